@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/health"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/maintenance"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/telemetry"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+)
+
+// AdminController serves operational endpoints for administrators
+type AdminController struct {
+	config       *config.Config
+	dbManager    *health.DatabaseManager
+	telemetry    *telemetry.Reporter
+	maintenance  *maintenance.Mode
+	auditService *audit.Service
+	logger       *logger.Logger
+}
+
+// NewAdminController creates a new admin controller
+func NewAdminController(cfg *config.Config, dbManager *health.DatabaseManager, telemetryReporter *telemetry.Reporter, maintenanceMode *maintenance.Mode, auditService *audit.Service, logger *logger.Logger) *AdminController {
+	return &AdminController{
+		config:       cfg,
+		dbManager:    dbManager,
+		telemetry:    telemetryReporter,
+		maintenance:  maintenanceMode,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// Routes declares the admin routes
+func (c *AdminController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/admin/config", Access: routing.Admin, Handler: c.GetConfig},
+		{Method: http.MethodGet, Path: "/admin/schema/status", Access: routing.Admin, Handler: c.GetSchemaStatus},
+		{Method: http.MethodPost, Path: "/admin/schema/repair-indexes", Access: routing.Admin, Handler: c.RepairIndexes},
+		{Method: http.MethodGet, Path: "/admin/telemetry/preview", Access: routing.Admin, Handler: c.PreviewTelemetry},
+		{Method: http.MethodGet, Path: "/admin/maintenance", Access: routing.Admin, Handler: c.GetMaintenance},
+		{Method: http.MethodPost, Path: "/admin/maintenance", Access: routing.Admin, Handler: c.SetMaintenance},
+	}
+}
+
+// GetConfig returns the effective configuration with secrets redacted
+func (c *AdminController) GetConfig(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"config":    config.Redact(c.config),
+	})
+}
+
+// GetSchemaStatus reports drift between the database and the schema the service
+// creates: missing or extra tables, columns and indexes, and invalid indexes
+func (c *AdminController) GetSchemaStatus(ctx *gin.Context) {
+	status, err := c.dbManager.SchemaStatus(ctx.Request.Context())
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Msg("Failed to read schema status")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read schema status"})
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
+
+// RepairIndexes starts rebuilding the missing and invalid expected indexes with
+// CREATE INDEX CONCURRENTLY. The build outlives the request, so it responds 202
+// with the indexes being rebuilt; progress is logged and shown by /schema/status.
+func (c *AdminController) RepairIndexes(ctx *gin.Context) {
+	indexes, err := c.dbManager.RepairIndexes(context.WithoutCancel(ctx.Request.Context()), c.logger)
+	if errors.Is(err, health.ErrRepairRunning) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Msg("Failed to start index repair")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start index repair"})
+		return
+	}
+
+	if len(indexes) == 0 {
+		ctx.JSON(http.StatusOK, gin.H{"indexes": indexes, "message": "No indexes need repair"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"indexes": indexes})
+}
+
+// PreviewTelemetry returns the exact usage report that is (or, when telemetry is
+// disabled, would be) sent, so operators can audit it
+func (c *AdminController) PreviewTelemetry(ctx *gin.Context) {
+	document, err := c.telemetry.Preview(ctx.Request.Context())
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Msg("Failed to build telemetry preview")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build telemetry preview"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"enabled":  c.telemetry.Enabled(),
+		"endpoint": c.telemetry.Endpoint(),
+		"document": json.RawMessage(document),
+	})
+}
+
+// GetMaintenance returns the maintenance switch as seen by this replica
+func (c *AdminController) GetMaintenance(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.maintenance.Status())
+}
+
+// SetMaintenanceRequest turns maintenance mode on or off. Duration, e.g. "15m",
+// makes it end on its own; without it maintenance lasts until disabled.
+type SetMaintenanceRequest struct {
+	Enabled  *bool  `json:"enabled" binding:"required"`
+	Duration string `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// SetMaintenance turns maintenance mode on or off. While it is on, writes get
+// 503 with the maintenance code and reads keep working. Other replicas pick the
+// change up within MAINTENANCE_POLL_INTERVAL.
+func (c *AdminController) SetMaintenance(ctx *gin.Context) {
+	var req SetMaintenanceRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration such as 15m"})
+			return
+		}
+	}
+
+	userID, _ := middleware.GetUserFromGinContext(ctx)
+	var status maintenance.Status
+	var err error
+	if *req.Enabled {
+		status, err = c.maintenance.Enable(ctx.Request.Context(), req.Reason, duration, userID)
+	} else {
+		status, err = c.maintenance.Disable(ctx.Request.Context())
+	}
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Msg("Failed to store maintenance mode")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store maintenance mode"})
+		return
+	}
+
+	action := "maintenance.disable"
+	if *req.Enabled {
+		action = "maintenance.enable"
+	}
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      userID,
+		Action:       action,
+		ResourceType: "system",
+		ResourceID:   "maintenance",
+		Details: map[string]interface{}{
+			"reason":   req.Reason,
+			"duration": req.Duration,
+		},
+	})
+
+	ctx.JSON(http.StatusOK, status)
+}
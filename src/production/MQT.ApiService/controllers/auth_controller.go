@@ -1,32 +1,38 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
 	service "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/auth"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuthController handles authentication requests
 type AuthController struct {
-	authService *service.AuthService
+	authService  *service.AuthService
+	auditService *audit.Service
 }
 
 // NewAuthController creates a new auth controller
-func NewAuthController(authService *service.AuthService) *AuthController {
+func NewAuthController(authService *service.AuthService, auditService *audit.Service) *AuthController {
 	return &AuthController{
-		authService: authService,
+		authService:  authService,
+		auditService: auditService,
 	}
 }
 
 // Register handles user registration
 func (h *AuthController) Register(c *gin.Context) {
 	var req service.RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -50,8 +56,7 @@ func (h *AuthController) Register(c *gin.Context) {
 // RegisterAdmin handles admin user registration
 func (h *AuthController) RegisterAdmin(c *gin.Context) {
 	var req service.RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -75,8 +80,7 @@ func (h *AuthController) RegisterAdmin(c *gin.Context) {
 // Login handles user login
 func (h *AuthController) Login(c *gin.Context) {
 	var req service.LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -103,6 +107,12 @@ func (h *AuthController) Login(c *gin.Context) {
 
 // RefreshTokens handles token refresh
 func (h *AuthController) RefreshTokens(c *gin.Context) {
+	// Impersonation sessions are deliberately short-lived and can't be extended
+	if h.authService.IsImpersonationToken(bearerToken(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "refresh is disabled for impersonation sessions"})
+		return
+	}
+
 	// Get refresh token from cookie
 	refreshToken, err := c.Cookie("refresh_token")
 	if err != nil {
@@ -163,10 +173,18 @@ func (h *AuthController) Profile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	profile, err := h.authService.Profile(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
 }
 
-// UpdateProfile handles updating the authenticated user's profile
+// UpdateProfile handles updating the authenticated user's profile. A new email
+// only takes effect once confirmed from that address, and a new username needs
+// the current password.
 func (h *AuthController) UpdateProfile(c *gin.Context) {
 	// Get user ID from context
 	userID, err := middleware.GetUserFromGinContext(c)
@@ -176,13 +194,13 @@ func (h *AuthController) UpdateProfile(c *gin.Context) {
 	}
 
 	var req struct {
-		Username string `json:"username,omitempty"`
-		Email    string `json:"email,omitempty"`
-		Password string `json:"password,omitempty"`
+		Username        string `json:"username,omitempty"`
+		Email           string `json:"email,omitempty"`
+		Password        string `json:"password,omitempty"`
+		CurrentPassword string `json:"current_password,omitempty"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -194,12 +212,17 @@ func (h *AuthController) UpdateProfile(c *gin.Context) {
 	}
 
 	// Update fields if provided
-	if req.Username != "" {
+	if req.Username != "" && req.Username != user.Username {
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required to change the username"})
+			return
+		}
+		if err := h.authService.VerifyPassword(user, req.CurrentPassword); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		user.Username = req.Username
 	}
-	if req.Email != "" {
-		user.Email = req.Email
-	}
 	if req.Password != "" {
 		// Hash the new password
 		hashedPassword, err := h.authService.HashPassword(req.Password)
@@ -217,30 +240,171 @@ func (h *AuthController) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedUser)
+	if req.Email != "" && req.Email != updatedUser.Email {
+		pending, err := h.authService.RequestEmailChange(c.Request.Context(), updatedUser, req.Email)
+		if err != nil {
+			c.JSON(emailChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		h.auditService.Record(c.Request.Context(), audit_models.AuditEvent{
+			ActorType:    audit_models.ActorTypeUser,
+			ActorID:      userID,
+			Action:       "user.email_change.request",
+			ResourceType: "user",
+			ResourceID:   userID,
+			Details: map[string]interface{}{
+				"expires_at": pending.ExpiresAt,
+			},
+		})
+	}
+
+	profile, err := h.authService.Profile(c.Request.Context(), updatedUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// ConfirmEmail applies a pending email change from the link emailed to the new address
+func (h *AuthController) ConfirmEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	user, err := h.authService.ConfirmEmailChange(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(emailChangeStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      user.UserID,
+		Action:       "user.email_change.confirm",
+		ResourceType: "user",
+		ResourceID:   user.UserID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address updated", "email": user.Email})
+}
+
+// CancelEmailChange drops the authenticated user's pending email change
+func (h *AuthController) CancelEmailChange(c *gin.Context) {
+	userID, err := middleware.GetUserFromGinContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.authService.CancelEmailChange(c.Request.Context(), userID); err != nil {
+		c.JSON(emailChangeStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      userID,
+		Action:       "user.email_change.cancel",
+		ResourceType: "user",
+		ResourceID:   userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pending email change cancelled"})
+}
+
+// emailChangeStatus maps email change errors to HTTP statuses
+func emailChangeStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrEmailUnchanged), errors.Is(err, service.ErrEmailChangeInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNoPendingEmailChange), errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrEmailTaken):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrEmailChangeExpired):
+		return http.StatusGone
+	case errors.Is(err, service.ErrEmailDelivery):
+		return http.StatusBadGateway
+	case errors.Is(err, service.ErrEmailChangeUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
-// RegisterRoutes registers the auth routes with Gin
-func (h *AuthController) RegisterRoutes(router *gin.Engine, authMiddleware *middleware.AuthMiddleware) {
-	// Public routes
-	auth := router.Group("/api/auth")
-	{
-		auth.POST("/register", h.Register)
-		auth.POST("/login", h.Login)
-		auth.POST("/refresh", h.RefreshTokens)
-		auth.POST("/logout", h.Logout)
+// Impersonate issues a short-lived token that acts as another user (admin only)
+func (h *AuthController) Impersonate(c *gin.Context) {
+	adminID, err := middleware.GetUserFromGinContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// No nested impersonation
+	if middleware.GetImpersonatorFromGinContext(c) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot impersonate from an impersonation session"})
+		return
+	}
+
+	targetUserID := c.Param("user_id")
+	response, err := h.authService.Impersonate(c.Request.Context(), adminID, targetUserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImpersonationTargetNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrImpersonationForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrImpersonationInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
 	}
 
-	// Protected routes
-	protected := auth.Group("", authMiddleware.Authenticate())
-	{
-		protected.GET("/profile", h.Profile)
-		protected.PATCH("/profile", h.UpdateProfile)
+	h.auditService.Record(c.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "user.impersonation.start",
+		ResourceType: "user",
+		ResourceID:   targetUserID,
+		Details: map[string]interface{}{
+			"token_id":   response.TokenID,
+			"expires_at": response.ExpiresAt,
+		},
+	})
+
+	c.Header(middleware.ImpersonatingHeader, targetUserID)
+	c.JSON(http.StatusOK, response)
+}
+
+// bearerToken returns the bearer token from the Authorization header, if any
+func bearerToken(c *gin.Context) string {
+	authHeader := c.GetHeader("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
 	}
+	return strings.TrimPrefix(authHeader, "Bearer ")
+}
 
-	// Admin-only routes (requires authentication + admin role)
-	adminOnly := auth.Group("", authMiddleware.Authenticate(), authMiddleware.RequireAdmin())
-	{
-		adminOnly.POST("/register/admin", h.RegisterAdmin)
+// Routes declares the auth routes
+func (h *AuthController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodPost, Path: "/api/auth/register", Access: routing.Public, Middleware: []gin.HandlerFunc{middleware.StrictJSON()}, Handler: h.Register},
+		{Method: http.MethodPost, Path: "/api/auth/login", Access: routing.Public, Handler: h.Login},
+		{Method: http.MethodPost, Path: "/api/auth/refresh", Access: routing.Public, Handler: h.RefreshTokens},
+		{Method: http.MethodPost, Path: "/api/auth/logout", Access: routing.Public, Handler: h.Logout},
+
+		{Method: http.MethodGet, Path: "/api/auth/profile", Access: routing.Authenticated, Handler: h.Profile},
+		{Method: http.MethodPatch, Path: "/api/auth/profile", Access: routing.Authenticated, Handler: h.UpdateProfile},
+		{Method: http.MethodDelete, Path: "/api/auth/profile/pending-email", Access: routing.Authenticated, Handler: h.CancelEmailChange},
+		{Method: http.MethodGet, Path: "/api/auth/confirm-email", Access: routing.Public, Handler: h.ConfirmEmail},
+
+		{Method: http.MethodPost, Path: "/api/auth/register/admin", Access: routing.Admin, Middleware: []gin.HandlerFunc{middleware.StrictJSON()}, Handler: h.RegisterAdmin},
+		{Method: http.MethodPost, Path: "/api/auth/impersonate/:user_id", Access: routing.Admin, Handler: h.Impersonate},
 	}
 }
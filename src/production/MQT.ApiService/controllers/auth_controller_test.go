@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	service "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/auth"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// stubUserRepo serves users by ID. Calls it doesn't implement panic.
+type stubUserRepo struct {
+	interfaces.UserRepository
+	users map[string]*auth_models.User
+}
+
+func (r *stubUserRepo) GetByID(_ context.Context, userID string) (*auth_models.User, error) {
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// recordingAuditRepo keeps the audit events created through it
+type recordingAuditRepo struct {
+	mu     sync.Mutex
+	events []audit_models.AuditEvent
+}
+
+func (r *recordingAuditRepo) Create(_ context.Context, event *audit_models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *recordingAuditRepo) recorded() []audit_models.AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]audit_models.AuditEvent(nil), r.events...)
+}
+
+// impersonationFixture is an AuthController over admin-1 and admin-2, user-1
+// and the deactivated user-2
+type impersonationFixture struct {
+	controller *AuthController
+	jwtService *jwt.Service
+	authMW     *middleware.AuthMiddleware
+	auditRepo  *recordingAuditRepo
+	audit      *audit.Service
+}
+
+func newImpersonationFixture(t *testing.T, allowAdminImpersonation bool) *impersonationFixture {
+	t.Helper()
+	users := &stubUserRepo{users: map[string]*auth_models.User{
+		"admin-1": {UserID: "admin-1", Username: "alice", Role: "admin", Active: true},
+		"admin-2": {UserID: "admin-2", Username: "bob", Role: "admin", Active: true},
+		"user-1":  {UserID: "user-1", Username: "carol", Email: "carol@example.com", Role: "user", Active: true},
+		"user-2":  {UserID: "user-2", Username: "dave", Role: "user", Active: false},
+	}}
+	jwtService := jwt.NewService(api_models.Config{
+		SecretKey:                  "test-secret",
+		AccessTokenDuration:        time.Hour,
+		RefreshTokenDuration:       24 * time.Hour,
+		ImpersonationTokenDuration: 15 * time.Minute,
+		Issuer:                     "test",
+	})
+	rbacService := rbac.NewService()
+	nop := zerolog.Nop()
+	auditRepo := &recordingAuditRepo{}
+	auditService := audit.NewService(auditRepo, &logger.Logger{Logger: &nop})
+	authService := service.NewAuthService(users, nil, jwtService, rbacService, nil, allowAdminImpersonation)
+	return &impersonationFixture{
+		controller: NewAuthController(authService, auditService),
+		jwtService: jwtService,
+		authMW:     middleware.NewAuthMiddleware(jwtService, rbacService, middleware.DefaultConfig()),
+		auditRepo:  auditRepo,
+		audit:      auditService,
+	}
+}
+
+// impersonate runs Impersonate of target as adminID, from an impersonation
+// session of impersonatorID when it is set
+func (f *impersonationFixture) impersonate(adminID, impersonatorID, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/auth/impersonate/"+target, nil)
+	ctx.Params = gin.Params{{Key: "user_id", Value: target}}
+	ctx.Set(string(middleware.UserIDContextKey), adminID)
+	ctx.Set(string(middleware.UserRoleContextKey), "admin")
+	if impersonatorID != "" {
+		ctx.Set(string(middleware.ImpersonatorContextKey), impersonatorID)
+	}
+	f.controller.Impersonate(ctx)
+	return w
+}
+
+// The token acts as the target with the target's role, names the admin, lasts
+// the impersonation duration and comes without a refresh token
+func TestImpersonate(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowAdmin   bool
+		impersonator string // set when the admin is already impersonating someone
+		target       string
+		wantStatus   int
+		wantRole     string
+	}{
+		{name: "user", target: "user-1", wantStatus: http.StatusOK, wantRole: "user"},
+		{name: "admin refused", target: "admin-2", wantStatus: http.StatusForbidden},
+		{name: "admin allowed", allowAdmin: true, target: "admin-2", wantStatus: http.StatusOK, wantRole: "admin"},
+		{name: "self", allowAdmin: true, target: "admin-1", wantStatus: http.StatusBadRequest},
+		{name: "deactivated", target: "user-2", wantStatus: http.StatusBadRequest},
+		{name: "unknown", target: "user-9", wantStatus: http.StatusNotFound},
+		{name: "nested", impersonator: "admin-2", target: "user-1", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newImpersonationFixture(t, tt.allowAdmin)
+			before := time.Now().Truncate(time.Second)
+			w := f.impersonate("admin-1", tt.impersonator, tt.target)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if events := f.auditRepo.recorded(); len(events) != 0 {
+					t.Errorf("refused impersonation audited: %+v", events)
+				}
+				return
+			}
+
+			var resp service.AuthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			claims, err := f.jwtService.ValidateAccessToken(resp.AccessToken)
+			if err != nil {
+				t.Fatalf("impersonation token doesn't validate: %v", err)
+			}
+			if claims.UserID != tt.target || claims.Role != tt.wantRole || claims.ImpersonatorID != "admin-1" {
+				t.Errorf("claims user %q role %q impersonator %q, want %q %q %q", claims.UserID, claims.Role, claims.ImpersonatorID, tt.target, tt.wantRole, "admin-1")
+			}
+			if claims.TokenID != resp.TokenID {
+				t.Errorf("claims token %q, response token %q", claims.TokenID, resp.TokenID)
+			}
+			if lifetime := claims.ExpiresAt.Sub(before); lifetime < 15*time.Minute || lifetime > 15*time.Minute+2*time.Second {
+				t.Errorf("token lasts %s, want 15m", lifetime)
+			}
+			if resp.ExpiresAt != claims.ExpiresAt.Unix() {
+				t.Errorf("response expires_at %d, token expires %d", resp.ExpiresAt, claims.ExpiresAt.Unix())
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("impersonation set a cookie: %s", w.Header().Get("Set-Cookie"))
+			}
+			if got := w.Header().Get(middleware.ImpersonatingHeader); got != tt.target {
+				t.Errorf("%s header %q, want %q", middleware.ImpersonatingHeader, got, tt.target)
+			}
+		})
+	}
+}
+
+// Starting a session is audited as the admin; what is done with the token is
+// audited as the target with the admin as impersonator
+func TestImpersonationAudit(t *testing.T) {
+	f := newImpersonationFixture(t, false)
+	w := f.impersonate("admin-1", "", "user-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp service.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/action", f.authMW.Authenticate(), func(c *gin.Context) {
+		userID, _ := middleware.GetUserFromGinContext(c)
+		f.audit.Record(c.Request.Context(), audit_models.AuditEvent{
+			ActorType: audit_models.ActorTypeUser,
+			ActorID:   userID,
+			Action:    "test.action",
+		})
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/action", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("action status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get(middleware.ImpersonatingHeader); got != "user-1" {
+		t.Errorf("%s header %q, want user-1", middleware.ImpersonatingHeader, got)
+	}
+
+	events := f.auditRepo.recorded()
+	if len(events) != 2 {
+		t.Fatalf("%d audit events, want 2: %+v", len(events), events)
+	}
+	start, action := events[0], events[1]
+	if start.Action != "user.impersonation.start" || start.ActorID != "admin-1" || start.ResourceID != "user-1" || start.ImpersonatorID != "" {
+		t.Errorf("start event %+v, want admin-1 starting on user-1", start)
+	}
+	if start.Details["token_id"] != resp.TokenID {
+		t.Errorf("start event token %v, want %s", start.Details["token_id"], resp.TokenID)
+	}
+	if action.ActorID != "user-1" || action.ImpersonatorID != "admin-1" {
+		t.Errorf("action attributed to %q impersonated by %q, want user-1 by admin-1", action.ActorID, action.ImpersonatorID)
+	}
+}
+
+// An impersonation session can't be extended through refresh, whatever
+// refresh cookie comes with it
+func TestRefreshRejectsImpersonation(t *testing.T) {
+	f := newImpersonationFixture(t, false)
+	impersonation, err := f.jwtService.GenerateImpersonationToken("user-1", "user", "admin-1")
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken: %v", err)
+	}
+	normal, err := f.jwtService.GenerateTokens("user-1", "user")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	other := jwt.NewService(api_models.Config{SecretKey: "other-secret", ImpersonationTokenDuration: time.Minute})
+	forged, err := other.GenerateImpersonationToken("user-1", "user", "admin-1")
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		bearer        string
+		impersonation bool // IsImpersonationToken
+		wantStatus    int  // of a refresh without a refresh cookie
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "access token", bearer: normal.AccessToken, wantStatus: http.StatusUnauthorized},
+		{name: "impersonation token", bearer: impersonation.AccessToken, impersonation: true, wantStatus: http.StatusForbidden},
+		{name: "impersonation token signed elsewhere", bearer: forged.AccessToken, wantStatus: http.StatusUnauthorized},
+		{name: "refresh token", bearer: normal.RefreshToken, wantStatus: http.StatusUnauthorized},
+	}
+	authService := service.NewAuthService(&stubUserRepo{}, nil, f.jwtService, rbac.NewService(), nil, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authService.IsImpersonationToken(tt.bearer); got != tt.impersonation {
+				t.Errorf("IsImpersonationToken() = %v, want %v", got, tt.impersonation)
+			}
+
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+			if tt.bearer != "" {
+				ctx.Request.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			f.controller.RefreshTokens(ctx)
+			if w.Code != tt.wantStatus {
+				t.Errorf("refresh status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	// A valid refresh cookie doesn't get an impersonation session past the check
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+	ctx.Request.Header.Set("Authorization", "Bearer "+impersonation.AccessToken)
+	ctx.Request.AddCookie(&http.Cookie{Name: "refresh_token", Value: normal.RefreshToken})
+	f.controller.RefreshTokens(ctx)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("refresh with a cookie status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+}
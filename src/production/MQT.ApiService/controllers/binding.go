@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+)
+
+// FieldError describes a single binding tag violation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// BindError is returned by decodeJSON and carries the HTTP status to respond with
+type BindError struct {
+	Status  int
+	Message string
+	Field   string       // set for unknown fields
+	Fields  []FieldError // set for validation failures
+}
+
+func (e *BindError) Error() string {
+	return e.Message
+}
+
+// Response returns the standard error body for the bind failure
+func (e *BindError) Response() gin.H {
+	body := gin.H{"error": e.Message}
+	if e.Field != "" {
+		body["field"] = e.Field
+	}
+	if len(e.Fields) > 0 {
+		body["fields"] = e.Fields
+	}
+	return body
+}
+
+// bindJSON decodes and validates the request body into obj. On failure it writes
+// the error response and returns false.
+func bindJSON(ctx *gin.Context, obj interface{}) bool {
+	if err := decodeJSON(ctx, obj); err != nil {
+		ctx.JSON(err.Status, err.Response())
+		return false
+	}
+	return true
+}
+
+// decodeJSON decodes the request body into obj, enforcing the body size limit and,
+// when strict mode is on for the route, rejecting unknown fields. Binding tags are
+// validated afterwards and reported per field.
+func decodeJSON(ctx *gin.Context, obj interface{}) (bindErr *BindError) {
+	defer func() {
+		if r := recover(); r != nil {
+			bindErr = &BindError{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid request body: %v", r)}
+		}
+	}()
+
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return &BindError{Status: http.StatusBadRequest, Message: "request body is required"}
+	}
+
+	body := io.Reader(ctx.Request.Body)
+	if limit := middleware.GetMaxBodyBytes(ctx); limit > 0 {
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		body = ctx.Request.Body
+	}
+
+	// Keep numbers in free-form fields (reading payloads, meta) as json.Number
+	// so they are stored exactly; see hardware_models.DecodePayload
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if middleware.IsStrictJSON(ctx) {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(obj); err != nil {
+		return jsonDecodeError(err)
+	}
+
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			return &BindError{
+				Status:  http.StatusBadRequest,
+				Message: "validation failed",
+				Fields:  fieldErrors(obj, validationErrs),
+			}
+		}
+		return &BindError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func jsonDecodeError(err error) *BindError {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &BindError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return &BindError{Status: http.StatusBadRequest, Message: "request body is required"}
+	case errors.As(err, &syntaxErr):
+		return &BindError{Status: http.StatusBadRequest, Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return &BindError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("field %q must be of type %s", typeErr.Field, typeErr.Type),
+			Field:   typeErr.Field,
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &BindError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("unknown field %q", field),
+			Field:   field,
+		}
+	default:
+		return &BindError{Status: http.StatusBadRequest, Message: "invalid request body: " + err.Error()}
+	}
+}
+
+func fieldErrors(obj interface{}, errs validator.ValidationErrors) []FieldError {
+	out := make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		field := jsonFieldName(obj, fe)
+		out = append(out, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(field, fe),
+		})
+	}
+	return out
+}
+
+// jsonFieldName maps a top-level struct field back to its JSON name so errors
+// use the names clients actually send
+func jsonFieldName(obj interface{}, fe validator.FieldError) string {
+	t := reflect.TypeOf(obj)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fe.Field()
+	}
+
+	sf, ok := t.FieldByName(fe.StructField())
+	if !ok {
+		return fe.Field()
+	}
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return fe.Field()
+	}
+	return name
+}
+
+func fieldErrorMessage(field string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", field)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s failed %s validation", field, fe.Tag())
+	}
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// newBindingRouter serves the Pi and device write routes as declared, behind
+// the global body binding middleware, over newMemoryController's repositories
+func newBindingRouter(t *testing.T, maxBodyBytes int64, strict bool) *gin.Engine {
+	t.Helper()
+	internal := newMemoryController(t)
+	nop := zerolog.Nop()
+	log := &logger.Logger{Logger: &nop}
+	pis := NewPiController(internal.piRepo, nil, nil, nil, nil, nil, log)
+	devices := NewDeviceController(internal.deviceRepo, internal.piRepo, internal.readingRepo, nil, nil, log)
+
+	router := gin.New()
+	router.Use(middleware.BodyBinding(maxBodyBytes, strict))
+	for _, route := range append(pis.Routes(), devices.Routes()...) {
+		if route.Method != http.MethodPost && route.Method != http.MethodPatch {
+			continue
+		}
+		handlers := append(append([]gin.HandlerFunc(nil), route.Middleware...), route.Handler)
+		router.Handle(route.Method, route.Path, handlers...)
+	}
+	return router
+}
+
+// Bodies that don't fit the request are refused with 400 naming the field, or
+// 413 when too large; routes marked strict refuse unknown fields even when the
+// global setting doesn't
+func TestBinding(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool // global STRICT_JSON
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantError  string
+		wantField  string       // for unknown fields and type errors
+		wantFields []FieldError // for tag violations, without messages
+	}{
+		{name: "valid device", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":3,"device_type":"sensor"}`, wantStatus: http.StatusCreated},
+		{name: "valid Pi", method: http.MethodPost, target: "/pis", body: `{"pi_id":"pi-3"}`, wantStatus: http.StatusCreated},
+
+		// Unknown fields
+		{name: "unknown device field", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":3,"device_type":"sensor","colour":"red"}`, wantStatus: http.StatusBadRequest, wantError: `unknown field "colour"`, wantField: "colour"},
+		{name: "unknown Pi field", method: http.MethodPost, target: "/pis", body: `{"pi_id":"pi-3","owner":"bob"}`, wantStatus: http.StatusBadRequest, wantError: `unknown field "owner"`, wantField: "owner"},
+		{name: "unknown field on a lenient route", method: http.MethodPatch, target: "/pis/pi-1/devices/0", body: `{"device_type":"probe","colour":"red"}`, wantStatus: http.StatusOK},
+		{name: "unknown field on a lenient route in strict mode", strict: true, method: http.MethodPatch, target: "/pis/pi-1/devices/0", body: `{"device_type":"probe","colour":"red"}`, wantStatus: http.StatusBadRequest, wantError: `unknown field "colour"`, wantField: "colour"},
+		{name: "unknown field inside meta", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":3,"device_type":"sensor","meta":{"colour":"red"}}`, wantStatus: http.StatusCreated},
+
+		// Oversize bodies
+		{name: "oversize device", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":3,"device_type":"sensor","meta":{"note":"` + strings.Repeat("x", 256) + `"}}`, wantStatus: http.StatusRequestEntityTooLarge, wantError: "request body exceeds 128 bytes"},
+		{name: "oversize Pi", method: http.MethodPost, target: "/pis", body: `{"pi_id":"` + strings.Repeat("x", 256) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantError: "request body exceeds 128 bytes"},
+
+		// Tag violations
+		{name: "missing device_type", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":3}`, wantStatus: http.StatusBadRequest, wantError: "validation failed", wantFields: []FieldError{{Field: "device_type", Rule: "required"}}},
+		{name: "negative device_id", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":-1,"device_type":"sensor"}`, wantStatus: http.StatusBadRequest, wantError: "validation failed", wantFields: []FieldError{{Field: "device_id", Rule: "min"}}},
+		{name: "every violation", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{}`, wantStatus: http.StatusBadRequest, wantError: "validation failed", wantFields: []FieldError{{Field: "device_id", Rule: "required"}, {Field: "device_type", Rule: "required"}}},
+		{name: "missing pi_id", method: http.MethodPost, target: "/pis", body: `{"user_id":""}`, wantStatus: http.StatusBadRequest, wantError: "validation failed", wantFields: []FieldError{{Field: "pi_id", Rule: "required"}}},
+
+		// Malformed bodies
+		{name: "wrong type", method: http.MethodPost, target: "/pis/pi-2/devices", body: `{"device_id":"3","device_type":"sensor"}`, wantStatus: http.StatusBadRequest, wantError: `field "device_id" must be of type int`, wantField: "device_id"},
+		{name: "malformed JSON", method: http.MethodPost, target: "/pis", body: `{"pi_id":`, wantStatus: http.StatusBadRequest, wantError: "invalid request body: unexpected EOF"},
+		{name: "empty body", method: http.MethodPost, target: "/pis", body: ``, wantStatus: http.StatusBadRequest, wantError: "request body is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newBindingRouter(t, 128, tt.strict)
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var resp struct {
+				Error  string       `json:"error"`
+				Field  string       `json:"field"`
+				Fields []FieldError `json:"fields"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Error != tt.wantError || resp.Field != tt.wantField {
+				t.Errorf("error %q on field %q, want %q on %q", resp.Error, resp.Field, tt.wantError, tt.wantField)
+			}
+			if len(resp.Fields) != len(tt.wantFields) {
+				t.Fatalf("fields %+v, want %+v", resp.Fields, tt.wantFields)
+			}
+			for n, want := range tt.wantFields {
+				if got := resp.Fields[n]; got.Field != want.Field || got.Rule != want.Rule || got.Message == "" {
+					t.Errorf("field error %d = %+v, want %s failing %s with a message", n, got, want.Field, want.Rule)
+				}
+			}
+		})
+	}
+}
@@ -7,84 +7,117 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/cacheinvalidation"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/units"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
-	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
 )
 
 // DeviceController handles Device management requests
 type DeviceController struct {
-	deviceRepo     interfaces.DeviceRepository
-	piRepo         interfaces.PiRepository
-	logger         *logger.Logger
-	authMiddleware *middleware.AuthMiddleware
+	deviceRepo  interfaces.DeviceRepository
+	piRepo      interfaces.PiRepository
+	readingRepo interfaces.ReadingRepository
+	caches      *cacheinvalidation.Bus
+	lookupKeys  []string
+	logger      *logger.Logger
+
+	payloadKeyCache *payloadKeyCache
 }
 
 // NewDeviceController creates a new device controller
-func NewDeviceController(deviceRepo interfaces.DeviceRepository, piRepo interfaces.PiRepository, logger *logger.Logger, authMiddleware *middleware.AuthMiddleware) *DeviceController {
+func NewDeviceController(deviceRepo interfaces.DeviceRepository, piRepo interfaces.PiRepository, readingRepo interfaces.ReadingRepository, caches *cacheinvalidation.Bus, lookupKeys []string, logger *logger.Logger) *DeviceController {
 	return &DeviceController{
-		deviceRepo:     deviceRepo,
-		piRepo:         piRepo,
-		logger:         logger,
-		authMiddleware: authMiddleware,
+		deviceRepo:  deviceRepo,
+		piRepo:      piRepo,
+		readingRepo: readingRepo,
+		caches:      caches,
+		lookupKeys:  lookupKeys,
+		logger:      logger,
+
+		payloadKeyCache: newPayloadKeyCache(),
 	}
 }
 
-// RegisterRoutes registers the device routes with Gin
-func (c *DeviceController) RegisterRoutes(router *gin.Engine) {
-	devices := router.Group("/pis/:pi_id/devices")
-	{
+// Routes declares the device and device type routes
+func (c *DeviceController) Routes() []routing.Route {
+	return []routing.Route{
 		// Admin only - create/update/delete
-		devices.POST("", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.CreateDevice)
-		devices.PATCH("/:device_id", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.UpdateDevice)
-		devices.DELETE("/:device_id", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.DeleteDevice)
+		{Method: http.MethodPost, Path: "/pis/:pi_id/devices", Access: routing.Admin, Middleware: []gin.HandlerFunc{middleware.StrictJSON()}, Handler: c.CreateDevice},
+		{Method: http.MethodPatch, Path: "/pis/:pi_id/devices/:device_id", Access: routing.Admin, Handler: c.UpdateDevice},
+		{Method: http.MethodDelete, Path: "/pis/:pi_id/devices/:device_id", Access: routing.Admin, Handler: c.DeleteDevice},
 
 		// Admin: all devices, User: devices from their PIs
-		devices.GET("", c.authMiddleware.Authenticate(), c.ListDevices)
-		devices.GET("/:device_id", c.authMiddleware.Authenticate(), c.GetDevice)
+		{Method: http.MethodGet, Path: "/pis/:pi_id/devices", Access: routing.Authenticated, Handler: c.ListDevices},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/devices/:device_id", Access: routing.Authenticated, Handler: c.GetDevice},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/devices/:device_id/current", Access: routing.Authenticated, Handler: c.GetCurrentReading},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/devices/:device_id/payload-keys", Access: routing.Authenticated, Handler: c.GetPayloadKeys},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/devices/:device_id/readings/summary", Access: routing.Authenticated, Handler: c.GetReadingSummary},
+
+		// Admin: all matches, User: matches on their PIs
+		{Method: http.MethodGet, Path: "/devices/lookup", Access: routing.Authenticated, Handler: c.LookupDevices},
+
+		// Admin only - fleet-wide view per device type
+		{Method: http.MethodGet, Path: "/device-types/:device_type/payload-keys", Access: routing.Admin, Handler: c.GetDeviceTypePayloadKeys},
+		{Method: http.MethodGet, Path: "/device-types/:device_type/units", Access: routing.Admin, Handler: c.GetDeviceTypeUnits},
+		{Method: http.MethodPut, Path: "/device-types/:device_type/units", Access: routing.Admin, Handler: c.UpdateDeviceTypeUnits},
 	}
 }
 
+// CreateDeviceRequest creates a device. Device IDs start at 0, so DeviceID is
+// a pointer to tell 0 from a missing field.
 type CreateDeviceRequest struct {
-	DeviceID   int    `json:"device_id" binding:"required"`
-	DeviceType string `json:"device_type" binding:"required"`
+	DeviceID   *int                   `json:"device_id" binding:"required,min=0"`
+	DeviceType string                 `json:"device_type" binding:"required"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
 }
 
 func (c *DeviceController) CreateDevice(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
 
 	var req CreateDeviceRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	if err := validateMetaUnits(req.Meta); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	device := hardware_models.Device{
 		PiID:       piID,
-		DeviceID:   req.DeviceID,
+		DeviceID:   *req.DeviceID,
 		DeviceType: req.DeviceType,
+		Meta:       req.Meta,
 		CreatedAt:  time.Now(),
 	}
 
-	if err := c.deviceRepo.CreateOrUpdateDevice(ctx, device); err != nil {
+	if err := c.deviceRepo.CreateOrUpdateDevice(ctx.Request.Context(), device); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.DeviceChanged(piID, device.DeviceID, ingest_models.CacheInvalidationCreated)
 
-	ctx.JSON(http.StatusCreated, device)
+	ctx.JSON(http.StatusCreated, api_models.NewDeviceResponse(device))
 }
 
 func (c *DeviceController) ListDevices(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "10"))
+	opts := interfaces.PageOptions{Page: page, PageSize: pageSize, IncludeTotal: includeTotal(ctx)}
 
 	// Check if user has access to this PI
 	userRole, _ := middleware.GetRoleFromGinContext(ctx)
 	if userRole != "admin" {
 		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
-		pi, err := c.piRepo.GetPi(ctx, piID)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -95,13 +128,108 @@ func (c *DeviceController) ListDevices(ctx *gin.Context) {
 		}
 	}
 
-	result, err := c.deviceRepo.ListDevicesByPi(ctx, piID, page, pageSize)
+	// include=current adds each device's latest reading in the same query
+	if ctx.Query("include") == "current" {
+		result, err := c.deviceRepo.ListDevicesWithLatest(ctx.Request.Context(), piID, opts)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if fields := parseFields(ctx); fields != nil {
+			if devices, ok := result.Items.([]hardware_models.DeviceWithLatest); ok {
+				for _, device := range devices {
+					if device.Current != nil {
+						device.Current.Payload = selectFields(device.Current.Payload, fields)
+					}
+				}
+			}
+		}
+		ctx.JSON(http.StatusOK, deviceWithLatestPage(result))
+		return
+	}
+
+	result, err := c.deviceRepo.ListDevicesByPi(ctx.Request.Context(), piID, opts)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	ctx.JSON(http.StatusOK, devicePage(result))
+}
+
+// CurrentReadingResponse is a device's latest reading and how old it is
+type CurrentReadingResponse struct {
+	Reading    api_models.ReadingResponse `json:"reading"`
+	AgeSeconds float64                    `json:"age_seconds"`
+}
+
+// GetCurrentReading returns the latest reading for a device
+func (c *DeviceController) GetCurrentReading(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+
+	// Check if user has access to this PI
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+		if err != nil || pi == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+			return
+		}
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	system, ok := parseUnitsSystem(ctx)
+	if !ok {
+		return
+	}
+	flattenDepth, ok := parseFlatten(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.deviceRepo.GetDevice(ctx.Request.Context(), piID, deviceID); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reading, err := c.readingRepo.GetLatestReading(ctx.Request.Context(), piID, deviceID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reading == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no readings for device"})
+		return
+	}
+
+	reading.Payload = selectFields(reading.Payload, parseFields(ctx))
+	readings := []hardware_models.Reading{*reading}
+	if err := applyUnits(ctx.Request.Context(), c.deviceRepo, piID, system, readings); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	applyFlatten(readings, flattenDepth)
+	reading = &readings[0]
+	if ctx.Query("include_received") != "true" {
+		reading.ReceivedAt = nil
+	}
+	ctx.JSON(http.StatusOK, CurrentReadingResponse{
+		Reading:    api_models.NewReadingResponse(*reading),
+		AgeSeconds: time.Since(reading.Ts).Seconds(),
+	})
 }
 
 func (c *DeviceController) GetDevice(ctx *gin.Context) {
@@ -113,7 +241,7 @@ func (c *DeviceController) GetDevice(ctx *gin.Context) {
 		return
 	}
 
-	device, err := c.deviceRepo.GetDevice(ctx, piID, deviceID)
+	device, err := c.deviceRepo.GetDevice(ctx.Request.Context(), piID, deviceID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
@@ -127,7 +255,7 @@ func (c *DeviceController) GetDevice(ctx *gin.Context) {
 	userRole, _ := middleware.GetRoleFromGinContext(ctx)
 	if userRole != "admin" {
 		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
-		pi, err := c.piRepo.GetPi(ctx, piID)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -138,11 +266,41 @@ func (c *DeviceController) GetDevice(ctx *gin.Context) {
 		}
 	}
 
-	ctx.JSON(http.StatusOK, device)
+	ctx.JSON(http.StatusOK, api_models.NewDeviceResponse(*device))
+}
+
+// LookupDevices finds devices by external identifiers in their meta, e.g.
+// /devices/lookup?meta.serial=ABC123. Users only see devices on their pis.
+func (c *DeviceController) LookupDevices(ctx *gin.Context) {
+	match, ok := parseMetaLookup(ctx, c.lookupKeys)
+	if !ok {
+		return
+	}
+
+	ownerID := ""
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		ownerID, _ = middleware.GetUserFromGinContext(ctx)
+	}
+
+	devices, err := c.deviceRepo.FindDevicesByMeta(ctx.Request.Context(), match, ownerID, metaLookupLimit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(devices) == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no devices match", "code": "not_found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api_models.ListResponse[api_models.DeviceResponse]{
+		Items: api_models.MapItems(devices, api_models.NewDeviceResponse),
+	})
 }
 
 type UpdateDeviceRequest struct {
-	DeviceType *string `json:"device_type,omitempty"`
+	DeviceType *string                 `json:"device_type,omitempty"`
+	Meta       *map[string]interface{} `json:"meta,omitempty"`
 }
 
 func (c *DeviceController) UpdateDevice(ctx *gin.Context) {
@@ -155,7 +313,7 @@ func (c *DeviceController) UpdateDevice(ctx *gin.Context) {
 	}
 
 	// Get existing device
-	existingDevice, err := c.deviceRepo.GetDevice(ctx, piID, deviceID)
+	existingDevice, err := c.deviceRepo.GetDevice(ctx.Request.Context(), piID, deviceID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
@@ -166,8 +324,7 @@ func (c *DeviceController) UpdateDevice(ctx *gin.Context) {
 	}
 
 	var req UpdateDeviceRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &req) {
 		return
 	}
 
@@ -176,12 +333,22 @@ func (c *DeviceController) UpdateDevice(ctx *gin.Context) {
 		existingDevice.DeviceType = *req.DeviceType
 	}
 
-	if err := c.deviceRepo.UpdateDevice(ctx, *existingDevice); err != nil {
+	// Replace meta if provided
+	if req.Meta != nil {
+		if err := validateMetaUnits(*req.Meta); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		existingDevice.Meta = *req.Meta
+	}
+
+	if err := c.deviceRepo.UpdateDevice(ctx.Request.Context(), *existingDevice); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.DeviceChanged(piID, deviceID, ingest_models.CacheInvalidationUpdated)
 
-	ctx.JSON(http.StatusOK, existingDevice)
+	ctx.JSON(http.StatusOK, api_models.NewDeviceResponse(*existingDevice))
 }
 
 func (c *DeviceController) DeleteDevice(ctx *gin.Context) {
@@ -195,7 +362,26 @@ func (c *DeviceController) DeleteDevice(ctx *gin.Context) {
 
 	cascade := ctx.DefaultQuery("cascade", "false") == "true"
 
-	if err := c.deviceRepo.DeleteDevice(ctx, piID, deviceID, cascade); err != nil {
+	// Without cascade a device that still has readings is refused, with the
+	// same summary GetReadingSummary reports so the client can show what a
+	// cascading delete would remove
+	if !cascade {
+		summary, err := c.readingSummary(ctx, piID, deviceID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if summary.Count > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":    "device has readings; delete with cascade=true to remove them",
+				"code":     "device_has_readings",
+				"readings": summary,
+			})
+			return
+		}
+	}
+
+	if err := c.deviceRepo.DeleteDevice(ctx.Request.Context(), piID, deviceID, cascade); err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
 			return
@@ -203,6 +389,70 @@ func (c *DeviceController) DeleteDevice(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.DeviceChanged(piID, deviceID, ingest_models.CacheInvalidationDeleted)
 
 	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
 }
+
+type UpdateDeviceTypeUnitsRequest struct {
+	Units map[string]interface{} `json:"units"`
+}
+
+// GetDeviceTypeUnits returns the payload units declared for a device type
+func (c *DeviceController) GetDeviceTypeUnits(ctx *gin.Context) {
+	deviceType := ctx.Param("device_type")
+
+	dt, err := c.deviceRepo.GetDeviceType(ctx.Request.Context(), deviceType)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	declared := map[string]interface{}{}
+	if dt != nil && dt.Meta != nil {
+		if fieldUnits, ok := dt.Meta["units"].(map[string]interface{}); ok {
+			declared = fieldUnits
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"device_type": deviceType, "units": declared})
+}
+
+// UpdateDeviceTypeUnits replaces the payload units declared for a device type.
+// Devices of the type inherit them unless their own meta.units overrides a field.
+func (c *DeviceController) UpdateDeviceTypeUnits(ctx *gin.Context) {
+	deviceType := ctx.Param("device_type")
+
+	var req UpdateDeviceTypeUnitsRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	if _, err := units.ParseDeclared(req.Units); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dt, err := c.deviceRepo.GetDeviceType(ctx.Request.Context(), deviceType)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if dt == nil {
+		dt = &hardware_models.DeviceType{DeviceType: deviceType}
+	}
+	if dt.Meta == nil {
+		dt.Meta = map[string]interface{}{}
+	}
+	if req.Units == nil {
+		req.Units = map[string]interface{}{}
+	}
+	dt.Meta["units"] = req.Units
+
+	if err := c.deviceRepo.UpsertDeviceType(ctx.Request.Context(), dt); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dt)
+}
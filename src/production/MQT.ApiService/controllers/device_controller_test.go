@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateDeviceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		deviceID int // created when the request passes
+	}{
+		{"device 0", `{"device_id":0,"device_type":"sensor"}`, http.StatusCreated, 0},
+		{"device 7", `{"device_id":7,"device_type":"sensor"}`, http.StatusCreated, 7},
+		{"missing device", `{"device_type":"sensor"}`, http.StatusBadRequest, 0},
+		{"negative device", `{"device_id":-1,"device_type":"sensor"}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			internal := newMemoryController(t)
+			c := &DeviceController{deviceRepo: internal.deviceRepo, piRepo: internal.piRepo, readingRepo: internal.readingRepo}
+
+			w := serve(c.CreateDevice, http.MethodPost, tt.body, gin.Param{Key: "pi_id", Value: "pi-2"})
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusCreated {
+				return
+			}
+			if _, err := c.deviceRepo.GetDevice(context.Background(), "pi-2", tt.deviceID); err != nil {
+				t.Errorf("device %d not created: %v", tt.deviceID, err)
+			}
+		})
+	}
+}
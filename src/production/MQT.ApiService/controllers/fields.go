@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// Flattening limits for ?flatten=true. Maps nested deeper than the depth are
+// kept whole under their dotted prefix.
+const (
+	defaultFlattenDepth = 8
+	maxFlattenDepth     = 32
+)
+
+// parseFields returns the payload keys requested with ?fields=a,b, or nil when
+// the whole payload should be returned
+func parseFields(ctx *gin.Context) []string {
+	raw := ctx.Query("fields")
+	if raw == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// selectFields returns the subset of payload named by fields. Missing keys are
+// left out rather than returned as null. A nil fields list returns payload as is.
+// A field that isn't a top-level key is read as a dot path into nested objects
+// (env.temp), keeping the nesting in the result; \. escapes a dot inside a key.
+func selectFields(payload map[string]interface{}, fields []string) map[string]interface{} {
+	if fields == nil || payload == nil {
+		return payload
+	}
+
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := payload[field]; ok {
+			selected[field] = value
+			continue
+		}
+
+		path := splitFieldPath(field)
+		if len(path) < 2 {
+			continue
+		}
+		if value, ok := lookupPath(payload, path); ok {
+			setPath(selected, path, value)
+		}
+	}
+	return selected
+}
+
+// splitFieldPath splits a dot path into keys. A backslash escapes the next
+// character, so a\.b is the single key "a.b". Empty keys make the path invalid.
+func splitFieldPath(field string) []string {
+	var path []string
+	var key strings.Builder
+	escaped := false
+	for _, r := range field {
+		switch {
+		case escaped:
+			key.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			if key.Len() == 0 {
+				return nil
+			}
+			path = append(path, key.String())
+			key.Reset()
+		default:
+			key.WriteRune(r)
+		}
+	}
+	if escaped || key.Len() == 0 {
+		return nil
+	}
+	return append(path, key.String())
+}
+
+// lookupPath walks path through nested objects. Arrays and scalars end the walk.
+func lookupPath(payload map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = payload
+	for _, key := range path {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath stores value at path in target, creating intermediate objects
+func setPath(target map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := target[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			target[key] = next
+		}
+		target = next
+	}
+	target[path[len(path)-1]] = value
+}
+
+// flattenPayload returns payload with nested objects flattened into dotted keys
+// (env.temp), escaping dots inside keys as \. so the names work with ?fields=.
+// Objects below maxDepth levels and arrays are kept as values.
+func flattenPayload(payload map[string]interface{}, maxDepth int) map[string]interface{} {
+	if payload == nil {
+		return nil
+	}
+	flat := make(map[string]interface{}, len(payload))
+	flattenInto(flat, "", payload, 1, maxDepth)
+	return flat
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, object map[string]interface{}, depth, maxDepth int) {
+	for key, value := range object {
+		name := strings.ReplaceAll(key, ".", `\.`)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 && depth < maxDepth {
+			flattenInto(flat, name, nested, depth+1, maxDepth)
+			continue
+		}
+		flat[name] = value
+	}
+}
+
+// parseFlatten reads ?flatten=true and ?flatten_depth=N. It returns 0 when the
+// payload should be left nested. On a bad depth it writes a 400 and returns false.
+func parseFlatten(ctx *gin.Context) (int, bool) {
+	if ctx.Query("flatten") != "true" {
+		return 0, true
+	}
+
+	depthStr := ctx.Query("flatten_depth")
+	if depthStr == "" {
+		return defaultFlattenDepth, true
+	}
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 1 || depth > maxFlattenDepth {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "flatten_depth must be between 1 and " + strconv.Itoa(maxFlattenDepth)})
+		return 0, false
+	}
+	return depth, true
+}
+
+// applyFlatten flattens each reading's payload when depth is positive
+func applyFlatten(readings []hardware_models.Reading, depth int) {
+	if depth <= 0 {
+		return
+	}
+	for i := range readings {
+		readings[i].Payload = flattenPayload(readings[i].Payload, depth)
+	}
+}
@@ -1,68 +1,153 @@
 package controllers
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/health"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/maintenance"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/startup"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/storagemonitor"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
-	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
 )
 
+// readinessCheckTimeout bounds the database checks behind /health/ready
+const readinessCheckTimeout = 2 * time.Second
+
 // HealthController handles health and stats requests
 type HealthController struct {
 	readingRepo    interfaces.ReadingRepository
 	piRepo         interfaces.PiRepository
 	logger         *logger.Logger
-	authMiddleware *middleware.AuthMiddleware
+	isReady        func() bool
+	storageMonitor *storagemonitor.LatencyMonitor
+	healthChecker  *health.HealthChecker
+	startup        *startup.Tracker
+	maintenance    *maintenance.Mode
+	inclusiveTo    bool // default for inclusive_to on the stats endpoint
 }
 
-// NewHealthController creates a new health controller
-func NewHealthController(readingRepo interfaces.ReadingRepository, piRepo interfaces.PiRepository, logger *logger.Logger, authMiddleware *middleware.AuthMiddleware) *HealthController {
+// NewHealthController creates a new health controller. isReady reports whether the
+// service is accepting traffic; it turns false as soon as shutdown begins.
+func NewHealthController(readingRepo interfaces.ReadingRepository, piRepo interfaces.PiRepository, logger *logger.Logger, isReady func() bool, storageMonitor *storagemonitor.LatencyMonitor, healthChecker *health.HealthChecker, startupTracker *startup.Tracker, maintenanceMode *maintenance.Mode, inclusiveTo bool) *HealthController {
 	return &HealthController{
 		readingRepo:    readingRepo,
 		piRepo:         piRepo,
 		logger:         logger,
-		authMiddleware: authMiddleware,
+		isReady:        isReady,
+		storageMonitor: storageMonitor,
+		healthChecker:  healthChecker,
+		startup:        startupTracker,
+		maintenance:    maintenanceMode,
+		inclusiveTo:    inclusiveTo,
 	}
 }
 
-// RegisterRoutes registers the health routes with Gin
-func (c *HealthController) RegisterRoutes(router *gin.Engine) {
-	// Public health endpoints
-	router.GET("/health/live", c.HealthLive)
-	router.GET("/health/ready", c.HealthReady)
-	router.GET("/metrics", c.Metrics)
-
-	// Stats endpoint with RBAC
-	router.GET("/stats/summary", c.authMiddleware.Authenticate(), c.GetSummaryStats)
+// Routes declares the health, metrics and stats routes
+func (c *HealthController) Routes() []routing.Route {
+	return []routing.Route{
+		// Public health endpoints
+		{Method: http.MethodGet, Path: "/health/live", Access: routing.Public, Handler: c.HealthLive},
+		{Method: http.MethodGet, Path: "/health/ready", Access: routing.Public, Handler: c.HealthReady},
+		{Method: http.MethodGet, Path: "/health/details", Access: routing.Public, Handler: c.HealthDetails},
+		{Method: http.MethodGet, Path: "/metrics", Access: routing.Public, Handler: c.Metrics},
+
+		// Stats endpoint with RBAC
+		{Method: http.MethodGet, Path: "/stats/summary", Access: routing.Authenticated, Handler: c.GetSummaryStats},
+	}
 }
 
 func (c *HealthController) HealthLive(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{
 		"status": "ok",
+		"build":  buildinfo.Get(),
 	})
 }
 
 func (c *HealthController) HealthReady(ctx *gin.Context) {
-	// This would typically check database connectivity
-	// For now, we'll assume it's ready
+	if c.isReady != nil && !c.isReady() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting_down",
+		})
+		return
+	}
+
+	// Ready only once the database answers and CreateTables has completed
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	if err := c.healthChecker.CheckDatabaseHealth(checkCtx); err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "not_ready",
+			"db":     false,
+			"error":  err.Error(),
+		})
+		return
+	}
+	if err := c.healthChecker.CheckSchema(checkCtx); err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "not_ready",
+			"db":     true,
+			"schema": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"status": "ready",
 		"db":     true,
-		"mqtt":   true,
+		"schema": true,
+	})
+}
+
+// HealthDetails reports component state for on-call, including whether reading
+// inserts are over their latency budget and whether startup steps are still being
+// retried. Degraded components still return 200.
+func (c *HealthController) HealthDetails(ctx *gin.Context) {
+	status := "ok"
+	storage := c.storageMonitor.Status()
+	if storage.Degraded || c.startup.Degraded() {
+		status = "degraded"
+	}
+	if c.isReady != nil && !c.isReady() {
+		status = "shutting_down"
+	}
+
+	code := http.StatusOK
+	if status == "shutting_down" {
+		code = http.StatusServiceUnavailable
+	}
+
+	ctx.JSON(code, gin.H{
+		"status":           status,
+		"timestamp":        time.Now().UTC().Format(time.RFC3339),
+		"build":            buildinfo.Get(),
+		"storage_degraded": storage.Degraded,
+		"insert_latency":   storage,
+		"startup":          c.startup.Status(),
+		"maintenance":      c.maintenance.Status(),
 	})
 }
 
+// Metrics serves the Prometheus registry, including database pool statistics
 func (c *HealthController) Metrics(ctx *gin.Context) {
-	// Basic metrics endpoint - can be enhanced with Prometheus metrics
-	ctx.String(http.StatusOK, "# HELP mqtt_ingestor_health Health status of MQTT ingestor\n# TYPE mqtt_ingestor_health gauge\nmqtt_ingestor_health 1\n")
+	promhttp.Handler().ServeHTTP(ctx.Writer, ctx.Request)
 }
 
 func (c *HealthController) GetSummaryStats(ctx *gin.Context) {
 	piID := ctx.Query("pi_id")
-	deviceID := ctx.Query("device_id")
+	deviceID, ok := parseDeviceIDQuery(ctx)
+	if !ok {
+		return
+	}
 	fromStr := ctx.Query("from")
 	toStr := ctx.Query("to")
 
@@ -74,7 +159,7 @@ func (c *HealthController) GetSummaryStats(ctx *gin.Context) {
 
 		// If pi_id is specified, check if user has access to it
 		if piID != "" {
-			pi, err := c.piRepo.GetPi(ctx, piID)
+			pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 			if err != nil {
 				ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 				return
@@ -108,8 +193,9 @@ func (c *HealthController) GetSummaryStats(ctx *gin.Context) {
 			params.To = &to
 		}
 	}
+	applyInclusiveTo(ctx, &params, c.inclusiveTo)
 
-	result, err := c.readingRepo.GetSummaryStats(ctx, params)
+	result, err := c.readingRepo.GetSummaryStats(ctx.Request.Context(), params)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
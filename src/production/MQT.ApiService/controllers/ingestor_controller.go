@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/ingestors"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// IngestorController collects ingestor heartbeats and shows which instances
+// are live and how far behind they are
+type IngestorController struct {
+	registry *ingestors.Registry
+}
+
+// NewIngestorController creates a new ingestor controller
+func NewIngestorController(registry *ingestors.Registry) *IngestorController {
+	return &IngestorController{registry: registry}
+}
+
+// Routes declares the ingestor coordination routes
+func (c *IngestorController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodPost, Path: "/internal/ingestors/heartbeat", Access: routing.Service, Handler: c.Heartbeat},
+		{Method: http.MethodGet, Path: "/admin/ingestors", Access: routing.Admin, Handler: c.ListIngestors},
+	}
+}
+
+// Heartbeat records an ingestor's latest report
+func (c *IngestorController) Heartbeat(ctx *gin.Context) {
+	var req ingest_models.IngestorHeartbeat
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	if !c.registry.Record(req) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many ingestor instances registered"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"recorded": true})
+}
+
+// ListIngestors returns the live ingestor instances and their totals
+func (c *IngestorController) ListIngestors(ctx *gin.Context) {
+	instances, summary := c.registry.List()
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":   instances,
+		"summary": summary,
+	})
+}
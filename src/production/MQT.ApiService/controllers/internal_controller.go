@@ -1,201 +1,817 @@
 package controllers
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/cacheinvalidation"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/ingeststats"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/payloadschema"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 )
 
 // InternalController handles internal API endpoints for service-to-service communication
 type InternalController struct {
-	piRepo      interfaces.PiRepository
-	deviceRepo  interfaces.DeviceRepository
-	readingRepo interfaces.ReadingRepository
+	piRepo            interfaces.PiRepository
+	deviceRepo        interfaces.DeviceRepository
+	readingRepo       interfaces.ReadingRepository
+	pendingDeviceRepo interfaces.PendingDeviceRepository
+	ingestErrorRepo   interfaces.IngestErrorRepository
+	auditService      *audit.Service
+	ingestStats       *ingeststats.Counter
+	payloadValidator  *payloadschema.Validator
+	caches            *cacheinvalidation.Bus
+	config            config.InternalConfig
 }
 
 // NewInternalController creates a new internal controller
-func NewInternalController(piRepo interfaces.PiRepository, deviceRepo interfaces.DeviceRepository, readingRepo interfaces.ReadingRepository) *InternalController {
+func NewInternalController(piRepo interfaces.PiRepository, deviceRepo interfaces.DeviceRepository, readingRepo interfaces.ReadingRepository, pendingDeviceRepo interfaces.PendingDeviceRepository, ingestErrorRepo interfaces.IngestErrorRepository, auditService *audit.Service, ingestStats *ingeststats.Counter, payloadValidator *payloadschema.Validator, caches *cacheinvalidation.Bus, cfg config.InternalConfig) *InternalController {
 	return &InternalController{
-		piRepo:      piRepo,
-		deviceRepo:  deviceRepo,
-		readingRepo: readingRepo,
+		piRepo:            piRepo,
+		deviceRepo:        deviceRepo,
+		readingRepo:       readingRepo,
+		pendingDeviceRepo: pendingDeviceRepo,
+		ingestErrorRepo:   ingestErrorRepo,
+		auditService:      auditService,
+		ingestStats:       ingestStats,
+		payloadValidator:  payloadValidator,
+		caches:            caches,
+		config:            cfg,
 	}
 }
 
-// ValidatePiRequest represents the request to validate a Pi
-type ValidatePiRequest struct {
-	PiID string `json:"pi_id" binding:"required"`
+// UpsertPiItem is a single entry of a provisioning batch
+type UpsertPiItem struct {
+	PiID string                 `json:"pi_id"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
 }
 
-// ValidatePiResponse represents the response from Pi validation
-type ValidatePiResponse struct {
-	Exists bool   `json:"exists"`
+// Statuses reported per item by UpsertPis
+const (
+	upsertStatusCreated = "created"
+	upsertStatusUpdated = "updated"
+	upsertStatusInvalid = "invalid"
+)
+
+// UpsertPiResult reports the outcome for a single provisioning entry
+type UpsertPiResult struct {
+	PiID   string `json:"pi_id"`
+	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 }
 
-// ValidateDeviceRequest represents the request to validate a Device
-type ValidateDeviceRequest struct {
-	PiID     string `json:"pi_id" binding:"required"`
-	DeviceID int    `json:"device_id" binding:"required"`
+// UpsertPisResponse represents the response from a provisioning batch
+type UpsertPisResponse struct {
+	Results []UpsertPiResult `json:"results"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Invalid int              `json:"invalid"`
 }
 
-// ValidateDeviceResponse represents the response from Device validation
-type ValidateDeviceResponse struct {
-	Exists bool   `json:"exists"`
-	Error  string `json:"error,omitempty"`
-}
+// UpsertPis creates or updates a batch of Pis for trusted provisioning systems.
+// Ownership (user_id) is intentionally not settable here.
+func (c *InternalController) UpsertPis(ctx *gin.Context) {
+	var items []UpsertPiItem
+	if !bindJSON(ctx, &items) {
+		return
+	}
 
-// CreateReadingRequest represents the request to create a reading
-type CreateReadingRequest struct {
-	PiID     string                 `json:"pi_id" binding:"required"`
-	DeviceID int                    `json:"device_id" binding:"required"`
-	Ts       string                 `json:"ts" binding:"required"`
-	Payload  map[string]interface{} `json:"payload" binding:"required"`
-}
+	if len(items) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "at least one pi is required"})
+		return
+	}
+	if c.config.PiBatchMaxSize > 0 && len(items) > c.config.PiBatchMaxSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("batch size %d exceeds maximum of %d", len(items), c.config.PiBatchMaxSize),
+		})
+		return
+	}
+
+	results := make([]UpsertPiResult, len(items))
+	seen := make(map[string]bool, len(items))
+	valid := make([]hardware_models.Pi, 0, len(items))
+	validIdx := make([]int, 0, len(items))
+	now := time.Now()
+
+	for idx, item := range items {
+		results[idx].PiID = item.PiID
+		switch {
+		case !hardware_models.IsValidPiID(item.PiID):
+			results[idx].Status = upsertStatusInvalid
+			results[idx].Error = "invalid pi_id format"
+		case seen[item.PiID]:
+			results[idx].Status = upsertStatusInvalid
+			results[idx].Error = "duplicate pi_id in batch"
+		default:
+			seen[item.PiID] = true
+			valid = append(valid, hardware_models.Pi{PiID: item.PiID, Meta: item.Meta, CreatedAt: now})
+			validIdx = append(validIdx, idx)
+		}
+	}
+
+	upserted, err := c.piRepo.CreateOrUpdatePis(ctx.Request.Context(), valid)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upsert pis: " + err.Error()})
+		return
+	}
+
+	serviceName, _ := middleware.GetServiceNameFromGinContext(ctx)
+	response := UpsertPisResponse{Results: results}
+
+	for n, result := range upserted {
+		status := upsertStatusUpdated
+		action := "pi.provision.update"
+		if result.Created {
+			status = upsertStatusCreated
+			action = "pi.provision.create"
+			c.caches.PiChanged(result.PiID, ingest_models.CacheInvalidationCreated)
+		}
+		results[validIdx[n]].Status = status
+
+		c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+			ActorType:    audit_models.ActorTypeService,
+			ActorID:      serviceName,
+			Action:       action,
+			ResourceType: "pi",
+			ResourceID:   result.PiID,
+		})
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case upsertStatusCreated:
+			response.Created++
+		case upsertStatusUpdated:
+			response.Updated++
+		default:
+			response.Invalid++
+		}
+	}
 
-// CreateReadingResponse represents the response from reading creation
-type CreateReadingResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	ctx.JSON(http.StatusOK, response)
 }
 
 // ValidatePi checks if a Pi exists
 func (c *InternalController) ValidatePi(ctx *gin.Context) {
-	var req ValidatePiRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, ValidatePiResponse{
+	var req ingest_models.ValidatePiRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.ValidatePiResponse{
 			Exists: false,
-			Error:  "Invalid request: " + err.Error(),
+			Error:  "Invalid request: " + err.Message,
 		})
 		return
 	}
 
-	// Check if Pi exists
-	_, err := c.piRepo.GetPi(ctx, req.PiID)
+	// A failed lookup is not an answer, so the ingestor retries it
+	status, err := c.piStatus(ctx.Request.Context(), req.PiID)
 	if err != nil {
-		ctx.JSON(http.StatusOK, ValidatePiResponse{
+		ctx.JSON(http.StatusInternalServerError, ingest_models.ValidatePiResponse{
 			Exists: false,
-			Error:  "",
+			Error:  "Failed to look up Pi: " + err.Error(),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, ValidatePiResponse{
-		Exists: true,
+	ctx.JSON(http.StatusOK, ingest_models.ValidatePiResponse{
+		Exists: status != ingest_models.PiStatusNotFound,
+		Status: status,
 		Error:  "",
 	})
 }
 
+// piStatus returns whether readings for the Pi may be stored, as one of the
+// ingest_models.PiStatus* values. Only a missing row means the Pi doesn't
+// exist; any other repository error is returned.
+func (c *InternalController) piStatus(ctx context.Context, piID string) (string, error) {
+	pi, err := c.piRepo.GetPi(ctx, piID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && pi == nil) {
+		return ingest_models.PiStatusNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Readings for unowned Pis are invisible to every non-admin, so optionally refuse them
+	if c.config.RequireOwnedPi && pi.UserID == "" {
+		return ingest_models.PiStatusUnassigned, nil
+	}
+	return ingest_models.PiStatusOK, nil
+}
+
 // ValidateDevice checks if a Device exists for a given Pi
 func (c *InternalController) ValidateDevice(ctx *gin.Context) {
-	var req ValidateDeviceRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, ValidateDeviceResponse{
+	var req ingest_models.ValidateDeviceRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.ValidateDeviceResponse{
 			Exists: false,
-			Error:  "Invalid request: " + err.Error(),
+			Error:  "Invalid request: " + err.Message,
 		})
 		return
 	}
 
-	// Check if Device exists
-	_, err := c.deviceRepo.GetDevice(ctx, req.PiID, req.DeviceID)
+	exists, err := c.deviceExists(ctx.Request.Context(), req.PiID, *req.DeviceID)
 	if err != nil {
-		ctx.JSON(http.StatusOK, ValidateDeviceResponse{
+		ctx.JSON(http.StatusInternalServerError, ingest_models.ValidateDeviceResponse{
 			Exists: false,
-			Error:  "",
+			Error:  "Failed to look up Device: " + err.Error(),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, ValidateDeviceResponse{
-		Exists: true,
+	ctx.JSON(http.StatusOK, ingest_models.ValidateDeviceResponse{
+		Exists: exists,
 		Error:  "",
 	})
 }
 
+// deviceExists reports whether the Pi has the device. As for Pis, only a
+// missing row means it doesn't.
+func (c *InternalController) deviceExists(ctx context.Context, piID string, deviceID int) (bool, error) {
+	device, err := c.deviceRepo.GetDevice(ctx, piID, deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return device != nil, nil
+}
+
+// maxValidateItems bounds a validation batch; each distinct device takes two
+// bind parameters and Postgres allows 65535 per statement
+const maxValidateItems = 10000
+
+// ValidateBatch validates the Pis and devices of an ingest flush with two
+// queries however many items it has: one for the distinct Pis and one for the
+// distinct devices of the Pis that exist. Repeated items are looked up once and
+// each gets its own result, in request order.
+func (c *InternalController) ValidateBatch(ctx *gin.Context) {
+	var req ingest_models.ValidateBatchRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.ValidateBatchResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+	if len(req.Items) > maxValidateItems {
+		ctx.JSON(http.StatusRequestEntityTooLarge, ingest_models.ValidateBatchResponse{
+			Error: fmt.Sprintf("batch size %d exceeds maximum of %d", len(req.Items), maxValidateItems),
+		})
+		return
+	}
+
+	var piIDs []string
+	seenPis := make(map[string]bool)
+	for _, item := range req.Items {
+		if !seenPis[item.PiID] {
+			seenPis[item.PiID] = true
+			piIDs = append(piIDs, item.PiID)
+		}
+	}
+	owners, err := c.piRepo.GetPiOwners(ctx.Request.Context(), piIDs)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.ValidateBatchResponse{
+			Error: "Failed to look up Pis: " + err.Error(),
+		})
+		return
+	}
+
+	var keys []interfaces.DeviceKey
+	seenDevices := make(map[interfaces.DeviceKey]bool)
+	for _, item := range req.Items {
+		if _, piExists := owners[item.PiID]; !piExists || item.DeviceID == nil {
+			continue
+		}
+		key := interfaces.DeviceKey{PiID: item.PiID, DeviceID: *item.DeviceID}
+		if seenDevices[key] {
+			continue
+		}
+		seenDevices[key] = true
+		keys = append(keys, key)
+	}
+	devices, err := c.deviceRepo.ExistingDevices(ctx.Request.Context(), keys)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.ValidateBatchResponse{
+			Error: "Failed to look up devices: " + err.Error(),
+		})
+		return
+	}
+
+	results := make([]ingest_models.ValidateResult, len(req.Items))
+	for n, item := range req.Items {
+		result := ingest_models.ValidateResult{PiID: item.PiID, DeviceID: item.DeviceID, PiStatus: ingest_models.PiStatusNotFound}
+		if owner, ok := owners[item.PiID]; ok {
+			result.PiExists = true
+			result.PiStatus = ingest_models.PiStatusOK
+			// As in ValidatePi, readings for unowned Pis are optionally refused
+			if c.config.RequireOwnedPi && owner == "" {
+				result.PiStatus = ingest_models.PiStatusUnassigned
+			}
+			if item.DeviceID != nil {
+				result.DeviceExists = devices[interfaces.DeviceKey{PiID: item.PiID, DeviceID: *item.DeviceID}]
+			}
+		}
+		results[n] = result
+	}
+	ctx.JSON(http.StatusOK, ingest_models.ValidateBatchResponse{Results: results})
+}
+
+// Pis per registry snapshot page, by default and at most
+const (
+	defaultRegistrySnapshotLimit = 1000
+	maxRegistrySnapshotLimit     = 5000
+)
+
+// RegistrySnapshot returns a page of the Pis readings are accepted for, with
+// the IDs of their devices, so the ingestor can fill its validation cache
+// before traffic arrives. Unowned Pis are left out when INGEST_REQUIRE_OWNED_PI
+// is set, as ValidatePi refuses them. updated_since (RFC3339) keeps only Pis
+// created since, or with a device created since; limit caps the Pis per page,
+// and cursor continues from the previous page's next_cursor.
+func (c *InternalController) RegistrySnapshot(ctx *gin.Context) {
+	page := interfaces.RegistryPage{OwnedOnly: c.config.RequireOwnedPi}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultRegistrySnapshotLimit)))
+	if err != nil || limit < 1 {
+		ctx.JSON(http.StatusBadRequest, ingest_models.RegistrySnapshotResponse{Error: "limit must be a positive integer"})
+		return
+	}
+	page.Limit = min(limit, maxRegistrySnapshotLimit)
+
+	if v := ctx.Query("updated_since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ingest_models.RegistrySnapshotResponse{Error: "invalid updated_since: expected RFC3339"})
+			return
+		}
+		page.UpdatedSince = &since
+	}
+	if v := ctx.Query("cursor"); v != "" {
+		after, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(after) == 0 {
+			ctx.JSON(http.StatusBadRequest, ingest_models.RegistrySnapshotResponse{Error: "invalid cursor"})
+			return
+		}
+		page.After = string(after)
+	}
+
+	piIDs, err := c.piRepo.ListAllPiIDs(ctx.Request.Context(), page)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.RegistrySnapshotResponse{Error: "Failed to list Pis: " + err.Error()})
+		return
+	}
+	keys, err := c.deviceRepo.ListAllDeviceKeys(ctx.Request.Context(), piIDs)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.RegistrySnapshotResponse{Error: "Failed to list devices: " + err.Error()})
+		return
+	}
+
+	devices := make(map[string][]int, len(piIDs))
+	for _, key := range keys {
+		devices[key.PiID] = append(devices[key.PiID], key.DeviceID)
+	}
+	response := ingest_models.RegistrySnapshotResponse{Pis: make([]ingest_models.RegistryPi, len(piIDs))}
+	for n, piID := range piIDs {
+		response.Pis[n] = ingest_models.RegistryPi{PiID: piID, DeviceIDs: devices[piID]}
+		if response.Pis[n].DeviceIDs == nil {
+			response.Pis[n].DeviceIDs = []int{}
+		}
+	}
+	if len(piIDs) == page.Limit {
+		response.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(piIDs[len(piIDs)-1]))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RecordDiscoveredDevice records a device announced on a Pi's discovery topic
+// as pending approval. Devices that are already registered are left alone.
+func (c *InternalController) RecordDiscoveredDevice(ctx *gin.Context) {
+	var req ingest_models.DiscoveredDeviceRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.DiscoveredDeviceResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), req.PiID)
+	if err != nil || pi == nil {
+		ctx.JSON(http.StatusOK, ingest_models.DiscoveredDeviceResponse{Status: ingest_models.DiscoveryStatusPiNotFound})
+		return
+	}
+
+	if _, err := c.deviceRepo.GetDevice(ctx.Request.Context(), req.PiID, *req.DeviceID); err == nil {
+		ctx.JSON(http.StatusOK, ingest_models.DiscoveredDeviceResponse{Status: ingest_models.DiscoveryStatusRegistered})
+		return
+	}
+
+	err = c.pendingDeviceRepo.Record(ctx.Request.Context(), hardware_models.PendingDevice{
+		PiID:       req.PiID,
+		DeviceID:   *req.DeviceID,
+		DeviceType: req.DeviceType,
+		Firmware:   req.Firmware,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.DiscoveredDeviceResponse{
+			Error: "Failed to record discovered device: " + err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ingest_models.DiscoveredDeviceResponse{Status: ingest_models.DiscoveryStatusPending})
+}
+
+// AutoRegisterDevice creates a device for the first reading of an unknown
+// device on a known Pi, marking it auto_registered in its meta. Unknown Pis
+// are refused, never created, and a device that already exists is left as it
+// is, so concurrent requests for the same device are safe.
+func (c *InternalController) AutoRegisterDevice(ctx *gin.Context) {
+	var req ingest_models.AutoRegisterDeviceRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.AutoRegisterDeviceResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), req.PiID)
+	if err != nil || pi == nil {
+		ctx.JSON(http.StatusOK, ingest_models.AutoRegisterDeviceResponse{Status: ingest_models.AutoRegisterStatusPiNotFound})
+		return
+	}
+
+	created, err := c.deviceRepo.CreateDeviceIfAbsent(ctx.Request.Context(), hardware_models.Device{
+		PiID:       req.PiID,
+		DeviceID:   *req.DeviceID,
+		DeviceType: req.DeviceType,
+		Meta:       map[string]interface{}{ingest_models.DeviceMetaAutoRegistered: true},
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.AutoRegisterDeviceResponse{
+			Error: "Failed to auto-register device: " + err.Error(),
+		})
+		return
+	}
+
+	status := ingest_models.AutoRegisterStatusExists
+	if created {
+		status = ingest_models.AutoRegisterStatusCreated
+		c.caches.DeviceChanged(req.PiID, *req.DeviceID, ingest_models.CacheInvalidationCreated)
+	}
+	ctx.JSON(http.StatusOK, ingest_models.AutoRegisterDeviceResponse{Status: status})
+}
+
 // CreateReading creates a reading
 func (c *InternalController) CreateReading(ctx *gin.Context) {
-	var req CreateReadingRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, CreateReadingResponse{
+	var req ingest_models.CreateReadingRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.CreateReadingResponse{
 			Success: false,
-			Error:   "Invalid request: " + err.Error(),
+			Error:   "Invalid request: " + err.Message,
 		})
 		return
 	}
 
-	// Parse timestamp
-	ts, err := parseTimeString(req.Ts)
+	reading, err := readingFromRequest(req)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, CreateReadingResponse{
+		ctx.JSON(http.StatusBadRequest, ingest_models.CreateReadingResponse{
 			Success: false,
-			Error:   "Invalid timestamp format: " + err.Error(),
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Create reading
-	reading := hardware_models.Reading{
-		PiID:     req.PiID,
-		DeviceID: req.DeviceID,
-		Ts:       ts,
-		Payload:  req.Payload,
+	var validation *payloadschema.Result
+	if c.config.ValidatePayloads {
+		validation = c.payloadValidator.Check(ctx.Request.Context(), reading.PiID, reading.DeviceID, reading.Payload)
+		if validation.Rejected() {
+			ctx.JSON(http.StatusUnprocessableEntity, ingest_models.CreateReadingResponse{
+				Success:    false,
+				Error:      fmt.Sprintf("Payload violates %s schema version %d", validation.DeviceType, validation.SchemaVersion),
+				Violations: validation.Violations,
+			})
+			return
+		}
 	}
 
-	if err := c.readingRepo.CreateReading(ctx, reading); err != nil {
-		ctx.JSON(http.StatusInternalServerError, CreateReadingResponse{
+	if err := c.readingRepo.CreateReading(ctx.Request.Context(), reading); err != nil {
+		// A replay of a stored reading; it is not counted again
+		if errors.Is(err, interfaces.ErrDuplicateReading) {
+			ctx.JSON(http.StatusConflict, ingest_models.CreateReadingResponse{
+				Success: false,
+				Error:   "Reading already exists",
+			})
+			return
+		}
+		// Deleted since the ingestor validated it
+		if errors.Is(err, interfaces.ErrReadingDeviceNotFound) {
+			ctx.JSON(http.StatusNotFound, ingest_models.CreateReadingResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Device %d does not exist for Pi %s", reading.DeviceID, reading.PiID),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, ingest_models.CreateReadingResponse{
 			Success: false,
 			Error:   "Failed to create reading: " + err.Error(),
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, CreateReadingResponse{
+	c.ingestStats.Record(reading.PiID, reading.DeviceID)
+
+	response := ingest_models.CreateReadingResponse{
 		Success: true,
 		Error:   "",
-	})
+	}
+	if validation.Flagged() {
+		c.payloadValidator.RecordViolation(ctx.Request.Context(), reading, validation)
+		response.Violations = validation.Violations
+	}
+
+	ctx.JSON(http.StatusCreated, response)
 }
 
-// RegisterRoutes registers the internal API routes
-func (c *InternalController) RegisterRoutes(router *gin.Engine) {
-	// Internal API group with service-to-service authentication
-	internal := router.Group("/internal")
-	internal.Use(middleware.ServiceAuthMiddleware())
+// readingFromRequest parses the timestamps of a create reading request
+func readingFromRequest(req ingest_models.CreateReadingRequest) (hardware_models.Reading, error) {
+	ts, err := ingest_models.ParseTime(string(req.Ts))
+	if err != nil {
+		return hardware_models.Reading{}, fmt.Errorf("Invalid timestamp format: %w", err)
+	}
+
+	reading := hardware_models.Reading{
+		PiID:     req.PiID,
+		DeviceID: *req.DeviceID,
+		Ts:       ts,
+		Payload:  req.Payload,
+	}
+
+	if req.ReceivedAt != "" {
+		receivedAt, err := ingest_models.ParseTime(string(req.ReceivedAt))
+		if err != nil {
+			return hardware_models.Reading{}, fmt.Errorf("Invalid received_at format: %w", err)
+		}
+		reading.ReceivedAt = &receivedAt
+	}
+	return reading, nil
+}
 
-	// Pi validation endpoint
-	internal.POST("/pis/validate", c.ValidatePi)
+// maxReadingBatch bounds a reading batch; each reading takes five bind
+// parameters and Postgres allows 65535 per statement
+const maxReadingBatch = 5000
 
-	// Device validation endpoint
-	internal.POST("/devices/validate", c.ValidateDevice)
+// CreateReadings creates a batch of readings with one insert. Readings that
+// can't be stored (bad timestamps, schema rejections, devices deleted since
+// validation, duplicates) are listed with their index and reason, and the
+// rest are still stored, so the ingestor can report each failure on its
+// error topic.
+func (c *InternalController) CreateReadings(ctx *gin.Context) {
+	var req ingest_models.CreateReadingsRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.CreateReadingsResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+	if len(req.Readings) > maxReadingBatch {
+		ctx.JSON(http.StatusRequestEntityTooLarge, ingest_models.CreateReadingsResponse{
+			Error: fmt.Sprintf("batch size %d exceeds maximum of %d", len(req.Readings), maxReadingBatch),
+		})
+		return
+	}
 
-	// Reading creation endpoint
-	internal.POST("/readings", c.CreateReading)
+	response, err := c.storeReadings(ctx.Request.Context(), req.Readings)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.CreateReadingsResponse{
+			Error: "Failed to create readings: " + err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
 }
 
-// parseTimeString parses a time string in RFC3339 format
-func parseTimeString(timeStr string) (time.Time, error) {
-	// Try RFC3339 format first
-	if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
-		return t, nil
+// storeReadings stores the readings of a batch with one insert, returning the
+// ones that couldn't be stored by index. The error is only for a failed
+// insert, when none were stored.
+func (c *InternalController) storeReadings(ctx context.Context, items []ingest_models.CreateReadingRequest) (ingest_models.CreateReadingsResponse, error) {
+	var failed []ingest_models.ReadingFailure
+	readings := make([]hardware_models.Reading, 0, len(items))
+	indexes := make([]int, 0, len(items)) // position in items of each of readings
+	flagged := make(map[int]*payloadschema.Result)
+
+	for n, item := range items {
+		reading, err := readingFromRequest(item)
+		if err != nil {
+			failed = append(failed, ingest_models.ReadingFailure{
+				Index:    n,
+				PiID:     item.PiID,
+				DeviceID: *item.DeviceID,
+				Ts:       string(item.Ts),
+				Reason:   ingest_models.ReadingFailureInvalid,
+				Error:    err.Error(),
+			})
+			continue
+		}
+
+		if c.config.ValidatePayloads {
+			validation := c.payloadValidator.Check(ctx, reading.PiID, reading.DeviceID, reading.Payload)
+			if validation.Rejected() {
+				failed = append(failed, ingest_models.ReadingFailure{
+					Index:      n,
+					PiID:       item.PiID,
+					DeviceID:   *item.DeviceID,
+					Ts:         string(item.Ts),
+					Reason:     ingest_models.ReadingFailureSchemaViolation,
+					Error:      fmt.Sprintf("Payload violates %s schema version %d", validation.DeviceType, validation.SchemaVersion),
+					Violations: validation.Violations,
+				})
+				continue
+			}
+			if validation.Flagged() {
+				flagged[len(readings)] = validation
+			}
+		}
+
+		readings = append(readings, reading)
+		indexes = append(indexes, n)
 	}
 
-	// Try other common formats
-	formats := []string{
-		"2006-01-02T15:04:05Z",
-		"2006-01-02T15:04:05.000Z",
-		"2006-01-02 15:04:05",
+	result, err := c.readingRepo.CreateReadings(ctx, readings)
+	if err != nil {
+		return ingest_models.CreateReadingsResponse{}, err
 	}
 
-	for _, format := range formats {
-		if t, err := time.Parse(format, timeStr); err == nil {
-			return t, nil
+	rejected := make(map[int]bool, len(result.Failed))
+	for _, failure := range result.Failed {
+		rejected[failure.Index] = true
+		failed = append(failed, ingest_models.ReadingFailure{
+			Index:    indexes[failure.Index],
+			PiID:     failure.PiID,
+			DeviceID: failure.DeviceID,
+			Ts:       string(items[indexes[failure.Index]].Ts),
+			Reason:   failure.Reason,
+			Error:    failure.Error,
+		})
+	}
+	for n, reading := range readings {
+		if rejected[n] {
+			continue
+		}
+		c.ingestStats.Record(reading.PiID, reading.DeviceID)
+		if validation, ok := flagged[n]; ok {
+			c.payloadValidator.RecordViolation(ctx, reading, validation)
 		}
 	}
+	sort.Slice(failed, func(a, b int) bool { return failed[a].Index < failed[b].Index })
+
+	return ingest_models.CreateReadingsResponse{
+		Inserted: result.Inserted,
+		Failed:   failed,
+	}, nil
+}
 
-	return time.Time{}, fmt.Errorf("unable to parse time string: %s", timeStr)
+// maxLivenessEntries bounds a liveness batch; each entry takes three bind
+// parameters and Postgres allows 65535 per statement
+const maxLivenessEntries = 20000
+
+// TouchLiveness records when each device in an ingest flush last sent a
+// reading, in one UPDATE for the whole flush instead of a write per reading.
+// Entries repeated for the same device are merged.
+func (c *InternalController) TouchLiveness(ctx *gin.Context) {
+	var req ingest_models.LivenessRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.LivenessResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+	if len(req.Entries) > maxLivenessEntries {
+		ctx.JSON(http.StatusRequestEntityTooLarge, ingest_models.LivenessResponse{
+			Error: fmt.Sprintf("batch size %d exceeds maximum of %d", len(req.Entries), maxLivenessEntries),
+		})
+		return
+	}
+
+	type deviceKey struct {
+		piID     string
+		deviceID int
+	}
+	index := make(map[deviceKey]int, len(req.Entries))
+	entries := make([]interfaces.DeviceLiveness, 0, len(req.Entries))
+	readings := 0
+	for _, entry := range req.Entries {
+		readings += entry.Count
+		key := deviceKey{entry.PiID, *entry.DeviceID}
+		if n, ok := index[key]; ok {
+			if entry.LastTs.After(entries[n].LastTs) {
+				entries[n].LastTs = entry.LastTs
+			}
+			continue
+		}
+		index[key] = len(entries)
+		entries = append(entries, interfaces.DeviceLiveness{PiID: entry.PiID, DeviceID: *entry.DeviceID, LastTs: entry.LastTs})
+	}
+
+	result, err := c.deviceRepo.TouchLiveness(ctx.Request.Context(), entries)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.LivenessResponse{
+			Error: "Failed to record liveness: " + err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ingest_models.LivenessResponse{
+		Devices:  result.Devices,
+		Pis:      result.Pis,
+		Readings: readings,
+	})
+}
+
+// maxIngestErrorReports bounds a batch of ingestor error reports
+const maxIngestErrorReports = 1000
+
+// ReportIngestError stores one error the ingestor published to a Pi
+func (c *InternalController) ReportIngestError(ctx *gin.Context) {
+	var report ingest_models.IngestErrorReport
+	if err := decodeJSON(ctx, &report); err != nil {
+		ctx.JSON(err.Status, ingest_models.IngestErrorsResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+	c.storeIngestErrors(ctx, []ingest_models.IngestErrorReport{report})
+}
+
+// ReportIngestErrors stores a batch of errors the ingestor published to Pis
+// with one insert
+func (c *InternalController) ReportIngestErrors(ctx *gin.Context) {
+	var req ingest_models.IngestErrorBatchRequest
+	if err := decodeJSON(ctx, &req); err != nil {
+		ctx.JSON(err.Status, ingest_models.IngestErrorsResponse{
+			Error: "Invalid request: " + err.Message,
+		})
+		return
+	}
+	if len(req.Errors) > maxIngestErrorReports {
+		ctx.JSON(http.StatusRequestEntityTooLarge, ingest_models.IngestErrorsResponse{
+			Error: fmt.Sprintf("batch size %d exceeds maximum of %d", len(req.Errors), maxIngestErrorReports),
+		})
+		return
+	}
+	c.storeIngestErrors(ctx, req.Errors)
+}
+
+func (c *InternalController) storeIngestErrors(ctx *gin.Context, reports []ingest_models.IngestErrorReport) {
+	if err := c.ingestErrorRepo.CreateMany(ctx.Request.Context(), reports); err != nil {
+		ctx.JSON(http.StatusInternalServerError, ingest_models.IngestErrorsResponse{
+			Error: "Failed to store ingest errors: " + err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, ingest_models.IngestErrorsResponse{Stored: len(reports)})
+}
+
+// Routes declares the internal service-to-service routes. Their own deadline,
+// body limit and concurrency cap keep ingest bursts from starving the public API.
+func (c *InternalController) Routes() []routing.Route {
+	concurrencyLimit := middleware.ConcurrencyLimit(c.config.MaxConcurrent, middleware.GroupInternal)
+	guards := func(extra ...gin.HandlerFunc) []gin.HandlerFunc {
+		return append([]gin.HandlerFunc{
+			middleware.RequestTimeout(c.config.RequestTimeout),
+			middleware.BodyLimit(c.config.MaxBodyBytes),
+			concurrencyLimit,
+		}, extra...)
+	}
+	piBatchLimiter := middleware.NewRateLimiter(c.config.PiBatchRateLimit, time.Minute)
+
+	return []routing.Route{
+		{Method: http.MethodPost, Path: "/internal/pis/validate", Access: routing.Service, Middleware: guards(), Handler: c.ValidatePi},
+		{Method: http.MethodPost, Path: "/internal/devices/validate", Access: routing.Service, Middleware: guards(), Handler: c.ValidateDevice},
+		{Method: http.MethodPost, Path: "/internal/validate/batch", Access: routing.Service, Middleware: guards(), Handler: c.ValidateBatch},
+		{Method: http.MethodGet, Path: "/internal/registry/snapshot", Access: routing.Service, Middleware: guards(), Handler: c.RegistrySnapshot},
+		{Method: http.MethodPost, Path: "/internal/devices/discovered", Access: routing.Service, Middleware: guards(), Handler: c.RecordDiscoveredDevice},
+		{Method: http.MethodPost, Path: "/internal/devices/auto-register", Access: routing.Service, Middleware: guards(), Handler: c.AutoRegisterDevice},
+		{Method: http.MethodPost, Path: "/internal/readings", Access: routing.Service, Middleware: guards(middleware.StrictJSON()), Handler: c.CreateReading},
+		{Method: http.MethodPost, Path: "/internal/readings/batch", Access: routing.Service, Middleware: guards(middleware.StrictJSON()), Handler: c.CreateReadings},
+		{Method: http.MethodPost, Path: "/internal/liveness", Access: routing.Service, Middleware: guards(), Handler: c.TouchLiveness},
+		{Method: http.MethodPost, Path: "/internal/ingest-errors", Access: routing.Service, Middleware: guards(), Handler: c.ReportIngestError},
+		{Method: http.MethodPost, Path: "/internal/ingest-errors/batch", Access: routing.Service, Middleware: guards(), Handler: c.ReportIngestErrors},
+		{Method: http.MethodPost, Path: "/internal/pis", Access: routing.Service, Middleware: guards(middleware.RateLimit(piBatchLimiter)), Handler: c.UpsertPis},
+	}
 }
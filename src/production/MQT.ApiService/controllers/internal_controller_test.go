@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+	memory "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Memory"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// stubPiRepo answers every GetPi with the same Pi and error
+type stubPiRepo struct {
+	interfaces.PiRepository
+	pi  *hardware_models.Pi
+	err error
+}
+
+func (r *stubPiRepo) GetPi(_ context.Context, _ string) (*hardware_models.Pi, error) {
+	return r.pi, r.err
+}
+
+// serve runs handler for one JSON request with the given path parameters and
+// returns the recorded response
+func serve(handler gin.HandlerFunc, method, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(method, "/", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Params = params
+	handler(ctx)
+	return w
+}
+
+// A missing Pi must be reported as not_found so the ingestor publishes
+// pi_not_found, whether the repository says so with sql.ErrNoRows or, as it
+// once did, with a nil Pi and no error.
+func TestValidatePi(t *testing.T) {
+	tests := []struct {
+		name           string
+		repo           stubPiRepo
+		requireOwned   bool
+		wantCode       int
+		wantExists     bool
+		wantStatus     string
+		wantErrorEmpty bool
+	}{
+		{
+			name:           "missing pi",
+			repo:           stubPiRepo{err: sql.ErrNoRows},
+			wantCode:       http.StatusOK,
+			wantStatus:     ingest_models.PiStatusNotFound,
+			wantErrorEmpty: true,
+		},
+		{
+			name:           "wrapped missing pi",
+			repo:           stubPiRepo{err: fmt.Errorf("get pi: %w", sql.ErrNoRows)},
+			wantCode:       http.StatusOK,
+			wantStatus:     ingest_models.PiStatusNotFound,
+			wantErrorEmpty: true,
+		},
+		{
+			name:           "nil pi without error",
+			repo:           stubPiRepo{},
+			wantCode:       http.StatusOK,
+			wantStatus:     ingest_models.PiStatusNotFound,
+			wantErrorEmpty: true,
+		},
+		{
+			name:     "lookup failure",
+			repo:     stubPiRepo{err: errors.New("connection refused")},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "owned pi",
+			repo:           stubPiRepo{pi: &hardware_models.Pi{PiID: "pi-1", UserID: "user-1"}},
+			requireOwned:   true,
+			wantCode:       http.StatusOK,
+			wantExists:     true,
+			wantStatus:     ingest_models.PiStatusOK,
+			wantErrorEmpty: true,
+		},
+		{
+			name:           "unowned pi",
+			repo:           stubPiRepo{pi: &hardware_models.Pi{PiID: "pi-1"}},
+			requireOwned:   true,
+			wantCode:       http.StatusOK,
+			wantExists:     true,
+			wantStatus:     ingest_models.PiStatusUnassigned,
+			wantErrorEmpty: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo
+			c := &InternalController{piRepo: &repo, config: config.InternalConfig{RequireOwnedPi: tt.requireOwned}}
+
+			w := serve(c.ValidatePi, http.MethodPost, `{"pi_id":"pi-1"}`)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			var resp ingest_models.ValidatePiResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Exists != tt.wantExists {
+				t.Errorf("exists = %v, want %v", resp.Exists, tt.wantExists)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if (resp.Error == "") != tt.wantErrorEmpty {
+				t.Errorf("error = %q", resp.Error)
+			}
+		})
+	}
+}
+
+// stubPendingDeviceRepo keeps the devices recorded as discovered
+type stubPendingDeviceRepo struct {
+	interfaces.PendingDeviceRepository
+	recorded []hardware_models.PendingDevice
+}
+
+func (r *stubPendingDeviceRepo) Record(_ context.Context, device hardware_models.PendingDevice) error {
+	r.recorded = append(r.recorded, device)
+	return nil
+}
+
+// newMemoryController returns an InternalController over in-memory
+// repositories holding pi-1, with device 0, and pi-2, with no devices
+func newMemoryController(t *testing.T) *InternalController {
+	t.Helper()
+	store := memory.NewStore()
+	c := &InternalController{
+		piRepo:            memory.NewPiRepository(store),
+		deviceRepo:        memory.NewDeviceRepository(store),
+		readingRepo:       memory.NewReadingRepository(store),
+		pendingDeviceRepo: &stubPendingDeviceRepo{},
+	}
+	ctx := context.Background()
+	for _, piID := range []string{"pi-1", "pi-2"} {
+		if err := c.piRepo.CreateOrUpdatePi(ctx, hardware_models.Pi{PiID: piID, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateOrUpdatePi(%s): %v", piID, err)
+		}
+	}
+	if err := c.deviceRepo.CreateOrUpdateDevice(ctx, hardware_models.Device{PiID: "pi-1", DeviceID: 0, DeviceType: "sensor", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateOrUpdateDevice: %v", err)
+	}
+	return c
+}
+
+// Device IDs start at 0, so every endpoint taking a device_id must accept 0
+// while still refusing a missing or negative one
+func TestDeviceIDZero(t *testing.T) {
+	reading := func(deviceField string) string {
+		return `{"pi_id":"pi-1",` + deviceField + `"ts":"2024-01-01T00:00:00Z","payload":{"t":1}}`
+	}
+	readingStored := func(t *testing.T, c *InternalController, _ string) {
+		if latest, err := c.readingRepo.GetLatestReading(context.Background(), "pi-1", 0); err != nil || latest == nil {
+			t.Errorf("no reading stored for device 0: %v", err)
+		}
+	}
+	deviceCreated := func(t *testing.T, c *InternalController, _ string) {
+		if _, err := c.deviceRepo.GetDevice(context.Background(), "pi-2", 0); err != nil {
+			t.Errorf("device 0 not created: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		handler  func(c *InternalController, ctx *gin.Context)
+		body     string
+		wantCode int
+		check    func(t *testing.T, c *InternalController, body string) // run when the request passes
+	}{
+		{
+			name:     "reading",
+			handler:  (*InternalController).CreateReading,
+			body:     reading(`"device_id":0,`),
+			wantCode: http.StatusCreated,
+			check:    readingStored,
+		},
+		{
+			name:     "reading without device",
+			handler:  (*InternalController).CreateReading,
+			body:     reading(``),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "reading with negative device",
+			handler:  (*InternalController).CreateReading,
+			body:     reading(`"device_id":-1,`),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "batch",
+			handler:  (*InternalController).CreateReadings,
+			body:     `{"readings":[` + reading(`"device_id":0,`) + `]}`,
+			wantCode: http.StatusOK,
+			check: func(t *testing.T, c *InternalController, body string) {
+				var resp ingest_models.CreateReadingsResponse
+				if err := json.Unmarshal([]byte(body), &resp); err != nil || resp.Inserted != 1 || len(resp.Failed) != 0 {
+					t.Errorf("batch response %s, want 1 inserted", body)
+				}
+				readingStored(t, c, body)
+			},
+		},
+		{
+			name:     "batch without device",
+			handler:  (*InternalController).CreateReadings,
+			body:     `{"readings":[` + reading(``) + `]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "auto-register",
+			handler:  (*InternalController).AutoRegisterDevice,
+			body:     `{"pi_id":"pi-2","device_id":0,"device_type":"sensor"}`,
+			wantCode: http.StatusOK,
+			check:    deviceCreated,
+		},
+		{
+			name:     "auto-register without device",
+			handler:  (*InternalController).AutoRegisterDevice,
+			body:     `{"pi_id":"pi-2","device_type":"sensor"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "discovered",
+			handler:  (*InternalController).RecordDiscoveredDevice,
+			body:     `{"pi_id":"pi-2","device_id":0,"device_type":"sensor"}`,
+			wantCode: http.StatusOK,
+			check: func(t *testing.T, c *InternalController, _ string) {
+				recorded := c.pendingDeviceRepo.(*stubPendingDeviceRepo).recorded
+				if len(recorded) != 1 || recorded[0].DeviceID != 0 {
+					t.Errorf("recorded %+v, want device 0", recorded)
+				}
+			},
+		},
+		{
+			name:     "discovered with negative device",
+			handler:  (*InternalController).RecordDiscoveredDevice,
+			body:     `{"pi_id":"pi-2","device_id":-1,"device_type":"sensor"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "liveness",
+			handler:  (*InternalController).TouchLiveness,
+			body:     `{"entries":[{"pi_id":"pi-1","device_id":0,"last_ts":"2024-01-01T00:00:00Z","count":1}]}`,
+			wantCode: http.StatusOK,
+			check: func(t *testing.T, _ *InternalController, body string) {
+				var resp ingest_models.LivenessResponse
+				if err := json.Unmarshal([]byte(body), &resp); err != nil || resp.Devices != 1 {
+					t.Errorf("liveness response %s, want 1 device", body)
+				}
+			},
+		},
+		{
+			name:     "liveness without device",
+			handler:  (*InternalController).TouchLiveness,
+			body:     `{"entries":[{"pi_id":"pi-1","last_ts":"2024-01-01T00:00:00Z","count":1}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newMemoryController(t)
+			w := serve(func(ctx *gin.Context) { tt.handler(c, ctx) }, http.MethodPost, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.check != nil {
+				tt.check(t, c, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateReadingTimestamp(t *testing.T) {
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := func(ts, receivedAt string) string {
+		return `{"pi_id":"pi-1","device_id":0,"ts":` + ts + `,"received_at":` + receivedAt + `,"payload":{"t":1}}`
+	}
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantTs   time.Time // checked when the reading is stored
+	}{
+		{"rfc3339", body(`"2024-03-01T13:00:00+01:00"`, `""`), http.StatusCreated, noon},
+		{"epoch seconds string", body(`"1709294400"`, `""`), http.StatusCreated, noon},
+		{"epoch milliseconds number", body(`1709294400123`, `""`), http.StatusCreated, noon.Add(123 * time.Millisecond)},
+		{"epoch microseconds number", body(`1709294400123456`, `1709294400`), http.StatusCreated, noon.Add(123 * time.Millisecond)},
+		{"ambiguous ts", body(`"03/01/2024 12:00"`, `""`), http.StatusBadRequest, time.Time{}},
+		{"garbage ts", body(`"soon"`, `""`), http.StatusBadRequest, time.Time{}},
+		{"garbage received_at", body(`"2024-03-01T12:00:00Z"`, `"later"`), http.StatusBadRequest, time.Time{}},
+		{"boolean ts", body(`true`, `""`), http.StatusBadRequest, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newMemoryController(t)
+			w := serve(c.CreateReading, http.MethodPost, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusCreated {
+				return
+			}
+			latest, err := c.readingRepo.GetLatestReading(context.Background(), "pi-1", 0)
+			if err != nil || latest == nil {
+				t.Fatalf("reading not stored: %v", err)
+			}
+			if !latest.Ts.Equal(tt.wantTs) {
+				t.Errorf("stored ts %v, want %v", latest.Ts, tt.wantTs)
+			}
+		})
+	}
+}
+
+// In a batch an unparseable timestamp fails only its own reading
+func TestCreateReadingsInvalidTimestamp(t *testing.T) {
+	c := newMemoryController(t)
+	w := serve(c.CreateReadings, http.MethodPost, `{"readings":[
+		{"pi_id":"pi-1","device_id":0,"ts":"03/01/2024 12:00","payload":{"t":1}},
+		{"pi_id":"pi-1","device_id":0,"ts":1709294400123,"payload":{"t":2}}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp ingest_models.CreateReadingsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Inserted != 1 || len(resp.Failed) != 1 {
+		t.Fatalf("inserted %d, failed %+v; want 1 and 1", resp.Inserted, resp.Failed)
+	}
+	if failure := resp.Failed[0]; failure.Index != 0 || failure.Reason != ingest_models.ReadingFailureInvalid || failure.Ts != "03/01/2024 12:00" {
+		t.Errorf("failure %+v, want reading 0 invalid", failure)
+	}
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin/binding"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/maintenance"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// InternalGRPCService serves the ingestor's optional gRPC transport with the
+// same lookups and batch write as /internal/pis/validate,
+// /internal/devices/validate and /internal/readings/batch. Callers are
+// authenticated by the service auth interceptors of the gRPC server.
+type InternalGRPCService struct {
+	ingestpb.UnimplementedIngestServiceServer
+
+	internal    *InternalController
+	maintenance *maintenance.Mode
+}
+
+// NewInternalGRPCService creates the gRPC service of internal
+func NewInternalGRPCService(internal *InternalController, maintenanceMode *maintenance.Mode) *InternalGRPCService {
+	return &InternalGRPCService{
+		internal:    internal,
+		maintenance: maintenanceMode,
+	}
+}
+
+// ValidatePi reports whether readings for a Pi may be stored
+func (s *InternalGRPCService) ValidatePi(ctx context.Context, req *ingestpb.ValidatePiRequest) (*ingestpb.ValidatePiResponse, error) {
+	if req.GetPiId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "pi_id is required")
+	}
+
+	piStatus, err := s.internal.piStatus(ctx, req.GetPiId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to look up Pi: "+err.Error())
+	}
+	return &ingestpb.ValidatePiResponse{
+		Exists: piStatus != ingest_models.PiStatusNotFound,
+		Status: piStatus,
+	}, nil
+}
+
+// ValidateDevice reports whether a Pi has a device
+func (s *InternalGRPCService) ValidateDevice(ctx context.Context, req *ingestpb.ValidateDeviceRequest) (*ingestpb.ValidateDeviceResponse, error) {
+	if req.GetPiId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "pi_id is required")
+	}
+	if req.GetDeviceId() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "device_id must not be negative")
+	}
+
+	exists, err := s.internal.deviceExists(ctx, req.GetPiId(), int(req.GetDeviceId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to look up Device: "+err.Error())
+	}
+	return &ingestpb.ValidateDeviceResponse{Exists: exists}, nil
+}
+
+// CreateReadings stores the readings of the stream as one batch. As on the
+// HTTP route, an invalid reading refuses the whole stream, and readings that
+// can't be stored are listed with their index while the rest are stored.
+func (s *InternalGRPCService) CreateReadings(stream ingestpb.IngestService_CreateReadingsServer) error {
+	if err := s.checkMaintenance(stream); err != nil {
+		return err
+	}
+
+	var items []ingest_models.CreateReadingRequest
+	for {
+		reading, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(items) == maxReadingBatch {
+			return status.Errorf(codes.ResourceExhausted, "batch size exceeds maximum of %d", maxReadingBatch)
+		}
+
+		item, err := reading.ToModel()
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&item)
+		}
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid reading %d: %v", len(items), err)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one reading is required")
+	}
+
+	response, err := s.internal.storeReadings(stream.Context(), items)
+	if err != nil {
+		return status.Error(codes.Internal, "Failed to create readings: "+err.Error())
+	}
+	return stream.SendAndClose(ingestpb.NewCreateReadingsResponse(response))
+}
+
+// checkMaintenance refuses a write while maintenance mode is on, as the
+// Maintenance middleware does over HTTP: codes.Unavailable, with the wait and
+// reason in the trailer so the ingestor holds its readings instead of
+// counting a failure
+func (s *InternalGRPCService) checkMaintenance(stream grpc.ServerStream) error {
+	if s.maintenance == nil {
+		return nil
+	}
+	state := s.maintenance.Status()
+	if !state.Active {
+		return nil
+	}
+
+	retryAfter := int(math.Ceil(s.maintenance.RetryAfter().Seconds()))
+	stream.SetTrailer(metadata.Pairs(
+		ingest_models.MetadataMaintenanceRetryAfter, strconv.Itoa(retryAfter),
+		ingest_models.MetadataMaintenanceReason, state.Reason,
+	))
+	return status.Error(codes.Unavailable, "Service is in maintenance mode; writes are paused")
+}
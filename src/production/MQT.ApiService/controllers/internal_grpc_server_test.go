@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	grpcTestSecret = "grpc-secret"
+	bufconnTarget  = "passthrough:///bufnet"
+)
+
+// startGRPCService serves the internal gRPC service of newMemoryController
+// over an in-memory listener, behind the interceptors main.go chains, and
+// returns the option that dials it. entered, if set, runs as each stream's
+// handler starts.
+func startGRPCService(t *testing.T, limits middleware.GRPCLimits, entered func()) grpc.DialOption {
+	t.Helper()
+	t.Setenv("INTERNAL_API_SECRET", grpcTestSecret)
+
+	guards := middleware.NewGRPCGuards(limits)
+	streamInterceptors := []grpc.StreamServerInterceptor{middleware.ServiceAuthStreamInterceptor(false), guards.StreamInterceptor()}
+	if entered != nil {
+		streamInterceptors = append(streamInterceptors, func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			entered()
+			return handler(srv, stream)
+		})
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.ServiceAuthUnaryInterceptor(false), guards.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+	ingestpb.RegisterIngestServiceServer(srv, NewInternalGRPCService(newMemoryController(t), nil))
+
+	listener := bufconn.Listen(1 << 20)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	})
+}
+
+// dialGRPCService returns a client of the service, which signs nothing
+func dialGRPCService(t *testing.T, dialer grpc.DialOption) ingestpb.IngestServiceClient {
+	t.Helper()
+	conn, err := grpc.NewClient(bufconnTarget, dialer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ingestpb.NewIngestServiceClient(conn)
+}
+
+// newGRPCIngestorClient returns the ingestor's API client on the service,
+// without retries
+func newGRPCIngestorClient(t *testing.T, dialer grpc.DialOption) *client.APIClient {
+	t.Helper()
+	apiClient := client.NewAPIClientWithConfig("http://api.invalid", grpcTestSecret, client.APIClientConfig{MaxRetries: 0})
+	if err := apiClient.UseGRPC(bufconnTarget, dialer); err != nil {
+		t.Fatalf("UseGRPC: %v", err)
+	}
+	t.Cleanup(func() { apiClient.Close() })
+	return apiClient
+}
+
+// signedContext returns the metadata of a call to fullMethod signed with
+// secret over nonce and request, nil for a stream
+func signedContext(t *testing.T, secret, fullMethod, nonce string, request proto.Message) context.Context {
+	t.Helper()
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = ingest_models.MarshalGRPCRequest(request); err != nil {
+			t.Fatalf("MarshalGRPCRequest: %v", err)
+		}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return metadata.AppendToOutgoingContext(context.Background(),
+		ingest_models.HeaderInternalTimestamp, timestamp,
+		ingest_models.HeaderInternalNonce, nonce,
+		ingest_models.HeaderInternalSignature, ingest_models.SignGRPCCall(secret, fullMethod, timestamp, nonce, body),
+	)
+}
+
+func TestGRPCServiceAuth(t *testing.T) {
+	validatePi := ingestpb.IngestService_ValidatePi_FullMethodName
+	pi1 := &ingestpb.ValidatePiRequest{PiId: "pi-1"}
+	pi2 := &ingestpb.ValidatePiRequest{PiId: "pi-2"}
+
+	tests := []struct {
+		name  string
+		ctx   func(t *testing.T) context.Context
+		calls []codes.Code // the same call, made once per code
+	}{
+		{
+			name: "signed",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, grpcTestSecret, validatePi, "nonce-1", pi1)
+			},
+			calls: []codes.Code{codes.OK},
+		},
+		{
+			name: "replayed",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, grpcTestSecret, validatePi, "nonce-1", pi1)
+			},
+			calls: []codes.Code{codes.OK, codes.Unauthenticated},
+		},
+		{
+			name: "signed for another request",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, grpcTestSecret, validatePi, "nonce-1", pi2)
+			},
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+		{
+			name: "signed for another method",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, grpcTestSecret, ingestpb.IngestService_ValidateDevice_FullMethodName, "nonce-1", pi1)
+			},
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+		{
+			name: "wrong secret",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, "other-secret", validatePi, "nonce-1", pi1)
+			},
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+		{
+			name:  "missing nonce",
+			ctx:   func(t *testing.T) context.Context { return signedContext(t, grpcTestSecret, validatePi, "", pi1) },
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+		{
+			name: "nonce too long",
+			ctx: func(t *testing.T) context.Context {
+				return signedContext(t, grpcTestSecret, validatePi, strings.Repeat("n", 65), pi1)
+			},
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+		{
+			name:  "unsigned",
+			ctx:   func(t *testing.T) context.Context { return context.Background() },
+			calls: []codes.Code{codes.Unauthenticated},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := dialGRPCService(t, startGRPCService(t, middleware.GRPCLimits{}, nil))
+			ctx := tt.ctx(t)
+			for n, want := range tt.calls {
+				resp, err := service.ValidatePi(ctx, pi1)
+				if code := status.Code(err); code != want {
+					t.Fatalf("call %d: code %v, want %v: %v", n, code, want, err)
+				}
+				if want == codes.OK && resp.GetStatus() != ingest_models.PiStatusOK {
+					t.Errorf("call %d: status %q, want %q", n, resp.GetStatus(), ingest_models.PiStatusOK)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCServiceAuthStream(t *testing.T) {
+	service := dialGRPCService(t, startGRPCService(t, middleware.GRPCLimits{}, nil))
+	ctx := signedContext(t, grpcTestSecret, ingestpb.IngestService_CreateReadings_FullMethodName, "nonce-1", nil)
+
+	send := func() error {
+		stream, err := service.CreateReadings(ctx)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&ingestpb.Reading{PiId: "pi-1", DeviceId: 0, Ts: "2024-01-01T00:00:00Z", Payload: []byte(`{"t":1}`)}); err != nil {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	if err := send(); err != nil {
+		t.Fatalf("signed stream: %v", err)
+	}
+	if code := status.Code(send()); code != codes.Unauthenticated {
+		t.Errorf("replayed stream: code %v, want %v", code, codes.Unauthenticated)
+	}
+}
+
+// The ingestor's client signs each call afresh, so repeated calls all pass
+func TestGRPCIngestorClient(t *testing.T) {
+	apiClient := newGRPCIngestorClient(t, startGRPCService(t, middleware.GRPCLimits{}, nil))
+	ctx := context.Background()
+
+	for range 2 {
+		if piStatus, err := apiClient.ValidatePi(ctx, "pi-1"); err != nil || piStatus != ingest_models.PiStatusOK {
+			t.Fatalf("ValidatePi = %q, %v", piStatus, err)
+		}
+	}
+	if exists, err := apiClient.ValidateDevice(ctx, "pi-1", 0); err != nil || !exists {
+		t.Fatalf("ValidateDevice(pi-1, 0) = %v, %v", exists, err)
+	}
+	for n := range 2 {
+		reading := hardware_models.Reading{PiID: "pi-1", DeviceID: 0, Ts: time.Now().Add(time.Duration(n) * time.Second), Payload: map[string]interface{}{"t": n}}
+		response, err := apiClient.CreateReadings(ctx, []hardware_models.Reading{reading})
+		if err != nil {
+			t.Fatalf("CreateReadings: %v", err)
+		}
+		if response.Inserted != 1 {
+			t.Errorf("CreateReadings inserted %d, want 1", response.Inserted)
+		}
+	}
+}
+
+func TestGRPCGuards(t *testing.T) {
+	readings := func(n int) []hardware_models.Reading {
+		batch := make([]hardware_models.Reading, n)
+		for i := range batch {
+			batch[i] = hardware_models.Reading{PiID: "pi-1", DeviceID: 0, Ts: time.Now().Add(time.Duration(i) * time.Second), Payload: map[string]interface{}{"t": i}}
+		}
+		return batch
+	}
+	ctx := context.Background()
+
+	t.Run("rate limit", func(t *testing.T) {
+		apiClient := newGRPCIngestorClient(t, startGRPCService(t, middleware.GRPCLimits{RateLimiter: middleware.NewRateLimiter(1, time.Minute)}, nil))
+		if _, err := apiClient.CreateReadings(ctx, readings(1)); err != nil {
+			t.Fatalf("first call: %v", err)
+		}
+		_, err := apiClient.CreateReadings(ctx, readings(1))
+		var apiErr *client.APIError
+		if errors.Is(err, client.ErrBatchTooLarge) || !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+			t.Errorf("second call: %v, want a 429 APIError", err)
+		}
+	})
+
+	t.Run("rate limit trailer", func(t *testing.T) {
+		dialer := startGRPCService(t, middleware.GRPCLimits{RateLimiter: middleware.NewRateLimiter(1, time.Minute)}, nil)
+		service := dialGRPCService(t, dialer)
+		request := &ingestpb.ValidatePiRequest{PiId: "pi-1"}
+		for n, want := range []codes.Code{codes.OK, codes.ResourceExhausted} {
+			var trailer metadata.MD
+			_, err := service.ValidatePi(signedContext(t, grpcTestSecret, ingestpb.IngestService_ValidatePi_FullMethodName, "nonce-"+strconv.Itoa(n), request), request, grpc.Trailer(&trailer))
+			if code := status.Code(err); code != want {
+				t.Fatalf("call %d: code %v, want %v: %v", n, code, want, err)
+			}
+			if hasTrailer := len(trailer.Get(ingest_models.MetadataRateLimitRetryAfter)) > 0; hasTrailer != (want != codes.OK) {
+				t.Errorf("call %d: trailer %v", n, trailer)
+			}
+		}
+	})
+
+	t.Run("body limit on a stream", func(t *testing.T) {
+		apiClient := newGRPCIngestorClient(t, startGRPCService(t, middleware.GRPCLimits{MaxBytes: 256}, nil))
+		if _, err := apiClient.CreateReadings(ctx, readings(1)); err != nil {
+			t.Fatalf("small batch: %v", err)
+		}
+		if _, err := apiClient.CreateReadings(ctx, readings(20)); !errors.Is(err, client.ErrBatchTooLarge) {
+			t.Errorf("large batch: %v, want %v", err, client.ErrBatchTooLarge)
+		}
+	})
+
+	t.Run("body limit on a unary call", func(t *testing.T) {
+		service := dialGRPCService(t, startGRPCService(t, middleware.GRPCLimits{MaxBytes: 256}, nil))
+		request := &ingestpb.ValidatePiRequest{PiId: strings.Repeat("p", 300)}
+		_, err := service.ValidatePi(signedContext(t, grpcTestSecret, ingestpb.IngestService_ValidatePi_FullMethodName, "nonce-1", request), request)
+		if code := status.Code(err); code != codes.ResourceExhausted {
+			t.Errorf("code %v, want %v: %v", code, codes.ResourceExhausted, err)
+		}
+	})
+
+	t.Run("concurrency cap", func(t *testing.T) {
+		entered := make(chan struct{}, 1)
+		dialer := startGRPCService(t, middleware.GRPCLimits{MaxConcurrent: 1, Timeout: 100 * time.Millisecond}, func() { entered <- struct{}{} })
+		service := dialGRPCService(t, dialer)
+
+		// An open stream holds the only slot until it is closed
+		held, err := service.CreateReadings(signedContext(t, grpcTestSecret, ingestpb.IngestService_CreateReadings_FullMethodName, "nonce-held", nil))
+		if err != nil {
+			t.Fatalf("CreateReadings: %v", err)
+		}
+		<-entered
+
+		request := &ingestpb.ValidatePiRequest{PiId: "pi-1"}
+		_, err = service.ValidatePi(signedContext(t, grpcTestSecret, ingestpb.IngestService_ValidatePi_FullMethodName, "nonce-1", request), request)
+		if code := status.Code(err); code != codes.Unavailable {
+			t.Errorf("code %v, want %v: %v", code, codes.Unavailable, err)
+		}
+		held.CloseAndRecv()
+
+		_, err = service.ValidatePi(signedContext(t, grpcTestSecret, ingestpb.IngestService_ValidatePi_FullMethodName, "nonce-2", request), request)
+		if err != nil {
+			t.Errorf("after the slot is freed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readingStream feeds readings to CreateReadings and keeps its response
+type readingStream struct {
+	grpc.ServerStream
+	readings []*ingestpb.Reading
+	response *ingestpb.CreateReadingsResponse
+}
+
+func (s *readingStream) Context() context.Context { return context.Background() }
+
+func (s *readingStream) Recv() (*ingestpb.Reading, error) {
+	if len(s.readings) == 0 {
+		return nil, io.EOF
+	}
+	reading := s.readings[0]
+	s.readings = s.readings[1:]
+	return reading, nil
+}
+
+func (s *readingStream) SendAndClose(response *ingestpb.CreateReadingsResponse) error {
+	s.response = response
+	return nil
+}
+
+func TestGRPCCreateReadingsDeviceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID int
+		wantCode codes.Code
+	}{
+		{"device 0", 0, codes.OK},
+		{"device 3", 3, codes.OK},
+		{"negative device", -1, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newMemoryController(t)
+			if err := c.deviceRepo.CreateOrUpdateDevice(context.Background(), hardware_models.Device{PiID: "pi-1", DeviceID: 3, DeviceType: "sensor", CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("CreateOrUpdateDevice: %v", err)
+			}
+
+			// Built as the ingestor builds it, so the conversion is covered too
+			reading, err := ingestpb.NewReading(ingest_models.NewCreateReadingRequest(hardware_models.Reading{
+				PiID:     "pi-1",
+				DeviceID: tt.deviceID,
+				Ts:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Payload:  map[string]interface{}{"t": 1},
+			}))
+			if err != nil {
+				t.Fatalf("NewReading: %v", err)
+			}
+			stream := &readingStream{readings: []*ingestpb.Reading{reading}}
+
+			err = NewInternalGRPCService(c, nil).CreateReadings(stream)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("CreateReadings returned %v, want %v", err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				return
+			}
+			if stream.response.GetInserted() != 1 || len(stream.response.GetFailed()) != 0 {
+				t.Errorf("response %v, want 1 inserted", stream.response)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metaLookupLimit caps the matches returned by a meta lookup
+const metaLookupLimit = 100
+
+// parseMetaLookup collects the meta.<key>=<value> query parameters of a lookup.
+// Only keys in allowedKeys may be used, so every lookup stays on the meta GIN
+// index. On a bad query it writes a 400 and returns false.
+func parseMetaLookup(ctx *gin.Context, allowedKeys []string) (map[string]string, bool) {
+	allowed := make(map[string]bool, len(allowedKeys))
+	for _, key := range allowedKeys {
+		allowed[key] = true
+	}
+
+	match := make(map[string]string)
+	for param, values := range ctx.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, "meta.")
+		if !ok {
+			continue
+		}
+		if !allowed[key] {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "meta key not allowed for lookup: " + key,
+				"code":    "lookup_key_not_allowed",
+				"allowed": allowedKeys,
+			})
+			return nil, false
+		}
+		if len(values) != 1 || values[0] == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "meta." + key + " must have exactly one non-empty value"})
+			return nil, false
+		}
+		match[key] = values[0]
+	}
+
+	if len(match) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "at least one meta.<key>=<value> parameter is required",
+			"allowed": allowedKeys,
+		})
+		return nil, false
+	}
+	return match, true
+}
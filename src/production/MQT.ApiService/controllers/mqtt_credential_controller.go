@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/mqttauth"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Results understood by the broker's HTTP auth and authorization hooks. "ignore"
+// hands the decision to the broker's next authenticator, which is how service
+// accounts such as the ingestor and bridge are still let in.
+const (
+	brokerResultAllow  = "allow"
+	brokerResultDeny   = "deny"
+	brokerResultIgnore = "ignore"
+)
+
+// MqttCredentialController issues per-Pi broker credentials and answers the
+// broker's HTTP auth and ACL hooks. Credentials are checked against the database
+// on every hook call, so a revocation takes effect once the broker's cache expires.
+type MqttCredentialController struct {
+	credentialRepo interfaces.MqttCredentialRepository
+	piRepo         interfaces.PiRepository
+	auditService   *audit.Service
+	topicRules     mqttauth.TopicRules
+	logger         *logger.Logger
+}
+
+// NewMqttCredentialController creates a new MQTT credential controller
+func NewMqttCredentialController(credentialRepo interfaces.MqttCredentialRepository, piRepo interfaces.PiRepository, auditService *audit.Service, topicRules mqttauth.TopicRules, logger *logger.Logger) *MqttCredentialController {
+	return &MqttCredentialController{
+		credentialRepo: credentialRepo,
+		piRepo:         piRepo,
+		auditService:   auditService,
+		topicRules:     topicRules,
+		logger:         logger,
+	}
+}
+
+// Routes declares the credential admin routes and the broker HTTP hooks, which
+// are authenticated with the internal service secret
+func (c *MqttCredentialController) Routes() []routing.Route {
+	return []routing.Route{
+		// Admin only - issue (rotate) and revoke
+		{Method: http.MethodPost, Path: "/pis/:pi_id/mqtt-credentials", Access: routing.Admin, Handler: c.IssueCredential},
+		{Method: http.MethodDelete, Path: "/pis/:pi_id/mqtt-credentials", Access: routing.Admin, Handler: c.RevokeCredential},
+
+		{Method: http.MethodPost, Path: "/internal/mqtt/auth", Access: routing.Service, Handler: c.BrokerAuth},
+		{Method: http.MethodPost, Path: "/internal/mqtt/acl", Access: routing.Service, Handler: c.BrokerACL},
+	}
+}
+
+// IssueCredentialResponse carries the new broker password; it is only ever shown here
+type IssueCredentialResponse struct {
+	CredentialID string    `json:"credential_id"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// IssueCredential generates a new broker password for a Pi, revoking the previous one
+func (c *MqttCredentialController) IssueCredential(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	_, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+	if err == sql.ErrNoRows {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, err := mqttauth.GenerateSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate credential"})
+		return
+	}
+
+	credential := &hardware_models.MqttCredential{
+		PiID:       piID,
+		SecretHash: mqttauth.HashSecret(secret),
+	}
+	if err := c.credentialRepo.Issue(ctx.Request.Context(), credential); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "pi.mqtt_credential.issue",
+		ResourceType: "pi",
+		ResourceID:   piID,
+		Details: map[string]interface{}{
+			"credential_id": credential.CredentialID,
+		},
+	})
+
+	ctx.JSON(http.StatusCreated, IssueCredentialResponse{
+		CredentialID: credential.CredentialID,
+		Username:     piID,
+		Password:     secret,
+		CreatedAt:    credential.CreatedAt.UTC(),
+	})
+}
+
+// RevokeCredential revokes a Pi's active broker credential
+func (c *MqttCredentialController) RevokeCredential(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+
+	revoked, err := c.credentialRepo.Revoke(ctx.Request.Context(), piID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no active credential for pi"})
+		return
+	}
+
+	adminID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "pi.mqtt_credential.revoke",
+		ResourceType: "pi",
+		ResourceID:   piID,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"revoked": true})
+}
+
+// BrokerAuthRequest is sent by the broker when a client connects
+type BrokerAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"clientid"`
+}
+
+// BrokerACLRequest is sent by the broker before a publish or subscribe
+type BrokerACLRequest struct {
+	Username string `json:"username"`
+	ClientID string `json:"clientid"`
+	Topic    string `json:"topic"`
+	Action   string `json:"action"`
+}
+
+// BrokerAuth validates a Pi's broker credentials. Usernames that were never
+// issued a credential are ignored so other authenticators can handle them.
+func (c *MqttCredentialController) BrokerAuth(ctx *gin.Context) {
+	var req BrokerAuthRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	credential, err := c.credentialRepo.GetLatest(ctx.Request.Context(), req.Username)
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Str("username", req.Username).Msg("Broker auth lookup failed")
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultDeny})
+		return
+	}
+	if credential == nil {
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultIgnore})
+		return
+	}
+
+	if credential.IsRevoked() || !mqttauth.VerifySecret(credential.SecretHash, req.Password) {
+		c.logger.Logger.Warn().
+			Str("component", "mqtt_auth").
+			Str("pi_id", req.Username).
+			Str("client_id", req.ClientID).
+			Bool("revoked", credential.IsRevoked()).
+			Msg("Broker auth denied")
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultDeny})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"result": brokerResultAllow})
+}
+
+// BrokerACL authorizes a Pi's publish or subscribe against its own topics
+func (c *MqttCredentialController) BrokerACL(ctx *gin.Context) {
+	var req BrokerACLRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	credential, err := c.credentialRepo.GetLatest(ctx.Request.Context(), req.Username)
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Str("username", req.Username).Msg("Broker ACL lookup failed")
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultDeny})
+		return
+	}
+	if credential == nil {
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultIgnore})
+		return
+	}
+
+	if credential.IsRevoked() || !c.topicRules.Authorize(req.Username, req.Action, req.Topic) {
+		ctx.JSON(http.StatusOK, gin.H{"result": brokerResultDeny})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"result": brokerResultAllow})
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/mqttauth"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// stubCredentialRepo serves the latest credential of each Pi. Calls it doesn't
+// implement panic.
+type stubCredentialRepo struct {
+	interfaces.MqttCredentialRepository
+	credentials map[string]*hardware_models.MqttCredential
+	err         error
+}
+
+func (r *stubCredentialRepo) GetLatest(_ context.Context, piID string) (*hardware_models.MqttCredential, error) {
+	return r.credentials[piID], r.err
+}
+
+// newCredentialController answers ACL hooks for pi-1 and pi-2, whose
+// credentials are active, and pi-3, whose credential is revoked, under the
+// default topic prefixes
+func newCredentialController(repoErr error) *MqttCredentialController {
+	revokedAt := time.Now()
+	repo := &stubCredentialRepo{
+		credentials: map[string]*hardware_models.MqttCredential{
+			"pi-1": {PiID: "pi-1"},
+			"pi-2": {PiID: "pi-2"},
+			"pi-3": {PiID: "pi-3", RevokedAt: &revokedAt},
+		},
+		err: repoErr,
+	}
+	nop := zerolog.Nop()
+	return NewMqttCredentialController(repo, nil, nil, mqttauth.TopicRules{
+		SensorPrefix:    "sensors",
+		CommandPrefix:   "commands",
+		ErrorPrefix:     "ingestor/errors",
+		DiscoveryPrefix: "discovery",
+	}, &logger.Logger{Logger: &nop})
+}
+
+// A Pi publishes concrete topics under its own sensor prefix and its discovery
+// topic, and subscribes, wildcards allowed below its own level, to its command
+// and error topics. Everything else, including any topic of another Pi, is denied.
+func TestBrokerACL(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		action   string
+		topic    string
+		want     string
+	}{
+		// Publishing (write)
+		{name: "publish reading", username: "pi-1", action: "publish", topic: "sensors/pi-1/0/temperature", want: brokerResultAllow},
+		{name: "publish discovery", username: "pi-1", action: "publish", topic: "discovery/pi-1", want: brokerResultAllow},
+		{name: "publish below discovery", username: "pi-1", action: "publish", topic: "discovery/pi-1/0", want: brokerResultDeny},
+		{name: "publish with +", username: "pi-1", action: "publish", topic: "sensors/pi-1/+/temperature", want: brokerResultDeny},
+		{name: "publish with #", username: "pi-1", action: "publish", topic: "sensors/pi-1/#", want: brokerResultDeny},
+		{name: "publish to commands", username: "pi-1", action: "publish", topic: "commands/pi-1/reboot", want: brokerResultDeny},
+		{name: "publish to errors", username: "pi-1", action: "publish", topic: "ingestor/errors/pi-1/0", want: brokerResultDeny},
+		{name: "publish another Pi's reading", username: "pi-1", action: "publish", topic: "sensors/pi-2/0/temperature", want: brokerResultDeny},
+		{name: "publish another Pi's discovery", username: "pi-1", action: "publish", topic: "discovery/pi-2", want: brokerResultDeny},
+		{name: "publish a Pi ID sharing the prefix", username: "pi-1", action: "publish", topic: "sensors/pi-10/0/temperature", want: brokerResultDeny},
+
+		// Subscribing (read)
+		{name: "subscribe commands", username: "pi-1", action: "subscribe", topic: "commands/pi-1", want: brokerResultAllow},
+		{name: "subscribe commands with #", username: "pi-1", action: "subscribe", topic: "commands/pi-1/#", want: brokerResultAllow},
+		{name: "subscribe commands with +", username: "pi-1", action: "subscribe", topic: "commands/pi-1/+/reboot", want: brokerResultAllow},
+		{name: "subscribe errors with #", username: "pi-1", action: "subscribe", topic: "ingestor/errors/pi-1/#", want: brokerResultAllow},
+		{name: "subscribe errors with +", username: "pi-1", action: "subscribe", topic: "ingestor/errors/pi-1/+", want: brokerResultAllow},
+		{name: "subscribe + at the Pi level", username: "pi-1", action: "subscribe", topic: "commands/+/reboot", want: brokerResultDeny},
+		{name: "subscribe # above the Pi level", username: "pi-1", action: "subscribe", topic: "commands/#", want: brokerResultDeny},
+		{name: "subscribe #", username: "pi-1", action: "subscribe", topic: "#", want: brokerResultDeny},
+		{name: "subscribe # glued to the Pi ID", username: "pi-1", action: "subscribe", topic: "commands/pi-1#", want: brokerResultDeny},
+		{name: "subscribe another Pi's commands", username: "pi-1", action: "subscribe", topic: "commands/pi-2/#", want: brokerResultDeny},
+		{name: "subscribe another Pi's errors", username: "pi-1", action: "subscribe", topic: "ingestor/errors/pi-2/0", want: brokerResultDeny},
+		{name: "subscribe own readings", username: "pi-1", action: "subscribe", topic: "sensors/pi-1/#", want: brokerResultDeny},
+
+		// Credentials
+		{name: "other Pi on its own topic", username: "pi-2", action: "publish", topic: "sensors/pi-2/0/temperature", want: brokerResultAllow},
+		{name: "revoked credential", username: "pi-3", action: "publish", topic: "sensors/pi-3/0/temperature", want: brokerResultDeny},
+		{name: "never issued a credential", username: "ingestor", action: "subscribe", topic: "sensors/#", want: brokerResultIgnore},
+		{name: "unknown action", username: "pi-1", action: "retain", topic: "sensors/pi-1/0/temperature", want: brokerResultDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(BrokerACLRequest{Username: tt.username, ClientID: tt.username, Topic: tt.topic, Action: tt.action})
+			w := serve(newCredentialController(nil).BrokerACL, http.MethodPost, string(body))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct{ Result string }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Result != tt.want {
+				t.Errorf("%s %s %s = %s, want %s", tt.username, tt.action, tt.topic, resp.Result, tt.want)
+			}
+		})
+	}
+}
+
+// A failed lookup fails closed rather than handing the decision on
+func TestBrokerACLLookupError(t *testing.T) {
+	body, _ := json.Marshal(BrokerACLRequest{Username: "pi-1", Topic: "sensors/pi-1/0/t", Action: "publish"})
+	w := serve(newCredentialController(errors.New("connection refused")).BrokerACL, http.MethodPost, string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct{ Result string }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Result != brokerResultDeny {
+		t.Errorf("result %s, want %s", resp.Result, brokerResultDeny)
+	}
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/notify"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// NotificationPreferenceController lets users choose how and when they are
+// notified
+type NotificationPreferenceController struct {
+	notificationRepo interfaces.NotificationRepository
+	logger           *logger.Logger
+}
+
+// NewNotificationPreferenceController creates a new notification preference controller
+func NewNotificationPreferenceController(notificationRepo interfaces.NotificationRepository, logger *logger.Logger) *NotificationPreferenceController {
+	return &NotificationPreferenceController{
+		notificationRepo: notificationRepo,
+		logger:           logger,
+	}
+}
+
+// Routes declares the notification preference routes
+func (c *NotificationPreferenceController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/api/auth/notification-preferences", Access: routing.Authenticated, Handler: c.GetPreferences},
+		{Method: http.MethodPatch, Path: "/api/auth/notification-preferences", Access: routing.Authenticated, Handler: c.UpdatePreferences},
+	}
+}
+
+// currentPreferences returns the user's stored preferences or the defaults
+func (c *NotificationPreferenceController) currentPreferences(ctx *gin.Context, userID string) (notification_models.Preferences, error) {
+	prefs, err := c.notificationRepo.GetPreferences(ctx.Request.Context(), userID)
+	if err != nil {
+		return notification_models.Preferences{}, err
+	}
+	if prefs == nil {
+		return notification_models.DefaultPreferences(userID), nil
+	}
+	return *prefs, nil
+}
+
+// GetPreferences returns the caller's notification preferences, or the
+// defaults if they never set any
+func (c *NotificationPreferenceController) GetPreferences(ctx *gin.Context) {
+	userID, err := middleware.GetUserFromGinContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	prefs, err := c.currentPreferences(ctx, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, prefs)
+}
+
+// UpdatePreferencesRequest changes the fields that are set. An empty channel
+// list goes back to the deployment defaults; empty quiet hour bounds turn
+// quiet hours off.
+type UpdatePreferencesRequest struct {
+	Channels        *[]string `json:"channels,omitempty"`
+	DigestMode      *string   `json:"digest_mode,omitempty"`
+	QuietHoursStart *string   `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   *string   `json:"quiet_hours_end,omitempty"`
+	Timezone        *string   `json:"timezone,omitempty"`
+}
+
+// UpdatePreferences changes the caller's notification preferences
+func (c *NotificationPreferenceController) UpdatePreferences(ctx *gin.Context) {
+	userID, err := middleware.GetUserFromGinContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req UpdatePreferencesRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	prefs, err := c.currentPreferences(ctx, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Channels != nil {
+		for _, channel := range *req.Channels {
+			if !notify.KnownChannel(channel) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown channel: " + channel})
+				return
+			}
+		}
+		prefs.Channels = *req.Channels
+	}
+	if req.DigestMode != nil {
+		prefs.DigestMode = *req.DigestMode
+	}
+	if req.QuietHoursStart != nil {
+		prefs.QuietHoursStart = *req.QuietHoursStart
+	}
+	if req.QuietHoursEnd != nil {
+		prefs.QuietHoursEnd = *req.QuietHoursEnd
+	}
+	if req.Timezone != nil {
+		prefs.Timezone = *req.Timezone
+	}
+	if err := prefs.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.notificationRepo.UpsertPreferences(ctx.Request.Context(), &prefs); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+const (
+	payloadKeysDefaultWindow = 24 * time.Hour
+	payloadKeysMaxWindow     = 7 * 24 * time.Hour
+	payloadKeysCacheTTL      = time.Minute
+)
+
+// PayloadKeysResponse lists the payload keys seen in a time window
+type PayloadKeysResponse struct {
+	From time.Time                    `json:"from"`
+	To   time.Time                    `json:"to"`
+	Keys []interfaces.PayloadKeyStats `json:"keys"`
+}
+
+// payloadKeyCache briefly remembers payload key results so repeated page loads
+// don't rerun the aggregation
+type payloadKeyCache struct {
+	mu      sync.Mutex
+	entries map[string]payloadKeyCacheEntry
+}
+
+type payloadKeyCacheEntry struct {
+	keys      []interfaces.PayloadKeyStats
+	expiresAt time.Time
+}
+
+func newPayloadKeyCache() *payloadKeyCache {
+	return &payloadKeyCache{entries: make(map[string]payloadKeyCacheEntry)}
+}
+
+func (c *payloadKeyCache) get(key string) ([]interfaces.PayloadKeyStats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.keys, true
+}
+
+func (c *payloadKeyCache) put(key string, keys []interfaces.PayloadKeyStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries so the map only holds what was asked for recently
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = payloadKeyCacheEntry{keys: keys, expiresAt: now.Add(payloadKeysCacheTTL)}
+}
+
+// parsePayloadKeysWindow reads from/to (RFC3339), defaulting to the last 24 hours
+func parsePayloadKeysWindow(ctx *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	if v := ctx.Query("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: expected RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed.UTC()
+	}
+
+	from := to.Add(-payloadKeysDefaultWindow)
+	if v := ctx.Query("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: expected RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed.UTC()
+	}
+
+	if !from.Before(to) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > payloadKeysMaxWindow {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "window must not exceed 7 days"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// payloadKeys runs a payload key query through the cache. Windows are truncated
+// to the minute so the default "last 24h" window is cacheable.
+func (c *DeviceController) payloadKeys(ctx *gin.Context, query interfaces.PayloadKeyQuery) {
+	query.From = query.From.Truncate(time.Minute)
+	query.To = query.To.Truncate(time.Minute)
+	cacheKey := query.PiID + "|" + strconv.Itoa(query.DeviceID) + "|" + query.DeviceType + "|" +
+		query.From.Format(time.RFC3339) + "|" + query.To.Format(time.RFC3339)
+
+	keys, ok := c.payloadKeyCache.get(cacheKey)
+	if !ok {
+		var err error
+		keys, err = c.readingRepo.GetPayloadKeys(ctx.Request.Context(), query)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.payloadKeyCache.put(cacheKey, keys)
+	}
+
+	ctx.JSON(http.StatusOK, PayloadKeysResponse{
+		From: query.From,
+		To:   query.To,
+		Keys: keys,
+	})
+}
+
+// GetPayloadKeys returns the top-level payload keys a device reported recently
+func (c *DeviceController) GetPayloadKeys(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+
+	// Check if user has access to this PI
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+		if err != nil || pi == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+			return
+		}
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	from, to, ok := parsePayloadKeysWindow(ctx)
+	if !ok {
+		return
+	}
+
+	c.payloadKeys(ctx, interfaces.PayloadKeyQuery{
+		PiID:     piID,
+		DeviceID: deviceID,
+		From:     from,
+		To:       to,
+	})
+}
+
+// GetDeviceTypePayloadKeys returns the payload keys reported by every device of a type (admin only)
+func (c *DeviceController) GetDeviceTypePayloadKeys(ctx *gin.Context) {
+	from, to, ok := parsePayloadKeysWindow(ctx)
+	if !ok {
+		return
+	}
+
+	c.payloadKeys(ctx, interfaces.PayloadKeyQuery{
+		DeviceType: ctx.Param("device_type"),
+		From:       from,
+		To:         to,
+	})
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/payloadschema"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Bounds for the violations listing
+const (
+	defaultViolationsLimit = 100
+	maxViolationsLimit     = 1000
+)
+
+// PayloadSchemaController manages the versioned JSON Schemas that reading
+// payloads of each device type are validated against on the internal write path
+type PayloadSchemaController struct {
+	schemaRepo   interfaces.PayloadSchemaRepository
+	validator    *payloadschema.Validator
+	auditService *audit.Service
+	logger       *logger.Logger
+}
+
+// NewPayloadSchemaController creates a new payload schema controller
+func NewPayloadSchemaController(schemaRepo interfaces.PayloadSchemaRepository, validator *payloadschema.Validator, auditService *audit.Service, logger *logger.Logger) *PayloadSchemaController {
+	return &PayloadSchemaController{
+		schemaRepo:   schemaRepo,
+		validator:    validator,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// Routes declares the payload schema routes
+func (c *PayloadSchemaController) Routes() []routing.Route {
+	return []routing.Route{
+		// Any user: the contract their devices' payloads are held to
+		{Method: http.MethodGet, Path: "/device-types/:device_type/schema", Access: routing.Authenticated, Handler: c.GetActiveSchema},
+		// Admin only
+		{Method: http.MethodGet, Path: "/device-types/:device_type/schema/violations", Access: routing.Admin, Handler: c.ListViolations},
+		{Method: http.MethodGet, Path: "/device-types/:device_type/schemas", Access: routing.Admin, Handler: c.ListSchemas},
+		{Method: http.MethodPost, Path: "/device-types/:device_type/schemas", Access: routing.Admin, Handler: c.CreateSchema},
+		{Method: http.MethodGet, Path: "/device-types/:device_type/schemas/:version", Access: routing.Admin, Handler: c.GetSchema},
+		{Method: http.MethodPatch, Path: "/device-types/:device_type/schemas/:version", Access: routing.Admin, Handler: c.UpdateSchema},
+		{Method: http.MethodDelete, Path: "/device-types/:device_type/schemas/:version", Access: routing.Admin, Handler: c.DeleteSchema},
+	}
+}
+
+func validEnforcement(enforcement string) bool {
+	return enforcement == hardware_models.SchemaEnforcementFlag || enforcement == hardware_models.SchemaEnforcementReject
+}
+
+// parseVersion writes a 400 and returns false when the version parameter isn't
+// a positive integer
+func parseVersion(ctx *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return 0, false
+	}
+	return version, true
+}
+
+func (c *PayloadSchemaController) recordAudit(ctx *gin.Context, action, deviceType string, details map[string]interface{}) {
+	userID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      userID,
+		Action:       action,
+		ResourceType: "device_type",
+		ResourceID:   deviceType,
+		Details:      details,
+	})
+}
+
+// GetActiveSchema returns the schema payloads of a device type are currently
+// validated against
+func (c *PayloadSchemaController) GetActiveSchema(ctx *gin.Context) {
+	schema, err := c.schemaRepo.GetActiveSchema(ctx.Request.Context(), ctx.Param("device_type"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "no active schema for device type"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, schema)
+}
+
+// ListSchemas returns every version of a device type's schema, newest first
+func (c *PayloadSchemaController) ListSchemas(ctx *gin.Context) {
+	schemas, err := c.schemaRepo.ListSchemas(ctx.Request.Context(), ctx.Param("device_type"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": schemas})
+}
+
+// GetSchema returns one version of a device type's schema
+func (c *PayloadSchemaController) GetSchema(ctx *gin.Context) {
+	version, ok := parseVersion(ctx)
+	if !ok {
+		return
+	}
+
+	schema, err := c.schemaRepo.GetSchema(ctx.Request.Context(), ctx.Param("device_type"), version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "schema not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, schema)
+}
+
+// CreateSchemaRequest adds a schema version. Enforcement defaults to flag and
+// the new version becomes active unless Active is false.
+type CreateSchemaRequest struct {
+	Schema      json.RawMessage `json:"schema" binding:"required"`
+	Enforcement string          `json:"enforcement,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+}
+
+// CreateSchema stores a new schema version for a device type. The document
+// must compile, so a schema that is stored can always be enforced.
+func (c *PayloadSchemaController) CreateSchema(ctx *gin.Context) {
+	deviceType := ctx.Param("device_type")
+
+	var req CreateSchemaRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	if req.Enforcement == "" {
+		req.Enforcement = hardware_models.SchemaEnforcementFlag
+	}
+	if !validEnforcement(req.Enforcement) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "enforcement must be flag or reject"})
+		return
+	}
+	if _, err := payloadschema.Compile(req.Schema); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid schema: " + err.Error()})
+		return
+	}
+
+	userID, _ := middleware.GetUserFromGinContext(ctx)
+	schema := &hardware_models.PayloadSchema{
+		DeviceType:  deviceType,
+		Schema:      req.Schema,
+		Enforcement: req.Enforcement,
+		Active:      req.Active == nil || *req.Active,
+		CreatedBy:   userID,
+	}
+
+	if err := c.schemaRepo.CreateSchema(ctx.Request.Context(), schema); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.validator.Invalidate()
+
+	c.recordAudit(ctx, "device_type.schema.create", deviceType, map[string]interface{}{
+		"version":     schema.Version,
+		"enforcement": schema.Enforcement,
+		"active":      schema.Active,
+	})
+
+	ctx.JSON(http.StatusCreated, schema)
+}
+
+// UpdateSchemaRequest changes a version's enforcement or activates or
+// deactivates it. The document itself is immutable; add a version instead.
+type UpdateSchemaRequest struct {
+	Enforcement *string `json:"enforcement,omitempty"`
+	Active      *bool   `json:"active,omitempty"`
+}
+
+// UpdateSchema changes how a schema version is enforced
+func (c *PayloadSchemaController) UpdateSchema(ctx *gin.Context) {
+	deviceType := ctx.Param("device_type")
+	version, ok := parseVersion(ctx)
+	if !ok {
+		return
+	}
+
+	var req UpdateSchemaRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	if req.Enforcement == nil && req.Active == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "enforcement or active is required"})
+		return
+	}
+	if req.Enforcement != nil && !validEnforcement(*req.Enforcement) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "enforcement must be flag or reject"})
+		return
+	}
+
+	schema, err := c.schemaRepo.UpdateSchema(ctx.Request.Context(), deviceType, version, req.Enforcement, req.Active)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "schema not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.validator.Invalidate()
+
+	c.recordAudit(ctx, "device_type.schema.update", deviceType, map[string]interface{}{
+		"version":     schema.Version,
+		"enforcement": schema.Enforcement,
+		"active":      schema.Active,
+	})
+
+	ctx.JSON(http.StatusOK, schema)
+}
+
+// DeleteSchema removes a schema version. The active version has to be
+// deactivated first so validation is never switched off by accident.
+func (c *PayloadSchemaController) DeleteSchema(ctx *gin.Context) {
+	deviceType := ctx.Param("device_type")
+	version, ok := parseVersion(ctx)
+	if !ok {
+		return
+	}
+
+	schema, err := c.schemaRepo.GetSchema(ctx.Request.Context(), deviceType, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "schema not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if schema.Active {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "schema is active; deactivate it before deleting"})
+		return
+	}
+
+	deleted, err := c.schemaRepo.DeleteSchema(ctx.Request.Context(), deviceType, version)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !deleted {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "schema not found"})
+		return
+	}
+	c.validator.Invalidate()
+
+	c.recordAudit(ctx, "device_type.schema.delete", deviceType, map[string]interface{}{
+		"version": version,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+// ListViolations returns the most recent readings of a device type that were
+// stored despite failing their schema
+func (c *PayloadSchemaController) ListViolations(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultViolationsLimit)))
+	if err != nil || limit < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxViolationsLimit {
+		limit = maxViolationsLimit
+	}
+
+	violations, err := c.schemaRepo.ListViolations(ctx.Request.Context(), ctx.Param("device_type"), limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": violations})
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/cacheinvalidation"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// PendingDeviceController lets a Pi's owner or an admin review the devices the
+// Pi announced on its discovery topic. Approving creates the device, after which
+// the ingestor accepts its readings; rejecting discards the announcement.
+type PendingDeviceController struct {
+	pendingDeviceRepo interfaces.PendingDeviceRepository
+	piRepo            interfaces.PiRepository
+	auditService      *audit.Service
+	caches            *cacheinvalidation.Bus
+	logger            *logger.Logger
+}
+
+// NewPendingDeviceController creates a new pending device controller
+func NewPendingDeviceController(pendingDeviceRepo interfaces.PendingDeviceRepository, piRepo interfaces.PiRepository, auditService *audit.Service, caches *cacheinvalidation.Bus, logger *logger.Logger) *PendingDeviceController {
+	return &PendingDeviceController{
+		pendingDeviceRepo: pendingDeviceRepo,
+		piRepo:            piRepo,
+		auditService:      auditService,
+		caches:            caches,
+		logger:            logger,
+	}
+}
+
+// Routes declares the pending device routes
+func (c *PendingDeviceController) Routes() []routing.Route {
+	return []routing.Route{
+		// Admin: any pi, User: their own pis
+		{Method: http.MethodGet, Path: "/pis/:pi_id/pending-devices", Access: routing.Authenticated, Handler: c.ListPendingDevices},
+		{Method: http.MethodPost, Path: "/pis/:pi_id/pending-devices/:device_id/approve", Access: routing.Authenticated, Handler: c.ApprovePendingDevice},
+		{Method: http.MethodPost, Path: "/pis/:pi_id/pending-devices/:device_id/reject", Access: routing.Authenticated, Handler: c.RejectPendingDevice},
+	}
+}
+
+// authorizePi writes a 404 or 403 and returns false unless the caller is an
+// admin or owns the pi
+func (c *PendingDeviceController) authorizePi(ctx *gin.Context, piID string) bool {
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole == "admin" {
+		return true
+	}
+
+	currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+	if err != nil || pi == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+		return false
+	}
+	if pi.UserID != currentUserID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return false
+	}
+	return true
+}
+
+// ListPendingDevices returns the devices a pi announced that await approval
+func (c *PendingDeviceController) ListPendingDevices(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	if !c.authorizePi(ctx, piID) {
+		return
+	}
+
+	devices, err := c.pendingDeviceRepo.ListByPi(ctx.Request.Context(), piID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": devices})
+}
+
+// ApprovePendingDeviceRequest optionally sets the new device's meta
+type ApprovePendingDeviceRequest struct {
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// ApprovePendingDevice creates the device from its pending entry
+func (c *PendingDeviceController) ApprovePendingDevice(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+	if !c.authorizePi(ctx, piID) {
+		return
+	}
+
+	// The body is optional
+	var req ApprovePendingDeviceRequest
+	if ctx.Request.ContentLength != 0 && !bindJSON(ctx, &req) {
+		return
+	}
+	if err := validateMetaUnits(req.Meta); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device, err := c.pendingDeviceRepo.Approve(ctx.Request.Context(), piID, deviceID, req.Meta)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "pending device not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.caches.DeviceChanged(piID, deviceID, ingest_models.CacheInvalidationCreated)
+
+	userID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      userID,
+		Action:       "pi.pending_device.approve",
+		ResourceType: "pi",
+		ResourceID:   piID,
+		Details: map[string]interface{}{
+			"device_id":   deviceID,
+			"device_type": device.DeviceType,
+		},
+	})
+
+	ctx.JSON(http.StatusCreated, device)
+}
+
+// RejectPendingDevice discards a pending entry. The device shows up again if
+// the pi announces it again.
+func (c *PendingDeviceController) RejectPendingDevice(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+	if !c.authorizePi(ctx, piID) {
+		return
+	}
+
+	rejected, err := c.pendingDeviceRepo.Reject(ctx.Request.Context(), piID, deviceID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !rejected {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "pending device not found"})
+		return
+	}
+
+	userID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      userID,
+		Action:       "pi.pending_device.reject",
+		ResourceType: "pi",
+		ResourceID:   piID,
+		Details: map[string]interface{}{
+			"device_id": deviceID,
+		},
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"rejected": true})
+}
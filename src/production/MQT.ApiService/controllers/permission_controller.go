@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+)
+
+// capabilityRoutes names the route behind each convenience flag, so a flag is
+// true exactly when the route's access check would let the user through.
+// can_read_all isn't a route; it is whether handlers skip ownership checks.
+var capabilityRoutes = map[string]struct{ method, path string }{
+	"can_manage_users":       {http.MethodPut, "/api/users/:id"},
+	"can_change_roles":       {http.MethodPut, "/api/users/:id/role"},
+	"can_register_admins":    {http.MethodPost, "/api/auth/register/admin"},
+	"can_impersonate":        {http.MethodPost, "/api/auth/impersonate/:user_id"},
+	"can_write_pis":          {http.MethodPost, "/pis"},
+	"can_write_devices":      {http.MethodPost, "/pis/:pi_id/devices"},
+	"can_manage_credentials": {http.MethodPost, "/pis/:pi_id/mqtt-credentials"},
+	"can_manage_schemas":     {http.MethodPost, "/device-types/:device_type/schemas"},
+	"can_purge_readings":     {http.MethodPost, "/admin/purges"},
+	"can_manage_maintenance": {http.MethodPost, "/admin/maintenance"},
+}
+
+// Permission is one route the user may call. Scope is "all" when the route
+// reaches every resource and "own" when handlers limit it to the user's own.
+type Permission struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Scope  string `json:"scope"`
+}
+
+// permissionSet is what a role resolves to
+type permissionSet struct {
+	Permissions  []Permission    `json:"permissions"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// PermissionController tells clients what the current user may do, resolved
+// from the route table the access middleware enforces. Rights depend only on
+// whether the role is admin and routes are fixed once registered, so each of
+// the two sets is resolved once.
+type PermissionController struct {
+	routes      *routing.Registry
+	rbacService *rbac.Service
+
+	mu    sync.Mutex
+	cache map[bool]*permissionSet
+}
+
+// NewPermissionController creates a new permission controller. routes must be
+// the registry the routes are applied from.
+func NewPermissionController(routes *routing.Registry, rbacService *rbac.Service) *PermissionController {
+	return &PermissionController{
+		routes:      routes,
+		rbacService: rbacService,
+		cache:       make(map[bool]*permissionSet),
+	}
+}
+
+// Routes declares the permission routes
+func (c *PermissionController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/api/auth/permissions", Access: routing.Authenticated, Handler: c.GetPermissions},
+	}
+}
+
+// GetPermissions returns the authenticated user's role, the routes it may call
+// and convenience flags for common UI decisions
+func (c *PermissionController) GetPermissions(ctx *gin.Context) {
+	role, err := middleware.GetRoleFromGinContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	isAdmin := c.rbacService.IsAdmin(role)
+	set := c.resolve(isAdmin)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"role":         role,
+		"is_admin":     isAdmin,
+		"permissions":  set.Permissions,
+		"capabilities": set.Capabilities,
+	})
+}
+
+// resolve returns the cached permission set for admins or everyone else
+func (c *PermissionController) resolve(isAdmin bool) *permissionSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if set, ok := c.cache[isAdmin]; ok {
+		return set
+	}
+
+	set := &permissionSet{Capabilities: map[string]bool{"can_read_all": isAdmin}}
+	for _, route := range c.routes.RoutesFor(isAdmin) {
+		scope := "own"
+		if isAdmin || route.Access == routing.Admin.String() {
+			scope = "all"
+		}
+		set.Permissions = append(set.Permissions, Permission{Method: route.Method, Path: route.Path, Scope: scope})
+	}
+	for name, route := range capabilityRoutes {
+		set.Capabilities[name] = c.routes.Permits(route.method, route.path, isAdmin)
+	}
+
+	c.cache[isAdmin] = set
+	return set
+}
@@ -7,42 +7,55 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/cacheinvalidation"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/ingeststats"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
-	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
 )
 
 // PiController handles Pi management requests
 type PiController struct {
-	piRepo         interfaces.PiRepository
-	userRepo       interfaces.UserRepository
-	logger         *logger.Logger
-	authMiddleware *middleware.AuthMiddleware
+	piRepo      interfaces.PiRepository
+	userRepo    interfaces.UserRepository
+	errorRepo   interfaces.IngestErrorRepository
+	ingestStats *ingeststats.Counter
+	caches      *cacheinvalidation.Bus
+	lookupKeys  []string
+	logger      *logger.Logger
 }
 
 // NewPiController creates a new pi controller
-func NewPiController(piRepo interfaces.PiRepository, userRepo interfaces.UserRepository, logger *logger.Logger, authMiddleware *middleware.AuthMiddleware) *PiController {
+func NewPiController(piRepo interfaces.PiRepository, userRepo interfaces.UserRepository, errorRepo interfaces.IngestErrorRepository, ingestStats *ingeststats.Counter, caches *cacheinvalidation.Bus, lookupKeys []string, logger *logger.Logger) *PiController {
 	return &PiController{
-		piRepo:         piRepo,
-		userRepo:       userRepo,
-		logger:         logger,
-		authMiddleware: authMiddleware,
+		piRepo:      piRepo,
+		userRepo:    userRepo,
+		errorRepo:   errorRepo,
+		ingestStats: ingestStats,
+		caches:      caches,
+		lookupKeys:  lookupKeys,
+		logger:      logger,
 	}
 }
 
-// RegisterRoutes registers the pi routes with Gin
-func (c *PiController) RegisterRoutes(router *gin.Engine) {
-	pis := router.Group("/pis")
-	{
+// Routes declares the pi routes
+func (c *PiController) Routes() []routing.Route {
+	return []routing.Route{
 		// Admin only - create/update/delete
-		pis.POST("", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.CreatePi)
-		pis.PATCH("/:pi_id", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.UpdatePi)
-		pis.DELETE("/:pi_id", c.authMiddleware.Authenticate(), c.authMiddleware.RequireAdmin(), c.DeletePi)
+		{Method: http.MethodPost, Path: "/pis", Access: routing.Admin, Middleware: []gin.HandlerFunc{middleware.StrictJSON()}, Handler: c.CreatePi},
+		{Method: http.MethodPatch, Path: "/pis/:pi_id", Access: routing.Admin, Handler: c.UpdatePi},
+		{Method: http.MethodDelete, Path: "/pis/:pi_id", Access: routing.Admin, Handler: c.DeletePi},
 
 		// Admin: all PIs, User: only their assigned PIs
-		pis.GET("", c.authMiddleware.Authenticate(), c.ListPis)
-		pis.GET("/:pi_id", c.authMiddleware.Authenticate(), c.GetPi)
+		{Method: http.MethodGet, Path: "/pis", Access: routing.Authenticated, Handler: c.ListPis},
+		{Method: http.MethodGet, Path: "/pis/lookup", Access: routing.Authenticated, Handler: c.LookupPis},
+		{Method: http.MethodGet, Path: "/pis/:pi_id", Access: routing.Authenticated, Handler: c.GetPi},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/ingest-stats", Access: routing.Authenticated, Handler: c.GetIngestStats},
+		{Method: http.MethodGet, Path: "/pis/:pi_id/ingest-errors", Access: routing.Authenticated, Handler: c.ListIngestErrors},
 	}
 }
 
@@ -53,14 +66,13 @@ type CreatePiRequest struct {
 
 func (c *PiController) CreatePi(ctx *gin.Context) {
 	var req CreatePiRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &req) {
 		return
 	}
 
 	// Validate that the user exists if user_id is provided
 	if req.UserID != "" {
-		user, err := c.userRepo.GetUser(ctx, req.UserID)
+		user, err := c.userRepo.GetUser(ctx.Request.Context(), req.UserID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
@@ -81,12 +93,13 @@ func (c *PiController) CreatePi(ctx *gin.Context) {
 		CreatedAt: time.Now(),
 	}
 
-	if err := c.piRepo.CreateOrUpdatePi(ctx, pi); err != nil {
+	if err := c.piRepo.CreateOrUpdatePi(ctx.Request.Context(), pi); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.PiChanged(pi.PiID, ingest_models.CacheInvalidationCreated)
 
-	ctx.JSON(http.StatusCreated, pi)
+	ctx.JSON(http.StatusCreated, api_models.NewPiResponse(pi))
 }
 
 func (c *PiController) ListPis(ctx *gin.Context) {
@@ -102,18 +115,19 @@ func (c *PiController) ListPis(ctx *gin.Context) {
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "10"))
 
-	result, err := c.piRepo.ListPis(ctx, filterUserID, page, pageSize)
+	opts := interfaces.PageOptions{Page: page, PageSize: pageSize, IncludeTotal: includeTotal(ctx)}
+	result, err := c.piRepo.ListPis(ctx.Request.Context(), filterUserID, opts)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	ctx.JSON(http.StatusOK, piPage(result))
 }
 
 func (c *PiController) GetPi(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
-	pi, err := c.piRepo.GetPi(ctx, piID)
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
@@ -133,7 +147,36 @@ func (c *PiController) GetPi(ctx *gin.Context) {
 		}
 	}
 
-	ctx.JSON(http.StatusOK, pi)
+	ctx.JSON(http.StatusOK, api_models.NewPiResponse(*pi))
+}
+
+// LookupPis finds pis by external identifiers in their meta, e.g.
+// /pis/lookup?meta.serial=ABC123. Users only see their own pis.
+func (c *PiController) LookupPis(ctx *gin.Context) {
+	match, ok := parseMetaLookup(ctx, c.lookupKeys)
+	if !ok {
+		return
+	}
+
+	ownerID := ""
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		ownerID, _ = middleware.GetUserFromGinContext(ctx)
+	}
+
+	pis, err := c.piRepo.FindPisByMeta(ctx.Request.Context(), match, ownerID, metaLookupLimit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(pis) == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no pis match", "code": "not_found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api_models.ListResponse[api_models.PiResponse]{
+		Items: api_models.MapItems(pis, api_models.NewPiResponse),
+	})
 }
 
 type UpdatePiRequest struct {
@@ -144,7 +187,7 @@ func (c *PiController) UpdatePi(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
 
 	// Get existing pi
-	existingPi, err := c.piRepo.GetPi(ctx, piID)
+	existingPi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
@@ -155,8 +198,7 @@ func (c *PiController) UpdatePi(ctx *gin.Context) {
 	}
 
 	var req UpdatePiRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &req) {
 		return
 	}
 
@@ -165,19 +207,20 @@ func (c *PiController) UpdatePi(ctx *gin.Context) {
 		existingPi.UserID = *req.UserID
 	}
 
-	if err := c.piRepo.UpdatePi(ctx, *existingPi); err != nil {
+	if err := c.piRepo.UpdatePi(ctx.Request.Context(), *existingPi); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.PiChanged(piID, ingest_models.CacheInvalidationUpdated)
 
-	ctx.JSON(http.StatusOK, existingPi)
+	ctx.JSON(http.StatusOK, api_models.NewPiResponse(*existingPi))
 }
 
 func (c *PiController) DeletePi(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
 	cascade := ctx.DefaultQuery("cascade", "false") == "true"
 
-	if err := c.piRepo.DeletePi(ctx, piID, cascade); err != nil {
+	if err := c.piRepo.DeletePi(ctx.Request.Context(), piID, cascade); err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -185,6 +228,108 @@ func (c *PiController) DeletePi(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.caches.PiChanged(piID, ingest_models.CacheInvalidationDeleted)
 
 	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
 }
+
+// GetIngestStats returns recent per-device reading counts for a Pi, served from
+// in-memory counters rather than the readings table
+func (c *PiController) GetIngestStats(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+	if err == sql.ErrNoRows {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check ownership if not admin
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, c.ingestStats.PiStats(piID))
+}
+
+// Page size of ListIngestErrors, by default and at most
+const (
+	defaultIngestErrorsPageSize = 50
+	maxIngestErrorsPageSize     = 500
+)
+
+// ListIngestErrors returns the errors the ingestor reported for a Pi's
+// readings, newest first, to the Pi's owner or an admin. from and to (RFC3339)
+// bound the error times, to exclusive; page and page_size page through them.
+func (c *PiController) ListIngestErrors(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+	if err == sql.ErrNoRows {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check ownership if not admin
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	query := interfaces.IngestErrorQuery{PiID: piID}
+	query.Page, err = strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || query.Page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return
+	}
+	query.PageSize, err = strconv.Atoi(ctx.DefaultQuery("page_size", strconv.Itoa(defaultIngestErrorsPageSize)))
+	if err != nil || query.PageSize < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be a positive integer"})
+		return
+	}
+	query.PageSize = min(query.PageSize, maxIngestErrorsPageSize)
+	var ok bool
+	if query.From, ok = parseOptionalTime(ctx, "from"); !ok {
+		return
+	}
+	if query.To, ok = parseOptionalTime(ctx, "to"); !ok {
+		return
+	}
+
+	result, err := c.errorRepo.ListByPi(ctx.Request.Context(), query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// parseOptionalTime reads an optional RFC3339 query parameter, answering 400
+// and returning false when it is malformed
+func parseOptionalTime(ctx *gin.Context, name string) (*time.Time, bool) {
+	v := ctx.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	parsed, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ": expected RFC3339"})
+		return nil, false
+	}
+	return &parsed, true
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/purge"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+)
+
+const (
+	defaultPurgeListLimit = 50
+	maxPurgeListLimit     = 500
+)
+
+// PurgeController deletes ranges of readings for administrators
+type PurgeController struct {
+	purger       *purge.Purger
+	auditService *audit.Service
+	logger       *logger.Logger
+}
+
+// NewPurgeController creates a new purge controller
+func NewPurgeController(purger *purge.Purger, auditService *audit.Service, logger *logger.Logger) *PurgeController {
+	return &PurgeController{
+		purger:       purger,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// Routes declares the purge routes
+func (c *PurgeController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodPost, Path: "/admin/purges", Access: routing.Admin, Handler: c.Purge},
+		{Method: http.MethodGet, Path: "/admin/purges", Access: routing.Admin, Handler: c.ListPurges},
+		{Method: http.MethodGet, Path: "/admin/purges/:id", Access: routing.Admin, Handler: c.GetPurge},
+		{Method: http.MethodPost, Path: "/admin/purges/:id/cancel", Access: routing.Admin, Handler: c.CancelPurge},
+	}
+}
+
+// PurgeRequest deletes one device's readings in the half-open range [from, to)
+type PurgeRequest struct {
+	PiID     string    `json:"pi_id" binding:"required"`
+	DeviceID *int      `json:"device_id" binding:"required"`
+	From     time.Time `json:"from" binding:"required"`
+	To       time.Time `json:"to" binding:"required"`
+}
+
+// Purge deletes a range of readings. Small ranges are deleted before the
+// response (200 with the count); larger ones start a chunked background job
+// (202 with the job, whose progress is at GET /admin/purges/:id).
+func (c *PurgeController) Purge(ctx *gin.Context) {
+	var req PurgeRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	if !req.From.Before(req.To) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	adminID, _ := middleware.GetUserFromGinContext(ctx)
+	result, err := c.purger.Purge(ctx.Request.Context(), purge.Request{
+		PiID:     req.PiID,
+		DeviceID: *req.DeviceID,
+		From:     req.From,
+		To:       req.To,
+	}, adminID)
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Str("pi_id", req.PiID).Int("device_id", *req.DeviceID).Msg("Failed to purge readings")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge readings"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"device_id": *req.DeviceID,
+		"from":      req.From,
+		"to":        req.To,
+	}
+	if result.Job != nil {
+		details["purge_id"] = result.Job.PurgeID
+		details["estimated_rows"] = result.Job.EstimatedRows
+	} else {
+		details["deleted_rows"] = result.Deleted
+	}
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "readings.purge",
+		ResourceType: "pi",
+		ResourceID:   req.PiID,
+		Details:      details,
+	})
+
+	if result.Job != nil {
+		ctx.JSON(http.StatusAccepted, result.Job)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted_rows": result.Deleted})
+}
+
+// ListPurges returns the most recent purge jobs, newest first
+func (c *PurgeController) ListPurges(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultPurgeListLimit)))
+	if err != nil || limit < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxPurgeListLimit {
+		limit = maxPurgeListLimit
+	}
+
+	jobs, err := c.purger.List(ctx.Request.Context(), limit)
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Msg("Failed to list purge jobs")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list purge jobs"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"items": jobs})
+}
+
+// GetPurge returns a purge job and its progress
+func (c *PurgeController) GetPurge(ctx *gin.Context) {
+	purgeID, ok := parsePurgeID(ctx)
+	if !ok {
+		return
+	}
+
+	job, err := c.purger.Get(ctx.Request.Context(), purgeID)
+	if errors.Is(err, purge.ErrJobNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Int64("purge_id", purgeID).Msg("Failed to get purge job")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get purge job"})
+		return
+	}
+	ctx.JSON(http.StatusOK, job)
+}
+
+// CancelPurge asks a running purge job to stop after its current chunk. The
+// job reports "cancelled" once it has stopped; finished jobs are unchanged.
+func (c *PurgeController) CancelPurge(ctx *gin.Context) {
+	purgeID, ok := parsePurgeID(ctx)
+	if !ok {
+		return
+	}
+
+	job, err := c.purger.Cancel(ctx.Request.Context(), purgeID)
+	if errors.Is(err, purge.ErrJobNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.logger.Logger.Error().Err(err).Int64("purge_id", purgeID).Msg("Failed to cancel purge job")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel purge job"})
+		return
+	}
+
+	adminID, _ := middleware.GetUserFromGinContext(ctx)
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "readings.purge.cancel",
+		ResourceType: "pi",
+		ResourceID:   job.PiID,
+		Details: map[string]interface{}{
+			"purge_id": purgeID,
+			"status":   job.Status,
+		},
+	})
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// parsePurgeID reads the :id path parameter, responding 400 if it's invalid
+func parsePurgeID(ctx *gin.Context) (int64, bool) {
+	purgeID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || purgeID < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid purge id"})
+		return 0, false
+	}
+	return purgeID, true
+}
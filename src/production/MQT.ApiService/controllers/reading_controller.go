@@ -6,37 +6,41 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
-	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
 )
 
 // ReadingController handles Reading management requests
 type ReadingController struct {
-	readingRepo    interfaces.ReadingRepository
-	piRepo         interfaces.PiRepository
-	logger         *logger.Logger
-	authMiddleware *middleware.AuthMiddleware
+	readingRepo interfaces.ReadingRepository
+	piRepo      interfaces.PiRepository
+	deviceRepo  interfaces.DeviceRepository
+	inclusiveTo bool // default for inclusive_to
+	logger      *logger.Logger
 }
 
-// NewReadingController creates a new reading controller
-func NewReadingController(readingRepo interfaces.ReadingRepository, piRepo interfaces.PiRepository, logger *logger.Logger, authMiddleware *middleware.AuthMiddleware) *ReadingController {
+// NewReadingController creates a new reading controller. inclusiveTo makes "to"
+// inclusive when a request doesn't say; see READINGS_INCLUSIVE_TO.
+func NewReadingController(readingRepo interfaces.ReadingRepository, piRepo interfaces.PiRepository, deviceRepo interfaces.DeviceRepository, inclusiveTo bool, logger *logger.Logger) *ReadingController {
 	return &ReadingController{
-		readingRepo:    readingRepo,
-		piRepo:         piRepo,
-		logger:         logger,
-		authMiddleware: authMiddleware,
+		readingRepo: readingRepo,
+		piRepo:      piRepo,
+		deviceRepo:  deviceRepo,
+		inclusiveTo: inclusiveTo,
+		logger:      logger,
 	}
 }
 
-// RegisterRoutes registers the reading routes with Gin
-func (c *ReadingController) RegisterRoutes(router *gin.Engine) {
-	readings := router.Group("/readings")
-	{
-		// Admin: all readings, User: readings from their devices
-		readings.GET("/latest", c.authMiddleware.Authenticate(), c.GetLatestReadings)
-		readings.GET("", c.authMiddleware.Authenticate(), c.GetReadings)
-		readings.GET("/pis/:pi_id/devices/:device_id", c.authMiddleware.Authenticate(), c.GetDeviceReadings)
+// Routes declares the reading routes. Admin: all readings, User: readings from their devices.
+func (c *ReadingController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/readings/latest", Access: routing.Authenticated, Handler: c.GetLatestReadings},
+		{Method: http.MethodGet, Path: "/readings", Access: routing.Authenticated, Handler: c.GetReadings},
+		{Method: http.MethodGet, Path: "/readings/pis/:pi_id/devices/:device_id", Access: routing.Authenticated, Handler: c.GetDeviceReadings},
 	}
 }
 
@@ -51,7 +55,7 @@ func (c *ReadingController) GetLatestReadings(ctx *gin.Context) {
 	userRole, _ := middleware.GetRoleFromGinContext(ctx)
 	if userRole != "admin" {
 		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
-		pi, err := c.piRepo.GetPi(ctx, piID)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -62,13 +66,30 @@ func (c *ReadingController) GetLatestReadings(ctx *gin.Context) {
 		}
 	}
 
-	readings, err := c.readingRepo.GetLatestReadings(ctx, piID)
+	system, ok := parseUnitsSystem(ctx)
+	if !ok {
+		return
+	}
+	flattenDepth, ok := parseFlatten(ctx)
+	if !ok {
+		return
+	}
+
+	readings, err := c.readingRepo.GetLatestReadings(ctx.Request.Context(), piID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"items": readings})
+	if err := applyUnits(ctx.Request.Context(), c.deviceRepo, piID, system, readings); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	applyFlatten(readings, flattenDepth)
+	applyIncludeReceived(ctx, readings)
+	ctx.JSON(http.StatusOK, api_models.ListResponse[api_models.ReadingResponse]{
+		Items: api_models.MapItems(readings, api_models.NewReadingResponse),
+	})
 }
 
 func (c *ReadingController) GetReadings(ctx *gin.Context) {
@@ -82,7 +103,7 @@ func (c *ReadingController) GetReadings(ctx *gin.Context) {
 	userRole, _ := middleware.GetRoleFromGinContext(ctx)
 	if userRole != "admin" {
 		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
-		pi, err := c.piRepo.GetPi(ctx, piID)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -93,44 +114,72 @@ func (c *ReadingController) GetReadings(ctx *gin.Context) {
 		}
 	}
 
-	deviceID := ctx.Query("device_id")
+	deviceID, ok := parseDeviceIDQuery(ctx)
+	if !ok {
+		return
+	}
 	fromStr := ctx.Query("from")
 	toStr := ctx.Query("to")
-	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
-	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, page := parseReadingPaging(ctx)
 
 	params := interfaces.ReadingQueryParams{
 		PiID:     piID,
 		DeviceID: deviceID,
 		Limit:    limit,
 		Page:     page,
+
+		IncludeTotal: includeTotal(ctx),
 	}
 
 	if fromStr != "" {
 		if from, err := time.Parse(time.RFC3339, fromStr); err == nil {
+			from = hardware_models.NormalizeTimestamp(from)
 			params.From = &from
 		}
 	}
 
 	if toStr != "" {
 		if to, err := time.Parse(time.RFC3339, toStr); err == nil {
+			to = hardware_models.NormalizeTimestamp(to)
 			params.To = &to
 		}
 	}
+	applyInclusiveTo(ctx, &params, c.inclusiveTo)
+
+	if !applySinceParams(ctx, &params) {
+		return
+	}
+	if !applySampleParam(ctx, &params) {
+		return
+	}
 
-	result, err := c.readingRepo.GetReadings(ctx, params)
+	system, ok := parseUnitsSystem(ctx)
+	if !ok {
+		return
+	}
+	flattenDepth, ok := parseFlatten(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.readingRepo.GetReadings(ctx.Request.Context(), params)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	if err := applyUnits(ctx.Request.Context(), c.deviceRepo, piID, system, result.Items); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	applyFlatten(result.Items, flattenDepth)
+	applyIncludeReceived(ctx, result.Items)
+	ctx.JSON(http.StatusOK, readingPage(result, params))
 }
 
 func (c *ReadingController) GetDeviceReadings(ctx *gin.Context) {
 	piID := ctx.Param("pi_id")
-	deviceIDStr := ctx.Param("device_id")
-	deviceID, err := strconv.Atoi(deviceIDStr)
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
 		return
@@ -140,7 +189,7 @@ func (c *ReadingController) GetDeviceReadings(ctx *gin.Context) {
 	userRole, _ := middleware.GetRoleFromGinContext(ctx)
 	if userRole != "admin" {
 		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
-		pi, err := c.piRepo.GetPi(ctx, piID)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
 		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
 			return
@@ -153,33 +202,201 @@ func (c *ReadingController) GetDeviceReadings(ctx *gin.Context) {
 
 	fromStr := ctx.Query("from")
 	toStr := ctx.Query("to")
-	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
-	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, page := parseReadingPaging(ctx)
 
 	params := interfaces.ReadingQueryParams{
 		PiID:     piID,
-		DeviceID: deviceIDStr,
+		DeviceID: &deviceID,
 		Limit:    limit,
 		Page:     page,
+
+		IncludeTotal: includeTotal(ctx),
 	}
 
 	if fromStr != "" {
 		if from, err := time.Parse(time.RFC3339, fromStr); err == nil {
+			from = hardware_models.NormalizeTimestamp(from)
 			params.From = &from
 		}
 	}
 
 	if toStr != "" {
 		if to, err := time.Parse(time.RFC3339, toStr); err == nil {
+			to = hardware_models.NormalizeTimestamp(to)
 			params.To = &to
 		}
 	}
+	applyInclusiveTo(ctx, &params, c.inclusiveTo)
+
+	if !applySinceParams(ctx, &params) {
+		return
+	}
+	if !applySampleParam(ctx, &params) {
+		return
+	}
+
+	system, ok := parseUnitsSystem(ctx)
+	if !ok {
+		return
+	}
+	flattenDepth, ok := parseFlatten(ctx)
+	if !ok {
+		return
+	}
 
-	result, err := c.readingRepo.GetReadingsByDevice(ctx, piID, deviceID, params)
+	result, err := c.readingRepo.GetReadingsByDevice(ctx.Request.Context(), params)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	if err := applyUnits(ctx.Request.Context(), c.deviceRepo, piID, system, result.Items); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	applyFlatten(result.Items, flattenDepth)
+	applyIncludeReceived(ctx, result.Items)
+	ctx.JSON(http.StatusOK, readingPage(result, params))
+}
+
+// applyIncludeReceived hides received_at unless the caller asked for it with
+// include_received=true
+func applyIncludeReceived(ctx *gin.Context, readings []hardware_models.Reading) {
+	if ctx.Query("include_received") == "true" {
+		return
+	}
+	for i := range readings {
+		readings[i].ReceivedAt = nil
+	}
+}
+
+// applyInclusiveTo reads inclusive_to. Ranges are half-open [from, to) so
+// day-by-day pages don't share boundary readings; inclusive_to=true restores
+// the old inclusive end for clients that relied on it. Without the parameter
+// the configured default applies.
+func applyInclusiveTo(ctx *gin.Context, params *interfaces.ReadingQueryParams, inclusiveDefault bool) {
+	switch ctx.Query("inclusive_to") {
+	case "true":
+		params.InclusiveTo = true
+	case "false":
+		params.InclusiveTo = false
+	default:
+		params.InclusiveTo = inclusiveDefault
+	}
+}
+
+// applySinceParams reads the incremental-sync parameters: since or
+// received_since (RFC3339 or Unix epoch seconds) and cursor (the
+// next_page_token of a previous query of the same kind). since syncs by
+// measurement time; received_since syncs by arrival and so also returns
+// readings replayed with a ts older than a since consumer's watermark. Neither
+// can be combined with from/to or the other. On failure it writes a 400 and
+// returns false.
+func applySinceParams(ctx *gin.Context, params *interfaces.ReadingQueryParams) bool {
+	sinceStr := ctx.Query("since")
+	receivedSinceStr := ctx.Query("received_since")
+	cursorStr := ctx.Query("cursor")
+	if sinceStr == "" && receivedSinceStr == "" && cursorStr == "" {
+		return true
+	}
+
+	if sinceStr != "" && receivedSinceStr != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "since cannot be combined with received_since"})
+		return false
+	}
+	if ctx.Query("from") != "" || ctx.Query("to") != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "since and received_since cannot be combined with from/to"})
+		return false
+	}
+	if sinceStr == "" && receivedSinceStr == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "cursor requires since or received_since"})
+		return false
+	}
+
+	name, value := "since", sinceStr
+	if receivedSinceStr != "" {
+		name, value = "received_since", receivedSinceStr
+	}
+	since, err := hardware_models.ParseTimestamp(value)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ": expected RFC3339 or Unix epoch seconds"})
+		return false
+	}
+	if receivedSinceStr != "" {
+		params.ReceivedSince = &since
+	} else {
+		params.Since = &since
+	}
+
+	if cursorStr != "" {
+		cursor, err := interfaces.DecodeReadingCursor(cursorStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		if (cursor.ReceivedAt != nil) != (params.ReceivedSince != nil) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cursor is from a different kind of query than " + name})
+			return false
+		}
+		params.After = cursor
+	}
+
+	return true
+}
+
+// applySampleParam reads sample=N, which keeps roughly every Nth reading of the
+// range for quick previews. It can't be combined with since, received_since or
+// cursor, whose
+// pages are keyset positions rather than row counts. On failure it writes a
+// 400 and returns false.
+func applySampleParam(ctx *gin.Context, params *interfaces.ReadingQueryParams) bool {
+	value := ctx.Query("sample")
+	if value == "" {
+		return true
+	}
+
+	sample, err := strconv.Atoi(value)
+	if err != nil || sample < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "sample must be a positive integer"})
+		return false
+	}
+	if params.Since != nil || params.ReceivedSince != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "sample cannot be combined with since/received_since/cursor"})
+		return false
+	}
+	params.Sample = sample
+	return true
+}
+
+// defaultReadingLimit is the page size when limit is absent or not positive
+const defaultReadingLimit = 100
+
+// parseReadingPaging reads limit and page. Missing, malformed or non-positive
+// values fall back to the defaults rather than reaching SQL as LIMIT 0 or a
+// negative offset.
+func parseReadingPaging(ctx *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultReadingLimit
+	}
+	page, err := strconv.Atoi(ctx.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return limit, page
+}
+
+// parseDeviceIDQuery reads the optional ?device_id= filter. It returns nil when
+// the parameter is absent; on a non-integer value it writes a 400 and returns false.
+func parseDeviceIDQuery(ctx *gin.Context) (*int, bool) {
+	value := ctx.Query("device_id")
+	if value == "" {
+		return nil, true
+	}
+	deviceID, err := strconv.Atoi(value)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "device_id must be an integer"})
+		return nil, false
+	}
+	return &deviceID, true
 }
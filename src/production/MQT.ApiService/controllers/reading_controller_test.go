@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// getAsAdmin runs handler for a GET of target by an admin, with the given
+// path parameters, and returns the recorded response
+func getAsAdmin(handler gin.HandlerFunc, target string, params ...gin.Param) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	ctx.Params = params
+	ctx.Set(string(middleware.UserRoleContextKey), "admin")
+	handler(ctx)
+	return w
+}
+
+// newReadingController returns a ReadingController over newMemoryController's
+// repositories holding hourly readings from 2024-01-01T00:00:00Z of pi-1:
+// 6 of device 0 and 4 of device 1
+func newReadingController(t *testing.T) *ReadingController {
+	t.Helper()
+	internal := newMemoryController(t)
+	ctx := context.Background()
+	if err := internal.deviceRepo.CreateOrUpdateDevice(ctx, hardware_models.Device{PiID: "pi-1", DeviceID: 1, DeviceType: "sensor", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateOrUpdateDevice: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for deviceID, count := range []int{6, 4} {
+		for n := range count {
+			reading := hardware_models.Reading{PiID: "pi-1", DeviceID: deviceID, Ts: start.Add(time.Duration(n) * time.Hour), Payload: map[string]interface{}{"t": n}}
+			if err := internal.readingRepo.CreateReading(ctx, reading); err != nil {
+				t.Fatalf("CreateReading: %v", err)
+			}
+		}
+	}
+	return NewReadingController(internal.readingRepo, internal.piRepo, internal.deviceRepo, false, nil)
+}
+
+// Total must count every reading the query matches, across pages and after
+// filters, sampling and since, and only when include_total asks for it
+func TestReadingsTotal(t *testing.T) {
+	total := func(n int) *int { return &n }
+
+	tests := []struct {
+		name      string
+		device    bool // GetDeviceReadings for device 0 rather than GetReadings for pi-1
+		query     string
+		wantItems int
+		wantTotal *int
+	}{
+		{name: "without include_total", query: "", wantItems: 10},
+		{name: "include_total false", query: "&include_total=false", wantItems: 10},
+		{name: "all", query: "&include_total=true", wantItems: 10, wantTotal: total(10)},
+		{name: "page of a larger total", query: "&include_total=true&limit=3&page=2", wantItems: 3, wantTotal: total(10)},
+		{name: "empty page", query: "&include_total=true&limit=5&page=3", wantItems: 0, wantTotal: total(10)},
+		{name: "device filter", query: "&include_total=true&device_id=1", wantItems: 4, wantTotal: total(4)},
+		{name: "range", query: "&include_total=true&from=2024-01-01T01:00:00Z&to=2024-01-01T03:00:00Z", wantItems: 4, wantTotal: total(4)},
+		{name: "sampled", query: "&include_total=true&sample=3", wantItems: 4, wantTotal: total(4)},
+		{name: "sampled page", query: "&include_total=true&sample=3&limit=3", wantItems: 3, wantTotal: total(4)},
+		{name: "since", query: "&include_total=true&since=2024-01-01T02:00:00Z&limit=2", wantItems: 2, wantTotal: total(4)},
+		{name: "since without include_total", query: "&since=2024-01-01T02:00:00Z", wantItems: 4},
+		{name: "device", device: true, query: "?include_total=true&limit=4", wantItems: 4, wantTotal: total(6)},
+		{name: "device sampled", device: true, query: "?include_total=true&sample=2", wantItems: 3, wantTotal: total(3)},
+		{name: "device since", device: true, query: "?include_total=true&since=2024-01-01T03:00:00Z", wantItems: 2, wantTotal: total(2)},
+		{name: "device without include_total", device: true, query: "", wantItems: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newReadingController(t)
+
+			var w *httptest.ResponseRecorder
+			if tt.device {
+				w = getAsAdmin(c.GetDeviceReadings, "/readings/pis/pi-1/devices/0"+tt.query,
+					gin.Param{Key: "pi_id", Value: "pi-1"}, gin.Param{Key: "device_id", Value: "0"})
+			} else {
+				w = getAsAdmin(c.GetReadings, "/readings?pi_id=pi-1"+tt.query)
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			var page api_models.ReadingPageResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(page.Items) != tt.wantItems {
+				t.Errorf("%d items, want %d", len(page.Items), tt.wantItems)
+			}
+			switch {
+			case tt.wantTotal == nil && page.Total != nil:
+				t.Errorf("total %d, want none", *page.Total)
+			case tt.wantTotal != nil && page.Total == nil:
+				t.Errorf("no total, want %d: %s", *tt.wantTotal, w.Body)
+			case tt.wantTotal != nil && *page.Total != *tt.wantTotal:
+				t.Errorf("total %d, want %d", *page.Total, *tt.wantTotal)
+			}
+		})
+	}
+}
+
+// A reading exactly at from is always returned; one exactly at to only when
+// to is inclusive, whether by the configured default or inclusive_to, and the
+// query echo reports the mode that was applied
+func TestReadingsRangeBoundaries(t *testing.T) {
+	const window = "from=2024-01-01T01:00:00Z&to=2024-01-01T03:00:00Z"
+
+	tests := []struct {
+		name          string
+		defaultToIncl bool // the controller's configured default
+		query         string
+		wantHours     []int
+		wantInclusive bool
+	}{
+		{name: "half-open by default", query: window, wantHours: []int{1, 2}},
+		{name: "inclusive_to", query: window + "&inclusive_to=true", wantHours: []int{1, 2, 3}, wantInclusive: true},
+		{name: "inclusive_to false", query: window + "&inclusive_to=false", wantHours: []int{1, 2}},
+		{name: "inclusive by default", defaultToIncl: true, query: window, wantHours: []int{1, 2, 3}, wantInclusive: true},
+		{name: "inclusive default overridden", defaultToIncl: true, query: window + "&inclusive_to=false", wantHours: []int{1, 2}},
+		{name: "from equals to", query: "from=2024-01-01T02:00:00Z&to=2024-01-01T02:00:00Z", wantHours: []int{}},
+		{name: "from equals to inclusive", query: "from=2024-01-01T02:00:00Z&to=2024-01-01T02:00:00Z&inclusive_to=true", wantHours: []int{2}, wantInclusive: true},
+		{name: "only from", query: "from=2024-01-01T04:00:00Z", wantHours: []int{4, 5}},
+		{name: "only to", query: "to=2024-01-01T01:00:00Z", wantHours: []int{0}},
+		{name: "only to inclusive", query: "to=2024-01-01T01:00:00Z&inclusive_to=true", wantHours: []int{0, 1}, wantInclusive: true},
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		for _, device := range []bool{false, true} {
+			name := tt.name
+			if device {
+				name += " by device"
+			}
+			t.Run(name, func(t *testing.T) {
+				c := newReadingController(t)
+				c.inclusiveTo = tt.defaultToIncl
+
+				var w *httptest.ResponseRecorder
+				if device {
+					w = getAsAdmin(c.GetDeviceReadings, "/readings/pis/pi-1/devices/0?"+tt.query,
+						gin.Param{Key: "pi_id", Value: "pi-1"}, gin.Param{Key: "device_id", Value: "0"})
+				} else {
+					w = getAsAdmin(c.GetReadings, "/readings?pi_id=pi-1&device_id=0&"+tt.query)
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+
+				var page api_models.ReadingPageResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				hours := []int{}
+				for _, item := range page.Items {
+					ts, err := time.Parse(time.RFC3339Nano, item.Ts)
+					if err != nil {
+						t.Fatalf("parsing ts %q: %v", item.Ts, err)
+					}
+					hours = append(hours, int(ts.Sub(start)/time.Hour))
+				}
+				sort.Ints(hours)
+				if !reflect.DeepEqual(hours, tt.wantHours) {
+					t.Errorf("readings at hours %v, want %v", hours, tt.wantHours)
+				}
+				if page.Query == nil {
+					t.Fatalf("no query echo: %s", w.Body)
+				}
+				if page.Query.ToInclusive != tt.wantInclusive {
+					t.Errorf("echoed to_inclusive %v, want %v", page.Query.ToInclusive, tt.wantInclusive)
+				}
+			})
+		}
+	}
+}
+
+// echoedReadings applies echo, as a client reading it would, to the readings
+// newReadingController stores, and returns them as device@hour in page order
+func echoedReadings(t *testing.T, echo *api_models.ReadingQueryEcho) []string {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	parse := func(value *string) *time.Time {
+		if value == nil {
+			return nil
+		}
+		ts, err := time.Parse(time.RFC3339Nano, *value)
+		if err != nil {
+			t.Fatalf("echoed time %q: %v", *value, err)
+		}
+		return &ts
+	}
+	from, to, since := parse(echo.From), parse(echo.To), parse(echo.Since)
+
+	type stored struct {
+		deviceID int
+		ts       time.Time
+	}
+	var matched []stored
+	for deviceID, count := range []int{6, 4} {
+		for n := range count {
+			ts := start.Add(time.Duration(n) * time.Hour)
+			switch {
+			case echo.PiID != "pi-1":
+			case echo.DeviceID != nil && *echo.DeviceID != deviceID:
+			case from != nil && ts.Before(*from):
+			case to != nil && echo.ToInclusive && ts.After(*to):
+			case to != nil && !echo.ToInclusive && !ts.Before(*to):
+			case since != nil && !ts.After(*since):
+			default:
+				matched = append(matched, stored{deviceID, ts})
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].ts.Equal(matched[j].ts) {
+			return matched[i].ts.After(matched[j].ts) == (echo.Order == api_models.ReadingOrderNewestFirst)
+		}
+		return matched[i].deviceID < matched[j].deviceID
+	})
+	if echo.Sample > 1 {
+		var sampled []stored
+		for n, reading := range matched {
+			if n%echo.Sample == 0 {
+				sampled = append(sampled, reading)
+			}
+		}
+		matched = sampled
+	}
+	if echo.Page > 1 {
+		matched = matched[min(len(matched), (echo.Page-1)*echo.Limit):]
+	}
+	matched = matched[:min(len(matched), echo.Limit)]
+
+	readings := []string{}
+	for _, reading := range matched {
+		readings = append(readings, fmt.Sprintf("%d@%d", reading.deviceID, int(reading.ts.Sub(start)/time.Hour)))
+	}
+	return readings
+}
+
+// The query echo must describe the predicates actually applied, for inputs
+// that are parsed, defaulted, normalized or ignored along the way: selecting
+// readings by the echo gives exactly the page returned
+func TestReadingsQueryEchoMatchesResults(t *testing.T) {
+	tests := []struct {
+		name   string
+		device bool // GetDeviceReadings for device 0 rather than GetReadings for pi-1
+		query  string
+		check  func(t *testing.T, echo *api_models.ReadingQueryEcho)
+	}{
+		{name: "offset", query: "from=2024-01-01T03:00:00%2B02:00", check: wantEchoed("from", "2024-01-01T01:00:00.000Z")},
+		{name: "offset with an unescaped plus", query: "from=2024-01-01T03:00:00+02:00", check: wantEchoed("from", "")},
+		{name: "sub-millisecond from", query: "from=2024-01-01T01:00:00.0004Z", check: wantEchoed("from", "2024-01-01T01:00:00.000Z")},
+		{name: "sub-millisecond to", query: "to=2024-01-01T01:00:00.0009Z", check: wantEchoed("to", "2024-01-01T01:00:00.000Z")},
+		{name: "sub-millisecond inclusive to", query: "to=2024-01-01T00:59:59.9999Z&inclusive_to=true", check: wantEchoed("to", "2024-01-01T00:59:59.999Z")},
+		{name: "nanoseconds by device", device: true, query: "from=2024-01-01T01:00:00.000000001Z&to=2024-01-01T03:00:00.000999999Z", check: wantEchoed("from", "2024-01-01T01:00:00.000Z")},
+		{name: "unparseable from", query: "from=yesterday", check: wantEchoed("from", "")},
+		{name: "date without a time", query: "to=2024-01-01", check: wantEchoed("to", "")},
+		{name: "from after to", query: "from=2024-01-01T04:00:00Z&to=2024-01-01T02:00:00Z", check: wantEchoed("to", "2024-01-01T02:00:00.000Z")},
+		{name: "inclusive_to without to", query: "inclusive_to=true", check: func(t *testing.T, echo *api_models.ReadingQueryEcho) {
+			if echo.ToInclusive {
+				t.Error("echoed to_inclusive without a to")
+			}
+		}},
+		{name: "inclusive_to in capitals", query: "to=2024-01-01T02:00:00Z&inclusive_to=TRUE", check: func(t *testing.T, echo *api_models.ReadingQueryEcho) {
+			if echo.ToInclusive {
+				t.Error("echoed to_inclusive for a value other than true")
+			}
+		}},
+		{name: "device 0", query: "device_id=0", check: func(t *testing.T, echo *api_models.ReadingQueryEcho) {
+			if echo.DeviceID == nil || *echo.DeviceID != 0 {
+				t.Errorf("echoed device_id %v, want 0", echo.DeviceID)
+			}
+		}},
+		{name: "limit 0", query: "limit=0", check: wantEchoedPaging(defaultReadingLimit, 1)},
+		{name: "negative limit", query: "limit=-3", check: wantEchoedPaging(defaultReadingLimit, 1)},
+		{name: "limit not a number", query: "limit=ten&page=2", check: wantEchoedPaging(defaultReadingLimit, 2)},
+		{name: "page 0", query: "limit=3&page=0", check: wantEchoedPaging(3, 1)},
+		{name: "a later page", query: "limit=3&page=3", check: wantEchoedPaging(3, 3)},
+		{name: "page past the end by device", device: true, query: "limit=4&page=3", check: wantEchoedPaging(4, 3)},
+		{name: "sampled page", query: "sample=3&limit=2&page=2", check: wantEchoedPaging(2, 2)},
+		{name: "since as epoch seconds", query: "since=1704070800&page=4", check: wantEchoed("since", "2024-01-01T01:00:00.000Z")},
+		{name: "since with an offset", query: "since=2024-01-01T03:00:00%2B02:00&limit=2", check: wantEchoed("since", "2024-01-01T01:00:00.000Z")},
+		{name: "since with a sub-millisecond epoch", device: true, query: "since=1704070800.0005", check: wantEchoed("since", "2024-01-01T01:00:00.000Z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newReadingController(t)
+
+			var w *httptest.ResponseRecorder
+			if tt.device {
+				w = getAsAdmin(c.GetDeviceReadings, "/readings/pis/pi-1/devices/0?"+tt.query,
+					gin.Param{Key: "pi_id", Value: "pi-1"}, gin.Param{Key: "device_id", Value: "0"})
+			} else {
+				w = getAsAdmin(c.GetReadings, "/readings?pi_id=pi-1&"+tt.query)
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			var page api_models.ReadingPageResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if page.Query == nil {
+				t.Fatalf("no query echo: %s", w.Body)
+			}
+			tt.check(t, page.Query)
+
+			got := []string{}
+			for _, item := range page.Items {
+				ts, err := time.Parse(time.RFC3339Nano, item.Ts)
+				if err != nil {
+					t.Fatalf("parsing ts %q: %v", item.Ts, err)
+				}
+				got = append(got, fmt.Sprintf("%d@%d", item.DeviceID, int(ts.Sub(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))/time.Hour)))
+			}
+			if want := echoedReadings(t, page.Query); !reflect.DeepEqual(got, want) {
+				echo, _ := json.Marshal(page.Query)
+				t.Errorf("returned %v, but the echo %s selects %v", got, echo, want)
+			}
+		})
+	}
+}
+
+// wantEchoed checks the echoed from, to or since; "" for null
+func wantEchoed(field, want string) func(*testing.T, *api_models.ReadingQueryEcho) {
+	return func(t *testing.T, echo *api_models.ReadingQueryEcho) {
+		t.Helper()
+		got := map[string]*string{"from": echo.From, "to": echo.To, "since": echo.Since}[field]
+		switch {
+		case want == "" && got != nil:
+			t.Errorf("echoed %s %q, want null", field, *got)
+		case want != "" && (got == nil || *got != want):
+			t.Errorf("echoed %s %v, want %q", field, got, want)
+		}
+	}
+}
+
+// wantEchoedPaging checks the echoed limit and page
+func wantEchoedPaging(limit, page int) func(*testing.T, *api_models.ReadingQueryEcho) {
+	return func(t *testing.T, echo *api_models.ReadingQueryEcho) {
+		t.Helper()
+		if echo.Limit != limit || echo.Page != page {
+			t.Errorf("echoed limit %d page %d, want %d and %d", echo.Limit, echo.Page, limit, page)
+		}
+	}
+}
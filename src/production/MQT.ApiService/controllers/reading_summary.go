@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+)
+
+// exactReadingCountLimit is the largest reading count reported exactly. Larger
+// counts come from planner statistics so the summary stays cheap for devices
+// with millions of readings.
+const exactReadingCountLimit = 100000
+
+// GetReadingSummary reports how many readings a device has and the span they
+// cover, so clients can warn before deleting or decommissioning it
+func (c *DeviceController) GetReadingSummary(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+	deviceID, err := strconv.Atoi(ctx.Param("device_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+
+	// Check if user has access to this PI
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+		if err != nil || pi == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+			return
+		}
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	if _, err := c.deviceRepo.GetDevice(ctx.Request.Context(), piID, deviceID); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := c.readingSummary(ctx, piID, deviceID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, summary)
+}
+
+// readingSummary summarises a device's readings for its response
+func (c *DeviceController) readingSummary(ctx *gin.Context, piID string, deviceID int) (api_models.ReadingSummaryResponse, error) {
+	summary, err := c.readingRepo.GetDeviceReadingSummary(ctx.Request.Context(), piID, deviceID, exactReadingCountLimit)
+	if err != nil {
+		return api_models.ReadingSummaryResponse{}, err
+	}
+	return api_models.ReadingSummaryResponse{
+		PiID:        piID,
+		DeviceID:    deviceID,
+		Count:       summary.Count,
+		Approximate: summary.Approximate,
+		FirstTs:     api_models.FormatOptionalTimestamp(summary.FirstTS),
+		LastTs:      api_models.FormatOptionalTimestamp(summary.LastTS),
+	}, nil
+}
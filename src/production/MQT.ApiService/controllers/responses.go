@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// includeTotal reads include_total. Totals cost a count of every matching row,
+// so pages only carry one when the caller asks with include_total=true.
+func includeTotal(ctx *gin.Context) bool {
+	return ctx.Query("include_total") == "true"
+}
+
+// piPage maps a page of pis from PiRepository.ListPis to its response
+func piPage(result *interfaces.PaginationResult) api_models.PageResponse[api_models.PiResponse] {
+	pis, _ := result.Items.([]hardware_models.Pi)
+	return api_models.PageResponse[api_models.PiResponse]{
+		Items:    api_models.MapItems(pis, api_models.NewPiResponse),
+		NextPage: result.NextPage,
+		Total:    result.Total,
+	}
+}
+
+// devicePage maps a page of devices from DeviceRepository.ListDevicesByPi to its response
+func devicePage(result *interfaces.PaginationResult) api_models.PageResponse[api_models.DeviceResponse] {
+	devices, _ := result.Items.([]hardware_models.Device)
+	return api_models.PageResponse[api_models.DeviceResponse]{
+		Items:    api_models.MapItems(devices, api_models.NewDeviceResponse),
+		NextPage: result.NextPage,
+		Total:    result.Total,
+	}
+}
+
+// deviceWithLatestPage maps a page from DeviceRepository.ListDevicesWithLatest to its response
+func deviceWithLatestPage(result *interfaces.PaginationResult) api_models.PageResponse[api_models.DeviceWithLatestResponse] {
+	devices, _ := result.Items.([]hardware_models.DeviceWithLatest)
+	return api_models.PageResponse[api_models.DeviceWithLatestResponse]{
+		Items:    api_models.MapItems(devices, api_models.NewDeviceWithLatestResponse),
+		NextPage: result.NextPage,
+		Total:    result.Total,
+	}
+}
+
+// readingPage maps a page of readings selected with params to its response
+func readingPage(result *interfaces.ReadingQueryResult, params interfaces.ReadingQueryParams) api_models.ReadingPageResponse {
+	return api_models.ReadingPageResponse{
+		Items:         api_models.MapItems(result.Items, api_models.NewReadingResponse),
+		NextPageToken: result.NextPageToken,
+		Total:         result.Total,
+		Sample:        result.Sample,
+		Query:         readingQueryEcho(params),
+	}
+}
+
+// readingQueryEcho describes params as the repository applies them: since
+// replaces page numbers with keyset paging, oldest first, and received_since
+// does the same in arrival order
+func readingQueryEcho(params interfaces.ReadingQueryParams) *api_models.ReadingQueryEcho {
+	echo := &api_models.ReadingQueryEcho{
+		PiID:        params.PiID,
+		DeviceID:    params.DeviceID,
+		From:        api_models.FormatOptionalTimestamp(params.From),
+		To:          api_models.FormatOptionalTimestamp(params.To),
+		ToInclusive: params.To != nil && params.InclusiveTo,
+		Limit:       params.Limit,
+		Page:        params.Page,
+		Order:       api_models.ReadingOrderNewestFirst,
+		Sample:      params.Sample,
+	}
+	if params.Since != nil {
+		echo.Since = api_models.FormatOptionalTimestamp(params.Since)
+		echo.Cursor = params.After != nil
+		echo.Page = 0
+		echo.Order = api_models.ReadingOrderOldestFirst
+	}
+	if params.ReceivedSince != nil {
+		echo.ReceivedSince = api_models.FormatOptionalTimestamp(params.ReceivedSince)
+		echo.Cursor = params.After != nil
+		echo.Page = 0
+		echo.Order = api_models.ReadingOrderArrival
+	}
+	return echo
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/seed"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+)
+
+// SeedController populates test environments with demo data
+type SeedController struct {
+	seeder       *seed.Seeder
+	auditService *audit.Service
+	logger       *logger.Logger
+}
+
+// NewSeedController creates a new seed controller
+func NewSeedController(seeder *seed.Seeder, auditService *audit.Service, logger *logger.Logger) *SeedController {
+	return &SeedController{
+		seeder:       seeder,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// Routes declares the seed routes
+func (c *SeedController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodPost, Path: "/admin/seed", Access: routing.Admin, Handler: c.Seed},
+	}
+}
+
+// SeedRequest names a seed and sizes it. Window and Interval are Go durations
+// such as "72h" and "5m"; omitted fields take the seeder's defaults.
+type SeedRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Users        int    `json:"users"`
+	PisPerUser   int    `json:"pis_per_user"`
+	DevicesPerPi int    `json:"devices_per_pi"`
+	Window       string `json:"window"`
+	Interval     string `json:"interval"`
+	Password     string `json:"password"`
+	Force        bool   `json:"force"`
+}
+
+// Seed generates users, pis, devices and readings under a seed name. A name
+// that already completed is a no-op (200 with the earlier run); a new seed
+// answers 201 with what it created.
+func (c *SeedController) Seed(ctx *gin.Context) {
+	var req SeedRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	seedReq := seed.Request{
+		Name:         req.Name,
+		Users:        req.Users,
+		PisPerUser:   req.PisPerUser,
+		DevicesPerPi: req.DevicesPerPi,
+		Password:     req.Password,
+		Force:        req.Force || ctx.Query("force") == "true",
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"window", req.Window, &seedReq.Window},
+		{"interval", req.Interval, &seedReq.Interval},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": field.name + " must be a duration such as 72h or 5m"})
+			return
+		}
+		*field.dst = d
+	}
+	if err := seedReq.Normalize(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := middleware.GetUserFromGinContext(ctx)
+	result, err := c.seeder.Seed(ctx.Request.Context(), seedReq, adminID)
+	switch {
+	case errors.Is(err, seed.ErrNotAllowed):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, seed.ErrRunning):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "seed_running"})
+		return
+	case errors.Is(err, seed.ErrDatabaseNotEmpty):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "database_not_empty"})
+		return
+	case err != nil:
+		c.logger.Logger.Error().Err(err).Str("seed", seedReq.Name).Msg("Failed to seed demo data")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seed demo data"})
+		return
+	}
+
+	if result.Existing != nil {
+		ctx.JSON(http.StatusOK, gin.H{"status": "already_seeded", "seed": result.Existing})
+		return
+	}
+
+	c.auditService.Record(ctx.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      adminID,
+		Action:       "seed.run",
+		ResourceType: "seed",
+		ResourceID:   seedReq.Name,
+		Details: map[string]interface{}{
+			"users":    len(result.Summary.Users),
+			"pis":      result.Summary.Pis,
+			"devices":  result.Summary.Devices,
+			"readings": result.Summary.Readings,
+			"forced":   seedReq.Force,
+		},
+	})
+
+	ctx.JSON(http.StatusCreated, gin.H{"status": "seeded", "seed": result.Summary})
+}
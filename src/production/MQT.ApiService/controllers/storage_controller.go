@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Bounds for the top consumers listing
+const (
+	defaultStorageTopLimit = 10
+	maxStorageTopLimit     = 100
+)
+
+// StorageController reports how much of the readings storage each Pi uses, as
+// computed by the storage accounting job
+type StorageController struct {
+	storageRepo interfaces.StorageUsageRepository
+	piRepo      interfaces.PiRepository
+	logger      *logger.Logger
+}
+
+// NewStorageController creates a new storage controller
+func NewStorageController(storageRepo interfaces.StorageUsageRepository, piRepo interfaces.PiRepository, logger *logger.Logger) *StorageController {
+	return &StorageController{
+		storageRepo: storageRepo,
+		piRepo:      piRepo,
+		logger:      logger,
+	}
+}
+
+// Routes declares the storage routes
+func (c *StorageController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/pis/:pi_id/storage", Access: routing.Authenticated, Handler: c.GetPiStorage},
+		{Method: http.MethodGet, Path: "/admin/storage/top", Access: routing.Admin, Handler: c.GetTopConsumers},
+	}
+}
+
+// GetPiStorage returns a Pi's storage usage as of the last accounting run
+func (c *StorageController) GetPiStorage(ctx *gin.Context) {
+	piID := ctx.Param("pi_id")
+
+	userRole, _ := middleware.GetRoleFromGinContext(ctx)
+	if userRole != "admin" {
+		currentUserID, _ := middleware.GetUserFromGinContext(ctx)
+		pi, err := c.piRepo.GetPi(ctx.Request.Context(), piID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "pi not found"})
+			return
+		}
+		if pi.UserID != currentUserID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	usage, err := c.storageRepo.GetPiUsage(ctx.Request.Context(), piID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "storage usage not computed yet"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, usage)
+}
+
+// GetTopConsumers returns the readings table total and the Pis using the most
+// storage
+func (c *StorageController) GetTopConsumers(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultStorageTopLimit)))
+	if err != nil || limit < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxStorageTopLimit {
+		limit = maxStorageTopLimit
+	}
+
+	total, err := c.storageRepo.GetTotal(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, err := c.storageRepo.ListTopUsage(ctx.Request.Context(), limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"total": total, "items": items})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/units"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// parseUnitsSystem reads ?units=metric|imperial|raw, defaulting to raw. On an
+// unknown value it writes a 400 and returns false.
+func parseUnitsSystem(ctx *gin.Context) (string, bool) {
+	system := ctx.DefaultQuery("units", units.SystemRaw)
+	if !units.ValidSystem(system) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "units must be one of metric, imperial, raw"})
+		return "", false
+	}
+	return system, true
+}
+
+// applyUnits converts the payloads of readings from one pi to system and records
+// the unit used for each converted field. raw leaves readings untouched.
+func applyUnits(ctx context.Context, deviceRepo interfaces.DeviceRepository, piID, system string, readings []hardware_models.Reading) error {
+	if system == units.SystemRaw || len(readings) == 0 {
+		return nil
+	}
+
+	declared, err := deviceRepo.GetDeclaredUnits(ctx, piID)
+	if err != nil {
+		return err
+	}
+
+	for i := range readings {
+		readings[i].Payload, readings[i].Units = units.ConvertPayload(readings[i].Payload, declared[readings[i].DeviceID], system)
+	}
+	return nil
+}
+
+// validateMetaUnits checks the units declared in a meta object, if any
+func validateMetaUnits(meta map[string]interface{}) error {
+	if meta == nil {
+		return nil
+	}
+	_, err := units.ParseDeclared(meta["units"])
+	return err
+}
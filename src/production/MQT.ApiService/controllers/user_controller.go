@@ -1,60 +1,61 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	auditService "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
 	service "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/auth"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 
 	"github.com/gin-gonic/gin"
 )
 
 // UserController handles user management requests
 type UserController struct {
-	userService *service.UserService
+	userService  *service.UserService
+	piRepo       interfaces.PiRepository
+	auditService *auditService.Service
 }
 
 // NewUserController creates a new user controller
-func NewUserController(userService *service.UserService) *UserController {
+func NewUserController(userService *service.UserService, piRepo interfaces.PiRepository, auditService *auditService.Service) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:  userService,
+		piRepo:       piRepo,
+		auditService: auditService,
 	}
 }
 
-// RegisterRoutes registers the user routes with Gin
-func (h *UserController) RegisterRoutes(router *gin.Engine, authMiddleware *middleware.AuthMiddleware) {
-	// Protected routes
-	users := router.Group("/api/users", authMiddleware.Authenticate())
-	{
-		// Get all users - requires admin role
-		users.GET("",
-			authMiddleware.RequireAdmin(),
-			h.GetAllUsers)
-
-		// Get user by ID - requires admin role or own user
-		users.GET("/:id",
-			h.GetUserByID)
-
-		// Update user - requires admin role
-		users.PUT("/:id",
-			authMiddleware.RequireAdmin(),
-			h.UpdateUser)
-
-		// Delete user - requires admin role
-		users.DELETE("/:id",
-			authMiddleware.RequireAdmin(),
-			h.DeleteUser)
-
-		// Update user role - requires admin role
-		users.PUT("/:id/role",
-			authMiddleware.RequireAdmin(),
-			h.UpdateUserRole)
+// UserDetailResponse is the user detail body, including how many pis the user owns
+type UserDetailResponse struct {
+	*auth_models.User
+	PisCount int `json:"pis_count"`
+}
+
+// Routes declares the user routes. Handlers allow the user themselves or an
+// admin where the route isn't admin only.
+func (h *UserController) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: http.MethodGet, Path: "/api/users", Access: routing.Admin, Handler: h.GetAllUsers},
+		{Method: http.MethodGet, Path: "/api/users/:id", Access: routing.Authenticated, Handler: h.GetUserByID},
+		{Method: http.MethodGet, Path: "/api/users/:id/pis", Access: routing.Authenticated, Handler: h.GetUserPis},
+		{Method: http.MethodPut, Path: "/api/users/:id", Access: routing.Admin, Handler: h.UpdateUser},
+		{Method: http.MethodDelete, Path: "/api/users/:id", Access: routing.Admin, Handler: h.DeleteUser},
+		{Method: http.MethodPut, Path: "/api/users/:id/role", Access: routing.Admin, Handler: h.UpdateUserRole},
 	}
 }
 
-// GetAllUsers retrieves all users
+// GetAllUsers retrieves all users. Deactivated users are only listed with include_inactive=true.
 func (h *UserController) GetAllUsers(c *gin.Context) {
-	users, err := h.userService.GetAllUsers(c.Request.Context())
+	includeInactive := c.Query("include_inactive") == "true"
+
+	users, err := h.userService.GetAllUsers(c.Request.Context(), includeInactive)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,7 +98,70 @@ func (h *UserController) GetUserByID(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, user)
+	pisCount, err := h.piRepo.CountPisByUser(c.Request.Context(), user.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserDetailResponse{User: user, PisCount: pisCount})
+}
+
+// GetUserPis lists the pis assigned to a user
+func (h *UserController) GetUserPis(c *gin.Context) {
+	userID := c.Param("id")
+
+	// Check ownership if not admin
+	userRole, err := middleware.GetRoleFromGinContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user role"})
+		return
+	}
+
+	if userRole != "admin" {
+		currentUserID, err := middleware.GetUserFromGinContext(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get current user"})
+			return
+		}
+
+		if userID != currentUserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	// This listing has always reported its total
+	opts := interfaces.PageOptions{Page: page, PageSize: pageSize, IncludeTotal: true}
+	result, err := h.piRepo.ListPis(c.Request.Context(), userID, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
 // UpdateUser updates a user
@@ -110,8 +174,7 @@ func (h *UserController) UpdateUser(c *gin.Context) {
 		Password string `json:"password,omitempty"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -173,6 +236,10 @@ func (h *UserController) DeleteUser(c *gin.Context) {
 	// Delete user
 	err = h.userService.DeleteUser(c.Request.Context(), userID)
 	if err != nil {
+		if errors.Is(err, interfaces.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "last_admin"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -188,16 +255,37 @@ func (h *UserController) UpdateUserRole(c *gin.Context) {
 		Role string `json:"role" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	user, err := h.userService.UpdateUserRole(c.Request.Context(), userID, req.Role)
+	user, previousRole, err := h.userService.UpdateUserRole(c.Request.Context(), userID, req.Role)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, service.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, interfaces.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "last_admin"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	actorID, _ := middleware.GetUserFromGinContext(c)
+	h.auditService.Record(c.Request.Context(), audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeUser,
+		ActorID:      actorID,
+		Action:       "user.role.update",
+		ResourceType: "user",
+		ResourceID:   userID,
+		Details: map[string]interface{}{
+			"old_role": previousRole,
+			"new_role": user.Role,
+		},
+	})
+
 	c.JSON(http.StatusOK, user)
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
 	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
 )
 
@@ -44,11 +45,22 @@ func (h *HealthChecker) CheckDatabaseHealth(ctx context.Context) error {
 	return nil
 }
 
+// CheckSchema verifies that CreateTables has completed by querying the readings table
+func (h *HealthChecker) CheckSchema(ctx context.Context) error {
+	if h.db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if _, err := h.db.ExecContext(ctx, "SELECT 1 FROM readings LIMIT 0"); err != nil {
+		return fmt.Errorf("schema check failed: %w", err)
+	}
+	return nil
+}
+
 // GetHealthStatus returns the current health status
 func (h *HealthChecker) GetHealthStatus(ctx context.Context) map[string]interface{} {
 	status := map[string]interface{}{
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"version":   buildinfo.Get().Version,
 		"checks":    make(map[string]interface{}),
 	}
 
@@ -78,7 +90,8 @@ func (h *HealthChecker) GetHealthStatus(ctx context.Context) map[string]interfac
 
 // DatabaseManager handles database operations
 type DatabaseManager struct {
-	db *sql.DB
+	db     *sql.DB
+	repair repairState
 }
 
 // NewDatabaseManager creates a new database manager
@@ -110,7 +123,8 @@ func ConnectPostgresWithTimeout(cfg *config.Config, timeout time.Duration) (*sql
 	return db, nil
 }
 
-// CreateTables creates the required tables if they don't exist
+// CreateTables creates the required tables if they don't exist. The resulting
+// columns are mirrored in expectedColumns for drift detection; keep both in step.
 func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -118,14 +132,17 @@ func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 	// Create users table
 	createUsersTable := `
 		CREATE TABLE IF NOT EXISTS users (
-			user_id     TEXT PRIMARY KEY,
-			username    TEXT NOT NULL UNIQUE,
-			email       TEXT NOT NULL UNIQUE,
-			password    TEXT NOT NULL,
-			role        TEXT NOT NULL,
-			active      BOOLEAN NOT NULL DEFAULT true,
-			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
-			updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+			user_id                  TEXT PRIMARY KEY,
+			username                 TEXT NOT NULL UNIQUE,
+			email                    TEXT NOT NULL UNIQUE,
+			password                 TEXT NOT NULL,
+			role                     TEXT NOT NULL,
+			active                   BOOLEAN NOT NULL DEFAULT true,
+			created_at               TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at               TIMESTAMPTZ NOT NULL DEFAULT now(),
+			pending_email            TEXT,
+			pending_email_token_id   TEXT,
+			pending_email_expires_at TIMESTAMPTZ
 		);
 	`
 
@@ -134,7 +151,9 @@ func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 		CREATE TABLE IF NOT EXISTS pis (
 			pi_id       TEXT PRIMARY KEY,
 			user_id     TEXT,
+			meta        JSONB NOT NULL DEFAULT '{}'::jsonb,
 			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_seen_at TIMESTAMPTZ,
 			FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
 		);
 	`
@@ -145,12 +164,23 @@ func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 			pi_id       TEXT NOT NULL,
 			device_id   INTEGER NOT NULL,
 			device_type TEXT,
+			meta        JSONB NOT NULL DEFAULT '{}'::jsonb,
 			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_reading_at TIMESTAMPTZ,
 			PRIMARY KEY (pi_id, device_id),
 			FOREIGN KEY (pi_id) REFERENCES pis(pi_id) ON DELETE CASCADE
 		);
 	`
 
+	// Create device types table; holds unit declarations shared by a device type
+	createDeviceTypesTable := `
+		CREATE TABLE IF NOT EXISTS device_types (
+			device_type TEXT PRIMARY KEY,
+			meta        JSONB NOT NULL DEFAULT '{}'::jsonb,
+			updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
 	// Create readings table
 	createReadingsTable := `
 		CREATE TABLE IF NOT EXISTS readings (
@@ -174,21 +204,256 @@ func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 		);
 	`
 
-	// Create indexes
-	createIndexes := `
-		CREATE INDEX IF NOT EXISTS idx_readings_pi_device_ts_desc ON readings (pi_id, device_id, ts DESC);
-		CREATE INDEX IF NOT EXISTS idx_readings_ts_desc ON readings (ts DESC);
-		CREATE INDEX IF NOT EXISTS idx_readings_payload_gin ON readings USING GIN (payload);
-		CREATE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+	// Create audit events table
+	createAuditEventsTable := `
+		CREATE TABLE IF NOT EXISTS audit_events (
+			event_id      TEXT PRIMARY KEY,
+			actor_type    TEXT NOT NULL,
+			actor_id      TEXT NOT NULL,
+			action        TEXT NOT NULL,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			impersonator_id TEXT,
+			details       JSONB,
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	// Create MQTT credentials table; at most one unrevoked credential per pi
+	createMqttCredentialsTable := `
+		CREATE TABLE IF NOT EXISTS mqtt_credentials (
+			credential_id TEXT PRIMARY KEY,
+			pi_id         TEXT NOT NULL,
+			secret_hash   TEXT NOT NULL,
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			revoked_at    TIMESTAMPTZ,
+			FOREIGN KEY (pi_id) REFERENCES pis(pi_id) ON DELETE CASCADE
+		);
+	`
+
+	// Create installation table; a single row holding the anonymous install ID
+	// used by the opt-in telemetry report
+	createInstallationTable := `
+		CREATE TABLE IF NOT EXISTS installation (
+			singleton   BOOLEAN PRIMARY KEY DEFAULT true CHECK (singleton),
+			install_id  TEXT NOT NULL,
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	// Create pending devices table; devices a Pi announced on its discovery topic
+	// that an owner or admin has not yet approved or rejected
+	createPendingDevicesTable := `
+		CREATE TABLE IF NOT EXISTS pending_devices (
+			pi_id         TEXT NOT NULL,
+			device_id     INTEGER NOT NULL,
+			device_type   TEXT NOT NULL,
+			firmware      TEXT,
+			first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			seen_count    INTEGER NOT NULL DEFAULT 1,
+			PRIMARY KEY (pi_id, device_id),
+			FOREIGN KEY (pi_id) REFERENCES pis(pi_id) ON DELETE CASCADE
+		);
+	`
+
+	// Create payload schemas table; versioned JSON Schema documents per device
+	// type, at most one of them active
+	createPayloadSchemasTable := `
+		CREATE TABLE IF NOT EXISTS payload_schemas (
+			device_type TEXT NOT NULL,
+			version     INTEGER NOT NULL,
+			schema      JSONB NOT NULL,
+			enforcement TEXT NOT NULL DEFAULT 'flag' CHECK (enforcement IN ('flag', 'reject')),
+			active      BOOLEAN NOT NULL DEFAULT false,
+			created_by  TEXT,
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (device_type, version)
+		);
+	`
+
+	// Create payload schema violations table; readings stored despite failing
+	// their device type's schema in flag mode
+	createPayloadSchemaViolationsTable := `
+		CREATE TABLE IF NOT EXISTS payload_schema_violations (
+			violation_id   BIGSERIAL PRIMARY KEY,
+			pi_id          TEXT NOT NULL,
+			device_id      INTEGER NOT NULL,
+			ts             TIMESTAMPTZ NOT NULL,
+			device_type    TEXT NOT NULL,
+			schema_version INTEGER NOT NULL,
+			violations     JSONB NOT NULL,
+			created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	// Create ingest errors table; errors the ingestor published to Pis, kept as
+	// their rejection history. Pis aren't referenced: errors for unknown Pis are
+	// kept too.
+	createIngestErrorsTable := `
+		CREATE TABLE IF NOT EXISTS ingest_errors (
+			error_id       BIGSERIAL PRIMARY KEY,
+			pi_id          TEXT NOT NULL,
+			device_id      TEXT NOT NULL DEFAULT '',
+			error_type     TEXT NOT NULL,
+			message        TEXT NOT NULL DEFAULT '',
+			topic          TEXT,
+			affected_count INTEGER NOT NULL DEFAULT 1,
+			ts             TIMESTAMPTZ NOT NULL,
+			received_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	// Create maintenance state table; a single row holding the maintenance switch
+	// so every replica converges on it
+	createMaintenanceStateTable := `
+		CREATE TABLE IF NOT EXISTS maintenance_state (
+			singleton   BOOLEAN PRIMARY KEY DEFAULT true CHECK (singleton),
+			enabled     BOOLEAN NOT NULL DEFAULT false,
+			reason      TEXT,
+			enabled_by  TEXT,
+			started_at  TIMESTAMPTZ,
+			expires_at  TIMESTAMPTZ,
+			updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	// Create notification tables: per-user delivery preferences, notifications
+	// held back for a digest or quiet hours, and how far each user's digests on
+	// each channel have been sent
+	createNotificationPreferencesTable := `
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id           TEXT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			channels          JSONB NOT NULL DEFAULT '[]'::jsonb,
+			digest_mode       TEXT NOT NULL DEFAULT 'immediate' CHECK (digest_mode IN ('immediate', 'hourly', 'daily')),
+			quiet_hours_start TEXT,
+			quiet_hours_end   TEXT,
+			timezone          TEXT NOT NULL DEFAULT 'UTC',
+			updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	createPendingNotificationsTable := `
+		CREATE TABLE IF NOT EXISTS pending_notifications (
+			event_id    BIGSERIAL PRIMARY KEY,
+			user_id     TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			channel     TEXT NOT NULL,
+			kind        TEXT NOT NULL,
+			subject     TEXT NOT NULL,
+			body        TEXT NOT NULL,
+			data        JSONB,
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+
+	createNotificationWatermarksTable := `
+		CREATE TABLE IF NOT EXISTS notification_digest_watermarks (
+			user_id          TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			channel          TEXT NOT NULL,
+			dispatched_until TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (user_id, channel)
+		);
+	`
+
+	// Create storage usage tables, written by the storage accounting job: each
+	// Pi's share of the readings table and the table as a whole
+	createStorageUsageTable := `
+		CREATE TABLE IF NOT EXISTS storage_usage (
+			pi_id        TEXT PRIMARY KEY REFERENCES pis(pi_id) ON DELETE CASCADE,
+			row_count    BIGINT NOT NULL,
+			approx_bytes BIGINT NOT NULL,
+			computed_at  TIMESTAMPTZ NOT NULL
+		);
+	`
+
+	createStorageUsageTotalTable := `
+		CREATE TABLE IF NOT EXISTS storage_usage_total (
+			singleton   BOOLEAN PRIMARY KEY DEFAULT true CHECK (singleton),
+			row_count   BIGINT NOT NULL,
+			total_bytes BIGINT NOT NULL,
+			computed_at TIMESTAMPTZ NOT NULL
+		);
 	`
 
+	// Create purge jobs table; reading deletions too large to run in one statement
+	// are tracked here while they delete in chunks. No foreign keys, so the record
+	// outlives the Pi or device it purged.
+	createPurgeJobsTable := `
+		CREATE TABLE IF NOT EXISTS purge_jobs (
+			purge_id         BIGSERIAL PRIMARY KEY,
+			pi_id            TEXT NOT NULL,
+			device_id        INTEGER NOT NULL,
+			range_from       TIMESTAMPTZ NOT NULL,
+			range_to         TIMESTAMPTZ NOT NULL,
+			status           TEXT NOT NULL CHECK (status IN ('running', 'completed', 'cancelled', 'failed')),
+			estimated_rows   BIGINT NOT NULL,
+			deleted_rows     BIGINT NOT NULL DEFAULT 0,
+			chunks           INTEGER NOT NULL DEFAULT 0,
+			cancel_requested BOOLEAN NOT NULL DEFAULT false,
+			error            TEXT,
+			requested_by     TEXT,
+			created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at      TIMESTAMPTZ
+		);
+	`
+
+	// Create seed runs table; one row per named demo data seed, so re-running a
+	// seed is a no-op and two replicas can't run the same seed at once
+	createSeedRunsTable := `
+		CREATE TABLE IF NOT EXISTS seed_runs (
+			name         TEXT PRIMARY KEY,
+			status       TEXT NOT NULL CHECK (status IN ('running', 'completed')),
+			summary      JSONB,
+			requested_by TEXT,
+			created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at  TIMESTAMPTZ
+		);
+	`
+
+	// Add columns introduced after the initial schema. received_at gets its default
+	// separately so existing readings stay NULL instead of taking the migration time.
+	alterTables := `
+		ALTER TABLE pis ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb;
+		ALTER TABLE devices ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb;
+		ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_id TEXT;
+		ALTER TABLE readings ADD COLUMN IF NOT EXISTS received_at TIMESTAMPTZ;
+		ALTER TABLE readings ALTER COLUMN received_at SET DEFAULT now();
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email_token_id TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email_expires_at TIMESTAMPTZ;
+		ALTER TABLE pis ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+		ALTER TABLE devices ADD COLUMN IF NOT EXISTS last_reading_at TIMESTAMPTZ;
+	`
+
+	// Unique indexes enforce invariants, so they are created with the tables
+	// rather than with the retryable secondary indexes
+	createUniqueIndexes := createIndexesQuery(uniqueIndexes)
+
 	queries := []string{
 		createUsersTable,
 		createPisTable,
 		createDevicesTable,
+		createDeviceTypesTable,
 		createReadingsTable,
 		createRolesTable,
-		createIndexes,
+		createAuditEventsTable,
+		createMqttCredentialsTable,
+		createInstallationTable,
+		createPendingDevicesTable,
+		createPayloadSchemasTable,
+		createPayloadSchemaViolationsTable,
+		createIngestErrorsTable,
+		createMaintenanceStateTable,
+		createNotificationPreferencesTable,
+		createPendingNotificationsTable,
+		createNotificationWatermarksTable,
+		createStorageUsageTable,
+		createStorageUsageTotalTable,
+		createPurgeJobsTable,
+		createSeedRunsTable,
+		alterTables,
+		createUniqueIndexes,
 	}
 
 	for _, query := range queries {
@@ -200,6 +465,21 @@ func (dm *DatabaseManager) CreateTables(ctx context.Context) error {
 	return nil
 }
 
+// CreateIndexes creates the secondary indexes. Queries work without them, so
+// callers may treat a failure here as retryable rather than fatal.
+func (dm *DatabaseManager) CreateIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	createIndexes := createIndexesQuery(secondaryIndexes)
+
+	if _, err := dm.db.ExecContext(ctx, createIndexes); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the database connection
 func (dm *DatabaseManager) Close() error {
 	if dm.db != nil {
@@ -0,0 +1,329 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// expectedColumns is every table CreateTables makes and the columns it ends up
+// with once alterTables has run. Update it together with the statements there.
+var expectedColumns = map[string][]string{
+	"users":                          {"user_id", "username", "email", "password", "role", "active", "created_at", "updated_at", "pending_email", "pending_email_token_id", "pending_email_expires_at"},
+	"pis":                            {"pi_id", "user_id", "meta", "created_at", "last_seen_at"},
+	"devices":                        {"pi_id", "device_id", "device_type", "meta", "created_at", "last_reading_at"},
+	"device_types":                   {"device_type", "meta", "updated_at"},
+	"readings":                       {"pi_id", "device_id", "ts", "payload", "received_at"},
+	"roles":                          {"role_id", "name", "description", "created_at", "updated_at"},
+	"audit_events":                   {"event_id", "actor_type", "actor_id", "action", "resource_type", "resource_id", "impersonator_id", "details", "created_at"},
+	"mqtt_credentials":               {"credential_id", "pi_id", "secret_hash", "created_at", "revoked_at"},
+	"installation":                   {"singleton", "install_id", "created_at"},
+	"pending_devices":                {"pi_id", "device_id", "device_type", "firmware", "first_seen_at", "last_seen_at", "seen_count"},
+	"payload_schemas":                {"device_type", "version", "schema", "enforcement", "active", "created_by", "created_at"},
+	"payload_schema_violations":      {"violation_id", "pi_id", "device_id", "ts", "device_type", "schema_version", "violations", "created_at"},
+	"maintenance_state":              {"singleton", "enabled", "reason", "enabled_by", "started_at", "expires_at", "updated_at"},
+	"notification_preferences":       {"user_id", "channels", "digest_mode", "quiet_hours_start", "quiet_hours_end", "timezone", "updated_at"},
+	"pending_notifications":          {"event_id", "user_id", "channel", "kind", "subject", "body", "data", "created_at"},
+	"notification_digest_watermarks": {"user_id", "channel", "dispatched_until"},
+	"storage_usage":                  {"pi_id", "row_count", "approx_bytes", "computed_at"},
+	"storage_usage_total":            {"singleton", "row_count", "total_bytes", "computed_at"},
+	"purge_jobs":                     {"purge_id", "pi_id", "device_id", "range_from", "range_to", "status", "estimated_rows", "deleted_rows", "chunks", "cancel_requested", "error", "requested_by", "created_at", "updated_at", "finished_at"},
+	"seed_runs":                      {"name", "status", "summary", "requested_by", "created_at", "finished_at"},
+}
+
+// schemaIndex is an index the application creates itself. Indexes backing
+// primary keys and UNIQUE constraints come with their tables and aren't listed.
+type schemaIndex struct {
+	Name       string
+	Table      string
+	Definition string // everything after "ON <table>"
+	Unique     bool
+}
+
+// uniqueIndexes enforce invariants and are created with the tables
+var uniqueIndexes = []schemaIndex{
+	{Name: "idx_mqtt_credentials_active", Table: "mqtt_credentials", Definition: "(pi_id) WHERE revoked_at IS NULL", Unique: true},
+	{Name: "idx_payload_schemas_active", Table: "payload_schemas", Definition: "(device_type) WHERE active", Unique: true},
+}
+
+// secondaryIndexes only speed up queries, so CreateIndexes may be retried
+var secondaryIndexes = []schemaIndex{
+	{Name: "idx_readings_pi_device_ts_desc", Table: "readings", Definition: "(pi_id, device_id, ts DESC)"},
+	{Name: "idx_readings_ts_desc", Table: "readings", Definition: "(ts DESC)"},
+	{Name: "idx_readings_pi_received_at", Table: "readings", Definition: "(pi_id, received_at)"},
+	{Name: "idx_readings_payload_gin", Table: "readings", Definition: "USING GIN (payload)"},
+	{Name: "idx_roles_name", Table: "roles", Definition: "(name)"},
+	{Name: "idx_audit_events_created_at", Table: "audit_events", Definition: "(created_at DESC)"},
+	{Name: "idx_mqtt_credentials_pi_created", Table: "mqtt_credentials", Definition: "(pi_id, created_at DESC)"},
+	{Name: "idx_pis_meta_gin", Table: "pis", Definition: "USING GIN (meta jsonb_path_ops)"},
+	{Name: "idx_devices_meta_gin", Table: "devices", Definition: "USING GIN (meta jsonb_path_ops)"},
+	{Name: "idx_payload_schema_violations_type_created", Table: "payload_schema_violations", Definition: "(device_type, created_at DESC)"},
+	{Name: "idx_ingest_errors_pi_ts", Table: "ingest_errors", Definition: "(pi_id, ts DESC)"},
+	{Name: "idx_pending_notifications_user_channel_created", Table: "pending_notifications", Definition: "(user_id, channel, created_at)"},
+	{Name: "idx_storage_usage_bytes", Table: "storage_usage", Definition: "(approx_bytes DESC)"},
+}
+
+// createStatement returns the CREATE INDEX statement for the index
+func (i schemaIndex) createStatement(concurrently bool) string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if i.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	b.WriteString("INDEX ")
+	if concurrently {
+		b.WriteString("CONCURRENTLY ")
+	}
+	fmt.Fprintf(&b, "IF NOT EXISTS %s ON %s %s;", i.Name, i.Table, i.Definition)
+	return b.String()
+}
+
+// createIndexesQuery joins the CREATE INDEX statements for indexes
+func createIndexesQuery(indexes []schemaIndex) string {
+	statements := make([]string, len(indexes))
+	for n, index := range indexes {
+		statements[n] = index.createStatement(false)
+	}
+	return strings.Join(statements, "\n")
+}
+
+// SchemaStatus compares the live schema with the one CreateTables and
+// CreateIndexes produce. Names are table or table.column, and indexes are
+// reported by name. Invalid indexes are left behind by a failed concurrent build.
+type SchemaStatus struct {
+	InSync         bool     `json:"in_sync"`
+	MissingTables  []string `json:"missing_tables"`
+	ExtraTables    []string `json:"extra_tables"`
+	MissingColumns []string `json:"missing_columns"`
+	ExtraColumns   []string `json:"extra_columns"`
+	MissingIndexes []string `json:"missing_indexes"`
+	ExtraIndexes   []string `json:"extra_indexes"`
+	InvalidIndexes []string `json:"invalid_indexes"`
+	RepairRunning  bool     `json:"repair_running"`
+}
+
+// SchemaStatus introspects information_schema and the catalogs of the current
+// schema and reports drift from the expected schema
+func (dm *DatabaseManager) SchemaStatus(ctx context.Context) (*SchemaStatus, error) {
+	columns := make(map[string]map[string]bool)
+	rows, err := dm.db.QueryContext(ctx, `
+		SELECT c.table_name, c.column_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		if columns[table] == nil {
+			columns[table] = make(map[string]bool)
+		}
+		columns[table][column] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	// Indexes that back a constraint belong to their table definition
+	indexes := make(map[string]bool)
+	rows, err = dm.db.QueryContext(ctx, `
+		SELECT ic.relname, ix.indisvalid
+		FROM pg_index ix
+		JOIN pg_class ic ON ic.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = ic.relnamespace
+		WHERE n.nspname = current_schema()
+		  AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = ix.indexrelid)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var valid bool
+		if err := rows.Scan(&name, &valid); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		indexes[name] = valid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	status := &SchemaStatus{
+		MissingTables:  []string{},
+		ExtraTables:    []string{},
+		MissingColumns: []string{},
+		ExtraColumns:   []string{},
+		MissingIndexes: []string{},
+		ExtraIndexes:   []string{},
+		InvalidIndexes: []string{},
+		RepairRunning:  dm.repairRunning(),
+	}
+
+	for table, expected := range expectedColumns {
+		actual, ok := columns[table]
+		if !ok {
+			status.MissingTables = append(status.MissingTables, table)
+			continue
+		}
+		want := make(map[string]bool, len(expected))
+		for _, column := range expected {
+			want[column] = true
+			if !actual[column] {
+				status.MissingColumns = append(status.MissingColumns, table+"."+column)
+			}
+		}
+		for column := range actual {
+			if !want[column] {
+				status.ExtraColumns = append(status.ExtraColumns, table+"."+column)
+			}
+		}
+	}
+	for table := range columns {
+		if _, ok := expectedColumns[table]; !ok {
+			status.ExtraTables = append(status.ExtraTables, table)
+		}
+	}
+
+	expectedIndexes := make(map[string]bool)
+	for _, index := range allIndexes() {
+		expectedIndexes[index.Name] = true
+		valid, ok := indexes[index.Name]
+		switch {
+		case !ok:
+			status.MissingIndexes = append(status.MissingIndexes, index.Name)
+		case !valid:
+			status.InvalidIndexes = append(status.InvalidIndexes, index.Name)
+		}
+	}
+	for name := range indexes {
+		if !expectedIndexes[name] {
+			status.ExtraIndexes = append(status.ExtraIndexes, name)
+		}
+	}
+
+	for _, list := range [][]string{status.MissingTables, status.ExtraTables, status.MissingColumns, status.ExtraColumns, status.MissingIndexes, status.ExtraIndexes, status.InvalidIndexes} {
+		sort.Strings(list)
+	}
+	status.InSync = len(status.MissingTables)+len(status.ExtraTables)+len(status.MissingColumns)+len(status.ExtraColumns)+
+		len(status.MissingIndexes)+len(status.ExtraIndexes)+len(status.InvalidIndexes) == 0
+
+	return status, nil
+}
+
+// allIndexes returns every index the application creates
+func allIndexes() []schemaIndex {
+	return append(append([]schemaIndex{}, uniqueIndexes...), secondaryIndexes...)
+}
+
+// ErrRepairRunning is returned by RepairIndexes while a repair is in progress
+var ErrRepairRunning = errors.New("index repair already running")
+
+// repairState guards against overlapping index repairs
+type repairState struct {
+	mu      sync.Mutex
+	running bool
+}
+
+func (dm *DatabaseManager) repairRunning() bool {
+	dm.repair.mu.Lock()
+	defer dm.repair.mu.Unlock()
+	return dm.repair.running
+}
+
+// RepairIndexes finds the expected indexes that are missing or invalid and
+// returns their names, then rebuilds them one at a time in the background with
+// CREATE INDEX CONCURRENTLY so tables stay writable. Invalid indexes are dropped
+// first. Progress and failures are logged; the build stops when ctx is cancelled.
+func (dm *DatabaseManager) RepairIndexes(ctx context.Context, log *logger.Logger) ([]string, error) {
+	dm.repair.mu.Lock()
+	if dm.repair.running {
+		dm.repair.mu.Unlock()
+		return nil, ErrRepairRunning
+	}
+	dm.repair.running = true
+	dm.repair.mu.Unlock()
+
+	status, err := dm.SchemaStatus(ctx)
+	if err != nil {
+		dm.finishRepair()
+		return nil, err
+	}
+
+	missing := make(map[string]bool)
+	for _, name := range status.MissingIndexes {
+		missing[name] = true
+	}
+	invalid := make(map[string]bool)
+	for _, name := range status.InvalidIndexes {
+		invalid[name] = true
+	}
+	missingTables := make(map[string]bool)
+	for _, table := range status.MissingTables {
+		missingTables[table] = true
+	}
+
+	var todo []schemaIndex
+	for _, index := range allIndexes() {
+		if (missing[index.Name] || invalid[index.Name]) && !missingTables[index.Table] {
+			todo = append(todo, index)
+		}
+	}
+
+	names := make([]string, len(todo))
+	for n, index := range todo {
+		names[n] = index.Name
+	}
+	if len(todo) == 0 {
+		dm.finishRepair()
+		return names, nil
+	}
+
+	go func() {
+		defer dm.finishRepair()
+		for n, index := range todo {
+			if ctx.Err() != nil {
+				log.Logger.Warn().Err(ctx.Err()).Int("remaining", len(todo)-n).Msg("Index repair cancelled")
+				return
+			}
+
+			start := time.Now()
+			log.Logger.Info().Str("index", index.Name).Int("step", n+1).Int("total", len(todo)).Msg("Rebuilding index")
+			if invalid[index.Name] {
+				if _, err := dm.db.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+index.Name); err != nil {
+					log.Logger.Error().Err(err).Str("index", index.Name).Msg("Failed to drop invalid index")
+					continue
+				}
+			}
+			if _, err := dm.db.ExecContext(ctx, index.createStatement(true)); err != nil {
+				log.Logger.Error().Err(err).Str("index", index.Name).Dur("elapsed", time.Since(start)).Msg("Failed to rebuild index")
+				continue
+			}
+			log.Logger.Info().Str("index", index.Name).Dur("elapsed", time.Since(start)).Msg("Index rebuilt")
+		}
+		log.Logger.Info().Int("total", len(todo)).Msg("Index repair finished")
+	}()
+
+	return names, nil
+}
+
+func (dm *DatabaseManager) finishRepair() {
+	dm.repair.mu.Lock()
+	defer dm.repair.mu.Unlock()
+	dm.repair.running = false
+}
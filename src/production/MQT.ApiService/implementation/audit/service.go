@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Service records audit events
+type Service struct {
+	auditRepo interfaces.AuditRepository
+	logger    *logger.Logger
+}
+
+// NewService creates a new audit service
+func NewService(auditRepo interfaces.AuditRepository, logger *logger.Logger) *Service {
+	return &Service{
+		auditRepo: auditRepo,
+		logger:    logger,
+	}
+}
+
+type impersonatorKey struct{}
+
+// WithImpersonator returns a context marking the request as part of an impersonation session
+func WithImpersonator(ctx context.Context, impersonatorID string) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, impersonatorID)
+}
+
+// ImpersonatorFromContext returns the impersonating admin's ID, if any
+func ImpersonatorFromContext(ctx context.Context) string {
+	impersonatorID, _ := ctx.Value(impersonatorKey{}).(string)
+	return impersonatorID
+}
+
+// Record persists an audit event. Failures are logged rather than returned so that
+// auditing never blocks the action being audited. Events recorded during an
+// impersonation session are attributed to the impersonator as well.
+func (s *Service) Record(ctx context.Context, event audit_models.AuditEvent) {
+	if event.ImpersonatorID == "" {
+		event.ImpersonatorID = ImpersonatorFromContext(ctx)
+	}
+
+	if err := s.auditRepo.Create(ctx, &event); err != nil {
+		s.logger.Logger.Error().Err(err).
+			Str("action", event.Action).
+			Str("actor_type", event.ActorType).
+			Str("actor_id", event.ActorID).
+			Str("resource_id", event.ResourceID).
+			Str("impersonator_id", event.ImpersonatorID).
+			Msg("Failed to record audit event")
+		return
+	}
+
+	s.logger.Logger.Info().
+		Str("component", "audit").
+		Str("action", event.Action).
+		Str("actor_type", event.ActorType).
+		Str("actor_id", event.ActorID).
+		Str("resource_type", event.ResourceType).
+		Str("resource_id", event.ResourceID).
+		Str("impersonator_id", event.ImpersonatorID).
+		Msg("Audit event recorded")
+}
@@ -3,14 +3,22 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
 	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 	jwt "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
 	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+)
 
-	"golang.org/x/crypto/bcrypt"
+// Impersonation errors, mapped to HTTP statuses by the auth controller
+var (
+	ErrImpersonationTargetNotFound = errors.New("user not found")
+	ErrImpersonationForbidden      = errors.New("impersonating this user is not allowed")
+	ErrImpersonationInvalid        = errors.New("invalid impersonation request")
 )
 
 // AuthService aggregates auth operations
@@ -19,6 +27,15 @@ type AuthService struct {
 	roleRepo    interfaces.RoleRepository
 	jwtService  *jwt.Service
 	rbacService *rbac.Service
+	hasher      *password.Hasher
+
+	// allowAdminImpersonation permits admins to impersonate other admins
+	allowAdminImpersonation bool
+
+	// Email changes; nil mailer means they can't be made, see UseEmailChange
+	mailer          Mailer
+	emailChangeTTL  time.Duration
+	emailConfirmURL string
 }
 
 type RegisterRequest struct {
@@ -55,25 +72,33 @@ func NewAuthService(
 	roleRepo interfaces.RoleRepository,
 	jwtService *jwt.Service,
 	rbacService *rbac.Service,
+	hasher *password.Hasher,
+	allowAdminImpersonation bool,
 ) *AuthService {
 	return &AuthService{
-		userRepo:    userRepo,
-		roleRepo:    roleRepo,
-		jwtService:  jwtService,
-		rbacService: rbacService,
+		userRepo:                userRepo,
+		roleRepo:                roleRepo,
+		jwtService:              jwtService,
+		rbacService:             rbacService,
+		hasher:                  hasher,
+		allowAdminImpersonation: allowAdminImpersonation,
 	}
 }
 
 // Register registers a new user
 func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*auth_models.User, error) {
 	// Check if user already exists
+	// Usernames of deactivated accounts stay reserved
 	existingUser, err := s.userRepo.GetByUsername(ctx, req.Username)
 	if err == nil && existingUser != nil {
+		if !existingUser.Active {
+			return nil, errors.New("username belongs to a deactivated account")
+		}
 		return nil, errors.New("username already exists")
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -84,23 +109,37 @@ func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*auth_
 	}
 
 	// Create user
-	user := auth_models.NewUser(req.Username, req.Email, string(hashedPassword), req.Role)
+	user := auth_models.NewUser(req.Username, req.Email, hashedPassword, req.Role)
 	return s.userRepo.Create(ctx, user)
 }
 
 // Login authenticates a user and returns tokens
 func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*AuthResponse, *api_models.TokenPair, error) {
 	user, err := s.userRepo.GetByUsername(ctx, req.Username)
-	if err != nil {
+	if err != nil || user == nil {
 		return nil, nil, errors.New("invalid credentials")
 	}
 
 	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	needsRehash, err := s.hasher.Verify(user.Password, req.Password)
 	if err != nil {
 		return nil, nil, errors.New("invalid credentials")
 	}
 
+	// Deactivated accounts can't log in
+	if !user.Active {
+		return nil, nil, errors.New("account is deactivated")
+	}
+
+	// Upgrade hashes made with an old algorithm or cost now that we have the plaintext.
+	// Failing to upgrade shouldn't block the login; it's retried next time.
+	if needsRehash {
+		if rehashed, err := s.hasher.Hash(req.Password); err == nil {
+			user.Password = rehashed
+			_ = s.userRepo.Update(ctx, user)
+		}
+	}
+
 	// Generate tokens
 	tokenPair, err := s.jwtService.GenerateTokens(user.UserID, user.Role)
 	if err != nil {
@@ -133,18 +172,60 @@ func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*
 	}, tokenPair, nil
 }
 
+// Impersonate issues a short-lived access token that acts as targetUserID on behalf of
+// impersonatorID. Impersonating another admin is refused unless explicitly allowed.
+func (s *AuthService) Impersonate(ctx context.Context, impersonatorID, targetUserID string) (*AuthResponse, error) {
+	if impersonatorID == targetUserID {
+		return nil, fmt.Errorf("%w: cannot impersonate yourself", ErrImpersonationInvalid)
+	}
+
+	target, err := s.userRepo.GetByID(ctx, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrImpersonationTargetNotFound
+	}
+	if !target.Active {
+		return nil, fmt.Errorf("%w: account is deactivated", ErrImpersonationInvalid)
+	}
+	if s.rbacService.IsAdmin(target.Role) && !s.allowAdminImpersonation {
+		return nil, fmt.Errorf("%w: target is an admin", ErrImpersonationForbidden)
+	}
+
+	tokenPair, err := s.jwtService.GenerateImpersonationToken(target.UserID, target.Role, impersonatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		AccessToken: tokenPair.AccessToken,
+		TokenID:     tokenPair.TokenID,
+		ExpiresAt:   tokenPair.ExpiresAt,
+		UserID:      target.UserID,
+		Username:    target.Username,
+		Email:       target.Email,
+		Role:        target.Role,
+	}, nil
+}
+
+// IsImpersonationToken reports whether accessToken is a valid impersonation token
+func (s *AuthService) IsImpersonationToken(accessToken string) bool {
+	if accessToken == "" {
+		return false
+	}
+	claims, err := s.jwtService.ValidateAccessToken(accessToken)
+	return err == nil && claims.ImpersonatorID != ""
+}
+
 // GetUserByID retrieves a user by ID
 func (s *AuthService) GetUserByID(ctx context.Context, userId string) (*auth_models.User, error) {
 	return s.userRepo.GetByID(ctx, userId)
 }
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password with the configured algorithm
 func (s *AuthService) HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+	return s.hasher.Hash(password)
 }
 
 // UpdateUser updates a user in the database
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwt "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
+	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// stubUserRepo holds a single user and counts updates to it. Calls it doesn't
+// implement panic.
+type stubUserRepo struct {
+	interfaces.UserRepository
+	user    auth_models.User
+	updates int
+}
+
+func (r *stubUserRepo) GetByUsername(_ context.Context, username string) (*auth_models.User, error) {
+	if username != r.user.Username {
+		return nil, nil
+	}
+	user := r.user
+	return &user, nil
+}
+
+func (r *stubUserRepo) Update(_ context.Context, user *auth_models.User) error {
+	r.user = *user
+	r.updates++
+	return nil
+}
+
+// A successful login replaces a hash made with another algorithm or weaker
+// parameters with one made under the current configuration; a failed login
+// or a current hash leaves it alone
+func TestLoginRehash(t *testing.T) {
+	bcryptConfig := config.PasswordHashConfig{Algorithm: password.AlgorithmBcrypt, BcryptCost: 4}
+	argon2idConfig := config.PasswordHashConfig{Algorithm: password.AlgorithmArgon2id, Argon2Time: 1, Argon2MemoryKiB: 1024, Argon2Threads: 1}
+
+	tests := []struct {
+		name       string
+		hashedWith config.PasswordHashConfig
+		current    config.PasswordHashConfig
+		password   string
+		active     bool
+		wantLogin  bool
+		wantRehash bool
+	}{
+		{name: "bcrypt to argon2id", hashedWith: bcryptConfig, current: argon2idConfig, password: "secret", active: true, wantLogin: true, wantRehash: true},
+		{name: "argon2id to bcrypt", hashedWith: argon2idConfig, current: bcryptConfig, password: "secret", active: true, wantLogin: true, wantRehash: true},
+		{name: "bcrypt cost raised", hashedWith: bcryptConfig, current: config.PasswordHashConfig{Algorithm: password.AlgorithmBcrypt, BcryptCost: 5}, password: "secret", active: true, wantLogin: true, wantRehash: true},
+		{name: "current hash", hashedWith: argon2idConfig, current: argon2idConfig, password: "secret", active: true, wantLogin: true},
+		{name: "wrong password", hashedWith: bcryptConfig, current: argon2idConfig, password: "wrong", active: true},
+		{name: "deactivated", hashedWith: bcryptConfig, current: argon2idConfig, password: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldHash, err := password.NewHasher(tt.hashedWith).Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			users := &stubUserRepo{user: auth_models.User{UserID: "user-1", Username: "carol", Password: oldHash, Role: "user", Active: tt.active}}
+			hasher := password.NewHasher(tt.current)
+			jwtService := jwt.NewService(api_models.Config{SecretKey: "test-secret", AccessTokenDuration: time.Hour, RefreshTokenDuration: time.Hour})
+			s := NewAuthService(users, nil, jwtService, rbac.NewService(), hasher, false)
+
+			_, _, err = s.Login(context.Background(), LoginRequest{Username: "carol", Password: tt.password})
+			if (err == nil) != tt.wantLogin {
+				t.Fatalf("Login() error = %v, want login %v", err, tt.wantLogin)
+			}
+
+			if !tt.wantRehash {
+				if users.updates != 0 || users.user.Password != oldHash {
+					t.Errorf("hash replaced %d times, want it left alone", users.updates)
+				}
+				return
+			}
+			if users.updates != 1 {
+				t.Fatalf("hash replaced %d times, want once", users.updates)
+			}
+			needsRehash, err := hasher.Verify(users.user.Password, "secret")
+			if err != nil || needsRehash {
+				t.Errorf("new hash %q: Verify() = %v, %v; want a current hash of the password", users.user.Password, needsRehash, err)
+			}
+
+			// The next login finds the hash current
+			if _, _, err := s.Login(context.Background(), LoginRequest{Username: "carol", Password: "secret"}); err != nil {
+				t.Fatalf("second Login() error = %v", err)
+			}
+			if users.updates != 1 {
+				t.Errorf("hash replaced again on the second login")
+			}
+		})
+	}
+}
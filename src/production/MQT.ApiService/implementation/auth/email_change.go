@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+
+	jwt "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// PurposeEmailChange marks tokens that confirm an email change
+const PurposeEmailChange = "email_change"
+
+// Identity change errors, mapped to HTTP statuses by the auth controller
+var (
+	ErrEmailChangeUnavailable = errors.New("email changes are unavailable: email delivery is not configured")
+	ErrInvalidEmail           = errors.New("invalid email address")
+	ErrEmailUnchanged         = errors.New("email address is unchanged")
+	ErrEmailDelivery          = errors.New("failed to send confirmation email")
+	ErrEmailChangeInvalid     = errors.New("invalid confirmation token, or the change was cancelled or replaced")
+	ErrEmailChangeExpired     = errors.New("confirmation token has expired")
+	ErrEmailTaken             = errors.New("email address is already in use")
+	ErrNoPendingEmailChange   = errors.New("no pending email change")
+	ErrCurrentPassword        = errors.New("current password is incorrect")
+)
+
+// Mailer sends a plain-text email to a single address
+type Mailer interface {
+	SendMail(ctx context.Context, to, subject, body string) error
+}
+
+// ProfileResponse is the authenticated user's profile with any email change
+// still awaiting confirmation
+type ProfileResponse struct {
+	*auth_models.User
+	PendingEmailChange *auth_models.PendingEmailChange `json:"pending_email_change,omitempty"`
+}
+
+// UseEmailChange enables email changes. Confirmation links are confirmURL with
+// the token appended and can be used for ttl.
+func (s *AuthService) UseEmailChange(mailer Mailer, ttl time.Duration, confirmURL string) {
+	s.mailer = mailer
+	s.emailChangeTTL = ttl
+	s.emailConfirmURL = confirmURL
+}
+
+// VerifyPassword checks password against the user's current password, for
+// changes that need the user to prove they know it
+func (s *AuthService) VerifyPassword(user *auth_models.User, password string) error {
+	if _, err := s.hasher.Verify(user.Password, password); err != nil {
+		return ErrCurrentPassword
+	}
+	return nil
+}
+
+// Profile returns the user's profile and pending email change, if any
+func (s *AuthService) Profile(ctx context.Context, user *auth_models.User) (*ProfileResponse, error) {
+	pending, err := s.PendingEmailChange(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &ProfileResponse{User: user, PendingEmailChange: pending}, nil
+}
+
+// PendingEmailChange returns the user's unexpired pending email change, or nil
+func (s *AuthService) PendingEmailChange(ctx context.Context, userID string) (*auth_models.PendingEmailChange, error) {
+	pending, err := s.userRepo.GetPendingEmail(ctx, userID)
+	if err != nil || pending == nil {
+		return nil, err
+	}
+	if !pending.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return pending, nil
+}
+
+// RequestEmailChange records newEmail as pending and emails a confirmation link
+// to it. The current address is told about the request so the owner can cancel
+// a change they didn't make. A new request replaces the previous one.
+func (s *AuthService) RequestEmailChange(ctx context.Context, user *auth_models.User, newEmail string) (*auth_models.PendingEmailChange, error) {
+	if s.mailer == nil {
+		return nil, ErrEmailChangeUnavailable
+	}
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		return nil, ErrInvalidEmail
+	}
+	if newEmail == user.Email {
+		return nil, ErrEmailUnchanged
+	}
+
+	token, claims, err := s.jwtService.GeneratePurposeToken(user.UserID, PurposeEmailChange, newEmail, s.emailChangeTTL)
+	if err != nil {
+		return nil, err
+	}
+	pending := auth_models.PendingEmailChange{
+		Email:     newEmail,
+		ExpiresAt: claims.ExpiresAt.Time,
+		TokenID:   claims.TokenID,
+	}
+	if err := s.userRepo.SetPendingEmail(ctx, user.UserID, pending); err != nil {
+		return nil, err
+	}
+
+	link := s.emailConfirmURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hello %s,\n\nConfirm that %s is your new email address by opening this link before %s:\n\n%s\n\nIf you didn't ask for this, ignore this email.",
+		user.Username, newEmail, pending.ExpiresAt.UTC().Format(time.RFC1123), link)
+	if err := s.mailer.SendMail(ctx, newEmail, "Confirm your new email address", body); err != nil {
+		// Nobody can confirm a change whose link never arrived
+		_, _ = s.userRepo.ClearPendingEmail(ctx, user.UserID)
+		return nil, fmt.Errorf("%w: %v", ErrEmailDelivery, err)
+	}
+
+	// Failing to warn the old address shouldn't block the change; the owner
+	// still sees it on their profile
+	if user.Email != "" {
+		notice := fmt.Sprintf("Hello %s,\n\nA change of your account's email address to %s was requested. It takes effect only once confirmed from the new address.\n\nIf this wasn't you, cancel it from your profile and change your password.",
+			user.Username, newEmail)
+		_ = s.mailer.SendMail(ctx, user.Email, "Email change requested for your account", notice)
+	}
+
+	return &pending, nil
+}
+
+// ConfirmEmailChange applies the pending email change the token was issued for
+// and returns the updated user
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) (*auth_models.User, error) {
+	claims, err := s.jwtService.ValidatePurposeToken(token, PurposeEmailChange)
+	if err != nil {
+		if jwt.IsExpired(err) {
+			return nil, ErrEmailChangeExpired
+		}
+		return nil, ErrEmailChangeInvalid
+	}
+
+	if _, err := s.userRepo.ConfirmPendingEmail(ctx, claims.UserID, claims.TokenID, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEmailChangeInvalid
+		case errors.Is(err, interfaces.ErrUserExists):
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// CancelEmailChange drops the user's pending email change, invalidating its link
+func (s *AuthService) CancelEmailChange(ctx context.Context, userID string) error {
+	cleared, err := s.userRepo.ClearPendingEmail(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !cleared {
+		return ErrNoPendingEmailChange
+	}
+	return nil
+}
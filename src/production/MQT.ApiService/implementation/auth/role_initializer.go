@@ -2,21 +2,26 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
 	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
 	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAdminAccountConflict means the configured admin username belongs to an
+// account that can't be used as the admin without an operator deciding to
+var ErrAdminAccountConflict = errors.New("admin username is taken by an unusable account")
+
 // RoleInitializerService handles initializing roles
 type RoleInitializerService struct {
 	roleRepo    interfaces.RoleRepository
 	userRepo    interfaces.UserRepository
 	rbacService *rbac.Service
+	hasher      *password.Hasher
 	logger      *logger.Logger
 	adminConfig AdminConfig
 }
@@ -26,6 +31,9 @@ type AdminConfig struct {
 	Username string
 	Email    string
 	Password string
+	// Reactivate allows a deactivated admin account holding Username to be
+	// reactivated with Password when no active admin is left
+	Reactivate bool
 }
 
 // NewRoleInitializerService creates a new role initializer service
@@ -33,6 +41,7 @@ func NewRoleInitializerService(
 	roleRepo interfaces.RoleRepository,
 	userRepo interfaces.UserRepository,
 	rbacService *rbac.Service,
+	hasher *password.Hasher,
 	logger *logger.Logger,
 	adminConfig AdminConfig,
 ) *RoleInitializerService {
@@ -40,6 +49,7 @@ func NewRoleInitializerService(
 		roleRepo:    roleRepo,
 		userRepo:    userRepo,
 		rbacService: rbacService,
+		hasher:      hasher,
 		logger:      logger,
 		adminConfig: adminConfig,
 	}
@@ -53,54 +63,48 @@ func (s *RoleInitializerService) InitializeRoles(ctx context.Context) error {
 		return err
 	}
 
-	// If no roles exist, create the admin and user roles
+	// If no roles exist, create the admin and user roles. Other replicas may be
+	// doing the same right now, so insert by name and skip any that already exist.
 	if len(roles) == 0 {
 		s.logger.Logger.Info().Msg("No roles found in database. Creating admin and user roles...")
 
-		adminRole := auth_models.NewRole(
-			"admin",
-			"Administrator with full access to all resources",
-		)
-
-		_, err := s.roleRepo.Create(ctx, adminRole)
-		if err != nil {
-			return err
+		defaultRoles := []*auth_models.Role{
+			auth_models.NewRole("admin", "Administrator with full access to all resources"),
+			auth_models.NewRole("user", "Regular user with read-only access to assigned resources"),
+		}
+		for _, role := range defaultRoles {
+			created, err := s.roleRepo.CreateIfNotExists(ctx, role)
+			if err != nil {
+				return err
+			}
+			if created {
+				s.logger.Logger.Info().Str("role", role.Name).Msg("Role created successfully")
+			} else {
+				s.logger.Logger.Info().Str("role", role.Name).Msg("Role already created by another instance")
+			}
 		}
-		s.logger.Logger.Info().Msg("Admin role created successfully")
-
-		// Add admin role to the RBAC service
-		s.rbacService.AddRole("admin")
-
-		// Also create a default user role
-		userRole := auth_models.NewRole(
-			"user",
-			"Regular user with read-only access to assigned resources",
-		)
 
-		_, err = s.roleRepo.Create(ctx, userRole)
+		// Reload so every replica uses the rows that won
+		roles, err = s.roleRepo.FindAll(ctx)
 		if err != nil {
 			return err
 		}
-		s.logger.Logger.Info().Msg("User role created successfully")
-
-		// Add user role to the RBAC service
-		s.rbacService.AddRole("user")
-	} else {
-		// Load all roles from the database into the RBAC service
-		s.logger.Logger.Info().Int("count", len(roles)).Msg("Loading roles from database")
-		for _, role := range roles {
-			s.rbacService.AddRole(role.Name)
-		}
-		s.logger.Logger.Info().Msg("Roles loaded successfully")
 	}
 
+	// Load all roles from the database into the RBAC service
+	s.logger.Logger.Info().Int("count", len(roles)).Msg("Loading roles from database")
+	for _, role := range roles {
+		s.rbacService.AddRole(role.Name)
+	}
+	s.logger.Logger.Info().Msg("Roles loaded successfully")
+
 	return nil
 }
 
 // InitializeAdminUser creates the first admin user if no admin users exist
 func (s *RoleInitializerService) InitializeAdminUser(ctx context.Context) error {
-	// Check if any admin users exist
-	adminUsers, err := s.userRepo.GetByRole(ctx, "admin")
+	// Check if any active admin users exist; deactivated admins can't log in
+	adminUsers, err := s.userRepo.GetByRole(ctx, "admin", false)
 	if err != nil {
 		return err
 	}
@@ -111,11 +115,32 @@ func (s *RoleInitializerService) InitializeAdminUser(ctx context.Context) error
 		return nil
 	}
 
+	// The configured username may already belong to another account, which keeps
+	// it reserved. Only a deactivated admin may be reused, and only when allowed.
+	existing, err := s.userRepo.GetByUsername(ctx, s.adminConfig.Username)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.Role != "admin" {
+			return fmt.Errorf("%w: %q is a %s account; set ADMIN_USERNAME to an unused username", ErrAdminAccountConflict, existing.Username, existing.Role)
+		}
+		if existing.Active {
+			// Another replica created the admin after we looked for one
+			s.logger.Logger.Info().Str("username", existing.Username).Msg("Admin user already created by another instance")
+			return nil
+		}
+		if !s.adminConfig.Reactivate {
+			return fmt.Errorf("%w: %q is a deactivated admin and no active admin is left; set ADMIN_REACTIVATE=true to reactivate it with ADMIN_PASSWORD, or set ADMIN_USERNAME to an unused username", ErrAdminAccountConflict, existing.Username)
+		}
+		return s.reactivateAdminUser(ctx, existing)
+	}
+
 	// Create the first admin user
 	s.logger.Logger.Info().Msg("No admin users found. Creating first admin user...")
 
 	// Hash the admin password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(s.adminConfig.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(s.adminConfig.Password)
 	if err != nil {
 		return fmt.Errorf("failed to hash admin password: %w", err)
 	}
@@ -124,11 +149,16 @@ func (s *RoleInitializerService) InitializeAdminUser(ctx context.Context) error
 	adminUser := auth_models.NewUser(
 		s.adminConfig.Username,
 		s.adminConfig.Email,
-		string(hashedPassword),
+		hashedPassword,
 		"admin",
 	)
 
 	_, err = s.userRepo.Create(ctx, adminUser)
+	if errors.Is(err, interfaces.ErrUserExists) {
+		// Another replica created the admin between our check and insert
+		s.logger.Logger.Info().Str("username", s.adminConfig.Username).Msg("Admin user already created by another instance")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -139,3 +169,22 @@ func (s *RoleInitializerService) InitializeAdminUser(ctx context.Context) error
 
 	return nil
 }
+
+// reactivateAdminUser reactivates a deactivated admin account with the configured password
+func (s *RoleInitializerService) reactivateAdminUser(ctx context.Context, user *auth_models.User) error {
+	s.logger.Logger.Warn().Str("username", user.Username).Msg("No active admin users found. Reactivating deactivated admin account (ADMIN_REACTIVATE=true)...")
+
+	hashedPassword, err := s.hasher.Hash(s.adminConfig.Password)
+	if err != nil {
+		return fmt.Errorf("failed to hash admin password: %w", err)
+	}
+
+	user.Password = hashedPassword
+	user.Active = true
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to reactivate admin user: %w", err)
+	}
+
+	s.logger.Logger.Warn().Msg("IMPORTANT: Change the admin password after first login for security!")
+	return nil
+}
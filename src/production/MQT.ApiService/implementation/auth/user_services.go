@@ -2,21 +2,35 @@ package auth
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
+	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
 	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
-	"golang.org/x/crypto/bcrypt"
+)
+
+// Role change errors, mapped to HTTP statuses by the user controller.
+// Removing the last admin is reported as interfaces.ErrLastAdmin.
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRole  = errors.New("invalid role")
 )
 
 // UserService provides user management operations
 type UserService struct {
-	userRepo interfaces.UserRepository
+	userRepo    interfaces.UserRepository
+	rbacService *rbac.Service
+	hasher      *password.Hasher
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo interfaces.UserRepository) *UserService {
+func NewUserService(userRepo interfaces.UserRepository, rbacService *rbac.Service, hasher *password.Hasher) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:    userRepo,
+		rbacService: rbacService,
+		hasher:      hasher,
 	}
 }
 
@@ -25,27 +39,35 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*auth_models.
 	return s.userRepo.GetByID(ctx, id)
 }
 
-// GetAllUsers retrieves all users
-func (s *UserService) GetAllUsers(ctx context.Context) ([]*auth_models.User, error) {
-	return s.userRepo.GetAll(ctx)
+// GetAllUsers retrieves all users, optionally including deactivated ones
+func (s *UserService) GetAllUsers(ctx context.Context, includeInactive bool) ([]*auth_models.User, error) {
+	return s.userRepo.GetAll(ctx, includeInactive)
 }
 
-// UpdateUserRole updates a user's role
-func (s *UserService) UpdateUserRole(ctx context.Context, userID string, newRole string) (*auth_models.User, error) {
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err != nil {
-		return nil, err
+// UpdateUserRole updates a user's role and returns the updated user along with
+// the role it replaced
+func (s *UserService) UpdateUserRole(ctx context.Context, userID string, newRole string) (*auth_models.User, string, error) {
+	if !s.rbacService.IsValidRole(newRole) {
+		return nil, "", ErrInvalidRole
 	}
 
-	user.Role = newRole
+	previousRole, err := s.userRepo.UpdateRole(ctx, userID, newRole)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrUserNotFound
+		}
+		return nil, "", err
+	}
 
-	// Update user
-	err = s.userRepo.Update(ctx, user)
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", ErrUserNotFound
 	}
 
-	return user, nil
+	return user, previousRole, nil
 }
 
 // UpdateUser updates a user in the database
@@ -62,11 +84,7 @@ func (s *UserService) DeleteUser(ctx context.Context, userID string) error {
 	return s.userRepo.Delete(ctx, userID, true) // hard delete
 }
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password with the configured algorithm
 func (s *UserService) HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+	return s.hasher.Hash(password)
 }
@@ -0,0 +1,51 @@
+package cacheinvalidation
+
+import (
+	"sync"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// Bus hands the Pi and device changes controllers make to the caches that
+// hold them: this replica's payload validator and, through a Publisher, the
+// ingestors' validation caches. A nil Bus drops events, so controllers built
+// without one still work.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(ingest_models.CacheInvalidation)
+}
+
+// NewBus creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls fn with every event published from now on. fn runs on the
+// publishing request, so it must not block.
+func (b *Bus) Subscribe(fn func(ingest_models.CacheInvalidation)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// PiChanged publishes that a Pi was created, updated or deleted, which evicts
+// it along with its devices
+func (b *Bus) PiChanged(piID, action string) {
+	b.publish(ingest_models.CacheInvalidation{PiID: piID, Action: action})
+}
+
+// DeviceChanged publishes that one device was created, updated or deleted
+func (b *Bus) DeviceChanged(piID string, deviceID int, action string) {
+	b.publish(ingest_models.CacheInvalidation{PiID: piID, DeviceID: &deviceID, Action: action})
+}
+
+func (b *Bus) publish(event ingest_models.CacheInvalidation) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subscribers {
+		fn(event)
+	}
+}
@@ -0,0 +1,35 @@
+package cacheinvalidation
+
+import (
+	"testing"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+func TestBusDeliversToEverySubscriber(t *testing.T) {
+	bus := NewBus()
+	var first, second []ingest_models.CacheInvalidation
+	bus.Subscribe(func(event ingest_models.CacheInvalidation) { first = append(first, event) })
+	bus.Subscribe(func(event ingest_models.CacheInvalidation) { second = append(second, event) })
+
+	bus.PiChanged("pi-1", ingest_models.CacheInvalidationDeleted)
+	bus.DeviceChanged("pi-1", 0, ingest_models.CacheInvalidationCreated)
+
+	for name, got := range map[string][]ingest_models.CacheInvalidation{"first": first, "second": second} {
+		if len(got) != 2 {
+			t.Fatalf("%s subscriber got %d events, want 2", name, len(got))
+		}
+		if got[0].PiID != "pi-1" || got[0].DeviceID != nil || got[0].Action != ingest_models.CacheInvalidationDeleted {
+			t.Errorf("%s subscriber got %+v for the Pi change", name, got[0])
+		}
+		if got[1].DeviceID == nil || *got[1].DeviceID != 0 || got[1].Action != ingest_models.CacheInvalidationCreated {
+			t.Errorf("%s subscriber got %+v for the device change", name, got[1])
+		}
+	}
+}
+
+func TestNilBusDropsEvents(t *testing.T) {
+	var bus *Bus
+	bus.PiChanged("pi-1", ingest_models.CacheInvalidationCreated)
+	bus.DeviceChanged("pi-1", 0, ingest_models.CacheInvalidationCreated)
+}
@@ -0,0 +1,156 @@
+package cacheinvalidation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// publishTimeout bounds how long a publish is waited on before it is counted
+// as failed; handlers never wait on it
+const publishTimeout = 10 * time.Second
+
+var publishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "api_service",
+	Name:      "cache_invalidations_published_total",
+	Help:      "Cache invalidation events published to the ingestors, by result (published or failed).",
+}, []string{"result"})
+
+// Publisher signs events and publishes them on the invalidation topic the
+// ingestors subscribe to. An event that can't be published is logged and
+// dropped; the ingestors' cache TTLs still bound how stale they get.
+type Publisher struct {
+	client  mqtt.Client
+	topic   string
+	secret  string
+	qos     byte
+	quiesce uint
+	logger  *logger.Logger
+}
+
+// NewPublisher connects to the broker in cfg in the background and returns a
+// publisher for topic, signing with secret
+func NewPublisher(cfg config.MQTTConfig, topic, secret string, logger *logger.Logger) (*Publisher, error) {
+	if topic == "" || secret == "" {
+		return nil, errors.New("cache invalidation needs a topic and INTERNAL_API_SECRET")
+	}
+	urls, err := cfg.Brokers()
+	if err != nil {
+		return nil, err
+	}
+
+	// Replicas need client IDs of their own, or the broker disconnects one
+	// whenever another connects
+	clientID := cfg.ClientID
+	if host, err := os.Hostname(); err == nil && host != "" {
+		clientID += "-" + host
+	}
+
+	opts := mqtt.NewClientOptions()
+	for _, u := range urls {
+		opts.AddBroker(u)
+	}
+	opts.SetClientID(clientID).
+		SetKeepAlive(cfg.KeepAlive).
+		SetPingTimeout(cfg.PingTimeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(cfg.MaxReconnectInterval).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(cfg.ConnectRetryInterval).
+		SetCleanSession(true)
+	if cfg.BrokerUser != "" {
+		opts.SetUsername(cfg.BrokerUser)
+		opts.SetPassword(cfg.BrokerPass)
+	}
+	if cfg.UseTLS {
+		tlsCfg, err := tlsConfig(cfg.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+	opts.OnConnect = func(mqtt.Client) {
+		logger.Logger.Info().Str("topic", topic).Msg("Cache invalidation publisher connected")
+	}
+	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
+		logger.Logger.Warn().Err(err).Msg("Cache invalidation publisher lost its connection; reconnecting")
+	}
+
+	// With connect retry on, the token only completes once connected, so it is
+	// not waited on: the API starts while the broker is unreachable
+	client := mqtt.NewClient(opts)
+	client.Connect()
+
+	return &Publisher{
+		client:  client,
+		topic:   topic,
+		secret:  secret,
+		qos:     1,
+		quiesce: uint(cfg.DisconnectQuiesce / time.Millisecond),
+		logger:  logger,
+	}, nil
+}
+
+// Publish signs event and publishes it without waiting for the broker
+func (p *Publisher) Publish(event ingest_models.CacheInvalidation) {
+	message, err := ingest_models.SignCacheInvalidation(p.secret, p.topic, event, time.Now())
+	if err == nil {
+		var payload []byte
+		if payload, err = json.Marshal(message); err == nil {
+			token := p.client.Publish(p.topic, p.qos, false, payload)
+			go p.await(token, event)
+			return
+		}
+	}
+	publishedTotal.WithLabelValues("failed").Inc()
+	p.logger.Logger.Error().Err(err).Str("pi_id", event.PiID).Msg("Failed to build cache invalidation")
+}
+
+func (p *Publisher) await(token mqtt.Token, event ingest_models.CacheInvalidation) {
+	var err error
+	if token.WaitTimeout(publishTimeout) {
+		err = token.Error()
+	} else {
+		err = fmt.Errorf("no acknowledgement within %s", publishTimeout)
+	}
+	if err != nil {
+		publishedTotal.WithLabelValues("failed").Inc()
+		p.logger.Logger.Warn().Err(err).Str("pi_id", event.PiID).Str("action", event.Action).
+			Msg("Failed to publish cache invalidation; ingestors keep their entries until the cache TTL")
+		return
+	}
+	publishedTotal.WithLabelValues("published").Inc()
+}
+
+// Close disconnects from the broker, letting publishes in flight finish
+func (p *Publisher) Close() {
+	p.client.Disconnect(p.quiesce)
+}
+
+func tlsConfig(caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	cp := x509.NewCertPool()
+	if !cp.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("bad CA file")
+	}
+	cfg.RootCAs = cp
+	return cfg, nil
+}
@@ -0,0 +1,164 @@
+package ingestors
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// maxInstances bounds the registry so a misbehaving reporter can't grow it
+// without limit; heartbeats from new instances beyond it are refused
+const maxInstances = 1024
+
+// Per-instance gauges are removed when the instance expires, so sums over them
+// only cover live ingestors. An autoscaler can scale on
+// sum(api_service_ingestor_queue_depth) or max(api_service_ingestor_lag_seconds).
+var (
+	liveInstances = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "api_service",
+		Name:      "ingestors_live",
+		Help:      "Ingestor instances that have sent a heartbeat within INGESTOR_HEARTBEAT_TTL.",
+	})
+
+	instanceQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "api_service",
+		Name:      "ingestor_queue_depth",
+		Help:      "Readings waiting in each live ingestor's queue, as last reported.",
+	}, []string{"instance"})
+
+	instanceProcessingRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "api_service",
+		Name:      "ingestor_processing_rate",
+		Help:      "Readings per second each live ingestor processed, as last reported.",
+	}, []string{"instance"})
+
+	instanceLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "api_service",
+		Name:      "ingestor_lag_seconds",
+		Help:      "Estimated seconds each live ingestor needs to drain its queue, as last reported.",
+	}, []string{"instance"})
+)
+
+// Instance is the latest heartbeat of one ingestor
+type Instance struct {
+	ingest_models.IngestorHeartbeat
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Summary totals the live instances
+type Summary struct {
+	Instances      int     `json:"instances"`
+	QueueDepth     int     `json:"queue_depth"`
+	ProcessingRate float64 `json:"processing_rate"`
+	MaxLagSeconds  float64 `json:"max_lag_seconds"`
+}
+
+// Registry keeps the latest heartbeat of each ingestor instance in memory.
+// Instances that haven't reported within ttl are dropped. Each API replica
+// keeps its own registry, so behind a load balancer an instance shows up on
+// whichever replicas its heartbeats reach.
+type Registry struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	instances map[string]*Instance
+}
+
+// NewRegistry creates an empty registry whose entries expire after ttl
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{
+		ttl:       ttl,
+		instances: make(map[string]*Instance),
+	}
+}
+
+// Record stores a heartbeat. It returns false when the registry is full and
+// the instance isn't already known.
+func (r *Registry) Record(heartbeat ingest_models.IngestorHeartbeat) bool {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(now)
+
+	instance, ok := r.instances[heartbeat.InstanceID]
+	if !ok {
+		if len(r.instances) >= maxInstances {
+			return false
+		}
+		instance = &Instance{FirstSeenAt: now}
+		r.instances[heartbeat.InstanceID] = instance
+	}
+	instance.IngestorHeartbeat = heartbeat
+	instance.LastSeenAt = now
+
+	instanceQueueDepth.WithLabelValues(heartbeat.InstanceID).Set(float64(heartbeat.QueueDepth))
+	instanceProcessingRate.WithLabelValues(heartbeat.InstanceID).Set(heartbeat.ProcessingRate)
+	instanceLag.WithLabelValues(heartbeat.InstanceID).Set(heartbeat.LagSeconds)
+	liveInstances.Set(float64(len(r.instances)))
+	return true
+}
+
+// List returns the live instances ordered by instance ID, with their totals
+func (r *Registry) List() ([]Instance, Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now().UTC())
+
+	list := make([]Instance, 0, len(r.instances))
+	var summary Summary
+	for _, instance := range r.instances {
+		list = append(list, *instance)
+		summary.QueueDepth += instance.QueueDepth
+		summary.ProcessingRate += instance.ProcessingRate
+		if instance.LagSeconds > summary.MaxLagSeconds {
+			summary.MaxLagSeconds = instance.LagSeconds
+		}
+	}
+	summary.Instances = len(list)
+	sort.Slice(list, func(a, b int) bool { return list[a].InstanceID < list[b].InstanceID })
+	return list, summary
+}
+
+// pruneLocked drops instances whose last heartbeat is older than ttl, along
+// with their gauges
+func (r *Registry) pruneLocked(now time.Time) {
+	for id, instance := range r.instances {
+		if now.Sub(instance.LastSeenAt) <= r.ttl {
+			continue
+		}
+		delete(r.instances, id)
+		instanceQueueDepth.DeleteLabelValues(id)
+		instanceProcessingRate.DeleteLabelValues(id)
+		instanceLag.DeleteLabelValues(id)
+	}
+	liveInstances.Set(float64(len(r.instances)))
+}
+
+// Run prunes expired instances every half ttl until ctx is cancelled, so the
+// gauges drop ingestors that stopped reporting even when nobody lists them
+func (r *Registry) Run(ctx context.Context) {
+	if r.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			r.pruneLocked(time.Now().UTC())
+			r.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ingeststats
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// windowMinutes is how far back the per-minute buckets reach
+const windowMinutes = 60
+
+// DeviceStats is the recent ingest activity of one device
+type DeviceStats struct {
+	DeviceID      int        `json:"device_id"`
+	Last1m        uint64     `json:"last_1m"`
+	Last10m       uint64     `json:"last_10m"`
+	Last60m       uint64     `json:"last_60m"`
+	LastReadingAt *time.Time `json:"last_reading_at,omitempty"`
+}
+
+// PiStats is the recent ingest activity of a Pi, per device. Counters are kept
+// in memory only, so Since is the time they started counting (service start).
+type PiStats struct {
+	PiID          string        `json:"pi_id"`
+	Since         time.Time     `json:"since"`
+	Last1m        uint64        `json:"last_1m"`
+	Last10m       uint64        `json:"last_10m"`
+	Last60m       uint64        `json:"last_60m"`
+	LastReadingAt *time.Time    `json:"last_reading_at,omitempty"`
+	Devices       []DeviceStats `json:"devices"`
+}
+
+type seriesKey struct {
+	piID     string
+	deviceID int
+}
+
+// series is a ring of per-minute reading counts for one (pi, device)
+type series struct {
+	key           seriesKey
+	counts        [windowMinutes]uint64
+	minutes       [windowMinutes]int64 // unix minute each bucket currently counts
+	lastReadingAt time.Time
+}
+
+func (s *series) add(at time.Time) {
+	minute := at.Unix() / 60
+	idx := minute % windowMinutes
+	if s.minutes[idx] != minute {
+		s.minutes[idx] = minute
+		s.counts[idx] = 0
+	}
+	s.counts[idx]++
+	if at.After(s.lastReadingAt) {
+		s.lastReadingAt = at
+	}
+}
+
+// sum returns the readings counted in the last n minutes, including the current one
+func (s *series) sum(now time.Time, n int64) uint64 {
+	current := now.Unix() / 60
+	var total uint64
+	for idx := range s.counts {
+		if m := s.minutes[idx]; m > current-n && m <= current {
+			total += s.counts[idx]
+		}
+	}
+	return total
+}
+
+// Counter keeps rolling per-minute ingest counts per (pi, device). At most
+// maxSeries pairs are tracked; the least recently written one is evicted when
+// a new pair arrives at capacity. Safe for concurrent use.
+type Counter struct {
+	mu        sync.Mutex
+	maxSeries int
+	startedAt time.Time
+	order     *list.List // front = most recently written
+	series    map[seriesKey]*list.Element
+	byPi      map[string]map[int]*list.Element
+}
+
+// NewCounter creates a counter tracking at most maxSeries (pi, device) pairs
+func NewCounter(maxSeries int) *Counter {
+	return &Counter{
+		maxSeries: maxSeries,
+		startedAt: time.Now().UTC(),
+		order:     list.New(),
+		series:    make(map[seriesKey]*list.Element),
+		byPi:      make(map[string]map[int]*list.Element),
+	}
+}
+
+// Record counts one accepted reading for a Pi's device
+func (c *Counter) Record(piID string, deviceID int) {
+	if c == nil || c.maxSeries <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+	key := seriesKey{piID: piID, deviceID: deviceID}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.series[key]
+	if ok {
+		c.order.MoveToFront(el)
+	} else {
+		if c.order.Len() >= c.maxSeries {
+			c.evict(c.order.Back())
+		}
+		el = c.order.PushFront(&series{key: key})
+		c.series[key] = el
+		devices := c.byPi[piID]
+		if devices == nil {
+			devices = make(map[int]*list.Element)
+			c.byPi[piID] = devices
+		}
+		devices[deviceID] = el
+	}
+	el.Value.(*series).add(now)
+}
+
+func (c *Counter) evict(el *list.Element) {
+	key := el.Value.(*series).key
+	c.order.Remove(el)
+	delete(c.series, key)
+	if devices := c.byPi[key.piID]; devices != nil {
+		delete(devices, key.deviceID)
+		if len(devices) == 0 {
+			delete(c.byPi, key.piID)
+		}
+	}
+}
+
+// PiStats returns the recent ingest counts for a Pi, with devices sorted by ID
+func (c *Counter) PiStats(piID string) PiStats {
+	stats := PiStats{PiID: piID, Devices: []DeviceStats{}}
+	if c == nil {
+		return stats
+	}
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats.Since = c.startedAt
+	for deviceID, el := range c.byPi[piID] {
+		s := el.Value.(*series)
+		device := DeviceStats{
+			DeviceID: deviceID,
+			Last1m:   s.sum(now, 1),
+			Last10m:  s.sum(now, 10),
+			Last60m:  s.sum(now, 60),
+		}
+		if !s.lastReadingAt.IsZero() {
+			lastReadingAt := s.lastReadingAt
+			device.LastReadingAt = &lastReadingAt
+			if stats.LastReadingAt == nil || lastReadingAt.After(*stats.LastReadingAt) {
+				stats.LastReadingAt = &lastReadingAt
+			}
+		}
+		stats.Last1m += device.Last1m
+		stats.Last10m += device.Last10m
+		stats.Last60m += device.Last60m
+		stats.Devices = append(stats.Devices, device)
+	}
+
+	sort.Slice(stats.Devices, func(a, b int) bool {
+		return stats.Devices[a].DeviceID < stats.Devices[b].DeviceID
+	})
+	return stats
+}
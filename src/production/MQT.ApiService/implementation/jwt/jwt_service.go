@@ -76,6 +76,40 @@ func (s *Service) GenerateTokens(userID, role string) (*api_models.TokenPair, er
 	}, nil
 }
 
+// GenerateImpersonationToken creates a short-lived access token for userID carrying
+// the impersonating admin's ID. No refresh token is issued, so the session ends
+// when the access token expires.
+func (s *Service) GenerateImpersonationToken(userID, role, impersonatorID string) (*api_models.TokenPair, error) {
+	tokenID := uuid.New().String()
+	now := time.Now()
+	expiresAt := now.Add(s.config.ImpersonationTokenDuration)
+
+	accessClaims := api_models.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.config.Issuer,
+		},
+		UserID:         userID,
+		Role:           role,
+		TokenID:        tokenID,
+		ImpersonatorID: impersonatorID,
+	}
+
+	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
+	accessTokenString, err := accessToken.SignedString([]byte(s.config.SecretKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &api_models.TokenPair{
+		AccessToken: accessTokenString,
+		TokenID:     tokenID,
+		ExpiresAt:   expiresAt.Unix(),
+	}, nil
+}
+
 // ValidateAccessToken validates an access token and returns the claims
 func (s *Service) ValidateAccessToken(tokenString string) (*api_models.AccessClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &api_models.AccessClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -89,7 +123,7 @@ func (s *Service) ValidateAccessToken(tokenString string) (*api_models.AccessCla
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*api_models.AccessClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*api_models.AccessClaims); ok && token.Valid && claims.Purpose == "" {
 		return claims, nil
 	}
 
@@ -109,13 +143,65 @@ func (s *Service) ValidateRefreshToken(tokenString string) (*api_models.RefreshC
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*api_models.RefreshClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*api_models.RefreshClaims); ok && token.Valid && claims.Purpose == "" {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid refresh token")
 }
 
+// GeneratePurposeToken creates a token that can only be used for purpose, such
+// as confirming an email change, and expires after ttl. It is rejected as an
+// access or refresh token.
+func (s *Service) GeneratePurposeToken(userID, purpose, target string, ttl time.Duration) (string, *api_models.PurposeClaims, error) {
+	now := time.Now()
+	claims := &api_models.PurposeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.config.Issuer,
+		},
+		UserID:  userID,
+		TokenID: uuid.New().String(),
+		Purpose: purpose,
+		Target:  target,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.config.SecretKey))
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+// ValidatePurposeToken validates a token made by GeneratePurposeToken for purpose
+// and returns the claims. Use IsExpired to tell an expired token from a bad one.
+func (s *Service) ValidatePurposeToken(tokenString, purpose string) (*api_models.PurposeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &api_models.PurposeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.config.SecretKey), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*api_models.PurposeClaims); ok && token.Valid && claims.Purpose == purpose {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// IsExpired reports whether err from a Validate function means the token expired
+func IsExpired(err error) bool {
+	return errors.Is(err, jwt.ErrTokenExpired)
+}
+
 // RefreshTokens generates new access token using a refresh token
 func (s *Service) RefreshTokens(refreshTokenString string, userRepo interfaces.UserRepository) (*api_models.TokenPair, error) {
 	// Validate the refresh token
@@ -0,0 +1,176 @@
+package maintenance
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Status is the maintenance switch as seen by this replica
+type Status struct {
+	Active    bool       `json:"active"`
+	Reason    string     `json:"reason,omitempty"`
+	EnabledBy string     `json:"enabled_by,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Mode is the maintenance switch. While it is active middleware.Maintenance rejects
+// state-changing requests. With a repository the switch is stored in the
+// database and every replica reloads it with RunReload; without one it only
+// applies to this replica.
+//
+// Expiry is evaluated on every check rather than by clearing the switch, so
+// replicas agree on when maintenance ends without having to write.
+type Mode struct {
+	repo       interfaces.MaintenanceRepository
+	retryAfter time.Duration
+	logger     *logger.Logger
+
+	mu    sync.RWMutex
+	state interfaces.MaintenanceState
+}
+
+// NewMode creates a maintenance switch, off until enabled or loaded. repo may
+// be nil to keep the switch in memory only. retryAfter is suggested to clients
+// while maintenance has no expiry.
+func NewMode(repo interfaces.MaintenanceRepository, retryAfter time.Duration, logger *logger.Logger) *Mode {
+	return &Mode{
+		repo:       repo,
+		retryAfter: retryAfter,
+		logger:     logger,
+	}
+}
+
+// Enable turns maintenance on. A duration of zero or less keeps it on until
+// Disable is called.
+func (m *Mode) Enable(ctx context.Context, reason string, duration time.Duration, enabledBy string) (Status, error) {
+	now := time.Now().UTC()
+	state := interfaces.MaintenanceState{
+		Enabled:   true,
+		Reason:    reason,
+		EnabledBy: enabledBy,
+		StartedAt: &now,
+		UpdatedAt: now,
+	}
+	if duration > 0 {
+		expiresAt := now.Add(duration)
+		state.ExpiresAt = &expiresAt
+	}
+	return m.save(ctx, state)
+}
+
+// Disable turns maintenance off
+func (m *Mode) Disable(ctx context.Context) (Status, error) {
+	return m.save(ctx, interfaces.MaintenanceState{UpdatedAt: time.Now().UTC()})
+}
+
+// save stores the state before applying it, so a failed write leaves this
+// replica agreeing with the others
+func (m *Mode) save(ctx context.Context, state interfaces.MaintenanceState) (Status, error) {
+	if m.repo != nil {
+		if err := m.repo.SaveState(ctx, state); err != nil {
+			return Status{}, err
+		}
+	}
+
+	m.mu.Lock()
+	m.state = state
+	m.mu.Unlock()
+	return m.Status(), nil
+}
+
+// Status returns the current switch, treating expired maintenance as off
+func (m *Mode) Status() Status {
+	m.mu.RLock()
+	state := m.state
+	m.mu.RUnlock()
+
+	if !state.Enabled || expired(state, time.Now()) {
+		return Status{Active: false}
+	}
+	return Status{
+		Active:    true,
+		Reason:    state.Reason,
+		EnabledBy: state.EnabledBy,
+		StartedAt: state.StartedAt,
+		ExpiresAt: state.ExpiresAt,
+	}
+}
+
+// Active reports whether writes are paused
+func (m *Mode) Active() bool {
+	return m.Status().Active
+}
+
+// RetryAfter is how long clients should wait before retrying: the time left
+// when maintenance expires, otherwise the configured default. It is at least
+// one second.
+func (m *Mode) RetryAfter() time.Duration {
+	status := m.Status()
+	wait := m.retryAfter
+	if status.ExpiresAt != nil {
+		wait = time.Until(*status.ExpiresAt)
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+func expired(state interfaces.MaintenanceState, now time.Time) bool {
+	return state.ExpiresAt != nil && !now.Before(*state.ExpiresAt)
+}
+
+// Reload replaces the switch with the stored one. It does nothing without a
+// repository.
+func (m *Mode) Reload(ctx context.Context) error {
+	if m.repo == nil {
+		return nil
+	}
+
+	state, err := m.repo.GetState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &interfaces.MaintenanceState{}
+	}
+
+	m.mu.Lock()
+	changed := state.Enabled != m.state.Enabled
+	m.state = *state
+	m.mu.Unlock()
+
+	if changed {
+		m.logger.Logger.Info().Bool("enabled", state.Enabled).Str("reason", state.Reason).Msg("Maintenance mode changed")
+	}
+	return nil
+}
+
+// RunReload calls Reload every interval until ctx is cancelled. Failures are
+// logged and the current switch is kept.
+func (m *Mode) RunReload(ctx context.Context, interval time.Duration) {
+	if m.repo == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := m.Reload(reloadCtx); err != nil {
+				m.logger.Logger.Warn().Err(err).Msg("Failed to reload maintenance mode")
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package mqttauth
+
+import "strings"
+
+// Broker ACL actions
+const (
+	ActionPublish   = "publish"
+	ActionSubscribe = "subscribe"
+)
+
+// TopicRules are the topic prefixes a Pi may use. Each prefix is followed by the
+// pi_id: a Pi publishes under <SensorPrefix>/<pi_id>/, announces devices on
+// exactly <DiscoveryPrefix>/<pi_id>, and subscribes under <CommandPrefix>/<pi_id>/
+// and <ErrorPrefix>/<pi_id>/.
+type TopicRules struct {
+	SensorPrefix    string
+	CommandPrefix   string
+	ErrorPrefix     string
+	DiscoveryPrefix string
+}
+
+// Authorize reports whether the Pi may perform action on topic. Publishes must
+// name a concrete topic; subscriptions may use wildcards below the Pi's own level.
+func (r TopicRules) Authorize(piID, action, topic string) bool {
+	if piID == "" || strings.ContainsAny(piID, "/+#") {
+		return false
+	}
+
+	switch action {
+	case ActionPublish:
+		if strings.ContainsAny(topic, "+#") {
+			return false
+		}
+		return withinPi(r.SensorPrefix, piID, topic) || isPiTopic(r.DiscoveryPrefix, piID, topic)
+	case ActionSubscribe:
+		return withinPi(r.CommandPrefix, piID, topic) || withinPi(r.ErrorPrefix, piID, topic)
+	default:
+		return false
+	}
+}
+
+// withinPi reports whether topic is <prefix>/<piID> or below it. Wildcards can
+// only appear after the pi_id level, since that level must match literally.
+func withinPi(prefix, piID, topic string) bool {
+	if prefix == "" {
+		return false
+	}
+	base := strings.TrimSuffix(prefix, "/") + "/" + piID
+	return topic == base || strings.HasPrefix(topic, base+"/")
+}
+
+// isPiTopic reports whether topic is exactly <prefix>/<piID>
+func isPiTopic(prefix, piID, topic string) bool {
+	return prefix != "" && topic == strings.TrimSuffix(prefix, "/")+"/"+piID
+}
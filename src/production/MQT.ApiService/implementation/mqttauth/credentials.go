@@ -0,0 +1,34 @@
+package mqttauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// secretBytes is the amount of randomness in a generated broker password
+const secretBytes = 32
+
+// GenerateSecret returns a new random broker password
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashSecret hashes a generated broker password for storage. The password is
+// 256 random bits, so a fast hash is enough and keeps broker auth hooks cheap;
+// user passwords go through the password package instead.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret reports whether secret matches a stored hash
+func VerifySecret(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashSecret(secret))) == 1
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// KindDigest is the kind of a summary of held-back notifications
+const KindDigest = "digest"
+
+// digestSettleDelay keeps a digest window open a little past its end so
+// notifications written just before it, by a replica with a slightly different
+// clock, still make it in
+const digestSettleDelay = time.Minute
+
+// Digester sends the notifications a Dispatcher held back, as one summary per
+// user and channel once their digest window has closed and they are out of
+// quiet hours.
+//
+// Progress is tracked as a watermark per user and channel, advanced only after
+// the summary was sent, so restarts neither drop nor repeat a digest. A crash
+// between sending and advancing sends that one digest again.
+type Digester struct {
+	dispatcher *Dispatcher
+	repo       interfaces.NotificationRepository
+	logger     *logger.Logger
+	now        func() time.Time
+}
+
+// NewDigester creates a digest job sending through dispatcher
+func NewDigester(dispatcher *Dispatcher, repo interfaces.NotificationRepository, logger *logger.Logger) *Digester {
+	return &Digester{
+		dispatcher: dispatcher,
+		repo:       repo,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// Run calls RunOnce every interval until ctx is cancelled. Failures are
+// logged and retried on the next tick.
+func (g *Digester) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.RunOnce(ctx); err != nil {
+				g.logger.Logger.Warn().Err(err).Msg("Failed to send notification digests")
+			}
+		}
+	}
+}
+
+// RunOnce sends every digest that is due. A recipient whose digest fails is
+// skipped and retried on the next run.
+func (g *Digester) RunOnce(ctx context.Context) error {
+	now := g.now()
+
+	recipients, err := g.repo.ListPendingRecipients(ctx)
+	if err != nil {
+		return err
+	}
+
+	prefsByUser := make(map[string]notification_models.Preferences)
+	for _, recipient := range recipients {
+		prefs, ok := prefsByUser[recipient.UserID]
+		if !ok {
+			prefs = g.dispatcher.loadPreferences(ctx, recipient.UserID)
+			prefsByUser[recipient.UserID] = prefs
+		}
+
+		if err := g.flush(ctx, recipient, newSchedule(prefs), now); err != nil {
+			g.logger.Logger.Warn().Err(err).
+				Str("user_id", recipient.UserID).
+				Str("channel", recipient.Channel).
+				Msg("Failed to send notification digest")
+		}
+	}
+	return nil
+}
+
+// flush sends the recipient's notifications up to the latest closed window
+func (g *Digester) flush(ctx context.Context, recipient notification_models.PendingRecipient, sched schedule, now time.Time) error {
+	if sched.inQuietHours(now) {
+		return nil
+	}
+
+	until := sched.digestBoundary(now)
+	if settled := now.Add(-digestSettleDelay); until.After(settled) {
+		until = settled
+	}
+	if !until.After(recipient.DispatchedUntil) {
+		return nil
+	}
+
+	pending, err := g.repo.ListPendingNotifications(ctx, recipient.UserID, recipient.Channel, recipient.DispatchedUntil, until)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		n := summarize(recipient, pending, sched.loc)
+		if err := g.dispatcher.send(ctx, recipient.Channel, n); err != nil && !errors.Is(err, ErrPermanent) {
+			return err
+		}
+		// Permanent failures were recorded by send; retrying won't fix them,
+		// so the watermark still moves on
+	}
+	return g.repo.AdvanceWatermark(ctx, recipient.UserID, recipient.Channel, until)
+}
+
+// summarize folds pending notifications into one. A single notification is
+// sent as it was.
+func summarize(recipient notification_models.PendingRecipient, pending []notification_models.PendingNotification, loc *time.Location) Notification {
+	to := Recipient{UserID: recipient.UserID, Email: recipient.Email, Channels: []string{recipient.Channel}}
+	if len(pending) == 1 {
+		return Notification{
+			Recipient: to,
+			Kind:      pending[0].Kind,
+			Subject:   pending[0].Subject,
+			Body:      pending[0].Body,
+			Data:      pending[0].Data,
+		}
+	}
+
+	kinds := make(map[string]int)
+	var body strings.Builder
+	for _, p := range pending {
+		kinds[p.Kind]++
+		fmt.Fprintf(&body, "%s  %s\n", p.CreatedAt.In(loc).Format("2006-01-02 15:04"), p.Subject)
+	}
+
+	return Notification{
+		Recipient: to,
+		Kind:      KindDigest,
+		Subject:   fmt.Sprintf("%d notifications", len(pending)),
+		Body:      body.String(),
+		Data: map[string]interface{}{
+			"count": len(pending),
+			"kinds": kinds,
+			"from":  pending[0].CreatedAt,
+			"until": pending[len(pending)-1].CreatedAt,
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+)
+
+// EmailNotifier sends notifications through an SMTP relay
+type EmailNotifier struct {
+	cfg config.EmailNotifierConfig
+}
+
+// NewEmailNotifier creates an SMTP email notifier
+func NewEmailNotifier(cfg config.EmailNotifierConfig) *EmailNotifier {
+	return &EmailNotifier{cfg: cfg}
+}
+
+// Send emails the notification to the recipient's address
+func (e *EmailNotifier) Send(ctx context.Context, n Notification) error {
+	if n.Recipient.Email == "" {
+		return fmt.Errorf("%w: recipient has no email address", ErrPermanent)
+	}
+	if strings.ContainsAny(n.Recipient.Email, "\r\n") || strings.ContainsAny(n.Subject, "\r\n") {
+		return fmt.Errorf("%w: header values must not contain line breaks", ErrPermanent)
+	}
+
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.SMTPHost)
+	}
+
+	msg := "From: " + e.cfg.From + "\r\n" +
+		"To: " + n.Recipient.Email + "\r\n" +
+		"Subject: " + n.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + n.Body + "\r\n"
+
+	addr := net.JoinHostPort(e.cfg.SMTPHost, strconv.Itoa(e.cfg.SMTPPort))
+
+	// net/smtp has no context support; run it aside so cancellation still returns
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, e.cfg.From, []string{n.Recipient.Email}, []byte(msg))
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// SendMail emails one message straight to an address, bypassing preferences.
+// It is used for account mail such as email change confirmations.
+func (e *EmailNotifier) SendMail(ctx context.Context, to, subject, body string) error {
+	return e.Send(ctx, Notification{
+		Recipient: Recipient{Email: to},
+		Kind:      "account",
+		Subject:   subject,
+		Body:      body,
+	})
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+)
+
+// MQTTNotifier publishes notifications to a per-user MQTT topic
+type MQTTNotifier struct {
+	cfg    config.MQTTNotifierConfig
+	client mqtt.Client
+}
+
+// NewMQTTNotifier creates an MQTT notifier on an already connected client
+func NewMQTTNotifier(cfg config.MQTTNotifierConfig, client mqtt.Client) *MQTTNotifier {
+	return &MQTTNotifier{cfg: cfg, client: client}
+}
+
+// Send publishes the notification as JSON on the recipient's topic
+func (m *MQTTNotifier) Send(ctx context.Context, n Notification) error {
+	if !m.client.IsConnected() {
+		return fmt.Errorf("mqtt client is not connected")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"kind":      n.Kind,
+		"subject":   n.Subject,
+		"body":      n.Body,
+		"data":      n.Data,
+		"timestamp": time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal notification: %v", ErrPermanent, err)
+	}
+
+	topic := strings.ReplaceAll(m.cfg.TopicTemplate, "{user_id}", n.Recipient.UserID)
+	token := m.client.Publish(topic, m.cfg.QoS, false, payload)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-token.Done():
+		return token.Error()
+	}
+}
@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Channel names, as used in recipient preferences and NOTIFY_DEFAULT_CHANNELS
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack" // alias for the webhook channel
+	ChannelMQTT    = "mqtt"
+)
+
+// KnownChannel reports whether name is a channel users may ask for, whether or
+// not it is enabled on this deployment
+func KnownChannel(name string) bool {
+	switch name {
+	case ChannelEmail, ChannelWebhook, ChannelSlack, ChannelMQTT:
+		return true
+	}
+	return false
+}
+
+// Recipient identifies who a notification is for
+type Recipient struct {
+	UserID   string
+	Email    string
+	Channels []string // preferred channels; empty uses the dispatcher defaults
+}
+
+// Notification is a single message to deliver to a recipient
+type Notification struct {
+	Recipient Recipient
+	Kind      string // e.g. "alert", "pi_offline", "password_reset"
+	Subject   string
+	Body      string
+	Data      map[string]interface{}
+	Critical  bool // sent right away, ignoring quiet hours and digest mode
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// ErrPermanent marks a delivery error that retrying won't fix (bad address,
+// channel not usable for this recipient)
+var ErrPermanent = errors.New("permanent notification failure")
+
+// Dispatcher routes notifications to the recipient's preferred channels,
+// retrying each channel with exponential backoff. With preferences it holds
+// non-critical notifications back for a Digester while the recipient is in
+// quiet hours or asked for digests.
+type Dispatcher struct {
+	channels        map[string]Notifier
+	defaultChannels []string
+	maxAttempts     int
+	retryBackoff    time.Duration
+	auditService    *audit.Service
+	logger          *logger.Logger
+
+	preferences interfaces.NotificationRepository
+	now         func() time.Time
+}
+
+// NewDispatcher creates a dispatcher over the given channels
+func NewDispatcher(channels map[string]Notifier, defaultChannels []string, maxAttempts int, retryBackoff time.Duration, auditService *audit.Service, logger *logger.Logger) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		channels:        channels,
+		defaultChannels: defaultChannels,
+		maxAttempts:     maxAttempts,
+		retryBackoff:    retryBackoff,
+		auditService:    auditService,
+		logger:          logger,
+		now:             time.Now,
+	}
+}
+
+// UsePreferences makes the dispatcher consult each recipient's stored
+// notification preferences before sending
+func (d *Dispatcher) UsePreferences(repo interfaces.NotificationRepository) {
+	d.preferences = repo
+}
+
+// loadPreferences returns the recipient's preferences, or the defaults when
+// they have none or they can't be read. Failing to read them sends the
+// notification right away rather than losing it.
+func (d *Dispatcher) loadPreferences(ctx context.Context, userID string) notification_models.Preferences {
+	if d.preferences == nil || userID == "" {
+		return notification_models.DefaultPreferences(userID)
+	}
+	prefs, err := d.preferences.GetPreferences(ctx, userID)
+	if err != nil {
+		d.logger.Logger.Warn().Err(err).Str("user_id", userID).Msg("Failed to load notification preferences, sending immediately")
+	}
+	if prefs == nil {
+		return notification_models.DefaultPreferences(userID)
+	}
+	return *prefs
+}
+
+// Dispatch sends n on every channel the recipient prefers, or holds it back
+// for the digest job when their preferences say so. It returns an error only if
+// no channel delivered or queued the notification.
+func (d *Dispatcher) Dispatch(ctx context.Context, n Notification) error {
+	prefs := d.loadPreferences(ctx, n.Recipient.UserID)
+
+	channels := n.Recipient.Channels
+	if len(channels) == 0 {
+		channels = prefs.Channels
+	}
+	if len(channels) == 0 {
+		channels = d.defaultChannels
+	}
+
+	hold := false
+	if d.preferences != nil && !n.Critical {
+		sched := newSchedule(prefs)
+		hold = !sched.immediate() || sched.inQuietHours(d.now())
+	}
+
+	var errs []error
+	handled := 0
+	for _, name := range channels {
+		if name == ChannelSlack {
+			name = ChannelWebhook
+		}
+		if _, ok := d.channels[name]; !ok {
+			errs = append(errs, fmt.Errorf("%s: channel not configured", name))
+			continue
+		}
+
+		var err error
+		if hold {
+			err = d.hold(ctx, name, n)
+		} else {
+			err = d.send(ctx, name, n)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		handled++
+	}
+
+	if handled == 0 {
+		if len(errs) == 0 {
+			return fmt.Errorf("no notification channels for recipient %s", n.Recipient.UserID)
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// send delivers n on one configured channel, recording a failure
+func (d *Dispatcher) send(ctx context.Context, name string, n Notification) error {
+	notifier, ok := d.channels[name]
+	if !ok {
+		return fmt.Errorf("channel not configured")
+	}
+	if err := d.sendWithRetry(ctx, name, notifier, n); err != nil {
+		d.recordFailure(ctx, name, n, err)
+		return err
+	}
+	return nil
+}
+
+// hold queues n on one channel for the digest job
+func (d *Dispatcher) hold(ctx context.Context, name string, n Notification) error {
+	return d.preferences.EnqueueNotification(ctx, notification_models.PendingNotification{
+		UserID:  n.Recipient.UserID,
+		Channel: name,
+		Kind:    n.Kind,
+		Subject: n.Subject,
+		Body:    n.Body,
+		Data:    n.Data,
+	})
+}
+
+func (d *Dispatcher) sendWithRetry(ctx context.Context, name string, notifier Notifier, n Notification) error {
+	var err error
+	for attempt := 0; attempt < d.maxAttempts; attempt++ {
+		if err = notifier.Send(ctx, n); err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrPermanent) || attempt == d.maxAttempts-1 {
+			break
+		}
+
+		delay := d.retryBackoff * time.Duration(1<<attempt)
+		d.logger.Logger.Warn().Err(err).
+			Str("channel", name).
+			Str("user_id", n.Recipient.UserID).
+			Int("attempt", attempt+1).
+			Dur("retry_in", delay).
+			Msg("Notification delivery failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) recordFailure(ctx context.Context, name string, n Notification, err error) {
+	d.logger.Logger.Error().Err(err).
+		Str("channel", name).
+		Str("user_id", n.Recipient.UserID).
+		Str("kind", n.Kind).
+		Msg("Notification delivery failed")
+
+	if d.auditService == nil {
+		return
+	}
+	d.auditService.Record(ctx, audit_models.AuditEvent{
+		ActorType:    audit_models.ActorTypeSystem,
+		Action:       "notification.delivery_failed",
+		ResourceType: "user",
+		ResourceID:   n.Recipient.UserID,
+		Details: map[string]interface{}{
+			"channel": name,
+			"kind":    n.Kind,
+			"error":   err.Error(),
+		},
+	})
+}
+
+// NewDispatcherFromConfig builds a dispatcher with every enabled channel.
+// mqttClient may be nil when the MQTT channel is disabled.
+func NewDispatcherFromConfig(cfg config.NotificationsConfig, mqttClient mqtt.Client, auditService *audit.Service, logger *logger.Logger) (*Dispatcher, error) {
+	channels := make(map[string]Notifier)
+	if cfg.Email.Enabled {
+		channels[ChannelEmail] = NewEmailNotifier(cfg.Email)
+	}
+	if cfg.Webhook.Enabled {
+		channels[ChannelWebhook] = NewWebhookNotifier(cfg.Webhook)
+	}
+	if cfg.MQTT.Enabled {
+		if mqttClient == nil {
+			return nil, fmt.Errorf("MQTT notifications are enabled but no MQTT client was provided")
+		}
+		channels[ChannelMQTT] = NewMQTTNotifier(cfg.MQTT, mqttClient)
+	}
+
+	return NewDispatcher(channels, cfg.DefaultChannels, cfg.MaxAttempts, cfg.RetryBackoff, auditService, logger), nil
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"time"
+
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+)
+
+// schedule is a user's preferences resolved against their timezone
+type schedule struct {
+	mode       string
+	loc        *time.Location
+	quiet      bool
+	quietStart int // minutes after local midnight
+	quietEnd   int
+}
+
+// newSchedule resolves prefs. Preferences are validated when stored, so an
+// unknown timezone or malformed quiet hours fall back to UTC and no quiet hours.
+func newSchedule(prefs notification_models.Preferences) schedule {
+	s := schedule{mode: prefs.DigestMode, loc: time.UTC}
+	if loc, err := time.LoadLocation(prefs.Timezone); err == nil {
+		s.loc = loc
+	}
+
+	start, errStart := time.Parse(notification_models.ClockLayout, prefs.QuietHoursStart)
+	end, errEnd := time.Parse(notification_models.ClockLayout, prefs.QuietHoursEnd)
+	if errStart == nil && errEnd == nil {
+		s.quietStart = start.Hour()*60 + start.Minute()
+		s.quietEnd = end.Hour()*60 + end.Minute()
+		s.quiet = s.quietStart != s.quietEnd
+	}
+	return s
+}
+
+// immediate reports whether notifications are sent as they happen rather than
+// collected for a digest
+func (s schedule) immediate() bool {
+	return s.mode != notification_models.DigestHourly && s.mode != notification_models.DigestDaily
+}
+
+// inQuietHours reports whether t falls in the quiet window. A window whose end
+// is before its start wraps past midnight.
+func (s schedule) inQuietHours(t time.Time) bool {
+	if !s.quiet {
+		return false
+	}
+	local := t.In(s.loc)
+	minute := local.Hour()*60 + local.Minute()
+	if s.quietStart < s.quietEnd {
+		return minute >= s.quietStart && minute < s.quietEnd
+	}
+	return minute >= s.quietStart || minute < s.quietEnd
+}
+
+// digestBoundary is the end of the latest digest window that has closed by t:
+// the start of the current local hour or day. In immediate mode every deferred
+// notification is due, so it is t itself.
+func (s schedule) digestBoundary(t time.Time) time.Time {
+	local := t.In(s.loc)
+	switch s.mode {
+	case notification_models.DigestHourly:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, s.loc)
+	case notification_models.DigestDaily:
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.loc)
+	default:
+		return t
+	}
+}
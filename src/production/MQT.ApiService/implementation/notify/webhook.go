@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+)
+
+// WebhookNotifier posts notifications to an HTTP endpoint, optionally in the
+// Slack incoming-webhook format
+type WebhookNotifier struct {
+	cfg        config.WebhookNotifierConfig
+	httpClient *http.Client
+}
+
+// NewWebhookNotifier creates a webhook notifier
+func NewWebhookNotifier(cfg config.WebhookNotifierConfig) *WebhookNotifier {
+	return &WebhookNotifier{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Send posts the notification to the configured URL
+func (w *WebhookNotifier) Send(ctx context.Context, n Notification) error {
+	var payload interface{}
+	if w.cfg.SlackFormat {
+		payload = map[string]string{"text": fmt.Sprintf("*%s*\n%s", n.Subject, n.Body)}
+	} else {
+		payload = map[string]interface{}{
+			"user_id": n.Recipient.UserID,
+			"kind":    n.Kind,
+			"subject": n.Subject,
+			"body":    n.Body,
+			"data":    n.Data,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal webhook payload: %v", ErrPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		// Client errors other than rate limiting won't succeed on retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", ErrPermanent, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+)
+
+// Small parameters keep the tests fast; only their differences matter
+var (
+	bcryptConfig     = config.PasswordHashConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	argon2idConfig   = config.PasswordHashConfig{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2MemoryKiB: 1024, Argon2Threads: 1}
+	strongerArgon2id = config.PasswordHashConfig{Algorithm: AlgorithmArgon2id, Argon2Time: 2, Argon2MemoryKiB: 2048, Argon2Threads: 1}
+)
+
+func mustHash(t *testing.T, cfg config.PasswordHashConfig, password string) string {
+	t.Helper()
+	hash, err := NewHasher(cfg).Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return hash
+}
+
+// A hash verifies under any configuration; it needs rehashing unless it was
+// made with the configured algorithm and parameters
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		hashedWith config.PasswordHashConfig
+		verifyWith config.PasswordHashConfig
+		password   string
+		wantErr    error
+		wantRehash bool
+		wantPrefix string
+	}{
+		{name: "bcrypt under bcrypt", hashedWith: bcryptConfig, verifyWith: bcryptConfig, password: "secret", wantPrefix: "$2a$"},
+		{name: "bcrypt under argon2id", hashedWith: bcryptConfig, verifyWith: argon2idConfig, password: "secret", wantRehash: true},
+		{name: "bcrypt under a higher cost", hashedWith: bcryptConfig, verifyWith: config.PasswordHashConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 5}, password: "secret", wantRehash: true},
+		{name: "argon2id under argon2id", hashedWith: argon2idConfig, verifyWith: argon2idConfig, password: "secret", wantPrefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "argon2id under bcrypt", hashedWith: argon2idConfig, verifyWith: bcryptConfig, password: "secret", wantRehash: true},
+		{name: "argon2id under stronger parameters", hashedWith: argon2idConfig, verifyWith: strongerArgon2id, password: "secret", wantRehash: true},
+		{name: "wrong password for bcrypt", hashedWith: bcryptConfig, verifyWith: argon2idConfig, password: "wrong", wantErr: ErrMismatch},
+		{name: "wrong password for argon2id", hashedWith: argon2idConfig, verifyWith: bcryptConfig, password: "wrong", wantErr: ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := mustHash(t, tt.hashedWith, "secret")
+			if !strings.HasPrefix(hash, tt.wantPrefix) {
+				t.Errorf("hash %q, want prefix %q", hash, tt.wantPrefix)
+			}
+			needsRehash, err := NewHasher(tt.verifyWith).Verify(hash, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.wantRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownFormat(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+		"$argon2id$v=19$c2FsdA$a2V5",
+	} {
+		if _, err := NewHasher(argon2idConfig).Verify(hash, "secret"); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Verify(%q) error = %v, want %v", hash, err, ErrUnknownFormat)
+		}
+	}
+}
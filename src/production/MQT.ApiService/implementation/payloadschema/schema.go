@@ -0,0 +1,406 @@
+package payloadschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// maxViolations caps how many violations are reported for one payload
+const maxViolations = 20
+
+// Keywords that only describe a schema and are accepted without effect
+var annotationKeywords = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"deprecated":  true,
+	"readOnly":    true,
+	"writeOnly":   true,
+}
+
+var validTypes = map[string]bool{
+	"object":  true,
+	"array":   true,
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"null":    true,
+}
+
+// Schema is a compiled JSON Schema. Compile supports the keywords payload
+// contracts need: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength and
+// pattern. Any other keyword is rejected rather than silently ignored, so a
+// schema never looks stricter than it is.
+type Schema struct {
+	types []string
+
+	enum []interface{}
+
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *bool
+	additionalSchema     *Schema
+
+	items    *Schema
+	minItems *int
+	maxItems *int
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+}
+
+// Compile parses a JSON Schema document
+func Compile(document []byte) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(document, &raw); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema must be a JSON object")
+	}
+	return compile(object, "")
+}
+
+func compile(raw map[string]interface{}, path string) (*Schema, error) {
+	s := &Schema{}
+	keywords := make([]string, 0, len(raw))
+	for keyword := range raw {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		value := raw[keyword]
+		where := joinPath(path, keyword)
+		var err error
+
+		switch keyword {
+		case "type":
+			s.types, err = compileTypes(value)
+		case "enum":
+			values, ok := value.([]interface{})
+			if !ok || len(values) == 0 {
+				err = fmt.Errorf("must be a non-empty array")
+			}
+			s.enum = values
+		case "const":
+			s.enum = []interface{}{value}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			s.properties = make(map[string]*Schema, len(properties))
+			for name, property := range properties {
+				object, ok := property.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: must be an object", joinPath(where, name))
+				}
+				if s.properties[name], err = compile(object, joinPath(where, name)); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an array of strings")
+				break
+			}
+			for _, name := range names {
+				str, ok := name.(string)
+				if !ok {
+					err = fmt.Errorf("must be an array of strings")
+					break
+				}
+				s.required = append(s.required, str)
+			}
+		case "additionalProperties":
+			switch v := value.(type) {
+			case bool:
+				s.additionalProperties = &v
+			case map[string]interface{}:
+				s.additionalSchema, err = compile(v, where)
+				if err != nil {
+					return nil, err
+				}
+			default:
+				err = fmt.Errorf("must be a boolean or an object")
+			}
+		case "items":
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			if s.items, err = compile(object, where); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			s.minItems, err = compileCount(value)
+		case "maxItems":
+			s.maxItems, err = compileCount(value)
+		case "minLength":
+			s.minLength, err = compileCount(value)
+		case "maxLength":
+			s.maxLength, err = compileCount(value)
+		case "minimum":
+			s.minimum, err = compileNumber(value)
+		case "maximum":
+			s.maximum, err = compileNumber(value)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = compileNumber(value)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = compileNumber(value)
+		case "multipleOf":
+			s.multipleOf, err = compileNumber(value)
+			if err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("must be greater than 0")
+			}
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		default:
+			if !annotationKeywords[keyword] {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+	}
+
+	return s, nil
+}
+
+func compileTypes(value interface{}) ([]string, error) {
+	var names []interface{}
+	switch v := value.(type) {
+	case string:
+		names = []interface{}{v}
+	case []interface{}:
+		names = v
+	default:
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+
+	types := make([]string, 0, len(names))
+	for _, name := range names {
+		str, ok := name.(string)
+		if !ok || !validTypes[str] {
+			return nil, fmt.Errorf("unknown type %v", name)
+		}
+		types = append(types, str)
+	}
+	return types, nil
+}
+
+func compileNumber(value interface{}) (*float64, error) {
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &number, nil
+}
+
+func compileCount(value interface{}) (*int, error) {
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(number)
+	return &count, nil
+}
+
+// Validate checks a decoded JSON value against the schema and returns the
+// violations, at most maxViolations of them. No violations means it passed.
+func (s *Schema) Validate(value interface{}) []hardware_models.SchemaViolation {
+	var violations []hardware_models.SchemaViolation
+	s.validate(value, "", &violations)
+	return violations
+}
+
+func (s *Schema) validate(value interface{}, path string, violations *[]hardware_models.SchemaViolation) {
+	report := func(format string, args ...interface{}) {
+		if len(*violations) < maxViolations {
+			*violations = append(*violations, hardware_models.SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if number, ok := value.(json.Number); ok {
+		if f, err := number.Float64(); err == nil {
+			value = f
+		}
+	}
+
+	if len(s.types) > 0 && !matchesType(value, s.types) {
+		report("expected %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value is not one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(v, path, violations)
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			report("expected at least %d items, got %d", *s.minItems, len(v))
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			report("expected at most %d items, got %d", *s.maxItems, len(v))
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"["+strconv.Itoa(i)+"]", violations)
+			}
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			report("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			report("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			report("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			report("must be < %v", *s.exclusiveMaximum)
+		}
+		if s.multipleOf != nil {
+			quotient := v / *s.multipleOf
+			if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+				report("must be a multiple of %v", *s.multipleOf)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			report("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			report("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("does not match pattern %s", s.pattern.String())
+		}
+	}
+}
+
+func (s *Schema) validateObject(object map[string]interface{}, path string, violations *[]hardware_models.SchemaViolation) {
+	for _, name := range s.required {
+		if _, ok := object[name]; !ok {
+			if len(*violations) < maxViolations {
+				*violations = append(*violations, hardware_models.SchemaViolation{Path: joinPath(path, name), Message: "required field is missing"})
+			}
+		}
+	}
+
+	// Walk keys in order so the reported violations are stable
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := joinPath(path, name)
+		if property, ok := s.properties[name]; ok {
+			property.validate(object[name], child, violations)
+			continue
+		}
+		if s.additionalSchema != nil {
+			s.additionalSchema.validate(object[name], child, violations)
+			continue
+		}
+		if s.additionalProperties != nil && !*s.additionalProperties {
+			if len(*violations) < maxViolations {
+				*violations = append(*violations, hardware_models.SchemaViolation{Path: child, Message: "field is not allowed"})
+			}
+		}
+	}
+}
+
+func matchesType(value interface{}, types []string) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of a decoded JSON value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// joinPath appends a key to a dot path, escaping dots in the key as the fields
+// parameter does
+func joinPath(path, key string) string {
+	key = strings.ReplaceAll(key, ".", `\.`)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,259 @@
+package payloadschema
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// maxCachedDevices bounds the device type cache; it is cleared when full
+const maxCachedDevices = 10000
+
+// Outcomes counted by payloadValidationsTotal
+const (
+	outcomePass   = "pass"
+	outcomeFlag   = "flag"
+	outcomeReject = "reject"
+)
+
+var payloadValidationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "api_service",
+	Name:      "payload_validations_total",
+	Help:      "Reading payloads checked against their device type's active schema, by outcome.",
+}, []string{"outcome"})
+
+// Result is the outcome of checking one payload against its device type's
+// active schema
+type Result struct {
+	DeviceType    string
+	SchemaVersion int
+	Enforcement   string
+	Violations    []hardware_models.SchemaViolation
+}
+
+// Rejected reports whether the reading should be refused
+func (r *Result) Rejected() bool {
+	return r != nil && len(r.Violations) > 0 && r.Enforcement == hardware_models.SchemaEnforcementReject
+}
+
+// Flagged reports whether the reading should be stored and its violations recorded
+func (r *Result) Flagged() bool {
+	return r != nil && len(r.Violations) > 0 && r.Enforcement != hardware_models.SchemaEnforcementReject
+}
+
+type activeSchema struct {
+	version     int
+	enforcement string
+	schema      *Schema
+}
+
+type schemaKey struct {
+	deviceType string
+	version    int
+}
+
+type deviceKey struct {
+	piID     string
+	deviceID int
+}
+
+type deviceTypeEntry struct {
+	deviceType string
+	loadedAt   time.Time
+}
+
+// Validator checks reading payloads against the active schema of their device
+// type. Active schemas are loaded together in one query and device types are
+// looked up per device, both cached for ttl, so a reading costs no queries while
+// the caches are warm and none at all while no schema is active. Schema
+// versions are immutable, so compiled schemas are kept across refreshes.
+//
+// Lookups fail open: when the database can't be reached the payload is not
+// checked rather than the reading being lost.
+type Validator struct {
+	schemaRepo interfaces.PayloadSchemaRepository
+	deviceRepo interfaces.DeviceRepository
+	ttl        time.Duration
+	logger     *logger.Logger
+
+	mu          sync.Mutex
+	active      map[string]*activeSchema
+	compiled    map[schemaKey]*Schema
+	loadedAt    time.Time
+	generation  uint64
+	refreshing  bool
+	deviceTypes map[deviceKey]deviceTypeEntry
+}
+
+// NewValidator creates a validator caching schemas and device types for ttl.
+// A ttl of 0 reloads them for every reading.
+func NewValidator(schemaRepo interfaces.PayloadSchemaRepository, deviceRepo interfaces.DeviceRepository, ttl time.Duration, logger *logger.Logger) *Validator {
+	return &Validator{
+		schemaRepo:  schemaRepo,
+		deviceRepo:  deviceRepo,
+		ttl:         ttl,
+		logger:      logger,
+		compiled:    make(map[schemaKey]*Schema),
+		deviceTypes: make(map[deviceKey]deviceTypeEntry),
+	}
+}
+
+// Invalidate drops the cached schemas so the next reading reloads them. Call it
+// after changing a schema; other replicas pick the change up within ttl.
+func (v *Validator) Invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.generation++
+	v.loadedAt = time.Time{}
+}
+
+// InvalidateDevice drops the cached type of a device, or of every device of the
+// Pi when deviceID is nil. Call it after changing or deleting devices; other
+// replicas pick the change up within ttl.
+func (v *Validator) InvalidateDevice(piID string, deviceID *int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if deviceID != nil {
+		delete(v.deviceTypes, deviceKey{piID: piID, deviceID: *deviceID})
+		return
+	}
+	for key := range v.deviceTypes {
+		if key.piID == piID {
+			delete(v.deviceTypes, key)
+		}
+	}
+}
+
+// Check validates a payload against the active schema of the device's type. It
+// returns nil when no schema applies.
+func (v *Validator) Check(ctx context.Context, piID string, deviceID int, payload map[string]interface{}) *Result {
+	active := v.activeSchemas(ctx)
+	if len(active) == 0 {
+		return nil
+	}
+
+	deviceType, ok := v.deviceType(ctx, piID, deviceID)
+	if !ok {
+		return nil
+	}
+	schema, ok := active[deviceType]
+	if !ok {
+		return nil
+	}
+
+	result := &Result{
+		DeviceType:    deviceType,
+		SchemaVersion: schema.version,
+		Enforcement:   schema.enforcement,
+		Violations:    schema.schema.Validate(payload),
+	}
+
+	switch {
+	case result.Rejected():
+		payloadValidationsTotal.WithLabelValues(outcomeReject).Inc()
+	case result.Flagged():
+		payloadValidationsTotal.WithLabelValues(outcomeFlag).Inc()
+	default:
+		payloadValidationsTotal.WithLabelValues(outcomePass).Inc()
+	}
+	return result
+}
+
+// activeSchemas returns the cached active schemas, reloading them once stale.
+// While one request reloads, others keep using the stale set.
+func (v *Validator) activeSchemas(ctx context.Context) map[string]*activeSchema {
+	v.mu.Lock()
+	if v.active != nil && (time.Since(v.loadedAt) < v.ttl || v.refreshing) {
+		active := v.active
+		v.mu.Unlock()
+		return active
+	}
+	v.refreshing = true
+	generation := v.generation
+	v.mu.Unlock()
+
+	schemas, err := v.schemaRepo.ListActiveSchemas(ctx)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refreshing = false
+
+	if err != nil {
+		v.logger.Logger.Warn().Err(err).Msg("Failed to load payload schemas; payloads are not validated")
+		return v.active
+	}
+
+	active := make(map[string]*activeSchema, len(schemas))
+	compiled := make(map[schemaKey]*Schema, len(schemas))
+	for _, s := range schemas {
+		key := schemaKey{deviceType: s.DeviceType, version: s.Version}
+		schema, ok := v.compiled[key]
+		if !ok {
+			// Schemas are compiled before they are stored, so this only fails
+			// for rows edited outside the API
+			if schema, err = Compile(s.Schema); err != nil {
+				v.logger.Logger.Error().Err(err).Str("device_type", s.DeviceType).Int("version", s.Version).Msg("Skipping payload schema that does not compile")
+				continue
+			}
+		}
+		compiled[key] = schema
+		active[s.DeviceType] = &activeSchema{version: s.Version, enforcement: s.Enforcement, schema: schema}
+	}
+
+	// A schema changed during the load; use the result once but reload next time
+	if generation == v.generation {
+		v.loadedAt = time.Now()
+	}
+	v.active = active
+	v.compiled = compiled
+	return active
+}
+
+// deviceType returns the device's type, or false when the device doesn't exist
+// or can't be looked up
+func (v *Validator) deviceType(ctx context.Context, piID string, deviceID int) (string, bool) {
+	key := deviceKey{piID: piID, deviceID: deviceID}
+
+	v.mu.Lock()
+	entry, ok := v.deviceTypes[key]
+	v.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < v.ttl {
+		return entry.deviceType, true
+	}
+
+	device, err := v.deviceRepo.GetDevice(ctx, piID, deviceID)
+	if err != nil || device == nil {
+		return "", false
+	}
+
+	v.mu.Lock()
+	if len(v.deviceTypes) >= maxCachedDevices {
+		v.deviceTypes = make(map[deviceKey]deviceTypeEntry)
+	}
+	v.deviceTypes[key] = deviceTypeEntry{deviceType: device.DeviceType, loadedAt: time.Now()}
+	v.mu.Unlock()
+
+	return device.DeviceType, true
+}
+
+// RecordViolation stores a flagged reading's violations. The reading is already
+// stored, so a failure is only logged.
+func (v *Validator) RecordViolation(ctx context.Context, reading hardware_models.Reading, result *Result) {
+	err := v.schemaRepo.RecordViolation(ctx, hardware_models.PayloadSchemaViolation{
+		PiID:          reading.PiID,
+		DeviceID:      reading.DeviceID,
+		Ts:            reading.Ts,
+		DeviceType:    result.DeviceType,
+		SchemaVersion: result.SchemaVersion,
+		Violations:    result.Violations,
+	})
+	if err != nil {
+		v.logger.Logger.Error().Err(err).Str("pi_id", reading.PiID).Int("device_id", reading.DeviceID).Msg("Failed to record payload schema violation")
+	}
+}
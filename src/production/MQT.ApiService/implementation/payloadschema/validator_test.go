@@ -0,0 +1,70 @@
+package payloadschema
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// countingDeviceRepo serves every device as a "sensor", counting lookups
+type countingDeviceRepo struct {
+	interfaces.DeviceRepository
+	lookups map[deviceKey]int
+}
+
+func (r *countingDeviceRepo) GetDevice(_ context.Context, piID string, deviceID int) (*hardware_models.Device, error) {
+	r.lookups[deviceKey{piID: piID, deviceID: deviceID}]++
+	return &hardware_models.Device{PiID: piID, DeviceID: deviceID, DeviceType: "sensor"}, nil
+}
+
+func TestInvalidateDevice(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		name       string
+		deviceID   *int
+		reloaded   []deviceKey
+		stillCache []deviceKey
+	}{
+		{
+			name:       "one device",
+			deviceID:   &zero,
+			reloaded:   []deviceKey{{"pi-1", 0}},
+			stillCache: []deviceKey{{"pi-1", 1}, {"pi-2", 0}},
+		},
+		{
+			name:       "whole pi",
+			reloaded:   []deviceKey{{"pi-1", 0}, {"pi-1", 1}},
+			stillCache: []deviceKey{{"pi-2", 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &countingDeviceRepo{lookups: make(map[deviceKey]int)}
+			v := NewValidator(nil, repo, time.Hour, nil)
+			ctx := context.Background()
+			keys := []deviceKey{{"pi-1", 0}, {"pi-1", 1}, {"pi-2", 0}}
+			for _, key := range keys {
+				v.deviceType(ctx, key.piID, key.deviceID)
+			}
+
+			v.InvalidateDevice("pi-1", tt.deviceID)
+			for _, key := range keys {
+				v.deviceType(ctx, key.piID, key.deviceID)
+			}
+
+			for _, key := range tt.reloaded {
+				if got := repo.lookups[key]; got != 2 {
+					t.Errorf("%v looked up %d times, want 2", key, got)
+				}
+			}
+			for _, key := range tt.stillCache {
+				if got := repo.lookups[key]; got != 1 {
+					t.Errorf("%v looked up %d times, want 1", key, got)
+				}
+			}
+		})
+	}
+}
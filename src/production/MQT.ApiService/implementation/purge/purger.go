@@ -0,0 +1,206 @@
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// ErrJobNotFound is returned for purge jobs that don't exist
+var ErrJobNotFound = errors.New("purge job not found")
+
+// errCancelled stops a chunked delete once cancellation has been requested
+var errCancelled = errors.New("purge cancelled")
+
+// Request is one device's readings to delete, in the half-open range [From, To)
+type Request struct {
+	PiID     string
+	DeviceID int
+	From     time.Time
+	To       time.Time
+}
+
+// Result is the outcome of Purge: the count deleted on the synchronous path,
+// or the job started for a large range
+type Result struct {
+	Deleted int64
+	Job     *interfaces.PurgeJob
+}
+
+// Purger deletes reading ranges. Small ranges are deleted in one statement;
+// ranges with more than the threshold are deleted by a background job in
+// bounded chunks with pauses between them, so a multi-month purge doesn't hold
+// locks on the readings table or write a burst of WAL. Jobs run on the replica
+// that started them and can be cancelled from any replica.
+type Purger struct {
+	cfg         config.PurgeConfig
+	readingRepo interfaces.ReadingRepository
+	jobRepo     interfaces.PurgeJobRepository
+	logger      *logger.Logger
+
+	ctx    context.Context // cancelled by Stop
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPurger creates a purger
+func NewPurger(cfg config.PurgeConfig, readingRepo interfaces.ReadingRepository, jobRepo interfaces.PurgeJobRepository, logger *logger.Logger) *Purger {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Purger{
+		cfg:         cfg,
+		readingRepo: readingRepo,
+		jobRepo:     jobRepo,
+		logger:      logger,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Purge deletes the requested range, synchronously when it holds at most the
+// async threshold of readings and otherwise by starting a job
+func (p *Purger) Purge(ctx context.Context, req Request, requestedBy string) (*Result, error) {
+	// Counting stops just past the threshold, so estimating a huge range is cheap
+	estimate, err := p.readingRepo.CountReadingsByTimeRange(ctx, req.PiID, req.DeviceID, req.From, req.To, p.cfg.AsyncThreshold+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if estimate <= p.cfg.AsyncThreshold {
+		deleted, err := p.readingRepo.DeleteReadingsByTimeRange(ctx, req.PiID, req.DeviceID, req.From, req.To)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Deleted: deleted}, nil
+	}
+
+	// The bounded count only says the range is large; count it fully so the job
+	// can report progress against it
+	estimate, err = p.readingRepo.CountReadingsByTimeRange(ctx, req.PiID, req.DeviceID, req.From, req.To, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &interfaces.PurgeJob{
+		PiID:          req.PiID,
+		DeviceID:      req.DeviceID,
+		From:          req.From,
+		To:            req.To,
+		EstimatedRows: estimate,
+		RequestedBy:   requestedBy,
+	}
+	if err := p.jobRepo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run(job)
+	}()
+
+	return &Result{Job: job}, nil
+}
+
+// run deletes a job's range chunk by chunk and records how it ended
+func (p *Purger) run(job *interfaces.PurgeJob) {
+	log := p.logger.Logger.With().Int64("purge_id", job.PurgeID).Str("pi_id", job.PiID).Int("device_id", job.DeviceID).Logger()
+	log.Info().Int64("estimated_rows", job.EstimatedRows).Msg("Purge job started")
+
+	deleted, err := p.readingRepo.DeleteReadingsInChunks(p.ctx, job.PiID, job.DeviceID, job.From, job.To, p.cfg.ChunkSize, func(chunk int64) error {
+		cancelRequested, err := p.jobRepo.RecordChunk(p.ctx, job.PurgeID, chunk)
+		if err != nil {
+			return fmt.Errorf("record progress: %w", err)
+		}
+		if cancelRequested {
+			return errCancelled
+		}
+		return p.pause()
+	})
+
+	status, errMsg := interfaces.PurgeStatusCompleted, ""
+	switch {
+	case errors.Is(err, errCancelled):
+		status = interfaces.PurgeStatusCancelled
+	case p.ctx.Err() != nil:
+		status, errMsg = interfaces.PurgeStatusFailed, "interrupted by shutdown; submit the purge again to finish it"
+	case err != nil:
+		status, errMsg = interfaces.PurgeStatusFailed, err.Error()
+	}
+
+	// The job's context may be gone by now; recording the outcome gets its own
+	finishCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.jobRepo.Finish(finishCtx, job.PurgeID, status, errMsg); err != nil {
+		log.Error().Err(err).Str("status", status).Msg("Failed to record purge job outcome")
+	}
+
+	event := log.Info()
+	if status == interfaces.PurgeStatusFailed {
+		event = log.Warn().Str("error", errMsg)
+	}
+	event.Str("status", status).Int64("deleted_rows", deleted).Msg("Purge job finished")
+}
+
+// pause waits between chunks so other queries and replication can catch up
+func (p *Purger) pause() error {
+	if p.cfg.ChunkPause <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(p.cfg.ChunkPause)
+	defer timer.Stop()
+	select {
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Get returns a job
+func (p *Purger) Get(ctx context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	job, err := p.jobRepo.Get(ctx, purgeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+// List returns the most recent jobs, newest first
+func (p *Purger) List(ctx context.Context, limit int) ([]interfaces.PurgeJob, error) {
+	return p.jobRepo.List(ctx, limit)
+}
+
+// Cancel asks a running job to stop after its current chunk. Readings already
+// deleted stay deleted.
+func (p *Purger) Cancel(ctx context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	job, err := p.jobRepo.RequestCancel(ctx, purgeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+// Stop interrupts running jobs and waits for them to record their outcome, or
+// for ctx to end
+func (p *Purger) Stop(ctx context.Context) error {
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
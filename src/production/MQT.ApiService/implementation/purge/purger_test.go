@@ -0,0 +1,258 @@
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+	memory "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Memory"
+)
+
+// fakeJobRepo keeps purge jobs in memory, records every chunk reported, and
+// asks the job to cancel once cancelAfter chunks have been recorded
+type fakeJobRepo struct {
+	mu          sync.Mutex
+	jobs        map[int64]*interfaces.PurgeJob
+	chunks      []int64
+	cancelAfter int
+	finished    chan struct{}
+}
+
+func newFakeJobRepo() *fakeJobRepo {
+	return &fakeJobRepo{jobs: map[int64]*interfaces.PurgeJob{}, finished: make(chan struct{})}
+}
+
+func (r *fakeJobRepo) Create(_ context.Context, job *interfaces.PurgeJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.PurgeID = int64(len(r.jobs) + 1)
+	job.Status = interfaces.PurgeStatusRunning
+	stored := *job
+	r.jobs[job.PurgeID] = &stored
+	return nil
+}
+
+func (r *fakeJobRepo) Get(_ context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[purgeID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (r *fakeJobRepo) List(_ context.Context, _ int) ([]interfaces.PurgeJob, error) {
+	return nil, nil
+}
+
+func (r *fakeJobRepo) RecordChunk(_ context.Context, purgeID int64, deleted int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.jobs[purgeID]
+	job.DeletedRows += deleted
+	job.Chunks++
+	r.chunks = append(r.chunks, deleted)
+	if r.cancelAfter > 0 && job.Chunks >= r.cancelAfter {
+		job.CancelRequested = true
+	}
+	return job.CancelRequested, nil
+}
+
+func (r *fakeJobRepo) RequestCancel(ctx context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	r.mu.Lock()
+	if job, ok := r.jobs[purgeID]; ok && job.Status == interfaces.PurgeStatusRunning {
+		job.CancelRequested = true
+	}
+	r.mu.Unlock()
+	return r.Get(ctx, purgeID)
+}
+
+func (r *fakeJobRepo) Finish(_ context.Context, purgeID int64, status, errMsg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.jobs[purgeID]
+	job.Status, job.Error = status, errMsg
+	close(r.finished)
+	return nil
+}
+
+// wait returns the job once it has finished
+func (r *fakeJobRepo) wait(t *testing.T, purgeID int64) *interfaces.PurgeJob {
+	t.Helper()
+	select {
+	case <-r.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("purge job never finished")
+	}
+	job, _ := r.Get(context.Background(), purgeID)
+	return job
+}
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at is base plus n minutes
+func at(n int) time.Time {
+	return base.Add(time.Duration(n) * time.Minute)
+}
+
+// newTestPurger returns a purger over a memory store where devices 1 and 2 of
+// pi-1 each have readings at minutes 0 to 11. With an AsyncThreshold below 8,
+// purging device 1 over [at(2), at(10)) starts a job.
+func newTestPurger(t *testing.T, cfg config.PurgeConfig, jobs *fakeJobRepo) (*Purger, *memory.ReadingRepository) {
+	t.Helper()
+	store := memory.NewStore()
+	readings := memory.NewReadingRepository(store)
+	ctx := context.Background()
+	if err := memory.NewPiRepository(store).CreateOrUpdatePi(ctx, hardware_models.Pi{PiID: "pi-1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateOrUpdatePi: %v", err)
+	}
+	for _, deviceID := range []int{1, 2} {
+		if err := memory.NewDeviceRepository(store).CreateOrUpdateDevice(ctx, hardware_models.Device{PiID: "pi-1", DeviceID: deviceID, DeviceType: "sensor", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateOrUpdateDevice: %v", err)
+		}
+		for n := 0; n < 12; n++ {
+			if err := readings.CreateReading(ctx, hardware_models.Reading{PiID: "pi-1", DeviceID: deviceID, Ts: at(n), Payload: map[string]interface{}{"t": n}}); err != nil {
+				t.Fatalf("CreateReading: %v", err)
+			}
+		}
+	}
+	nop := zerolog.Nop()
+	return NewPurger(cfg, readings, jobs, &logger.Logger{Logger: &nop}), readings
+}
+
+// minutesLeft returns the minutes of a device's readings still stored, oldest first
+func minutesLeft(t *testing.T, readings *memory.ReadingRepository, deviceID int) []int {
+	t.Helper()
+	result, err := readings.GetReadingsByDevice(context.Background(), interfaces.ReadingQueryParams{PiID: "pi-1", DeviceID: &deviceID, Limit: 100, Page: 1})
+	if err != nil {
+		t.Fatalf("GetReadingsByDevice: %v", err)
+	}
+	minutes := []int{}
+	for _, reading := range result.Items {
+		minutes = append(minutes, int(reading.Ts.Sub(base)/time.Minute))
+	}
+	sort.Ints(minutes)
+	return minutes
+}
+
+func purgeDevice1(t *testing.T, p *Purger) *interfaces.PurgeJob {
+	t.Helper()
+	result, err := p.Purge(context.Background(), Request{PiID: "pi-1", DeviceID: 1, From: at(2), To: at(10)}, "admin")
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Job == nil {
+		t.Fatalf("deleted %d synchronously, want a job", result.Deleted)
+	}
+	return result.Job
+}
+
+// Whatever the chunk size, a job deletes each of the 8 readings in the range
+// exactly once: none skipped where one chunk ends and the next begins, none
+// counted twice, and nothing outside the range or of another device touched
+func TestPurgeChunkEdges(t *testing.T) {
+	for _, chunkSize := range []int{1, 2, 3, 4, 5, 7, 8, 9, 100} {
+		t.Run("chunk size "+strconv.Itoa(chunkSize), func(t *testing.T) {
+			jobs := newFakeJobRepo()
+			p, readings := newTestPurger(t, config.PurgeConfig{AsyncThreshold: 1, ChunkSize: chunkSize}, jobs)
+
+			job := jobs.wait(t, purgeDevice1(t, p).PurgeID)
+			if job.Status != interfaces.PurgeStatusCompleted || job.Error != "" {
+				t.Fatalf("job %s: %s", job.Status, job.Error)
+			}
+			if job.EstimatedRows != 8 || job.DeletedRows != 8 {
+				t.Errorf("deleted %d of an estimated %d, want 8 of 8", job.DeletedRows, job.EstimatedRows)
+			}
+
+			// Every chunk is full but the last, which is short or, after a
+			// full one, empty
+			var want []int64
+			for left := int64(8); ; left -= int64(chunkSize) {
+				if left < int64(chunkSize) {
+					want = append(want, left)
+					break
+				}
+				want = append(want, int64(chunkSize))
+			}
+			if !reflect.DeepEqual(jobs.chunks, want) || job.Chunks != len(want) {
+				t.Errorf("chunks %v (%d recorded), want %v", jobs.chunks, job.Chunks, want)
+			}
+
+			if got, want := minutesLeft(t, readings, 1), []int{0, 1, 10, 11}; !reflect.DeepEqual(got, want) {
+				t.Errorf("device 1 left with %v, want %v", got, want)
+			}
+			if got := minutesLeft(t, readings, 2); len(got) != 12 {
+				t.Errorf("device 2 left with %v, want all 12", got)
+			}
+		})
+	}
+}
+
+// A job asked to cancel stops after the chunk in progress; the oldest chunks
+// stay deleted and the rest of the range is kept
+func TestPurgeCancel(t *testing.T) {
+	jobs := newFakeJobRepo()
+	jobs.cancelAfter = 2
+	p, readings := newTestPurger(t, config.PurgeConfig{AsyncThreshold: 1, ChunkSize: 3}, jobs)
+
+	job := jobs.wait(t, purgeDevice1(t, p).PurgeID)
+	if job.Status != interfaces.PurgeStatusCancelled || job.Error != "" {
+		t.Errorf("job %s: %q, want cancelled", job.Status, job.Error)
+	}
+	if job.DeletedRows != 6 || job.Chunks != 2 {
+		t.Errorf("deleted %d in %d chunks, want 6 in 2", job.DeletedRows, job.Chunks)
+	}
+	if got, want := minutesLeft(t, readings, 1), []int{0, 1, 8, 9, 10, 11}; !reflect.DeepEqual(got, want) {
+		t.Errorf("device 1 left with %v, want %v", got, want)
+	}
+}
+
+// Stop interrupts a job pausing between chunks, which is recorded as failed
+// so the purge can be submitted again
+func TestPurgeStop(t *testing.T) {
+	jobs := newFakeJobRepo()
+	p, readings := newTestPurger(t, config.PurgeConfig{AsyncThreshold: 1, ChunkSize: 3, ChunkPause: time.Hour}, jobs)
+	job := purgeDevice1(t, p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	job = jobs.wait(t, job.PurgeID)
+	if job.Status != interfaces.PurgeStatusFailed || job.Error == "" {
+		t.Errorf("job %s: %q, want failed with a reason", job.Status, job.Error)
+	}
+	if got := minutesLeft(t, readings, 1); len(got) != 12-int(job.DeletedRows) {
+		t.Errorf("device 1 left with %v after %d deleted", got, job.DeletedRows)
+	}
+}
+
+// Ranges up to the threshold are deleted before Purge returns, without a job
+func TestPurgeSynchronous(t *testing.T) {
+	jobs := newFakeJobRepo()
+	p, readings := newTestPurger(t, config.PurgeConfig{AsyncThreshold: 8, ChunkSize: 3}, jobs)
+
+	result, err := p.Purge(context.Background(), Request{PiID: "pi-1", DeviceID: 1, From: at(2), To: at(10)}, "admin")
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Job != nil || result.Deleted != 8 {
+		t.Errorf("deleted %d with job %v, want 8 without a job", result.Deleted, result.Job)
+	}
+	if got, want := minutesLeft(t, readings, 1), []int{0, 1, 10, 11}; !reflect.DeepEqual(got, want) {
+		t.Errorf("device 1 left with %v, want %v", got, want)
+	}
+}
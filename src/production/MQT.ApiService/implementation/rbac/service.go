@@ -1,7 +1,19 @@
 package rbac
 
-// Service provides RBAC operations
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Service provides RBAC operations. Roles are read on every request and can be
+// changed at runtime, so the map is guarded by a RWMutex.
 type Service struct {
+	mu    sync.RWMutex
 	roles map[string]bool
 }
 
@@ -17,6 +29,8 @@ func NewService() *Service {
 
 // IsValidRole checks if a role is valid
 func (s *Service) IsValidRole(roleName string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.roles[roleName]
 }
 
@@ -32,14 +46,83 @@ func (s *Service) IsUser(roleName string) bool {
 
 // AddRole adds a new role
 func (s *Service) AddRole(roleName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.roles[roleName] = true
 }
 
-// GetValidRoles returns all valid roles
+// RemoveRole removes a role. Users holding it stop passing IsValidRole checks.
+func (s *Service) RemoveRole(roleName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.roles, roleName)
+}
+
+// ReplaceAll swaps the whole role set for roleNames
+func (s *Service) ReplaceAll(roleNames []string) {
+	roles := make(map[string]bool, len(roleNames))
+	for _, roleName := range roleNames {
+		roles[roleName] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles = roles
+}
+
+// GetValidRoles returns all valid roles, sorted
 func (s *Service) GetValidRoles() []string {
-	var roles []string
+	s.mu.RLock()
+	roles := make([]string, 0, len(s.roles))
 	for role := range s.roles {
 		roles = append(roles, role)
 	}
+	s.mu.RUnlock()
+
+	sort.Strings(roles)
 	return roles
 }
+
+// ReloadFromRepository replaces the role set with the roles stored in the
+// database, picking up changes made by other replicas. An empty result is
+// ignored so a truncated table can't lock everyone out.
+func (s *Service) ReloadFromRepository(ctx context.Context, roleRepo interfaces.RoleRepository) error {
+	roles, err := roleRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+	}
+	s.ReplaceAll(roleNames)
+	return nil
+}
+
+// RunReload calls ReloadFromRepository every interval until ctx is cancelled.
+// Failures are logged and the current role set is kept.
+func (s *Service) RunReload(ctx context.Context, roleRepo interfaces.RoleRepository, interval time.Duration, log *logger.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := s.ReloadFromRepository(reloadCtx, roleRepo); err != nil {
+				log.Logger.Warn().Err(err).Msg("Failed to reload roles")
+			}
+			cancel()
+		}
+	}
+}
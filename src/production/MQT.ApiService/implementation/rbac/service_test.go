@@ -0,0 +1,120 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// stubRoleRepo returns each of its role sets in turn. Calls it doesn't
+// implement panic.
+type stubRoleRepo struct {
+	interfaces.RoleRepository
+	sets  [][]string
+	calls atomic.Int64
+	err   error
+}
+
+func (r *stubRoleRepo) FindAll(_ context.Context) ([]*auth_models.Role, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	names := r.sets[int(r.calls.Add(1)-1)%len(r.sets)]
+	roles := make([]*auth_models.Role, 0, len(names))
+	for _, name := range names {
+		roles = append(roles, auth_models.NewRole(name, ""))
+	}
+	return roles, nil
+}
+
+// Requests check roles while the reload loop replaces them. Run with -race:
+// readers must never see a half-replaced set, and the roles present in every
+// set must stay valid throughout.
+func TestConcurrentReadsAndReloads(t *testing.T) {
+	s := NewService()
+	repo := &stubRoleRepo{sets: [][]string{
+		{"admin", "user"},
+		{"admin", "user", "operator"},
+		{"admin", "user", "auditor", "operator"},
+	}}
+
+	const readers, reloads = 8, 500
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	failures := make(chan string, readers)
+	for n := 0; n < readers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !s.IsValidRole("admin") || !s.IsValidRole("user") {
+					failures <- "admin or user missing during a reload"
+					return
+				}
+				roles := s.GetValidRoles()
+				if !sort.StringsAreSorted(roles) || len(roles) < 2 {
+					failures <- "GetValidRoles returned a partial or unsorted set"
+					return
+				}
+			}
+		}()
+	}
+
+	for n := 0; n < reloads; n++ {
+		if err := s.ReloadFromRepository(context.Background(), repo); err != nil {
+			t.Fatalf("ReloadFromRepository: %v", err)
+		}
+		if n%50 == 0 {
+			s.AddRole("temporary")
+			s.RemoveRole("temporary")
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(failures)
+	for failure := range failures {
+		t.Error(failure)
+	}
+}
+
+// A reload that fails or finds no roles keeps the current set
+func TestReloadKeepsRolesOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		repo *stubRoleRepo
+		want []string
+	}{
+		{name: "replaced", repo: &stubRoleRepo{sets: [][]string{{"admin", "operator"}}}, want: []string{"admin", "operator"}},
+		{name: "empty table", repo: &stubRoleRepo{sets: [][]string{{}}}, want: []string{"admin", "user"}},
+		{name: "error", repo: &stubRoleRepo{err: errors.New("connection refused")}, want: []string{"admin", "user"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService()
+			err := s.ReloadFromRepository(context.Background(), tt.repo)
+			if (err != nil) != (tt.repo.err != nil) {
+				t.Errorf("ReloadFromRepository() error = %v, want %v", err, tt.repo.err)
+			}
+			got := s.GetValidRoles()
+			if len(got) != len(tt.want) {
+				t.Fatalf("roles %v, want %v", got, tt.want)
+			}
+			for n := range got {
+				if got[n] != tt.want[n] {
+					t.Fatalf("roles %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package seed
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// deviceTypes are assigned to a Pi's devices in turn
+var deviceTypes = []string{"temperature", "humidity"}
+
+// generator makes plausible reading payloads. It is seeded from the seed name,
+// so the same name always produces the same data.
+type generator struct {
+	rng *rand.Rand
+}
+
+func newGenerator(name string) *generator {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	sum := h.Sum64()
+	return &generator{rng: rand.New(rand.NewPCG(sum, sum>>1|1))}
+}
+
+// series is one device's sequence of payloads
+type series interface {
+	next(ts time.Time) map[string]interface{}
+}
+
+// series returns the payload sequence for device, with its own offsets so
+// devices of the same type don't move in lockstep
+func (g *generator) series(device hardware_models.Device) series {
+	if device.DeviceType == "humidity" {
+		return &humiditySeries{rng: g.rng, value: 40 + g.rng.Float64()*20}
+	}
+	return &temperatureSeries{
+		rng:   g.rng,
+		base:  18 + g.rng.Float64()*6,
+		phase: g.rng.Float64() * 2 * math.Pi,
+	}
+}
+
+// temperatureSeries follows a daily sine wave of ±4°C around its base, with noise
+type temperatureSeries struct {
+	rng   *rand.Rand
+	base  float64
+	phase float64
+}
+
+func (s *temperatureSeries) next(ts time.Time) map[string]interface{} {
+	day := float64(ts.Unix()%86400) / 86400
+	value := s.base + 4*math.Sin(2*math.Pi*day+s.phase) + s.rng.NormFloat64()*0.3
+	return map[string]interface{}{"temperature": round(value, 2)}
+}
+
+// humiditySeries is a random walk kept between 20% and 90%
+type humiditySeries struct {
+	rng   *rand.Rand
+	value float64
+}
+
+func (s *humiditySeries) next(time.Time) map[string]interface{} {
+	s.value = math.Min(90, math.Max(20, s.value+s.rng.NormFloat64()*0.8))
+	return map[string]interface{}{"humidity": round(s.value, 1)}
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,337 @@
+package seed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+var (
+	// ErrNotAllowed is returned when SEED_ALLOWED is not set
+	ErrNotAllowed = errors.New("seeding is disabled; set SEED_ALLOWED=true to enable it")
+
+	// ErrDatabaseNotEmpty is returned when the database holds more rows than
+	// SEED_MAX_EXISTING_ROWS and the request doesn't force the seed
+	ErrDatabaseNotEmpty = errors.New("database already holds data")
+
+	// ErrRunning is returned while another seed of the same name is running
+	ErrRunning = errors.New("a seed with this name is already running")
+)
+
+// Limits on a single seed, so a typo can't ask for billions of readings
+const (
+	MaxUsers        = 50
+	MaxPisPerUser   = 20
+	MaxDevicesPerPi = 20
+	MaxWindow       = 31 * 24 * time.Hour
+	MinInterval     = 10 * time.Second
+	MaxReadings     = 2000000
+
+	// readingChunk matches the batch size the internal API accepts
+	readingChunk = 5000
+)
+
+// namePattern keeps seed names usable inside pi IDs and usernames
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Request describes the data to generate. Zero values take the defaults from
+// Normalize. Readings cover [now-Window, now) at Interval for every device.
+type Request struct {
+	Name         string
+	Users        int
+	PisPerUser   int
+	DevicesPerPi int
+	Window       time.Duration
+	Interval     time.Duration
+	Password     string // for every seeded user; generated when empty
+	Force        bool   // seed even when the database already holds data
+}
+
+// Normalize fills in defaults and checks the request against the limits
+func (r *Request) Normalize() error {
+	if !namePattern.MatchString(r.Name) {
+		return fmt.Errorf("name must be 1-32 lowercase letters, digits or dashes")
+	}
+	if r.Users == 0 {
+		r.Users = 2
+	}
+	if r.PisPerUser == 0 {
+		r.PisPerUser = 2
+	}
+	if r.DevicesPerPi == 0 {
+		r.DevicesPerPi = 2
+	}
+	if r.Window == 0 {
+		r.Window = 72 * time.Hour
+	}
+	if r.Interval == 0 {
+		r.Interval = 5 * time.Minute
+	}
+
+	switch {
+	case r.Users < 1 || r.Users > MaxUsers:
+		return fmt.Errorf("users must be between 1 and %d", MaxUsers)
+	case r.PisPerUser < 1 || r.PisPerUser > MaxPisPerUser:
+		return fmt.Errorf("pis_per_user must be between 1 and %d", MaxPisPerUser)
+	case r.DevicesPerPi < 1 || r.DevicesPerPi > MaxDevicesPerPi:
+		return fmt.Errorf("devices_per_pi must be between 1 and %d", MaxDevicesPerPi)
+	case r.Window < 0 || r.Window > MaxWindow:
+		return fmt.Errorf("window must be positive and at most %s", MaxWindow)
+	case r.Interval < MinInterval:
+		return fmt.Errorf("interval must be at least %s", MinInterval)
+	case r.Password != "" && len(r.Password) < 8:
+		return fmt.Errorf("password must be at least 8 characters")
+	}
+	if readings := r.readingsPerDevice() * int64(r.Users*r.PisPerUser*r.DevicesPerPi); readings > MaxReadings {
+		return fmt.Errorf("seed would create %d readings; at most %d are allowed", readings, MaxReadings)
+	}
+	return nil
+}
+
+func (r *Request) readingsPerDevice() int64 {
+	return int64(r.Window / r.Interval)
+}
+
+// SeededUser is a user created by a seed
+type SeededUser struct {
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username"`
+	PiIDs    []string `json:"pi_ids"`
+}
+
+// Summary reports what a seed created. Password is only set on the run that
+// generated it and is not stored.
+type Summary struct {
+	Name             string       `json:"name"`
+	Users            []SeededUser `json:"users"`
+	Password         string       `json:"password,omitempty"`
+	Pis              int          `json:"pis"`
+	Devices          int          `json:"devices"`
+	Readings         int          `json:"readings"`
+	ReadingsRejected int          `json:"readings_rejected,omitempty"`
+	From             time.Time    `json:"from"`
+	To               time.Time    `json:"to"`
+}
+
+// Result is the outcome of Seed. Existing is set instead of Summary when a
+// seed of that name had already completed and nothing was done.
+type Result struct {
+	Summary  *Summary
+	Existing *interfaces.SeedRun
+}
+
+// Seeder populates an environment with demo users, pis, devices and readings.
+// Seeds are named; each name runs at most once, across replicas, and the
+// generated data is deterministic for a name.
+type Seeder struct {
+	cfg         config.SeedConfig
+	userRepo    interfaces.UserRepository
+	piRepo      interfaces.PiRepository
+	deviceRepo  interfaces.DeviceRepository
+	readingRepo interfaces.ReadingRepository
+	seedRepo    interfaces.SeedRunRepository
+	hasher      *password.Hasher
+	logger      *logger.Logger
+}
+
+// NewSeeder creates a seeder
+func NewSeeder(cfg config.SeedConfig, userRepo interfaces.UserRepository, piRepo interfaces.PiRepository, deviceRepo interfaces.DeviceRepository, readingRepo interfaces.ReadingRepository, seedRepo interfaces.SeedRunRepository, hasher *password.Hasher, logger *logger.Logger) *Seeder {
+	return &Seeder{
+		cfg:         cfg,
+		userRepo:    userRepo,
+		piRepo:      piRepo,
+		deviceRepo:  deviceRepo,
+		readingRepo: readingRepo,
+		seedRepo:    seedRepo,
+		hasher:      hasher,
+		logger:      logger,
+	}
+}
+
+// Seed runs req, which must have been normalized. Guards are checked in order:
+// seeding must be allowed, the name must not have run, and the database must
+// be nearly empty unless req.Force is set. A failed seed is released so it can
+// be run again; everything it writes is an upsert or reported as a duplicate,
+// so a re-run completes what the failed one started.
+func (s *Seeder) Seed(ctx context.Context, req Request, requestedBy string) (*Result, error) {
+	if !s.cfg.Allowed {
+		return nil, ErrNotAllowed
+	}
+
+	claimed, existing, err := s.seedRepo.Claim(ctx, req.Name, requestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("claim seed: %w", err)
+	}
+	if !claimed {
+		if existing.Status == interfaces.SeedStatusRunning {
+			return nil, ErrRunning
+		}
+		return &Result{Existing: existing}, nil
+	}
+
+	summary, err := s.run(ctx, req)
+	if err != nil {
+		if releaseErr := s.seedRepo.Release(context.WithoutCancel(ctx), req.Name); releaseErr != nil {
+			s.logger.Logger.Error().Err(releaseErr).Str("seed", req.Name).Msg("Failed to release seed")
+		}
+		return nil, err
+	}
+
+	stored := *summary
+	stored.Password = ""
+	summaryJSON, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("marshal summary: %w", err)
+	}
+	if err := s.seedRepo.Complete(ctx, req.Name, summaryJSON); err != nil {
+		return nil, fmt.Errorf("complete seed: %w", err)
+	}
+	return &Result{Summary: summary}, nil
+}
+
+// run checks the row guard and generates the data of a claimed seed
+func (s *Seeder) run(ctx context.Context, req Request) (*Summary, error) {
+	if !req.Force {
+		// Counting stops just past the limit, so checking a large database is cheap
+		rows, err := s.seedRepo.CountRows(ctx, s.cfg.MaxExistingRows+1)
+		if err != nil {
+			return nil, fmt.Errorf("count existing rows: %w", err)
+		}
+		if rows > s.cfg.MaxExistingRows {
+			return nil, fmt.Errorf("%w: more than %d rows; pass force=true to seed anyway", ErrDatabaseNotEmpty, s.cfg.MaxExistingRows)
+		}
+	}
+
+	plainPassword := req.Password
+	generated := plainPassword == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("generate password: %w", err)
+		}
+		plainPassword = hex.EncodeToString(buf)
+	}
+	hashed, err := s.hasher.Hash(plainPassword)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	to := time.Now().UTC().Truncate(req.Interval)
+	summary := &Summary{
+		Name:  req.Name,
+		Users: []SeededUser{},
+		From:  to.Add(-time.Duration(req.readingsPerDevice()) * req.Interval),
+		To:    to,
+	}
+	if generated {
+		summary.Password = plainPassword
+	}
+	gen := newGenerator(req.Name)
+
+	for u := 1; u <= req.Users; u++ {
+		user, err := s.seedUser(ctx, req.Name, u, hashed)
+		if err != nil {
+			return nil, err
+		}
+		seeded := SeededUser{UserID: user.UserID, Username: user.Username, PiIDs: []string{}}
+
+		for p := 1; p <= req.PisPerUser; p++ {
+			piID := fmt.Sprintf("seed-%s-u%d-pi%d", req.Name, u, p)
+			pi := hardware_models.Pi{PiID: piID, UserID: user.UserID, CreatedAt: summary.From}
+			if err := s.piRepo.CreateOrUpdatePi(ctx, pi); err != nil {
+				return nil, fmt.Errorf("create pi %s: %w", piID, err)
+			}
+			seeded.PiIDs = append(seeded.PiIDs, piID)
+			summary.Pis++
+
+			for d := 1; d <= req.DevicesPerPi; d++ {
+				device := hardware_models.Device{
+					PiID:       piID,
+					DeviceID:   d,
+					DeviceType: deviceTypes[(d-1)%len(deviceTypes)],
+					Meta:       map[string]interface{}{"seed": req.Name},
+					CreatedAt:  summary.From,
+				}
+				if err := s.deviceRepo.CreateOrUpdateDevice(ctx, device); err != nil {
+					return nil, fmt.Errorf("create device %s/%d: %w", piID, d, err)
+				}
+				summary.Devices++
+
+				inserted, rejected, err := s.seedReadings(ctx, gen, device, summary.From, req)
+				if err != nil {
+					return nil, err
+				}
+				summary.Readings += inserted
+				summary.ReadingsRejected += rejected
+			}
+		}
+		summary.Users = append(summary.Users, seeded)
+	}
+
+	s.logger.Logger.Info().Str("seed", req.Name).Int("users", len(summary.Users)).Int("pis", summary.Pis).
+		Int("devices", summary.Devices).Int("readings", summary.Readings).Msg("Seed completed")
+	return summary, nil
+}
+
+// seedUser creates the u-th user of a seed, or reuses it when a failed run
+// already created it
+func (s *Seeder) seedUser(ctx context.Context, name string, u int, hashedPassword string) (*auth_models.User, error) {
+	username := fmt.Sprintf("seed-%s-user%d", name, u)
+	existing, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("look up user %s: %w", username, err)
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	user := auth_models.NewUser(username, username+"@seed.invalid", hashedPassword, "user")
+	created, err := s.userRepo.Create(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("create user %s: %w", username, err)
+	}
+	return created, nil
+}
+
+// seedReadings writes a device's readings from `from` at req.Interval in
+// chunks, returning how many were inserted and rejected
+func (s *Seeder) seedReadings(ctx context.Context, gen *generator, device hardware_models.Device, from time.Time, req Request) (int, int, error) {
+	total := int(req.readingsPerDevice())
+	payloads := gen.series(device)
+	inserted, rejected := 0, 0
+
+	chunk := make([]hardware_models.Reading, 0, min(total, readingChunk))
+	for n := 0; n < total; n += readingChunk {
+		chunk = chunk[:0]
+		for i := n; i < min(n+readingChunk, total); i++ {
+			ts := from.Add(time.Duration(i) * req.Interval)
+			chunk = append(chunk, hardware_models.Reading{
+				PiID:       device.PiID,
+				DeviceID:   device.DeviceID,
+				Ts:         ts,
+				Payload:    payloads.next(ts),
+				ReceivedAt: &ts,
+			})
+		}
+
+		result, err := s.readingRepo.CreateReadings(ctx, chunk)
+		if err != nil {
+			return inserted, rejected, fmt.Errorf("create readings for %s/%d: %w", device.PiID, device.DeviceID, err)
+		}
+		inserted += result.Inserted
+		rejected += len(result.Failed)
+	}
+	return inserted, rejected, nil
+}
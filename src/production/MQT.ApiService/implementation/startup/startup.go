@@ -0,0 +1,144 @@
+package startup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// Retry backoff for steps that failed at startup
+const (
+	initialRetryDelay = time.Second
+	maxRetryDelay     = time.Minute
+)
+
+// Component states reported on /health/details
+const (
+	StateOK       = "ok"
+	StateDegraded = "degraded"
+)
+
+// ComponentStatus is the state of one retryable startup step
+type ComponentStatus struct {
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tracker runs retryable startup steps. In strict mode a failure is returned to
+// the caller as before. Otherwise the step is marked degraded and retried in the
+// background with exponential backoff until it succeeds or ctx is cancelled.
+type Tracker struct {
+	strict bool
+	logger *logger.Logger
+	ctx    context.Context
+
+	mu         sync.RWMutex
+	components map[string]ComponentStatus
+	wg         sync.WaitGroup
+}
+
+// NewTracker creates a tracker whose background retries stop when ctx is cancelled
+func NewTracker(ctx context.Context, strict bool, logger *logger.Logger) *Tracker {
+	return &Tracker{
+		strict:     strict,
+		logger:     logger,
+		ctx:        ctx,
+		components: make(map[string]ComponentStatus),
+	}
+}
+
+// RunRetryable runs step once. It only returns an error in strict mode; otherwise
+// a failed step keeps retrying in the background and the error is only logged.
+func (t *Tracker) RunRetryable(ctx context.Context, name string, step func(ctx context.Context) error) error {
+	err := step(ctx)
+	t.record(name, err)
+	if err == nil {
+		return nil
+	}
+	if t.strict {
+		return err
+	}
+
+	t.logger.Logger.Warn().Err(err).Str("component", name).Msg("Startup step failed, retrying in the background")
+	t.wg.Add(1)
+	go t.retry(name, step)
+	return nil
+}
+
+// retry re-runs step with exponential backoff until it succeeds or the tracker's
+// context is cancelled
+func (t *Tracker) retry(name string, step func(ctx context.Context) error) {
+	defer t.wg.Done()
+
+	delay := initialRetryDelay
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		err := step(t.ctx)
+		t.record(name, err)
+		if err == nil {
+			t.logger.Logger.Info().Str("component", name).Msg("Startup step succeeded after retry")
+			return
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		t.logger.Logger.Warn().Err(err).Str("component", name).Dur("next_retry", delay).Msg("Startup step retry failed")
+	}
+}
+
+func (t *Tracker) record(name string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.components[name]
+	status.Attempts++
+	status.UpdatedAt = time.Now()
+	if err != nil {
+		status.State = StateDegraded
+		status.LastError = err.Error()
+	} else {
+		status.State = StateOK
+		status.LastError = ""
+	}
+	t.components[name] = status
+}
+
+// Degraded reports whether any startup step is still failing
+func (t *Tracker) Degraded() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, status := range t.components {
+		if status.State != StateOK {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns a copy of every step's state, keyed by name
+func (t *Tracker) Status() map[string]ComponentStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	components := make(map[string]ComponentStatus, len(t.components))
+	for name, status := range t.components {
+		components[name] = status
+	}
+	return components
+}
+
+// Wait blocks until every background retry has returned. Cancel the tracker's
+// context first.
+func (t *Tracker) Wait() {
+	t.wg.Wait()
+}
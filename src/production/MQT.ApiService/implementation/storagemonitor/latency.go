@@ -0,0 +1,172 @@
+package storagemonitor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// maxSamplesPerWindow bounds memory per window; once full, the oldest samples are overwritten
+const maxSamplesPerWindow = 10000
+
+// LatencyStatus is a snapshot of the monitor, reported on /health/details
+type LatencyStatus struct {
+	Enabled            bool      `json:"enabled"`
+	Degraded           bool      `json:"degraded"`
+	BudgetMs           int64     `json:"budget_ms"`
+	LastP95Ms          int64     `json:"last_p95_ms"`
+	ConsecutiveBreach  int       `json:"consecutive_windows_over_budget"`
+	ConsecutiveWindows int       `json:"consecutive_windows_threshold"`
+	LastEvaluatedAt    time.Time `json:"last_evaluated_at,omitempty"`
+}
+
+// LatencyMonitor compares the p95 of reading insert latencies in each window with
+// a budget and flags storage as degraded after enough consecutive windows over it
+type LatencyMonitor struct {
+	cfg    config.StorageMonitorConfig
+	logger *logger.Logger
+
+	mu            sync.Mutex
+	samples       []time.Duration
+	next          int // overwrite position once samples is full
+	consecutive   int
+	degraded      bool
+	lastP95       time.Duration
+	lastEvaluated time.Time
+}
+
+// NewLatencyMonitor creates a latency monitor. A zero budget disables it.
+func NewLatencyMonitor(cfg config.StorageMonitorConfig, logger *logger.Logger) *LatencyMonitor {
+	return &LatencyMonitor{
+		cfg:     cfg,
+		logger:  logger,
+		samples: make([]time.Duration, 0, 64),
+	}
+}
+
+func (m *LatencyMonitor) enabled() bool {
+	return m.cfg.InsertLatencyBudget > 0
+}
+
+// Observe records one insert. Its signature matches the reading repository's
+// InsertObserver. Failed inserts count too, since timeouts are what we want to catch.
+func (m *LatencyMonitor) Observe(operation string, duration time.Duration, err error) {
+	if !m.enabled() {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.samples) < maxSamplesPerWindow {
+		m.samples = append(m.samples, duration)
+		return
+	}
+	m.samples[m.next] = duration
+	m.next = (m.next + 1) % maxSamplesPerWindow
+}
+
+// Evaluate closes the current window. Windows without inserts leave the state unchanged.
+func (m *LatencyMonitor) Evaluate() {
+	if !m.enabled() {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.samples) == 0 {
+		return
+	}
+
+	p95 := percentile(m.samples, 0.95)
+	m.samples = m.samples[:0]
+	m.next = 0
+	m.lastP95 = p95
+	m.lastEvaluated = time.Now().UTC()
+
+	if p95 <= m.cfg.InsertLatencyBudget {
+		m.consecutive = 0
+		if m.degraded {
+			m.degraded = false
+			m.logger.Logger.Info().
+				Str("component", "storage_monitor").
+				Str("event", "storage_recovered").
+				Dur("p95", p95).
+				Dur("budget", m.cfg.InsertLatencyBudget).
+				Msg("Reading insert latency back within budget")
+		}
+		return
+	}
+
+	m.consecutive++
+	if m.consecutive >= m.cfg.ConsecutiveWindows && !m.degraded {
+		m.degraded = true
+		m.logger.Logger.Warn().
+			Str("component", "storage_monitor").
+			Str("event", "storage_degraded").
+			Dur("p95", p95).
+			Dur("budget", m.cfg.InsertLatencyBudget).
+			Int("windows", m.consecutive).
+			Msg("Reading insert latency over budget")
+	}
+}
+
+// Run evaluates a window every cfg.Window until ctx is cancelled
+func (m *LatencyMonitor) Run(ctx context.Context) {
+	if !m.enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(m.cfg.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Evaluate()
+		}
+	}
+}
+
+// Degraded reports whether insert latency is currently over budget
+func (m *LatencyMonitor) Degraded() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.degraded
+}
+
+// Status returns a snapshot of the monitor state
+func (m *LatencyMonitor) Status() LatencyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return LatencyStatus{
+		Enabled:            m.enabled(),
+		Degraded:           m.degraded,
+		BudgetMs:           m.cfg.InsertLatencyBudget.Milliseconds(),
+		LastP95Ms:          m.lastP95.Milliseconds(),
+		ConsecutiveBreach:  m.consecutive,
+		ConsecutiveWindows: m.cfg.ConsecutiveWindows,
+		LastEvaluatedAt:    m.lastEvaluated,
+	}
+}
+
+// percentile returns the nearest-rank percentile of samples, sorting them in place
+func percentile(samples []time.Duration, p float64) time.Duration {
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	rank := int(float64(len(samples))*p+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(samples) {
+		rank = len(samples) - 1
+	}
+	return samples[rank]
+}
@@ -0,0 +1,302 @@
+package storageusage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/notify"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// KindSoftLimit is the notification kind sent when a storage soft limit is crossed
+const KindSoftLimit = "storage_soft_limit"
+
+// Apportion splits totalBytes between Pis in proportion to their row counts.
+// Shares are rounded down and the bytes left over go one each to the largest
+// remainders (ties by Pi ID), so the shares always add up to totalBytes.
+func Apportion(totalBytes int64, rowsByPi map[string]int64) map[string]int64 {
+	shares := make(map[string]int64, len(rowsByPi))
+	var totalRows uint64
+	for piID, rows := range rowsByPi {
+		shares[piID] = 0
+		if rows > 0 {
+			totalRows += uint64(rows)
+		}
+	}
+	if totalRows == 0 || totalBytes <= 0 {
+		return shares
+	}
+
+	type remainder struct {
+		piID string
+		rem  uint64
+	}
+	remainders := make([]remainder, 0, len(rowsByPi))
+	var assigned int64
+	for piID, rows := range rowsByPi {
+		if rows <= 0 {
+			continue
+		}
+		// totalBytes*rows can overflow 64 bits; rows <= totalRows keeps the
+		// quotient in range
+		hi, lo := bits.Mul64(uint64(totalBytes), uint64(rows))
+		quo, rem := bits.Div64(hi, lo, totalRows)
+		shares[piID] = int64(quo)
+		assigned += int64(quo)
+		remainders = append(remainders, remainder{piID: piID, rem: rem})
+	}
+
+	sort.Slice(remainders, func(i, j int) bool {
+		if remainders[i].rem != remainders[j].rem {
+			return remainders[i].rem > remainders[j].rem
+		}
+		return remainders[i].piID < remainders[j].piID
+	})
+	// Fewer bytes are left over than there are Pis with readings
+	for i := 0; assigned < totalBytes; i++ {
+		shares[remainders[i].piID]++
+		assigned++
+	}
+	return shares
+}
+
+// Accountant periodically apportions the readings table's size between Pis
+// and notifies when a Pi or the whole table crosses its soft limit. A crossing
+// is a run at or above the limit following one below it, so each is reported
+// once, across restarts and replicas.
+type Accountant struct {
+	cfg        config.StorageAccountingConfig
+	repo       interfaces.StorageUsageRepository
+	userRepo   interfaces.UserRepository
+	dispatcher *notify.Dispatcher
+	logger     *logger.Logger
+	now        func() time.Time
+}
+
+// NewAccountant creates the storage accounting job. dispatcher may be nil, in
+// which case crossings are only logged.
+func NewAccountant(cfg config.StorageAccountingConfig, repo interfaces.StorageUsageRepository, userRepo interfaces.UserRepository, dispatcher *notify.Dispatcher, logger *logger.Logger) *Accountant {
+	return &Accountant{
+		cfg:        cfg,
+		repo:       repo,
+		userRepo:   userRepo,
+		dispatcher: dispatcher,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// Run calls RunOnce every interval inside the configured window until ctx is
+// cancelled. It returns at once when accounting is disabled. Failures are
+// logged and retried on the next tick.
+func (a *Accountant) Run(ctx context.Context) {
+	if a.cfg.Interval <= 0 {
+		return
+	}
+
+	// Ticks are checked against the window, so don't wait a whole interval
+	// to notice it opening
+	tick := a.cfg.Interval
+	if a.cfg.WindowStart != "" && tick > 5*time.Minute {
+		tick = 5 * time.Minute
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !a.inWindow(a.now()) {
+				continue
+			}
+			if err := a.RunOnce(ctx); err != nil {
+				a.logger.Logger.Warn().Err(err).Msg("Storage accounting failed")
+			}
+		}
+	}
+}
+
+// inWindow reports whether t falls in the configured UTC window. Bounds are
+// validated with the configuration.
+func (a *Accountant) inWindow(t time.Time) bool {
+	if a.cfg.WindowStart == "" {
+		return true
+	}
+	start, _ := time.Parse("15:04", a.cfg.WindowStart)
+	end, _ := time.Parse("15:04", a.cfg.WindowEnd)
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	minute := t.UTC().Hour()*60 + t.UTC().Minute()
+
+	switch {
+	case from == to:
+		return true
+	case from < to:
+		return minute >= from && minute < to
+	default:
+		return minute >= from || minute < to
+	}
+}
+
+// RunOnce measures the readings table, stores each Pi's share and reports
+// soft limit crossings. It does nothing when another replica ran less than
+// half an interval ago.
+func (a *Accountant) RunOnce(ctx context.Context) error {
+	now := a.now().UTC()
+
+	last, err := a.repo.GetTotal(ctx)
+	if err != nil {
+		return err
+	}
+	if last != nil && now.Sub(last.ComputedAt) < a.cfg.Interval/2 {
+		return nil
+	}
+
+	measurement, err := a.repo.MeasureReadings(ctx, a.cfg.StatementTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to measure readings: %w", err)
+	}
+
+	shares := Apportion(measurement.TotalBytes, measurement.RowsByPi)
+	usage := make([]interfaces.PiStorageUsage, 0, len(shares))
+	total := interfaces.StorageTotal{TotalBytes: measurement.TotalBytes, ComputedAt: now}
+	for piID, rows := range measurement.RowsByPi {
+		usage = append(usage, interfaces.PiStorageUsage{
+			PiID:        piID,
+			RowCount:    rows,
+			ApproxBytes: shares[piID],
+			ComputedAt:  now,
+		})
+		total.RowCount += rows
+	}
+
+	previous, previousTotal, err := a.repo.SaveUsage(ctx, usage, total)
+	if err != nil {
+		return fmt.Errorf("failed to save storage usage: %w", err)
+	}
+
+	a.logger.Logger.Info().
+		Int64("total_bytes", total.TotalBytes).
+		Int64("rows", total.RowCount).
+		Int("pis", len(usage)).
+		Dur("duration", time.Since(now)).
+		Msg("Storage accounting complete")
+
+	a.checkLimits(ctx, usage, total, previous, previousTotal)
+	return nil
+}
+
+// crossed reports whether usage went from below limit to at or above it
+func crossed(before, after, limit int64) bool {
+	return limit > 0 && before < limit && after >= limit
+}
+
+func (a *Accountant) checkLimits(ctx context.Context, usage []interfaces.PiStorageUsage, total interfaces.StorageTotal, previous []interfaces.PiStorageUsage, previousTotal *interfaces.StorageTotal) {
+	var before int64
+	if previousTotal != nil {
+		before = previousTotal.TotalBytes
+	}
+	if crossed(before, total.TotalBytes, a.cfg.TotalSoftLimitBytes) {
+		a.alert(ctx, "", notify.Notification{
+			Subject: "Readings storage soft limit reached",
+			Body: fmt.Sprintf("The readings table uses %s, at or above its soft limit of %s.",
+				formatBytes(total.TotalBytes), formatBytes(a.cfg.TotalSoftLimitBytes)),
+			Data: map[string]interface{}{
+				"scope":       "readings",
+				"total_bytes": total.TotalBytes,
+				"limit_bytes": a.cfg.TotalSoftLimitBytes,
+			},
+		})
+	}
+
+	if a.cfg.PiSoftLimitBytes <= 0 {
+		return
+	}
+	previousBytes := make(map[string]int64, len(previous))
+	for _, u := range previous {
+		previousBytes[u.PiID] = u.ApproxBytes
+	}
+	for _, u := range usage {
+		if !crossed(previousBytes[u.PiID], u.ApproxBytes, a.cfg.PiSoftLimitBytes) {
+			continue
+		}
+
+		// The stored row carries the owner; Pis that no longer exist weren't stored
+		stored, err := a.repo.GetPiUsage(ctx, u.PiID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				a.logger.Logger.Warn().Err(err).Str("pi_id", u.PiID).Msg("Failed to look up Pi for storage soft limit")
+			}
+			continue
+		}
+		a.alert(ctx, stored.UserID, notify.Notification{
+			Subject: fmt.Sprintf("Pi %s reached its storage soft limit", u.PiID),
+			Body: fmt.Sprintf("Readings of Pi %s use about %s, at or above the soft limit of %s.",
+				u.PiID, formatBytes(u.ApproxBytes), formatBytes(a.cfg.PiSoftLimitBytes)),
+			Data: map[string]interface{}{
+				"scope":        "pi",
+				"pi_id":        u.PiID,
+				"approx_bytes": u.ApproxBytes,
+				"limit_bytes":  a.cfg.PiSoftLimitBytes,
+			},
+		})
+	}
+}
+
+// alert logs a crossing and notifies every active admin and, when set, the
+// owner
+func (a *Accountant) alert(ctx context.Context, ownerID string, n notify.Notification) {
+	a.logger.Logger.Warn().Interface("details", n.Data).Msg(n.Subject)
+	if a.dispatcher == nil {
+		return
+	}
+
+	recipients, err := a.userRepo.GetByRole(ctx, "admin", false)
+	if err != nil {
+		a.logger.Logger.Warn().Err(err).Msg("Failed to list admins for storage soft limit")
+	}
+	if ownerID != "" {
+		owner, err := a.userRepo.GetByID(ctx, ownerID)
+		if err != nil {
+			a.logger.Logger.Warn().Err(err).Str("user_id", ownerID).Msg("Failed to look up Pi owner for storage soft limit")
+		} else if owner != nil && owner.Active && owner.Role != "admin" {
+			recipients = append(recipients, owner)
+		}
+	}
+
+	n.Kind = KindSoftLimit
+	for _, user := range recipients {
+		if err := a.dispatcher.Dispatch(ctx, withRecipient(n, user)); err != nil {
+			a.logger.Logger.Warn().Err(err).Str("user_id", user.UserID).Msg("Failed to send storage soft limit notification")
+		}
+	}
+}
+
+func withRecipient(n notify.Notification, user *auth_models.User) notify.Notification {
+	n.Recipient = notify.Recipient{UserID: user.UserID, Email: user.Email}
+	return n
+}
+
+// formatBytes renders a size in binary units, e.g. "1.5 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,226 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// ReportSchemaVersion is bumped whenever a field is added to Report
+const ReportSchemaVersion = 1
+
+// Delay before the first report, so a crash-looping replica doesn't report on
+// every start
+const firstReportDelay = 10 * time.Minute
+
+// Report is the whole document sent to the telemetry endpoint. Every JSON field
+// must be listed in allowedFields and every feature in allowedFeatures, or
+// Marshal refuses to serialize it; add new fields there deliberately.
+type Report struct {
+	SchemaVersion int             `json:"schema_version"`
+	InstallID     string          `json:"install_id"` // random, generated on first run
+	Version       string          `json:"version"`
+	Users         string          `json:"users"` // bucketed counts, see bucket
+	Pis           string          `json:"pis"`
+	Devices       string          `json:"devices"`
+	Features      map[string]bool `json:"features"`
+}
+
+// allowedFields is the serializer whitelist for Report. Never add identifiers,
+// hostnames, addresses or payload data.
+var allowedFields = map[string]bool{
+	"schema_version": true,
+	"install_id":     true,
+	"version":        true,
+	"users":          true,
+	"pis":            true,
+	"devices":        true,
+	"features":       true,
+}
+
+// allowedFeatures is the whitelist of feature flag names in Report.Features
+var allowedFeatures = map[string]bool{
+	"strict_json":             true,
+	"admin_impersonation":     true,
+	"startup_strict":          true,
+	"ingest_require_owned_pi": true,
+	"internal_listener":       true,
+	"notify_email":            true,
+	"notify_webhook":          true,
+	"notify_mqtt":             true,
+	"storage_monitor":         true,
+}
+
+// Marshal serializes report after checking every field and feature against the
+// whitelists, so nothing reaches the wire that hasn't been reviewed
+func Marshal(report *Report) ([]byte, error) {
+	t := reflect.TypeOf(*report)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if !allowedFields[name] {
+			return nil, fmt.Errorf("telemetry field %q (%s) is not whitelisted", name, t.Field(i).Name)
+		}
+	}
+	for feature := range report.Features {
+		if !allowedFeatures[feature] {
+			return nil, fmt.Errorf("telemetry feature %q is not whitelisted", feature)
+		}
+	}
+	return json.Marshal(report)
+}
+
+// bucket reports a count as an order-of-magnitude range instead of the exact value
+func bucket(count int64) string {
+	switch {
+	case count <= 0:
+		return "0"
+	case count <= 10:
+		return "1-10"
+	case count <= 100:
+		return "11-100"
+	case count <= 1000:
+		return "101-1000"
+	case count <= 10000:
+		return "1001-10000"
+	default:
+		return "10000+"
+	}
+}
+
+// Reporter builds the usage report and, when enabled, sends it periodically
+type Reporter struct {
+	cfg        *config.Config
+	repo       interfaces.InstallationRepository
+	logger     *logger.Logger
+	httpClient *http.Client
+}
+
+// NewReporter creates a telemetry reporter
+func NewReporter(cfg *config.Config, repo interfaces.InstallationRepository, logger *logger.Logger) *Reporter {
+	return &Reporter{
+		cfg:        cfg,
+		repo:       repo,
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Enabled reports whether reports are sent
+func (r *Reporter) Enabled() bool {
+	return r.cfg.Telemetry.Enabled
+}
+
+// Endpoint returns the URL reports are sent to
+func (r *Reporter) Endpoint() string {
+	return r.cfg.Telemetry.Endpoint
+}
+
+// Build assembles the report from the database and the effective configuration
+func (r *Reporter) Build(ctx context.Context) (*Report, error) {
+	installID, err := r.repo.GetInstallID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get install id: %w", err)
+	}
+	counts, err := r.repo.CountResources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count resources: %w", err)
+	}
+
+	return &Report{
+		SchemaVersion: ReportSchemaVersion,
+		InstallID:     installID,
+		Version:       buildinfo.Get().Version,
+		Users:         bucket(counts.Users),
+		Pis:           bucket(counts.Pis),
+		Devices:       bucket(counts.Devices),
+		Features: map[string]bool{
+			"strict_json":             r.cfg.Server.StrictJSON,
+			"admin_impersonation":     r.cfg.Auth.AllowAdminImpersonation,
+			"startup_strict":          r.cfg.Server.StartupStrict,
+			"ingest_require_owned_pi": r.cfg.Internal.RequireOwnedPi,
+			"internal_listener":       r.cfg.Internal.Port != "",
+			"notify_email":            r.cfg.Notifications.Email.Enabled,
+			"notify_webhook":          r.cfg.Notifications.Webhook.Enabled,
+			"notify_mqtt":             r.cfg.Notifications.MQTT.Enabled,
+			"storage_monitor":         r.cfg.StorageMonitor.InsertLatencyBudget > 0,
+		},
+	}, nil
+}
+
+// Preview returns the exact document that would be sent
+func (r *Reporter) Preview(ctx context.Context) ([]byte, error) {
+	report, err := r.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(report)
+}
+
+// Send builds the report and POSTs it to the endpoint
+func (r *Reporter) Send(ctx context.Context) error {
+	body, err := r.Preview(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.Telemetry.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Run sends a report every interval until ctx is cancelled. It returns at once
+// when telemetry is disabled. Failures are logged and the next report is sent
+// on schedule.
+func (r *Reporter) Run(ctx context.Context) {
+	if !r.Enabled() {
+		return
+	}
+
+	interval := r.cfg.Telemetry.Interval
+	delay := firstReportDelay
+	if interval < delay {
+		delay = interval
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			sendCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if err := r.Send(sendCtx); err != nil {
+				r.logger.Logger.Warn().Err(err).Msg("Failed to send telemetry report")
+			} else {
+				r.logger.Logger.Info().Msg("Telemetry report sent")
+			}
+			cancel()
+			timer.Reset(interval)
+		}
+	}
+}
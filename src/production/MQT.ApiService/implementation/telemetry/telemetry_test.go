@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type fakeInstallationRepo struct {
+	counts interfaces.ResourceCounts
+}
+
+func (f *fakeInstallationRepo) GetInstallID(ctx context.Context) (string, error) {
+	return "install-1", nil
+}
+
+func (f *fakeInstallationRepo) CountResources(ctx context.Context) (*interfaces.ResourceCounts, error) {
+	return &f.counts, nil
+}
+
+// Every JSON field of Report must be whitelisted, and the whitelist must not
+// list fields Report no longer has
+func TestReportFieldsMatchWhitelist(t *testing.T) {
+	fields := map[string]bool{}
+	reportType := reflect.TypeOf(Report{})
+	for i := 0; i < reportType.NumField(); i++ {
+		name, _, _ := strings.Cut(reportType.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+		if !allowedFields[name] {
+			t.Errorf("Report field %q (%s) is not in allowedFields", name, reportType.Field(i).Name)
+		}
+	}
+	for name := range allowedFields {
+		if !fields[name] {
+			t.Errorf("allowedFields lists %q, which Report doesn't have", name)
+		}
+	}
+}
+
+func TestBuiltReportIsWhitelisted(t *testing.T) {
+	repo := &fakeInstallationRepo{counts: interfaces.ResourceCounts{Users: 3, Pis: 42, Devices: 12345}}
+	reporter := NewReporter(&config.Config{}, repo, nil)
+
+	report, err := reporter.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for feature := range report.Features {
+		if !allowedFeatures[feature] {
+			t.Errorf("Build reports feature %q, which is not in allowedFeatures", feature)
+		}
+	}
+
+	body, err := Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil {
+		t.Fatalf("report is not a JSON object: %v", err)
+	}
+	for key := range document {
+		if !allowedFields[key] {
+			t.Errorf("serialized report carries %q, which is not whitelisted", key)
+		}
+	}
+
+	// Counts only leave bucketed
+	for key, want := range map[string]string{"users": `"1-10"`, "pis": `"11-100"`, "devices": `"10000+"`} {
+		if got := string(document[key]); got != want {
+			t.Errorf("%s = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestMarshalRefusesUnlistedFeature(t *testing.T) {
+	report := &Report{Features: map[string]bool{"hostname": true}}
+	if _, err := Marshal(report); err == nil {
+		t.Fatal("Marshal accepted a feature that is not whitelisted")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		count int64
+		want  string
+	}{
+		{-1, "0"},
+		{0, "0"},
+		{1, "1-10"},
+		{10, "1-10"},
+		{11, "11-100"},
+		{100, "11-100"},
+		{101, "101-1000"},
+		{1000, "101-1000"},
+		{1001, "1001-10000"},
+		{10000, "1001-10000"},
+		{10001, "10000+"},
+	}
+	for _, tt := range tests {
+		if got := bucket(tt.count); got != tt.want {
+			t.Errorf("bucket(%d) = %q, want %q", tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Unit systems accepted by the units query parameter
+const (
+	SystemRaw      = "raw"
+	SystemMetric   = "metric"
+	SystemImperial = "imperial"
+)
+
+// unit converts to the base unit of its quantity as base = (value + offset) * num / den.
+// Keeping the factor as a ratio and multiplying before dividing lets exact factors
+// like 5/9 round-trip without drift.
+type unit struct {
+	quantity string
+	offset   float64
+	num      float64
+	den      float64
+}
+
+// table holds every unit that can be declared, keyed by its symbol. Base units are
+// °C for temperature, Pa for pressure, m/s for speed and m for length.
+var table = map[string]unit{
+	"C": {quantity: "temperature", num: 1, den: 1},
+	"F": {quantity: "temperature", offset: -32, num: 5, den: 9},
+	"K": {quantity: "temperature", offset: -273.15, num: 1, den: 1},
+
+	"Pa":   {quantity: "pressure", num: 1, den: 1},
+	"hPa":  {quantity: "pressure", num: 100, den: 1},
+	"kPa":  {quantity: "pressure", num: 1000, den: 1},
+	"psi":  {quantity: "pressure", num: 6894.757293168361, den: 1},
+	"inHg": {quantity: "pressure", num: 3386.389, den: 1},
+
+	"m/s":  {quantity: "speed", num: 1, den: 1},
+	"km/h": {quantity: "speed", num: 1000, den: 3600},
+	"mph":  {quantity: "speed", num: 0.44704, den: 1},
+
+	"m":  {quantity: "length", num: 1, den: 1},
+	"mm": {quantity: "length", num: 1, den: 1000},
+	"ft": {quantity: "length", num: 0.3048, den: 1},
+	"in": {quantity: "length", num: 0.0254, den: 1},
+}
+
+// precision rounds converted values to nine decimal places, well below sensor
+// resolution. Converting into a unit no larger and back returns the original
+// reading; through a larger unit it can be off by that unit's rounding step.
+const precision = 1e9
+
+// targets maps each declared unit to the unit it is reported in for a system.
+// Units that already belong to the system are left alone.
+var targets = map[string]map[string]string{
+	SystemMetric: {
+		"F":    "C",
+		"psi":  "hPa",
+		"inHg": "hPa",
+		"mph":  "km/h",
+		"ft":   "m",
+		"in":   "mm",
+	},
+	SystemImperial: {
+		"C":    "F",
+		"K":    "F",
+		"Pa":   "psi",
+		"hPa":  "psi",
+		"kPa":  "psi",
+		"m/s":  "mph",
+		"km/h": "mph",
+		"m":    "ft",
+		"mm":   "in",
+	},
+}
+
+// ValidSystem reports whether system is a value the units query parameter accepts
+func ValidSystem(system string) bool {
+	return system == SystemRaw || system == SystemMetric || system == SystemImperial
+}
+
+// Known reports whether symbol is a unit that can be declared
+func Known(symbol string) bool {
+	_, ok := table[symbol]
+	return ok
+}
+
+// Symbols returns every unit that can be declared, sorted
+func Symbols() []string {
+	symbols := make([]string, 0, len(table))
+	for symbol := range table {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Convert converts value from one unit to another of the same quantity
+func Convert(value float64, from, to string) (float64, error) {
+	src, ok := table[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	dst, ok := table[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if src.quantity != dst.quantity {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, src.quantity, to, dst.quantity)
+	}
+	if from == to {
+		return value, nil
+	}
+
+	base := (value + src.offset) * src.num / src.den
+	converted := base*dst.den/dst.num - dst.offset
+	return math.Round(converted*precision) / precision, nil
+}
+
+// Target returns the unit a value declared in symbol is reported in under system
+func Target(symbol, system string) string {
+	if target, ok := targets[system][symbol]; ok {
+		return target
+	}
+	return symbol
+}
+
+// ParseDeclared reads a meta.units object into a field -> unit map. It rejects
+// anything but an object of known unit symbols.
+func ParseDeclared(raw interface{}) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("units must be an object of field to unit")
+	}
+
+	declared := make(map[string]string, len(object))
+	for field, value := range object {
+		symbol, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unit for %q must be a string", field)
+		}
+		if !Known(symbol) {
+			return nil, fmt.Errorf("unknown unit %q for %q (known: %s)", symbol, field, strings.Join(Symbols(), ", "))
+		}
+		declared[field] = symbol
+	}
+	return declared, nil
+}
+
+// ConvertPayload returns payload with every numeric field that has a declared unit
+// converted to system, plus the unit each of those fields is reported in. Fields
+// without a declared unit and non-numeric values pass through unchanged. The raw
+// system returns payload as is with the declared units. payload is not modified.
+func ConvertPayload(payload map[string]interface{}, declared map[string]string, system string) (map[string]interface{}, map[string]string) {
+	if payload == nil || len(declared) == 0 {
+		return payload, nil
+	}
+
+	used := make(map[string]string)
+	var converted map[string]interface{}
+	for field, symbol := range declared {
+		value, ok := payload[field]
+		if !ok {
+			continue
+		}
+		number, ok := toFloat(value)
+		if !ok {
+			continue
+		}
+
+		target := Target(symbol, system)
+		used[field] = target
+		if target == symbol {
+			continue
+		}
+
+		result, err := Convert(number, symbol, target)
+		if err != nil {
+			used[field] = symbol
+			continue
+		}
+		if converted == nil {
+			converted = make(map[string]interface{}, len(payload))
+			for k, v := range payload {
+				converted[k] = v
+			}
+		}
+		converted[field] = result
+	}
+
+	if len(used) == 0 {
+		used = nil
+	}
+	if converted == nil {
+		return payload, used
+	}
+	return converted, used
+}
+
+// toFloat returns value as a float64 if it is a JSON or Go number
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,199 @@
+package units
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Conversions with exact factors land exactly on the expected value
+func TestConvertExact(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{212, "F", "C", 100},
+		{32, "F", "C", 0},
+		{-40, "F", "C", -40},
+		{-40, "C", "F", -40},
+		{100, "C", "F", 212},
+		{37, "C", "F", 98.6},
+		{0, "K", "C", -273.15},
+		{0, "C", "K", 273.15},
+		{1013.25, "hPa", "Pa", 101325},
+		{101.325, "kPa", "hPa", 1013.25},
+		{36, "km/h", "m/s", 10},
+		{1, "mph", "km/h", 1.609344},
+		{1, "ft", "in", 12},
+		{1, "in", "mm", 25.4},
+		{1, "m", "mm", 1000},
+		{21.5, "C", "C", 21.5},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Convert(%v, %s, %s): %v", tt.value, tt.from, tt.to, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Convert(%v, %s, %s) = %v, want %v", tt.value, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// Converting a reading into another system's unit and back, for every
+// conversion a units query can make, returns the stored value exactly when the
+// other unit is no larger, and otherwise to within the half rounding step lost
+// in each unit. Repeating the round trip never drifts further.
+func TestConvertRoundTrip(t *testing.T) {
+	values := []float64{-40, -17.5, 0, 0.1, 1, 21.37, 99.99, 1013.25, 4096, 101325}
+	for system, conversions := range targets {
+		for from, to := range conversions {
+			// How many from units one to unit is
+			size := (table[to].num / table[to].den) / (table[from].num / table[from].den)
+			tolerance := 0.0
+			if size > 1 {
+				tolerance = (size + 1) / precision / 2
+			}
+
+			for _, value := range values {
+				there, back := roundTrip(t, value, from, to)
+				if diff := math.Abs(back - value); diff > tolerance {
+					t.Errorf("%s: %v %s -> %v %s -> %v %s, off by %g, want at most %g", system, value, from, there, to, back, from, diff, tolerance)
+				}
+				if again, backAgain := roundTrip(t, back, from, to); again != there || backAgain != back {
+					t.Errorf("%s: %v %s drifts on a second round trip: %v %s -> %v %s", system, value, from, again, to, backAgain, from)
+				}
+			}
+		}
+	}
+}
+
+// roundTrip converts value from one unit to another and back
+func roundTrip(t *testing.T, value float64, from, to string) (there, back float64) {
+	t.Helper()
+	there, err := Convert(value, from, to)
+	if err != nil {
+		t.Fatalf("Convert(%v, %s, %s): %v", value, from, to, err)
+	}
+	back, err = Convert(there, to, from)
+	if err != nil {
+		t.Fatalf("Convert(%v, %s, %s): %v", there, to, from, err)
+	}
+	return there, back
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"unknown source", "furlong", "m"},
+		{"unknown target", "m", "furlong"},
+		{"different quantities", "C", "Pa"},
+		{"case matters", "c", "F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Convert(1, tt.from, tt.to); err == nil {
+				t.Errorf("Convert(1, %s, %s) = %v, want an error", tt.from, tt.to, got)
+			}
+		})
+	}
+}
+
+// Only numeric fields with a declared unit change; everything else, including
+// the caller's payload, is left as it was
+func TestConvertPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   map[string]interface{}
+		declared  map[string]string
+		system    string
+		want      map[string]interface{}
+		wantUnits map[string]string
+	}{
+		{
+			name:      "converted",
+			payload:   map[string]interface{}{"t": 212.0, "p": json.Number("1013.25")},
+			declared:  map[string]string{"t": "F", "p": "hPa"},
+			system:    SystemMetric,
+			want:      map[string]interface{}{"t": 100.0, "p": json.Number("1013.25")},
+			wantUnits: map[string]string{"t": "C", "p": "hPa"},
+		},
+		{
+			name:      "json.Number converted",
+			payload:   map[string]interface{}{"t": json.Number("100")},
+			declared:  map[string]string{"t": "C"},
+			system:    SystemImperial,
+			want:      map[string]interface{}{"t": 212.0},
+			wantUnits: map[string]string{"t": "F"},
+		},
+		{
+			name:      "undeclared fields untouched",
+			payload:   map[string]interface{}{"t": 100, "humidity": 55.5, "battery": json.Number("3.7")},
+			declared:  map[string]string{"t": "C"},
+			system:    SystemImperial,
+			want:      map[string]interface{}{"t": 212.0, "humidity": 55.5, "battery": json.Number("3.7")},
+			wantUnits: map[string]string{"t": "F"},
+		},
+		{
+			name:     "non-numeric values untouched",
+			payload:  map[string]interface{}{"t": "n/a", "p": nil, "s": true, "l": map[string]interface{}{"value": 1.0}, "h": []interface{}{1.0}, "bad": json.Number("x")},
+			declared: map[string]string{"t": "C", "p": "Pa", "s": "m/s", "l": "m", "h": "m", "bad": "C"},
+			system:   SystemImperial,
+			want:     map[string]interface{}{"t": "n/a", "p": nil, "s": true, "l": map[string]interface{}{"value": 1.0}, "h": []interface{}{1.0}, "bad": json.Number("x")},
+		},
+		{
+			name:      "declared field missing",
+			payload:   map[string]interface{}{"t": 20.0},
+			declared:  map[string]string{"t": "C", "p": "hPa"},
+			system:    SystemImperial,
+			want:      map[string]interface{}{"t": 68.0},
+			wantUnits: map[string]string{"t": "F"},
+		},
+		{
+			name:      "already in the system",
+			payload:   map[string]interface{}{"t": 20.0},
+			declared:  map[string]string{"t": "C"},
+			system:    SystemMetric,
+			want:      map[string]interface{}{"t": 20.0},
+			wantUnits: map[string]string{"t": "C"},
+		},
+		{
+			name:      "raw",
+			payload:   map[string]interface{}{"t": 68.0},
+			declared:  map[string]string{"t": "F"},
+			system:    SystemRaw,
+			want:      map[string]interface{}{"t": 68.0},
+			wantUnits: map[string]string{"t": "F"},
+		},
+		{
+			name:    "nothing declared",
+			payload: map[string]interface{}{"t": 68.0},
+			system:  SystemMetric,
+			want:    map[string]interface{}{"t": 68.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := make(map[string]interface{}, len(tt.payload))
+			for k, v := range tt.payload {
+				original[k] = v
+			}
+
+			got, gotUnits := ConvertPayload(tt.payload, tt.declared, tt.system)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("payload %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotUnits, tt.wantUnits) {
+				t.Errorf("units %v, want %v", gotUnits, tt.wantUnits)
+			}
+			if !reflect.DeepEqual(tt.payload, original) {
+				t.Errorf("caller's payload changed to %v", tt.payload)
+			}
+		})
+	}
+}
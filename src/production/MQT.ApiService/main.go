@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,16 +13,40 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/controllers"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
 	container "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Container"
 	implementation "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Implementation"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 
 	// Auth imports
+	auditService "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
 	authService "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/auth"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/cacheinvalidation"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/ingestors"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/ingeststats"
 	jwt "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/maintenance"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/mqttauth"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/notify"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/payloadschema"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/purge"
 	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/seed"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/startup"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/storagemonitor"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/storageusage"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/telemetry"
 	authMiddleware "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/routing"
 	api_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/api"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -29,47 +55,94 @@ func main() {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize container: %v", err))
 	}
-	defer ctr.Shutdown(context.Background())
 
 	logger := ctr.GetLogger()
-	logger.Info("Starting API Service")
+	build := buildinfo.Get()
+	logger.Logger.Info().Str("commit", build.Commit).Str("build_date", build.BuildDate).Msg("Starting API Service")
 
 	// Initialize database
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Tables are critical; the remaining steps can be retried in the background
+	// unless STARTUP_STRICT is set
 	if err := ctr.InitializeDatabase(ctx); err != nil {
 		logger.FatalWithError(err, "Failed to initialize database")
 	}
 
+	startupCtx, stopStartupRetries := context.WithCancel(context.Background())
+	startupTracker := startup.NewTracker(startupCtx, ctr.GetConfig().Server.StartupStrict, logger)
+	if err := startupTracker.RunRetryable(ctx, "database_indexes", ctr.InitializeIndexes); err != nil {
+		logger.FatalWithError(err, "Failed to create database indexes")
+	}
+
 	// Get database connection
 	db, err := ctr.GetDatabase()
 	if err != nil {
 		logger.FatalWithError(err, "Failed to get database connection")
 	}
 
+	healthChecker, err := ctr.GetHealthChecker()
+	if err != nil {
+		logger.FatalWithError(err, "Failed to create health checker")
+	}
+
+	dbManager, err := ctr.GetDatabaseManager()
+	if err != nil {
+		logger.FatalWithError(err, "Failed to get database manager")
+	}
+
 	// Create repositories
 	readingRepo := implementation.NewPostgresReadingRepository(db)
 	userRepo := implementation.NewPostgresUserRepository(db)
 	piRepo := implementation.NewPostgresPiRepository(db)
 	deviceRepo := implementation.NewPostgresDeviceRepository(db)
 	roleRepo := implementation.NewPostgresRoleRepository(db)
+	auditRepo := implementation.NewPostgresAuditRepository(db)
+	mqttCredentialRepo := implementation.NewPostgresMqttCredentialRepository(db)
+	installationRepo := implementation.NewPostgresInstallationRepository(db)
+	pendingDeviceRepo := implementation.NewPostgresPendingDeviceRepository(db)
+	ingestErrorRepo := implementation.NewPostgresIngestErrorRepository(db)
+	payloadSchemaRepo := implementation.NewPostgresPayloadSchemaRepository(db)
+	notificationRepo := implementation.NewPostgresNotificationRepository(db)
+	storageUsageRepo := implementation.NewPostgresStorageUsageRepository(db)
+	purgeJobRepo := implementation.NewPostgresPurgeJobRepository(db)
+	seedRunRepo := implementation.NewPostgresSeedRunRepository(db)
 
 	// Get configuration
 	config := ctr.GetConfig()
 
+	// Reading timestamps are truncated and serialized at this precision
+	if err := hardware_models.SetTimestampPrecision(config.Server.TimestampPrecision); err != nil {
+		logger.FatalWithError(err, "Invalid timestamp precision")
+	}
+
+	// Export connection pool statistics on /metrics
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, config.Database.DBName))
+
+	// Watch reading insert latency against its budget
+	storageMonitor := storagemonitor.NewLatencyMonitor(config.StorageMonitor, logger)
+	readingRepo.SetInsertObserver(storageMonitor.Observe)
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	go storageMonitor.Run(monitorCtx)
+
 	// Initialize JWT service for token validation
 	jwtConfig := api_models.Config{
 		SecretKey:            config.Auth.JWTSecretKey,
 		AccessTokenDuration:  config.Auth.AccessTokenDuration,
 		RefreshTokenDuration: config.Auth.RefreshTokenDuration,
 		Issuer:               config.Auth.JWTIssuer,
+
+		ImpersonationTokenDuration: config.Auth.ImpersonationTokenDuration,
 	}
 	jwtService := jwt.NewService(jwtConfig)
 
 	// Initialize RBAC service
 	rbacService := rbac.NewService()
 
+	// Initialize audit service
+	auditServiceInstance := auditService.NewService(auditRepo, logger)
+
 	// Create auth middleware
 	middlewareConfig := authMiddleware.Config{
 		AccessTokenHeader: "Authorization",
@@ -78,36 +151,130 @@ func main() {
 	authMiddlewareInstance := authMiddleware.NewAuthMiddleware(jwtService, rbacService, middlewareConfig)
 
 	// Initialize auth services
-	authServiceInstance := authService.NewAuthService(userRepo, roleRepo, jwtService, rbacService)
-	userServiceInstance := authService.NewUserService(userRepo)
+	passwordHasher := password.NewHasher(config.Auth.PasswordHash)
+	authServiceInstance := authService.NewAuthService(userRepo, roleRepo, jwtService, rbacService, passwordHasher, config.Auth.AllowAdminImpersonation)
+	userServiceInstance := authService.NewUserService(userRepo, rbacService, passwordHasher)
 
 	// Initialize role initializer
 	roleInitializer := authService.NewRoleInitializerService(
 		roleRepo,
 		userRepo,
 		rbacService,
+		passwordHasher,
 		logger,
 		authService.AdminConfig{
-			Username: config.Auth.Admin.Username,
-			Email:    config.Auth.Admin.Email,
-			Password: config.Auth.Admin.Password,
+			Username:   config.Auth.Admin.Username,
+			Email:      config.Auth.Admin.Email,
+			Password:   config.Auth.Admin.Password,
+			Reactivate: config.Auth.Admin.Reactivate,
 		},
 	)
 
-	// Initialize roles and admin user
-	if err := roleInitializer.InitializeRoles(ctx); err != nil {
-		logger.FatalWithError(err, "Failed to initialize roles")
+	// Initialize roles and admin user. The admin user is created after the roles
+	// have loaded, so both run as one step.
+	if err := startupTracker.RunRetryable(ctx, "role_seeding", func(ctx context.Context) error {
+		if err := roleInitializer.InitializeRoles(ctx); err != nil {
+			return err
+		}
+		err := roleInitializer.InitializeAdminUser(ctx)
+		if errors.Is(err, authService.ErrAdminAccountConflict) {
+			// Retrying can't fix this; an operator has to decide what to do with the account
+			logger.FatalWithError(err, "Failed to initialize admin user")
+		}
+		return err
+	}); err != nil {
+		logger.FatalWithError(err, "Failed to initialize roles and admin user")
+	}
+
+	// Pick up role changes made by other replicas
+	roleReloadCtx, stopRoleReload := context.WithCancel(context.Background())
+	go rbacService.RunReload(roleReloadCtx, roleRepo, config.Auth.RoleReloadInterval, logger)
+
+	// Maintenance mode pauses writes. It is stored in the database so every
+	// replica converges on it, unless MAINTENANCE_PERSIST=false keeps it per replica.
+	var maintenanceRepo interfaces.MaintenanceRepository
+	if config.Maintenance.Persist {
+		maintenanceRepo = implementation.NewPostgresMaintenanceRepository(db)
+	}
+	maintenanceMode := maintenance.NewMode(maintenanceRepo, config.Maintenance.RetryAfter, logger)
+	if err := maintenanceMode.Reload(ctx); err != nil {
+		logger.Logger.Warn().Err(err).Msg("Failed to load maintenance mode; starting with writes enabled")
+	}
+	maintenanceCtx, stopMaintenanceReload := context.WithCancel(context.Background())
+	go maintenanceMode.RunReload(maintenanceCtx, config.Maintenance.PollInterval)
+
+	// POST routes that only look things up, and the switch itself, stay open
+	// during maintenance
+	maintenanceExempt := []string{
+		"/admin/maintenance",
+		"/api/auth/login",
+		"/api/auth/refresh",
+		"/api/auth/logout",
+		"/internal/pis/validate",
+		"/internal/devices/validate",
+		"/internal/validate/batch",
+		"/internal/mqtt/auth",
+		"/internal/mqtt/acl",
+		"/internal/ingestors/heartbeat",
 	}
-	if err := roleInitializer.InitializeAdminUser(ctx); err != nil {
-		logger.FatalWithError(err, "Failed to initialize admin user")
+
+	// Opt-in anonymous usage report; say so loudly either way so operators know
+	telemetryReporter := telemetry.NewReporter(config, installationRepo, logger)
+	if telemetryReporter.Enabled() {
+		logger.Logger.Warn().Str("endpoint", telemetryReporter.Endpoint()).Dur("interval", config.Telemetry.Interval).
+			Msg("TELEMETRY ENABLED: anonymous usage statistics will be sent; preview them at GET /admin/telemetry/preview")
+	} else {
+		logger.Logger.Info().Msg("Telemetry disabled (set TELEMETRY_ENABLED=true to opt in)")
+	}
+	telemetryCtx, stopTelemetry := context.WithCancel(context.Background())
+	go telemetryReporter.Run(telemetryCtx)
+
+	// Notifications honour each user's preferences; those held back for quiet
+	// hours or digests are sent by the digest job. The API's only MQTT client
+	// publishes cache invalidations, so the MQTT channel can't be used from here.
+	digestCtx, stopDigests := context.WithCancel(context.Background())
+	dispatcher, err := notify.NewDispatcherFromConfig(config.Notifications, nil, auditServiceInstance, logger)
+	if err != nil {
+		logger.Logger.Warn().Err(err).Msg("Notifications disabled")
+	} else {
+		dispatcher.UsePreferences(notificationRepo)
+		go notify.NewDigester(dispatcher, notificationRepo, logger).Run(digestCtx, config.Notifications.DigestInterval)
 	}
 
-	// Note: MQTT ingestor is now a separate service
+	// Email changes are confirmed from the new address, so they need SMTP
+	if config.Notifications.Email.Enabled {
+		authServiceInstance.UseEmailChange(notify.NewEmailNotifier(config.Notifications.Email), config.Auth.EmailChangeTTL, config.Auth.EmailConfirmURL)
+	} else {
+		logger.Logger.Info().Msg("Email changes disabled (set NOTIFY_EMAIL_ENABLED=true and SMTP_* to allow them)")
+	}
+
+	// Per-Pi storage accounting; soft limit crossings are sent through the dispatcher
+	storageCtx, stopStorageAccounting := context.WithCancel(context.Background())
+	go storageusage.NewAccountant(config.StorageAccounting, storageUsageRepo, userRepo, dispatcher, logger).Run(storageCtx)
+
+	// Note: MQTT ingestor is now a separate service. Its instances report
+	// heartbeats here; expired ones are pruned in the background.
+	ingestorRegistry := ingestors.NewRegistry(config.Internal.IngestorHeartbeatTTL)
+	ingestorCtx, stopIngestorRegistry := context.WithCancel(context.Background())
+	go ingestorRegistry.Run(ingestorCtx)
+
+	// Large reading purges run as chunked background jobs on this replica
+	purger := purge.NewPurger(config.Purge, readingRepo, purgeJobRepo, logger)
+
+	// Demo data seeding for test environments, off unless SEED_ALLOWED is set
+	seeder := seed.NewSeeder(config.Seed, userRepo, piRepo, deviceRepo, readingRepo, seedRunRepo, passwordHasher, logger)
 
 	// Initialize Gin router
 	router := gin.New()
+	// Let handlers that pass the gin context see values set on the request context
+	router.ContextWithFallback = true
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
+	router.Use(authMiddleware.ServiceVersion())
+	router.Use(authMiddleware.RequestMetrics())
+	router.Use(authMiddleware.RequestTimeout(config.Server.RequestTimeout))
+	router.Use(authMiddleware.BodyBinding(config.Server.MaxBodyBytes, config.Server.StrictJSON))
+	router.Use(authMiddleware.Maintenance(maintenanceMode, maintenanceExempt...))
 
 	// Configure CORS from config
 	corsConfig := cors.Config{
@@ -120,23 +287,110 @@ func main() {
 	}
 	router.Use(cors.New(corsConfig))
 
-	// Create controllers and register routes
-	authController := controllers.NewAuthController(authServiceInstance)
-	userController := controllers.NewUserController(userServiceInstance)
-	piController := controllers.NewPiController(piRepo, userRepo, logger, authMiddlewareInstance)
-	deviceController := controllers.NewDeviceController(deviceRepo, piRepo, logger, authMiddlewareInstance)
-	readingController := controllers.NewReadingController(readingRepo, piRepo, logger, authMiddlewareInstance)
-	healthController := controllers.NewHealthController(readingRepo, piRepo, logger, authMiddlewareInstance)
-	internalController := controllers.NewInternalController(piRepo, deviceRepo, readingRepo)
-
-	// Register all routes
-	authController.RegisterRoutes(router, authMiddlewareInstance)
-	userController.RegisterRoutes(router, authMiddlewareInstance)
-	piController.RegisterRoutes(router)
-	deviceController.RegisterRoutes(router)
-	readingController.RegisterRoutes(router)
-	healthController.RegisterRoutes(router)
-	internalController.RegisterRoutes(router)
+	// Service-to-service routes share the public listener unless INTERNAL_PORT is set
+	internalRouter := router
+	if config.Internal.Port != "" {
+		internalRouter = gin.New()
+		internalRouter.ContextWithFallback = true
+		internalRouter.Use(gin.Logger())
+		internalRouter.Use(gin.Recovery())
+		internalRouter.Use(authMiddleware.ServiceVersion())
+		internalRouter.Use(authMiddleware.RequestMetrics())
+		internalRouter.Use(authMiddleware.RequestTimeout(config.Server.RequestTimeout))
+		internalRouter.Use(authMiddleware.BodyBinding(config.Server.MaxBodyBytes, config.Server.StrictJSON))
+		internalRouter.Use(authMiddleware.Maintenance(maintenanceMode, maintenanceExempt...))
+	}
+
+	// Rolling per-device ingest counters, shared by the internal write path and /pis/:pi_id/ingest-stats
+	ingestStats := ingeststats.NewCounter(config.Internal.IngestStatsMaxSeries)
+
+	// Active payload schemas, shared by the internal write path and the schema admin routes
+	payloadValidator := payloadschema.NewValidator(payloadSchemaRepo, deviceRepo, config.Internal.SchemaCacheTTL, logger)
+
+	// Pi and device changes evict this replica's cached device types and, with
+	// CACHE_INVALIDATION_TOPIC set, the ingestors' validation caches, so a Pi
+	// or device created after a miss isn't refused until the negative TTL ends
+	cacheInvalidations := cacheinvalidation.NewBus()
+	cacheInvalidations.Subscribe(func(event ingest_models.CacheInvalidation) {
+		payloadValidator.InvalidateDevice(event.PiID, event.DeviceID)
+	})
+	if config.Internal.CacheInvalidationTopic != "" {
+		publisher, err := cacheinvalidation.NewPublisher(config.MQTT, config.Internal.CacheInvalidationTopic, os.Getenv("INTERNAL_API_SECRET"), logger)
+		if err != nil {
+			logger.FatalWithError(err, "Failed to set up cache invalidation publishing")
+		}
+		cacheInvalidations.Subscribe(publisher.Publish)
+		ctr.GetLifecycle().OnShutdown(container.PhaseCloseClients, "cache_invalidation_publisher", func(ctx context.Context) error {
+			publisher.Close()
+			return nil
+		})
+	}
+
+	if config.Readings.InclusiveTo {
+		logger.Logger.Warn().Msg("READINGS_INCLUSIVE_TO is deprecated: reading ranges default to an inclusive end; clients should use half-open [from, to) ranges or pass inclusive_to=true")
+	}
+
+	// Create controllers and register routes. The permission controller reads
+	// the registry it is registered in, so it reports what is enforced.
+	if config.Internal.AllowBearerAuth {
+		logger.Logger.Warn().Msg("INTERNAL_ALLOW_BEARER_AUTH is set: /internal accepts unsigned requests carrying INTERNAL_API_SECRET as a bearer token; turn it off once every caller signs its requests")
+	}
+	routeRegistry := routing.NewRegistry(authMiddlewareInstance, authMiddleware.ServiceAuthMiddleware(config.Internal.AllowBearerAuth))
+	authController := controllers.NewAuthController(authServiceInstance, auditServiceInstance)
+	permissionController := controllers.NewPermissionController(routeRegistry, rbacService)
+	userController := controllers.NewUserController(userServiceInstance, piRepo, auditServiceInstance)
+	piController := controllers.NewPiController(piRepo, userRepo, ingestErrorRepo, ingestStats, cacheInvalidations, config.Server.MetaLookupKeys, logger)
+	deviceController := controllers.NewDeviceController(deviceRepo, piRepo, readingRepo, cacheInvalidations, config.Server.MetaLookupKeys, logger)
+	pendingDeviceController := controllers.NewPendingDeviceController(pendingDeviceRepo, piRepo, auditServiceInstance, cacheInvalidations, logger)
+	readingController := controllers.NewReadingController(readingRepo, piRepo, deviceRepo, config.Readings.InclusiveTo, logger)
+	healthController := controllers.NewHealthController(readingRepo, piRepo, logger, ctr.GetLifecycle().IsReady, storageMonitor, healthChecker, startupTracker, maintenanceMode, config.Readings.InclusiveTo)
+	mqttCredentialController := controllers.NewMqttCredentialController(mqttCredentialRepo, piRepo, auditServiceInstance, mqttauth.TopicRules{
+		SensorPrefix:    config.Internal.MQTTSensorTopicPrefix,
+		CommandPrefix:   config.Internal.MQTTCommandTopicPrefix,
+		ErrorPrefix:     config.Internal.MQTTErrorTopicPrefix,
+		DiscoveryPrefix: config.Internal.MQTTDiscoveryPrefix,
+	}, logger)
+	payloadSchemaController := controllers.NewPayloadSchemaController(payloadSchemaRepo, payloadValidator, auditServiceInstance, logger)
+	notificationPreferenceController := controllers.NewNotificationPreferenceController(notificationRepo, logger)
+	storageController := controllers.NewStorageController(storageUsageRepo, piRepo, logger)
+	adminController := controllers.NewAdminController(config, dbManager, telemetryReporter, maintenanceMode, auditServiceInstance, logger)
+	ingestorController := controllers.NewIngestorController(ingestorRegistry)
+	purgeController := controllers.NewPurgeController(purger, auditServiceInstance, logger)
+	seedController := controllers.NewSeedController(seeder, auditServiceInstance, logger)
+	internalController := controllers.NewInternalController(piRepo, deviceRepo, readingRepo, pendingDeviceRepo, ingestErrorRepo, auditServiceInstance, ingestStats, payloadValidator, cacheInvalidations, config.Internal)
+
+	// Declare every controller's routes, then register them in one step so
+	// middleware is applied uniformly and duplicates fail with a clear error
+	for _, registration := range []struct {
+		name   string
+		routes []routing.Route
+	}{
+		{"AuthController", authController.Routes()},
+		{"PermissionController", permissionController.Routes()},
+		{"NotificationPreferenceController", notificationPreferenceController.Routes()},
+		{"UserController", userController.Routes()},
+		{"PiController", piController.Routes()},
+		{"DeviceController", deviceController.Routes()},
+		{"PendingDeviceController", pendingDeviceController.Routes()},
+		{"PayloadSchemaController", payloadSchemaController.Routes()},
+		{"ReadingController", readingController.Routes()},
+		{"HealthController", healthController.Routes()},
+		{"InternalController", internalController.Routes()},
+		{"IngestorController", ingestorController.Routes()},
+		{"PurgeController", purgeController.Routes()},
+		{"SeedController", seedController.Routes()},
+		{"MqttCredentialController", mqttCredentialController.Routes()},
+		{"StorageController", storageController.Routes()},
+		{"AdminController", adminController.Routes()},
+	} {
+		if err := routeRegistry.Add(registration.name, registration.routes...); err != nil {
+			logger.FatalWithError(err, "Failed to register routes")
+		}
+	}
+	routeRegistry.Apply(router, internalRouter)
+	for _, route := range routeRegistry.Routes() {
+		logger.Logger.Debug().Str("method", route.Method).Str("path", route.Path).Str("access", route.Access).Str("controller", route.Controller).Msg("Route registered")
+	}
 
 	// Get port from configuration
 	port := config.Server.Port
@@ -158,6 +412,117 @@ func main() {
 		}
 	}()
 
+	// The HTTP server stops before the container closes the database
+	lifecycle := ctr.GetLifecycle()
+	lifecycle.OnShutdown(container.PhaseStopHTTP, "http_server", func(ctx context.Context) error {
+		return srv.Shutdown(ctx)
+	})
+
+	if internalRouter != router {
+		internalSrv := &http.Server{
+			Addr:         ":" + config.Internal.Port,
+			Handler:      internalRouter,
+			ReadTimeout:  config.Server.ReadTimeout,
+			WriteTimeout: config.Server.WriteTimeout,
+			IdleTimeout:  config.Server.IdleTimeout,
+		}
+		go func() {
+			logger.Info("Internal HTTP server starting on port " + config.Internal.Port)
+			if err := internalSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.FatalWithError(err, "Failed to start internal HTTP server")
+			}
+		}()
+		lifecycle.OnShutdown(container.PhaseStopHTTP, "internal_http_server", func(ctx context.Context) error {
+			return internalSrv.Shutdown(ctx)
+		})
+	}
+
+	// Ingestors with API_TRANSPORT=grpc validate and write readings over gRPC,
+	// on its own port, authenticated like /internal
+	if config.Internal.GRPCPort != "" {
+		grpcListener, err := net.Listen("tcp", ":"+config.Internal.GRPCPort)
+		if err != nil {
+			logger.FatalWithError(err, "Failed to listen for internal gRPC")
+		}
+		// The guards of the /internal routes, nested in the global ones as there
+		grpcLimits := authMiddleware.GRPCLimits{
+			Timeout:       config.Internal.RequestTimeout,
+			MaxBytes:      config.Internal.MaxBodyBytes,
+			MaxConcurrent: config.Internal.MaxConcurrent,
+			RateLimiter:   authMiddleware.NewRateLimiter(config.Internal.GRPCRateLimit, time.Minute),
+		}
+		if grpcLimits.Timeout <= 0 || (config.Server.RequestTimeout > 0 && config.Server.RequestTimeout < grpcLimits.Timeout) {
+			grpcLimits.Timeout = config.Server.RequestTimeout
+		}
+		if grpcLimits.MaxBytes <= 0 || (config.Server.MaxBodyBytes > 0 && config.Server.MaxBodyBytes < grpcLimits.MaxBytes) {
+			grpcLimits.MaxBytes = config.Server.MaxBodyBytes
+		}
+		grpcGuards := authMiddleware.NewGRPCGuards(grpcLimits)
+		grpcSrv := grpc.NewServer(
+			grpc.ChainUnaryInterceptor(authMiddleware.ServiceAuthUnaryInterceptor(config.Internal.AllowBearerAuth), grpcGuards.UnaryInterceptor()),
+			grpc.ChainStreamInterceptor(authMiddleware.ServiceAuthStreamInterceptor(config.Internal.AllowBearerAuth), grpcGuards.StreamInterceptor()),
+		)
+		ingestpb.RegisterIngestServiceServer(grpcSrv, controllers.NewInternalGRPCService(internalController, maintenanceMode))
+		go func() {
+			logger.Info("Internal gRPC server starting on port " + config.Internal.GRPCPort)
+			if err := grpcSrv.Serve(grpcListener); err != nil {
+				logger.FatalWithError(err, "Failed to start internal gRPC server")
+			}
+		}()
+		lifecycle.OnShutdown(container.PhaseStopHTTP, "internal_grpc_server", func(ctx context.Context) error {
+			// Let streams in progress finish, unless that outlasts the phase
+			stopped := make(chan struct{})
+			go func() {
+				grpcSrv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				grpcSrv.Stop()
+				return ctx.Err()
+			}
+		})
+	}
+	lifecycle.OnShutdown(container.PhaseCloseClients, "storage_monitor", func(ctx context.Context) error {
+		stopMonitor()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "role_reload", func(ctx context.Context) error {
+		stopRoleReload()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "maintenance_reload", func(ctx context.Context) error {
+		stopMaintenanceReload()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "telemetry", func(ctx context.Context) error {
+		stopTelemetry()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "notification_digests", func(ctx context.Context) error {
+		stopDigests()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "storage_accounting", func(ctx context.Context) error {
+		stopStorageAccounting()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "ingestor_registry", func(ctx context.Context) error {
+		stopIngestorRegistry()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "purge_jobs", func(ctx context.Context) error {
+		return purger.Stop(ctx)
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "startup_retries", func(ctx context.Context) error {
+		stopStartupRetries()
+		startupTracker.Wait()
+		return nil
+	})
+	lifecycle.SetReady()
+
 	logger.Info("API service running... press Ctrl+C to stop")
 
 	// Wait for shutdown signal
@@ -166,12 +531,5 @@ func main() {
 	<-sig
 
 	logger.Info("Shutting down...")
-
-	// Graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
-
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		logger.ErrorWithError(err, "Server forced to shutdown")
-	}
+	ctr.Shutdown(context.Background())
 }
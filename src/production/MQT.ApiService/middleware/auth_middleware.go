@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/audit"
 	jwt "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/jwt"
 	rbac "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
 
@@ -17,12 +18,16 @@ type contextKey string
 
 const (
 	// Context keys
-	UserIDContextKey      contextKey = "user_id"
-	UserRoleContextKey    contextKey = "user_role"
-	TokenIDContextKey     contextKey = "token_id"
-	AccessTokenContextKey contextKey = "access_token"
+	UserIDContextKey       contextKey = "user_id"
+	UserRoleContextKey     contextKey = "user_role"
+	TokenIDContextKey      contextKey = "token_id"
+	AccessTokenContextKey  contextKey = "access_token"
+	ImpersonatorContextKey contextKey = "impersonator_id"
 )
 
+// ImpersonatingHeader is set on responses to requests made with an impersonation token
+const ImpersonatingHeader = "X-Impersonating"
+
 // AuthMiddleware provides middleware functions for authentication and authorization
 type AuthMiddleware struct {
 	jwtService  *jwt.Service
@@ -106,6 +111,13 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		c.Set(string(TokenIDContextKey), accessClaims.TokenID)
 		c.Set(string(AccessTokenContextKey), accessToken)
 
+		// Impersonation sessions carry the admin's identity for auditing
+		if accessClaims.ImpersonatorID != "" {
+			c.Set(string(ImpersonatorContextKey), accessClaims.ImpersonatorID)
+			c.Request = c.Request.WithContext(audit.WithImpersonator(c.Request.Context(), accessClaims.ImpersonatorID))
+			c.Header(ImpersonatingHeader, accessClaims.UserID)
+		}
+
 		c.Next()
 	}
 }
@@ -255,3 +267,9 @@ func GetRoleFromGinContext(c *gin.Context) (string, error) {
 
 	return role, nil
 }
+
+// GetImpersonatorFromGinContext returns the impersonating admin's ID, or an empty
+// string when the request isn't part of an impersonation session
+func GetImpersonatorFromGinContext(c *gin.Context) string {
+	return c.GetString(string(ImpersonatorContextKey))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys read by the controllers' JSON bind helper
+const (
+	strictJSONKey   = "strict_json"
+	maxBodyBytesKey = "max_body_bytes"
+)
+
+// BodyBinding sets the request body size limit and the global strict-JSON default
+// for every route. A maxBytes of zero or less disables the size limit.
+func BodyBinding(maxBytes int64, strict bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(maxBodyBytesKey, maxBytes)
+		if strict {
+			c.Set(strictJSONKey, true)
+		}
+		c.Next()
+	}
+}
+
+// StrictJSON enables unknown-field rejection for a single route regardless of the
+// global setting
+func StrictJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(strictJSONKey, true)
+		c.Next()
+	}
+}
+
+// IsStrictJSON reports whether unknown JSON fields should be rejected for this request
+func IsStrictJSON(c *gin.Context) bool {
+	return c.GetBool(strictJSONKey)
+}
+
+// GetMaxBodyBytes returns the request body size limit, or zero when unlimited
+func GetMaxBodyBytes(c *gin.Context) int64 {
+	return c.GetInt64(maxBodyBytesKey)
+}
+
+// BodyLimit tightens the body size limit for a group of routes. It never raises
+// the global limit, and a maxBytes of zero or less leaves it unchanged.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if current := GetMaxBodyBytes(c); maxBytes > 0 && (current <= 0 || maxBytes < current) {
+			c.Set(maxBodyBytesKey, maxBytes)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimit caps how many requests in a route group run at once. A request
+// waits for a free slot until its context ends, then gets 503 so the caller can
+// retry. A limit of zero or less disables the cap.
+func ConcurrencyLimit(limit int, group string) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	slots := make(chan struct{}, limit)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		case <-c.Request.Context().Done():
+			httpRequestsRejectedTotal.WithLabelValues(group).Inc()
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many concurrent requests"})
+			c.Abort()
+			return
+		}
+		defer func() { <-slots }()
+
+		c.Next()
+	}
+}
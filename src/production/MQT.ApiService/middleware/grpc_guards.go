@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCLimits are the guards of the /internal routes as they apply to gRPC
+// calls. A zero value disables each of them.
+type GRPCLimits struct {
+	Timeout       time.Duration // deadline of each call, as RequestTimeout
+	MaxBytes      int64         // request bytes per call, over all its messages, as BodyLimit
+	MaxConcurrent int           // calls served at once, as ConcurrencyLimit
+	RateLimiter   *RateLimiter  // calls per service, as RateLimit
+}
+
+// GRPCGuards applies GRPCLimits to unary and streaming calls, which share the
+// concurrency cap. Its interceptors go after the service auth interceptors.
+type GRPCGuards struct {
+	limits GRPCLimits
+	slots  chan struct{}
+}
+
+// NewGRPCGuards creates the guards for limits
+func NewGRPCGuards(limits GRPCLimits) *GRPCGuards {
+	g := &GRPCGuards{limits: limits}
+	if limits.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return g
+}
+
+// UnaryInterceptor guards unary calls
+func (g *GRPCGuards) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := g.rateLimit(ctx, func(md metadata.MD) { grpc.SetTrailer(ctx, md) }); err != nil {
+			return nil, err
+		}
+		if message, ok := req.(proto.Message); ok && g.limits.MaxBytes > 0 && int64(proto.Size(message)) > g.limits.MaxBytes {
+			return nil, status.Error(codes.ResourceExhausted, "Request body too large")
+		}
+
+		ctx, cancel := g.withTimeout(ctx)
+		defer cancel()
+		release, err := g.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor guards streaming calls. Their messages count towards
+// MaxBytes as they are received.
+func (g *GRPCGuards) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := g.rateLimit(stream.Context(), stream.SetTrailer); err != nil {
+			return err
+		}
+
+		ctx, cancel := g.withTimeout(stream.Context())
+		defer cancel()
+		release, err := g.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return handler(srv, &guardedStream{ServerStream: stream, ctx: ctx, maxBytes: g.limits.MaxBytes})
+	}
+}
+
+// rateLimit refuses a call over the caller's rate, keyed by service name as
+// RateLimit does, with the wait set as a trailer through setTrailer
+func (g *GRPCGuards) rateLimit(ctx context.Context, setTrailer func(metadata.MD)) error {
+	if g.limits.RateLimiter == nil {
+		return nil
+	}
+	serviceName := defaultServiceName
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-service-name"); len(values) > 0 && values[0] != "" {
+			serviceName = values[0]
+		}
+	}
+
+	allowed, retryAfter := g.limits.RateLimiter.Allow("service:" + serviceName)
+	if allowed {
+		return nil
+	}
+	setTrailer(metadata.Pairs(ingest_models.MetadataRateLimitRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1)))
+	return status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+}
+
+func (g *GRPCGuards) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.limits.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.limits.Timeout)
+}
+
+// acquire waits for a free slot until ctx ends, then refuses the call with
+// codes.Unavailable so the caller retries
+func (g *GRPCGuards) acquire(ctx context.Context) (func(), error) {
+	if g.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return func() { <-g.slots }, nil
+	case <-ctx.Done():
+		return nil, status.Error(codes.Unavailable, "Too many concurrent requests")
+	}
+}
+
+// guardedStream carries the guarded context and counts the bytes received
+type guardedStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	maxBytes int64
+	received int64
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *guardedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if message, ok := m.(proto.Message); ok && s.maxBytes > 0 {
+		s.received += int64(proto.Size(message))
+		if s.received > s.maxBytes {
+			return status.Error(codes.ResourceExhausted, "Request body too large")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/maintenance"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// Maintenance rejects state-changing requests with 503 and the maintenance code
+// while maintenance mode is on. GET, HEAD and OPTIONS requests always pass, as
+// do the routes in exempt: the ones that only look things up despite being
+// POSTs, and the switch itself. Routes are matched by their declared path.
+func Maintenance(mode *maintenance.Mode, exempt ...string) gin.HandlerFunc {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if exemptPaths[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		status := mode.Status()
+		if !status.Active {
+			c.Next()
+			return
+		}
+
+		retryAfter := int(math.Ceil(mode.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, ingest_models.MaintenanceResponse{
+			Error:     "Service is in maintenance mode; writes are paused",
+			Code:      ingest_models.ErrorCodeMaintenance,
+			Reason:    status.Reason,
+			ExpiresAt: status.ExpiresAt,
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Route groups used as the group label on the HTTP metrics
+const (
+	GroupPublic   = "public"
+	GroupInternal = "internal"
+)
+
+// Prometheus metrics for HTTP requests, split by route group so internal ingest
+// load can be told apart from user traffic
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api_service",
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route group and status code.",
+	}, []string{"group", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api_service",
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route group.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"group"})
+
+	httpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "api_service",
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served, by route group.",
+	}, []string{"group"})
+
+	httpRequestsRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api_service",
+		Name:      "http_requests_rejected_total",
+		Help:      "HTTP requests rejected by the concurrency limit, by route group.",
+	}, []string{"group"})
+)
+
+// RequestMetrics records request counts, durations and in-flight requests. The
+// group is taken from the matched route: /internal routes are internal, the rest
+// public.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := GroupPublic
+		if path := c.FullPath(); path == "/internal" || strings.HasPrefix(path, "/internal/") {
+			group = GroupInternal
+		}
+
+		inFlight := httpRequestsInFlight.WithLabelValues(group)
+		inFlight.Inc()
+		start := time.Now()
+
+		c.Next()
+
+		inFlight.Dec()
+		httpRequestDuration.WithLabelValues(group).Observe(time.Since(start).Seconds())
+		httpRequestsTotal.WithLabelValues(group, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
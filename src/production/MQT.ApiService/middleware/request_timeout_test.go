@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// blockingPiRepo is a repository whose GetPi blocks like a stuck query until
+// its context is cancelled, then reports why. Calls it doesn't implement panic.
+type blockingPiRepo struct {
+	interfaces.PiRepository
+	started   chan struct{}
+	cancelled chan error
+}
+
+func (r *blockingPiRepo) GetPi(ctx context.Context, _ string) (*hardware_models.Pi, error) {
+	close(r.started)
+	<-ctx.Done()
+	r.cancelled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// A query blocked in the repository is cancelled when the request deadline
+// passes or the client goes away, whichever comes first
+func TestRequestTimeoutCancelsQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		disconnect bool // the client gives up after the query starts
+		want       error
+	}{
+		{name: "deadline", timeout: 20 * time.Millisecond, want: context.DeadlineExceeded},
+		{name: "client disconnects", timeout: time.Minute, disconnect: true, want: context.Canceled},
+		{name: "client disconnects without a timeout", disconnect: true, want: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &blockingPiRepo{started: make(chan struct{}), cancelled: make(chan error, 1)}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(RequestTimeout(tt.timeout))
+			router.GET("/pis/:pi_id", func(c *gin.Context) {
+				if _, err := repo.GetPi(c.Request.Context(), c.Param("pi_id")); err != nil {
+					c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+				}
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			clientCtx, disconnect := context.WithCancel(context.Background())
+			defer disconnect()
+			req, err := http.NewRequestWithContext(clientCtx, http.MethodGet, server.URL+"/pis/pi-1", nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			responded := make(chan *http.Response, 1)
+			go func() {
+				resp, _ := http.DefaultClient.Do(req)
+				responded <- resp
+			}()
+
+			select {
+			case <-repo.started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("query never started")
+			}
+			if tt.disconnect {
+				disconnect()
+			}
+
+			select {
+			case err := <-repo.cancelled:
+				if !errors.Is(err, tt.want) {
+					t.Errorf("query context ended with %v, want %v", err, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("query context was never cancelled")
+			}
+
+			resp := <-responded
+			if tt.disconnect {
+				return
+			}
+			if resp == nil {
+				t.Fatal("no response after the deadline")
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusGatewayTimeout {
+				t.Errorf("status %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+			}
+		})
+	}
+}
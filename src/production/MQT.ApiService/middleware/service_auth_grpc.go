@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxNonceLength bounds the nonce of a signed gRPC call, which the API keeps
+// until the call's timestamp expires
+const maxNonceLength = 64
+
+// ServiceAuthUnaryInterceptor checks the credentials of ServiceAuthMiddleware
+// on unary gRPC calls, sent as metadata. A signature covers the call's method,
+// timestamp, nonce and request, and each nonce is accepted once, so a captured
+// call can neither be replayed nor carry another request.
+func ServiceAuthUnaryInterceptor(allowBearer bool) grpc.UnaryServerInterceptor {
+	nonces := newNonceCache()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authenticateServiceCall(ctx, info.FullMethod, req, nonces, allowBearer); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ServiceAuthStreamInterceptor is ServiceAuthUnaryInterceptor for streaming
+// calls. Their messages arrive after the call is authenticated, so only the
+// method, timestamp and nonce are signed; the port belongs on the internal
+// network like INTERNAL_PORT.
+func ServiceAuthStreamInterceptor(allowBearer bool) grpc.StreamServerInterceptor {
+	nonces := newNonceCache()
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticateServiceCall(stream.Context(), info.FullMethod, nil, nonces, allowBearer); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// authenticateServiceCall checks a gRPC call's signature, made with
+// ingest_models.SignGRPCCall over req (nil for streams), and that its nonce is
+// new, or with allowBearer an unsigned call's bearer token
+func authenticateServiceCall(ctx context.Context, fullMethod string, req any, nonces *nonceCache, allowBearer bool) error {
+	secret := os.Getenv("INTERNAL_API_SECRET")
+	if secret == "" {
+		return status.Error(codes.Internal, "Internal API secret not configured")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	timestamp := first(ingest_models.HeaderInternalTimestamp)
+	signature := first(ingest_models.HeaderInternalSignature)
+	nonce := first(ingest_models.HeaderInternalNonce)
+
+	switch {
+	case timestamp != "" || signature != "":
+		if timestamp == "" || signature == "" || nonce == "" {
+			return status.Error(codes.Unauthenticated, "Signed calls need "+ingest_models.HeaderInternalTimestamp+", "+ingest_models.HeaderInternalNonce+" and "+ingest_models.HeaderInternalSignature)
+		}
+		if len(nonce) > maxNonceLength {
+			return status.Errorf(codes.Unauthenticated, "%s is longer than %d characters", ingest_models.HeaderInternalNonce, maxNonceLength)
+		}
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, "Invalid "+ingest_models.HeaderInternalTimestamp+". Expected Unix seconds")
+		}
+		signedAt := time.Unix(seconds, 0)
+		if skew := time.Since(signedAt); skew > serviceSignatureMaxSkew || skew < -serviceSignatureMaxSkew {
+			return status.Error(codes.Unauthenticated, "Call timestamp is outside the allowed window")
+		}
+
+		var request []byte
+		if req != nil {
+			if request, err = ingest_models.MarshalGRPCRequest(req); err != nil {
+				return status.Error(codes.Internal, "Failed to check call signature: "+err.Error())
+			}
+		}
+		expected := ingest_models.SignGRPCCall(secret, fullMethod, timestamp, nonce, request)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			return status.Error(codes.Unauthenticated, "Invalid call signature")
+		}
+		// Only checked once the signature passes, so nobody else can fill the cache
+		if !nonces.use(nonce, signedAt.Add(serviceSignatureMaxSkew)) {
+			return status.Error(codes.Unauthenticated, "Call was already made")
+		}
+	case allowBearer:
+		token, ok := strings.CutPrefix(first("authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return status.Error(codes.Unauthenticated, "Invalid service token")
+		}
+	default:
+		return status.Error(codes.Unauthenticated, "Missing "+ingest_models.HeaderInternalTimestamp+" and "+ingest_models.HeaderInternalSignature+" metadata")
+	}
+	return nil
+}
+
+// nonceCache remembers the nonces of signed calls until their timestamps
+// leave the allowed window, after which the signature refuses them anyway
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // nonce -> when it may be forgotten
+	pruned time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use records nonce until expires and reports whether it was new
+func (n *nonceCache) use(nonce string, expires time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(n.pruned) >= time.Minute {
+		for old, oldExpires := range n.seen {
+			if now.After(oldExpires) {
+				delete(n.seen, old)
+			}
+		}
+		n.pruned = now
+	}
+
+	if oldExpires, ok := n.seen[nonce]; ok && !now.After(oldExpires) {
+		return false
+	}
+	n.seen[nonce] = expires
+	return true
+}
@@ -1,45 +1,37 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/subtle"
+	"errors"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
 )
 
-// ServiceAuthMiddleware validates service-to-service authentication
-func ServiceAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get the Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Missing Authorization header",
-			})
-			c.Abort()
-			return
-		}
+// defaultServiceName is used when a caller doesn't identify itself
+const defaultServiceName = "mqtt-ingestor"
 
-		// Check if it's a Bearer token
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization format. Expected 'Bearer <token>'",
-			})
-			c.Abort()
-			return
-		}
-
-		// Extract the token
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Empty token",
-			})
-			c.Abort()
-			return
-		}
+// serviceSignatureMaxSkew is how far a signed request's timestamp may be from
+// the API's clock, either way; older signatures can't be replayed
+const serviceSignatureMaxSkew = 5 * time.Minute
 
+// ServiceAuthMiddleware validates service-to-service authentication. Requests
+// are signed with INTERNAL_API_SECRET (see ingest_models.SignServiceRequest)
+// and carry the time they were signed, so a captured request is only good for
+// a few minutes and the secret itself never travels. With allowBearer, requests
+// without a signature may instead send the secret as a bearer token, as every
+// caller did before signing; that is kept for one release so callers can be
+// upgraded after the API.
+func ServiceAuthMiddleware(allowBearer bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
 		// Get the expected secret from environment
 		expectedSecret := os.Getenv("INTERNAL_API_SECRET")
 		if expectedSecret == "" {
@@ -50,20 +42,147 @@ func ServiceAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Validate the token
-		if token != expectedSecret {
+		signed := c.GetHeader(ingest_models.HeaderInternalSignature) != "" || c.GetHeader(ingest_models.HeaderInternalTimestamp) != ""
+		var ok bool
+		switch {
+		case signed:
+			ok = verifyServiceSignature(c, expectedSecret)
+		case allowBearer:
+			ok = verifyServiceBearer(c, expectedSecret)
+		default:
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid service token",
+				"error": "Missing " + ingest_models.HeaderInternalTimestamp + " and " + ingest_models.HeaderInternalSignature + " headers",
 			})
 			c.Abort()
 			return
 		}
+		if !ok {
+			return
+		}
+
+		// Callers may identify themselves for auditing; the ingestor predates the header
+		serviceName := c.GetHeader("X-Service-Name")
+		if serviceName == "" {
+			serviceName = defaultServiceName
+		}
 
 		// Add service context to the request
 		c.Set("service_auth", true)
-		c.Set("service_name", "mqtt-ingestor")
+		c.Set("service_name", serviceName)
 
 		// Continue to the next handler
 		c.Next()
 	}
 }
+
+// verifyServiceSignature checks the request's signature and timestamp,
+// answering and aborting when they don't pass. The body is read to check it,
+// within the global body limit, and put back for the handler.
+func verifyServiceSignature(c *gin.Context, secret string) bool {
+	timestamp := c.GetHeader(ingest_models.HeaderInternalTimestamp)
+	signature := c.GetHeader(ingest_models.HeaderInternalSignature)
+	if timestamp == "" || signature == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Signed requests need both " + ingest_models.HeaderInternalTimestamp + " and " + ingest_models.HeaderInternalSignature,
+		})
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid " + ingest_models.HeaderInternalTimestamp + ". Expected Unix seconds",
+		})
+		return false
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > serviceSignatureMaxSkew || skew < -serviceSignatureMaxSkew {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Request timestamp is outside the allowed window",
+		})
+		return false
+	}
+
+	var body []byte
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		reader := io.Reader(c.Request.Body)
+		limit := GetMaxBodyBytes(c)
+		if limit > 0 {
+			reader = io.LimitReader(reader, limit+1)
+		}
+		body, err = io.ReadAll(reader)
+		c.Request.Body.Close()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Failed to read request body",
+			})
+			return false
+		}
+		if limit > 0 && int64(len(body)) > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "Request body too large",
+			})
+			return false
+		}
+		c.Request.Body = http.NoBody
+		if len(body) > 0 {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+
+	expected := ingest_models.SignServiceRequest(secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid request signature",
+		})
+		return false
+	}
+	return true
+}
+
+// verifyServiceBearer checks a plain INTERNAL_API_SECRET bearer token,
+// answering and aborting when it doesn't pass
+func verifyServiceBearer(c *gin.Context, secret string) bool {
+	// Get the Authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Missing Authorization header",
+		})
+		return false
+	}
+
+	// Check if it's a Bearer token
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid authorization format. Expected 'Bearer <token>'",
+		})
+		return false
+	}
+
+	// Extract the token
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Empty token",
+		})
+		return false
+	}
+
+	// Validate the token
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid service token",
+		})
+		return false
+	}
+	return true
+}
+
+// GetServiceNameFromGinContext retrieves the authenticated service name from Gin context
+func GetServiceNameFromGinContext(c *gin.Context) (string, error) {
+	serviceName := c.GetString("service_name")
+	if serviceName == "" {
+		return "", errors.New("service not found in context")
+	}
+	return serviceName, nil
+}
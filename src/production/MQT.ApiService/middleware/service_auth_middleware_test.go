@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+const (
+	testSecret   = "internal-secret"
+	testPath     = "/internal/readings?source=test"
+	testMaxBytes = 64
+)
+
+// newServiceAuthRouter echoes the body of every request that gets past
+// ServiceAuthMiddleware, so tests can check the body is put back
+func newServiceAuthRouter(allowBearer bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(BodyBinding(testMaxBytes, false), ServiceAuthMiddleware(allowBearer))
+	router.POST("/internal/readings", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+// signedRequest returns a request for testPath signed with secret as if the
+// caller's clock were skew ahead of the API's
+func signedRequest(secret, body string, skew time.Duration) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, testPath, strings.NewReader(body))
+	timestamp := strconv.FormatInt(time.Now().Add(skew).Unix(), 10)
+	req.Header.Set(ingest_models.HeaderInternalTimestamp, timestamp)
+	req.Header.Set(ingest_models.HeaderInternalSignature, ingest_models.SignServiceRequest(secret, http.MethodPost, testPath, timestamp, []byte(body)))
+	return req
+}
+
+func TestServiceAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretUnset bool
+		allowBearer bool
+		request     func() *http.Request
+		wantCode    int
+		wantBody    string // checked when the request passes
+	}{
+		{
+			name:     "signed",
+			request:  func() *http.Request { return signedRequest(testSecret, `{"pi_id":"pi-1"}`, 0) },
+			wantCode: http.StatusOK,
+			wantBody: `{"pi_id":"pi-1"}`,
+		},
+		{
+			name:     "signed without body",
+			request:  func() *http.Request { return signedRequest(testSecret, "", 0) },
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "clock behind within the window",
+			request:  func() *http.Request { return signedRequest(testSecret, "{}", -4*time.Minute) },
+			wantCode: http.StatusOK,
+			wantBody: "{}",
+		},
+		{
+			name:     "clock ahead within the window",
+			request:  func() *http.Request { return signedRequest(testSecret, "{}", 4*time.Minute) },
+			wantCode: http.StatusOK,
+			wantBody: "{}",
+		},
+		{
+			name:     "clock too far behind",
+			request:  func() *http.Request { return signedRequest(testSecret, "{}", -6*time.Minute) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "clock too far ahead",
+			request:  func() *http.Request { return signedRequest(testSecret, "{}", 6*time.Minute) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				req := signedRequest(testSecret, `{"pi_id":"pi-1"}`, 0)
+				req.Body = io.NopCloser(strings.NewReader(`{"pi_id":"pi-2"}`))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			request: func() *http.Request {
+				req := signedRequest(testSecret, "{}", 0)
+				req.URL.RawQuery = "source=other"
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong secret",
+			request:  func() *http.Request { return signedRequest("other-secret", "{}", 0) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature",
+			request: func() *http.Request {
+				req := signedRequest(testSecret, "{}", 0)
+				req.Header.Del(ingest_models.HeaderInternalSignature)
+				return req
+			},
+			allowBearer: true,
+			wantCode:    http.StatusUnauthorized,
+		},
+		{
+			name: "missing timestamp",
+			request: func() *http.Request {
+				req := signedRequest(testSecret, "{}", 0)
+				req.Header.Del(ingest_models.HeaderInternalTimestamp)
+				return req
+			},
+			allowBearer: true,
+			wantCode:    http.StatusUnauthorized,
+		},
+		{
+			name: "timestamp not in seconds",
+			request: func() *http.Request {
+				req := signedRequest(testSecret, "{}", 0)
+				req.Header.Set(ingest_models.HeaderInternalTimestamp, time.Now().Format(time.RFC3339))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "signed body over the limit",
+			request:  func() *http.Request { return signedRequest(testSecret, strings.Repeat("x", testMaxBytes+1), 0) },
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "missing headers",
+			request:  func() *http.Request { return httptest.NewRequest(http.MethodPost, testPath, strings.NewReader("{}")) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "bearer when not allowed",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, testPath, strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer "+testSecret)
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "bearer when allowed",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, testPath, strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer "+testSecret)
+				return req
+			},
+			allowBearer: true,
+			wantCode:    http.StatusOK,
+			wantBody:    "{}",
+		},
+		{
+			name: "wrong bearer",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, testPath, strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer other-secret")
+				return req
+			},
+			allowBearer: true,
+			wantCode:    http.StatusUnauthorized,
+		},
+		{
+			name:        "secret not configured",
+			secretUnset: true,
+			request:     func() *http.Request { return signedRequest("", "{}", 0) },
+			wantCode:    http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := testSecret
+			if tt.secretUnset {
+				secret = ""
+			}
+			t.Setenv("INTERNAL_API_SECRET", secret)
+
+			w := httptest.NewRecorder()
+			newServiceAuthRouter(tt.allowBearer).ServeHTTP(w, tt.request())
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode == http.StatusOK && w.Body.String() != tt.wantBody {
+				t.Errorf("handler read body %q, want %q", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
+)
+
+// ServiceVersionHeader names the build that answered a request
+const ServiceVersionHeader = "X-Service-Version"
+
+// ServiceVersion sets X-Service-Version on every response, so a response can
+// be traced to a build while a rollout is in progress
+func ServiceVersion() gin.HandlerFunc {
+	version := buildinfo.Get().Version
+	return func(c *gin.Context) {
+		c.Header(ServiceVersionHeader, version)
+		c.Next()
+	}
+}
@@ -0,0 +1,235 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/middleware"
+)
+
+// Access is the authentication a route requires. The registry attaches the
+// matching middleware, so controllers never add Authenticate or RequireAdmin
+// themselves.
+type Access int
+
+const (
+	// Public routes need no credentials
+	Public Access = iota
+	// Authenticated routes need a user token; handlers check ownership
+	Authenticated
+	// Admin routes need a user token with the admin role
+	Admin
+	// Service routes need the internal service secret and are served on the
+	// internal listener
+	Service
+)
+
+// String returns the access level as shown in the route table
+func (a Access) String() string {
+	switch a {
+	case Public:
+		return "public"
+	case Authenticated:
+		return "authenticated"
+	case Admin:
+		return "admin"
+	case Service:
+		return "service"
+	default:
+		return "unknown"
+	}
+}
+
+// Permits reports whether a user token passes the route's access checks.
+// isAdmin must follow the same rule as the RequireAdmin middleware. Service
+// routes never accept user tokens.
+func (a Access) Permits(isAdmin bool) bool {
+	switch a {
+	case Public, Authenticated:
+		return true
+	case Admin:
+		return isAdmin
+	default:
+		return false
+	}
+}
+
+// Route is a single endpoint declared by a controller. Middleware runs after
+// the access checks and before Handler.
+type Route struct {
+	Method     string
+	Path       string
+	Access     Access
+	Middleware []gin.HandlerFunc
+	Handler    gin.HandlerFunc
+}
+
+// RouteInfo is one row of the route table
+type RouteInfo struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Access     string `json:"access"`
+	Controller string `json:"controller"`
+}
+
+type registeredRoute struct {
+	Route
+	controller string
+}
+
+// Registry collects routes from every controller and registers them on the
+// engines in one step, with the same middleware order for every route
+type Registry struct {
+	authMiddleware *middleware.AuthMiddleware
+	serviceAuth    gin.HandlerFunc
+	routes         []registeredRoute
+
+	// owners maps "METHOD path" (with parameter names removed) to the
+	// controller that declared it
+	owners map[string]string
+	// params maps "METHOD prefix" to the parameter name used at the next
+	// segment, since gin panics when two routes name the same segment differently
+	params map[string]registeredParam
+}
+
+type registeredParam struct {
+	name       string
+	controller string
+}
+
+// NewRegistry creates an empty route registry
+func NewRegistry(authMiddleware *middleware.AuthMiddleware, serviceAuth gin.HandlerFunc) *Registry {
+	return &Registry{
+		authMiddleware: authMiddleware,
+		serviceAuth:    serviceAuth,
+		owners:         make(map[string]string),
+		params:         make(map[string]registeredParam),
+	}
+}
+
+// Add declares routes on behalf of controller. It fails, naming both
+// controllers, when a route is already declared or uses a different parameter
+// name for a path segment another route already named.
+func (r *Registry) Add(controller string, routes ...Route) error {
+	for _, route := range routes {
+		key := route.Method + " " + normalizePath(route.Path)
+		if owner, ok := r.owners[key]; ok {
+			return fmt.Errorf("route %s %s declared by %s is already registered by %s", route.Method, route.Path, controller, owner)
+		}
+
+		segments := strings.Split(strings.Trim(route.Path, "/"), "/")
+		for i, segment := range segments {
+			if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+				continue
+			}
+			prefix := route.Method + " /" + normalizePath(strings.Join(segments[:i], "/"))
+			if existing, ok := r.params[prefix]; ok && existing.name != segment {
+				return fmt.Errorf("route %s %s declared by %s names a path parameter %s where %s uses %s",
+					route.Method, route.Path, controller, segment, existing.controller, existing.name)
+			}
+		}
+
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				prefix := route.Method + " /" + normalizePath(strings.Join(segments[:i], "/"))
+				if _, ok := r.params[prefix]; !ok {
+					r.params[prefix] = registeredParam{name: segment, controller: controller}
+				}
+			}
+		}
+		r.owners[key] = controller
+		r.routes = append(r.routes, registeredRoute{Route: route, controller: controller})
+	}
+	return nil
+}
+
+// normalizePath drops parameter names so /pis/:id and /pis/:pi_id compare equal
+func normalizePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			segments[i] = ":"
+		case strings.HasPrefix(segment, "*"):
+			segments[i] = "*"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Apply registers every declared route. Service routes go on internal, all
+// others on public; pass the same engine twice to share one listener.
+func (r *Registry) Apply(public, internal *gin.Engine) {
+	for _, route := range r.routes {
+		engine := public
+		if route.Access == Service {
+			engine = internal
+		}
+		engine.Handle(route.Method, route.Path, r.handlers(route.Route)...)
+	}
+}
+
+// handlers returns the chain for a route: access checks, then the route's own
+// middleware, then the handler
+func (r *Registry) handlers(route Route) []gin.HandlerFunc {
+	var chain []gin.HandlerFunc
+	switch route.Access {
+	case Authenticated:
+		chain = append(chain, r.authMiddleware.Authenticate())
+	case Admin:
+		chain = append(chain, r.authMiddleware.Authenticate(), r.authMiddleware.RequireAdmin())
+	case Service:
+		chain = append(chain, r.serviceAuth)
+	}
+	chain = append(chain, route.Middleware...)
+	return append(chain, route.Handler)
+}
+
+// Routes returns the route table sorted by path and method, for documentation
+// and API description tooling
+func (r *Registry) Routes() []RouteInfo {
+	return r.table(func(Access) bool { return true })
+}
+
+// RoutesFor returns the part of the route table a user token may call, public
+// routes excluded, sorted like Routes. It reads the same access levels the
+// registered middleware enforces, so the two can't disagree.
+func (r *Registry) RoutesFor(isAdmin bool) []RouteInfo {
+	return r.table(func(access Access) bool { return access != Public && access.Permits(isAdmin) })
+}
+
+// Permits reports whether a user token may call the route declared as method
+// and path; undeclared routes are never permitted
+func (r *Registry) Permits(method, path string, isAdmin bool) bool {
+	for _, route := range r.routes {
+		if route.Method == method && route.Path == path {
+			return route.Access.Permits(isAdmin)
+		}
+	}
+	return false
+}
+
+// table lists the routes whose access level passes include, sorted by path and method
+func (r *Registry) table(include func(Access) bool) []RouteInfo {
+	table := []RouteInfo{}
+	for _, route := range r.routes {
+		if !include(route.Access) {
+			continue
+		}
+		table = append(table, RouteInfo{
+			Method:     route.Method,
+			Path:       route.Path,
+			Access:     route.Access.String(),
+			Controller: route.controller,
+		})
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Path != table[j].Path {
+			return table[i].Path < table[j].Path
+		}
+		return table[i].Method < table[j].Method
+	})
+	return table
+}
@@ -0,0 +1,52 @@
+// Package buildinfo identifies the running build. The values are injected at
+// build time, the same for every binary:
+//
+//	go build -ldflags "-X gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo.Version=v1.2.3 \
+//	  -X gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo.Commit=abc1234 \
+//	  -X gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo.BuildDate=2026-01-02T15:04:05Z"
+package buildinfo
+
+import "runtime/debug"
+
+// Set with -ldflags -X; see the package comment
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Get returns the injected build values. A commit or date that wasn't injected
+// falls back to the VCS stamp the go tool embeds when building from a checkout,
+// and then to "dev".
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+	if info.Commit == "" || info.BuildDate == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				switch {
+				case setting.Key == "vcs.revision" && info.Commit == "":
+					info.Commit = setting.Value
+				case setting.Key == "vcs.time" && info.BuildDate == "":
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "dev"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "dev"
+	}
+	return info
+}
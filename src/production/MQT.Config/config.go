@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
 )
 
 // Config holds all application configuration
@@ -29,6 +30,34 @@ type Config struct {
 
 	// CORS configuration
 	CORS CORSConfig `json:"cors"`
+
+	// Internal (service-to-service) API configuration
+	Internal InternalConfig `json:"internal"`
+
+	// Shutdown sequencing configuration
+	Shutdown ShutdownConfig `json:"shutdown"`
+
+	// Notification delivery channels
+	Notifications NotificationsConfig `json:"notifications"`
+
+	// Reading insert latency budget
+	StorageMonitor StorageMonitorConfig `json:"storage_monitor"`
+
+	// Opt-in anonymous usage statistics
+	Telemetry TelemetryConfig `json:"telemetry"`
+
+	// Maintenance mode, which pauses writes
+	Maintenance MaintenanceConfig `json:"maintenance"`
+
+	// Per-Pi storage accounting and soft limits
+	StorageAccounting StorageAccountingConfig `json:"storage_accounting"`
+
+	// Reading query semantics
+	Readings ReadingsConfig `json:"readings"`
+	Purge    PurgeConfig    `json:"purge"`
+
+	// Demo and test data seeding
+	Seed SeedConfig `json:"seed"`
 }
 
 // ServerConfig holds server-related configuration
@@ -37,6 +66,23 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `json:"read_timeout"`
 	WriteTimeout time.Duration `json:"write_timeout"`
 	IdleTimeout  time.Duration `json:"idle_timeout"`
+	MaxBodyBytes int64         `json:"max_body_bytes"` // JSON request body limit, 0 disables
+	StrictJSON   bool          `json:"strict_json"`    // reject unknown JSON fields on every route
+
+	// RequestTimeout bounds the context handed to repositories; keep it below
+	// WriteTimeout so the handler can still write its error response. 0 disables.
+	RequestTimeout time.Duration `json:"request_timeout"`
+
+	// StartupStrict exits on any startup failure. When false, retryable steps
+	// (indexes, role seeding, admin user) are retried in the background instead.
+	StartupStrict bool `json:"startup_strict"`
+
+	// MetaLookupKeys are the meta keys /pis/lookup and /devices/lookup accept
+	MetaLookupKeys []string `json:"meta_lookup_keys"`
+
+	// TimestampPrecision is what reading timestamps are truncated to on the way in
+	// and the fixed precision they are serialized with: 1s, 1ms or 1us
+	TimestampPrecision time.Duration `json:"timestamp_precision"`
 }
 
 // DatabaseConfig holds database-related configuration
@@ -53,28 +99,80 @@ type DatabaseConfig struct {
 
 // MQTTConfig holds MQTT-related configuration
 type MQTTConfig struct {
-	BrokerHost  string        `json:"broker_host"`
+	BrokerHost  string        `json:"broker_host"` // one host or a comma-separated list for failover
 	BrokerPort  int           `json:"broker_port"`
+	BrokerURLs  string        `json:"broker_urls"` // comma-separated; takes precedence over BrokerHost
 	BrokerUser  string        `json:"broker_user"`
 	BrokerPass  string        `json:"broker_pass"`
 	UseTLS      bool          `json:"use_tls"`
 	CACertPath  string        `json:"ca_cert_path"`
-	Topic       string        `json:"topic"`
+	Topic       string        `json:"topic"` // one topic filter or a comma-separated list
 	ClientID    string        `json:"client_id"`
 	SharedGroup string        `json:"shared_group"`
 	KeepAlive   time.Duration `json:"keep_alive"`
 	PingTimeout time.Duration `json:"ping_timeout"`
+
+	ConnectRetryInterval time.Duration `json:"connect_retry_interval"` // wait between initial connection attempts
+	MaxReconnectInterval time.Duration `json:"max_reconnect_interval"` // cap on the reconnect backoff
+	DisconnectQuiesce    time.Duration `json:"disconnect_quiesce"`     // time allowed for in-flight work on disconnect
+
+	QoS           byte `json:"qos"`            // QoS requested for the reading and discovery subscriptions
+	ErrorQoS      byte `json:"error_qos"`      // QoS of errors published back to Pis
+	ErrorRetained bool `json:"error_retained"` // publish those errors retained
+}
+
+// Topics returns the topic filters readings are subscribed on
+func (m MQTTConfig) Topics() []string {
+	return mqtmodels.ParseTopicFilters(m.Topic)
+}
+
+// ValidateQoS checks the subscription and error QoS levels are 0, 1 or 2
+func (m MQTTConfig) ValidateQoS() error {
+	if m.QoS > 2 {
+		return fmt.Errorf("MQTT_QOS must be 0, 1 or 2")
+	}
+	if m.ErrorQoS > 2 {
+		return fmt.Errorf("MQTT_ERROR_QOS must be 0, 1 or 2")
+	}
+	return nil
+}
+
+// Brokers returns the URLs of the configured brokers, in the order they are tried
+func (m MQTTConfig) Brokers() ([]string, error) {
+	list := m.BrokerURLs
+	if list == "" {
+		list = m.BrokerHost
+	}
+	return mqtmodels.ParseBrokerURLs(list, m.BrokerPort, m.UseTLS)
 }
 
 // AuthConfig holds authentication-related configuration
 type AuthConfig struct {
-	JWTSecretKey               string        `json:"jwt_secret_key"`
-	JWTIssuer                  string        `json:"jwt_issuer"`
-	AccessTokenDuration        time.Duration `json:"access_token_duration"`
-	RefreshTokenDuration       time.Duration `json:"refresh_token_duration"`
-	PasswordMinLength          int           `json:"password_min_length"`
-	PasswordRequireSpecialChar bool          `json:"password_require_special_char"`
-	Admin                      AdminConfig   `json:"admin"`
+	JWTSecretKey               string             `json:"jwt_secret_key"`
+	JWTIssuer                  string             `json:"jwt_issuer"`
+	AccessTokenDuration        time.Duration      `json:"access_token_duration"`
+	RefreshTokenDuration       time.Duration      `json:"refresh_token_duration"`
+	PasswordMinLength          int                `json:"password_min_length"`
+	PasswordRequireSpecialChar bool               `json:"password_require_special_char"`
+	Admin                      AdminConfig        `json:"admin"`
+	ImpersonationTokenDuration time.Duration      `json:"impersonation_token_duration"`
+	AllowAdminImpersonation    bool               `json:"allow_admin_impersonation"` // allow admins to impersonate other admins
+	PasswordHash               PasswordHashConfig `json:"password_hash"`
+	RoleReloadInterval         time.Duration      `json:"role_reload_interval"` // how often roles are re-read from the database, 0 disables
+
+	// Email changes are confirmed from the new address; changing email needs SMTP
+	EmailChangeTTL  time.Duration `json:"email_change_ttl"`  // how long a pending change can be confirmed
+	EmailConfirmURL string        `json:"email_confirm_url"` // link sent in the confirmation email; ?token= is appended
+}
+
+// PasswordHashConfig holds the parameters for new password hashes. Existing
+// hashes in any supported format still verify and are upgraded on login.
+type PasswordHashConfig struct {
+	Algorithm       string `json:"algorithm"` // "argon2id" or "bcrypt"
+	BcryptCost      int    `json:"bcrypt_cost"`
+	Argon2Time      uint32 `json:"argon2_time"`
+	Argon2MemoryKiB uint32 `json:"argon2_memory_kib"`
+	Argon2Threads   uint8  `json:"argon2_threads"`
 }
 
 // AdminConfig holds admin user configuration
@@ -82,6 +180,8 @@ type AdminConfig struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Reactivate lets startup reactivate a deactivated admin holding Username
+	Reactivate bool `json:"reactivate"`
 }
 
 // LoggingConfig holds logging-related configuration
@@ -102,6 +202,148 @@ type CORSConfig struct {
 	MaxAge           int      `json:"max_age"`
 }
 
+// InternalConfig holds configuration for the internal service-to-service API
+type InternalConfig struct {
+	PiBatchMaxSize   int  `json:"pi_batch_max_size"`   // maximum entries per POST /internal/pis
+	PiBatchRateLimit int  `json:"pi_batch_rate_limit"` // POST /internal/pis requests per minute per service
+	RequireOwnedPi   bool `json:"require_owned_pi"`    // reject readings for Pis with no owner
+
+	IngestStatsMaxSeries int `json:"ingest_stats_max_series"` // (pi, device) pairs kept in the in-memory ingest counters
+
+	IngestorHeartbeatTTL time.Duration `json:"ingestor_heartbeat_ttl"` // ingestors that haven't reported for this long drop off /admin/ingestors
+
+	// Payload schema validation on /internal/readings
+	ValidatePayloads bool          `json:"validate_payloads"` // check payloads against their device type's active schema
+	SchemaCacheTTL   time.Duration `json:"schema_cache_ttl"`  // how long active schemas and device types are cached per replica
+
+	// Guards for the /internal group so ingest bursts can't starve the public API
+	RequestTimeout time.Duration `json:"request_timeout"` // deadline for /internal requests, shorter than REQUEST_TIMEOUT
+	MaxConcurrent  int           `json:"max_concurrent"`  // /internal requests served at once; 0 disables the limit
+	MaxBodyBytes   int64         `json:"max_body_bytes"`  // body size limit for /internal requests; 0 keeps MAX_REQUEST_BODY_BYTES
+	Port           string        `json:"port"`            // serve /internal on its own listener; empty shares PORT
+	GRPCPort       string        `json:"grpc_port"`       // serve the ingestor's gRPC transport on this port; empty disables it
+	GRPCRateLimit  int           `json:"grpc_rate_limit"` // gRPC calls per minute per service; 0 disables the limit
+
+	// Topic on the MQTT broker where Pi and device changes are published, signed
+	// with INTERNAL_API_SECRET, so ingestors evict them from their validation
+	// caches at once; empty disables it
+	CacheInvalidationTopic string `json:"cache_invalidation_topic"`
+
+	// Accept unsigned requests carrying INTERNAL_API_SECRET as a bearer token, for
+	// callers that don't sign their requests yet; to be removed next release
+	AllowBearerAuth bool `json:"allow_bearer_auth"`
+
+	// Topic prefixes for the broker ACL hook; each is followed by the Pi's own pi_id level
+	MQTTSensorTopicPrefix  string `json:"mqtt_sensor_topic_prefix"`  // Pis publish readings here
+	MQTTCommandTopicPrefix string `json:"mqtt_command_topic_prefix"` // Pis subscribe to commands here
+	MQTTErrorTopicPrefix   string `json:"mqtt_error_topic_prefix"`   // Pis subscribe to ingestion errors here
+	MQTTDiscoveryPrefix    string `json:"mqtt_discovery_prefix"`     // Pis announce new devices here
+}
+
+// ShutdownConfig holds graceful shutdown sequencing configuration
+type ShutdownConfig struct {
+	DrainDelay   time.Duration `json:"drain_delay"`   // time between reporting not-ready and stopping work
+	PhaseTimeout time.Duration `json:"phase_timeout"` // upper bound for each shutdown phase
+}
+
+// NotificationsConfig holds notification channel configuration
+type NotificationsConfig struct {
+	DefaultChannels []string      `json:"default_channels"` // used when a recipient has no preference
+	MaxAttempts     int           `json:"max_attempts"`     // delivery attempts per channel
+	RetryBackoff    time.Duration `json:"retry_backoff"`    // first retry delay, doubled per attempt
+	DigestInterval  time.Duration `json:"digest_interval"`  // how often held-back notifications are checked; 0 disables digests
+
+	Email   EmailNotifierConfig   `json:"email"`
+	Webhook WebhookNotifierConfig `json:"webhook"`
+	MQTT    MQTTNotifierConfig    `json:"mqtt"`
+}
+
+// StorageMonitorConfig holds the reading insert latency budget. Storage is reported
+// degraded once p95 insert latency exceeds the budget for ConsecutiveWindows windows.
+type StorageMonitorConfig struct {
+	InsertLatencyBudget time.Duration `json:"insert_latency_budget"` // 0 disables the monitor
+	Window              time.Duration `json:"window"`
+	ConsecutiveWindows  int           `json:"consecutive_windows"`
+}
+
+// TelemetryConfig holds the opt-in anonymous usage report. Nothing is sent
+// unless Enabled is set.
+type TelemetryConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Endpoint string        `json:"endpoint"` // URL the report is POSTed to
+	Interval time.Duration `json:"interval"` // time between reports
+}
+
+// StorageAccountingConfig holds the job that apportions the readings table's size
+// between Pis, and the soft limits that notify when crossed. The job only runs
+// inside the optional daily window (UTC, may wrap past midnight) so it can be
+// kept to off-peak hours.
+type StorageAccountingConfig struct {
+	Interval            time.Duration `json:"interval"`          // time between runs; 0 disables accounting
+	StatementTimeout    time.Duration `json:"statement_timeout"` // cap on each accounting query
+	WindowStart         string        `json:"window_start"`      // "HH:MM"; empty runs at any time
+	WindowEnd           string        `json:"window_end"`
+	PiSoftLimitBytes    int64         `json:"pi_soft_limit_bytes"`    // 0 disables the per-Pi limit
+	TotalSoftLimitBytes int64         `json:"total_soft_limit_bytes"` // 0 disables the readings table limit
+}
+
+// MaintenanceConfig holds how maintenance mode is shared between replicas
+type MaintenanceConfig struct {
+	Persist      bool          `json:"persist"`       // store the switch in the database so every replica sees it
+	PollInterval time.Duration `json:"poll_interval"` // how often replicas reload the stored switch
+	RetryAfter   time.Duration `json:"retry_after"`   // Retry-After sent while maintenance has no expiry
+}
+
+// ReadingsConfig holds how reading queries interpret their time range
+type ReadingsConfig struct {
+	// InclusiveTo makes "to" an inclusive bound by default, as it was before
+	// ranges became half-open [from, to). Deprecated: clients should page with
+	// half-open ranges or pass inclusive_to=true.
+	InclusiveTo bool `json:"inclusive_to"`
+}
+
+// PurgeConfig holds how admin reading purges delete. Ranges with more readings
+// than AsyncThreshold are deleted by a background job in chunks of ChunkSize,
+// pausing ChunkPause between chunks, instead of in one statement.
+type PurgeConfig struct {
+	AsyncThreshold int64         `json:"async_threshold"`
+	ChunkSize      int           `json:"chunk_size"`
+	ChunkPause     time.Duration `json:"chunk_pause"`
+}
+
+// SeedConfig guards POST /admin/seed. Seeding is refused unless Allowed, and
+// refused against a database holding more than MaxExistingRows users, pis,
+// devices and readings together unless the request forces it.
+type SeedConfig struct {
+	Allowed         bool  `json:"allowed"`
+	MaxExistingRows int64 `json:"max_existing_rows"`
+}
+
+// EmailNotifierConfig holds SMTP settings for email notifications
+type EmailNotifierConfig struct {
+	Enabled  bool   `json:"enabled"`
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort int    `json:"smtp_port"`
+	Username string `json:"username"`
+	Password string `json:"-"`
+	From     string `json:"from"`
+}
+
+// WebhookNotifierConfig holds settings for generic/Slack webhook notifications
+type WebhookNotifierConfig struct {
+	Enabled     bool          `json:"enabled"`
+	URL         string        `json:"-" redact:"true"` // Slack webhook URLs embed their secret
+	SlackFormat bool          `json:"slack_format"`    // send {"text": ...} instead of the full notification
+	Timeout     time.Duration `json:"timeout"`
+}
+
+// MQTTNotifierConfig holds settings for notifications published over MQTT
+type MQTTNotifierConfig struct {
+	Enabled       bool   `json:"enabled"`
+	TopicTemplate string `json:"topic_template"` // e.g., "notifications/{user_id}"
+	QoS           byte   `json:"qos"`
+}
+
 // BatchConfig holds batch processing configuration
 type BatchConfig struct {
 	Size   int           `json:"size"`
@@ -110,11 +352,12 @@ type BatchConfig struct {
 
 // IngestorConfig holds configuration for the MQTT Ingestor service
 type IngestorConfig struct {
-	Server            ServerConfig  `json:"server"`
-	MQTT              MQTTConfig    `json:"mqtt"`
-	Logging           LoggingConfig `json:"logging"`
-	ApiServiceURL     string        `json:"api_service_url"`
-	InternalAPISecret string        `json:"internal_api_secret"`
+	Server            ServerConfig   `json:"server"`
+	MQTT              MQTTConfig     `json:"mqtt"`
+	Logging           LoggingConfig  `json:"logging"`
+	Shutdown          ShutdownConfig `json:"shutdown"`
+	ApiServiceURL     string         `json:"api_service_url"`
+	InternalAPISecret string         `json:"internal_api_secret"`
 }
 
 // LoadIngestorConfig loads configuration for the MQTT Ingestor service
@@ -135,6 +378,7 @@ func LoadIngestorConfig() (*IngestorConfig, error) {
 		MQTT: MQTTConfig{
 			BrokerHost:  getEnv("BROKER_HOST", "localhost"),
 			BrokerPort:  getInt("BROKER_PORT", 1883),
+			BrokerURLs:  getEnv("BROKER_URLS", ""),
 			BrokerUser:  getEnv("BROKER_USER", ""),
 			BrokerPass:  getEnv("BROKER_PASS", ""),
 			UseTLS:      getBool("BROKER_TLS", false),
@@ -144,6 +388,14 @@ func LoadIngestorConfig() (*IngestorConfig, error) {
 			SharedGroup: getEnv("MQTT_SHARED_GROUP", ""),
 			KeepAlive:   getDuration("MQTT_KEEP_ALIVE", 30*time.Second),
 			PingTimeout: getDuration("MQTT_PING_TIMEOUT", 10*time.Second),
+
+			ConnectRetryInterval: getDuration("MQTT_CONNECT_RETRY_INTERVAL", 5*time.Second),
+			MaxReconnectInterval: getDuration("MQTT_MAX_RECONNECT_INTERVAL", 10*time.Minute),
+			DisconnectQuiesce:    getDuration("MQTT_DISCONNECT_QUIESCE", 500*time.Millisecond),
+
+			QoS:           byte(getInt("MQTT_QOS", 1)),
+			ErrorQoS:      byte(getInt("MQTT_ERROR_QOS", 1)),
+			ErrorRetained: getBool("MQTT_ERROR_RETAINED", false),
 		},
 		Logging: LoggingConfig{
 			Level:        getEnv("LOG_LEVEL", "info"),
@@ -151,6 +403,10 @@ func LoadIngestorConfig() (*IngestorConfig, error) {
 			Output:       getEnv("LOG_OUTPUT", "stdout"),
 			EnableCaller: getBool("LOG_ENABLE_CALLER", false),
 		},
+		Shutdown: ShutdownConfig{
+			DrainDelay:   getDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+			PhaseTimeout: getDuration("SHUTDOWN_PHASE_TIMEOUT", 10*time.Second),
+		},
 		ApiServiceURL:     getEnv("API_SERVICE_URL", "http://api-service:9002"),
 		InternalAPISecret: getRequiredEnv("INTERNAL_API_SECRET"),
 	}
@@ -162,6 +418,21 @@ func LoadIngestorConfig() (*IngestorConfig, error) {
 	if config.InternalAPISecret == "" {
 		return nil, fmt.Errorf("INTERNAL_API_SECRET is required")
 	}
+	if config.Shutdown.DrainDelay < 0 || config.Shutdown.PhaseTimeout <= 0 {
+		return nil, fmt.Errorf("shutdown drain delay must not be negative and phase timeout must be positive")
+	}
+	if _, err := config.MQTT.Brokers(); err != nil {
+		return nil, fmt.Errorf("BROKER_URLS or BROKER_HOST: %w", err)
+	}
+	if err := config.MQTT.ValidateQoS(); err != nil {
+		return nil, err
+	}
+	if config.MQTT.PingTimeout <= 0 || config.MQTT.PingTimeout >= config.MQTT.KeepAlive {
+		return nil, fmt.Errorf("MQTT_PING_TIMEOUT must be positive and shorter than MQTT_KEEP_ALIVE")
+	}
+	if config.MQTT.ConnectRetryInterval <= 0 || config.MQTT.MaxReconnectInterval < config.MQTT.ConnectRetryInterval {
+		return nil, fmt.Errorf("MQTT_CONNECT_RETRY_INTERVAL must be positive and MQTT_MAX_RECONNECT_INTERVAL not shorter than it")
+	}
 
 	return config, nil
 }
@@ -180,6 +451,14 @@ func LoadApiConfig() (*Config, error) {
 			ReadTimeout:  getDuration("READ_TIMEOUT", 30*time.Second),
 			WriteTimeout: getDuration("WRITE_TIMEOUT", 30*time.Second),
 			IdleTimeout:  getDuration("IDLE_TIMEOUT", 120*time.Second),
+			MaxBodyBytes: int64(getInt("MAX_REQUEST_BODY_BYTES", 1<<20)),
+			StrictJSON:   getBool("STRICT_JSON_BINDING", false),
+
+			RequestTimeout: getDuration("REQUEST_TIMEOUT", 25*time.Second),
+			StartupStrict:  getBool("STARTUP_STRICT", false),
+			MetaLookupKeys: getStringSlice("META_LOOKUP_KEYS", []string{"serial", "asset_tag"}),
+
+			TimestampPrecision: getDuration("TIMESTAMP_PRECISION", time.Millisecond),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("POSTGRES_HOST", "localhost"),
@@ -191,10 +470,12 @@ func LoadApiConfig() (*Config, error) {
 			MaxConns: getInt("POSTGRES_MAX_CONNS", 25),
 			MinConns: getInt("POSTGRES_MIN_CONNS", 5),
 		},
-		// Minimal MQTT config for API (not used but required for struct)
+		// Broker the API publishes cache invalidations to, when
+		// CACHE_INVALIDATION_TOPIC is set
 		MQTT: MQTTConfig{
 			BrokerHost:  getEnv("BROKER_HOST", "localhost"),
 			BrokerPort:  getInt("BROKER_PORT", 1883),
+			BrokerURLs:  getEnv("BROKER_URLS", ""),
 			BrokerUser:  getEnv("BROKER_USER", ""),
 			BrokerPass:  getEnv("BROKER_PASS", ""),
 			UseTLS:      getBool("BROKER_TLS", false),
@@ -204,6 +485,14 @@ func LoadApiConfig() (*Config, error) {
 			SharedGroup: getEnv("MQTT_SHARED_GROUP", ""),
 			KeepAlive:   getDuration("MQTT_KEEP_ALIVE", 30*time.Second),
 			PingTimeout: getDuration("MQTT_PING_TIMEOUT", 10*time.Second),
+
+			ConnectRetryInterval: getDuration("MQTT_CONNECT_RETRY_INTERVAL", 5*time.Second),
+			MaxReconnectInterval: getDuration("MQTT_MAX_RECONNECT_INTERVAL", 10*time.Minute),
+			DisconnectQuiesce:    getDuration("MQTT_DISCONNECT_QUIESCE", 500*time.Millisecond),
+
+			QoS:           byte(getInt("MQTT_QOS", 1)),
+			ErrorQoS:      byte(getInt("MQTT_ERROR_QOS", 1)),
+			ErrorRetained: getBool("MQTT_ERROR_RETAINED", false),
 		},
 		Auth: AuthConfig{
 			JWTSecretKey:               getEnv("JWT_SECRET_KEY", "change-this-secret-in-production"),
@@ -213,10 +502,23 @@ func LoadApiConfig() (*Config, error) {
 			PasswordMinLength:          getInt("PASSWORD_MIN_LENGTH", 8),
 			PasswordRequireSpecialChar: getBool("PASSWORD_REQUIRE_SPECIAL_CHAR", true),
 			Admin: AdminConfig{
-				Username: getEnv("ADMIN_USERNAME", "admin"),
-				Email:    getEnv("ADMIN_EMAIL", "admin@example.com"),
-				Password: getEnv("ADMIN_PASSWORD", "adminpassword123"),
+				Username:   getEnv("ADMIN_USERNAME", "admin"),
+				Email:      getEnv("ADMIN_EMAIL", "admin@example.com"),
+				Password:   getEnv("ADMIN_PASSWORD", "adminpassword123"),
+				Reactivate: getBool("ADMIN_REACTIVATE", false),
+			},
+			PasswordHash: PasswordHashConfig{
+				Algorithm:       getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+				BcryptCost:      getInt("BCRYPT_COST", 10),
+				Argon2Time:      uint32(getInt("ARGON2_TIME", 3)),
+				Argon2MemoryKiB: uint32(getInt("ARGON2_MEMORY_KIB", 64*1024)),
+				Argon2Threads:   uint8(getInt("ARGON2_THREADS", 2)),
 			},
+			ImpersonationTokenDuration: getDuration("JWT_IMPERSONATION_TOKEN_DURATION", 15*time.Minute),
+			AllowAdminImpersonation:    getBool("ALLOW_ADMIN_IMPERSONATION", false),
+			RoleReloadInterval:         getDuration("ROLE_RELOAD_INTERVAL", time.Minute),
+			EmailChangeTTL:             getDuration("EMAIL_CHANGE_TTL", 24*time.Hour),
+			EmailConfirmURL:            getEnv("EMAIL_CONFIRM_URL", "http://localhost:9002/api/auth/confirm-email"),
 		},
 		Logging: LoggingConfig{
 			Level:        getEnv("LOG_LEVEL", "info"),
@@ -232,80 +534,96 @@ func LoadApiConfig() (*Config, error) {
 			AllowCredentials: getBool("CORS_ALLOW_CREDENTIALS", true),
 			MaxAge:           getInt("CORS_MAX_AGE", 43200), // 12 hours
 		},
-	}
+		Internal: InternalConfig{
+			PiBatchMaxSize:   getInt("INTERNAL_PI_BATCH_MAX_SIZE", 500),
+			PiBatchRateLimit: getInt("INTERNAL_PI_BATCH_RATE_LIMIT", 30),
+			RequireOwnedPi:   getBool("INGEST_REQUIRE_OWNED_PI", false),
 
-	// Validate configuration
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("configuration validation failed: %w", err)
-	}
+			IngestStatsMaxSeries: getInt("INGEST_STATS_MAX_SERIES", 10000),
+			IngestorHeartbeatTTL: getDuration("INGESTOR_HEARTBEAT_TTL", time.Minute),
 
-	return config, nil
-}
+			ValidatePayloads: getBool("INGEST_VALIDATE_PAYLOADS", true),
+			SchemaCacheTTL:   getDuration("PAYLOAD_SCHEMA_CACHE_TTL", 30*time.Second),
 
-// Load loads configuration from environment variables with fallback defaults
-func Load() (*Config, error) {
-	// Try to load .env file, but don't fail if it doesn't exist
-	if err := godotenv.Load(); err != nil {
-		// Silently ignore .env file loading errors
-		// This allows the application to work with environment variables set directly
-	}
+			RequestTimeout: getDuration("INTERNAL_REQUEST_TIMEOUT", 5*time.Second),
+			MaxConcurrent:  getInt("INTERNAL_MAX_CONCURRENT", 64),
+			MaxBodyBytes:   int64(getInt("INTERNAL_MAX_BODY_BYTES", 256<<10)),
+			Port:           getEnv("INTERNAL_PORT", ""),
+			GRPCPort:       getEnv("INTERNAL_GRPC_PORT", ""),
+			GRPCRateLimit:  getInt("INTERNAL_GRPC_RATE_LIMIT", 0),
 
-	config := &Config{
-		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
-			ReadTimeout:  getDuration("READ_TIMEOUT", 30*time.Second),
-			WriteTimeout: getDuration("WRITE_TIMEOUT", 30*time.Second),
-			IdleTimeout:  getDuration("IDLE_TIMEOUT", 120*time.Second),
-		},
-		Database: DatabaseConfig{
-			Host:     getEnv("POSTGRES_HOST", "localhost"),
-			Port:     getInt("POSTGRES_PORT", 5432),
-			User:     getRequiredEnv("POSTGRES_USER"),
-			Password: getRequiredEnv("POSTGRES_PASSWORD"),
-			DBName:   getEnv("POSTGRES_DB", "iot"),
-			SSLMode:  getEnv("POSTGRES_SSLMODE", "disable"),
-			MaxConns: getInt("POSTGRES_MAX_CONNS", 25),
-			MinConns: getInt("POSTGRES_MIN_CONNS", 5),
+			CacheInvalidationTopic: getEnv("CACHE_INVALIDATION_TOPIC", ""),
+
+			AllowBearerAuth: getBool("INTERNAL_ALLOW_BEARER_AUTH", true),
+
+			MQTTSensorTopicPrefix:  getEnv("MQTT_ACL_SENSOR_PREFIX", "sensors"),
+			MQTTCommandTopicPrefix: getEnv("MQTT_ACL_COMMAND_PREFIX", "commands"),
+			MQTTErrorTopicPrefix:   getEnv("MQTT_ACL_ERROR_PREFIX", "ingestor/errors"),
+			MQTTDiscoveryPrefix:    getEnv("MQTT_ACL_DISCOVERY_PREFIX", "discovery"),
 		},
-		MQTT: MQTTConfig{
-			BrokerHost:  getEnv("BROKER_HOST", "localhost"),
-			BrokerPort:  getInt("BROKER_PORT", 1883),
-			BrokerUser:  getEnv("BROKER_USER", ""),
-			BrokerPass:  getEnv("BROKER_PASS", ""),
-			UseTLS:      getBool("BROKER_TLS", false),
-			CACertPath:  getEnv("BROKER_CA_FILE", ""),
-			Topic:       getEnv("MQTT_TOPIC", "sensors/#"),
-			ClientID:    getEnv("MQTT_CLIENT_ID", "mqtt-ingestor"),
-			SharedGroup: getEnv("MQTT_SHARED_GROUP", ""),
-			KeepAlive:   getDuration("MQTT_KEEP_ALIVE", 30*time.Second),
-			PingTimeout: getDuration("MQTT_PING_TIMEOUT", 10*time.Second),
+		Shutdown: ShutdownConfig{
+			DrainDelay:   getDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+			PhaseTimeout: getDuration("SHUTDOWN_PHASE_TIMEOUT", 10*time.Second),
 		},
-		Auth: AuthConfig{
-			JWTSecretKey:               getEnv("JWT_SECRET_KEY", "change-this-secret-in-production"),
-			JWTIssuer:                  getEnv("JWT_ISSUER", "mpt-auth-service"),
-			AccessTokenDuration:        getDuration("JWT_ACCESS_TOKEN_DURATION", 15*time.Minute),
-			RefreshTokenDuration:       getDuration("JWT_REFRESH_TOKEN_DURATION", 7*24*time.Hour),
-			PasswordMinLength:          getInt("PASSWORD_MIN_LENGTH", 8),
-			PasswordRequireSpecialChar: getBool("PASSWORD_REQUIRE_SPECIAL_CHAR", true),
-			Admin: AdminConfig{
-				Username: getEnv("ADMIN_USERNAME", "admin"),
-				Email:    getEnv("ADMIN_EMAIL", "admin@example.com"),
-				Password: getEnv("ADMIN_PASSWORD", "adminpassword123"),
+		Notifications: NotificationsConfig{
+			DefaultChannels: getStringSlice("NOTIFY_DEFAULT_CHANNELS", []string{"email"}),
+			MaxAttempts:     getInt("NOTIFY_MAX_ATTEMPTS", 3),
+			RetryBackoff:    getDuration("NOTIFY_RETRY_BACKOFF", 2*time.Second),
+			DigestInterval:  getDuration("NOTIFY_DIGEST_INTERVAL", time.Minute),
+			Email: EmailNotifierConfig{
+				Enabled:  getBool("NOTIFY_EMAIL_ENABLED", false),
+				SMTPHost: getEnv("SMTP_HOST", ""),
+				SMTPPort: getInt("SMTP_PORT", 587),
+				Username: getEnv("SMTP_USERNAME", ""),
+				Password: getEnv("SMTP_PASSWORD", ""),
+				From:     getEnv("SMTP_FROM", ""),
+			},
+			Webhook: WebhookNotifierConfig{
+				Enabled:     getBool("NOTIFY_WEBHOOK_ENABLED", false),
+				URL:         getEnv("NOTIFY_WEBHOOK_URL", ""),
+				SlackFormat: getBool("NOTIFY_WEBHOOK_SLACK_FORMAT", false),
+				Timeout:     getDuration("NOTIFY_WEBHOOK_TIMEOUT", 10*time.Second),
+			},
+			MQTT: MQTTNotifierConfig{
+				Enabled:       getBool("NOTIFY_MQTT_ENABLED", false),
+				TopicTemplate: getEnv("NOTIFY_MQTT_TOPIC_TEMPLATE", "notifications/{user_id}"),
+				QoS:           byte(getInt("NOTIFY_MQTT_QOS", 1)),
 			},
 		},
-		Logging: LoggingConfig{
-			Level:        getEnv("LOG_LEVEL", "info"),
-			Format:       getEnv("LOG_FORMAT", "text"),
-			Output:       getEnv("LOG_OUTPUT", "stdout"),
-			EnableCaller: getBool("LOG_ENABLE_CALLER", false),
+		StorageMonitor: StorageMonitorConfig{
+			InsertLatencyBudget: getDuration("INSERT_LATENCY_BUDGET", 2*time.Second),
+			Window:              getDuration("INSERT_LATENCY_WINDOW", time.Minute),
+			ConsecutiveWindows:  getInt("INSERT_LATENCY_WINDOWS", 3),
 		},
-		CORS: CORSConfig{
-			AllowedOrigins:   getStringSlice("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
-			AllowedMethods:   getStringSlice("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
-			AllowedHeaders:   getStringSlice("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization", "token"}),
-			ExposedHeaders:   getStringSlice("CORS_EXPOSED_HEADERS", []string{"Content-Length"}),
-			AllowCredentials: getBool("CORS_ALLOW_CREDENTIALS", true),
-			MaxAge:           getInt("CORS_MAX_AGE", 43200), // 12 hours
+		Telemetry: TelemetryConfig{
+			Enabled:  getBool("TELEMETRY_ENABLED", false),
+			Endpoint: getEnv("TELEMETRY_ENDPOINT", ""),
+			Interval: getDuration("TELEMETRY_INTERVAL", 24*time.Hour),
+		},
+		Maintenance: MaintenanceConfig{
+			Persist:      getBool("MAINTENANCE_PERSIST", true),
+			PollInterval: getDuration("MAINTENANCE_POLL_INTERVAL", 5*time.Second),
+			RetryAfter:   getDuration("MAINTENANCE_RETRY_AFTER", 30*time.Second),
+		},
+		Readings: ReadingsConfig{
+			InclusiveTo: getBool("READINGS_INCLUSIVE_TO", false),
+		},
+		Purge: PurgeConfig{
+			AsyncThreshold: int64(getInt("PURGE_ASYNC_THRESHOLD", 50000)),
+			ChunkSize:      getInt("PURGE_CHUNK_SIZE", 5000),
+			ChunkPause:     getDuration("PURGE_CHUNK_PAUSE", 250*time.Millisecond),
+		},
+		Seed: SeedConfig{
+			Allowed:         getBool("SEED_ALLOWED", false),
+			MaxExistingRows: int64(getInt("SEED_MAX_EXISTING_ROWS", 10000)),
+		},
+		StorageAccounting: StorageAccountingConfig{
+			Interval:            getDuration("STORAGE_ACCOUNTING_INTERVAL", time.Hour),
+			StatementTimeout:    getDuration("STORAGE_ACCOUNTING_STATEMENT_TIMEOUT", 2*time.Minute),
+			WindowStart:         getEnv("STORAGE_ACCOUNTING_WINDOW_START", ""),
+			WindowEnd:           getEnv("STORAGE_ACCOUNTING_WINDOW_END", ""),
+			PiSoftLimitBytes:    int64(getInt("STORAGE_PI_SOFT_LIMIT_BYTES", 0)),
+			TotalSoftLimitBytes: int64(getInt("STORAGE_READINGS_SOFT_LIMIT_BYTES", 0)),
 		},
 	}
 
@@ -317,6 +635,12 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+// Load loads the API service configuration. It is LoadApiConfig under its
+// older name, so the two can't drift apart as keys are added.
+func Load() (*Config, error) {
+	return LoadApiConfig()
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.Database.User == "" {
@@ -331,6 +655,103 @@ func (c *Config) Validate() error {
 	if c.Auth.PasswordMinLength < 6 {
 		return fmt.Errorf("password minimum length must be at least 6")
 	}
+	switch c.Auth.PasswordHash.Algorithm {
+	case "argon2id":
+		if c.Auth.PasswordHash.Argon2Time < 1 || c.Auth.PasswordHash.Argon2MemoryKiB < 8*uint32(c.Auth.PasswordHash.Argon2Threads) || c.Auth.PasswordHash.Argon2Threads < 1 {
+			return fmt.Errorf("invalid argon2 parameters: ARGON2_TIME and ARGON2_THREADS must be at least 1 and ARGON2_MEMORY_KIB at least 8 per thread")
+		}
+	case "bcrypt":
+		if c.Auth.PasswordHash.BcryptCost < 4 || c.Auth.PasswordHash.BcryptCost > 31 {
+			return fmt.Errorf("BCRYPT_COST must be between 4 and 31")
+		}
+	default:
+		return fmt.Errorf("PASSWORD_HASH_ALGORITHM must be argon2id or bcrypt")
+	}
+	if c.Internal.PiBatchMaxSize < 0 || c.Internal.PiBatchRateLimit < 0 || c.Internal.IngestStatsMaxSeries < 0 ||
+		c.Internal.RequestTimeout < 0 || c.Internal.MaxConcurrent < 0 || c.Internal.MaxBodyBytes < 0 || c.Internal.SchemaCacheTTL < 0 ||
+		c.Internal.IngestorHeartbeatTTL < 0 || c.Internal.GRPCRateLimit < 0 {
+		return fmt.Errorf("internal API limits must not be negative")
+	}
+	if c.Internal.Port != "" && c.Internal.Port == c.Server.Port {
+		return fmt.Errorf("INTERNAL_PORT must differ from PORT; leave it empty to share the listener")
+	}
+	if c.Internal.GRPCPort != "" && (c.Internal.GRPCPort == c.Server.Port || c.Internal.GRPCPort == c.Internal.Port) {
+		return fmt.Errorf("INTERNAL_GRPC_PORT must differ from PORT and INTERNAL_PORT")
+	}
+	if c.Server.MaxBodyBytes < 0 {
+		return fmt.Errorf("MAX_REQUEST_BODY_BYTES must not be negative")
+	}
+	if c.Server.RequestTimeout < 0 {
+		return fmt.Errorf("REQUEST_TIMEOUT must not be negative")
+	}
+	if c.Server.WriteTimeout > 0 && c.Server.RequestTimeout >= c.Server.WriteTimeout {
+		return fmt.Errorf("REQUEST_TIMEOUT must be shorter than WRITE_TIMEOUT")
+	}
+	// Only the API service sets a timestamp precision; Postgres stores microseconds
+	switch c.Server.TimestampPrecision {
+	case 0, time.Second, time.Millisecond, time.Microsecond:
+	default:
+		return fmt.Errorf("TIMESTAMP_PRECISION must be 1s, 1ms or 1us")
+	}
+	if c.Shutdown.DrainDelay < 0 || c.Shutdown.PhaseTimeout <= 0 {
+		return fmt.Errorf("shutdown drain delay must not be negative and phase timeout must be positive")
+	}
+	if c.Notifications.MaxAttempts < 1 || c.Notifications.RetryBackoff < 0 {
+		return fmt.Errorf("NOTIFY_MAX_ATTEMPTS must be at least 1 and NOTIFY_RETRY_BACKOFF must not be negative")
+	}
+	if c.Notifications.DigestInterval < 0 {
+		return fmt.Errorf("NOTIFY_DIGEST_INTERVAL must not be negative")
+	}
+	if c.Notifications.Email.Enabled && (c.Notifications.Email.SMTPHost == "" || c.Notifications.Email.From == "") {
+		return fmt.Errorf("SMTP_HOST and SMTP_FROM are required when NOTIFY_EMAIL_ENABLED is set")
+	}
+	if c.Telemetry.Enabled && (c.Telemetry.Endpoint == "" || c.Telemetry.Interval <= 0) {
+		return fmt.Errorf("TELEMETRY_ENABLED requires TELEMETRY_ENDPOINT and a positive TELEMETRY_INTERVAL")
+	}
+	if c.Notifications.Webhook.Enabled && c.Notifications.Webhook.URL == "" {
+		return fmt.Errorf("NOTIFY_WEBHOOK_URL is required when NOTIFY_WEBHOOK_ENABLED is set")
+	}
+	if c.Notifications.MQTT.QoS > 2 {
+		return fmt.Errorf("NOTIFY_MQTT_QOS must be 0, 1 or 2")
+	}
+	if err := c.MQTT.ValidateQoS(); err != nil {
+		return err
+	}
+	if c.Auth.RoleReloadInterval < 0 {
+		return fmt.Errorf("ROLE_RELOAD_INTERVAL must not be negative")
+	}
+	if c.Auth.EmailChangeTTL <= 0 {
+		return fmt.Errorf("EMAIL_CHANGE_TTL must be positive")
+	}
+	if c.Purge.AsyncThreshold < 0 || c.Purge.ChunkSize < 1 || c.Purge.ChunkPause < 0 {
+		return fmt.Errorf("PURGE_ASYNC_THRESHOLD and PURGE_CHUNK_PAUSE must not be negative and PURGE_CHUNK_SIZE must be at least 1")
+	}
+	if c.Seed.MaxExistingRows < 0 {
+		return fmt.Errorf("SEED_MAX_EXISTING_ROWS must not be negative")
+	}
+	if c.StorageMonitor.InsertLatencyBudget < 0 {
+		return fmt.Errorf("INSERT_LATENCY_BUDGET must not be negative")
+	}
+	if c.StorageMonitor.InsertLatencyBudget > 0 && (c.StorageMonitor.Window <= 0 || c.StorageMonitor.ConsecutiveWindows < 1) {
+		return fmt.Errorf("INSERT_LATENCY_WINDOW must be positive and INSERT_LATENCY_WINDOWS at least 1")
+	}
+	if c.Maintenance.PollInterval < 0 || c.Maintenance.RetryAfter < time.Second {
+		return fmt.Errorf("MAINTENANCE_POLL_INTERVAL must not be negative and MAINTENANCE_RETRY_AFTER must be at least 1s")
+	}
+	if c.StorageAccounting.Interval < 0 || c.StorageAccounting.StatementTimeout <= 0 {
+		return fmt.Errorf("STORAGE_ACCOUNTING_INTERVAL must not be negative and STORAGE_ACCOUNTING_STATEMENT_TIMEOUT must be positive")
+	}
+	if c.StorageAccounting.PiSoftLimitBytes < 0 || c.StorageAccounting.TotalSoftLimitBytes < 0 {
+		return fmt.Errorf("storage soft limits must not be negative")
+	}
+	if (c.StorageAccounting.WindowStart == "") != (c.StorageAccounting.WindowEnd == "") {
+		return fmt.Errorf("STORAGE_ACCOUNTING_WINDOW_START and STORAGE_ACCOUNTING_WINDOW_END must be set together")
+	}
+	for _, bound := range []string{c.StorageAccounting.WindowStart, c.StorageAccounting.WindowEnd} {
+		if _, err := time.Parse("15:04", bound); bound != "" && err != nil {
+			return fmt.Errorf("storage accounting window bounds must be given as HH:MM")
+		}
+	}
 	return nil
 }
 
@@ -340,13 +761,23 @@ func (c *Config) GetDatabaseDSN() string {
 		c.Database.Host, c.Database.Port, c.Database.User, c.Database.Password, c.Database.DBName, c.Database.SSLMode)
 }
 
-// GetMQTTBrokerURL returns the MQTT broker URL
+// GetMQTTBrokerURL returns the URL of the first MQTT broker
 func (c *Config) GetMQTTBrokerURL() string {
-	scheme := "tcp"
-	if c.MQTT.UseTLS {
-		scheme = "tcps"
+	urls, err := c.GetMQTTBrokerURLs()
+	if err != nil {
+		scheme := "tcp"
+		if c.MQTT.UseTLS {
+			scheme = "tcps"
+		}
+		return fmt.Sprintf("%s://%s:%d", scheme, c.MQTT.BrokerHost, c.MQTT.BrokerPort)
 	}
-	return fmt.Sprintf("%s://%s:%d", scheme, c.MQTT.BrokerHost, c.MQTT.BrokerPort)
+	return urls[0]
+}
+
+// GetMQTTBrokerURLs returns the URLs of all configured MQTT brokers, in the
+// order they are tried
+func (c *Config) GetMQTTBrokerURLs() ([]string, error) {
+	return c.MQTT.Brokers()
 }
 
 // Helper functions for environment variable parsing
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RedactedValue replaces secret values in Redact output
+const RedactedValue = "[REDACTED]"
+
+// secretNameParts mark a string field as secret by name, so a newly added
+// password or token is redacted even if nobody remembers to tag it
+var secretNameParts = []string{"pass", "secret", "token", "key", "credential"}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Redact converts a configuration struct into a map suitable for debug endpoints.
+// A field is treated as secret when it is tagged `redact:"true"`, tagged
+// `json:"-"`, or is a string whose name contains one of secretNameParts.
+// Secrets that are set are replaced with RedactedValue; unset ones stay empty so
+// it is still visible whether they were configured. Keys follow the json tag,
+// falling back to the Go field name.
+func Redact(cfg interface{}) map[string]interface{} {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return redactStruct(v)
+}
+
+func redactStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName != "" && jsonName != "-" {
+			name = jsonName
+		}
+
+		out[name] = redactValue(field, v.Field(i))
+	}
+
+	return out
+}
+
+func redactValue(field reflect.StructField, v reflect.Value) interface{} {
+	if isSecretField(field) {
+		if v.IsZero() {
+			return ""
+		}
+		return RedactedValue
+	}
+
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Struct:
+		return redactStruct(v)
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if v.IsNil() {
+			return nil
+		}
+		return redactStruct(v.Elem())
+	default:
+		return v.Interface()
+	}
+}
+
+func isSecretField(field reflect.StructField) bool {
+	if field.Tag.Get("redact") == "true" || field.Tag.Get("json") == "-" {
+		return true
+	}
+
+	kind := field.Type.Kind()
+	if kind != reflect.String && !(kind == reflect.Slice && field.Type.Elem().Kind() == reflect.String) {
+		return false
+	}
+
+	name := strings.ToLower(field.Name)
+	for _, part := range secretNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -30,12 +30,16 @@ type Container struct {
 
 	// Cleanup functions
 	cleanupFuncs []func() error
+
+	// Readiness and ordered shutdown
+	lifecycle *Lifecycle
 }
 
 // IngestorContainer manages dependencies for the MQTT Ingestor service
 type IngestorContainer struct {
-	config *config.IngestorConfig
-	logger *logger.Logger
+	config    *config.IngestorConfig
+	logger    *logger.Logger
+	lifecycle *Lifecycle
 }
 
 // ApiContainer manages dependencies for the API service
@@ -55,9 +59,10 @@ func NewContainer() (*Container, error) {
 	log := logger.NewLogger(&cfg.Logging)
 
 	container := &Container{
-		config:   cfg,
-		logger:   log,
-		services: make(map[string]interface{}),
+		config:    cfg,
+		logger:    log,
+		services:  make(map[string]interface{}),
+		lifecycle: NewLifecycle(cfg.Shutdown, log),
 	}
 
 	// Register cleanup functions
@@ -78,8 +83,9 @@ func NewIngestorContainer() (*IngestorContainer, error) {
 	log := logger.NewLogger(&cfg.Logging)
 
 	return &IngestorContainer{
-		config: cfg,
-		logger: log,
+		config:    cfg,
+		logger:    log,
+		lifecycle: NewLifecycle(cfg.Shutdown, log),
 	}, nil
 }
 
@@ -95,9 +101,10 @@ func NewApiContainer() (*ApiContainer, error) {
 	log := logger.NewLogger(&cfg.Logging)
 
 	baseContainer := &Container{
-		config:   cfg,
-		logger:   log,
-		services: make(map[string]interface{}),
+		config:    cfg,
+		logger:    log,
+		services:  make(map[string]interface{}),
+		lifecycle: NewLifecycle(cfg.Shutdown, log),
 	}
 
 	// Register cleanup functions
@@ -126,6 +133,16 @@ func (c *IngestorContainer) GetLogger() *logger.Logger {
 	return c.logger
 }
 
+// GetLifecycle returns the readiness and shutdown lifecycle
+func (c *Container) GetLifecycle() *Lifecycle {
+	return c.lifecycle
+}
+
+// GetLifecycle returns the readiness and shutdown lifecycle
+func (c *IngestorContainer) GetLifecycle() *Lifecycle {
+	return c.lifecycle
+}
+
 // GetDatabase returns the database connection
 func (c *Container) GetDatabase() (*sql.DB, error) {
 	c.mu.Lock()
@@ -224,6 +241,21 @@ func (c *Container) InitializeDatabase(ctx context.Context) error {
 	return nil
 }
 
+// InitializeIndexes creates the secondary indexes on the tables made by InitializeDatabase
+func (c *Container) InitializeIndexes(ctx context.Context) error {
+	dbManager, err := c.GetDatabaseManager()
+	if err != nil {
+		return fmt.Errorf("failed to get database manager: %w", err)
+	}
+
+	if err := dbManager.CreateIndexes(ctx); err != nil {
+		return err
+	}
+
+	c.logger.Info("Database indexes created successfully")
+	return nil
+}
+
 // HealthCheck performs a comprehensive health check
 func (c *Container) HealthCheck(ctx context.Context) map[string]interface{} {
 	healthChecker, err := c.GetHealthChecker()
@@ -237,24 +269,11 @@ func (c *Container) HealthCheck(ctx context.Context) map[string]interface{} {
 	return healthChecker.GetHealthStatus(ctx)
 }
 
-// Shutdown gracefully shuts down the container and all its dependencies
+// Shutdown gracefully shuts down the container and all its dependencies.
+// It runs the lifecycle sequence; cleanup functions run in the close_clients phase.
 func (c *Container) Shutdown(ctx context.Context) error {
 	c.logger.Info("Shutting down container...")
-
-	// Execute cleanup functions in reverse order
-	for i := len(c.cleanupFuncs) - 1; i >= 0; i-- {
-		if err := c.cleanupFuncs[i](); err != nil {
-			c.logger.ErrorWithError(err, "Error during cleanup")
-		}
-	}
-
-	// Close database connection
-	if c.db != nil {
-		if err := c.db.Close(); err != nil {
-			c.logger.ErrorWithError(err, "Error closing database connection")
-		}
-	}
-
+	c.lifecycle.Shutdown(ctx)
 	c.logger.Info("Container shutdown complete")
 	return nil
 }
@@ -262,6 +281,7 @@ func (c *Container) Shutdown(ctx context.Context) error {
 // Shutdown gracefully shuts down the ingestor container
 func (c *IngestorContainer) Shutdown(ctx context.Context) error {
 	c.logger.Info("Shutting down ingestor container...")
+	c.lifecycle.Shutdown(ctx)
 	c.logger.Info("Ingestor container shutdown complete")
 	return nil
 }
@@ -274,6 +294,20 @@ func (c *Container) registerCleanup() {
 		}
 		return nil
 	})
+
+	// Execute cleanup functions in reverse order once everything upstream has stopped
+	c.lifecycle.OnShutdown(PhaseCloseClients, "container_cleanup", func(ctx context.Context) error {
+		c.mu.RLock()
+		funcs := append([]func() error(nil), c.cleanupFuncs...)
+		c.mu.RUnlock()
+
+		for i := len(funcs) - 1; i >= 0; i-- {
+			if err := funcs[i](); err != nil {
+				c.logger.ErrorWithError(err, "Error during cleanup")
+			}
+		}
+		return nil
+	})
 }
 
 // AddCleanupFunc adds a cleanup function
@@ -0,0 +1,131 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// ShutdownPhase identifies a step of the shutdown sequence. Phases run in declaration order.
+type ShutdownPhase int
+
+const (
+	// PhaseStopIngestion stops taking in new work and flushes what is already queued
+	PhaseStopIngestion ShutdownPhase = iota
+	// PhaseStopHTTP stops the HTTP servers
+	PhaseStopHTTP
+	// PhaseCloseClients closes database and broker connections
+	PhaseCloseClients
+)
+
+var shutdownPhaseNames = map[ShutdownPhase]string{
+	PhaseStopIngestion: "stop_ingestion",
+	PhaseStopHTTP:      "stop_http",
+	PhaseCloseClients:  "close_clients",
+}
+
+func (p ShutdownPhase) String() string {
+	if name, ok := shutdownPhaseNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("phase_%d", int(p))
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Lifecycle tracks readiness and drives the ordered shutdown sequence:
+// readiness is flipped to not-ready, the drain delay elapses so load balancers
+// stop routing, and then each phase's hooks run under the phase timeout.
+type Lifecycle struct {
+	cfg    config.ShutdownConfig
+	logger *logger.Logger
+	ready  atomic.Bool
+
+	mu    sync.Mutex
+	hooks map[ShutdownPhase][]shutdownHook
+	once  sync.Once
+}
+
+// NewLifecycle creates a lifecycle that starts out not ready
+func NewLifecycle(cfg config.ShutdownConfig, log *logger.Logger) *Lifecycle {
+	return &Lifecycle{
+		cfg:    cfg,
+		logger: log,
+		hooks:  make(map[ShutdownPhase][]shutdownHook),
+	}
+}
+
+// SetReady marks the service as ready to receive traffic
+func (l *Lifecycle) SetReady() {
+	l.ready.Store(true)
+}
+
+// IsReady reports whether the service should report itself ready
+func (l *Lifecycle) IsReady() bool {
+	return l.ready.Load()
+}
+
+// OnShutdown registers a hook to run during the given phase. Hooks within a
+// phase run in registration order.
+func (l *Lifecycle) OnShutdown(phase ShutdownPhase, name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks[phase] = append(l.hooks[phase], shutdownHook{name: name, fn: fn})
+}
+
+// Shutdown runs the shutdown sequence once. Subsequent calls are no-ops.
+func (l *Lifecycle) Shutdown(ctx context.Context) {
+	l.once.Do(func() {
+		l.ready.Store(false)
+		l.logger.Logger.Info().Dur("drain_delay", l.cfg.DrainDelay).Msg("Readiness set to not ready, draining")
+
+		if l.cfg.DrainDelay > 0 {
+			select {
+			case <-time.After(l.cfg.DrainDelay):
+			case <-ctx.Done():
+			}
+		}
+
+		for _, phase := range []ShutdownPhase{PhaseStopIngestion, PhaseStopHTTP, PhaseCloseClients} {
+			l.runPhase(ctx, phase)
+		}
+	})
+}
+
+func (l *Lifecycle) runPhase(ctx context.Context, phase ShutdownPhase) {
+	l.mu.Lock()
+	hooks := append([]shutdownHook(nil), l.hooks[phase]...)
+	l.mu.Unlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	start := time.Now()
+	phaseCtx, cancel := context.WithTimeout(ctx, l.cfg.PhaseTimeout)
+	defer cancel()
+
+	for _, hook := range hooks {
+		done := make(chan error, 1)
+		go func() { done <- hook.fn(phaseCtx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				l.logger.Logger.Error().Err(err).Str("phase", phase.String()).Str("hook", hook.name).Msg("Shutdown hook failed")
+			}
+		case <-phaseCtx.Done():
+			l.logger.Logger.Error().Err(phaseCtx.Err()).Str("phase", phase.String()).Str("hook", hook.name).Msg("Shutdown hook timed out")
+		}
+	}
+
+	l.logger.Logger.Info().Str("phase", phase.String()).Dur("elapsed", time.Since(start)).Msg("Shutdown phase complete")
+}
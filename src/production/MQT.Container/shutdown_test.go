@@ -0,0 +1,164 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+)
+
+// fakeComponent stands in for a server or client that the lifecycle stops. It
+// records when it was stopped and whether the service still reported ready.
+type fakeComponent struct {
+	name      string
+	lifecycle *Lifecycle
+	events    *eventLog
+	hang      bool // block until the phase times out
+	err       error
+}
+
+func (c *fakeComponent) stop(ctx context.Context) error {
+	c.events.add(fmt.Sprintf("%s ready=%v", c.name, c.lifecycle.IsReady()))
+	if c.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.err
+}
+
+// eventLog is the order in which fake components were stopped
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.events)
+}
+
+// registration is a fake component registered to stop in phase
+type registration struct {
+	phase ShutdownPhase
+	name  string
+	hang  bool
+	err   error
+}
+
+func newTestLifecycle(drainDelay, phaseTimeout time.Duration) *Lifecycle {
+	nop := zerolog.Nop()
+	return NewLifecycle(config.ShutdownConfig{DrainDelay: drainDelay, PhaseTimeout: phaseTimeout}, &logger.Logger{Logger: &nop})
+}
+
+// Readiness drops before anything stops; then ingestion, HTTP and clients stop
+// in that order whatever order they were registered in, and a failing or hung
+// hook doesn't keep later hooks or phases from running
+func TestShutdownOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []registration
+		want       string
+	}{
+		{
+			name: "registered in phase order",
+			components: []registration{
+				{phase: PhaseStopIngestion, name: "ingestor"},
+				{phase: PhaseStopHTTP, name: "http"},
+				{phase: PhaseCloseClients, name: "db"},
+			},
+			want: "[ingestor ready=false http ready=false db ready=false]",
+		},
+		{
+			name: "registered in reverse",
+			components: []registration{
+				{phase: PhaseCloseClients, name: "db"},
+				{phase: PhaseCloseClients, name: "mqtt"},
+				{phase: PhaseStopHTTP, name: "grpc"},
+				{phase: PhaseStopHTTP, name: "http"},
+				{phase: PhaseStopIngestion, name: "ingestor"},
+			},
+			want: "[ingestor ready=false grpc ready=false http ready=false db ready=false mqtt ready=false]",
+		},
+		{
+			name: "failing hook",
+			components: []registration{
+				{phase: PhaseStopIngestion, name: "ingestor", err: errors.New("flush failed")},
+				{phase: PhaseStopIngestion, name: "bridge"},
+				{phase: PhaseCloseClients, name: "db"},
+			},
+			want: "[ingestor ready=false bridge ready=false db ready=false]",
+		},
+		{
+			name: "hung hook",
+			components: []registration{
+				{phase: PhaseStopHTTP, name: "http", hang: true},
+				{phase: PhaseCloseClients, name: "db"},
+			},
+			want: "[http ready=false db ready=false]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLifecycle(0, 50*time.Millisecond)
+			events := &eventLog{}
+			for _, c := range tt.components {
+				component := &fakeComponent{name: c.name, lifecycle: l, events: events, hang: c.hang, err: c.err}
+				l.OnShutdown(c.phase, c.name, component.stop)
+			}
+			l.SetReady()
+
+			l.Shutdown(context.Background())
+			if got := events.String(); got != tt.want {
+				t.Errorf("stopped %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Nothing stops until the drain delay has passed, and only the first Shutdown
+// runs the hooks
+func TestShutdownDrainAndOnce(t *testing.T) {
+	const drainDelay = 50 * time.Millisecond
+	l := newTestLifecycle(drainDelay, time.Second)
+	events := &eventLog{}
+	var stoppedAt time.Time
+	l.OnShutdown(PhaseStopIngestion, "ingestor", func(ctx context.Context) error {
+		stoppedAt = time.Now()
+		events.add("ingestor")
+		return nil
+	})
+	l.SetReady()
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		l.Shutdown(context.Background())
+		close(done)
+	}()
+	time.Sleep(drainDelay / 5)
+	if l.IsReady() {
+		t.Error("still ready while draining")
+	}
+	<-done
+	if waited := stoppedAt.Sub(start); waited < drainDelay {
+		t.Errorf("ingestion stopped %s after shutdown began, before the %s drain delay", waited, drainDelay)
+	}
+
+	l.Shutdown(context.Background())
+	if got := events.String(); got != "[ingestor]" {
+		t.Errorf("stopped %s, want the ingestor once", got)
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
 )
 
 // CircuitBreakerState represents the state of the circuit breaker
@@ -23,16 +31,151 @@ const (
 	StateHalfOpen
 )
 
-// CircuitBreaker implements circuit breaker pattern for resilience
+// CircuitBreaker implements circuit breaker pattern for resilience. It opens
+// after maxFailures consecutive failures and refuses calls for resetTimeout,
+// then turns half-open and lets halfOpenProbes calls through: one succeeding
+// closes it, one failing opens it again for another resetTimeout.
 type CircuitBreaker struct {
-	maxFailures  int
-	resetTimeout time.Duration
-	state        CircuitBreakerState
-	failureCount int
-	lastFailTime time.Time
-	mutex        sync.RWMutex
+	maxFailures    int
+	resetTimeout   time.Duration
+	halfOpenProbes int
+	state          CircuitBreakerState
+	failureCount   int
+	lastFailTime   time.Time
+	openedAt       time.Time
+	probes         int // probe calls let through since turning half-open
+	now            func() time.Time
+	mutex          sync.RWMutex
 }
 
+// Error classifications reported for each API call attempt
+const (
+	ResultOK          = "ok"
+	ResultCircuitOpen = "circuit_open"
+	ResultTimeout     = "timeout"
+	ResultCanceled    = "canceled"
+	ResultNetwork     = "network"
+	ResultClientError = "http_4xx"
+	ResultServerError = "http_5xx"
+	ResultDecode      = "decode"
+	ResultAPIError    = "api_error"
+	ResultMaintenance = "maintenance"
+)
+
+// CallResult describes a single API call attempt, passed to the CallObserver
+type CallResult struct {
+	Endpoint   string
+	PiID       string
+	DeviceID   int
+	Attempt    int // 1-based
+	Latency    time.Duration
+	Result     string // one of the Result* classifications
+	StatusCode int    // 0 when no response was received
+	Err        error
+}
+
+// CallObserver is notified after every API call attempt
+type CallObserver func(CallResult)
+
+// callInfo identifies the reading an API call is made for
+type callInfo struct {
+	endpoint string
+	piID     string
+	deviceID int
+}
+
+// APIError is returned when the API Service answers with an unexpected status
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("API returned status %d: %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("API returned status %d", e.Status)
+}
+
+// Retryable reports whether the same request may succeed later: a timeout
+// (408), rate limiting (429) or a server error. Any other 4xx refuses the
+// request itself, as a bad payload or an unknown Pi, and repeating it won't
+// help.
+func (e *APIError) Retryable() bool {
+	return e.Status == http.StatusRequestTimeout || e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// IsRejected reports whether err is the API refusing the request itself rather
+// than being unable to handle it: bad data, not a service outage
+func IsRejected(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !apiErr.Retryable()
+}
+
+// maintenanceError is returned while the API Service is in maintenance mode
+type maintenanceError struct {
+	RetryAfter time.Duration
+	Reason     string
+}
+
+func (e *maintenanceError) Error() string {
+	if e.Reason != "" {
+		return "API is in maintenance mode: " + e.Reason
+	}
+	return "API is in maintenance mode"
+}
+
+// Bounds for waiting out maintenance. The wait is capped so that the end of
+// maintenance is noticed soon even when Retry-After is long.
+const (
+	minMaintenanceWait = time.Second
+	maxMaintenanceWait = 30 * time.Second
+)
+
+func (e *maintenanceError) wait() time.Duration {
+	switch {
+	case e.RetryAfter < minMaintenanceWait:
+		return minMaintenanceWait
+	case e.RetryAfter > maxMaintenanceWait:
+		return maxMaintenanceWait
+	default:
+		return e.RetryAfter
+	}
+}
+
+var (
+	errCircuitOpen = errors.New("circuit breaker is open")
+	errDecode      = errors.New("failed to decode response")
+	errAPI         = errors.New("API error")
+
+	// ErrSchemaViolation is returned when the API refuses a reading because its
+	// payload fails the device type's schema. Retrying can't help, so it is
+	// returned after the first attempt.
+	ErrSchemaViolation = errors.New("payload violates schema")
+
+	// ErrDuplicateReading is returned when the device already has a reading at
+	// that ts, as when a gateway replays buffered data. It is not retried.
+	ErrDuplicateReading = errors.New("reading already exists")
+
+	// ErrDeviceNotFound is returned by CreateReading when the API no longer
+	// knows the reading's device, as when it was deleted after validation. It
+	// is not retried.
+	ErrDeviceNotFound = errors.New("device not found")
+
+	// ErrBatchUnsupported is returned by CreateReadings, ValidateBatch and
+	// ReportIngestErrors when the API predates the batch endpoint. Readings
+	// should then be created, or validated, one at a time.
+	ErrBatchUnsupported = errors.New("batch endpoint not supported")
+
+	// ErrBatchTooLarge is returned by CreateReadings when the API refuses the
+	// batch for its size (the internal body limit). Smaller batches may pass.
+	ErrBatchTooLarge = errors.New("reading batch too large")
+
+	// ErrSnapshotUnsupported is returned by RegistrySnapshot when the API
+	// predates the snapshot endpoint
+	ErrSnapshotUnsupported = errors.New("registry snapshot endpoint not supported")
+)
+
 // APIClient handles communication with the API Service
 type APIClient struct {
 	baseURL        string
@@ -41,74 +184,127 @@ type APIClient struct {
 	circuitBreaker *CircuitBreaker
 	maxRetries     int
 	retryDelay     time.Duration
+	timeout        time.Duration
+	observer       CallObserver
+
+	// Set by UseGRPC; validation and reading writes then use gRPC
+	grpcConn *grpc.ClientConn
+	grpc     ingestpb.IngestServiceClient
 }
 
-// NewAPIClient creates a new API client
+// NewAPIClient creates a new API client with DefaultAPIClientConfig
 func NewAPIClient(baseURL, apiSecret string) *APIClient {
+	return NewAPIClientWithConfig(baseURL, apiSecret, DefaultAPIClientConfig())
+}
+
+// NewAPIClientWithConfig creates a new API client with the given timeouts,
+// retries and circuit breaker thresholds
+func NewAPIClientWithConfig(baseURL, apiSecret string, cfg APIClientConfig) *APIClient {
+	cfg = cfg.withDefaults()
 	return &APIClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   cfg.Timeout,
+			Transport: cfg.transport(),
 		},
 		apiSecret: apiSecret,
 		circuitBreaker: &CircuitBreaker{
-			maxFailures:  5,
-			resetTimeout: 30 * time.Second,
-			state:        StateClosed,
+			maxFailures:    cfg.BreakerFailures,
+			resetTimeout:   cfg.BreakerReset,
+			halfOpenProbes: cfg.HalfOpenProbes,
+			state:          StateClosed,
+			now:            time.Now,
 		},
-		maxRetries: 3,
-		retryDelay: 1 * time.Second,
+		maxRetries: cfg.MaxRetries,
+		retryDelay: cfg.RetryDelay,
+		timeout:    cfg.Timeout,
 	}
 }
 
-// ValidatePiRequest represents the request to validate a Pi
-type ValidatePiRequest struct {
-	PiID string `json:"pi_id"`
-}
-
-// ValidatePiResponse represents the response from Pi validation
-type ValidatePiResponse struct {
-	Exists bool   `json:"exists"`
-	Error  string `json:"error,omitempty"`
-}
-
-// ValidateDeviceRequest represents the request to validate a Device
-type ValidateDeviceRequest struct {
-	PiID     string `json:"pi_id"`
-	DeviceID int    `json:"device_id"`
-}
-
-// ValidateDeviceResponse represents the response from Device validation
-type ValidateDeviceResponse struct {
-	Exists bool   `json:"exists"`
-	Error  string `json:"error,omitempty"`
+// SetCallObserver registers a function called after every API call attempt.
+// It must be set before the client is used.
+func (c *APIClient) SetCallObserver(observer CallObserver) {
+	c.observer = observer
 }
 
-// CreateReadingRequest represents the request to create a reading
-type CreateReadingRequest struct {
-	PiID     string                 `json:"pi_id"`
-	DeviceID int                    `json:"device_id"`
-	Ts       time.Time              `json:"ts"`
-	Payload  map[string]interface{} `json:"payload"`
+// ClassifyError maps an API call error to one of the Result* classifications
+func ClassifyError(err error) string {
+	var apiErr *APIError
+	var maintenanceErr *maintenanceError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.Is(err, errCircuitOpen):
+		return ResultCircuitOpen
+	case errors.As(err, &maintenanceErr):
+		return ResultMaintenance
+	case errors.Is(err, context.DeadlineExceeded):
+		return ResultTimeout
+	case errors.Is(err, context.Canceled):
+		return ResultCanceled
+	case errors.As(err, &apiErr):
+		if apiErr.Status >= 500 {
+			return ResultServerError
+		}
+		return ResultClientError
+	case errors.Is(err, ErrSchemaViolation), errors.Is(err, ErrDuplicateReading), errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrBatchUnsupported), errors.Is(err, ErrBatchTooLarge):
+		return ResultClientError
+	case errors.Is(err, errDecode):
+		return ResultDecode
+	case errors.Is(err, errAPI):
+		return ResultAPIError
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ResultTimeout
+		}
+		return ResultNetwork
+	default:
+		return ResultNetwork
+	}
 }
 
-// CreateReadingResponse represents the response from reading creation
-type CreateReadingResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+// IsTransient reports whether err means the API couldn't be reached or
+// couldn't handle the request right now, so the same call may succeed later.
+// Refusals of the request itself, such as a schema violation, are not.
+func IsTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	switch ClassifyError(err) {
+	case ResultCircuitOpen, ResultTimeout, ResultCanceled, ResultNetwork, ResultServerError, ResultMaintenance:
+		return true
+	default:
+		return false
+	}
 }
 
 // Circuit breaker methods
+
+// canExecute reports whether a call may go ahead. Once the reset timeout has
+// passed, an open breaker turns half-open; a half-open one lets a call through
+// only while it has probes left, and that call must end in onSuccess,
+// onFailure or onInconclusive.
 func (cb *CircuitBreaker) canExecute() bool {
-	cb.mutex.RLock()
-	defer cb.mutex.RUnlock()
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
 
 	switch cb.state {
 	case StateClosed:
 		return true
 	case StateOpen:
-		return time.Since(cb.lastFailTime) > cb.resetTimeout
+		if cb.now().Sub(cb.openedAt) < cb.resetTimeout {
+			return false
+		}
+		cb.onHalfOpen()
+		fallthrough
 	case StateHalfOpen:
+		if cb.probes >= cb.halfOpenProbes {
+			return false
+		}
+		cb.probes++
 		return true
 	default:
 		return false
@@ -120,6 +316,7 @@ func (cb *CircuitBreaker) onSuccess() {
 	defer cb.mutex.Unlock()
 
 	cb.failureCount = 0
+	cb.probes = 0
 	cb.state = StateClosed
 }
 
@@ -128,36 +325,121 @@ func (cb *CircuitBreaker) onFailure() {
 	defer cb.mutex.Unlock()
 
 	cb.failureCount++
-	cb.lastFailTime = time.Now()
+	cb.lastFailTime = cb.now()
 
-	if cb.failureCount >= cb.maxFailures {
-		cb.state = StateOpen
+	switch cb.state {
+	case StateHalfOpen:
+		// The probe failed: back to open, with a fresh reset timeout
+		cb.open()
+	case StateClosed:
+		if cb.failureCount >= cb.maxFailures {
+			cb.open()
+		}
 	}
 }
 
-func (cb *CircuitBreaker) onHalfOpen() {
+// onInconclusive ends a call that says nothing about the API's health, such as
+// one answered with maintenance mode, freeing its probe if it was one
+func (cb *CircuitBreaker) onInconclusive() {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	if cb.state == StateHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// open starts refusing calls for resetTimeout. Callers hold cb.mutex.
+func (cb *CircuitBreaker) open() {
+	cb.state = StateOpen
+	cb.openedAt = cb.now()
+	cb.probes = 0
+}
+
+// onHalfOpen starts probing the API. Callers hold cb.mutex.
+func (cb *CircuitBreaker) onHalfOpen() {
 	cb.state = StateHalfOpen
+	cb.probes = 0
+}
+
+// nextProbeIn returns how long an open breaker refuses calls for, or 0 when it
+// is not open. Callers hold cb.mutex.
+func (cb *CircuitBreaker) nextProbeIn() time.Duration {
+	if cb.state != StateOpen {
+		return 0
+	}
+	return max(cb.resetTimeout-cb.now().Sub(cb.openedAt), 0)
+}
+
+// observe records metrics for an attempt and notifies the observer
+func (c *APIClient) observe(call callInfo, attempt int, latency time.Duration, err error) {
+	result := ClassifyError(err)
+	apiRequestsTotal.WithLabelValues(call.endpoint, result).Inc()
+	if result != ResultCircuitOpen {
+		apiRequestDuration.WithLabelValues(call.endpoint).Observe(latency.Seconds())
+	}
+
+	if c.observer == nil {
+		return
+	}
+	statusCode := 0
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		statusCode = apiErr.Status
+	}
+	c.observer(CallResult{
+		Endpoint:   call.endpoint,
+		PiID:       call.piID,
+		DeviceID:   call.deviceID,
+		Attempt:    attempt + 1,
+		Latency:    latency,
+		Result:     result,
+		StatusCode: statusCode,
+		Err:        err,
+	})
 }
 
 // retryWithBackoff executes a function with exponential backoff retry logic
-func (c *APIClient) retryWithBackoff(ctx context.Context, operation func() error) error {
+func (c *APIClient) retryWithBackoff(ctx context.Context, call callInfo, operation func() error) error {
 	var lastErr error
 
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
 		// Check circuit breaker
 		if !c.circuitBreaker.canExecute() {
-			return fmt.Errorf("circuit breaker is open")
+			c.observe(call, attempt, 0, errCircuitOpen)
+			return errCircuitOpen
 		}
 
 		// Execute operation
+		start := time.Now()
 		err := operation()
+		c.observe(call, attempt, time.Since(start), err)
 		if err == nil {
 			c.circuitBreaker.onSuccess()
 			return nil
 		}
+		// The API handled the request, so it counts towards the breaker as
+		// healthy, and refused it for good, so it isn't retried
+		if errors.Is(err, ErrSchemaViolation) || errors.Is(err, ErrDuplicateReading) || errors.Is(err, ErrDeviceNotFound) || errors.Is(err, ErrBatchUnsupported) || errors.Is(err, ErrBatchTooLarge) || IsRejected(err) {
+			c.circuitBreaker.onSuccess()
+			return err
+		}
+
+		// Writes are paused on purpose, so wait it out without using up an
+		// attempt or counting against the breaker. The batch writer stalls
+		// meanwhile and readings wait in the queue under its overflow policy.
+		var maintenanceErr *maintenanceError
+		if errors.As(err, &maintenanceErr) {
+			c.circuitBreaker.onInconclusive()
+			lastErr = err
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(maintenanceErr.wait()):
+			}
+			attempt--
+			continue
+		}
 
 		lastErr = err
 		c.circuitBreaker.onFailure()
@@ -182,13 +464,19 @@ func (c *APIClient) retryWithBackoff(ctx context.Context, operation func() error
 	return fmt.Errorf("operation failed after %d attempts: %w", c.maxRetries+1, lastErr)
 }
 
-// ValidatePi checks if a Pi exists in the API Service
-func (c *APIClient) ValidatePi(ctx context.Context, piID string) (bool, error) {
-	var result bool
+// ValidatePi checks if a Pi exists in the API Service and may receive readings.
+// It returns one of the ingest_models.PiStatus* values.
+func (c *APIClient) ValidatePi(ctx context.Context, piID string) (string, error) {
+	if c.grpc != nil {
+		return c.grpcValidatePi(ctx, piID)
+	}
+
+	var result string
 	var resultErr error
 
-	err := c.retryWithBackoff(ctx, func() error {
-		req := ValidatePiRequest{PiID: piID}
+	call := callInfo{endpoint: "/internal/pis/validate", piID: piID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		req := ingest_models.ValidatePiRequest{PiID: piID}
 
 		resp, err := c.makeRequest(ctx, "POST", "/internal/pis/validate", req)
 		if err != nil {
@@ -198,41 +486,104 @@ func (c *APIClient) ValidatePi(ctx context.Context, piID string) (bool, error) {
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			resultErr = fmt.Errorf("API returned status %d", resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
 			return resultErr
 		}
 
-		var response ValidatePiResponse
+		var response ingest_models.ValidatePiResponse
 		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			resultErr = fmt.Errorf("failed to decode response: %w", err)
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
 			return resultErr
 		}
 
 		if response.Error != "" {
-			resultErr = fmt.Errorf("API error: %s", response.Error)
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
 			return resultErr
 		}
 
-		result = response.Exists
+		result = response.Status
+		if result == "" {
+			// Older API Services only report existence
+			result = ingest_models.PiStatusNotFound
+			if response.Exists {
+				result = ingest_models.PiStatusOK
+			}
+		}
 		return nil
 	})
 
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
 	return result, nil
 }
 
+// ValidateBatch validates the Pis and devices of items in one call, returning
+// one result per item in the same order
+func (c *APIClient) ValidateBatch(ctx context.Context, items []ingest_models.ValidateItem) ([]ingest_models.ValidateResult, error) {
+	var results []ingest_models.ValidateResult
+	var resultErr error
+
+	call := callInfo{endpoint: "/internal/validate/batch"}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		resp, err := c.makeRequest(ctx, "POST", "/internal/validate/batch", ingest_models.ValidateBatchRequest{Items: items})
+		if err != nil {
+			resultErr = fmt.Errorf("failed to validate batch: %w", err)
+			return resultErr
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+			resultErr = ErrBatchUnsupported
+			return resultErr
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
+			return resultErr
+		}
+
+		var response ingest_models.ValidateBatchResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
+			return resultErr
+		}
+		if response.Error != "" {
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
+			return resultErr
+		}
+		if len(response.Results) != len(items) {
+			resultErr = fmt.Errorf("%w: %d results for %d items", errDecode, len(response.Results), len(items))
+			return resultErr
+		}
+
+		results = response.Results
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
 // ValidateDevice checks if a Device exists for a given Pi
 func (c *APIClient) ValidateDevice(ctx context.Context, piID string, deviceID int) (bool, error) {
+	if c.grpc != nil {
+		return c.grpcValidateDevice(ctx, piID, deviceID)
+	}
+
 	var result bool
 	var resultErr error
 
-	err := c.retryWithBackoff(ctx, func() error {
-		req := ValidateDeviceRequest{
+	call := callInfo{endpoint: "/internal/devices/validate", piID: piID, deviceID: deviceID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		req := ingest_models.ValidateDeviceRequest{
 			PiID:     piID,
-			DeviceID: deviceID,
+			DeviceID: &deviceID,
 		}
 
 		resp, err := c.makeRequest(ctx, "POST", "/internal/devices/validate", req)
@@ -243,18 +594,19 @@ func (c *APIClient) ValidateDevice(ctx context.Context, piID string, deviceID in
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			resultErr = fmt.Errorf("API returned status %d", resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
 			return resultErr
 		}
 
-		var response ValidateDeviceResponse
+		var response ingest_models.ValidateDeviceResponse
 		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			resultErr = fmt.Errorf("failed to decode response: %w", err)
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
 			return resultErr
 		}
 
 		if response.Error != "" {
-			resultErr = fmt.Errorf("API error: %s", response.Error)
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
 			return resultErr
 		}
 
@@ -269,17 +621,103 @@ func (c *APIClient) ValidateDevice(ctx context.Context, piID string, deviceID in
 	return result, nil
 }
 
+// ReportDiscoveredDevice records a device announced on a Pi's discovery topic as
+// pending approval. It returns one of the ingest_models.DiscoveryStatus* values.
+func (c *APIClient) ReportDiscoveredDevice(ctx context.Context, req ingest_models.DiscoveredDeviceRequest) (string, error) {
+	var result string
+	var resultErr error
+
+	call := callInfo{endpoint: "/internal/devices/discovered", piID: req.PiID, deviceID: *req.DeviceID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		resp, err := c.makeRequest(ctx, "POST", "/internal/devices/discovered", req)
+		if err != nil {
+			resultErr = fmt.Errorf("failed to report discovered device: %w", err)
+			return resultErr
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
+			return resultErr
+		}
+
+		var response ingest_models.DiscoveredDeviceResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
+			return resultErr
+		}
+
+		if response.Error != "" {
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
+			return resultErr
+		}
+
+		result = response.Status
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// AutoRegisterDevice creates an unknown device of a known Pi on its first
+// reading. It returns one of the ingest_models.AutoRegisterStatus* values.
+func (c *APIClient) AutoRegisterDevice(ctx context.Context, req ingest_models.AutoRegisterDeviceRequest) (string, error) {
+	var result string
+	var resultErr error
+
+	call := callInfo{endpoint: "/internal/devices/auto-register", piID: req.PiID, deviceID: *req.DeviceID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		resp, err := c.makeRequest(ctx, "POST", "/internal/devices/auto-register", req)
+		if err != nil {
+			resultErr = fmt.Errorf("failed to auto-register device: %w", err)
+			return resultErr
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
+			return resultErr
+		}
+
+		var response ingest_models.AutoRegisterDeviceResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
+			return resultErr
+		}
+
+		if response.Error != "" {
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
+			return resultErr
+		}
+
+		result = response.Status
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
 // CreateReading creates a reading in the API Service
 func (c *APIClient) CreateReading(ctx context.Context, reading hardware_models.Reading) error {
+	if c.grpc != nil {
+		return c.grpcCreateReading(ctx, reading)
+	}
+
 	var resultErr error
 
-	err := c.retryWithBackoff(ctx, func() error {
-		req := CreateReadingRequest{
-			PiID:     reading.PiID,
-			DeviceID: reading.DeviceID,
-			Ts:       reading.Ts,
-			Payload:  reading.Payload,
-		}
+	call := callInfo{endpoint: "/internal/readings", piID: reading.PiID, deviceID: reading.DeviceID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		req := ingest_models.NewCreateReadingRequest(reading)
 
 		resp, err := c.makeRequest(ctx, "POST", "/internal/readings", req)
 		if err != nil {
@@ -288,20 +726,40 @@ func (c *APIClient) CreateReading(ctx context.Context, reading hardware_models.R
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			var response ingest_models.CreateReadingResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				resultErr = fmt.Errorf("%w: %v", errDecode, err)
+				return resultErr
+			}
+			resultErr = fmt.Errorf("%w: %s", ErrSchemaViolation, describeViolations(response))
+			return resultErr
+		}
+
+		if resp.StatusCode == http.StatusConflict {
+			resultErr = ErrDuplicateReading
+			return resultErr
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			resultErr = ErrDeviceNotFound
+			return resultErr
+		}
+
 		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
-			resultErr = fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
 			return resultErr
 		}
 
-		var response CreateReadingResponse
+		var response ingest_models.CreateReadingResponse
 		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			resultErr = fmt.Errorf("failed to decode response: %w", err)
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
 			return resultErr
 		}
 
 		if !response.Success && response.Error != "" {
-			resultErr = fmt.Errorf("API error: %s", response.Error)
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
 			return resultErr
 		}
 
@@ -311,29 +769,142 @@ func (c *APIClient) CreateReading(ctx context.Context, reading hardware_models.R
 	return err
 }
 
+// CreateReadings creates a batch of readings in the API Service with one call.
+// Readings the API could not store are listed in the response's Failed, by
+// index into readings; the call itself only fails when none were stored.
+func (c *APIClient) CreateReadings(ctx context.Context, readings []hardware_models.Reading) (*ingest_models.CreateReadingsResponse, error) {
+	if c.grpc != nil {
+		return c.grpcCreateReadings(ctx, readings)
+	}
+
+	var result *ingest_models.CreateReadingsResponse
+	var resultErr error
+
+	call := callInfo{endpoint: "/internal/readings/batch"}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		req := ingest_models.CreateReadingsRequest{Readings: make([]ingest_models.CreateReadingRequest, len(readings))}
+		for n, reading := range readings {
+			req.Readings[n] = ingest_models.NewCreateReadingRequest(reading)
+		}
+
+		resp, err := c.makeRequest(ctx, "POST", "/internal/readings/batch", req)
+		if err != nil {
+			resultErr = fmt.Errorf("failed to create readings: %w", err)
+			return resultErr
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+			resultErr = ErrBatchUnsupported
+			return resultErr
+		}
+		if resp.StatusCode == http.StatusRequestEntityTooLarge {
+			resultErr = ErrBatchTooLarge
+			return resultErr
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resultErr = &APIError{Status: resp.StatusCode, Body: string(body)}
+			return resultErr
+		}
+
+		var response ingest_models.CreateReadingsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			resultErr = fmt.Errorf("%w: %v", errDecode, err)
+			return resultErr
+		}
+
+		if response.Error != "" {
+			resultErr = fmt.Errorf("%w: %s", errAPI, response.Error)
+			return resultErr
+		}
+
+		result = &response
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// describeViolations summarises a rejected reading for the error topic
+func describeViolations(response ingest_models.CreateReadingResponse) string {
+	parts := make([]string, 0, len(response.Violations))
+	for _, violation := range response.Violations {
+		if violation.Path == "" {
+			parts = append(parts, violation.Message)
+			continue
+		}
+		parts = append(parts, violation.Path+": "+violation.Message)
+	}
+	if len(parts) == 0 {
+		return response.Error
+	}
+	return response.Error + " (" + strings.Join(parts, "; ") + ")"
+}
+
 // makeRequest makes an HTTP request to the API Service
 func (c *APIClient) makeRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
 	var reqBody io.Reader
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
+		reqBody = bytes.NewReader(jsonData)
 	}
 
-	url := c.baseURL + path
-	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Add service-to-service authentication
-	req.Header.Set("Authorization", "Bearer "+c.apiSecret)
+	// Add service-to-service authentication: the request is signed with the
+	// secret rather than carrying it, and the signature expires
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(ingest_models.HeaderInternalTimestamp, timestamp)
+	req.Header.Set(ingest_models.HeaderInternalSignature, ingest_models.SignServiceRequest(c.apiSecret, method, req.URL.RequestURI(), timestamp, jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "mqtt-ingestor-service")
 
-	return c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMaintenance(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkMaintenance returns a maintenanceError when resp is the API's
+// maintenance 503. Any other 503 is left for the caller, body intact.
+func checkMaintenance(resp *http.Response) error {
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var response ingest_models.MaintenanceResponse
+	if err := json.Unmarshal(body, &response); err != nil || response.Code != ingest_models.ErrorCodeMaintenance {
+		return nil
+	}
+
+	retryAfter := maxMaintenanceWait
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return &maintenanceError{RetryAfter: retryAfter, Reason: response.Reason}
 }
 
 // Health checks if the API Service is healthy
@@ -351,6 +922,112 @@ func (c *APIClient) Health(ctx context.Context) error {
 	return nil
 }
 
+// SendHeartbeat reports this instance's queue and throughput to the API. It
+// makes a single attempt and skips the circuit breaker; a missed heartbeat is
+// simply replaced by the next one.
+func (c *APIClient) SendHeartbeat(ctx context.Context, heartbeat ingest_models.IngestorHeartbeat) error {
+	resp, err := c.makeRequest(ctx, "POST", "/internal/ingestors/heartbeat", heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{Status: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
+
+// ReportIngestErrors sends errors published to Pis to the API, which keeps
+// them as each Pi's rejection history. Like SendHeartbeat it makes a single
+// attempt and skips the circuit breaker: the errors were already published,
+// and a report that fails is only missing from the history. An API without
+// the endpoint gives ErrBatchUnsupported.
+func (c *APIClient) ReportIngestErrors(ctx context.Context, reports []ingest_models.IngestErrorReport) error {
+	resp, err := c.makeRequest(ctx, "POST", "/internal/ingest-errors/batch", ingest_models.IngestErrorBatchRequest{Errors: reports})
+	if err != nil {
+		return fmt.Errorf("failed to report ingest errors: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return ErrBatchUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{Status: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
+
+// RegistrySnapshot fetches the page of the API's registry snapshot that
+// follows cursor ("" for the first), limited to Pis and devices created since
+// updatedSince unless it is nil. Like SendHeartbeat it makes a single attempt
+// and skips the circuit breaker: the snapshot only saves validation calls.
+func (c *APIClient) RegistrySnapshot(ctx context.Context, updatedSince *time.Time, cursor string) (*ingest_models.RegistrySnapshotResponse, error) {
+	query := url.Values{}
+	if updatedSince != nil {
+		query.Set("updated_since", updatedSince.UTC().Format(time.RFC3339))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	path := "/internal/registry/snapshot"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := c.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registry snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil, ErrSnapshotUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Status: resp.StatusCode, Body: string(body)}
+	}
+
+	var response ingest_models.RegistrySnapshotResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecode, err)
+	}
+	return &response, nil
+}
+
+// TouchLiveness reports when each device written in a flush last sent a
+// reading. Like SendHeartbeat it makes a single attempt and skips the circuit
+// breaker: the next flush carries newer times anyway.
+func (c *APIClient) TouchLiveness(ctx context.Context, entries []ingest_models.LivenessEntry) (*ingest_models.LivenessResponse, error) {
+	resp, err := c.makeRequest(ctx, "POST", "/internal/liveness", ingest_models.LivenessRequest{Entries: entries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record liveness: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Status: resp.StatusCode, Body: string(body)}
+	}
+
+	var response ingest_models.LivenessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecode, err)
+	}
+	return &response, nil
+}
+
+// IsCircuitClosed reports whether the circuit breaker is letting calls through normally
+func (c *APIClient) IsCircuitClosed() bool {
+	c.circuitBreaker.mutex.RLock()
+	defer c.circuitBreaker.mutex.RUnlock()
+	return c.circuitBreaker.state == StateClosed
+}
+
 // GetCircuitBreakerStatus returns the current circuit breaker status for monitoring
 func (c *APIClient) GetCircuitBreakerStatus() map[string]interface{} {
 	c.circuitBreaker.mutex.RLock()
@@ -367,10 +1044,12 @@ func (c *APIClient) GetCircuitBreakerStatus() map[string]interface{} {
 	}
 
 	return map[string]interface{}{
-		"state":          stateStr,
-		"failure_count":  c.circuitBreaker.failureCount,
-		"last_fail_time": c.circuitBreaker.lastFailTime,
-		"max_failures":   c.circuitBreaker.maxFailures,
-		"reset_timeout":  c.circuitBreaker.resetTimeout,
+		"state":            stateStr,
+		"failure_count":    c.circuitBreaker.failureCount,
+		"last_fail_time":   c.circuitBreaker.lastFailTime,
+		"max_failures":     c.circuitBreaker.maxFailures,
+		"reset_timeout":    c.circuitBreaker.resetTimeout,
+		"next_probe_in":    c.circuitBreaker.nextProbeIn(),
+		"half_open_probes": c.circuitBreaker.halfOpenProbes,
 	}
 }
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// Calls a breakerStep makes against the breaker
+const (
+	callSuccess      = "success"      // let through, then succeeds
+	callFailure      = "failure"      // let through, then fails
+	callInconclusive = "inconclusive" // let through, then ends inconclusive
+	callPending      = "pending"      // let through and still in flight
+	callRefused      = "refused"      // refused by the breaker
+)
+
+// breakerStep advances the clock, makes one call and checks the state after it
+type breakerStep struct {
+	advance time.Duration
+	call    string
+	want    CircuitBreakerState
+}
+
+// trip opens a breaker built by newTestBreaker
+var trip = []breakerStep{
+	{call: callFailure, want: StateClosed},
+	{call: callFailure, want: StateClosed},
+	{call: callFailure, want: StateOpen},
+}
+
+// afterTrip returns the trip steps followed by steps
+func afterTrip(steps ...breakerStep) []breakerStep {
+	return append(append([]breakerStep{}, trip...), steps...)
+}
+
+// newTestBreaker opens after 3 failures, probes after 10s and allows 2 probes.
+// Its clock only moves when the returned function is called.
+func newTestBreaker() (*CircuitBreaker, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := &CircuitBreaker{
+		maxFailures:    3,
+		resetTimeout:   10 * time.Second,
+		halfOpenProbes: 2,
+		state:          StateClosed,
+		now:            func() time.Time { return now },
+	}
+	return cb, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "success resets the failure count",
+			steps: []breakerStep{
+				{call: callFailure, want: StateClosed},
+				{call: callFailure, want: StateClosed},
+				{call: callSuccess, want: StateClosed},
+				{call: callFailure, want: StateClosed},
+				{call: callFailure, want: StateClosed},
+			},
+		},
+		{
+			name: "closed to open",
+			steps: afterTrip(
+				breakerStep{call: callRefused, want: StateOpen},
+			),
+		},
+		{
+			name: "open to half-open",
+			steps: afterTrip(
+				breakerStep{advance: 9 * time.Second, call: callRefused, want: StateOpen},
+				breakerStep{advance: time.Second, call: callPending, want: StateHalfOpen},
+			),
+		},
+		{
+			name: "half-open probe limit",
+			steps: afterTrip(
+				breakerStep{advance: 10 * time.Second, call: callPending, want: StateHalfOpen},
+				breakerStep{call: callPending, want: StateHalfOpen},
+				breakerStep{call: callRefused, want: StateHalfOpen},
+				breakerStep{advance: time.Hour, call: callRefused, want: StateHalfOpen},
+			),
+		},
+		{
+			name: "inconclusive probe frees its slot",
+			steps: afterTrip(
+				breakerStep{advance: 10 * time.Second, call: callPending, want: StateHalfOpen},
+				breakerStep{call: callInconclusive, want: StateHalfOpen},
+				breakerStep{call: callPending, want: StateHalfOpen},
+				breakerStep{call: callRefused, want: StateHalfOpen},
+			),
+		},
+		{
+			name: "probe success closes",
+			steps: afterTrip(
+				breakerStep{advance: 10 * time.Second, call: callSuccess, want: StateClosed},
+				breakerStep{call: callFailure, want: StateClosed},
+				breakerStep{call: callFailure, want: StateClosed},
+				breakerStep{call: callFailure, want: StateOpen},
+			),
+		},
+		{
+			name: "probe failure reopens for a fresh timeout",
+			steps: afterTrip(
+				breakerStep{advance: 10 * time.Second, call: callFailure, want: StateOpen},
+				breakerStep{advance: 9 * time.Second, call: callRefused, want: StateOpen},
+				breakerStep{advance: time.Second, call: callPending, want: StateHalfOpen},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, advance := newTestBreaker()
+			for n, step := range tt.steps {
+				advance(step.advance)
+				allowed := cb.canExecute()
+				if allowed != (step.call != callRefused) {
+					t.Fatalf("step %d (%s): canExecute() = %v", n, step.call, allowed)
+				}
+				switch step.call {
+				case callSuccess:
+					cb.onSuccess()
+				case callFailure:
+					cb.onFailure()
+				case callInconclusive:
+					cb.onInconclusive()
+				}
+				if cb.state != step.want {
+					t.Fatalf("step %d (%s): state %d, want %d", n, step.call, cb.state, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerNextProbeIn(t *testing.T) {
+	cb, advance := newTestBreaker()
+	if got := cb.nextProbeIn(); got != 0 {
+		t.Errorf("closed: nextProbeIn() = %v, want 0", got)
+	}
+	for range trip {
+		cb.canExecute()
+		cb.onFailure()
+	}
+	advance(4 * time.Second)
+	if got := cb.nextProbeIn(); got != 6*time.Second {
+		t.Errorf("open: nextProbeIn() = %v, want 6s", got)
+	}
+	advance(time.Minute)
+	if got := cb.nextProbeIn(); got != 0 {
+		t.Errorf("past the reset timeout: nextProbeIn() = %v, want 0", got)
+	}
+}
+
+// isAPIError reports whether err carries an APIError with status
+func isAPIError(status int) func(error) bool {
+	return func(err error) bool {
+		var apiErr *APIError
+		return errors.As(err, &apiErr) && apiErr.Status == status
+	}
+}
+
+// A 2xx, 3xx or 4xx answer is final: the call isn't retried and the breaker
+// counts it as the API being healthy. A 408, 429 or 5xx is retried and counts
+// as a failure, so the breaker opens and refuses the calls after it; a
+// maintenance 503 is waited out without counting either way.
+func TestAPIClientStatusClasses(t *testing.T) {
+	const calls = 3
+	tests := []struct {
+		name         string
+		create       bool // call CreateReading rather than ValidatePi
+		status       int
+		body         string
+		wantRequests int64
+		wantState    CircuitBreakerState
+		wantErr      func(error) bool // for the last call; nil for no error
+	}{
+		{name: "200", status: http.StatusOK, body: `{"exists":true,"status":"ok"}`, wantRequests: calls, wantState: StateClosed},
+		{name: "201 reading", create: true, status: http.StatusCreated, body: `{"success":true}`, wantRequests: calls, wantState: StateClosed},
+		{name: "301 without a location", status: http.StatusMovedPermanently, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusMovedPermanently)},
+		{name: "304", status: http.StatusNotModified, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusNotModified)},
+		{name: "400", status: http.StatusBadRequest, body: `{"error":"bad request"}`, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusBadRequest)},
+		{name: "401", status: http.StatusUnauthorized, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusUnauthorized)},
+		{name: "403", status: http.StatusForbidden, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusForbidden)},
+		{name: "404", status: http.StatusNotFound, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusNotFound)},
+		{name: "409", status: http.StatusConflict, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusConflict)},
+		{name: "422", status: http.StatusUnprocessableEntity, wantRequests: calls, wantState: StateClosed, wantErr: isAPIError(http.StatusUnprocessableEntity)},
+		{name: "404 reading", create: true, status: http.StatusNotFound, wantRequests: calls, wantState: StateClosed, wantErr: func(err error) bool { return errors.Is(err, ErrDeviceNotFound) }},
+		{name: "409 reading", create: true, status: http.StatusConflict, wantRequests: calls, wantState: StateClosed, wantErr: func(err error) bool { return errors.Is(err, ErrDuplicateReading) }},
+		{name: "422 reading", create: true, status: http.StatusUnprocessableEntity, body: `{"success":false}`, wantRequests: calls, wantState: StateClosed, wantErr: func(err error) bool { return errors.Is(err, ErrSchemaViolation) }},
+		{name: "408", status: http.StatusRequestTimeout, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "429", status: http.StatusTooManyRequests, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "500", status: http.StatusInternalServerError, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "502", status: http.StatusBadGateway, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "503", status: http.StatusServiceUnavailable, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "500 reading", create: true, status: http.StatusInternalServerError, wantRequests: 3, wantState: StateOpen, wantErr: func(err error) bool { return errors.Is(err, errCircuitOpen) }},
+		{name: "503 maintenance", status: http.StatusServiceUnavailable, body: `{"error":"maintenance","code":"maintenance"}`, wantRequests: calls, wantState: StateClosed, wantErr: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			c := NewAPIClientWithConfig(server.URL, "secret", APIClientConfig{
+				MaxRetries:      2,
+				RetryDelay:      time.Millisecond,
+				BreakerFailures: 3,
+				BreakerReset:    time.Minute,
+			})
+
+			var err error
+			for range calls {
+				// Long enough for any retries, short of a maintenance wait
+				ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+				if tt.create {
+					err = c.CreateReading(ctx, hardware_models.Reading{PiID: "pi-1", DeviceID: 3, Ts: time.Now(), Payload: map[string]interface{}{"t": 21.5}})
+				} else {
+					_, err = c.ValidatePi(ctx, "pi-1")
+				}
+				cancel()
+			}
+
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("last call: %v", err)
+			}
+			if tt.wantErr != nil && !tt.wantErr(err) {
+				t.Errorf("last call error = %v", err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("%d requests for %d calls, want %d", got, calls, tt.wantRequests)
+			}
+			if got := c.circuitBreaker.state; got != tt.wantState {
+				t.Errorf("breaker state %v, want %v", got, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// APIClientConfig tunes the HTTP client, retries and circuit breaker of an
+// APIClient. Zero or negative values fall back to DefaultAPIClientConfig,
+// except MaxRetries, where 0 means a single attempt.
+type APIClientConfig struct {
+	Timeout             time.Duration // limit on one HTTP request, response body included
+	MaxRetries          int           // attempts after the first; negative uses the default
+	RetryDelay          time.Duration // backoff before the first retry, doubled for each one after
+	BreakerFailures     int           // consecutive failures that open the circuit breaker
+	BreakerReset        time.Duration // how long an open breaker refuses calls before probing
+	HalfOpenProbes      int           // calls let through to probe the API once the breaker half-opens
+	MaxIdleConnsPerHost int           // keep-alive connections kept to the API service
+	IdleConnTimeout     time.Duration // how long an unused keep-alive connection is kept
+}
+
+// DefaultAPIClientConfig returns the settings NewAPIClient uses
+func DefaultAPIClientConfig() APIClientConfig {
+	return APIClientConfig{
+		Timeout:             30 * time.Second,
+		MaxRetries:          3,
+		RetryDelay:          time.Second,
+		BreakerFailures:     5,
+		BreakerReset:        30 * time.Second,
+		HalfOpenProbes:      1,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// withDefaults replaces the unusable values of cfg with the defaults
+func (cfg APIClientConfig) withDefaults() APIClientConfig {
+	defaults := DefaultAPIClientConfig()
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = defaults.MaxRetries
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaults.RetryDelay
+	}
+	if cfg.BreakerFailures <= 0 {
+		cfg.BreakerFailures = defaults.BreakerFailures
+	}
+	if cfg.BreakerReset <= 0 {
+		cfg.BreakerReset = defaults.BreakerReset
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = defaults.HalfOpenProbes
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	return cfg
+}
+
+// transport returns the default transport with its idle connection limits
+// raised: the default keeps only 2 per host, so the flush workers open and
+// close connections to the API service all the time
+func (cfg APIClientConfig) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = max(transport.MaxIdleConns, cfg.MaxIdleConnsPerHost)
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	return transport
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Transports for the ingestor's hot path, the values of API_TRANSPORT
+const (
+	TransportHTTP = "http" // JSON over HTTP on the /internal routes
+	TransportGRPC = "grpc" // the API's gRPC service; see UseGRPC
+)
+
+// UseGRPC moves Pi and device validation and reading writes to the API's gRPC
+// service at target (host:port, the API's INTERNAL_GRPC_PORT), over plaintext
+// like the internal HTTP routes. Every other call stays on HTTP. The calls
+// keep the client's timeout, retries and circuit breaker, and fail the way
+// HTTP calls do, so callers can't tell the transports apart. The connection
+// is made on first use; opts are added to the defaults. UseGRPC must be
+// called before the client is used.
+func (c *APIClient) UseGRPC(target string, opts ...grpc.DialOption) error {
+	if target == "" {
+		return errors.New("gRPC target of the API service is empty")
+	}
+
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUserAgent("mqtt-ingestor-service"),
+		grpc.WithChainUnaryInterceptor(c.signUnaryCall),
+		grpc.WithChainStreamInterceptor(c.signStreamCall),
+	}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	c.grpcConn = conn
+	c.grpc = ingestpb.NewIngestServiceClient(conn)
+	return nil
+}
+
+// Close closes the gRPC connection, if UseGRPC opened one
+func (c *APIClient) Close() error {
+	if c.grpcConn == nil {
+		return nil
+	}
+	return c.grpcConn.Close()
+}
+
+// signCall adds the service authentication to a gRPC call's metadata, signed
+// with ingest_models.SignGRPCCall over a fresh nonce and request, the
+// marshalled request of a unary call or nil for a stream
+func (c *APIClient) signCall(ctx context.Context, method string, request []byte) (context.Context, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to sign gRPC call: %w", err)
+	}
+	nonceHex := hex.EncodeToString(nonce)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return metadata.AppendToOutgoingContext(ctx,
+		ingest_models.HeaderInternalTimestamp, timestamp,
+		ingest_models.HeaderInternalNonce, nonceHex,
+		ingest_models.HeaderInternalSignature, ingest_models.SignGRPCCall(c.apiSecret, method, timestamp, nonceHex, request),
+	), nil
+}
+
+func (c *APIClient) signUnaryCall(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	request, err := ingest_models.MarshalGRPCRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to sign gRPC call: %w", err)
+	}
+	ctx, err = c.signCall(ctx, method, request)
+	if err != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *APIClient) signStreamCall(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := c.signCall(ctx, method, nil)
+	if err != nil {
+		return nil, err
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// grpcValidatePi is ValidatePi over gRPC
+func (c *APIClient) grpcValidatePi(ctx context.Context, piID string) (string, error) {
+	var result string
+
+	call := callInfo{endpoint: ingestpb.IngestService_ValidatePi_FullMethodName, piID: piID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+
+		var trailer metadata.MD
+		resp, err := c.grpc.ValidatePi(callCtx, &ingestpb.ValidatePiRequest{PiId: piID}, grpc.Trailer(&trailer))
+		if err != nil {
+			return grpcError(ctx, err, trailer)
+		}
+		result = resp.GetStatus()
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// grpcValidateDevice is ValidateDevice over gRPC
+func (c *APIClient) grpcValidateDevice(ctx context.Context, piID string, deviceID int) (bool, error) {
+	var result bool
+
+	call := callInfo{endpoint: ingestpb.IngestService_ValidateDevice_FullMethodName, piID: piID, deviceID: deviceID}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+
+		var trailer metadata.MD
+		resp, err := c.grpc.ValidateDevice(callCtx, &ingestpb.ValidateDeviceRequest{PiId: piID, DeviceId: int32(deviceID)}, grpc.Trailer(&trailer))
+		if err != nil {
+			return grpcError(ctx, err, trailer)
+		}
+		result = resp.GetExists()
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+	return result, nil
+}
+
+// grpcCreateReadings is CreateReadings over gRPC
+func (c *APIClient) grpcCreateReadings(ctx context.Context, readings []hardware_models.Reading) (*ingest_models.CreateReadingsResponse, error) {
+	var result *ingest_models.CreateReadingsResponse
+
+	call := callInfo{endpoint: ingestpb.IngestService_CreateReadings_FullMethodName}
+	err := c.retryWithBackoff(ctx, call, func() error {
+		response, err := c.streamReadings(ctx, readings)
+		if err != nil {
+			return err
+		}
+		result = response
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// grpcCreateReading is CreateReading over gRPC: a stream of one reading,
+// whose failure is returned as the error the HTTP route's status gives
+func (c *APIClient) grpcCreateReading(ctx context.Context, reading hardware_models.Reading) error {
+	call := callInfo{endpoint: ingestpb.IngestService_CreateReadings_FullMethodName, piID: reading.PiID, deviceID: reading.DeviceID}
+	return c.retryWithBackoff(ctx, call, func() error {
+		response, err := c.streamReadings(ctx, []hardware_models.Reading{reading})
+		if err != nil {
+			return err
+		}
+		if len(response.Failed) == 0 {
+			return nil
+		}
+
+		failure := response.Failed[0]
+		switch failure.Reason {
+		case ingest_models.ReadingFailureSchemaViolation:
+			return fmt.Errorf("%w: %s", ErrSchemaViolation, describeViolations(ingest_models.CreateReadingResponse{Error: failure.Error, Violations: failure.Violations}))
+		case ingest_models.ReadingFailureDuplicate:
+			return ErrDuplicateReading
+		case ingest_models.ReadingFailureDeviceNotFound:
+			return ErrDeviceNotFound
+		default:
+			return &APIError{Status: http.StatusBadRequest, Body: failure.Error}
+		}
+	})
+}
+
+// streamReadings sends readings as one CreateReadings stream, within the
+// client's timeout
+func (c *APIClient) streamReadings(ctx context.Context, readings []hardware_models.Reading) (*ingest_models.CreateReadingsResponse, error) {
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stream, err := c.grpc.CreateReadings(callCtx)
+	if err != nil {
+		return nil, grpcError(ctx, err, nil)
+	}
+	for _, reading := range readings {
+		message, err := ingestpb.NewReading(ingest_models.NewCreateReadingRequest(reading))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create readings: %w", err)
+		}
+		if err := stream.Send(message); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The API ended the call early; its status comes from CloseAndRecv
+				break
+			}
+			return nil, grpcError(ctx, err, nil)
+		}
+	}
+
+	// ResourceExhausted is a batch too large unless the rate limit refused it
+	response, err := stream.CloseAndRecv()
+	if status.Code(err) == codes.ResourceExhausted && len(stream.Trailer().Get(ingest_models.MetadataRateLimitRetryAfter)) == 0 {
+		return nil, ErrBatchTooLarge
+	}
+	if err != nil {
+		return nil, grpcError(ctx, err, stream.Trailer())
+	}
+	return response.ToModel(), nil
+}
+
+// grpcError maps a failed gRPC call to the error an HTTP call failing the same
+// way returns, so retries, the circuit breaker and IsRejected treat both
+// transports alike: maintenance waits, an unreachable API is a network error,
+// a deadline is a timeout, and any other status is an APIError with the
+// matching HTTP status
+func grpcError(ctx context.Context, err error, trailer metadata.MD) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded:
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if st.Code() == codes.DeadlineExceeded {
+			return fmt.Errorf("gRPC call timed out: %w", context.DeadlineExceeded)
+		}
+	case codes.Unavailable:
+		if values := trailer.Get(ingest_models.MetadataMaintenanceRetryAfter); len(values) > 0 {
+			retryAfter := maxMaintenanceWait
+			if seconds, err := strconv.Atoi(values[0]); err == nil {
+				retryAfter = time.Duration(seconds) * time.Second
+			}
+			var reason string
+			if values := trailer.Get(ingest_models.MetadataMaintenanceReason); len(values) > 0 {
+				reason = values[0]
+			}
+			return &maintenanceError{RetryAfter: retryAfter, Reason: reason}
+		}
+		return fmt.Errorf("failed to reach API over gRPC: %s", st.Message())
+	}
+	return &APIError{Status: httpStatusFromCode(st.Code()), Body: st.Message()}
+}
+
+// httpStatusFromCode returns the HTTP status the API would have answered with
+// for a gRPC status code
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
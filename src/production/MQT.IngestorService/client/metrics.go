@@ -0,0 +1,24 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for calls made to the API Service. Labels are kept to the
+// endpoint and outcome so cardinality stays fixed; per-Pi detail lives in the
+// ingestor's bounded failure tracker.
+var (
+	apiRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "api_requests_total",
+		Help:      "API Service request attempts, by endpoint and result classification.",
+	}, []string{"endpoint", "result"})
+
+	apiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "api_request_duration_seconds",
+		Help:      "API Service request attempt latency, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+)
@@ -0,0 +1,55 @@
+package mqtingestor
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// autoRegisterDevice creates the unknown device of reading, whose Pi has
+// already been validated, with its type taken from the topic's metric
+// segment. It reports whether the device exists now. Pis are never created:
+// one that has disappeared since validation leaves the device unknown.
+// Readings of the same device in one flush share one validation, so the
+// device is registered once per flush; across replicas the API keeps the
+// first registration.
+func (i *Ingestor) autoRegisterDevice(ctx context.Context, reading ingest_models.ReadingEnvelope, deviceID int) (bool, error) {
+	topic, err := ingest_models.ParseSensorTopic(reading.Topic)
+	if err != nil || topic.Metric == "" {
+		return false, nil
+	}
+
+	if i.cfg.DryRun {
+		i.logger.Logger.Info().
+			Str("event", "would_auto_register").
+			Str("pi_id", reading.PiID).
+			Int("device_id", deviceID).
+			Str("device_type", topic.Metric).
+			Msg("Dry run: unknown device not registered")
+		return false, nil
+	}
+
+	status, err := i.apiClient.AutoRegisterDevice(ctx, ingest_models.AutoRegisterDeviceRequest{
+		PiID:       reading.PiID,
+		DeviceID:   &deviceID,
+		DeviceType: topic.Metric,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch status {
+	case ingest_models.AutoRegisterStatusCreated:
+		i.logger.Logger.Info().Str("pi_id", reading.PiID).Int("device_id", deviceID).Str("device_type", topic.Metric).Msg("Auto-registered unknown device")
+		devicesAutoRegisteredTotal.Inc()
+	case ingest_models.AutoRegisterStatusExists:
+		i.logger.Logger.Debug().Str("pi_id", reading.PiID).Int("device_id", deviceID).Msg("Device to auto-register already exists")
+	default:
+		i.logger.Logger.Warn().Str("pi_id", reading.PiID).Int("device_id", deviceID).Str("status", status).Msg("Device not auto-registered")
+		return false, nil
+	}
+	i.validations.put(deviceCacheKey(reading.PiID, strconv.Itoa(deviceID)), deviceStatusOK, true, time.Now())
+	return true, nil
+}
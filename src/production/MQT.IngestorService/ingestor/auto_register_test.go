@@ -0,0 +1,154 @@
+package mqtingestor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// fakeRegistryAPI is an API Service whose Pis all exist but whose devices
+// exist only once auto-registered. It counts registrations and readings
+// written per device.
+type fakeRegistryAPI struct {
+	mu            sync.Mutex
+	registered    map[string]bool
+	registrations map[string]int
+	written       map[string]int
+}
+
+func newFakeRegistryAPI() *fakeRegistryAPI {
+	return &fakeRegistryAPI{registered: map[string]bool{}, registrations: map[string]int{}, written: map[string]int{}}
+}
+
+func registryKey(piID string, deviceID int) string {
+	return fmt.Sprintf("%s/%d", piID, deviceID)
+}
+
+func (f *fakeRegistryAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/internal/validate/batch":
+		var req ingest_models.ValidateBatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		results := make([]ingest_models.ValidateResult, len(req.Items))
+		for n, item := range req.Items {
+			results[n] = ingest_models.ValidateResult{PiID: item.PiID, DeviceID: item.DeviceID, PiExists: true, PiStatus: ingest_models.PiStatusOK}
+			if item.DeviceID != nil {
+				results[n].DeviceExists = f.registered[registryKey(item.PiID, *item.DeviceID)]
+			}
+		}
+		json.NewEncoder(w).Encode(ingest_models.ValidateBatchResponse{Results: results})
+	case "/internal/devices/auto-register":
+		var req ingest_models.AutoRegisterDeviceRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		key := registryKey(req.PiID, *req.DeviceID)
+		f.registrations[key]++
+		status := ingest_models.AutoRegisterStatusCreated
+		if f.registered[key] {
+			status = ingest_models.AutoRegisterStatusExists
+		}
+		f.registered[key] = true
+		json.NewEncoder(w).Encode(ingest_models.AutoRegisterDeviceResponse{Status: status})
+	case "/internal/readings/batch":
+		var req ingest_models.CreateReadingsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, reading := range req.Readings {
+			f.written[registryKey(reading.PiID, *reading.DeviceID)]++
+		}
+		json.NewEncoder(w).Encode(ingest_models.CreateReadingsResponse{Inserted: len(req.Readings)})
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+func autoRegisterReading(piID, deviceID string, ts time.Time) ingest_models.ReadingEnvelope {
+	return ingest_models.ReadingEnvelope{
+		PiID:       piID,
+		DeviceID:   deviceID,
+		Topic:      fmt.Sprintf("sensors/%s/%s/temperature", piID, deviceID),
+		Payload:    map[string]interface{}{"t": 21.5},
+		Ts:         ts,
+		ReceivedAt: ts,
+	}
+}
+
+// Several readings of one unknown device in a flush register it once and are
+// all written; a later flush finds it registered
+func TestAutoRegisterOncePerDevice(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		flushes           [][]ingest_models.ReadingEnvelope
+		wantRegistrations map[string]int
+		wantWritten       map[string]int
+	}{
+		{
+			name: "two readings of one device",
+			flushes: [][]ingest_models.ReadingEnvelope{{
+				autoRegisterReading("pi-1", "3", ts),
+				autoRegisterReading("pi-1", "3", ts.Add(time.Second)),
+			}},
+			wantRegistrations: map[string]int{"pi-1/3": 1},
+			wantWritten:       map[string]int{"pi-1/3": 2},
+		},
+		{
+			name: "the same device spelt two ways",
+			flushes: [][]ingest_models.ReadingEnvelope{{
+				autoRegisterReading("pi-1", "3", ts),
+				autoRegisterReading("pi-1", "03", ts.Add(time.Second)),
+			}},
+			wantRegistrations: map[string]int{"pi-1/3": 1},
+			wantWritten:       map[string]int{"pi-1/3": 2},
+		},
+		{
+			name: "interleaved with other devices",
+			flushes: [][]ingest_models.ReadingEnvelope{{
+				autoRegisterReading("pi-1", "3", ts),
+				autoRegisterReading("pi-1", "4", ts),
+				autoRegisterReading("pi-2", "3", ts),
+				autoRegisterReading("pi-1", "3", ts.Add(time.Second)),
+				autoRegisterReading("pi-1", "4", ts.Add(time.Second)),
+			}},
+			wantRegistrations: map[string]int{"pi-1/3": 1, "pi-1/4": 1, "pi-2/3": 1},
+			wantWritten:       map[string]int{"pi-1/3": 2, "pi-1/4": 2, "pi-2/3": 1},
+		},
+		{
+			name: "a later flush",
+			flushes: [][]ingest_models.ReadingEnvelope{
+				{autoRegisterReading("pi-1", "3", ts), autoRegisterReading("pi-1", "3", ts.Add(time.Second))},
+				{autoRegisterReading("pi-1", "3", ts.Add(2*time.Second))},
+			},
+			wantRegistrations: map[string]int{"pi-1/3": 1},
+			wantWritten:       map[string]int{"pi-1/3": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeRegistryAPI()
+			i := newWorkerTestIngestor(t, api, 1)
+			i.cfg.AutoRegisterDevices = true
+
+			for _, flush := range tt.flushes {
+				i.processBatch(context.Background(), flush, newLivenessBatch())
+			}
+
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			if !reflect.DeepEqual(api.registrations, tt.wantRegistrations) {
+				t.Errorf("registrations %v, want %v", api.registrations, tt.wantRegistrations)
+			}
+			if !reflect.DeepEqual(api.written, tt.wantWritten) {
+				t.Errorf("readings written %v, want %v", api.written, tt.wantWritten)
+			}
+		})
+	}
+}
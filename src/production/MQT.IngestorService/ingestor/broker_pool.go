@@ -0,0 +1,120 @@
+package mqtingestor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// brokerPool rotates connection attempts across the configured brokers.
+//
+// paho walks its server list from the top on every connection attempt, so on
+// its own a reconnect always lands on the first reachable broker. The pool is
+// installed as the client's dialer and shifts each dial by an offset that moves
+// past the broker last connected to, so reconnects continue round-robin from
+// there while still trying every broker in one attempt. paho only sees the
+// servers as a list of equals; the TLS config is applied to whichever one is
+// dialed.
+type brokerPool struct {
+	urls []*url.URL
+
+	mu        sync.Mutex
+	offset    int // added to paho's server index to pick the broker to dial
+	lastDial  int // index of the broker most recently dialed
+	connected int // index of the broker of the current connection, -1 when disconnected
+}
+
+func newBrokerPool(rawURLs []string) (*brokerPool, error) {
+	p := &brokerPool{lastDial: -1, connected: -1}
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.urls = append(p.urls, u)
+	}
+	if len(p.urls) == 0 {
+		return nil, fmt.Errorf("no brokers configured")
+	}
+	return p, nil
+}
+
+// indexOf returns the position of the server paho is about to try
+func (p *brokerPool) indexOf(server *url.URL) int {
+	for i, u := range p.urls {
+		if u.String() == server.String() {
+			return i
+		}
+	}
+	return 0
+}
+
+// pick returns the broker to dial in place of server and remembers it
+func (p *brokerPool) pick(server *url.URL) *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx := (p.indexOf(server) + p.offset) % len(p.urls)
+	p.lastDial = idx
+	return p.urls[idx]
+}
+
+// dial opens the network connection for one paho connection attempt. Only the
+// tcp and TLS schemes ParseBrokerURLs accepts need handling here.
+func (p *brokerPool) dial(server *url.URL, opts mqtt.ClientOptions) (net.Conn, error) {
+	target := p.pick(server)
+
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 30 * time.Second}
+	}
+
+	switch target.Scheme {
+	case "tcp", "mqtt":
+		return dialer.Dial("tcp", target.Host)
+	default:
+		return tls.DialWithDialer(dialer, "tcp", target.Host, opts.TLSConfig)
+	}
+}
+
+// markConnected records the broker just dialed as the current connection and
+// moves the next attempt on to the broker after it
+func (p *brokerPool) markConnected() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastDial < 0 {
+		return ""
+	}
+	p.connected = p.lastDial
+	p.offset = (p.connected + 1) % len(p.urls)
+	return p.urls[p.connected].String()
+}
+
+func (p *brokerPool) markDisconnected() {
+	p.mu.Lock()
+	p.connected = -1
+	p.mu.Unlock()
+}
+
+// current returns the URL of the connected broker, or "" while disconnected
+func (p *brokerPool) current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connected < 0 {
+		return ""
+	}
+	return p.urls[p.connected].String()
+}
+
+// all returns the configured broker URLs in configuration order
+func (p *brokerPool) all() []string {
+	urls := make([]string, len(p.urls))
+	for i, u := range p.urls {
+		urls[i] = u.String()
+	}
+	return urls
+}
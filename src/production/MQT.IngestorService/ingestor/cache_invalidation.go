@@ -0,0 +1,55 @@
+package mqtingestor
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// cacheInvalidationMaxSkew is how far an invalidation's timestamp may be from
+// this ingestor's clock, as for signed service requests
+const cacheInvalidationMaxSkew = 5 * time.Minute
+
+// cacheInvalidationEnabled reports whether the API's invalidation events are
+// subscribed. They are signed with the shared secret, so it is needed to
+// check them.
+func (i *Ingestor) cacheInvalidationEnabled() bool {
+	return i.cfg.CacheInvalidationTopic != "" && i.cfg.ControlSecret != ""
+}
+
+// onCacheInvalidation evicts the Pi or device of an invalidation event from the
+// validation cache, so a Pi or device registered after a miss is accepted with
+// its next reading instead of once the negative TTL has passed, and one that
+// was deleted is refused. Events that aren't signed by the API are dropped.
+func (i *Ingestor) onCacheInvalidation(_ mqtt.Client, m mqtt.Message) {
+	var message ingest_models.CacheInvalidationMessage
+	if err := json.Unmarshal(m.Payload(), &message); err != nil {
+		cacheInvalidationsTotal.WithLabelValues("malformed").Inc()
+		i.logger.Logger.Warn().Err(err).Str("topic", m.Topic()).Msg("Dropped malformed cache invalidation")
+		return
+	}
+	event, err := message.Verify(i.cfg.ControlSecret, m.Topic(), time.Now(), cacheInvalidationMaxSkew)
+	if err != nil {
+		cacheInvalidationsTotal.WithLabelValues("unauthorized").Inc()
+		i.logger.Logger.Warn().Err(err).Str("topic", m.Topic()).Msg("Dropped cache invalidation that failed verification")
+		return
+	}
+
+	i.invalidate(event)
+	cacheInvalidationsTotal.WithLabelValues("applied").Inc()
+}
+
+// invalidate evicts the Pi, with its devices, or the device an event names
+func (i *Ingestor) invalidate(event ingest_models.CacheInvalidation) {
+	log := i.logger.Logger.Debug().Str("pi_id", event.PiID).Str("action", event.Action)
+	if event.DeviceID != nil {
+		i.validations.invalidate(deviceCacheKey(event.PiID, strconv.Itoa(*event.DeviceID)))
+		log.Int("device_id", *event.DeviceID).Msg("Evicted device from the validation cache")
+		return
+	}
+	i.validations.invalidatePi(event.PiID)
+	log.Msg("Evicted Pi from the validation cache")
+}
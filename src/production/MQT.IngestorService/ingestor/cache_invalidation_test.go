@@ -0,0 +1,153 @@
+package mqtingestor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	client "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+const (
+	testInvalidationTopic  = "internal/cache-invalidate"
+	testInvalidationSecret = "secret"
+)
+
+// fakeMessage is an MQTT message as delivered to a handler
+type fakeMessage struct {
+	topic     string
+	payload   []byte
+	retained  bool
+	duplicate bool
+}
+
+func (m fakeMessage) Duplicate() bool   { return m.duplicate }
+func (m fakeMessage) Qos() byte         { return 1 }
+func (m fakeMessage) Retained() bool    { return m.retained }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+// fakeDeviceAPI answers device validation with whether the device has been
+// registered yet, counting the lookups
+type fakeDeviceAPI struct {
+	registered atomic.Bool
+	lookups    atomic.Int32
+}
+
+func (f *fakeDeviceAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lookups.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingest_models.ValidateDeviceResponse{Exists: f.registered.Load()})
+}
+
+func newInvalidationTestIngestor(t *testing.T, api http.Handler) *Ingestor {
+	t.Helper()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	nop := zerolog.Nop()
+	return &Ingestor{
+		cfg: mqtmodels.IngestorConfig{
+			CacheInvalidationTopic: testInvalidationTopic,
+			ControlSecret:          testInvalidationSecret,
+		},
+		apiClient:   client.NewAPIClient(server.URL, testInvalidationSecret),
+		logger:      &logger.Logger{Logger: &nop},
+		validations: newValidationCache(time.Minute, 30*time.Second),
+	}
+}
+
+func invalidationMessage(t *testing.T, secret string, event ingest_models.CacheInvalidation) fakeMessage {
+	t.Helper()
+	message, err := ingest_models.SignCacheInvalidation(secret, testInvalidationTopic, event, time.Now())
+	if err != nil {
+		t.Fatalf("SignCacheInvalidation: %v", err)
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return fakeMessage{topic: testInvalidationTopic, payload: payload}
+}
+
+// A device created right after a reading missed it is accepted with the next
+// reading, not once the negative TTL has passed
+func TestCacheInvalidationAcceptsDeviceCreatedAfterMiss(t *testing.T) {
+	api := &fakeDeviceAPI{}
+	i := newInvalidationTestIngestor(t, api)
+	ctx := context.Background()
+
+	if exists, err := i.deviceExists(ctx, "pi-1", 0, nil); err != nil || exists {
+		t.Fatalf("deviceExists before registration = %v, %v; want false, nil", exists, err)
+	}
+
+	api.registered.Store(true)
+	if exists, _ := i.deviceExists(ctx, "pi-1", 0, nil); exists {
+		t.Fatal("deviceExists skipped the cached miss before any invalidation")
+	}
+
+	deviceID := 0
+	i.onCacheInvalidation(nil, invalidationMessage(t, testInvalidationSecret, ingest_models.CacheInvalidation{
+		PiID: "pi-1", DeviceID: &deviceID, Action: ingest_models.CacheInvalidationCreated,
+	}))
+
+	exists, err := i.deviceExists(ctx, "pi-1", 0, nil)
+	if err != nil || !exists {
+		t.Fatalf("deviceExists after invalidation = %v, %v; want true, nil", exists, err)
+	}
+	if got := api.lookups.Load(); got != 2 {
+		t.Errorf("API was asked %d times, want 2", got)
+	}
+}
+
+func TestCacheInvalidationIgnoresUnsignedEvents(t *testing.T) {
+	i := newInvalidationTestIngestor(t, &fakeDeviceAPI{})
+	now := time.Now()
+	key := deviceCacheKey("pi-1", "3")
+	i.validations.put(key, deviceStatusNotFound, false, now)
+
+	deviceID := 3
+	event := ingest_models.CacheInvalidation{PiID: "pi-1", DeviceID: &deviceID, Action: ingest_models.CacheInvalidationCreated}
+	for name, message := range map[string]fakeMessage{
+		"wrong secret": invalidationMessage(t, "other", event),
+		"malformed":    {topic: testInvalidationTopic, payload: []byte("not json")},
+	} {
+		i.onCacheInvalidation(nil, message)
+		if _, ok := i.validations.lookup(key, now); !ok {
+			t.Errorf("%s: entry was evicted", name)
+		}
+	}
+}
+
+func TestCacheInvalidationOfPiEvictsItsDevices(t *testing.T) {
+	i := newInvalidationTestIngestor(t, &fakeDeviceAPI{})
+	now := time.Now()
+	for _, key := range []string{piCacheKey("pi-1"), deviceCacheKey("pi-1", "0"), deviceCacheKey("pi-1", "7"), piCacheKey("pi-10"), deviceCacheKey("pi-10", "0")} {
+		i.validations.put(key, ingest_models.PiStatusOK, true, now)
+	}
+
+	i.onCacheInvalidation(nil, invalidationMessage(t, testInvalidationSecret, ingest_models.CacheInvalidation{
+		PiID: "pi-1", Action: ingest_models.CacheInvalidationDeleted,
+	}))
+
+	for _, key := range []string{piCacheKey("pi-1"), deviceCacheKey("pi-1", "0"), deviceCacheKey("pi-1", "7")} {
+		if _, ok := i.validations.lookup(key, now); ok {
+			t.Errorf("%s is still cached", key)
+		}
+	}
+	for _, key := range []string{piCacheKey("pi-10"), deviceCacheKey("pi-10", "0")} {
+		if _, ok := i.validations.lookup(key, now); !ok {
+			t.Errorf("%s was evicted with pi-1", key)
+		}
+	}
+}
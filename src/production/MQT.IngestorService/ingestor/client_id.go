@@ -0,0 +1,56 @@
+package mqtingestor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// ClientID returns the MQTT client ID in use, with its suffix once Start has
+// added one
+func (i *Ingestor) ClientID() string {
+	return i.cfg.ClientID
+}
+
+// suffixedClientID returns ClientID with the instance ID appended, so replicas
+// sharing MQTT_CLIENT_ID each get their own session instead of the broker
+// disconnecting one whenever the other connects. The instance ID is the
+// hostname by default, which keeps the ID stable across restarts of the same
+// container. Without a usable instance ID a random suffix is used, which
+// changes on every start; a persistent session for it is never resumed, so
+// MQTT_CLEAN_SESSION should be set.
+func (i *Ingestor) suffixedClientID() string {
+	suffix := clientIDSuffix(i.cfg.InstanceID)
+	if suffix == "" {
+		suffix = randomClientIDSuffix()
+		if !i.cfg.CleanSession {
+			i.logger.Logger.Warn().Msg("MQTT client ID has a random suffix but MQTT_CLEAN_SESSION is off: the broker keeps a session for every start that is never resumed")
+		}
+	}
+	if strings.HasSuffix(i.cfg.ClientID, "-"+suffix) {
+		return i.cfg.ClientID
+	}
+	return i.cfg.ClientID + "-" + suffix
+}
+
+// clientIDSuffix keeps the letters, digits, '-' and '_' of instanceID, which
+// every broker accepts in a client ID. "unknown", the instance ID when the
+// hostname can't be read, gives "".
+func clientIDSuffix(instanceID string) string {
+	if instanceID == "unknown" {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, instanceID)
+}
+
+// randomClientIDSuffix returns 8 random hex digits
+func randomClientIDSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
 	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
 )
 
@@ -21,6 +22,30 @@ func mustInt(env string, def int) int {
 	return i
 }
 
+func mustInt64(env string, def int64) int64 {
+	v := os.Getenv(env)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || i < 0 {
+		log.Fatalf("invalid %s: %q", env, v)
+	}
+	return i
+}
+
+func mustFloat(env string, def float64) float64 {
+	v := os.Getenv(env)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", env, err)
+	}
+	return f
+}
+
 func mustBool(env string, def bool) bool {
 	v := os.Getenv(env)
 	if v == "" {
@@ -48,10 +73,81 @@ func mustDur(env string, def time.Duration) time.Duration {
 	return d
 }
 
+func mustQoS(env string, def byte) byte {
+	q := mustInt(env, int(def))
+	if q < 0 || q > 2 {
+		log.Fatalf("invalid %s: %d (expected 0, 1 or 2)", env, q)
+	}
+	return byte(q)
+}
+
+// mustOverflowPolicy reads the overflow policy from env, or from fallbackEnv,
+// its older name, when env is unset
+func mustOverflowPolicy(env, fallbackEnv, def string) string {
+	if os.Getenv(env) == "" && os.Getenv(fallbackEnv) != "" {
+		env = fallbackEnv
+	}
+	p := defaultStr(env, def)
+	if p != OverflowBlock && p != OverflowDropNewest && p != OverflowDropOldest && p != OverflowSpool {
+		log.Fatalf("invalid %s: %q (expected %q, %q, %q or %q)", env, p, OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSpool)
+	}
+	return p
+}
+
+func mustSchemaErrorType(env, def string) string {
+	t := defaultStr(env, def)
+	if t != errorTypeSchemaViolation && t != errorTypeSchemaValidationFailed {
+		log.Fatalf("invalid %s: %q (expected %q or %q)", env, t, errorTypeSchemaViolation, errorTypeSchemaValidationFailed)
+	}
+	return t
+}
+
+func mustAPITransport(env, def string) string {
+	t := defaultStr(env, def)
+	if t != client.TransportHTTP && t != client.TransportGRPC {
+		log.Fatalf("invalid %s: %q (expected %q or %q)", env, t, client.TransportHTTP, client.TransportGRPC)
+	}
+	if t == client.TransportGRPC && os.Getenv("API_GRPC_ADDR") == "" {
+		log.Fatalf("%s=%s needs API_GRPC_ADDR", env, t)
+	}
+	return t
+}
+
+// hostname is the default instance ID; in a container it is the container ID
+// or pod name, which is unique per replica
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+// APIClientConfig returns the API client settings of cfg
+func APIClientConfig(cfg mqtmodels.IngestorConfig) client.APIClientConfig {
+	return client.APIClientConfig{
+		Timeout:             cfg.APIClientTimeout,
+		MaxRetries:          cfg.APIClientMaxRetries,
+		RetryDelay:          cfg.APIClientRetryDelay,
+		BreakerFailures:     cfg.APIClientBreakerFailures,
+		BreakerReset:        cfg.APIClientBreakerReset,
+		HalfOpenProbes:      cfg.CircuitHalfOpenProbes,
+		MaxIdleConnsPerHost: cfg.APIClientMaxIdleConns,
+		IdleConnTimeout:     cfg.APIClientIdleConnTimeout,
+	}
+}
+
+func mustValidConnection(cfg mqtmodels.IngestorConfig) {
+	if err := cfg.ValidateConnection(); err != nil {
+		log.Fatalf("invalid MQTT connection settings: %v", err)
+	}
+}
+
 func Load() mqtmodels.IngestorConfig {
-	return mqtmodels.IngestorConfig{
+	cfg := mqtmodels.IngestorConfig{
 		BrokerHost:  os.Getenv("BROKER_HOST"),
 		BrokerPort:  mustInt("BROKER_PORT", 1883),
+		BrokerURLs:  os.Getenv("BROKER_URLS"),
 		BrokerUser:  os.Getenv("BROKER_USER"),
 		BrokerPass:  os.Getenv("BROKER_PASS"),
 		UseTLS:      mustBool("BROKER_TLS", false),
@@ -59,6 +155,19 @@ func Load() mqtmodels.IngestorConfig {
 		Topic:       defaultStr("MQTT_TOPIC", "sensors/#"),
 		ClientID:    defaultStr("MQTT_CLIENT_ID", "go-ingestor-1"),
 		SharedGroup: os.Getenv("MQTT_SHARED_GROUP"),
+		QoS:         mustQoS("MQTT_QOS", 1),
+
+		ClientIDAutoSuffix: mustBool("MQTT_CLIENT_ID_AUTOSUFFIX", os.Getenv("MQTT_SHARED_GROUP") != ""),
+		CleanSession:       mustBool("MQTT_CLEAN_SESSION", false),
+
+		KeepAlive:            mustDur("MQTT_KEEP_ALIVE", 30*time.Second),
+		PingTimeout:          mustDur("MQTT_PING_TIMEOUT", 10*time.Second),
+		ConnectRetryInterval: mustDur("MQTT_CONNECT_RETRY_INTERVAL", 5*time.Second),
+		MaxReconnectInterval: mustDur("MQTT_MAX_RECONNECT_INTERVAL", 10*time.Minute),
+		DisconnectQuiesce:    mustDur("MQTT_DISCONNECT_QUIESCE", 500*time.Millisecond),
+
+		DiscoveryEnabled: mustBool("MQTT_DISCOVERY_ENABLED", true),
+		DiscoveryTopic:   defaultStr("MQTT_DISCOVERY_TOPIC", "discovery/+"),
 
 		PostgresHost:     defaultStr("POSTGRES_HOST", "localhost"),
 		PostgresPort:     mustInt("POSTGRES_PORT", 5432),
@@ -69,14 +178,87 @@ func Load() mqtmodels.IngestorConfig {
 
 		BatchSize:   mustInt("BATCH_SIZE", 200),
 		BatchWindow: mustDur("BATCH_WINDOW", 1*time.Second),
+		Workers:     mustInt("INGESTOR_WORKERS", 4),
+
+		QueueSize:            mustInt("QUEUE_SIZE", 4096),
+		QueueMaxBytes:        mustInt64("QUEUE_MAX_BYTES", 64<<20),
+		QueueOverflowPolicy:  mustOverflowPolicy("INGESTOR_OVERFLOW", "QUEUE_OVERFLOW_POLICY", OverflowBlock),
+		QueueDegradedPercent: mustInt("QUEUE_DEGRADED_PERCENT", 80),
+		DryRun:               mustBool("INGEST_DRY_RUN", false),
+		ShutdownTimeout:      mustDur("INGESTOR_SHUTDOWN_TIMEOUT", 20*time.Second),
+
+		MaxMsgsPerPiPerSec: mustFloat("INGESTOR_MAX_MSGS_PER_PI_PER_SEC", 0),
+		RateLimitCooldown:  mustDur("INGESTOR_RATE_LIMIT_COOLDOWN", time.Minute),
+
+		IgnoreRetained: mustBool("INGESTOR_IGNORE_RETAINED", true),
+
+		PayloadFormat:        defaultStr("INGESTOR_PAYLOAD_FORMAT", PayloadFormatJSON),
+		MaxDecompressedBytes: mustInt64("INGESTOR_MAX_DECOMPRESSED_BYTES", 1<<20),
+		StoreInvalidAsRaw:    mustBool("INGESTOR_STORE_INVALID_AS_RAW", false),
+
+		PayloadTimestampField: defaultStr("PAYLOAD_TS_FIELD", "ts"),
+		MaxTimestampSkew:      mustDur("MAX_TIMESTAMP_SKEW", 5*time.Minute),
+		MaxPayloadReadings:    mustInt("MAX_PAYLOAD_READINGS", 500),
+
+		DedupWindow:     mustDur("INGESTOR_DEDUP_WINDOW", 0),
+		DedupMaxEntries: mustInt("INGESTOR_DEDUP_MAX_ENTRIES", 100000),
+
+		AutoRegisterDevices: mustBool("INGESTOR_AUTO_REGISTER_DEVICES", false),
+
+		ValidationCacheTTL:         mustDur("VALIDATION_CACHE_TTL", 5*time.Minute),
+		ValidationCacheNegativeTTL: mustDur("VALIDATION_CACHE_NEGATIVE_TTL", 30*time.Second),
+		RegistrySnapshot:           mustBool("INGESTOR_REGISTRY_SNAPSHOT", true),
+		RegistryRefreshInterval:    mustDur("INGESTOR_REGISTRY_REFRESH_INTERVAL", 5*time.Minute),
+		CacheInvalidationTopic:     os.Getenv("CACHE_INVALIDATION_TOPIC"),
+
+		APIClientTimeout:         mustDur("API_CLIENT_TIMEOUT", 30*time.Second),
+		APIClientMaxRetries:      mustInt("API_CLIENT_MAX_RETRIES", 3),
+		APIClientRetryDelay:      mustDur("API_CLIENT_RETRY_DELAY", time.Second),
+		APIClientBreakerFailures: mustInt("API_CLIENT_BREAKER_FAILURES", 5),
+		APIClientBreakerReset:    mustDur("API_CLIENT_BREAKER_RESET", 30*time.Second),
+		CircuitHalfOpenProbes:    mustInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", 1),
+		APIClientMaxIdleConns:    mustInt("API_CLIENT_MAX_IDLE_CONNS", 32),
+		APIClientIdleConnTimeout: mustDur("API_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second),
+		APITransport:             mustAPITransport("API_TRANSPORT", client.TransportHTTP),
+		APIGRPCAddr:              os.Getenv("API_GRPC_ADDR"),
+
+		SpoolDir:            os.Getenv("INGEST_SPOOL_DIR"),
+		SpoolMaxBytes:       mustInt64("INGEST_SPOOL_MAX_BYTES", 256<<20),
+		SpoolFileMaxBytes:   mustInt64("INGEST_SPOOL_FILE_MAX_BYTES", 8<<20),
+		SpoolReplayInterval: mustDur("INGEST_SPOOL_REPLAY_INTERVAL", 30*time.Second),
+
+		PublishErrors:      mustBool("MQTT_PUBLISH_ERRORS", true),
+		ErrorBufferSize:    mustInt("ERROR_BUFFER_SIZE", 50),
+		ErrorTopicTemplate: defaultStr("ERROR_TOPIC_TEMPLATE", "ingestor/errors/{pi_id}/{device_id}"),
+		ErrorQoS:           mustQoS("MQTT_ERROR_QOS", 1),
+		ErrorRetained:      mustBool("MQTT_ERROR_RETAINED", false),
+		ReportErrors:       mustBool("INGESTOR_REPORT_ERRORS", true),
+		ErrorReportBuffer:  mustInt("INGESTOR_ERROR_REPORT_BUFFER", 256),
+		SchemaErrorType:    mustSchemaErrorType("INGESTOR_SCHEMA_ERROR_TYPE", errorTypeSchemaViolation),
+
+		StatusEnabled:       mustBool("MQTT_STATUS_ENABLED", true),
+		StatusTopicTemplate: defaultStr("MQTT_STATUS_TOPIC", "ingestor/status/{client_id}"),
+
+		ControlEnabled:       mustBool("INGESTOR_CONTROL_ENABLED", true),
+		ControlTopicTemplate: defaultStr("INGESTOR_CONTROL_TOPIC", "ingestor/control/{client_id}"),
+		ControlSecret:        os.Getenv("INTERNAL_API_SECRET"),
+
+		InstanceID:        defaultStr("INGESTOR_INSTANCE_ID", hostname()),
+		HeartbeatInterval: mustDur("HEARTBEAT_INTERVAL", 15*time.Second),
+
+		MaxTrackedPis: mustInt("DEBUG_MAX_TRACKED_PIS", 1000),
+		DebugToken:    os.Getenv("DEBUG_TOKEN"),
 	}
+	mustValidConnection(cfg)
+	return cfg
 }
 
 // LoadFromEnv loads configuration from environment variables for the new microservice architecture
 func LoadFromEnv() mqtmodels.IngestorConfig {
-	return mqtmodels.IngestorConfig{
+	cfg := mqtmodels.IngestorConfig{
 		BrokerHost:  os.Getenv("BROKER_HOST"),
 		BrokerPort:  mustInt("BROKER_PORT", 1883),
+		BrokerURLs:  os.Getenv("BROKER_URLS"),
 		BrokerUser:  os.Getenv("BROKER_USER"),
 		BrokerPass:  os.Getenv("BROKER_PASS"),
 		UseTLS:      mustBool("BROKER_TLS", false),
@@ -84,11 +266,96 @@ func LoadFromEnv() mqtmodels.IngestorConfig {
 		Topic:       defaultStr("MQTT_TOPIC", "sensors/#"),
 		ClientID:    defaultStr("MQTT_CLIENT_ID", "mqtt-ingestor-1"),
 		SharedGroup: os.Getenv("MQTT_SHARED_GROUP"),
+		QoS:         mustQoS("MQTT_QOS", 1),
+
+		ClientIDAutoSuffix: mustBool("MQTT_CLIENT_ID_AUTOSUFFIX", os.Getenv("MQTT_SHARED_GROUP") != ""),
+		CleanSession:       mustBool("MQTT_CLEAN_SESSION", false),
+
+		KeepAlive:            mustDur("MQTT_KEEP_ALIVE", 30*time.Second),
+		PingTimeout:          mustDur("MQTT_PING_TIMEOUT", 10*time.Second),
+		ConnectRetryInterval: mustDur("MQTT_CONNECT_RETRY_INTERVAL", 5*time.Second),
+		MaxReconnectInterval: mustDur("MQTT_MAX_RECONNECT_INTERVAL", 10*time.Minute),
+		DisconnectQuiesce:    mustDur("MQTT_DISCONNECT_QUIESCE", 500*time.Millisecond),
+
+		DiscoveryEnabled: mustBool("MQTT_DISCOVERY_ENABLED", true),
+		DiscoveryTopic:   defaultStr("MQTT_DISCOVERY_TOPIC", "discovery/+"),
 
 		// No database configuration needed for microservice architecture
 		BatchSize:   mustInt("BATCH_SIZE", 200),
 		BatchWindow: mustDur("BATCH_WINDOW", 1*time.Second),
+		Workers:     mustInt("INGESTOR_WORKERS", 4),
+
+		QueueSize:            mustInt("QUEUE_SIZE", 4096),
+		QueueMaxBytes:        mustInt64("QUEUE_MAX_BYTES", 64<<20),
+		QueueOverflowPolicy:  mustOverflowPolicy("INGESTOR_OVERFLOW", "QUEUE_OVERFLOW_POLICY", OverflowBlock),
+		QueueDegradedPercent: mustInt("QUEUE_DEGRADED_PERCENT", 80),
+		DryRun:               mustBool("INGEST_DRY_RUN", false),
+		ShutdownTimeout:      mustDur("INGESTOR_SHUTDOWN_TIMEOUT", 20*time.Second),
+
+		MaxMsgsPerPiPerSec: mustFloat("INGESTOR_MAX_MSGS_PER_PI_PER_SEC", 0),
+		RateLimitCooldown:  mustDur("INGESTOR_RATE_LIMIT_COOLDOWN", time.Minute),
+
+		IgnoreRetained: mustBool("INGESTOR_IGNORE_RETAINED", true),
+
+		PayloadFormat:        defaultStr("INGESTOR_PAYLOAD_FORMAT", PayloadFormatJSON),
+		MaxDecompressedBytes: mustInt64("INGESTOR_MAX_DECOMPRESSED_BYTES", 1<<20),
+		StoreInvalidAsRaw:    mustBool("INGESTOR_STORE_INVALID_AS_RAW", false),
+
+		PayloadTimestampField: defaultStr("PAYLOAD_TS_FIELD", "ts"),
+		MaxTimestampSkew:      mustDur("MAX_TIMESTAMP_SKEW", 5*time.Minute),
+		MaxPayloadReadings:    mustInt("MAX_PAYLOAD_READINGS", 500),
+
+		DedupWindow:     mustDur("INGESTOR_DEDUP_WINDOW", 0),
+		DedupMaxEntries: mustInt("INGESTOR_DEDUP_MAX_ENTRIES", 100000),
+
+		AutoRegisterDevices: mustBool("INGESTOR_AUTO_REGISTER_DEVICES", false),
+
+		ValidationCacheTTL:         mustDur("VALIDATION_CACHE_TTL", 5*time.Minute),
+		ValidationCacheNegativeTTL: mustDur("VALIDATION_CACHE_NEGATIVE_TTL", 30*time.Second),
+		RegistrySnapshot:           mustBool("INGESTOR_REGISTRY_SNAPSHOT", true),
+		RegistryRefreshInterval:    mustDur("INGESTOR_REGISTRY_REFRESH_INTERVAL", 5*time.Minute),
+		CacheInvalidationTopic:     os.Getenv("CACHE_INVALIDATION_TOPIC"),
+
+		APIClientTimeout:         mustDur("API_CLIENT_TIMEOUT", 30*time.Second),
+		APIClientMaxRetries:      mustInt("API_CLIENT_MAX_RETRIES", 3),
+		APIClientRetryDelay:      mustDur("API_CLIENT_RETRY_DELAY", time.Second),
+		APIClientBreakerFailures: mustInt("API_CLIENT_BREAKER_FAILURES", 5),
+		APIClientBreakerReset:    mustDur("API_CLIENT_BREAKER_RESET", 30*time.Second),
+		CircuitHalfOpenProbes:    mustInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", 1),
+		APIClientMaxIdleConns:    mustInt("API_CLIENT_MAX_IDLE_CONNS", 32),
+		APIClientIdleConnTimeout: mustDur("API_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second),
+		APITransport:             mustAPITransport("API_TRANSPORT", client.TransportHTTP),
+		APIGRPCAddr:              os.Getenv("API_GRPC_ADDR"),
+
+		SpoolDir:            os.Getenv("INGEST_SPOOL_DIR"),
+		SpoolMaxBytes:       mustInt64("INGEST_SPOOL_MAX_BYTES", 256<<20),
+		SpoolFileMaxBytes:   mustInt64("INGEST_SPOOL_FILE_MAX_BYTES", 8<<20),
+		SpoolReplayInterval: mustDur("INGEST_SPOOL_REPLAY_INTERVAL", 30*time.Second),
+
+		PublishErrors:      mustBool("MQTT_PUBLISH_ERRORS", true),
+		ErrorBufferSize:    mustInt("ERROR_BUFFER_SIZE", 50),
+		ErrorTopicTemplate: defaultStr("ERROR_TOPIC_TEMPLATE", "ingestor/errors/{pi_id}/{device_id}"),
+		ErrorQoS:           mustQoS("MQTT_ERROR_QOS", 1),
+		ErrorRetained:      mustBool("MQTT_ERROR_RETAINED", false),
+		ReportErrors:       mustBool("INGESTOR_REPORT_ERRORS", true),
+		ErrorReportBuffer:  mustInt("INGESTOR_ERROR_REPORT_BUFFER", 256),
+		SchemaErrorType:    mustSchemaErrorType("INGESTOR_SCHEMA_ERROR_TYPE", errorTypeSchemaViolation),
+
+		StatusEnabled:       mustBool("MQTT_STATUS_ENABLED", true),
+		StatusTopicTemplate: defaultStr("MQTT_STATUS_TOPIC", "ingestor/status/{client_id}"),
+
+		ControlEnabled:       mustBool("INGESTOR_CONTROL_ENABLED", true),
+		ControlTopicTemplate: defaultStr("INGESTOR_CONTROL_TOPIC", "ingestor/control/{client_id}"),
+		ControlSecret:        os.Getenv("INTERNAL_API_SECRET"),
+
+		InstanceID:        defaultStr("INGESTOR_INSTANCE_ID", hostname()),
+		HeartbeatInterval: mustDur("HEARTBEAT_INTERVAL", 15*time.Second),
+
+		MaxTrackedPis: mustInt("DEBUG_MAX_TRACKED_PIS", 1000),
+		DebugToken:    os.Getenv("DEBUG_TOKEN"),
 	}
+	mustValidConnection(cfg)
+	return cfg
 }
 
 func required(k string) string {
@@ -0,0 +1,230 @@
+package mqtingestor
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// controlQoS is the QoS of control acks
+const controlQoS = 1
+
+// liveSettings are the settings the control topic can change while the
+// ingestor runs. topics is replaced whole, never modified in place.
+type liveSettings struct {
+	batchSize   int
+	batchWindow time.Duration
+	topics      []string // reading topic filters, without the shared group prefix
+}
+
+// settings returns the batch and topic settings in effect
+func (i *Ingestor) settings() liveSettings {
+	i.liveMu.RLock()
+	defer i.liveMu.RUnlock()
+	return i.live
+}
+
+// controlEnabled reports whether the control topic is subscribed. It needs the
+// shared secret, or anyone who can publish to the broker could reconfigure the
+// ingestor.
+func (i *Ingestor) controlEnabled() bool {
+	return i.cfg.ControlEnabled && i.cfg.ControlSecret != "" && i.cfg.ControlTopicTemplate != ""
+}
+
+// controlTopic renders the configured control topic template for this client
+func (i *Ingestor) controlTopic() string {
+	return strings.NewReplacer("{client_id}", i.cfg.ClientID, "{instance_id}", i.cfg.InstanceID).Replace(i.cfg.ControlTopicTemplate)
+}
+
+// onControl applies a command from the control topic and acks it with the
+// settings in effect afterwards. Malformed commands and those without the
+// shared secret are logged and dropped unanswered; retained ones are ignored
+// so a stale command isn't applied again on every reconnect.
+func (i *Ingestor) onControl(_ mqtt.Client, m mqtt.Message) {
+	if m.Retained() {
+		i.logger.Logger.Warn().Str("topic", m.Topic()).Msg("Ignoring retained control command")
+		return
+	}
+
+	var cmd ingest_models.ControlCommand
+	if err := json.Unmarshal(m.Payload(), &cmd); err != nil {
+		controlCommandsTotal.WithLabelValues("malformed").Inc()
+		i.logger.Logger.Warn().Err(err).Str("topic", m.Topic()).Msg("Rejected malformed control command")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(cmd.Secret), []byte(i.cfg.ControlSecret)) != 1 {
+		controlCommandsTotal.WithLabelValues("unauthorized").Inc()
+		i.logger.Logger.Warn().Str("topic", m.Topic()).Str("cmd", cmd.Cmd).Msg("Rejected control command with a missing or wrong secret")
+		return
+	}
+
+	i.controlMu.Lock()
+	defer i.controlMu.Unlock()
+
+	var err error
+	switch cmd.Cmd {
+	case ingest_models.ControlCmdSetBatch:
+		err = i.setBatch(cmd)
+	case ingest_models.ControlCmdResubscribe:
+		err = i.resubscribe(cmd.Topic)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd.Cmd)
+	}
+
+	ack := ingest_models.ControlAck{
+		ID:        cmd.ID,
+		Cmd:       cmd.Cmd,
+		Status:    ingest_models.ControlStatusApplied,
+		Config:    i.controlSettings(),
+		Timestamp: time.Now().UTC(),
+	}
+	if err != nil {
+		controlCommandsTotal.WithLabelValues("rejected").Inc()
+		i.logger.Logger.Warn().Err(err).Str("cmd", cmd.Cmd).Str("id", cmd.ID).Msg("Rejected control command")
+		ack.Status = ingest_models.ControlStatusRejected
+		ack.Error = err.Error()
+	} else {
+		controlCommandsTotal.WithLabelValues("applied").Inc()
+		i.logger.Logger.Info().Str("cmd", cmd.Cmd).Str("id", cmd.ID).Int("batch_size", ack.Config.BatchSize).Str("batch_window", ack.Config.BatchWindow).Strs("topics", ack.Config.Topics).Msg("Applied control command")
+	}
+	i.publishControlAck(ack)
+}
+
+// setBatch changes the batch size and/or window. Both are checked as
+// BATCH_SIZE and BATCH_WINDOW are at startup, then swapped together, and the
+// batch writer picks them up at once.
+func (i *Ingestor) setBatch(cmd ingest_models.ControlCommand) error {
+	if cmd.Size == 0 && cmd.Window == "" {
+		return errors.New("set_batch needs size, window or both")
+	}
+
+	current := i.settings()
+	next := i.cfg
+	next.BatchSize = current.batchSize
+	next.BatchWindow = current.batchWindow
+	if cmd.Size != 0 {
+		next.BatchSize = cmd.Size
+	}
+	if cmd.Window != "" {
+		window, err := time.ParseDuration(cmd.Window)
+		if err != nil {
+			return fmt.Errorf("invalid window: %w", err)
+		}
+		next.BatchWindow = window
+	}
+	if err := next.ValidateBatching(); err != nil {
+		return err
+	}
+
+	i.liveMu.Lock()
+	i.live.batchSize = next.BatchSize
+	i.live.batchWindow = next.BatchWindow
+	i.liveMu.Unlock()
+
+	select {
+	case i.batchChanged <- struct{}{}:
+	default: // a change is already waiting to be picked up, and will read these settings
+	}
+	return nil
+}
+
+// resubscribe replaces the reading topic filters with list. The new filters
+// are subscribed before the old ones are dropped, so no readings are missed in
+// between; if any is refused, those just added are unsubscribed again and the
+// old filters stay.
+func (i *Ingestor) resubscribe(list string) error {
+	filters := mqtmodels.ParseTopicFilters(list)
+	if len(filters) == 0 {
+		return errors.New("resubscribe needs at least one topic filter")
+	}
+	for _, filter := range filters {
+		if err := mqtmodels.ValidateTopicFilter(filter); err != nil {
+			return err
+		}
+	}
+	// Retries for a connection still subscribing would miss the change
+	if !i.IsSubscribed() {
+		return errors.New("subscriptions are not active yet; try again once the ingestor is subscribed")
+	}
+
+	current := i.settings().topics
+	var added []string
+	for _, filter := range filters {
+		if slices.Contains(current, filter) {
+			continue
+		}
+		topic := i.sharedTopic(filter)
+		if err := subscribeOnce(i.mqttClient, topic, i.cfg.QoS, i.onMessage); err != nil {
+			i.unsubscribe(added)
+			return fmt.Errorf("subscribing to %s: %w", filter, err)
+		}
+		added = append(added, topic)
+	}
+
+	i.liveMu.Lock()
+	i.live.topics = filters
+	i.liveMu.Unlock()
+
+	var removed []string
+	for _, filter := range current {
+		if !slices.Contains(filters, filter) {
+			removed = append(removed, i.sharedTopic(filter))
+		}
+	}
+	i.unsubscribe(removed)
+	return nil
+}
+
+// unsubscribe drops topics, logging rather than returning a failure: the
+// subscription is gone from the settings either way, and the next reconnect
+// won't restore it
+func (i *Ingestor) unsubscribe(topics []string) {
+	if len(topics) == 0 {
+		return
+	}
+	token := i.mqttClient.Unsubscribe(topics...)
+	if !token.WaitTimeout(subscribeTimeout) {
+		i.logger.Logger.Error().Strs("topics", topics).Msg("Timed out unsubscribing from MQTT topics")
+		return
+	}
+	if err := token.Error(); err != nil {
+		i.logger.Logger.Error().Err(err).Strs("topics", topics).Msg("Failed to unsubscribe from MQTT topics")
+	}
+}
+
+// controlSettings returns the settings in effect as reported in control acks
+func (i *Ingestor) controlSettings() ingest_models.ControlSettings {
+	settings := i.settings()
+	return ingest_models.ControlSettings{
+		BatchSize:   settings.batchSize,
+		BatchWindow: settings.batchWindow.String(),
+		Topics:      settings.topics,
+	}
+}
+
+// publishControlAck publishes ack on the control topic's /ack subtopic
+func (i *Ingestor) publishControlAck(ack ingest_models.ControlAck) {
+	payload, err := json.Marshal(ack)
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Msg("Failed to marshal control ack")
+		return
+	}
+
+	topic := i.controlTopic() + "/ack"
+	token := i.mqttClient.Publish(topic, controlQoS, false, payload)
+	if !token.WaitTimeout(statusPublishTimeout) {
+		i.logger.Logger.Warn().Str("topic", topic).Str("cmd", ack.Cmd).Msg("Timed out publishing control ack")
+		return
+	}
+	if err := token.Error(); err != nil {
+		i.logger.Logger.Warn().Err(err).Str("topic", topic).Str("cmd", ack.Cmd).Msg("Failed to publish control ack")
+	}
+}
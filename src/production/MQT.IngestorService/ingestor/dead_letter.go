@@ -0,0 +1,122 @@
+package mqtingestor
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// failOrSpool handles readings that couldn't be validated or written because
+// of err. When the API was unreachable or failing and the spool is enabled
+// they are spooled for replay; otherwise, or once the spool is full, they are
+// dropped as failAll does, each Pi being told on its own error topic. A
+// request the API refused outright, with a 4xx other than 408 or 429, is
+// reported as rejected_by_api rather than errorType, so a Pi can tell bad data
+// from an outage.
+func (i *Ingestor) failOrSpool(readings []ingest_models.ReadingEnvelope, err error, errorType, message string) {
+	if client.IsRejected(err) {
+		errorType = "rejected_by_api"
+	}
+	if i.spool != nil && err != nil && client.IsTransient(err) {
+		n, spoolErr := i.spool.append(readings)
+		if n > 0 {
+			i.logger.Logger.Warn().Err(err).Int("readings", n).Msg("API unavailable; spooled readings for replay")
+			i.stats.recordSpooled(n)
+		}
+		if spoolErr != nil {
+			i.logger.Logger.Error().Err(spoolErr).Msg("Failed to spool readings")
+		} else if n < len(readings) {
+			i.logger.Logger.Error().Int("readings", len(readings)-n).Msg("Spool is full; dropping readings")
+		}
+		readings = readings[n:]
+	}
+	for _, group := range groupByPi(readings) {
+		i.failAll(group.readings, errorType, message)
+	}
+}
+
+// runSpoolReplay replays spooled readings every SpoolReplayInterval until
+// ingestion stops
+func (i *Ingestor) runSpoolReplay(ctx context.Context) {
+	ticker := time.NewTicker(i.cfg.SpoolReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.stopCh:
+			return
+		case <-ticker.C:
+			i.replaySpool(ctx)
+		}
+	}
+}
+
+// replaySpool feeds spooled readings back through validation and writing,
+// oldest file first, a batch at a time. It only starts while the circuit
+// breaker is closed and the API answers its health check, and stops as soon
+// as the breaker opens again; readings that fail again go back to the spool.
+func (i *Ingestor) replaySpool(ctx context.Context) {
+	if !i.replayable(ctx) {
+		return
+	}
+
+	for {
+		name, ok := i.spool.next()
+		if !ok {
+			return
+		}
+
+		var offset int64
+		for {
+			readings, next, err := i.spool.read(name, offset, i.settings().batchSize)
+			if err != nil {
+				i.logger.Logger.Error().Err(err).Str("file", name).Msg("Failed to read spool file")
+				return
+			}
+			if len(readings) == 0 && next == offset {
+				break
+			}
+			offset = next
+			if len(readings) > 0 {
+				i.logger.Logger.Info().Str("file", name).Int("readings", len(readings)).Msg("Replaying spooled readings")
+				i.processBatch(ctx, readings, newLivenessBatch())
+			}
+
+			if !i.spoolReplayContinues() {
+				if err := i.spool.truncate(name, offset); err != nil {
+					i.logger.Logger.Error().Err(err).Str("file", name).Msg("Failed to trim replayed readings from spool file")
+				}
+				return
+			}
+		}
+
+		if err := i.spool.remove(name); err != nil {
+			i.logger.Logger.Error().Err(err).Str("file", name).Msg("Failed to remove replayed spool file")
+			return
+		}
+	}
+}
+
+// replayable reports whether the API looks able to take replayed readings
+func (i *Ingestor) replayable(ctx context.Context) bool {
+	if !i.apiClient.IsCircuitClosed() {
+		return false
+	}
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return i.apiClient.Health(healthCtx) == nil
+}
+
+// spoolReplayContinues reports whether replay should go on to the next batch
+func (i *Ingestor) spoolReplayContinues() bool {
+	select {
+	case <-i.stopCh:
+		return false
+	default:
+		return i.apiClient.IsCircuitClosed()
+	}
+}
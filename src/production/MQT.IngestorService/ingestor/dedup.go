@@ -0,0 +1,66 @@
+package mqtingestor
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// dedupFilter drops readings already seen from the same Pi and device with the
+// same payload and a ts in the same window, as sent by gateways that
+// retransmit on reconnect. Keys are kept in an LRU of at most maxEntries, so
+// memory stays flat however many devices report. It is used only by the batch
+// writer goroutine.
+type dedupFilter struct {
+	window     time.Duration
+	maxEntries int
+	order      *list.List // keys, most recently seen first
+	entries    map[string]*list.Element
+}
+
+func newDedupFilter(window time.Duration, maxEntries int) *dedupFilter {
+	return &dedupFilter{window: window, maxEntries: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// seen reports whether reading duplicates one seen recently, and remembers it
+// otherwise
+func (d *dedupFilter) seen(reading ingest_models.ReadingEnvelope) bool {
+	key, ok := d.key(reading)
+	if !ok {
+		return false
+	}
+	if element, ok := d.entries[key]; ok {
+		d.order.MoveToFront(element)
+		return true
+	}
+
+	d.entries[key] = d.order.PushFront(key)
+	if d.order.Len() > d.maxEntries {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(string))
+	}
+	return false
+}
+
+// key identifies reading by Pi, device, payload hash and ts truncated to the
+// window. Payload maps encode with sorted keys, so equal payloads hash the
+// same. It reports false when the payload can't be encoded.
+func (d *dedupFilter) key(reading ingest_models.ReadingEnvelope) (string, bool) {
+	payload, err := json.Marshal(reading.Payload)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("%s\x00%s\x00%x\x00%d", reading.PiID, reading.DeviceID, sum[:16], reading.Ts.Truncate(d.window).UnixNano()), true
+}
+
+// duplicate drops a reading the dedup filter has seen
+func (i *Ingestor) duplicate(reading ingest_models.ReadingEnvelope) {
+	i.logger.Logger.Debug().Str("pi_id", reading.PiID).Str("device_id", reading.DeviceID).Time("ts", reading.Ts).Msg("Dropping duplicate reading")
+	i.stats.recordDuplicate()
+}
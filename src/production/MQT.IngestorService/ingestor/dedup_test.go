@@ -0,0 +1,93 @@
+package mqtingestor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+func dedupReading(piID, deviceID string, ts time.Time, payload map[string]interface{}) ingest_models.ReadingEnvelope {
+	return ingest_models.ReadingEnvelope{PiID: piID, DeviceID: deviceID, Payload: payload, Ts: ts, ReceivedAt: ts}
+}
+
+// A retransmitted reading is dropped; one that differs in anything but the
+// order of its payload keys or its ts within the window is kept
+func TestDedupFilter(t *testing.T) {
+	window := time.Minute
+	ts := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	first := dedupReading("pi-1", "3", ts, map[string]interface{}{"t": 21.5, "h": 40.0})
+
+	tests := []struct {
+		name    string
+		reading ingest_models.ReadingEnvelope
+		want    bool
+	}{
+		// Duplicates
+		{name: "identical", reading: first, want: true},
+		{name: "keys in another order", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"h": 40.0, "t": 21.5}), want: true},
+		{name: "later in the same window", reading: dedupReading("pi-1", "3", ts.Add(45*time.Second), map[string]interface{}{"t": 21.5, "h": 40.0}), want: true},
+		{name: "received later", reading: ingest_models.ReadingEnvelope{PiID: "pi-1", DeviceID: "3", Payload: map[string]interface{}{"t": 21.5, "h": 40.0}, Ts: ts, ReceivedAt: ts.Add(time.Hour)}, want: true},
+
+		// Near duplicates
+		{name: "another value", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"t": 21.6, "h": 40.0}), want: false},
+		{name: "an extra field", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"t": 21.5, "h": 40.0, "b": 3.7}), want: false},
+		{name: "a missing field", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"t": 21.5}), want: false},
+		{name: "a number as a string", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"t": "21.5", "h": 40.0}), want: false},
+		{name: "a nested difference", reading: dedupReading("pi-1", "3", ts, map[string]interface{}{"t": 21.5, "h": 40.0, "gps": map[string]interface{}{"lat": 1.0}}), want: false},
+		{name: "another device", reading: dedupReading("pi-1", "4", ts, map[string]interface{}{"t": 21.5, "h": 40.0}), want: false},
+		{name: "another Pi", reading: dedupReading("pi-2", "3", ts, map[string]interface{}{"t": 21.5, "h": 40.0}), want: false},
+		{name: "the next window", reading: dedupReading("pi-1", "3", ts.Add(50*time.Second), map[string]interface{}{"t": 21.5, "h": 40.0}), want: false},
+		{name: "the previous window", reading: dedupReading("pi-1", "3", ts.Add(-11*time.Second), map[string]interface{}{"t": 21.5, "h": 40.0}), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDedupFilter(window, 100)
+			if d.seen(first) {
+				t.Fatal("the first reading was taken for a duplicate")
+			}
+			if got := d.seen(tt.reading); got != tt.want {
+				t.Errorf("seen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Readings whose payload can't be hashed are never dropped
+func TestDedupFilterUnencodablePayload(t *testing.T) {
+	d := newDedupFilter(time.Minute, 100)
+	reading := dedupReading("pi-1", "3", time.Now(), map[string]interface{}{"t": math.NaN()})
+	for n := range 2 {
+		if d.seen(reading) {
+			t.Errorf("reading %d dropped", n)
+		}
+	}
+}
+
+// Past maxEntries the least recently seen key is forgotten, and seeing a
+// duplicate again keeps its key
+func TestDedupFilterEviction(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reading := func(deviceID string) ingest_models.ReadingEnvelope {
+		return dedupReading("pi-1", deviceID, ts, map[string]interface{}{"t": 1.0})
+	}
+	d := newDedupFilter(time.Minute, 2)
+
+	d.seen(reading("1"))
+	d.seen(reading("2"))
+	if !d.seen(reading("1")) {
+		t.Fatal("device 1 not a duplicate before eviction")
+	}
+	d.seen(reading("3")) // evicts device 2, the least recently seen
+
+	if !d.seen(reading("1")) {
+		t.Error("device 1 was evicted although seen more recently than device 2")
+	}
+	if d.seen(reading("2")) {
+		t.Error("device 2 still remembered past maxEntries")
+	}
+	if len(d.entries) != 2 || d.order.Len() != 2 {
+		t.Errorf("%d entries and %d in order, want 2", len(d.entries), d.order.Len())
+	}
+}
@@ -0,0 +1,75 @@
+package mqtingestor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// discoveryTimeout bounds reporting one announcement, retries included
+const discoveryTimeout = 30 * time.Second
+
+// onDiscovery forwards a device announcement to the API, which records it as
+// pending until the Pi's owner or an admin approves it. Announcements are rare,
+// so they skip the reading queue and are reported right away.
+func (i *Ingestor) onDiscovery(_ mqtt.Client, m mqtt.Message) {
+	i.logger.Logger.Debug().Str("topic", m.Topic()).Str("payload", string(m.Payload())).Msg("Received discovery message")
+
+	piID, err := ingest_models.ParseDiscoveryTopic(m.Topic())
+	if err != nil {
+		i.logger.Logger.Warn().Str("topic", m.Topic()).Str("expected", ingest_models.DiscoveryTopicFormat).Msg("Invalid discovery topic format")
+		i.publishError(m.Topic(), "unknown", "unknown", "invalid_topic", err.Error())
+		return
+	}
+
+	var msg ingest_models.DiscoveryMessage
+	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+		i.publishError(m.Topic(), piID, "unknown", "invalid_discovery", fmt.Sprintf("Invalid discovery message: %v", err))
+		return
+	}
+	if err := msg.Validate(); err != nil {
+		i.publishError(m.Topic(), piID, "unknown", "invalid_discovery", fmt.Sprintf("Invalid discovery message: %v", err))
+		return
+	}
+	deviceID := strconv.Itoa(*msg.DeviceID)
+
+	if i.cfg.DryRun {
+		i.logger.Logger.Info().
+			Str("event", "would_report_device").
+			Str("pi_id", piID).
+			Int("device_id", *msg.DeviceID).
+			Str("device_type", msg.DeviceType).
+			Msg("Dry run: discovered device not reported")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+
+	status, err := i.apiClient.ReportDiscoveredDevice(ctx, ingest_models.DiscoveredDeviceRequest{
+		PiID:       piID,
+		DeviceID:   msg.DeviceID,
+		DeviceType: msg.DeviceType,
+		Firmware:   msg.Firmware,
+	})
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Str("pi_id", piID).Int("device_id", *msg.DeviceID).Msg("Failed to report discovered device via API")
+		i.publishError(m.Topic(), piID, deviceID, "discovery_error", fmt.Sprintf("Failed to report discovered device %d: %v", *msg.DeviceID, err))
+		return
+	}
+
+	switch status {
+	case ingest_models.DiscoveryStatusPiNotFound:
+		i.logger.Logger.Warn().Str("pi_id", piID).Int("device_id", *msg.DeviceID).Msg("Ignoring discovered device: pi not found")
+		i.publishError(m.Topic(), piID, deviceID, "pi_not_found", fmt.Sprintf("Pi %s does not exist", piID))
+	case ingest_models.DiscoveryStatusRegistered:
+		i.logger.Logger.Debug().Str("pi_id", piID).Int("device_id", *msg.DeviceID).Msg("Discovered device is already registered")
+	default:
+		i.logger.Logger.Info().Str("pi_id", piID).Int("device_id", *msg.DeviceID).Str("device_type", msg.DeviceType).Msg("Discovered device pending approval")
+	}
+}
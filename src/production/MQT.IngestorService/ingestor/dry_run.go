@@ -0,0 +1,32 @@
+package mqtingestor
+
+import (
+	"sort"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// DryRun reports whether INGEST_DRY_RUN is set. In dry-run mode the ingestor
+// subscribes, parses and validates as usual and still publishes errors back to
+// the Pis, but never writes readings or discovered devices to the API.
+func (i *Ingestor) DryRun() bool {
+	return i.cfg.DryRun
+}
+
+// wouldInsert stands in for CreateReading in dry-run mode. Only the payload
+// keys are logged so a busy site doesn't flood the logs with readings.
+func (i *Ingestor) wouldInsert(reading hardware_models.Reading) {
+	keys := make([]string, 0, len(reading.Payload))
+	for k := range reading.Payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	i.logger.Logger.Info().
+		Str("event", "would_insert").
+		Str("pi_id", reading.PiID).
+		Int("device_id", reading.DeviceID).
+		Strs("payload_keys", keys).
+		Msg("Dry run: reading not written")
+	i.stats.recordWouldInsert()
+}
@@ -0,0 +1,63 @@
+package mqtingestor
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentError is a single ingestion error kept for quick triage via the health endpoint
+type RecentError struct {
+	ErrorType string    `json:"error_type"`
+	Message   string    `json:"message"`
+	PiID      string    `json:"pi_id"`
+	DeviceID  string    `json:"device_id"`
+	Topic     string    `json:"topic,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// errorRing is a fixed-size ring buffer of the most recent ingestion errors
+type errorRing struct {
+	mu      sync.Mutex
+	entries []RecentError
+	next    int
+	full    bool
+}
+
+func newErrorRing(size int) *errorRing {
+	if size < 0 {
+		size = 0
+	}
+	return &errorRing{entries: make([]RecentError, size)}
+}
+
+func (r *errorRing) add(e RecentError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the buffered errors, newest first
+func (r *errorRing) snapshot() []RecentError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+
+	out := make([]RecentError, 0, count)
+	for n := 1; n <= count; n++ {
+		idx := (r.next - n + len(r.entries)) % len(r.entries)
+		out = append(out, r.entries[idx])
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package mqtingestor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// maxErrorReportsPerCall is how many buffered errors are sent in one request
+const maxErrorReportsPerCall = 100
+
+// errorReportTimeout bounds one request sending errors to the API
+const errorReportTimeout = 5 * time.Second
+
+// errorReporter sends the errors published to Pis to the API, which keeps them
+// as each Pi's history. Reporting never holds up ingestion: errors wait in a
+// small buffer, ones that don't fit are dropped, and a failed request is not
+// retried. An API without the endpoint is not asked again.
+type errorReporter struct {
+	apiClient *client.APIClient
+	logger    *logger.Logger
+
+	reports     chan ingest_models.IngestErrorReport
+	unsupported atomic.Bool
+
+	started   atomic.Bool
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newErrorReporter(apiClient *client.APIClient, logger *logger.Logger, buffer int) *errorReporter {
+	return &errorReporter{
+		apiClient: apiClient,
+		logger:    logger,
+		reports:   make(chan ingest_models.IngestErrorReport, buffer),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// add queues report without blocking, dropping it when the buffer is full
+func (r *errorReporter) add(report ingest_models.IngestErrorReport) {
+	if r.unsupported.Load() {
+		return
+	}
+	select {
+	case r.reports <- report:
+	default:
+		errorReportsTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// start runs the reporter until close
+func (r *errorReporter) start() {
+	if r.started.CompareAndSwap(false, true) {
+		go r.run()
+	}
+}
+
+// run sends queued errors until close, then sends up to one more batch
+func (r *errorReporter) run() {
+	defer close(r.done)
+	for {
+		select {
+		case report := <-r.reports:
+			r.send(r.collect(report))
+		case <-r.closing:
+			// One last request, so a down API holds up shutdown once at most
+			if batch := r.collect(); len(batch) > 0 {
+				r.send(batch)
+			}
+			if left := len(r.reports); left > 0 {
+				errorReportsTotal.WithLabelValues("dropped").Add(float64(left))
+			}
+			return
+		}
+	}
+}
+
+// collect returns batch with as many queued errors as are waiting added, up
+// to maxErrorReportsPerCall
+func (r *errorReporter) collect(batch ...ingest_models.IngestErrorReport) []ingest_models.IngestErrorReport {
+	for len(batch) < maxErrorReportsPerCall {
+		select {
+		case report := <-r.reports:
+			batch = append(batch, report)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (r *errorReporter) send(batch []ingest_models.IngestErrorReport) {
+	if r.unsupported.Load() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+	defer cancel()
+	err := r.apiClient.ReportIngestErrors(ctx, batch)
+	if errors.Is(err, client.ErrBatchUnsupported) {
+		r.logger.Logger.Info().Msg("API has no ingest error endpoint; errors are only published to Pis")
+		r.unsupported.Store(true)
+		return
+	}
+	if err != nil {
+		errorReportsTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		r.logger.Logger.Warn().Err(err).Int("errors", len(batch)).Msg("Failed to report ingest errors to the API")
+		return
+	}
+	errorReportsTotal.WithLabelValues("ok").Add(float64(len(batch)))
+}
+
+// close sends the errors still queued, as many as fit in one request, and
+// stops the reporter. Errors added after it are never sent.
+func (r *errorReporter) close() {
+	if !r.started.Load() {
+		return
+	}
+	r.closeOnce.Do(func() { close(r.closing) })
+	<-r.done
+}
@@ -0,0 +1,71 @@
+package mqtingestor
+
+import (
+	"context"
+	"time"
+
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// runHeartbeats reports this instance's queue depth, throughput and lag to the
+// API every HeartbeatInterval until ingestion stops, so operators can tell
+// whether the shared group needs more replicas
+func (i *Ingestor) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(i.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	lastProcessed := i.stats.processed()
+	lastAt := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.stopCh:
+			return
+		case now := <-ticker.C:
+			processed := i.stats.processed()
+			heartbeat := i.heartbeat(processed-lastProcessed, now.Sub(lastAt))
+			lastProcessed, lastAt = processed, now
+
+			sendCtx, cancel := context.WithTimeout(ctx, i.cfg.HeartbeatInterval)
+			if err := i.apiClient.SendHeartbeat(sendCtx, heartbeat); err != nil {
+				i.logger.Logger.Warn().Err(err).Msg("Failed to send ingestor heartbeat")
+			}
+			cancel()
+		}
+	}
+}
+
+// heartbeat builds the report for readings processed over elapsed. Lag is the
+// time the queue would take to drain at that rate; when nothing was processed
+// but readings are waiting, it is how long the batch writer has been stalled.
+func (i *Ingestor) heartbeat(processed uint64, elapsed time.Duration) ingest_models.IngestorHeartbeat {
+	depth := len(i.msgCh)
+	var rate, lag float64
+	if elapsed > 0 {
+		rate = float64(processed) / elapsed.Seconds()
+	}
+	switch {
+	case rate > 0:
+		lag = float64(depth) / rate
+	case depth > 0:
+		lag = i.stats.sinceLastFlush().Seconds()
+	}
+
+	build := buildinfo.Get()
+	return ingest_models.IngestorHeartbeat{
+		InstanceID:     i.cfg.InstanceID,
+		Version:        build.Version,
+		Commit:         build.Commit,
+		ClientID:       i.cfg.ClientID,
+		SharedGroup:    i.cfg.SharedGroup,
+		Connected:      i.IsConnected(),
+		DryRun:         i.cfg.DryRun,
+		QueueDepth:     depth,
+		QueueCapacity:  cap(i.msgCh),
+		ProcessingRate: rate,
+		LagSeconds:     lag,
+	}
+}
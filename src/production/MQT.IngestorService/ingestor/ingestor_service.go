@@ -5,49 +5,162 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
 	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
 	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
-	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
 )
 
 type Ingestor struct {
 	cfg        mqtmodels.IngestorConfig
 	apiClient  *client.APIClient
 	mqttClient mqtt.Client
-	msgCh      chan hardware_models.ReadingWithTopic
+	brokers    *brokerPool
+	msgCh      chan queuedReading
 	wg         sync.WaitGroup
 	logger     *logger.Logger
+
+	queueBudget  *byteBudget
+	recentErrors *errorRing
+	stats        *ingestStats
+	piFailures   *piFailureTracker
+	validations  *validationCache
+	overflowErrs *overflowThrottle
+	spool        *spool         // nil when INGEST_SPOOL_DIR is unset
+	errorReports *errorReporter // nil when INGESTOR_REPORT_ERRORS is off or in dry-run mode
+	dedup        *dedupFilter   // nil when INGESTOR_DEDUP_WINDOW is 0
+	rateLimiter  *rateLimiter   // nil when INGESTOR_MAX_MSGS_PER_PI_PER_SEC is 0
+
+	liveMu       sync.RWMutex
+	live         liveSettings  // batch and topic settings the control topic can change; guarded by liveMu
+	batchChanged chan struct{} // signals the batch writer to pick up new batch settings
+	controlMu    sync.Mutex    // applies one control command at a time
+
+	queueMu     sync.RWMutex // held for reading by enqueue and for writing by closeQueue
+	queueClosed bool         // msgCh has been closed; guarded by queueMu
+
+	subscribed               atomic.Bool
+	batchUnsupported         atomic.Bool // set once the API answers the batch endpoint with 404
+	validateBatchUnsupported atomic.Bool // likewise for the batch validation endpoint
+	subscribeGen             atomic.Uint64
+	stopCh                   chan struct{} // closed by Stop to end subscription retries and blocked enqueues
+	stopOnce                 sync.Once
+	cancelRun                context.CancelFunc // cancels the goroutines Start runs when Stop's drain times out
+	startedAt                time.Time          // reported in the online status
 }
 
-func New(cfg mqtmodels.IngestorConfig, apiClient *client.APIClient, logger *logger.Logger) *Ingestor {
-	return &Ingestor{
+// New creates an ingestor, refusing batch settings the batch writer can't run with
+func New(cfg mqtmodels.IngestorConfig, apiClient *client.APIClient, logger *logger.Logger) (*Ingestor, error) {
+	if err := cfg.ValidateBatching(); err != nil {
+		return nil, fmt.Errorf("invalid ingestor config: %w", err)
+	}
+	if !validPayloadFormat(cfg.PayloadFormat) {
+		return nil, fmt.Errorf("invalid ingestor config: INGESTOR_PAYLOAD_FORMAT %q is not a known payload format", cfg.PayloadFormat)
+	}
+
+	i := &Ingestor{
 		cfg:       cfg,
 		apiClient: apiClient,
-		msgCh:     make(chan hardware_models.ReadingWithTopic, 4096),
+		msgCh:     make(chan queuedReading, cfg.QueueSize),
 		logger:    logger,
+
+		queueBudget:  newByteBudget(cfg.QueueMaxBytes),
+		recentErrors: newErrorRing(cfg.ErrorBufferSize),
+		stats:        newIngestStats(),
+		piFailures:   newPiFailureTracker(cfg.MaxTrackedPis),
+		validations:  newValidationCache(cfg.ValidationCacheTTL, cfg.ValidationCacheNegativeTTL),
+		overflowErrs: newOverflowThrottle(),
+		stopCh:       make(chan struct{}),
+
+		live:         liveSettings{batchSize: cfg.BatchSize, batchWindow: cfg.BatchWindow, topics: cfg.Topics()},
+		batchChanged: make(chan struct{}, 1),
+	}
+	if cfg.ControlEnabled && cfg.ControlSecret == "" {
+		logger.Logger.Warn().Msg("INTERNAL_API_SECRET is not set: the control topic is disabled")
+	}
+	if cfg.CacheInvalidationTopic != "" && cfg.ControlSecret == "" {
+		logger.Logger.Warn().Msg("INTERNAL_API_SECRET is not set: cache invalidations are ignored")
+	}
+	if cfg.MaxMsgsPerPiPerSec > 0 {
+		i.rateLimiter = newRateLimiter(cfg.MaxMsgsPerPiPerSec, cfg.RateLimitCooldown)
 	}
+	if cfg.DedupWindow > 0 {
+		i.dedup = newDedupFilter(cfg.DedupWindow, cfg.DedupMaxEntries)
+	}
+	if cfg.ReportErrors && !cfg.DryRun {
+		i.errorReports = newErrorReporter(apiClient, logger, cfg.ErrorReportBuffer)
+	}
+	if cfg.SpoolDir != "" {
+		spool, err := openSpool(cfg.SpoolDir, cfg.SpoolMaxBytes, cfg.SpoolFileMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		i.spool = spool
+	}
+	apiClient.SetCallObserver(i.observeAPICall)
+	if cfg.DryRun {
+		dryRunEnabled.Set(1)
+	}
+	return i, nil
 }
 
-func (i *Ingestor) Start(ctx context.Context) error {
-	opts := mqtt.NewClientOptions().
-		AddBroker(i.brokerURL()).
+// observeAPICall logs every API Service call attempt made while flushing batches
+func (i *Ingestor) observeAPICall(call client.CallResult) {
+	if call.Result == client.ResultMaintenance {
+		i.logger.Logger.Info().Err(call.Err).Str("endpoint", call.Endpoint).Msg("API Service is in maintenance mode; holding readings until writes resume")
+		return
+	}
+
+	event := i.logger.Logger.Debug()
+	if call.Err != nil {
+		event = event.Err(call.Err)
+	}
+	event.
+		Str("pi_id", call.PiID).
+		Int("device_id", call.DeviceID).
+		Str("endpoint", call.Endpoint).
+		Int("attempt", call.Attempt).
+		Dur("latency", call.Latency).
+		Str("result", call.Result).
+		Int("status_code", call.StatusCode).
+		Msg("API call")
+}
+
+// clientOptions builds the MQTT client options from the configuration
+func (i *Ingestor) clientOptions() (*mqtt.ClientOptions, error) {
+	urls, err := i.cfg.Brokers()
+	if err != nil {
+		return nil, err
+	}
+	pool, err := newBrokerPool(urls)
+	if err != nil {
+		return nil, err
+	}
+	i.brokers = pool
+
+	opts := mqtt.NewClientOptions()
+	for _, u := range urls {
+		opts.AddBroker(u)
+	}
+	opts.SetCustomOpenConnectionFn(pool.dial).
 		SetClientID(i.cfg.ClientID).
 		SetOrderMatters(false).
-		SetKeepAlive(30 * time.Second).
-		SetPingTimeout(10 * time.Second).
+		SetKeepAlive(i.cfg.KeepAlive).
+		SetPingTimeout(i.cfg.PingTimeout).
 		SetAutoReconnect(true).
+		SetMaxReconnectInterval(i.cfg.MaxReconnectInterval).
 		SetConnectRetry(true).
-		SetConnectRetryInterval(5 * time.Second).
-		SetCleanSession(false)
+		SetConnectRetryInterval(i.cfg.ConnectRetryInterval).
+		SetCleanSession(i.cfg.CleanSession)
 
 	if i.cfg.BrokerUser != "" {
 		opts.SetUsername(i.cfg.BrokerUser)
@@ -57,29 +170,45 @@ func (i *Ingestor) Start(ctx context.Context) error {
 	if i.cfg.UseTLS {
 		tlsCfg, err := i.tlsConfig(i.cfg.CACertPath)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		opts.SetTLSConfig(tlsCfg)
 	}
 
-	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
-		i.logger.Logger.Error().Err(err).Msg("MQTT connection lost")
+	i.setWill(opts)
+	opts.OnConnectionLost = i.onConnectionLost
+	opts.OnConnect = i.onConnect
+	return opts, nil
+}
+
+func (i *Ingestor) Start(ctx context.Context) error {
+	if i.cfg.DryRun {
+		i.logger.Logger.Warn().Msg("INGEST_DRY_RUN is set: readings are validated but not written")
 	}
-	opts.OnConnect = func(c mqtt.Client) {
-		topic := i.cfg.Topic
-		if i.cfg.SharedGroup != "" {
-			topic = fmt.Sprintf("$share/%s/%s", i.cfg.SharedGroup, i.cfg.Topic)
-		}
-		i.logger.Logger.Info().Str("topic", topic).Msg("MQTT connected, subscribing to topic")
-		if token := c.Subscribe(topic, 1, i.onMessage); token.Wait() && token.Error() != nil {
-			i.logger.Logger.Error().Err(token.Error()).Str("topic", topic).Msg("Failed to subscribe to MQTT topic")
-		}
+
+	i.startedAt = time.Now().UTC()
+	if i.cfg.ClientIDAutoSuffix {
+		i.cfg.ClientID = i.suffixedClientID()
+	}
+	i.logger.Logger.Info().Str("client_id", i.cfg.ClientID).Msg("Using MQTT client ID")
+
+	// The cache is filled before subscribing, so the first flushes find it warm
+	var registryLoadedAt *time.Time
+	refreshRegistry := false
+	if i.registryEnabled() {
+		registryLoadedAt, refreshRegistry = i.primeRegistry(ctx)
+	}
+
+	opts, err := i.clientOptions()
+	if err != nil {
+		return err
 	}
 
 	i.mqttClient = mqtt.NewClient(opts)
 	if tk := i.mqttClient.Connect(); tk.Wait() && tk.Error() != nil {
 		return tk.Error()
 	}
+	ctx, i.cancelRun = context.WithCancel(ctx)
 
 	// batch writer
 	i.wg.Add(1)
@@ -88,65 +217,249 @@ func (i *Ingestor) Start(ctx context.Context) error {
 		i.batchWriter(ctx)
 	}()
 
+	if i.cfg.HeartbeatInterval > 0 {
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.runHeartbeats(ctx)
+		}()
+	}
+
+	if i.spool != nil {
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.runSpoolReplay(ctx)
+		}()
+	}
+
+	if i.errorReports != nil {
+		i.errorReports.start()
+	}
+
+	if refreshRegistry && i.cfg.RegistryRefreshInterval > 0 {
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.runRegistryRefresh(ctx, registryLoadedAt)
+		}()
+	}
+
 	return nil
 }
 
-func (i *Ingestor) Stop() {
+// shutdownSpillTimeout is how long Stop waits, once its drain has timed out and
+// the API calls are cancelled, for the goroutines to spool what is left
+const shutdownSpillTimeout = 5 * time.Second
+
+// Stop stops ingestion: it publishes the stopping status, unsubscribes so no
+// new messages arrive, waits for message handlers still queuing readings, then
+// drains the queue and waits for the batch writer's final flush. Messages
+// delivered after Stop has begun are dropped. The MQTT connection is left open
+// so errors from that flush can still be published; call Close after. Stop may
+// be called more than once.
+//
+// The drain is given ShutdownTimeout, and no longer than ctx allows. Past that,
+// the API calls still in flight are cancelled, which spools their readings and
+// those still queued, or drops and counts them without a spool, and Stop
+// returns the timeout's error.
+func (i *Ingestor) Stop(ctx context.Context) error {
+	i.stopOnce.Do(func() {
+		i.publishStatus(ingest_models.IngestorStatusStopping)
+		close(i.stopCh)
+		i.subscribeGen.Add(1)
+		i.subscribed.Store(false)
+		if i.mqttClient != nil && i.mqttClient.IsConnected() {
+			topics := i.subscriptionTopics()
+			if token := i.mqttClient.Unsubscribe(topics...); token.WaitTimeout(5*time.Second) && token.Error() != nil {
+				i.logger.Logger.Error().Err(token.Error()).Strs("topics", topics).Msg("Failed to unsubscribe from MQTT topics")
+			}
+		}
+		i.closeQueue()
+	})
+
+	drainCtx, cancel := ctx, context.CancelFunc(func() {})
+	if i.cfg.ShutdownTimeout > 0 {
+		drainCtx, cancel = context.WithTimeout(ctx, i.cfg.ShutdownTimeout)
+	}
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-drainCtx.Done():
+	}
+
+	i.logger.Logger.Warn().Int("queued", len(i.msgCh)).Dur("shutdown_timeout", i.cfg.ShutdownTimeout).Msg("Drain timed out; cancelling API calls and spooling what is left")
+	if i.cancelRun != nil {
+		i.cancelRun()
+	}
+	select {
+	case <-done:
+	case <-time.After(shutdownSpillTimeout):
+		i.logger.Logger.Error().Msg("Ingestor goroutines still running after cancellation; abandoning them")
+	}
+	return fmt.Errorf("ingestor drain: %w", drainCtx.Err())
+}
+
+// Close publishes the offline status, disconnects from the MQTT broker and
+// closes the spool. A clean disconnect doesn't trigger the Last Will, so the
+// status is sent here.
+func (i *Ingestor) Close() {
+	i.publishStatus(ingest_models.IngestorStatusOffline)
+	if i.errorReports != nil {
+		i.errorReports.close()
+	}
+	if i.spool != nil {
+		i.spool.close()
+	}
 	if i.mqttClient != nil && i.mqttClient.IsConnected() {
-		i.mqttClient.Disconnect(500)
+		i.mqttClient.Disconnect(uint(i.cfg.DisconnectQuiesce.Milliseconds()))
 	}
-	close(i.msgCh)
-	i.wg.Wait()
 }
 
 func (i *Ingestor) IsConnected() bool {
 	return i.mqttClient != nil && i.mqttClient.IsConnected()
 }
 
-func (i *Ingestor) onMessage(_ mqtt.Client, m mqtt.Message) {
-	i.logger.Logger.Debug().Str("topic", m.Topic()).Str("payload", string(m.Payload())).Msg("Received MQTT message")
+// ConnectedBroker returns the URL of the broker the client is connected to, or
+// "" while disconnected
+func (i *Ingestor) ConnectedBroker() string {
+	if i.brokers == nil || !i.IsConnected() {
+		return ""
+	}
+	return i.brokers.current()
+}
 
-	var payload map[string]interface{}
-	if err := json.Unmarshal(m.Payload(), &payload); err != nil {
-		payload = map[string]interface{}{"raw": string(m.Payload())}
+// Brokers returns the configured broker URLs in the order they were listed
+func (i *Ingestor) Brokers() []string {
+	if i.brokers == nil {
+		return nil
 	}
+	return i.brokers.all()
+}
+
+// RecentErrors returns the most recent ingestion errors, newest first
+func (i *Ingestor) RecentErrors() []RecentError {
+	return i.recentErrors.snapshot()
+}
+
+func (i *Ingestor) onMessage(_ mqtt.Client, m mqtt.Message) {
+	i.logger.Logger.Debug().Str("topic", m.Topic()).Str("payload", string(m.Payload())).Msg("Received MQTT message")
+	i.stats.recordReceived()
 
 	// Parse topic to extract pi_id and device_id
 	// Expected format: sensors/<pi_id>/<device_id>/<metric>
-	parts := strings.Split(m.Topic(), "/")
-	if len(parts) < 4 {
-		i.logger.Logger.Warn().Str("topic", m.Topic()).Str("expected", "sensors/<pi_id>/<device_id>/<metric>").Msg("Invalid topic format")
-		// Try to extract pi_id and device_id from what we have for error reporting
-		piID := "unknown"
-		deviceID := "unknown"
-		if len(parts) >= 2 {
-			piID = parts[1]
-		}
-		if len(parts) >= 3 {
-			deviceID = parts[2]
+	topic, err := ingest_models.ParseSensorTopic(m.Topic())
+	if err != nil {
+		i.logger.Logger.Warn().Str("topic", m.Topic()).Str("expected", ingest_models.SensorTopicFormat).Msg("Invalid topic format")
+		// topic still carries what pi_id and device_id could be read, for error reporting
+		i.publishError(m.Topic(), topic.PiID, topic.DeviceID, "invalid_topic", fmt.Sprintf("Invalid topic format: %s, expected: %s", m.Topic(), ingest_models.SensorTopicFormat))
+		return
+	}
+
+	// Retained messages are redelivered on every reconnect, so by default they
+	// are dropped rather than stored again
+	if m.Retained() {
+		messagesRetainedTotal.Inc()
+		if i.cfg.IgnoreRetained {
+			i.logger.Logger.Debug().Str("topic", m.Topic()).Msg("Ignoring retained message")
+			i.stats.recordRetainedIgnored()
+			return
 		}
-		i.publishError(piID, deviceID, "invalid_topic", fmt.Sprintf("Invalid topic format: %s, expected: sensors/<pi_id>/<device_id>/<metric>", m.Topic()))
+	}
+	// A QoS 1 redelivery may repeat a message already queued; the dedup
+	// filter drops it then, when INGESTOR_DEDUP_WINDOW is set
+	if m.Duplicate() {
+		i.logger.Logger.Debug().Str("topic", m.Topic()).Msg("Received redelivered message")
+		messagesRedeliveredTotal.Inc()
+	}
+
+	// A Pi over its rate is dropped before its payload is even decoded
+	if i.rateLimited(m.Topic(), topic) {
 		return
 	}
 
-	piID := parts[1]     // e.g., sensors/pi_001/temperature/humidity -> pi_001
-	deviceID := parts[2] // e.g., sensors/pi_001/temperature/humidity -> temperature
+	receivedAt := time.Now().UTC()
 
-	reading := hardware_models.ReadingWithTopic{
-		PiID:       piID,
-		DeviceID:   deviceID,
-		Topic:      m.Topic(),
+	// Gateways may gzip large batches; they are parsed as if sent uncompressed
+	data := m.Payload()
+	if isGzip(data) {
+		if data, err = gunzipPayload(data, i.cfg.MaxDecompressedBytes); err != nil {
+			i.logger.Logger.Warn().Err(err).Str("pi_id", topic.PiID).Str("device_id", topic.DeviceID).Msg("Dropping message: gzip payload could not be decompressed")
+			i.publishError(m.Topic(), topic.PiID, topic.DeviceID, "decompress_failed", fmt.Sprintf("Failed to decompress gzip payload: %v", err))
+			i.stats.recordFailed("decompress_failed")
+			return
+		}
+	}
+
+	// Numbers are kept as json.Number so large integer counters aren't rounded
+	payload, elements, err := i.decodeMessage(data)
+	if err != nil {
+		i.logger.Logger.Warn().Err(err).Str("pi_id", topic.PiID).Str("device_id", topic.DeviceID).Str("format", i.cfg.PayloadFormat).Msg("Dropping message: invalid payload")
+		i.publishError(m.Topic(), topic.PiID, topic.DeviceID, "invalid_payload", fmt.Sprintf("Payload is not valid %s: %v", i.cfg.PayloadFormat, err))
+		i.stats.recordFailed("invalid_payload")
+		return
+	}
+	if m.Retained() {
+		markRetained(payload, elements)
+	}
+	// A Pi catching up after being offline may send an array of readings
+	if elements != nil {
+		i.queueArray(m.Topic(), topic, elements, receivedAt)
+		return
+	}
+	if err := i.queueReading(m.Topic(), topic, payload, len(data), receivedAt); err != nil {
+		i.reportEnqueueFailure(m.Topic(), topic, err, 1)
+	}
+}
+
+// queueReading queues one reading's payload for the batch writer, taking its
+// timestamp from the payload. It returns the enqueue error, if any, for the
+// caller to report; readings refused for their timestamp are reported here.
+func (i *Ingestor) queueReading(sourceTopic string, topic ingest_models.SensorTopic, payload map[string]interface{}, payloadBytes int, receivedAt time.Time) error {
+	reading := ingest_models.ReadingEnvelope{
+		PiID:       topic.PiID,     // e.g., sensors/pi_001/temperature/humidity -> pi_001
+		DeviceID:   topic.DeviceID, // e.g., sensors/pi_001/temperature/humidity -> temperature
+		Topic:      sourceTopic,
 		Payload:    payload,
-		ReceivedAt: time.Now().UTC(),
+		Ts:         receivedAt,
+		ReceivedAt: receivedAt,
+	}
+	if !i.applyPayloadTimestamp(&reading) {
+		return nil
 	}
 
-	i.logger.Logger.Debug().Str("pi_id", piID).Str("device_id", deviceID).Msg("Queuing reading")
-	i.msgCh <- reading
+	i.logger.Logger.Debug().Str("pi_id", reading.PiID).Str("device_id", reading.DeviceID).Msg("Queuing reading")
+	return i.enqueue(reading, payloadBytes)
 }
 
+// reportEnqueueFailure reports count readings of one message that enqueue
+// refused with err
+func (i *Ingestor) reportEnqueueFailure(sourceTopic string, topic ingest_models.SensorTopic, err error, count int) {
+	if errors.Is(err, errStopping) {
+		i.logger.Logger.Warn().Str("pi_id", topic.PiID).Str("device_id", topic.DeviceID).Int("readings", count).Msg("Dropping reading: ingestor is stopping")
+		i.stats.recordFailedN("shutting_down", count)
+		return
+	}
+	i.queueOverflowed(sourceTopic, topic.PiID, topic.DeviceID, count)
+}
+
+// batchWriter collects queued readings into batches and hands each to the
+// flush workers once it reaches BatchSize or BatchWindow has passed. When the
+// queue is closed it flushes what is left and stops the workers, which finish
+// their batches before Stop's wait returns.
 func (i *Ingestor) batchWriter(ctx context.Context) {
-	batch := make([]hardware_models.ReadingWithTopic, 0, i.cfg.BatchSize)
-	timer := time.NewTimer(i.cfg.BatchWindow)
+	settings := i.settings()
+	batch := make([]ingest_models.ReadingEnvelope, 0, settings.batchSize)
+	workers := i.startWorkers(ctx)
+	defer workers.stop()
+	timer := time.NewTimer(settings.batchWindow)
 	defer timer.Stop()
 
 	flush := func() {
@@ -154,90 +467,99 @@ func (i *Ingestor) batchWriter(ctx context.Context) {
 			return
 		}
 		i.logger.Logger.Info().Int("batch_size", len(batch)).Msg("Flushing batch to API Service")
+		workers.dispatch(batch)
+		batch = batch[:0]
+	}
 
-		// Process each reading in the batch
-		for _, readingWithTopic := range batch {
-			// Convert deviceID string to int
-			deviceIDInt, err := strconv.Atoi(readingWithTopic.DeviceID)
-			if err != nil {
-				i.logger.Logger.Error().Err(err).Str("device_id", readingWithTopic.DeviceID).Msg("Error converting device_id to int")
-				continue
-			}
-
-			// Validate Pi exists via API
-			piExists, err := i.apiClient.ValidatePi(ctx, readingWithTopic.PiID)
-			if err != nil {
-				i.logger.Logger.Error().Err(err).Str("pi_id", readingWithTopic.PiID).Msg("Failed to validate Pi via API")
-				i.publishError(readingWithTopic.PiID, readingWithTopic.DeviceID, "pi_validation_error", fmt.Sprintf("Failed to validate Pi %s: %v", readingWithTopic.PiID, err))
-				continue
-			}
-			if !piExists {
-				i.logger.Logger.Warn().Str("pi_id", readingWithTopic.PiID).Msg("Skipping reading: pi not found")
-				i.publishError(readingWithTopic.PiID, readingWithTopic.DeviceID, "pi_not_found", fmt.Sprintf("Pi %s does not exist", readingWithTopic.PiID))
-				continue
-			}
-
-			// Validate device exists via API
-			deviceExists, err := i.apiClient.ValidateDevice(ctx, readingWithTopic.PiID, deviceIDInt)
-			if err != nil {
-				i.logger.Logger.Error().Err(err).Str("pi_id", readingWithTopic.PiID).Int("device_id", deviceIDInt).Msg("Failed to validate Device via API")
-				i.publishError(readingWithTopic.PiID, readingWithTopic.DeviceID, "device_validation_error", fmt.Sprintf("Failed to validate Device %d: %v", deviceIDInt, err))
-				continue
-			}
-			if !deviceExists {
-				i.logger.Logger.Warn().Str("pi_id", readingWithTopic.PiID).Int("device_id", deviceIDInt).Msg("Skipping reading: device not found")
-				i.publishError(readingWithTopic.PiID, readingWithTopic.DeviceID, "device_not_found", fmt.Sprintf("Device %d does not exist for Pi %s", deviceIDInt, readingWithTopic.PiID))
-				continue
-			}
-
-			// Create reading via API
-			reading := hardware_models.Reading{
-				PiID:     readingWithTopic.PiID,
-				DeviceID: deviceIDInt,
-				Ts:       readingWithTopic.ReceivedAt,
-				Payload:  readingWithTopic.Payload,
-			}
-			if err := i.apiClient.CreateReading(ctx, reading); err != nil {
-				i.logger.Logger.Error().Err(err).Str("pi_id", readingWithTopic.PiID).Str("device_id", readingWithTopic.DeviceID).Msg("Error creating reading via API")
-				i.publishError(readingWithTopic.PiID, readingWithTopic.DeviceID, "create_reading_error", fmt.Sprintf("Failed to create reading: %v", err))
-			}
+	// add appends a dequeued reading to batch unless it's a duplicate
+	add := func(item queuedReading) {
+		i.dequeued(item)
+		if i.dedup != nil && i.dedup.seen(item.reading) {
+			i.duplicate(item.reading)
+			return
 		}
-
-		i.logger.Logger.Info().Int("count", len(batch)).Msg("Successfully processed readings")
-		batch = batch[:0]
+		batch = append(batch, item.reading)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			// Cancelled by Stop's drain timeout: whatever is still queued
+			// goes with the last flush, whose calls fail at once and spool it
+		drain:
+			for {
+				select {
+				case item, ok := <-i.msgCh:
+					if !ok {
+						break drain
+					}
+					add(item)
+				default:
+					break drain
+				}
+			}
 			flush()
 			return
-		case rd, ok := <-i.msgCh:
+		case item, ok := <-i.msgCh:
 			if !ok {
 				flush()
 				return
 			}
-			batch = append(batch, rd)
-			if len(batch) >= i.cfg.BatchSize {
+			add(item)
+			if len(batch) >= settings.batchSize {
+				flush()
+				resetTimer(timer, settings.batchWindow)
+			}
+		case <-i.batchChanged:
+			// set_batch on the control topic; a batch already past the new
+			// size is flushed now, and the new window starts from here
+			settings = i.settings()
+			if len(batch) >= settings.batchSize {
 				flush()
-				if !timer.Stop() {
-					<-timer.C
-				}
-				timer.Reset(i.cfg.BatchWindow)
 			}
+			resetTimer(timer, settings.batchWindow)
 		case <-timer.C:
 			flush()
-			timer.Reset(i.cfg.BatchWindow)
+			timer.Reset(settings.batchWindow)
 		}
 	}
 }
 
-func (i *Ingestor) brokerURL() string {
-	scheme := "tcp"
-	if i.cfg.UseTLS {
-		scheme = "tcps"
+// processBatch validates and writes batch. Each Pi's readings are validated
+// together, so a bad Pi fails on its own and is reported once. The valid
+// readings of every Pi are then written with one batch call, and last-seen
+// times are written once for the batch rather than per reading.
+func (i *Ingestor) processBatch(ctx context.Context, batch []ingest_models.ReadingEnvelope, liveness *livenessBatch) {
+	known := i.validateBatch(ctx, batch)
+	var pending []pendingReading
+	for _, group := range groupByPi(batch) {
+		pending = append(pending, i.validatePi(ctx, group, known)...)
 	}
-	return fmt.Sprintf("%s://%s:%d", scheme, i.cfg.BrokerHost, i.cfg.BrokerPort)
+	i.writeReadings(ctx, pending, liveness)
+
+	i.touchLiveness(ctx, liveness)
+	liveness.reset()
+}
+
+// resetTimer restarts timer for d. A fire that landed while the timer was
+// being stopped is drained without blocking, so it can't trigger an extra
+// flush right after the reset.
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// sharedTopic prefixes topic with the shared subscription group, if any
+func (i *Ingestor) sharedTopic(topic string) string {
+	if i.cfg.SharedGroup != "" {
+		return fmt.Sprintf("$share/%s/%s", i.cfg.SharedGroup, topic)
+	}
+	return topic
 }
 
 func (i *Ingestor) tlsConfig(caFile string) (*tls.Config, error) {
@@ -257,32 +579,68 @@ func (i *Ingestor) tlsConfig(caFile string) (*tls.Config, error) {
 	return cfg, nil
 }
 
-// publishError publishes an error message to the error topic for Pi feedback
-func (i *Ingestor) publishError(piID, deviceID, errorType, message string) {
-	if i.mqttClient == nil || !i.mqttClient.IsConnected() {
-		return
+// errorTopic renders the configured error topic template for a Pi/device pair
+func (i *Ingestor) errorTopic(piID, deviceID string) string {
+	return strings.NewReplacer("{pi_id}", piID, "{device_id}", deviceID).Replace(i.cfg.ErrorTopicTemplate)
+}
+
+// publishError records an ingestion error and publishes it to the error topic for Pi feedback.
+// sourceTopic is the MQTT topic of the message that triggered the error.
+func (i *Ingestor) publishError(sourceTopic, piID, deviceID, errorType, message string) {
+	i.publishErrorCount(sourceTopic, piID, deviceID, errorType, message, 1)
+}
+
+// publishErrorCount is publishError for an error that affected count readings,
+// which is reported once with affected_count set
+func (i *Ingestor) publishErrorCount(sourceTopic, piID, deviceID, errorType, message string, count int) {
+	now := time.Now().UTC()
+
+	ingestErrorsTotal.WithLabelValues(errorType).Inc()
+	lastErrorTimestamp.WithLabelValues(errorType).Set(float64(now.Unix()))
+	i.piFailures.record(piID, deviceID, errorType, count, now)
+	i.recentErrors.add(RecentError{
+		ErrorType: errorType,
+		Message:   message,
+		PiID:      piID,
+		DeviceID:  deviceID,
+		Topic:     sourceTopic,
+		Timestamp: now,
+	})
+	if i.errorReports != nil && piID != "" {
+		i.errorReports.add(ingest_models.IngestErrorReport{
+			PiID:          piID,
+			DeviceID:      deviceID,
+			ErrorType:     errorType,
+			Message:       message,
+			Topic:         sourceTopic,
+			AffectedCount: count,
+			Ts:            now,
+		})
 	}
 
-	errorPayload := map[string]interface{}{
-		"error_type": errorType,
-		"message":    message,
-		"pi_id":      piID,
-		"device_id":  deviceID,
-		"timestamp":  time.Now().UTC(),
+	if !i.cfg.PublishErrors || i.mqttClient == nil || !i.mqttClient.IsConnected() {
+		errorPublishesTotal.WithLabelValues(errorType, "skipped").Inc()
+		return
 	}
 
+	errorPayload := ingest_models.NewIngestError(errorType, message, piID, deviceID, sourceTopic, now)
+	errorPayload.AffectedCount = count
+
 	payloadJSON, err := json.Marshal(errorPayload)
 	if err != nil {
 		i.logger.Logger.Error().Err(err).Msg("Failed to marshal error payload")
+		errorPublishesTotal.WithLabelValues(errorType, "failed").Inc()
 		return
 	}
 
-	errorTopic := fmt.Sprintf("ingestor/errors/%s/%s", piID, deviceID)
-	token := i.mqttClient.Publish(errorTopic, 1, false, payloadJSON)
+	errorTopic := i.errorTopic(piID, deviceID)
+	token := i.mqttClient.Publish(errorTopic, i.cfg.ErrorQoS, i.cfg.ErrorRetained, payloadJSON)
 
 	if token.Wait() && token.Error() != nil {
+		errorPublishesTotal.WithLabelValues(errorType, "failed").Inc()
 		i.logger.Logger.Error().Err(token.Error()).Str("topic", errorTopic).Msg("Failed to publish error")
 	} else {
+		errorPublishesTotal.WithLabelValues(errorType, "ok").Inc()
 		i.logger.Logger.Info().Str("topic", errorTopic).Str("message", message).Msg("Published error")
 	}
 }
@@ -0,0 +1,181 @@
+package mqtingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// queuedReadings drains the readings onMessage queued
+func queuedReadings(i *Ingestor) []ingest_models.ReadingEnvelope {
+	var readings []ingest_models.ReadingEnvelope
+	for {
+		select {
+		case item := <-i.msgCh:
+			readings = append(readings, item.reading)
+		default:
+			return readings
+		}
+	}
+}
+
+// Retained messages, which the broker redelivers on every reconnect, are
+// dropped and counted by default; with INGESTOR_IGNORE_RETAINED off they are
+// queued with every reading marked retained. Live messages are never marked.
+func TestRetainedMessages(t *testing.T) {
+	const topic = "sensors/pi-1/3/temperature"
+	tests := []struct {
+		name           string
+		ignoreRetained bool
+		message        fakeMessage
+		wantQueued     int
+		wantRetained   bool // queued readings are marked
+		wantIgnored    uint64
+	}{
+		{name: "retained, ignored", ignoreRetained: true, message: fakeMessage{topic: topic, payload: []byte(`{"t":21.5}`), retained: true}, wantIgnored: 1},
+		{name: "retained array, ignored", ignoreRetained: true, message: fakeMessage{topic: topic, payload: []byte(`[{"t":21.5},{"t":21.6}]`), retained: true}, wantIgnored: 1},
+		{name: "retained redelivery, ignored", ignoreRetained: true, message: fakeMessage{topic: topic, payload: []byte(`{"t":21.5}`), retained: true, duplicate: true}, wantIgnored: 1},
+		{name: "retained, kept", message: fakeMessage{topic: topic, payload: []byte(`{"t":21.5}`), retained: true}, wantQueued: 1, wantRetained: true},
+		{name: "retained array, kept", message: fakeMessage{topic: topic, payload: []byte(`[{"t":21.5},{"t":21.6},{"t":21.7}]`), retained: true}, wantQueued: 3, wantRetained: true},
+		{name: "live", ignoreRetained: true, message: fakeMessage{topic: topic, payload: []byte(`{"t":21.5}`)}, wantQueued: 1},
+		{name: "live array", ignoreRetained: true, message: fakeMessage{topic: topic, payload: []byte(`[{"t":21.5},{"t":21.6}]`)}, wantQueued: 2},
+		{name: "live with retained off", message: fakeMessage{topic: topic, payload: []byte(`{"t":21.5}`)}, wantQueued: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newWorkerTestIngestor(t, &fakeIngestAPI{}, 1)
+			i.cfg.IgnoreRetained = tt.ignoreRetained
+
+			i.onMessage(nil, tt.message)
+
+			queued := queuedReadings(i)
+			if len(queued) != tt.wantQueued {
+				t.Fatalf("queued %d readings, want %d", len(queued), tt.wantQueued)
+			}
+			for n, reading := range queued {
+				if reading.PiID != "pi-1" || reading.DeviceID != "3" {
+					t.Errorf("reading %d is for %s/%s, want pi-1/3", n, reading.PiID, reading.DeviceID)
+				}
+				retained, marked := reading.Payload["retained"]
+				if marked != tt.wantRetained || (marked && retained != true) {
+					t.Errorf("reading %d payload %v, want marked retained %v", n, reading.Payload, tt.wantRetained)
+				}
+			}
+			stats := i.Stats()
+			if stats.RetainedIgnored != tt.wantIgnored || stats.MessagesReceived != 1 {
+				t.Errorf("%d retained ignored of %d received, want %d of 1", stats.RetainedIgnored, stats.MessagesReceived, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+// hangingAPI is a fakeIngestAPI whose calls to hang block until the caller
+// gives up on them
+type hangingAPI struct {
+	fakeIngestAPI
+	hang    map[string]bool
+	release chan struct{}
+}
+
+func (f *hangingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.hang[r.URL.Path] {
+		select {
+		case <-r.Context().Done():
+		case <-f.release:
+		}
+		return
+	}
+	f.fakeIngestAPI.ServeHTTP(w, r)
+}
+
+// startBatchWriter runs the batch writer as Start does, without connecting
+func startBatchWriter(i *Ingestor) {
+	var ctx context.Context
+	ctx, i.cancelRun = context.WithCancel(context.Background())
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		i.batchWriter(ctx)
+	}()
+}
+
+// Stop returns once ShutdownTimeout or its context runs out, whichever is
+// first, however long the API takes to answer the final flush; the readings
+// of the cancelled calls are spooled or counted as failed, never lost
+func TestStopWithHungAPI(t *testing.T) {
+	const readings = 5
+	tests := []struct {
+		name            string
+		hang            []string
+		shutdownTimeout time.Duration
+		ctxTimeout      time.Duration // 0 for none
+		spool           bool
+		wantErr         error
+		wantInserted    uint64
+	}{
+		{name: "healthy API", shutdownTimeout: time.Second, wantInserted: readings},
+		{name: "validation hangs", hang: []string{"/internal/validate/batch", "/internal/pis/validate"}, shutdownTimeout: 200 * time.Millisecond, wantErr: context.DeadlineExceeded},
+		{name: "writes hang", hang: []string{"/internal/readings/batch"}, shutdownTimeout: 200 * time.Millisecond, wantErr: context.DeadlineExceeded},
+		{name: "writes hang with a spool", hang: []string{"/internal/readings/batch"}, shutdownTimeout: 200 * time.Millisecond, spool: true, wantErr: context.DeadlineExceeded},
+		{name: "context ends first", hang: []string{"/internal/readings/batch"}, shutdownTimeout: time.Minute, ctxTimeout: 200 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &hangingAPI{hang: map[string]bool{}, release: make(chan struct{})}
+			for _, path := range tt.hang {
+				api.hang[path] = true
+			}
+			i := newWorkerTestIngestor(t, api, 2)
+			t.Cleanup(func() { close(api.release) }) // before the server closes
+			i.cfg.ShutdownTimeout = tt.shutdownTimeout
+			if tt.spool {
+				spool, err := openSpool(t.TempDir(), 1<<20, 1<<20)
+				if err != nil {
+					t.Fatalf("openSpool: %v", err)
+				}
+				t.Cleanup(spool.close)
+				i.spool = spool
+			}
+			startBatchWriter(i)
+			for n := range readings {
+				i.onMessage(nil, fakeMessage{topic: fmt.Sprintf("sensors/pi-%d/3/temperature", n), payload: []byte(`{"t":21.5}`)})
+			}
+
+			ctx, deadline := context.Background(), tt.shutdownTimeout
+			if tt.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+				defer cancel()
+				deadline = min(deadline, tt.ctxTimeout)
+			}
+
+			start := time.Now()
+			err := i.Stop(ctx)
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Stop() error = %v, want %v", err, tt.wantErr)
+			}
+			// The cancelled calls must return promptly, well inside the
+			// grace Stop gives them before abandoning the goroutines
+			if elapsed > deadline+time.Second {
+				t.Errorf("Stop took %s with a %s deadline", elapsed, deadline)
+			}
+			if got := i.stats.processed(); got != readings {
+				t.Errorf("%d readings accounted for, want %d: %+v", got, readings, i.Stats())
+			}
+			stats := i.Stats()
+			if stats.ReadingsInserted != tt.wantInserted {
+				t.Errorf("%d readings inserted, want %d", stats.ReadingsInserted, tt.wantInserted)
+			}
+			if tt.spool && stats.Spool.Spooled != readings {
+				t.Errorf("%d readings spooled, want %d", stats.Spool.Spooled, readings)
+			}
+		})
+	}
+}
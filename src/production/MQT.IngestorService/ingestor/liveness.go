@@ -0,0 +1,61 @@
+package mqtingestor
+
+import (
+	"context"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// livenessBatch aggregates the readings written in one flush per device, so
+// the API can update last-seen times with one call instead of one per reading
+type livenessBatch struct {
+	index   map[livenessKey]int
+	entries []ingest_models.LivenessEntry
+}
+
+type livenessKey struct {
+	piID     string
+	deviceID int
+}
+
+func newLivenessBatch() *livenessBatch {
+	return &livenessBatch{index: make(map[livenessKey]int)}
+}
+
+// record counts one written reading, keeping the newest ts per device.
+// Devices keep the order in which they were first written.
+func (b *livenessBatch) record(piID string, deviceID int, ts time.Time) {
+	key := livenessKey{piID: piID, deviceID: deviceID}
+	n, ok := b.index[key]
+	if !ok {
+		b.index[key] = len(b.entries)
+		b.entries = append(b.entries, ingest_models.LivenessEntry{PiID: piID, DeviceID: &deviceID, LastTs: ts.UTC(), Count: 1})
+		return
+	}
+	entry := &b.entries[n]
+	entry.Count++
+	if ts.After(entry.LastTs) {
+		entry.LastTs = ts.UTC()
+	}
+}
+
+// reset empties the batch for the next flush
+func (b *livenessBatch) reset() {
+	clear(b.index)
+	b.entries = b.entries[:0]
+}
+
+// touchLiveness sends the flush's liveness to the API. Failures are only
+// logged: readings are already stored and the next flush sends newer times.
+func (i *Ingestor) touchLiveness(ctx context.Context, batch *livenessBatch) {
+	if len(batch.entries) == 0 {
+		return
+	}
+	response, err := i.apiClient.TouchLiveness(ctx, batch.entries)
+	if err != nil {
+		i.logger.Logger.Warn().Err(err).Int("devices", len(batch.entries)).Msg("Failed to record device liveness")
+		return
+	}
+	i.logger.Logger.Debug().Int64("devices", response.Devices).Int64("pis", response.Pis).Int("readings", response.Readings).Msg("Recorded device liveness")
+}
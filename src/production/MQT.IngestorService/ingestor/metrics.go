@@ -0,0 +1,143 @@
+package mqtingestor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for the ingestor, served by the health server on /metrics
+var (
+	ingestErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "errors_total",
+		Help:      "Ingestion errors reported to Pis, by error type.",
+	}, []string{"error_type"})
+
+	errorPublishesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "error_publishes_total",
+		Help:      "Error-topic publish attempts, by error type and result (ok, failed, skipped).",
+	}, []string{"error_type", "result"})
+
+	errorReportsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "error_reports_total",
+		Help:      "Errors sent to the API for each Pi's error history, by result (ok, failed, dropped).",
+	}, []string{"result"})
+
+	lastErrorTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "last_error_timestamp_seconds",
+		Help:      "Unix time of the most recent ingestion error, by error type.",
+	}, []string{"error_type"})
+
+	messagesReceivedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "messages_received_total",
+		Help:      "MQTT messages received on the subscribed topic.",
+	})
+
+	readingsInsertedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "readings_inserted_total",
+		Help:      "Readings successfully written through the API service.",
+	})
+
+	messagesRetainedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "messages_retained_total",
+		Help:      "Retained MQTT messages received; dropped unless INGESTOR_IGNORE_RETAINED is false.",
+	})
+
+	messagesRedeliveredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "messages_redelivered_total",
+		Help:      "MQTT messages received with the DUP flag set, i.e. QoS 1 or 2 redeliveries.",
+	})
+
+	readingsDuplicateTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "readings_duplicate_total",
+		Help:      "Readings dropped as duplicates of one seen within INGESTOR_DEDUP_WINDOW.",
+	})
+
+	readingsWouldInsertTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "readings_would_insert_total",
+		Help:      "Readings that passed validation but were not written because dry-run mode is on.",
+	})
+
+	dryRunEnabled = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "dry_run",
+		Help:      "1 while the ingestor runs in dry-run mode and writes nothing, otherwise 0.",
+	})
+
+	readingsFailedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "readings_failed_total",
+		Help:      "Readings dropped by the batch writer, by error type.",
+	}, []string{"error_type"})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "queue_depth",
+		Help:      "Readings waiting in the batch writer queue.",
+	})
+
+	queueBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "queue_bytes",
+		Help:      "Estimated bytes held by readings waiting in the batch writer queue.",
+	})
+
+	spoolBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "spool_bytes",
+		Help:      "Bytes of readings held in the dead-letter spool.",
+	})
+
+	spoolReadings = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "spool_readings",
+		Help:      "Readings waiting in the dead-letter spool to be replayed.",
+	})
+
+	devicesAutoRegisteredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "devices_auto_registered_total",
+		Help:      "Unknown devices created on their first reading with INGESTOR_AUTO_REGISTER_DEVICES.",
+	})
+
+	controlCommandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "control_commands_total",
+		Help:      "Commands received on the control topic, by result (applied, rejected, unauthorized, malformed).",
+	}, []string{"result"})
+
+	validationCacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "validation_cache_lookups_total",
+		Help:      "Pi and device validation cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	cacheInvalidationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "cache_invalidations_total",
+		Help:      "Invalidation events received from the API, by result (applied, unauthorized, malformed).",
+	}, []string{"result"})
+
+	batchFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "batch_flush_duration_seconds",
+		Help:      "Time taken to flush a batch to the API service.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+
+	batchFlushSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mqtt_ingestor",
+		Name:      "batch_flush_size",
+		Help:      "Readings per flushed batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
@@ -0,0 +1,69 @@
+package mqtingestor
+
+import (
+	"time"
+)
+
+// OperationalStatus is what the ingestor is doing right now, served on the
+// health server's /status route
+type OperationalStatus struct {
+	Connected        bool       `json:"connected"`
+	Broker           string     `json:"broker,omitempty"`
+	Subscribed       bool       `json:"subscribed"`
+	Topics           []string   `json:"topics"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	MessagesReceived uint64     `json:"messages_received"`
+	ReadingsFlushed  uint64     `json:"readings_flushed"` // handed to the API by completed flushes, written or not
+	LastMessageAt    *time.Time `json:"last_message_at,omitempty"`
+	LastFlushAt      *time.Time `json:"last_flush_at,omitempty"`
+	LastWriteAt      *time.Time `json:"last_successful_write_at,omitempty"` // when a flush last stored a reading
+	QueueDepth       int        `json:"queue_depth"`
+	QueueCapacity    int        `json:"queue_capacity"`
+	BatchSize        int        `json:"batch_size"`
+	BatchWindow      string     `json:"batch_window"`
+	Workers          int        `json:"workers"`
+	DryRun           bool       `json:"dry_run"`
+}
+
+// GetStatus returns the ingestor's connection, throughput and batching state
+func (i *Ingestor) GetStatus() OperationalStatus {
+	i.stats.mu.Lock()
+	lastFlushAt := i.stats.lastFlushAt
+	i.stats.mu.Unlock()
+	settings := i.settings()
+
+	status := OperationalStatus{
+		Connected:        i.IsConnected(),
+		Broker:           i.ConnectedBroker(),
+		Subscribed:       i.IsSubscribed(),
+		Topics:           i.subscriptionTopics(),
+		MessagesReceived: i.stats.messagesReceived.Load(),
+		ReadingsFlushed:  i.stats.readingsFlushed.Load(),
+		LastMessageAt:    unixNanoTime(i.stats.lastMessageAt.Load()),
+		LastWriteAt:      unixNanoTime(i.stats.lastInsertAt.Load()),
+		QueueDepth:       len(i.msgCh),
+		QueueCapacity:    cap(i.msgCh),
+		BatchSize:        settings.batchSize,
+		BatchWindow:      settings.batchWindow.String(),
+		Workers:          i.cfg.Workers,
+		DryRun:           i.cfg.DryRun,
+	}
+	if !i.startedAt.IsZero() {
+		startedAt := i.startedAt
+		status.StartedAt = &startedAt
+	}
+	if !lastFlushAt.IsZero() {
+		lastFlushAt = lastFlushAt.UTC()
+		status.LastFlushAt = &lastFlushAt
+	}
+	return status
+}
+
+// unixNanoTime converts a stored unix nanosecond time, returning nil for 0
+func unixNanoTime(ns int64) *time.Time {
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns).UTC()
+	return &t
+}
@@ -0,0 +1,86 @@
+package mqtingestor
+
+import (
+	"sync"
+	"time"
+)
+
+// errorTypeQueueOverflow is published for readings dropped because the queue
+// was full
+const errorTypeQueueOverflow = "queue_overflow"
+
+// overflowErrorInterval is the least time between queue_overflow errors published
+// to the same Pi; drops in between are added to the next error's affected_count
+const overflowErrorInterval = time.Minute
+
+// overflowThrottleSweepMin is the Pi count at which the throttle first drops
+// Pis it hasn't published to within overflowErrorInterval
+const overflowThrottleSweepMin = 1024
+
+type overflowEntry struct {
+	lastPublished time.Time
+	suppressed    int // readings dropped since lastPublished
+}
+
+// overflowThrottle limits queue_overflow errors to one per Pi per
+// overflowErrorInterval. While the queue overflows every message could be
+// dropped, and an error for each would add publish load just when the ingestor
+// is furthest behind.
+type overflowThrottle struct {
+	mu      sync.Mutex
+	entries map[string]*overflowEntry
+	sweepAt int
+}
+
+func newOverflowThrottle() *overflowThrottle {
+	return &overflowThrottle{entries: make(map[string]*overflowEntry), sweepAt: overflowThrottleSweepMin}
+}
+
+// allow records count dropped readings for piID. It reports whether an error
+// may be published now and, if so, how many readings it should cover,
+// including those dropped while errors were held back.
+func (t *overflowThrottle) allow(piID string, count int, now time.Time) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[piID]
+	if !ok {
+		if len(t.entries) >= t.sweepAt {
+			t.sweep(now)
+		}
+		t.entries[piID] = &overflowEntry{lastPublished: now}
+		return count, true
+	}
+	if now.Sub(entry.lastPublished) < overflowErrorInterval {
+		entry.suppressed += count
+		return 0, false
+	}
+	count += entry.suppressed
+	entry.lastPublished = now
+	entry.suppressed = 0
+	return count, true
+}
+
+// sweep forgets Pis whose last error is older than overflowErrorInterval;
+// readings they had held back are not reported. Callers hold t.mu.
+func (t *overflowThrottle) sweep(now time.Time) {
+	for piID, entry := range t.entries {
+		if now.Sub(entry.lastPublished) >= overflowErrorInterval {
+			delete(t.entries, piID)
+		}
+	}
+	t.sweepAt = max(2*len(t.entries), overflowThrottleSweepMin)
+}
+
+// queueOverflowed reports count readings of one Pi and device dropped because
+// the queue was full: they are logged and counted every time, and published as
+// a queue_overflow error at most once per Pi per overflowErrorInterval
+func (i *Ingestor) queueOverflowed(sourceTopic, piID, deviceID string, count int) {
+	i.logger.Logger.Warn().Str("pi_id", piID).Str("device_id", deviceID).Int("readings", count).Str("policy", i.cfg.QueueOverflowPolicy).Msg("Dropping reading: queue full")
+	i.stats.recordDropped(count)
+	i.stats.recordFailedN(errorTypeQueueOverflow, count)
+
+	if total, ok := i.overflowErrs.allow(piID, count, time.Now()); ok {
+		i.publishErrorCount(sourceTopic, piID, deviceID, errorTypeQueueOverflow, "Ingestor queue is full, reading dropped", total)
+	}
+}
@@ -0,0 +1,180 @@
+package mqtingestor
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// doneToken is an MQTT token that has already completed
+type doneToken struct{ err error }
+
+func (t doneToken) Wait() bool                     { return true }
+func (t doneToken) WaitTimeout(time.Duration) bool { return true }
+func (t doneToken) Error() error                   { return t.err }
+func (t doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakePublish is one message published through fakeMQTTClient
+type fakePublish struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// fakeMQTTClient is a connected MQTT client that keeps what is published to
+// it. Calls it doesn't implement panic.
+type fakeMQTTClient struct {
+	mqtt.Client
+	mu        sync.Mutex
+	published []fakePublish
+}
+
+func (c *fakeMQTTClient) IsConnected() bool { return true }
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, _ := payload.([]byte)
+	c.published = append(c.published, fakePublish{topic: topic, retained: retained, payload: data})
+	return doneToken{}
+}
+
+// errors returns the ingest errors published so far
+func (c *fakeMQTTClient) errors(t *testing.T) []ingest_models.IngestError {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []ingest_models.IngestError
+	for _, p := range c.published {
+		var e ingest_models.IngestError
+		if err := json.Unmarshal(p.payload, &e); err != nil {
+			t.Fatalf("message on %s is not an ingest error: %v", p.topic, err)
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+func TestOverflowThrottle(t *testing.T) {
+	type step struct {
+		advance   time.Duration
+		piID      string
+		count     int
+		wantOK    bool
+		wantCount int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "first drop publishes",
+			steps: []step{
+				{piID: "pi-1", count: 3, wantOK: true, wantCount: 3},
+			},
+		},
+		{
+			name: "drops within a minute are held back",
+			steps: []step{
+				{piID: "pi-1", count: 1, wantOK: true, wantCount: 1},
+				{advance: time.Second, piID: "pi-1", count: 2},
+				{advance: 58 * time.Second, piID: "pi-1", count: 1},
+			},
+		},
+		{
+			name: "held back drops are reported after a minute",
+			steps: []step{
+				{piID: "pi-1", count: 1, wantOK: true, wantCount: 1},
+				{advance: 30 * time.Second, piID: "pi-1", count: 2},
+				{advance: 30 * time.Second, piID: "pi-1", count: 4, wantOK: true, wantCount: 6},
+				{advance: 59 * time.Second, piID: "pi-1", count: 1},
+			},
+		},
+		{
+			name: "each Pi has its own minute",
+			steps: []step{
+				{piID: "pi-1", count: 1, wantOK: true, wantCount: 1},
+				{advance: time.Second, piID: "pi-2", count: 1, wantOK: true, wantCount: 1},
+				{advance: time.Second, piID: "pi-1", count: 1},
+				{advance: time.Second, piID: "pi-2", count: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newOverflowThrottle()
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			for n, s := range tt.steps {
+				now = now.Add(s.advance)
+				count, ok := throttle.allow(s.piID, s.count, now)
+				if ok != s.wantOK || count != s.wantCount {
+					t.Fatalf("step %d: allow(%s, %d) = %d, %v; want %d, %v", n, s.piID, s.count, count, ok, s.wantCount, s.wantOK)
+				}
+			}
+		})
+	}
+}
+
+// Every dropped reading is counted, but each Pi gets one queue_overflow
+// error per minute on its feedback topic
+func TestQueueOverflowedPublishesError(t *testing.T) {
+	i := newQueueTestIngestor(OverflowDropNewest, 1, 0)
+	mqttClient := &fakeMQTTClient{}
+	i.mqttClient = mqttClient
+	i.cfg.PublishErrors = true
+	i.cfg.ErrorTopicTemplate = "ingestor/errors/{pi_id}/{device_id}"
+
+	i.queueOverflowed("sensors/pi-1/0/t", "pi-1", "0", 2)
+	i.queueOverflowed("sensors/pi-1/0/t", "pi-1", "0", 1)
+	i.queueOverflowed("sensors/pi-2/3/t", "pi-2", "3", 1)
+
+	errs := mqttClient.errors(t)
+	if len(errs) != 2 {
+		t.Fatalf("%d errors published, want one per Pi: %+v", len(errs), errs)
+	}
+	for n, want := range []struct {
+		piID  string
+		count int
+	}{{"pi-1", 2}, {"pi-2", 1}} {
+		if errs[n].ErrorType != errorTypeQueueOverflow || errs[n].PiID != want.piID || errs[n].AffectedCount != want.count {
+			t.Errorf("error %d = %+v, want %s for %s covering %d", n, errs[n], errorTypeQueueOverflow, want.piID, want.count)
+		}
+	}
+	if topic := mqttClient.published[0].topic; topic != "ingestor/errors/pi-1/0" {
+		t.Errorf("published to %s, want the Pi's feedback topic", topic)
+	}
+	if dropped := i.stats.queueDropped.Load(); dropped != 4 {
+		t.Errorf("%d readings counted as dropped, want 4", dropped)
+	}
+}
+
+func TestMustOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		fallback string
+		want     string
+	}{
+		{name: "unset", want: OverflowBlock},
+		{name: "INGESTOR_OVERFLOW", current: OverflowDropOldest, want: OverflowDropOldest},
+		{name: "older name", fallback: OverflowDropNewest, want: OverflowDropNewest},
+		{name: "both set", current: OverflowDropOldest, fallback: OverflowDropNewest, want: OverflowDropOldest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INGESTOR_OVERFLOW", tt.current)
+			t.Setenv("QUEUE_OVERFLOW_POLICY", tt.fallback)
+			if got := mustOverflowPolicy("INGESTOR_OVERFLOW", "QUEUE_OVERFLOW_POLICY", OverflowBlock); got != tt.want {
+				t.Errorf("mustOverflowPolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package mqtingestor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// payloadElement is one reading of an array payload and its size in the message
+type payloadElement struct {
+	payload map[string]interface{}
+	size    int
+}
+
+// splitPayloadArray splits a JSON array of objects into its readings. It
+// reports false for anything else, including arrays holding non-objects, which
+// keep being stored as a single raw payload as before arrays were accepted.
+func splitPayloadArray(data []byte) ([]payloadElement, bool) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, false
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(trimmed, &raw); err != nil {
+		return nil, false
+	}
+	elements := make([]payloadElement, len(raw))
+	for n, element := range raw {
+		if err := hardware_models.DecodePayload(element, &elements[n].payload); err != nil || elements[n].payload == nil {
+			return nil, false
+		}
+		elements[n].size = len(element)
+	}
+	return elements, true
+}
+
+// queueArray queues each reading of an array payload on its own, each taking
+// its timestamp from its own payload. An array longer than MaxPayloadReadings
+// is refused whole with one payload_too_large error.
+func (i *Ingestor) queueArray(sourceTopic string, topic ingest_models.SensorTopic, elements []payloadElement, receivedAt time.Time) {
+	if len(elements) > i.cfg.MaxPayloadReadings {
+		i.logger.Logger.Warn().Str("pi_id", topic.PiID).Str("device_id", topic.DeviceID).Int("readings", len(elements)).Int("max", i.cfg.MaxPayloadReadings).Msg("Dropping message: too many readings in array payload")
+		i.publishErrorCount(sourceTopic, topic.PiID, topic.DeviceID, "payload_too_large", fmt.Sprintf("Array payload holds %d readings, at most %d are accepted per message", len(elements), i.cfg.MaxPayloadReadings), len(elements))
+		i.stats.recordFailedN("payload_too_large", len(elements))
+		return
+	}
+
+	for n, element := range elements {
+		if err := i.queueReading(sourceTopic, topic, element.payload, element.size, receivedAt); err != nil {
+			// Stop at the first refusal rather than report each reading
+			i.reportEnqueueFailure(sourceTopic, topic, err, len(elements)-n)
+			return
+		}
+	}
+}
+
+// markRetained flags the readings of a retained message, stored when
+// INGESTOR_IGNORE_RETAINED is false, so they can be told from live ones
+func markRetained(payload map[string]interface{}, elements []payloadElement) {
+	if payload != nil {
+		payload["retained"] = true
+	}
+	for _, element := range elements {
+		element.payload["retained"] = true
+	}
+}
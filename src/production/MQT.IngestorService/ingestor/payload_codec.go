@@ -0,0 +1,159 @@
+package mqtingestor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// Payload formats for INGESTOR_PAYLOAD_FORMAT
+const (
+	PayloadFormatJSON = "json"
+	PayloadFormatCBOR = "cbor"
+	PayloadFormatAuto = "auto" // JSON, falling back to CBOR
+)
+
+// PayloadDecoder decodes a message payload into a reading payload. Numbers
+// should be json.Number, as DecodePayload gives for JSON, so every format
+// stores and compares alike.
+type PayloadDecoder func(data []byte) (map[string]interface{}, error)
+
+// payloadDecoders holds the formats INGESTOR_PAYLOAD_FORMAT may name besides auto
+var payloadDecoders = map[string]PayloadDecoder{
+	PayloadFormatJSON: decodeJSONPayload,
+	PayloadFormatCBOR: decodeCBORPayload,
+}
+
+// RegisterPayloadDecoder adds a payload format, or replaces one. It must be
+// called before New, typically from an init function.
+func RegisterPayloadDecoder(format string, decoder PayloadDecoder) {
+	payloadDecoders[format] = decoder
+}
+
+// validPayloadFormat reports whether format is auto or a registered format
+func validPayloadFormat(format string) bool {
+	_, ok := payloadDecoders[format]
+	return ok || format == PayloadFormatAuto
+}
+
+// errNotObject is returned for valid JSON that isn't an object
+var errNotObject = errors.New("payload is not an object")
+
+func decodeJSONPayload(data []byte) (map[string]interface{}, error) {
+	var payload map[string]interface{}
+	if err := hardware_models.DecodePayload(data, &payload); err != nil {
+		if json.Valid(data) {
+			return nil, errNotObject
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+var cborHandle = func() *codec.CborHandle {
+	h := &codec.CborHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// decodeCBORPayload decodes a CBOR map with text keys. Numbers become
+// json.Number, times RFC3339 strings and byte strings base64, as they would be
+// stored from JSON.
+func decodeCBORPayload(data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	decoder := codec.NewDecoderBytes(data, cborHandle)
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.NumBytesRead() != len(data) {
+		return nil, errors.New("unexpected data after CBOR value")
+	}
+	payload, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("CBOR payload is %T, not a map", value)
+	}
+	normalized, err := normalizeCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	return normalized.(map[string]interface{}), nil
+}
+
+// normalizeCBOR converts decoded CBOR values to the types JSON decoding gives
+func normalizeCBOR(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			normalized, err := normalizeCBOR(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+		return v, nil
+	case []interface{}:
+		for n, item := range v {
+			normalized, err := normalizeCBOR(item)
+			if err != nil {
+				return nil, err
+			}
+			v[n] = normalized
+		}
+		return v, nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("CBOR payload holds %v, which can't be stored", v)
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	default:
+		// strings, bools, nil, and []byte, which encodes as base64
+		return v, nil
+	}
+}
+
+// decodeMessage decodes a message payload in the configured format. A JSON
+// array of objects is returned as elements instead of a payload. Valid JSON
+// that isn't an object keeps being stored under "raw"; anything that isn't
+// valid in the configured format is an error, unless StoreInvalidAsRaw keeps
+// the old behaviour of storing it under "raw" too.
+func (i *Ingestor) decodeMessage(data []byte) (map[string]interface{}, []payloadElement, error) {
+	payload, elements, err := i.decodeFormat(data)
+	if err != nil && i.cfg.StoreInvalidAsRaw {
+		return map[string]interface{}{"raw": string(data)}, nil, nil
+	}
+	return payload, elements, err
+}
+
+// decodeFormat decodes data strictly in the configured format
+func (i *Ingestor) decodeFormat(data []byte) (map[string]interface{}, []payloadElement, error) {
+	format := i.cfg.PayloadFormat
+	if format == PayloadFormatJSON || format == PayloadFormatAuto {
+		if elements, ok := splitPayloadArray(data); ok {
+			return nil, elements, nil
+		}
+		payload, err := decodeJSONPayload(data)
+		if errors.Is(err, errNotObject) {
+			return map[string]interface{}{"raw": string(data)}, nil, nil
+		}
+		if err == nil || format == PayloadFormatJSON {
+			return payload, nil, err
+		}
+		format = PayloadFormatCBOR
+	}
+
+	payload, err := payloadDecoders[format](data)
+	return payload, nil, err
+}
@@ -0,0 +1,40 @@
+package mqtingestor
+
+import (
+	"reflect"
+	"testing"
+
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
+)
+
+func TestDecodeMessageInvalidPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		storeRaw bool
+		data     string
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{name: "dropped by default", format: PayloadFormatJSON, data: "temp=21", wantErr: true},
+		{name: "auto drops what neither format decodes", format: PayloadFormatAuto, data: "temp=21", wantErr: true},
+		{name: "stored raw when asked", format: PayloadFormatJSON, storeRaw: true, data: "temp=21", want: map[string]interface{}{"raw": "temp=21"}},
+		{name: "cbor stored raw when asked", format: PayloadFormatCBOR, storeRaw: true, data: "temp=21", want: map[string]interface{}{"raw": "temp=21"}},
+		{name: "non-object JSON is always raw", format: PayloadFormatJSON, data: "42", want: map[string]interface{}{"raw": "42"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Ingestor{cfg: mqtmodels.IngestorConfig{PayloadFormat: tt.format, StoreInvalidAsRaw: tt.storeRaw}}
+			payload, elements, err := i.decodeMessage([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeMessage error = %v, want error %v", err, tt.wantErr)
+			}
+			if elements != nil {
+				t.Errorf("got elements %v", elements)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(payload, tt.want) {
+				t.Errorf("payload = %v, want %v", payload, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package mqtingestor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// isGzip reports whether data starts with the gzip magic bytes
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// gunzipPayload decompresses a gzip payload, refusing one that decompresses
+// to more than maxBytes so a small message can't expand into a zip bomb
+func gunzipPayload(data []byte, maxBytes int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > maxBytes {
+		return nil, fmt.Errorf("decompressed payload exceeds %d bytes", maxBytes)
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package mqtingestor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("gzip Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("gzip Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestIsGzip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "gzip", data: gzipped(t, []byte(`{"t":21.5}`)), want: true},
+		{name: "magic bytes only", data: []byte{0x1f, 0x8b}, want: true},
+		{name: "JSON", data: []byte(`{"t":21.5}`)},
+		{name: "one magic byte", data: []byte{0x1f}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGzip(tt.data); got != tt.want {
+				t.Errorf("isGzip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGunzipPayload(t *testing.T) {
+	payload := []byte(`{"t":21.5,"h":40}`)
+	concatenated := append(gzipped(t, []byte(`{"t":`)), gzipped(t, []byte(`21.5}`))...)
+	corrupted := gzipped(t, payload)
+	corrupted[len(corrupted)-8] ^= 0xff // CRC-32 in the trailer
+
+	tests := []struct {
+		name     string
+		data     []byte
+		maxBytes int64
+		want     string
+		wantErr  string
+	}{
+		{name: "payload", data: gzipped(t, payload), maxBytes: 1 << 20, want: string(payload)},
+		{name: "exactly the limit", data: gzipped(t, payload), maxBytes: int64(len(payload)), want: string(payload)},
+		{name: "empty", data: gzipped(t, nil), maxBytes: 1, want: ""},
+		{name: "several members", data: concatenated, maxBytes: 1 << 20, want: `{"t":21.5}`},
+		{name: "one byte over the limit", data: gzipped(t, payload), maxBytes: int64(len(payload)) - 1, wantErr: "decompressed payload exceeds 16 bytes"},
+		{name: "zip bomb", data: gzipped(t, bytes.Repeat([]byte{'0'}, 16<<20)), maxBytes: 1 << 20, wantErr: "decompressed payload exceeds 1048576 bytes"},
+		{name: "corrupt checksum", data: corrupted, maxBytes: 1 << 20, wantErr: "gzip: invalid checksum"},
+		{name: "magic bytes only", data: []byte{0x1f, 0x8b}, maxBytes: 1 << 20, wantErr: "unexpected EOF"},
+		{name: "bad header", data: []byte{0x1f, 0x8b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, maxBytes: 1 << 20, wantErr: "gzip: invalid header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gunzipPayload(tt.data, tt.maxBytes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("gunzipPayload() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gunzipPayload(): %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("gunzipPayload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// A payload cut off anywhere after the magic bytes, header and trailer
+// included, is refused rather than parsed from what arrived
+func TestGunzipPayloadTruncated(t *testing.T) {
+	data := gzipped(t, []byte(`{"t":21.5,"h":40,"note":"a reading long enough to span several deflate symbols"}`))
+	for n := 2; n < len(data); n++ {
+		if got, err := gunzipPayload(data[:n], 1<<20); err == nil {
+			t.Errorf("first %d of %d bytes decompressed to %q", n, len(data), got)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package mqtingestor
+
+import (
+	"fmt"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// applyPayloadTimestamp sets reading.Ts from the payload's timestamp field, so
+// readings a device buffered offline keep the time they were measured rather
+// than the time they were uploaded. Ts stays the receive time when the field
+// is missing or can't be parsed. A timestamp more than MaxTimestampSkew ahead
+// of the receive time is refused with an invalid_timestamp error, and false is
+// returned so the reading is dropped.
+func (i *Ingestor) applyPayloadTimestamp(reading *ingest_models.ReadingEnvelope) bool {
+	ts, found, err := ingest_models.PayloadTimestamp(reading.Payload, i.cfg.PayloadTimestampField)
+	if !found {
+		return true
+	}
+	if err != nil {
+		i.logger.Logger.Debug().Err(err).Str("pi_id", reading.PiID).Str("device_id", reading.DeviceID).Str("field", i.cfg.PayloadTimestampField).Msg("Unparseable payload timestamp; using receive time")
+		return true
+	}
+
+	if ts.Sub(reading.ReceivedAt) > i.cfg.MaxTimestampSkew {
+		i.logger.Logger.Warn().Str("pi_id", reading.PiID).Str("device_id", reading.DeviceID).Time("ts", ts).Time("received_at", reading.ReceivedAt).Msg("Dropping reading: timestamp is in the future")
+		i.publishError(reading.Topic, reading.PiID, reading.DeviceID, "invalid_timestamp", fmt.Sprintf("Timestamp %s is more than %s ahead of the server clock", ts.Format(time.RFC3339Nano), i.cfg.MaxTimestampSkew))
+		i.stats.recordFailed("invalid_timestamp")
+		return false
+	}
+	reading.Ts = ts
+	return true
+}
@@ -0,0 +1,457 @@
+package mqtingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// piBatch is the part of a flushed batch that came from one Pi, in arrival order
+type piBatch struct {
+	piID     string
+	readings []ingest_models.ReadingEnvelope
+}
+
+// groupByPi splits a batch into one piBatch per Pi. Pis keep the order in
+// which they first appear and each Pi's readings keep their arrival order, so
+// a Pi's readings are written in the order it sent them.
+func groupByPi(batch []ingest_models.ReadingEnvelope) []piBatch {
+	var groups []piBatch
+	index := make(map[string]int)
+	for _, reading := range batch {
+		n, ok := index[reading.PiID]
+		if !ok {
+			n = len(groups)
+			index[reading.PiID] = n
+			groups = append(groups, piBatch{piID: reading.PiID})
+		}
+		groups[n].readings = append(groups[n].readings, reading)
+	}
+	return groups
+}
+
+// failAll drops every reading in readings for one reason, publishing a single
+// error for all of them. The error goes to the topic of the first reading.
+func (i *Ingestor) failAll(readings []ingest_models.ReadingEnvelope, errorType, message string) {
+	if len(readings) == 0 {
+		return
+	}
+	first := readings[0]
+	i.publishErrorCount(first.Topic, first.PiID, first.DeviceID, errorType, message, len(readings))
+	i.stats.recordFailedN(errorType, len(readings))
+}
+
+// validatePi checks one Pi's readings and returns those that may be written.
+// The Pi is validated once and each of its devices once, so a Pi that is
+// unknown or unassigned costs one API call and one error publish however many
+// readings it sent. Results come from the validation cache while it holds
+// them, then from known, and only then from the API.
+func (i *Ingestor) validatePi(ctx context.Context, group piBatch, known validationResults) []pendingReading {
+	piStatus, err := i.piStatus(ctx, group.piID, known)
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Str("pi_id", group.piID).Int("readings", len(group.readings)).Msg("Failed to validate Pi via API")
+		i.failOrSpool(group.readings, err, "pi_validation_error", fmt.Sprintf("Failed to validate Pi %s: %v", group.piID, err))
+		return nil
+	}
+	if piStatus == ingest_models.PiStatusNotFound {
+		i.logger.Logger.Warn().Str("pi_id", group.piID).Int("readings", len(group.readings)).Msg("Skipping readings: pi not found")
+		i.failAll(group.readings, "pi_not_found", fmt.Sprintf("Pi %s does not exist", group.piID))
+		return nil
+	}
+	if piStatus == ingest_models.PiStatusUnassigned {
+		i.logger.Logger.Warn().Str("pi_id", group.piID).Int("readings", len(group.readings)).Msg("Skipping readings: pi has no owner")
+		i.failAll(group.readings, "pi_unassigned", fmt.Sprintf("Pi %s is not assigned to a user", group.piID))
+		return nil
+	}
+
+	// Validate each device once. Readings of a device that fails are collected
+	// so the device gets one error however many readings it sent.
+	type deviceCheck struct {
+		errorType, message string // empty when the device is valid
+		err                error  // set when the API couldn't answer
+		rejected           []ingest_models.ReadingEnvelope
+	}
+	checks := make(map[string]*deviceCheck)
+	var order []string
+	var valid []pendingReading
+
+	for _, reading := range group.readings {
+		check, ok := checks[reading.DeviceID]
+		if !ok {
+			errorType, message, err := i.validateDevice(ctx, reading, known)
+			check = &deviceCheck{errorType: errorType, message: message, err: err}
+			checks[reading.DeviceID] = check
+			order = append(order, reading.DeviceID)
+		}
+		if check.errorType != "" {
+			check.rejected = append(check.rejected, reading)
+			continue
+		}
+
+		deviceIDInt, _ := strconv.Atoi(reading.DeviceID)
+		valid = append(valid, newPendingReading(reading, deviceIDInt))
+	}
+
+	for _, deviceID := range order {
+		check := checks[deviceID]
+		i.failOrSpool(check.rejected, check.err, check.errorType, check.message)
+	}
+	return valid
+}
+
+// validateDevice checks the device of reading exists for its Pi. It returns
+// the error type and message to report, or "" when the device is valid, and
+// the API error when the device couldn't be checked.
+func (i *Ingestor) validateDevice(ctx context.Context, reading ingest_models.ReadingEnvelope, known validationResults) (string, string, error) {
+	deviceIDInt, err := strconv.Atoi(reading.DeviceID)
+	if err == nil && deviceIDInt < 0 {
+		err = errors.New("device_id is negative")
+	}
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Str("device_id", reading.DeviceID).Msg("Error converting device_id to int")
+		return "invalid_device_id", fmt.Sprintf("Invalid device_id %q", reading.DeviceID), nil
+	}
+
+	deviceExists, err := i.deviceExists(ctx, reading.PiID, deviceIDInt, known)
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Str("pi_id", reading.PiID).Int("device_id", deviceIDInt).Msg("Failed to validate Device via API")
+		return "device_validation_error", fmt.Sprintf("Failed to validate Device %d: %v", deviceIDInt, err), err
+	}
+	if !deviceExists && i.cfg.AutoRegisterDevices {
+		deviceExists, err = i.autoRegisterDevice(ctx, reading, deviceIDInt)
+		if err != nil {
+			i.logger.Logger.Error().Err(err).Str("pi_id", reading.PiID).Int("device_id", deviceIDInt).Msg("Failed to auto-register Device via API")
+			return "device_registration_error", fmt.Sprintf("Failed to auto-register Device %d: %v", deviceIDInt, err), err
+		}
+	}
+	if !deviceExists {
+		i.logger.Logger.Warn().Str("pi_id", reading.PiID).Int("device_id", deviceIDInt).Msg("Skipping readings: device not found")
+		return "device_not_found", fmt.Sprintf("Device %d does not exist for Pi %s", deviceIDInt, reading.PiID), nil
+	}
+	return "", "", nil
+}
+
+// piStatus returns the Pi's validation status, asking the API only when
+// neither the validation cache nor known has an answer
+func (i *Ingestor) piStatus(ctx context.Context, piID string, known validationResults) (string, error) {
+	key := piCacheKey(piID)
+	if status, ok := i.validations.get(key, time.Now()); ok {
+		return status, nil
+	}
+	status, ok := known[key]
+	if !ok {
+		var err error
+		if status, err = i.apiClient.ValidatePi(ctx, piID); err != nil {
+			return "", err
+		}
+	}
+	i.validations.put(key, status, status == ingest_models.PiStatusOK, time.Now())
+	return status, nil
+}
+
+// deviceExists reports whether the device exists for the Pi, asking the API
+// only when neither the validation cache nor known has an answer
+func (i *Ingestor) deviceExists(ctx context.Context, piID string, deviceID int, known validationResults) (bool, error) {
+	key := deviceCacheKey(piID, strconv.Itoa(deviceID))
+	if status, ok := i.validations.get(key, time.Now()); ok {
+		return status == deviceStatusOK, nil
+	}
+	status, ok := known[key]
+	if !ok {
+		exists, err := i.apiClient.ValidateDevice(ctx, piID, deviceID)
+		if err != nil {
+			return false, err
+		}
+		status = deviceStatusNotFound
+		if exists {
+			status = deviceStatusOK
+		}
+	}
+	exists := status == deviceStatusOK
+	i.validations.put(key, status, exists, time.Now())
+	return exists, nil
+}
+
+// maxValidateItemsPerCall matches the API's cap on a validation batch
+const maxValidateItemsPerCall = 10000
+
+// validationResults holds the answers of a flush's batch validation, by
+// validation cache key and in the form the cache stores them
+type validationResults map[string]string
+
+// validateBatch asks the API in one call about every Pi and device of batch
+// that the validation cache can't answer, so a flush costs at most one
+// validation request (more only past maxValidateItemsPerCall items). The
+// answers aren't cached here: validatePi caches them
+// as it uses them, which keeps the cache's hit and miss counts true. When the
+// call fails, whatever it would have answered is validated one Pi and device
+// at a time, which reports the failure per Pi as before; an API without the
+// endpoint is remembered and not asked again.
+func (i *Ingestor) validateBatch(ctx context.Context, batch []ingest_models.ReadingEnvelope) validationResults {
+	if i.validateBatchUnsupported.Load() {
+		return nil
+	}
+
+	now := time.Now()
+	var items []ingest_models.ValidateItem
+	seen := make(map[string]bool)
+	for _, reading := range batch {
+		piKey := piCacheKey(reading.PiID)
+		status, piCached := i.validations.lookup(piKey, now)
+		if piCached && status != ingest_models.PiStatusOK {
+			continue // its devices won't be checked
+		}
+		// A malformed device ID is refused without asking; its Pi still needs checking
+		key := piKey
+		deviceID, err := strconv.Atoi(reading.DeviceID)
+		item := ingest_models.ValidateItem{PiID: reading.PiID}
+		if err == nil && deviceID >= 0 {
+			key = deviceCacheKey(reading.PiID, strconv.Itoa(deviceID))
+			if _, ok := i.validations.lookup(key, now); ok {
+				continue
+			}
+			item.DeviceID = &deviceID
+		} else if piCached {
+			continue
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	known := make(validationResults, len(items))
+	for len(items) > 0 {
+		chunk := items[:min(len(items), maxValidateItemsPerCall)]
+		items = items[len(chunk):]
+
+		results, err := i.apiClient.ValidateBatch(ctx, chunk)
+		if errors.Is(err, client.ErrBatchUnsupported) {
+			i.logger.Logger.Warn().Msg("API has no batch validation endpoint; validating Pis and devices one at a time")
+			i.validateBatchUnsupported.Store(true)
+			return known
+		}
+		if err != nil {
+			i.logger.Logger.Warn().Err(err).Int("items", len(chunk)).Msg("Batch validation failed; validating Pis and devices one at a time")
+			return known
+		}
+
+		for _, result := range results {
+			known[piCacheKey(result.PiID)] = result.PiStatus
+			if result.DeviceID == nil || result.PiStatus != ingest_models.PiStatusOK {
+				continue
+			}
+			status := deviceStatusNotFound
+			if result.DeviceExists {
+				status = deviceStatusOK
+			}
+			known[deviceCacheKey(result.PiID, strconv.Itoa(*result.DeviceID))] = status
+		}
+	}
+	return known
+}
+
+// Device validation results as held in the validation cache
+const (
+	deviceStatusOK       = "ok"
+	deviceStatusNotFound = "not_found"
+)
+
+// pendingReading is a validated reading and the envelope it arrived in
+type pendingReading struct {
+	envelope ingest_models.ReadingEnvelope
+	reading  hardware_models.Reading
+}
+
+// newPendingReading builds the reading to write for envelope
+func newPendingReading(envelope ingest_models.ReadingEnvelope, deviceID int) pendingReading {
+	receivedAt := envelope.ReceivedAt
+	return pendingReading{
+		envelope: envelope,
+		reading: hardware_models.Reading{
+			PiID:       envelope.PiID,
+			DeviceID:   deviceID,
+			Ts:         envelope.Ts,
+			Payload:    envelope.Payload,
+			ReceivedAt: &receivedAt,
+		},
+	}
+}
+
+// Error types for readings a payload schema rejected. They are the same
+// error under two names: schema_validation_failed is published instead of
+// schema_violation when SchemaErrorType asks for it.
+const (
+	errorTypeSchemaViolation        = "schema_violation"
+	errorTypeSchemaValidationFailed = "schema_validation_failed"
+)
+
+// Error types published for readings the API refused within a batch, by
+// ingest_models.ReadingFailure* reason. Schema violations are published as
+// schemaErrorType.
+var readingFailureErrorTypes = map[string]string{
+	ingest_models.ReadingFailureDeviceNotFound: "device_not_found",
+	ingest_models.ReadingFailureDuplicate:      "duplicate_reading",
+}
+
+// schemaErrorType is the error type published for a reading its payload
+// schema rejected
+func (i *Ingestor) schemaErrorType() string {
+	if i.cfg.SchemaErrorType == "" {
+		return errorTypeSchemaViolation
+	}
+	return i.cfg.SchemaErrorType
+}
+
+// maxReadingsPerCall matches the API's cap on a reading batch
+const maxReadingsPerCall = 5000
+
+// writeReadings creates a flush's validated readings via the API in one call,
+// or logs them in dry-run mode, and records those stored in liveness. Readings
+// the API refuses get their own error publish; if the API has no batch
+// endpoint they are written one at a time instead.
+func (i *Ingestor) writeReadings(ctx context.Context, pending []pendingReading, liveness *livenessBatch) {
+	for len(pending) > maxReadingsPerCall {
+		i.writeReadings(ctx, pending[:maxReadingsPerCall], liveness)
+		pending = pending[maxReadingsPerCall:]
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if i.cfg.DryRun {
+		for _, p := range pending {
+			i.wouldInsert(p.reading)
+		}
+		return
+	}
+	if i.batchUnsupported.Load() {
+		for _, p := range pending {
+			i.writeReading(ctx, p, liveness)
+		}
+		return
+	}
+
+	readings := make([]hardware_models.Reading, len(pending))
+	for n, p := range pending {
+		readings[n] = p.reading
+	}
+
+	response, err := i.apiClient.CreateReadings(ctx, readings)
+	if errors.Is(err, client.ErrBatchTooLarge) && len(pending) > 1 {
+		// Over the API's body limit; halves are sent separately
+		mid := len(pending) / 2
+		i.writeReadings(ctx, pending[:mid], liveness)
+		i.writeReadings(ctx, pending[mid:], liveness)
+		return
+	}
+	if errors.Is(err, client.ErrBatchUnsupported) {
+		i.logger.Logger.Warn().Msg("API has no batch reading endpoint; writing readings one at a time")
+		i.batchUnsupported.Store(true)
+		for _, p := range pending {
+			i.writeReading(ctx, p, liveness)
+		}
+		return
+	}
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Int("readings", len(pending)).Msg("Error creating readings via API")
+		envelopes := make([]ingest_models.ReadingEnvelope, len(pending))
+		for n, p := range pending {
+			envelopes[n] = p.envelope
+		}
+		i.failOrSpool(envelopes, err, "create_reading_error", fmt.Sprintf("Failed to create readings: %v", err))
+		return
+	}
+
+	failed := make(map[int]bool, len(response.Failed))
+	for _, failure := range response.Failed {
+		if failure.Index < 0 || failure.Index >= len(pending) {
+			continue
+		}
+		failed[failure.Index] = true
+		envelope := pending[failure.Index].envelope
+
+		errorType, ok := readingFailureErrorTypes[failure.Reason]
+		if failure.Reason == ingest_models.ReadingFailureSchemaViolation {
+			errorType, ok = i.schemaErrorType(), true
+		}
+		if !ok {
+			errorType = "create_reading_error"
+		}
+		message := failure.Error
+		if len(failure.Violations) > 0 {
+			message = describeFailure(failure)
+		}
+		i.logger.Logger.Warn().Str("pi_id", envelope.PiID).Str("device_id", envelope.DeviceID).Str("reason", failure.Reason).Str("error", failure.Error).Msg("Reading rejected by API")
+		if failure.Reason == ingest_models.ReadingFailureDeviceNotFound {
+			// Deleted since it was validated; check again on its next reading
+			i.validations.invalidateDevice(envelope.PiID, envelope.DeviceID)
+		}
+		i.publishError(envelope.Topic, envelope.PiID, envelope.DeviceID, errorType, message)
+		i.stats.recordFailed(errorType)
+	}
+
+	for n, p := range pending {
+		if failed[n] {
+			continue
+		}
+		i.stats.recordInserted()
+		liveness.record(p.reading.PiID, p.reading.DeviceID, p.reading.Ts)
+	}
+}
+
+// describeFailure summarises a reading refused by its schema for the error topic
+func describeFailure(failure ingest_models.ReadingFailure) string {
+	parts := make([]string, 0, len(failure.Violations))
+	for _, violation := range failure.Violations {
+		if violation.Path == "" {
+			parts = append(parts, violation.Message)
+			continue
+		}
+		parts = append(parts, violation.Path+": "+violation.Message)
+	}
+	return failure.Error + " (" + strings.Join(parts, "; ") + ")"
+}
+
+// writeReading creates one validated reading via the API and records it in
+// liveness once stored
+func (i *Ingestor) writeReading(ctx context.Context, p pendingReading, liveness *livenessBatch) {
+	envelope, reading := p.envelope, p.reading
+	if err := i.apiClient.CreateReading(ctx, reading); err != nil {
+		if errors.Is(err, client.ErrSchemaViolation) {
+			i.logger.Logger.Warn().Err(err).Str("pi_id", envelope.PiID).Str("device_id", envelope.DeviceID).Msg("Reading rejected by payload schema")
+			i.publishError(envelope.Topic, envelope.PiID, envelope.DeviceID, i.schemaErrorType(), err.Error())
+			i.stats.recordFailed(i.schemaErrorType())
+			return
+		}
+		if errors.Is(err, client.ErrDeviceNotFound) {
+			// Deleted since it was validated; check again on its next reading
+			i.logger.Logger.Warn().Str("pi_id", envelope.PiID).Str("device_id", envelope.DeviceID).Msg("Device no longer exists")
+			i.validations.invalidateDevice(envelope.PiID, envelope.DeviceID)
+			i.publishError(envelope.Topic, envelope.PiID, envelope.DeviceID, "device_not_found", err.Error())
+			i.stats.recordFailed("device_not_found")
+			return
+		}
+		if errors.Is(err, client.ErrDuplicateReading) {
+			i.logger.Logger.Warn().Str("pi_id", envelope.PiID).Str("device_id", envelope.DeviceID).Msg("Reading already stored")
+			i.publishError(envelope.Topic, envelope.PiID, envelope.DeviceID, "duplicate_reading", err.Error())
+			i.stats.recordFailed("duplicate_reading")
+			return
+		}
+		i.logger.Logger.Error().Err(err).Str("pi_id", envelope.PiID).Str("device_id", envelope.DeviceID).Msg("Error creating reading via API")
+		i.failOrSpool([]ingest_models.ReadingEnvelope{envelope}, err, "create_reading_error", fmt.Sprintf("Failed to create reading: %v", err))
+		return
+	}
+	i.stats.recordInserted()
+	liveness.record(reading.PiID, reading.DeviceID, reading.Ts)
+}
@@ -0,0 +1,109 @@
+package mqtingestor
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recentErrorTypesPerPi is how many error types are remembered for each tracked Pi
+const recentErrorTypesPerPi = 5
+
+// PiFailures summarises ingestion failures for a single Pi
+type PiFailures struct {
+	PiID             string            `json:"pi_id"`
+	Failures         uint64            `json:"failures"`
+	FailuresByType   map[string]uint64 `json:"failures_by_type"`
+	RecentErrorTypes []string          `json:"recent_error_types"` // newest first
+	LastDeviceID     string            `json:"last_device_id,omitempty"`
+	LastFailureAt    time.Time         `json:"last_failure_at"`
+}
+
+// piFailureTracker keeps failure counters for at most maxPis Pis. When full,
+// the Pi that failed least recently is evicted so a flood of bad Pi IDs can't
+// grow memory without bound.
+type piFailureTracker struct {
+	mu      sync.Mutex
+	maxPis  int
+	order   *list.List // front = most recently failed
+	entries map[string]*list.Element
+}
+
+func newPiFailureTracker(maxPis int) *piFailureTracker {
+	if maxPis < 0 {
+		maxPis = 0
+	}
+	return &piFailureTracker{
+		maxPis:  maxPis,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (t *piFailureTracker) record(piID, deviceID, errorType string, count int, at time.Time) {
+	if piID == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.maxPis == 0 {
+		return
+	}
+
+	el, ok := t.entries[piID]
+	if ok {
+		t.order.MoveToFront(el)
+	} else {
+		if t.order.Len() >= t.maxPis {
+			oldest := t.order.Back()
+			t.order.Remove(oldest)
+			delete(t.entries, oldest.Value.(*PiFailures).PiID)
+		}
+		el = t.order.PushFront(&PiFailures{PiID: piID, FailuresByType: make(map[string]uint64)})
+		t.entries[piID] = el
+	}
+
+	entry := el.Value.(*PiFailures)
+	entry.Failures += uint64(count)
+	entry.FailuresByType[errorType] += uint64(count)
+	entry.RecentErrorTypes = append([]string{errorType}, entry.RecentErrorTypes...)
+	if len(entry.RecentErrorTypes) > recentErrorTypesPerPi {
+		entry.RecentErrorTypes = entry.RecentErrorTypes[:recentErrorTypesPerPi]
+	}
+	entry.LastDeviceID = deviceID
+	entry.LastFailureAt = at
+}
+
+// top returns up to limit Pis ordered by failure count, highest first
+func (t *piFailureTracker) top(limit int) []PiFailures {
+	t.mu.Lock()
+	out := make([]PiFailures, 0, t.order.Len())
+	for el := t.order.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*PiFailures)
+		byType := make(map[string]uint64, len(entry.FailuresByType))
+		for errorType, count := range entry.FailuresByType {
+			byType[errorType] = count
+		}
+		copied := *entry
+		copied.FailuresByType = byType
+		copied.RecentErrorTypes = append([]string(nil), entry.RecentErrorTypes...)
+		out = append(out, copied)
+	}
+	t.mu.Unlock()
+
+	sort.SliceStable(out, func(a, b int) bool {
+		return out[a].Failures > out[b].Failures
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// TopFailingPis returns the tracked Pis with the most ingestion failures
+func (i *Ingestor) TopFailingPis(limit int) []PiFailures {
+	return i.piFailures.top(limit)
+}
@@ -0,0 +1,234 @@
+package mqtingestor
+
+import (
+	"errors"
+	"sync"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// Queue overflow policies, applied when the queue is at its count or byte limit
+const (
+	OverflowBlock      = "block"       // wait for the batch writer to make room (stalls the MQTT handler)
+	OverflowDropNewest = "drop_newest" // drop the incoming reading and publish a queue_overflow error
+	OverflowDropOldest = "drop_oldest" // drop the longest-queued reading to make room, publishing a queue_overflow error for it
+	OverflowSpool      = "spool"       // write the incoming reading to the disk spool for replay; dropped as drop_newest once the spool is full
+)
+
+// readingOverhead approximates the fixed cost of a queued reading beyond its
+// payload and topic bytes
+const readingOverhead = 256
+
+// Reasons enqueue refuses a reading
+var (
+	errQueueFull = errors.New("queue full")
+	errStopping  = errors.New("ingestor is stopping")
+)
+
+// queuedReading is a reading waiting for the batch writer, with its estimated size
+type queuedReading struct {
+	reading ingest_models.ReadingEnvelope
+	size    int64
+}
+
+// byteBudget bounds the estimated memory held by queued readings
+type byteBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int64 // 0 disables the budget
+	used   int64
+	closed bool // set by close; waiting acquires give up
+}
+
+func newByteBudget(max int64) *byteBudget {
+	b := &byteBudget{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire reserves size bytes. When wait is true it blocks until enough bytes
+// are released; otherwise it returns false if the budget would be exceeded.
+// A reading larger than the whole budget is admitted once the queue is empty
+// so it can't wedge the queue forever. Once the budget is closed a waiting
+// acquire returns false.
+func (b *byteBudget) acquire(size int64, wait bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 {
+		for b.used > 0 && b.used+size > b.max {
+			if !wait || b.closed {
+				return false
+			}
+			b.cond.Wait()
+		}
+	}
+	b.used += size
+	queueBytes.Set(float64(b.used))
+	return true
+}
+
+func (b *byteBudget) release(size int64) {
+	b.mu.Lock()
+	b.used -= size
+	queueBytes.Set(float64(b.used))
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// close wakes any acquire waiting for room, which then fails. Stop uses it so
+// MQTT handlers blocked on a full queue return instead of holding up shutdown.
+func (b *byteBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *byteBudget) inUse() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// enqueue adds a reading to the batch writer queue, applying the overflow
+// policy when the queue is at its count or byte limit. It returns errQueueFull
+// when the reading was dropped for room and errStopping once Stop has begun.
+//
+// The queue's read lock is held for the whole send, so Stop, which closes
+// msgCh under the write lock, waits for sends in progress to finish rather
+// than have them panic on a closed channel.
+func (i *Ingestor) enqueue(reading ingest_models.ReadingEnvelope, payloadBytes int) error {
+	item := queuedReading{
+		reading: reading,
+		size:    int64(payloadBytes+len(reading.Topic)) + readingOverhead,
+	}
+
+	i.queueMu.RLock()
+	defer i.queueMu.RUnlock()
+	if i.queueClosed {
+		return errStopping
+	}
+
+	switch i.cfg.QueueOverflowPolicy {
+	case OverflowDropNewest:
+		if !i.queueBudget.acquire(item.size, false) {
+			return errQueueFull
+		}
+		select {
+		case i.msgCh <- item:
+		default:
+			i.queueBudget.release(item.size)
+			return errQueueFull
+		}
+	case OverflowSpool:
+		if !i.queueBudget.acquire(item.size, false) {
+			return i.spill(reading)
+		}
+		select {
+		case i.msgCh <- item:
+		default:
+			i.queueBudget.release(item.size)
+			return i.spill(reading)
+		}
+	case OverflowDropOldest:
+		for !i.queueBudget.acquire(item.size, false) {
+			if !i.dropOldest() {
+				// The batch writer took the oldest but hasn't released its bytes yet
+				if !i.queueBudget.acquire(item.size, true) {
+					return errStopping
+				}
+				break
+			}
+		}
+		if !i.sendDroppingOldest(item) {
+			i.queueBudget.release(item.size)
+			return errStopping
+		}
+	default:
+		if !i.queueBudget.acquire(item.size, true) {
+			return errStopping
+		}
+		select {
+		case i.msgCh <- item:
+		case <-i.stopCh:
+			i.queueBudget.release(item.size)
+			return errStopping
+		}
+	}
+
+	queueDepth.Set(float64(len(i.msgCh)))
+	return nil
+}
+
+// spill writes a reading the queue has no room for to the spool, which
+// replays it once the API takes readings again. It returns errQueueFull when
+// the spool is disabled, full or can't be written.
+func (i *Ingestor) spill(reading ingest_models.ReadingEnvelope) error {
+	if i.spool == nil {
+		return errQueueFull
+	}
+	n, err := i.spool.append([]ingest_models.ReadingEnvelope{reading})
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Msg("Failed to spool reading")
+	}
+	if n == 0 {
+		return errQueueFull
+	}
+	i.stats.recordSpooled(n)
+	return nil
+}
+
+// sendDroppingOldest sends item, dropping the oldest queued readings while
+// the queue is full. It returns false if Stop begins while it waits.
+func (i *Ingestor) sendDroppingOldest(item queuedReading) bool {
+	for {
+		select {
+		case i.msgCh <- item:
+			return true
+		default:
+		}
+		if !i.dropOldest() {
+			// Nothing queued to drop, as with an unbuffered queue; wait as block does
+			select {
+			case i.msgCh <- item:
+				return true
+			case <-i.stopCh:
+				return false
+			}
+		}
+	}
+}
+
+// dropOldest drops the reading that has been queued longest, reporting it as
+// overflowed. It returns false if the queue was already empty.
+func (i *Ingestor) dropOldest() bool {
+	select {
+	case item, ok := <-i.msgCh:
+		if !ok {
+			return false
+		}
+		i.dequeued(item)
+		i.queueOverflowed(item.reading.Topic, item.reading.PiID, item.reading.DeviceID, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+// closeQueue ends the queue once no enqueue is in progress, letting the batch
+// writer flush what is left and return. Handlers blocked on a full queue are
+// released first, since the batch writer may already have stopped reading.
+func (i *Ingestor) closeQueue() {
+	i.queueBudget.close()
+	i.queueMu.Lock()
+	defer i.queueMu.Unlock()
+	i.queueClosed = true
+	close(i.msgCh)
+}
+
+// dequeued releases the byte budget held by a reading taken off the queue
+func (i *Ingestor) dequeued(item queuedReading) {
+	i.queueBudget.release(item.size)
+	queueDepth.Set(float64(len(i.msgCh)))
+}
@@ -0,0 +1,313 @@
+package mqtingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+func newQueueTestIngestor(policy string, queueSize int, maxBytes int64) *Ingestor {
+	nop := zerolog.Nop()
+	return &Ingestor{
+		cfg:          mqtmodels.IngestorConfig{QueueOverflowPolicy: policy},
+		msgCh:        make(chan queuedReading, queueSize),
+		logger:       &logger.Logger{Logger: &nop},
+		queueBudget:  newByteBudget(maxBytes),
+		recentErrors: newErrorRing(16),
+		stats:        newIngestStats(),
+		piFailures:   newPiFailureTracker(16),
+		overflowErrs: newOverflowThrottle(),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Handlers publishing while Stop closes the queue must neither send on the
+// closed channel nor stay blocked on a full queue, and every byte they
+// reserved must be released. Run with -race.
+func TestEnqueueRacesStop(t *testing.T) {
+	for _, policy := range []string{OverflowBlock, OverflowDropNewest, OverflowDropOldest} {
+		for _, stalled := range []bool{false, true} {
+			name := policy + "/draining"
+			if stalled {
+				name = policy + "/stalled writer"
+			}
+			t.Run(name, func(t *testing.T) {
+				i := newQueueTestIngestor(policy, 4, 4*(readingOverhead+64))
+
+				// The batch writer drains until the queue closes, or stops
+				// reading early as when it has already shut down
+				writerDone := make(chan struct{})
+				go func() {
+					defer close(writerDone)
+					if stalled {
+						return
+					}
+					for item := range i.msgCh {
+						i.dequeued(item)
+					}
+				}()
+
+				const publishers = 8
+				var wg sync.WaitGroup
+				accepted := make([]int, publishers)
+				for p := 0; p < publishers; p++ {
+					wg.Add(1)
+					go func(p int) {
+						defer wg.Done()
+						for n := 0; ; n++ {
+							reading := ingest_models.ReadingEnvelope{PiID: fmt.Sprintf("pi-%d", p), DeviceID: "0", Topic: "sensors/pi/0/t"}
+							err := i.enqueue(reading, 64)
+							if errors.Is(err, errStopping) {
+								return
+							}
+							if err == nil {
+								accepted[p]++
+							} else if !errors.Is(err, errQueueFull) {
+								t.Errorf("enqueue returned %v", err)
+								return
+							}
+						}
+					}(p)
+				}
+
+				time.Sleep(20 * time.Millisecond)
+				if err := i.Stop(context.Background()); err != nil {
+					t.Fatalf("Stop: %v", err)
+				}
+
+				published := make(chan struct{})
+				go func() {
+					wg.Wait()
+					close(published)
+				}()
+				select {
+				case <-published:
+				case <-time.After(5 * time.Second):
+					t.Fatal("publishers still blocked after Stop")
+				}
+
+				if err := i.enqueue(ingest_models.ReadingEnvelope{PiID: "pi-late"}, 64); !errors.Is(err, errStopping) {
+					t.Errorf("enqueue after Stop returned %v, want errStopping", err)
+				}
+
+				<-writerDone
+				for item := range i.msgCh {
+					i.dequeued(item)
+				}
+				if used := i.queueBudget.inUse(); used != 0 {
+					t.Errorf("%d queue bytes still reserved", used)
+				}
+				total := 0
+				for _, n := range accepted {
+					total += n
+				}
+				if total == 0 {
+					t.Error("no reading was accepted before Stop")
+				}
+			})
+		}
+	}
+}
+
+func TestByteBudgetAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int64
+		used int64 // reserved before the acquire
+		size int64
+		want bool
+	}{
+		{name: "fills the budget exactly", max: 100, size: 100, want: true},
+		{name: "reaches the budget exactly", max: 100, used: 60, size: 40, want: true},
+		{name: "one byte over", max: 100, used: 60, size: 41, want: false},
+		{name: "full budget", max: 100, used: 100, size: 1, want: false},
+		{name: "oversize reading on an empty queue", max: 100, size: 150, want: true},
+		{name: "oversize reading behind others", max: 100, used: 1, size: 150, want: false},
+		{name: "budget disabled", max: 0, used: 1 << 40, size: 1 << 40, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newByteBudget(tt.max)
+			if tt.used > 0 && !b.acquire(tt.used, false) {
+				t.Fatalf("acquire(%d) on an empty budget failed", tt.used)
+			}
+			if got := b.acquire(tt.size, false); got != tt.want {
+				t.Fatalf("acquire(%d) with %d of %d used = %v, want %v", tt.size, tt.used, tt.max, got, tt.want)
+			}
+			want := tt.used
+			if tt.want {
+				want += tt.size
+			}
+			if used := b.inUse(); used != want {
+				t.Errorf("%d bytes in use, want %d", used, want)
+			}
+		})
+	}
+}
+
+// A waiting acquire gets its bytes once enough are released, and gives up
+// when the budget is closed
+func TestByteBudgetWait(t *testing.T) {
+	b := newByteBudget(100)
+	b.acquire(80, false)
+
+	acquired := make(chan bool)
+	go func() { acquired <- b.acquire(40, true) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire returned while the budget was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.release(20)
+	if !<-acquired {
+		t.Fatal("acquire failed after room was made")
+	}
+	if used := b.inUse(); used != 100 {
+		t.Errorf("%d bytes in use, want 100", used)
+	}
+
+	go func() { acquired <- b.acquire(1, true) }()
+	b.close()
+	if <-acquired {
+		t.Error("acquire succeeded after the budget was closed")
+	}
+}
+
+// queueTestReading is the nth reading offered to a test queue
+func queueTestReading(n int) ingest_models.ReadingEnvelope {
+	return ingest_models.ReadingEnvelope{PiID: "pi-1", DeviceID: "0", Topic: "sensors/pi-1/0/t", Payload: map[string]interface{}{"n": n}}
+}
+
+// queued drains the queue and returns the n of each reading in it, in order
+func queued(i *Ingestor) []int {
+	var ns []int
+	for {
+		select {
+		case item := <-i.msgCh:
+			i.dequeued(item)
+			ns = append(ns, item.reading.Payload["n"].(int))
+		default:
+			return ns
+		}
+	}
+}
+
+// Each policy once the queue is full, by reading count or by bytes: three
+// readings are offered to a queue with room for two
+func TestEnqueueOverflowPolicies(t *testing.T) {
+	const payloadBytes = 64
+	itemSize := int64(payloadBytes+len(queueTestReading(0).Topic)) + readingOverhead
+
+	limits := []struct {
+		name      string
+		queueSize int
+		maxBytes  int64
+	}{
+		{"count limit", 2, 0},
+		{"byte limit", 16, 2 * itemSize},
+	}
+	tests := []struct {
+		name        string
+		policy      string
+		spool       bool
+		spoolBytes  int64 // spool capacity; defaults to room for every reading
+		wantErr     error // of the third enqueue
+		wantQueued  []int
+		wantDropped uint64
+		wantSpooled int64
+	}{
+		{name: "drop_newest", policy: OverflowDropNewest, wantErr: errQueueFull, wantQueued: []int{0, 1}},
+		{name: "drop_oldest", policy: OverflowDropOldest, wantQueued: []int{1, 2}, wantDropped: 1},
+		{name: "spool", policy: OverflowSpool, spool: true, wantQueued: []int{0, 1}, wantSpooled: 1},
+		{name: "spool when full", policy: OverflowSpool, spool: true, spoolBytes: 1, wantErr: errQueueFull, wantQueued: []int{0, 1}},
+		{name: "spool disabled", policy: OverflowSpool, wantErr: errQueueFull, wantQueued: []int{0, 1}},
+	}
+	for _, limit := range limits {
+		for _, tt := range tests {
+			t.Run(limit.name+"/"+tt.name, func(t *testing.T) {
+				i := newQueueTestIngestor(tt.policy, limit.queueSize, limit.maxBytes)
+				if tt.spool {
+					spoolBytes := tt.spoolBytes
+					if spoolBytes == 0 {
+						spoolBytes = 1 << 20
+					}
+					s, err := openSpool(t.TempDir(), spoolBytes, spoolBytes)
+					if err != nil {
+						t.Fatalf("openSpool: %v", err)
+					}
+					t.Cleanup(s.close)
+					i.spool = s
+				}
+
+				for n := 0; n < 2; n++ {
+					if err := i.enqueue(queueTestReading(n), payloadBytes); err != nil {
+						t.Fatalf("enqueue %d: %v", n, err)
+					}
+				}
+				if err := i.enqueue(queueTestReading(2), payloadBytes); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("third enqueue returned %v, want %v", err, tt.wantErr)
+				}
+
+				if got := queued(i); fmt.Sprint(got) != fmt.Sprint(tt.wantQueued) {
+					t.Errorf("queued %v, want %v", got, tt.wantQueued)
+				}
+				if dropped := i.stats.queueDropped.Load(); dropped != tt.wantDropped {
+					t.Errorf("%d readings dropped from the queue, want %d", dropped, tt.wantDropped)
+				}
+				if i.spool != nil {
+					if spooled := i.spool.stats().Readings; spooled != tt.wantSpooled {
+						t.Errorf("%d readings spooled, want %d", spooled, tt.wantSpooled)
+					}
+				}
+				if used := i.queueBudget.inUse(); used != 0 {
+					t.Errorf("%d queue bytes still reserved", used)
+				}
+			})
+		}
+	}
+}
+
+// block holds the third reading until the batch writer makes room
+func TestEnqueueBlockPolicy(t *testing.T) {
+	for _, limit := range []struct {
+		name      string
+		queueSize int
+		maxBytes  int64
+	}{
+		{"count limit", 2, 0},
+		{"byte limit", 16, 2 * (64 + int64(len(queueTestReading(0).Topic)) + readingOverhead)},
+	} {
+		t.Run(limit.name, func(t *testing.T) {
+			i := newQueueTestIngestor(OverflowBlock, limit.queueSize, limit.maxBytes)
+			for n := 0; n < 2; n++ {
+				if err := i.enqueue(queueTestReading(n), 64); err != nil {
+					t.Fatalf("enqueue %d: %v", n, err)
+				}
+			}
+
+			done := make(chan error)
+			go func() { done <- i.enqueue(queueTestReading(2), 64) }()
+			select {
+			case err := <-done:
+				t.Fatalf("enqueue returned %v while the queue was full", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			i.dequeued(<-i.msgCh)
+			if err := <-done; err != nil {
+				t.Fatalf("enqueue after room was made: %v", err)
+			}
+			if got := queued(i); fmt.Sprint(got) != "[1 2]" {
+				t.Errorf("queued %v, want [1 2]", got)
+			}
+		})
+	}
+}
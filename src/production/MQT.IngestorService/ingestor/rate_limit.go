@@ -0,0 +1,166 @@
+package mqtingestor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// rateLimiterSweepMin is the Pi count at which the limiter first drops Pis
+// that have been idle long enough for their bucket to refill
+const rateLimiterSweepMin = 1024
+
+// rateLimitStatsPis is how many throttled Pis the health endpoint lists
+const rateLimitStatsPis = 20
+
+// RateLimitStats is a point-in-time view of per-Pi rate limiting, served on the
+// health endpoint
+type RateLimitStats struct {
+	Enabled       bool          `json:"enabled"`
+	MaxMsgsPerSec float64       `json:"max_msgs_per_sec,omitempty"`
+	TrackedPis    int           `json:"tracked_pis"`
+	ThrottledPis  []PiRateLimit `json:"throttled_pis,omitempty"` // most dropped first
+}
+
+// PiRateLimit counts one Pi's messages since it was last idle long enough to
+// be forgotten
+type PiRateLimit struct {
+	PiID          string    `json:"pi_id"`
+	Allowed       uint64    `json:"allowed"`
+	Dropped       uint64    `json:"dropped"`
+	LastDroppedAt time.Time `json:"last_dropped_at"`
+}
+
+type piBucket struct {
+	tokens        float64
+	updatedAt     time.Time
+	allowed       uint64
+	dropped       uint64
+	lastDroppedAt time.Time
+	notifiedAt    time.Time // last rate_limited error published
+	suppressed    int       // messages dropped since notifiedAt
+}
+
+// rateLimiter is a token bucket per Pi, holding up to one second of messages.
+// A Pi that goes quiet until its bucket is full and its notice cooldown has
+// passed is forgotten, so the map doesn't grow with every Pi ever seen.
+type rateLimiter struct {
+	rate     float64 // messages per second
+	burst    float64
+	cooldown time.Duration
+	idleTTL  time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*piBucket
+	sweepAt int
+}
+
+func newRateLimiter(rate float64, cooldown time.Duration) *rateLimiter {
+	burst := max(rate, 1)
+	refill := time.Duration(burst / rate * float64(time.Second))
+	return &rateLimiter{
+		rate:     rate,
+		burst:    burst,
+		cooldown: cooldown,
+		idleTTL:  max(refill, cooldown),
+		buckets:  make(map[string]*piBucket),
+		sweepAt:  rateLimiterSweepMin,
+	}
+}
+
+// allow takes a token for piID. When there is none it reports false, and
+// notify is how many messages a rate_limited error should cover now, or 0
+// while the Pi is within its cooldown.
+func (l *rateLimiter) allow(piID string, now time.Time) (ok bool, notify int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, found := l.buckets[piID]
+	if !found {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweep(now)
+		}
+		bucket = &piBucket{tokens: l.burst, updatedAt: now}
+		l.buckets[piID] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*l.rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.allowed++
+		return true, 0
+	}
+
+	bucket.dropped++
+	bucket.lastDroppedAt = now
+	bucket.suppressed++
+	if !bucket.notifiedAt.IsZero() && now.Sub(bucket.notifiedAt) < l.cooldown {
+		return false, 0
+	}
+	notify = bucket.suppressed
+	bucket.notifiedAt = now
+	bucket.suppressed = 0
+	return false, notify
+}
+
+// sweep forgets Pis idle for idleTTL. Callers hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for piID, bucket := range l.buckets {
+		if now.Sub(bucket.updatedAt) >= l.idleTTL {
+			delete(l.buckets, piID)
+		}
+	}
+	l.sweepAt = max(2*len(l.buckets), rateLimiterSweepMin)
+}
+
+func (l *rateLimiter) stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := RateLimitStats{Enabled: true, MaxMsgsPerSec: l.rate, TrackedPis: len(l.buckets)}
+	for piID, bucket := range l.buckets {
+		if bucket.dropped > 0 {
+			stats.ThrottledPis = append(stats.ThrottledPis, PiRateLimit{
+				PiID:          piID,
+				Allowed:       bucket.allowed,
+				Dropped:       bucket.dropped,
+				LastDroppedAt: bucket.lastDroppedAt,
+			})
+		}
+	}
+	sort.Slice(stats.ThrottledPis, func(a, b int) bool {
+		if stats.ThrottledPis[a].Dropped != stats.ThrottledPis[b].Dropped {
+			return stats.ThrottledPis[a].Dropped > stats.ThrottledPis[b].Dropped
+		}
+		return stats.ThrottledPis[a].PiID < stats.ThrottledPis[b].PiID
+	})
+	if len(stats.ThrottledPis) > rateLimitStatsPis {
+		stats.ThrottledPis = stats.ThrottledPis[:rateLimitStatsPis]
+	}
+	return stats
+}
+
+// rateLimited reports whether a message from topic's Pi is over its rate and
+// must be dropped. The first drop publishes a rate_limited error; later ones
+// are only counted until the cooldown has passed, when the next error covers
+// them all.
+func (i *Ingestor) rateLimited(sourceTopic string, topic ingest_models.SensorTopic) bool {
+	if i.rateLimiter == nil {
+		return false
+	}
+	ok, notify := i.rateLimiter.allow(topic.PiID, time.Now())
+	if ok {
+		return false
+	}
+
+	i.stats.recordFailed("rate_limited")
+	if notify > 0 {
+		i.logger.Logger.Warn().Str("pi_id", topic.PiID).Int("messages", notify).Float64("max_msgs_per_sec", i.cfg.MaxMsgsPerPiPerSec).Msg("Dropping messages: Pi is over its rate limit")
+		i.publishErrorCount(sourceTopic, topic.PiID, topic.DeviceID, "rate_limited", fmt.Sprintf("Pi is publishing more than %g messages per second; messages are being dropped", i.cfg.MaxMsgsPerPiPerSec), notify)
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package mqtingestor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// registrySnapshotTimeout bounds the snapshot Start fetches, which holds up
+// subscribing
+const registrySnapshotTimeout = 30 * time.Second
+
+// registryRefreshOverlap is how far before the previous fetch a refresh asks
+// from, to cover clock skew between the ingestor and the database and
+// registrations that committed late
+const registryRefreshOverlap = time.Minute
+
+// registryEnabled reports whether the validation cache is filled from the
+// registry snapshot; without a positive TTL nothing would be kept
+func (i *Ingestor) registryEnabled() bool {
+	return i.cfg.RegistrySnapshot && i.cfg.ValidationCacheTTL > 0
+}
+
+// loadRegistry fills the validation cache with the Pis and devices of the
+// API's registry snapshot, created since since unless it is nil, so readings
+// from them are not validated one API call at a time as traffic starts. Pages
+// are followed until the snapshot ends; the ones fetched before a failure stay
+// cached.
+func (i *Ingestor) loadRegistry(ctx context.Context, since *time.Time) error {
+	var cursor string
+	pis, devices := 0, 0
+	for {
+		page, err := i.apiClient.RegistrySnapshot(ctx, since, cursor)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, pi := range page.Pis {
+			i.validations.put(piCacheKey(pi.PiID), ingest_models.PiStatusOK, true, now)
+			for _, deviceID := range pi.DeviceIDs {
+				i.validations.put(deviceCacheKey(pi.PiID, strconv.Itoa(deviceID)), deviceStatusOK, true, now)
+			}
+			devices += len(pi.DeviceIDs)
+		}
+		pis += len(page.Pis)
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	i.logger.Logger.Info().Int("pis", pis).Int("devices", devices).Bool("full", since == nil).Msg("Loaded registry snapshot into the validation cache")
+	return nil
+}
+
+// primeRegistry loads the full registry snapshot for Start, returning when
+// the fetch began, or nil if it failed, and whether refreshes should follow.
+// They shouldn't for an API without the endpoint; after any other failure the
+// first refresh fetches it all.
+func (i *Ingestor) primeRegistry(ctx context.Context) (*time.Time, bool) {
+	startedAt := time.Now()
+	loadCtx, cancel := context.WithTimeout(ctx, registrySnapshotTimeout)
+	defer cancel()
+
+	err := i.loadRegistry(loadCtx, nil)
+	if errors.Is(err, client.ErrSnapshotUnsupported) {
+		i.logger.Logger.Info().Msg("API has no registry snapshot endpoint; Pis and devices are validated as readings arrive")
+		return nil, false
+	}
+	if err != nil {
+		i.logger.Logger.Warn().Err(err).Msg("Failed to load registry snapshot; Pis and devices are validated as readings arrive")
+		return nil, true
+	}
+	return &startedAt, true
+}
+
+// runRegistryRefresh fetches the Pis and devices registered since the last
+// successful fetch every RegistryRefreshInterval, so the cache learns about
+// them without a failed validation first. A failed refresh is retried from
+// the same point on the next tick.
+func (i *Ingestor) runRegistryRefresh(ctx context.Context, loadedAt *time.Time) {
+	ticker := time.NewTicker(i.cfg.RegistryRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.stopCh:
+			return
+		case <-ticker.C:
+			startedAt := time.Now()
+			var since *time.Time
+			if loadedAt != nil {
+				from := loadedAt.Add(-registryRefreshOverlap)
+				since = &from
+			}
+
+			loadCtx, cancel := context.WithTimeout(ctx, registrySnapshotTimeout)
+			err := i.loadRegistry(loadCtx, since)
+			cancel()
+			if errors.Is(err, client.ErrSnapshotUnsupported) {
+				i.logger.Logger.Info().Msg("API no longer has a registry snapshot endpoint; registry refreshes stopped")
+				return
+			}
+			if err != nil {
+				i.logger.Logger.Warn().Err(err).Msg("Failed to refresh registry snapshot")
+				continue
+			}
+			loadedAt = &startedAt
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package mqtingestor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// Spool file names sort in the order they were created
+const (
+	spoolFilePrefix = "spool-"
+	spoolFileSuffix = ".ndjson"
+)
+
+// SpoolStats is a point-in-time view of the dead-letter spool, served on the
+// health endpoint
+type SpoolStats struct {
+	Enabled  bool   `json:"enabled"`
+	Readings int64  `json:"readings"` // readings waiting to be replayed
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"max_bytes"`
+	Files    int    `json:"files"`
+	Spooled  uint64 `json:"spooled"`  // readings written to the spool since startup
+	Replayed uint64 `json:"replayed"` // readings taken back out for another attempt
+	Dropped  uint64 `json:"dropped"`  // readings refused because the spool was full
+}
+
+// spool is a directory of NDJSON files holding readings the API couldn't be
+// reached for. Readings are appended to the newest file, which is rotated once
+// it reaches fileMaxBytes; replay works through the older files, oldest first.
+// The files of every rotation together may not exceed maxBytes, so a long
+// outage can't fill the disk: past that, readings are dropped.
+type spool struct {
+	dir          string
+	maxBytes     int64
+	fileMaxBytes int64
+
+	mu         sync.Mutex
+	active     *os.File // nil until the next append
+	activeName string
+	activeSize int64
+	files      map[string]int64 // size of every spool file, the active one included
+	bytes      int64
+	readings   int64
+	seq        uint64
+
+	spooled  atomic.Uint64
+	replayed atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// openSpool opens the spool in dir, creating it if needed. Files left by an
+// earlier run are kept for replay.
+func openSpool(dir string, maxBytes, fileMaxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	s := &spool{dir: dir, maxBytes: maxBytes, fileMaxBytes: fileMaxBytes, files: make(map[string]int64)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, spoolFilePrefix) || !strings.HasSuffix(name, spoolFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool file %s: %w", name, err)
+		}
+		s.files[name] = int64(len(data))
+		s.bytes += int64(len(data))
+		s.readings += int64(bytes.Count(data, []byte{'\n'}))
+	}
+	s.updateGauges()
+	return s, nil
+}
+
+// append writes readings to the spool and returns how many were written. It
+// stops at the first reading that would take the spool past maxBytes.
+func (s *spool) append(readings []ingest_models.ReadingEnvelope) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.updateGauges()
+
+	for n, reading := range readings {
+		line, err := json.Marshal(reading)
+		if err != nil {
+			return n, fmt.Errorf("failed to encode reading: %w", err)
+		}
+		line = append(line, '\n')
+		size := int64(len(line))
+
+		if s.bytes+size > s.maxBytes {
+			s.dropped.Add(uint64(len(readings) - n))
+			return n, nil
+		}
+		if s.active != nil && s.activeSize+size > s.fileMaxBytes {
+			s.rotate()
+		}
+		if s.active == nil {
+			if err := s.create(); err != nil {
+				return n, err
+			}
+		}
+
+		if _, err := s.active.Write(line); err != nil {
+			return n, fmt.Errorf("failed to write spool file: %w", err)
+		}
+		s.activeSize += size
+		s.files[s.activeName] = s.activeSize
+		s.bytes += size
+		s.readings++
+		s.spooled.Add(1)
+	}
+	return len(readings), nil
+}
+
+// create starts a new active file. Callers hold s.mu.
+func (s *spool) create() error {
+	s.seq++
+	name := fmt.Sprintf("%s%020d-%06d%s", spoolFilePrefix, time.Now().UnixNano(), s.seq, spoolFileSuffix)
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	s.active, s.activeName, s.activeSize = f, name, 0
+	s.files[name] = 0
+	return nil
+}
+
+// rotate closes the active file so replay can take it. Callers hold s.mu.
+func (s *spool) rotate() {
+	if s.active == nil {
+		return
+	}
+	s.active.Close()
+	s.active, s.activeName, s.activeSize = nil, "", 0
+}
+
+// next returns the oldest file ready for replay. The active file is rotated
+// when it is the only one left, so readings don't wait for it to fill.
+func (s *spool) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		if name != s.activeName {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 && s.activeSize > 0 {
+		names = append(names, s.activeName)
+		s.rotate()
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+	return names[0], true
+}
+
+// read takes up to limit readings from file name, starting at byte offset,
+// and returns them with the offset following the last one. Lines that don't
+// decode are skipped, as is a partial last line left by a crash mid-write.
+func (s *spool) read(name string, offset int64, limit int) ([]ingest_models.ReadingEnvelope, int64, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var readings []ingest_models.ReadingEnvelope
+	lines := 0
+	reader := bufio.NewReader(f)
+	for len(readings) < limit {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, offset, err
+		}
+		offset += int64(len(line))
+		lines++
+
+		var reading ingest_models.ReadingEnvelope
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&reading); err != nil {
+			continue
+		}
+		readings = append(readings, reading)
+	}
+
+	s.mu.Lock()
+	s.readings -= int64(lines)
+	s.updateGauges()
+	s.mu.Unlock()
+	s.replayed.Add(uint64(len(readings)))
+	return readings, offset, nil
+}
+
+// remove deletes a file whose readings have all been replayed
+func (s *spool) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.updateGauges()
+
+	s.bytes -= s.files[name]
+	delete(s.files, name)
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// truncate drops the first offset bytes of a file, which have been replayed,
+// when replay stops partway through it
+func (s *spool) truncate(name string, offset int64) error {
+	path := filepath.Join(s.dir, name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.updateGauges()
+
+	size := s.files[name]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data[offset:], 0o640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.files[name] = size - offset
+	s.bytes -= offset
+	return nil
+}
+
+// close closes the active file; the spool stays on disk for the next run
+func (s *spool) close() {
+	s.mu.Lock()
+	s.rotate()
+	s.mu.Unlock()
+}
+
+// updateGauges publishes the spool depth. Callers hold s.mu.
+func (s *spool) updateGauges() {
+	spoolBytes.Set(float64(s.bytes))
+	spoolReadings.Set(float64(s.readings))
+}
+
+func (s *spool) stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpoolStats{
+		Enabled:  true,
+		Readings: s.readings,
+		Bytes:    s.bytes,
+		MaxBytes: s.maxBytes,
+		Files:    len(s.files),
+		Spooled:  s.spooled.Load(),
+		Replayed: s.replayed.Load(),
+		Dropped:  s.dropped.Load(),
+	}
+}
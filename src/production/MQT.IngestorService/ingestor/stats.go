@@ -0,0 +1,186 @@
+package mqtingestor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point-in-time view of the batch writer, served on the health endpoint
+type Stats struct {
+	MessagesReceived  uint64               `json:"messages_received"`
+	RetainedIgnored   uint64               `json:"messages_retained_ignored"`
+	ReadingsInserted  uint64               `json:"readings_inserted"`
+	ReadingsDryRun    uint64               `json:"readings_would_insert,omitempty"` // validated but not written in dry-run mode
+	ReadingsFailed    map[string]uint64    `json:"readings_failed"`
+	ReadingsDuplicate uint64               `json:"readings_duplicate"` // dropped by the dedup filter
+	Workers           int                  `json:"workers"`
+	QueueDepth        int                  `json:"queue_depth"`
+	QueueCapacity     int                  `json:"queue_capacity"`
+	QueueBytes        int64                `json:"queue_bytes"`
+	QueueMaxBytes     int64                `json:"queue_max_bytes"`
+	QueuePolicy       string               `json:"queue_overflow_policy"`
+	QueueDropped      uint64               `json:"queue_dropped"` // readings dropped by the overflow policy
+	LastFlushAt       *time.Time           `json:"last_flush_at,omitempty"`
+	LastFlushDuration string               `json:"last_flush_duration,omitempty"`
+	ValidationCache   ValidationCacheStats `json:"validation_cache"`
+	Spool             SpoolStats           `json:"spool"`
+	RateLimit         RateLimitStats       `json:"rate_limit"`
+}
+
+// ingestStats mirrors the Prometheus counters so Stats() can report them without
+// scraping the registry
+type ingestStats struct {
+	messagesReceived atomic.Uint64
+	retainedIgnored  atomic.Uint64
+	readingsInserted atomic.Uint64
+	readingsDryRun   atomic.Uint64
+	queueDropped     atomic.Uint64
+	readingsSpooled  atomic.Uint64
+	readingsDup      atomic.Uint64
+	readingsFlushed  atomic.Uint64
+	lastMessageAt    atomic.Int64 // unix nanoseconds; 0 until the first message
+	lastInsertAt     atomic.Int64 // unix nanoseconds; 0 until the first reading is written
+
+	mu                sync.Mutex
+	readingsFailed    map[string]uint64
+	lastFlushAt       time.Time
+	lastFlushDuration time.Duration
+	startedAt         time.Time
+}
+
+func newIngestStats() *ingestStats {
+	return &ingestStats{readingsFailed: make(map[string]uint64), startedAt: time.Now()}
+}
+
+// processed returns how many readings the batch writer has finished with, by
+// writing, dropping, spooling, deduplicating or (in dry-run mode) skipping them
+func (s *ingestStats) processed() uint64 {
+	total := s.readingsInserted.Load() + s.readingsDryRun.Load() + s.readingsSpooled.Load() + s.readingsDup.Load()
+	s.mu.Lock()
+	for _, count := range s.readingsFailed {
+		total += count
+	}
+	s.mu.Unlock()
+	return total
+}
+
+// sinceLastFlush returns the time since the batch writer last flushed, or
+// since startup if it hasn't yet
+func (s *ingestStats) sinceLastFlush() time.Duration {
+	s.mu.Lock()
+	last := s.lastFlushAt
+	s.mu.Unlock()
+	if last.IsZero() {
+		last = s.startedAt
+	}
+	return time.Since(last)
+}
+
+func (s *ingestStats) recordReceived() {
+	s.messagesReceived.Add(1)
+	s.lastMessageAt.Store(time.Now().UnixNano())
+	messagesReceivedTotal.Inc()
+}
+
+func (s *ingestStats) recordRetainedIgnored() {
+	s.retainedIgnored.Add(1)
+}
+
+func (s *ingestStats) recordInserted() {
+	s.readingsInserted.Add(1)
+	s.lastInsertAt.Store(time.Now().UnixNano())
+	readingsInsertedTotal.Inc()
+}
+
+func (s *ingestStats) recordWouldInsert() {
+	s.readingsDryRun.Add(1)
+	readingsWouldInsertTotal.Inc()
+}
+
+func (s *ingestStats) recordDropped(n int) {
+	s.queueDropped.Add(uint64(n))
+}
+
+func (s *ingestStats) recordDuplicate() {
+	s.readingsDup.Add(1)
+	readingsDuplicateTotal.Inc()
+}
+
+func (s *ingestStats) recordSpooled(n int) {
+	s.readingsSpooled.Add(uint64(n))
+}
+
+func (s *ingestStats) recordFailed(errorType string) {
+	s.recordFailedN(errorType, 1)
+}
+
+func (s *ingestStats) recordFailedN(errorType string, n int) {
+	s.mu.Lock()
+	s.readingsFailed[errorType] += uint64(n)
+	s.mu.Unlock()
+	readingsFailedTotal.WithLabelValues(errorType).Add(float64(n))
+}
+
+func (s *ingestStats) recordFlush(size int, start time.Time) {
+	elapsed := time.Since(start)
+	s.readingsFlushed.Add(uint64(size))
+	s.mu.Lock()
+	s.lastFlushAt = start
+	s.lastFlushDuration = elapsed
+	s.mu.Unlock()
+	batchFlushDuration.Observe(elapsed.Seconds())
+	batchFlushSize.Observe(float64(size))
+}
+
+// Stats returns the batch writer counters and current queue depth
+func (i *Ingestor) Stats() Stats {
+	i.stats.mu.Lock()
+	failed := make(map[string]uint64, len(i.stats.readingsFailed))
+	for errorType, count := range i.stats.readingsFailed {
+		failed[errorType] = count
+	}
+	lastFlushAt := i.stats.lastFlushAt
+	lastFlushDuration := i.stats.lastFlushDuration
+	i.stats.mu.Unlock()
+
+	stats := Stats{
+		MessagesReceived:  i.stats.messagesReceived.Load(),
+		RetainedIgnored:   i.stats.retainedIgnored.Load(),
+		ReadingsInserted:  i.stats.readingsInserted.Load(),
+		ReadingsDryRun:    i.stats.readingsDryRun.Load(),
+		ReadingsFailed:    failed,
+		ReadingsDuplicate: i.stats.readingsDup.Load(),
+		Workers:           i.cfg.Workers,
+		QueueDepth:        len(i.msgCh),
+		QueueCapacity:     cap(i.msgCh),
+		QueueBytes:        i.queueBudget.inUse(),
+		QueueMaxBytes:     i.cfg.QueueMaxBytes,
+		QueuePolicy:       i.cfg.QueueOverflowPolicy,
+		QueueDropped:      i.stats.queueDropped.Load(),
+		ValidationCache:   i.validations.stats(),
+	}
+	if i.spool != nil {
+		stats.Spool = i.spool.stats()
+	}
+	if i.rateLimiter != nil {
+		stats.RateLimit = i.rateLimiter.stats()
+	}
+	if !lastFlushAt.IsZero() {
+		stats.LastFlushAt = &lastFlushAt
+		stats.LastFlushDuration = lastFlushDuration.String()
+	}
+	return stats
+}
+
+// IsQueueSaturated reports whether the queue is at or above the configured
+// degraded threshold
+func (i *Ingestor) IsQueueSaturated() bool {
+	if i.cfg.QueueDegradedPercent <= 0 || cap(i.msgCh) == 0 {
+		return false
+	}
+	if i.cfg.QueueMaxBytes > 0 && i.queueBudget.inUse()*100 >= i.cfg.QueueMaxBytes*int64(i.cfg.QueueDegradedPercent) {
+		return true
+	}
+	return len(i.msgCh)*100 >= cap(i.msgCh)*i.cfg.QueueDegradedPercent
+}
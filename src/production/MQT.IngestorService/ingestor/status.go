@@ -0,0 +1,77 @@
+package mqtingestor
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// statusQoS is the QoS of status messages, including the Last Will
+const statusQoS = 1
+
+// statusPublishTimeout bounds the wait for a status publish to be acknowledged
+const statusPublishTimeout = 5 * time.Second
+
+// statusTopic renders the configured status topic template for this client
+func (i *Ingestor) statusTopic() string {
+	return strings.NewReplacer("{client_id}", i.cfg.ClientID, "{instance_id}", i.cfg.InstanceID).Replace(i.cfg.StatusTopicTemplate)
+}
+
+// setWill registers the retained offline status as the connection's Last
+// Will, which the broker publishes if the ingestor disappears without
+// disconnecting
+func (i *Ingestor) setWill(opts *mqtt.ClientOptions) {
+	if !i.cfg.StatusEnabled {
+		return
+	}
+	payload, err := json.Marshal(ingest_models.IngestorStatus{
+		Status:     ingest_models.IngestorStatusOffline,
+		ClientID:   i.cfg.ClientID,
+		InstanceID: i.cfg.InstanceID,
+	})
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Msg("Failed to marshal Last Will status")
+		return
+	}
+	opts.SetBinaryWill(i.statusTopic(), payload, statusQoS, true)
+}
+
+// publishStatus publishes status retained on the status topic and waits for
+// the broker to acknowledge it
+func (i *Ingestor) publishStatus(status string) {
+	if !i.cfg.StatusEnabled || i.mqttClient == nil || !i.mqttClient.IsConnected() {
+		return
+	}
+
+	now := time.Now().UTC()
+	message := ingest_models.IngestorStatus{
+		Status:     status,
+		ClientID:   i.cfg.ClientID,
+		InstanceID: i.cfg.InstanceID,
+		Timestamp:  &now,
+	}
+	if status == ingest_models.IngestorStatusOnline {
+		startedAt := i.startedAt
+		message.StartedAt = &startedAt
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		i.logger.Logger.Error().Err(err).Msg("Failed to marshal ingestor status")
+		return
+	}
+
+	topic := i.statusTopic()
+	token := i.mqttClient.Publish(topic, statusQoS, true, payload)
+	if !token.WaitTimeout(statusPublishTimeout) {
+		i.logger.Logger.Warn().Str("topic", topic).Str("status", status).Msg("Timed out publishing ingestor status")
+		return
+	}
+	if err := token.Error(); err != nil {
+		i.logger.Logger.Warn().Err(err).Str("topic", topic).Str("status", status).Msg("Failed to publish ingestor status")
+		return
+	}
+	i.logger.Logger.Debug().Str("topic", topic).Str("status", status).Msg("Published ingestor status")
+}
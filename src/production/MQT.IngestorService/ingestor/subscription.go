@@ -0,0 +1,160 @@
+package mqtingestor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// Subscription retry backoff; doubled after each failure up to the max
+const (
+	subscribeRetryInitial = time.Second
+	subscribeRetryMax     = time.Minute
+	subscribeTimeout      = 10 * time.Second
+)
+
+// subackFailure is the SUBACK return code for a rejected subscription (e.g. ACL denied)
+const subackFailure = 0x80
+
+// IsSubscribed reports whether the topic subscriptions are active. It turns true
+// once the broker acknowledges all of them and false when the connection drops.
+func (i *Ingestor) IsSubscribed() bool {
+	return i.subscribed.Load()
+}
+
+// onConnect starts subscribing, and publishes the online status, in the
+// background so paho's connect handler isn't blocked by retries. Each connection gets a new generation; retries for an older
+// connection give up.
+func (i *Ingestor) onConnect(c mqtt.Client) {
+	if i.brokers != nil {
+		i.logger.Logger.Info().Str("broker", i.brokers.markConnected()).Msg("Connected to MQTT broker")
+	}
+	gen := i.subscribeGen.Add(1)
+	go i.subscribeWithRetry(c, gen)
+	go i.publishStatus(ingest_models.IngestorStatusOnline)
+}
+
+// onConnectionLost clears the subscription state; onConnect subscribes again after reconnecting
+func (i *Ingestor) onConnectionLost(_ mqtt.Client, err error) {
+	i.subscribed.Store(false)
+	broker := ""
+	if i.brokers != nil {
+		broker = i.brokers.current()
+		i.brokers.markDisconnected()
+	}
+	i.logger.Logger.Error().Err(err).Str("broker", broker).Msg("MQTT connection lost")
+}
+
+// subscription is a topic filter the ingestor consumes and its message handler
+type subscription struct {
+	topic   string
+	handler mqtt.MessageHandler
+}
+
+// subscriptions returns a readings subscription for each topic filter, those
+// of MQTT_TOPIC until a resubscribe command replaces them, and, when enabled,
+// the device discovery, control and cache invalidation ones. All but the
+// control and invalidation subscriptions, which every replica needs for
+// itself, join the shared group if configured.
+func (i *Ingestor) subscriptions() []subscription {
+	var subs []subscription
+	for _, topic := range i.settings().topics {
+		subs = append(subs, subscription{topic: i.sharedTopic(topic), handler: i.onMessage})
+	}
+	if i.cfg.DiscoveryEnabled && i.cfg.DiscoveryTopic != "" {
+		subs = append(subs, subscription{topic: i.sharedTopic(i.cfg.DiscoveryTopic), handler: i.onDiscovery})
+	}
+	if i.controlEnabled() {
+		subs = append(subs, subscription{topic: i.controlTopic(), handler: i.onControl})
+	}
+	if i.cacheInvalidationEnabled() {
+		subs = append(subs, subscription{topic: i.cfg.CacheInvalidationTopic, handler: i.onCacheInvalidation})
+	}
+	return subs
+}
+
+// subscriptionTopics returns the topic filter of every subscription
+func (i *Ingestor) subscriptionTopics() []string {
+	return topicsOf(i.subscriptions())
+}
+
+func topicsOf(subs []subscription) []string {
+	topics := make([]string, len(subs))
+	for n, sub := range subs {
+		topics[n] = sub.topic
+	}
+	return topics
+}
+
+// subscribeWithRetry subscribes to every topic, retrying those that fail until
+// each one is acknowledged. A filter the broker refuses doesn't hold up the
+// others: they are subscribed, and deliver readings, while it is retried.
+// IsSubscribed turns true once all of them are acknowledged.
+func (i *Ingestor) subscribeWithRetry(c mqtt.Client, gen uint64) {
+	pending := i.subscriptions()
+	backoff := subscribeRetryInitial
+
+	for attempt := 1; ; attempt++ {
+		if i.subscribeGen.Load() != gen || !c.IsConnectionOpen() {
+			return
+		}
+
+		i.logger.Logger.Info().Strs("topics", topicsOf(pending)).Int("attempt", attempt).Msg("MQTT connected, subscribing to topics")
+		var failed []subscription
+		for _, sub := range pending {
+			if err := subscribeOnce(c, sub.topic, i.cfg.QoS, sub.handler); err != nil {
+				i.logger.Logger.Error().Err(err).Str("topic", sub.topic).Int("attempt", attempt).Msg("Failed to subscribe to MQTT topic")
+				failed = append(failed, sub)
+			}
+		}
+		if len(failed) == 0 {
+			topics := i.subscriptionTopics()
+			// Stop may have run while waiting for the SUBACK
+			if i.subscribeGen.Load() != gen {
+				c.Unsubscribe(topics...)
+				return
+			}
+			i.subscribed.Store(true)
+			i.logger.Logger.Info().Strs("topics", topics).Msg("Subscribed to MQTT topics")
+			return
+		}
+		pending = failed
+
+		i.logger.Logger.Error().Strs("topics", topicsOf(pending)).Int("attempt", attempt).Dur("retry_in", backoff).Msg("Retrying failed MQTT subscriptions")
+
+		select {
+		case <-i.stopCh:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > subscribeRetryMax {
+			backoff = subscribeRetryMax
+		}
+	}
+}
+
+// subscribeOnce subscribes at qos and waits for the SUBACK. paho reports a
+// broker rejection only through the granted QoS, so that is checked as well.
+func subscribeOnce(c mqtt.Client, topic string, qos byte, handler mqtt.MessageHandler) error {
+	token := c.Subscribe(topic, qos, handler)
+	if !token.WaitTimeout(subscribeTimeout) {
+		return errors.New("timed out waiting for SUBACK")
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+
+	if st, ok := token.(*mqtt.SubscribeToken); ok {
+		for filter, qos := range st.Result() {
+			if qos == subackFailure {
+				return fmt.Errorf("broker rejected subscription to %s", filter)
+			}
+		}
+	}
+	return nil
+}
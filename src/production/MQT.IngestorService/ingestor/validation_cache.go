@@ -0,0 +1,160 @@
+package mqtingestor
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// validationCacheSweepMin is the entry count at which the cache first sweeps
+// out expired entries; after a sweep the threshold doubles from what is left
+const validationCacheSweepMin = 1024
+
+// ValidationCacheStats is a point-in-time view of the validation cache, served
+// on the health endpoint
+type ValidationCacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+type validationEntry struct {
+	status  string
+	expires time.Time
+}
+
+// validationCache remembers Pi and device validation results so a steady
+// stream of readings doesn't cost API calls on every flush. Results that let
+// readings through are kept for ttl and failed ones for negativeTTL, so a Pi
+// that is registered after being refused is picked up quickly. Pis are keyed
+// by pi_id and devices by pi_id/device_id. Only answers from the API are
+// cached, never errors reaching it.
+type validationCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]validationEntry
+	sweepAt int
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newValidationCache(ttl, negativeTTL time.Duration) *validationCache {
+	return &validationCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]validationEntry),
+		sweepAt:     validationCacheSweepMin,
+	}
+}
+
+func piCacheKey(piID string) string {
+	return piID
+}
+
+func deviceCacheKey(piID, deviceID string) string {
+	return piID + "/" + deviceID
+}
+
+// get returns the cached status for key, if there is one that hasn't expired
+func (c *validationCache) get(key string, now time.Time) (string, bool) {
+	status, ok := c.lookup(key, now)
+	if !ok {
+		c.misses.Add(1)
+		validationCacheLookupsTotal.WithLabelValues("miss").Inc()
+		return "", false
+	}
+	c.hits.Add(1)
+	validationCacheLookupsTotal.WithLabelValues("hit").Inc()
+	return status, true
+}
+
+// lookup is get without counting a hit or miss, for looking ahead of the
+// lookup that decides
+func (c *validationCache) lookup(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.status, ok
+}
+
+// put caches status for key. positive says whether the status lets readings
+// through, which picks the TTL; a zero TTL leaves the result uncached.
+func (c *validationCache) put(key, status string, positive bool, now time.Time) {
+	ttl := c.negativeTTL
+	if positive {
+		ttl = c.ttl
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = validationEntry{status: status, expires: now.Add(ttl)}
+	if len(c.entries) >= c.sweepAt {
+		c.sweep(now)
+	}
+}
+
+// sweep drops expired entries; entries are otherwise only dropped when looked
+// up, so without it Pis that stop sending would stay cached forever. Callers
+// hold c.mu.
+func (c *validationCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.sweepAt = max(2*len(c.entries), validationCacheSweepMin)
+}
+
+// invalidateDevice forgets a device and its Pi, for when the API refuses a
+// reading because the device no longer exists. The Pi goes too since deleting
+// the Pi is the usual way its devices disappear.
+func (c *validationCache) invalidateDevice(piID, deviceID string) {
+	c.mu.Lock()
+	delete(c.entries, deviceCacheKey(piID, deviceID))
+	delete(c.entries, piCacheKey(piID))
+	c.mu.Unlock()
+}
+
+// invalidate forgets one entry
+func (c *validationCache) invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// invalidatePi forgets a Pi and every device of it
+func (c *validationCache) invalidatePi(piID string) {
+	prefix := deviceCacheKey(piID, "")
+	c.mu.Lock()
+	delete(c.entries, piCacheKey(piID))
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *validationCache) stats() ValidationCacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return ValidationCacheStats{
+		Enabled: c.ttl > 0 || c.negativeTTL > 0,
+		Entries: entries,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
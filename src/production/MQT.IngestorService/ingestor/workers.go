@@ -0,0 +1,78 @@
+package mqtingestor
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// flushWorkers validates and writes flushed readings on Workers goroutines, so
+// API latency no longer caps the ingestor at one call in flight. Readings are
+// partitioned by Pi, so every reading of a device goes through the same worker
+// in the order it arrived, and a Pi is still validated once per flush.
+type flushWorkers struct {
+	queues []chan []ingest_models.ReadingEnvelope
+}
+
+// startWorkers starts the flush workers. They exit once stop has been called
+// and their queued batches are processed, and are waited for with i.wg.
+func (i *Ingestor) startWorkers(ctx context.Context) *flushWorkers {
+	w := &flushWorkers{queues: make([]chan []ingest_models.ReadingEnvelope, i.cfg.Workers)}
+	for n := range w.queues {
+		queue := make(chan []ingest_models.ReadingEnvelope, 1)
+		w.queues[n] = queue
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.runWorker(ctx, queue)
+		}()
+	}
+	return w
+}
+
+// runWorker processes the batches handed to one worker, each with its own
+// liveness so workers never share one
+func (i *Ingestor) runWorker(ctx context.Context, queue <-chan []ingest_models.ReadingEnvelope) {
+	liveness := newLivenessBatch()
+	for batch := range queue {
+		start := time.Now()
+		i.processBatch(ctx, batch, liveness)
+		i.stats.recordFlush(len(batch), start)
+		i.logger.Logger.Info().Int("count", len(batch)).Msg("Successfully processed readings")
+	}
+}
+
+// dispatch hands batch to the workers, blocking while a worker is still busy
+// with its earlier batches so a slow API pushes back on the queue. batch may
+// be reused once dispatch returns.
+func (w *flushWorkers) dispatch(batch []ingest_models.ReadingEnvelope) {
+	parts := make([][]ingest_models.ReadingEnvelope, len(w.queues))
+	for _, reading := range batch {
+		n := w.partition(reading.PiID)
+		parts[n] = append(parts[n], reading)
+	}
+	for n, part := range parts {
+		if len(part) > 0 {
+			w.queues[n] <- part
+		}
+	}
+}
+
+// partition returns the worker that handles piID's readings
+func (w *flushWorkers) partition(piID string) int {
+	if len(w.queues) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(piID))
+	return int(h.Sum32() % uint32(len(w.queues)))
+}
+
+// stop lets the workers exit once they have processed what was dispatched
+func (w *flushWorkers) stop() {
+	for _, queue := range w.queues {
+		close(queue)
+	}
+}
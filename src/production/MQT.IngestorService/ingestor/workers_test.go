@@ -0,0 +1,129 @@
+package mqtingestor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	client "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// fakeIngestAPI answers the calls a flush makes as an API Service holding
+// every Pi and device would, after waiting latency on each, and counts the
+// readings written. Without batch it answers the batch endpoints 404, as API
+// Services from before them do.
+type fakeIngestAPI struct {
+	latency  time.Duration
+	noBatch  bool
+	inserted atomic.Int64
+}
+
+func (f *fakeIngestAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.latency)
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/internal/validate/batch", "/internal/readings/batch":
+		if f.noBatch {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	switch r.URL.Path {
+	case "/internal/validate/batch":
+		var req ingest_models.ValidateBatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		results := make([]ingest_models.ValidateResult, len(req.Items))
+		for n, item := range req.Items {
+			results[n] = ingest_models.ValidateResult{PiID: item.PiID, DeviceID: item.DeviceID, PiExists: true, PiStatus: ingest_models.PiStatusOK, DeviceExists: true}
+		}
+		json.NewEncoder(w).Encode(ingest_models.ValidateBatchResponse{Results: results})
+	case "/internal/readings/batch":
+		var req ingest_models.CreateReadingsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.inserted.Add(int64(len(req.Readings)))
+		json.NewEncoder(w).Encode(ingest_models.CreateReadingsResponse{Inserted: len(req.Readings)})
+	case "/internal/pis/validate":
+		json.NewEncoder(w).Encode(ingest_models.ValidatePiResponse{Exists: true, Status: ingest_models.PiStatusOK})
+	case "/internal/devices/validate":
+		json.NewEncoder(w).Encode(ingest_models.ValidateDeviceResponse{Exists: true})
+	case "/internal/readings":
+		f.inserted.Add(1)
+		json.NewEncoder(w).Encode(ingest_models.CreateReadingResponse{Success: true})
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+// newWorkerTestIngestor returns an ingestor with workers flush workers, over
+// a real API client calling api
+func newWorkerTestIngestor(tb testing.TB, api http.Handler, workers int) *Ingestor {
+	tb.Helper()
+	server := httptest.NewServer(api)
+	tb.Cleanup(server.Close)
+
+	cfg := *mqtmodels.NewIngestorConfig()
+	cfg.Workers = workers
+	cfg.ReportErrors = false
+	cfg.PublishErrors = false
+	nop := zerolog.Nop()
+	i, err := New(cfg, client.NewAPIClient(server.URL, "secret"), &logger.Logger{Logger: &nop})
+	if err != nil {
+		tb.Fatalf("New: %v", err)
+	}
+	return i
+}
+
+// Flushes through an API with injected latency, for each worker count. Each
+// worker has its own calls in flight, so when the API takes one reading per
+// call readings/s grows roughly with the workers until the Pis run out; with
+// the batch endpoints a flush costs each worker the same few calls whatever
+// its share, and readings/s should hold steady rather than drop.
+func BenchmarkFlushWorkers(b *testing.B) {
+	const pis, perPi = 16, 8
+	batch := make([]ingest_models.ReadingEnvelope, 0, pis*perPi)
+	now := time.Now()
+	for p := range pis {
+		for d := range perPi {
+			batch = append(batch, ingest_models.ReadingEnvelope{
+				PiID:       fmt.Sprintf("pi-%d", p),
+				DeviceID:   fmt.Sprint(d),
+				Payload:    map[string]interface{}{"t": 21.5},
+				Ts:         now,
+				ReceivedAt: now,
+			})
+		}
+	}
+
+	for _, mode := range []string{"batch", "per-reading"} {
+		for _, workers := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("api=%s/workers=%d", mode, workers), func(b *testing.B) {
+				api := &fakeIngestAPI{latency: time.Millisecond, noBatch: mode == "per-reading"}
+				i := newWorkerTestIngestor(b, api, workers)
+				w := i.startWorkers(context.Background())
+
+				b.ResetTimer()
+				for range b.N {
+					w.dispatch(batch)
+				}
+				w.stop()
+				i.wg.Wait()
+				b.StopTimer()
+
+				if got, want := api.inserted.Load(), int64(b.N*len(batch)); got != want {
+					b.Fatalf("API received %d readings, want %d", got, want)
+				}
+				b.ReportMetric(float64(b.N*len(batch))/b.Elapsed().Seconds(), "readings/s")
+			})
+		}
+	}
+}
@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
 	container "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Container"
 	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/client"
 	mqtingestor "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.IngestorService/ingestor"
+	mqtmodels "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models"
 )
 
 func main() {
@@ -20,29 +28,54 @@ func main() {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize container: %v", err))
 	}
-	defer ctr.Shutdown(context.Background())
 
 	logger := ctr.GetLogger()
-	logger.Info("Starting MQTT Ingestor Service")
+	build := buildinfo.Get()
+	logger.Logger.Info().Str("commit", build.Commit).Str("build_date", build.BuildDate).Msg("Starting MQTT Ingestor Service")
 
 	// Get configuration
 	config := ctr.GetConfig()
 
-	// Create API client
-	apiClient := client.NewAPIClient(config.ApiServiceURL, config.InternalAPISecret)
-
 	// Create MQTT ingestor configuration from environment
 	cfg := mqtingestor.LoadFromEnv()
 
+	// Create API client
+	apiClient := client.NewAPIClientWithConfig(config.ApiServiceURL, config.InternalAPISecret, mqtingestor.APIClientConfig(cfg))
+	if cfg.APITransport == client.TransportGRPC {
+		if err := apiClient.UseGRPC(cfg.APIGRPCAddr); err != nil {
+			logger.FatalWithError(err, "Invalid API_GRPC_ADDR")
+		}
+		logger.Logger.Info().Str("addr", cfg.APIGRPCAddr).Msg("Validating and writing readings over gRPC")
+	}
+
 	// Create and start MQTT ingestor
-	ing := mqtingestor.New(cfg, apiClient, logger)
+	ing, err := mqtingestor.New(cfg, apiClient, logger)
+	if err != nil {
+		logger.FatalWithError(err, "Invalid MQTT ingestor configuration")
+	}
 	if err := ing.Start(context.Background()); err != nil {
 		logger.FatalWithError(err, "Failed to start MQTT ingestor")
 	}
-	defer ing.Stop()
 
 	// Start health check server
-	go startHealthServer(ctr, ing, apiClient)
+	healthSrv := startHealthServer(ctr, ing, apiClient, cfg)
+
+	// Register shutdown steps; the container runs them in phase order
+	lifecycle := ctr.GetLifecycle()
+	lifecycle.OnShutdown(container.PhaseStopIngestion, "mqtt_ingestor", func(ctx context.Context) error {
+		return ing.Stop(ctx)
+	})
+	lifecycle.OnShutdown(container.PhaseStopHTTP, "health_server", func(ctx context.Context) error {
+		return healthSrv.Shutdown(ctx)
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "mqtt_client", func(ctx context.Context) error {
+		ing.Close()
+		return nil
+	})
+	lifecycle.OnShutdown(container.PhaseCloseClients, "api_client", func(ctx context.Context) error {
+		return apiClient.Close()
+	})
+	lifecycle.SetReady()
 
 	logger.Info("MQTT ingestor running... press Ctrl+C to stop")
 
@@ -52,19 +85,41 @@ func main() {
 	<-sig
 
 	logger.Info("Shutting down...")
+	ctr.Shutdown(context.Background())
 }
 
 // startHealthServer starts a simple HTTP server for health checks
-func startHealthServer(ctr *container.IngestorContainer, ing *mqtingestor.Ingestor, apiClient *client.APIClient) {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+func startHealthServer(ctr *container.IngestorContainer, ing *mqtingestor.Ingestor, apiClient *client.APIClient, cfg mqtmodels.IngestorConfig) *http.Server {
+	mux := http.NewServeMux()
+	lifecycle := ctr.GetLifecycle()
+
+	// requireDebugToken guards /debug/* when DEBUG_TOKEN is set
+	requireDebugToken := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if cfg.DebugToken != "" {
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.DebugToken)) != 1 {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		// Check MQTT connection
+		// Check MQTT connection and subscription
 		mqttStatus := "disconnected"
 		if ing.IsConnected() {
 			mqttStatus = "connected"
 		}
+		subscriptionStatus := "unsubscribed"
+		if ing.IsSubscribed() {
+			subscriptionStatus = "subscribed"
+		}
 
 		// Check API service connection
 		apiStatus := "disconnected"
@@ -73,13 +128,20 @@ func startHealthServer(ctr *container.IngestorContainer, ing *mqtingestor.Ingest
 		}
 
 		// Return health status
+		// Connected but unable to keep up counts as degraded, not unhealthy
 		status := "healthy"
-		if mqttStatus != "connected" || apiStatus != "connected" {
+		if ing.IsQueueSaturated() {
+			status = "degraded"
+		}
+		if mqttStatus != "connected" || subscriptionStatus != "subscribed" || apiStatus != "connected" {
 			status = "unhealthy"
 		}
+		if !lifecycle.IsReady() {
+			status = "shutting_down"
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		if status == "healthy" {
+		if status == "healthy" || status == "degraded" {
 			w.WriteHeader(http.StatusOK)
 		} else {
 			w.WriteHeader(http.StatusServiceUnavailable)
@@ -88,26 +150,106 @@ func startHealthServer(ctr *container.IngestorContainer, ing *mqtingestor.Ingest
 		// Get circuit breaker status
 		circuitBreakerStatus := apiClient.GetCircuitBreakerStatus()
 
-		fmt.Fprintf(w, `{
-			"status": "%s",
-			"timestamp": "%s",
-			"services": {
-				"mqtt": "%s",
-				"api_service": "%s"
+		body := map[string]interface{}{
+			"status":    status,
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"build":     buildinfo.Get(),
+			"dry_run":   ing.DryRun(),
+			"client_id": ing.ClientID(),
+			"services": map[string]interface{}{
+				"mqtt":              mqttStatus,
+				"mqtt_broker":       ing.ConnectedBroker(),
+				"mqtt_brokers":      ing.Brokers(),
+				"mqtt_subscription": subscriptionStatus,
+				"api_service":       apiStatus,
 			},
-			"circuit_breaker": {
-				"state": "%s",
-				"failure_count": %d
-			}
-		}`, status, time.Now().UTC().Format(time.RFC3339), mqttStatus, apiStatus,
-			circuitBreakerStatus["state"], circuitBreakerStatus["failure_count"])
+			"circuit_breaker": map[string]interface{}{
+				"state":         circuitBreakerStatus["state"],
+				"failure_count": circuitBreakerStatus["failure_count"],
+				"next_probe_in": circuitBreakerStatus["next_probe_in"].(time.Duration).String(),
+			},
+			"stats":         ing.Stats(),
+			"recent_errors": ing.RecentErrors(),
+		}
+		if ing.DryRun() {
+			body["warning"] = "INGEST_DRY_RUN is enabled: readings are validated but not written"
+		}
+		json.NewEncoder(w).Encode(body)
+	})
+
+	// Operational detail: throughput, last activity and batching settings
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"ingestor":  ing.GetStatus(),
+		})
+	})
+
+	// Readiness: connected alone isn't enough, the subscription must be active too
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ready := lifecycle.IsReady() && ing.IsConnected() && ing.IsSubscribed()
+
+		w.Header().Set("Content-Type", "application/json")
+		if ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ready":      ready,
+			"connected":  ing.IsConnected(),
+			"broker":     ing.ConnectedBroker(),
+			"subscribed": ing.IsSubscribed(),
+			"dry_run":    ing.DryRun(),
+		})
 	})
 
+	// Per-Pi failure counters for troubleshooting individual devices
+	mux.HandleFunc("/debug/pis", requireDebugToken(func(w http.ResponseWriter, r *http.Request) {
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"pis":       ing.TopFailingPis(limit),
+		})
+	}))
+
+	// Effective configuration with secrets redacted
+	mux.HandleFunc("/debug/config", requireDebugToken(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"ingestor":  config.Redact(cfg),
+			"service":   config.Redact(ctr.GetConfig()),
+		})
+	}))
+
+	// Prometheus metrics
+	mux.Handle("/metrics", promhttp.Handler())
+
 	port := ctr.GetConfig().Server.Port
 	logger := ctr.GetLogger()
-	logger.Info("Health server starting on port " + port)
-
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		logger.FatalWithError(err, "Failed to start health server")
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: mux,
 	}
+
+	go func() {
+		logger.Info("Health server starting on port " + port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.FatalWithError(err, "Failed to start health server")
+		}
+	}()
+
+	return srv
 }
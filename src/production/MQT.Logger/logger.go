@@ -7,6 +7,7 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	buildinfo "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.BuildInfo"
 	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
 )
 
@@ -51,6 +52,9 @@ func NewLogger(cfg *config.LoggingConfig) *Logger {
 		log.Logger = log.Logger.With().Caller().Logger()
 	}
 
+	// Every line carries the build version, so logs from a rollout can be split by build
+	log.Logger = log.Logger.With().Str("version", buildinfo.Get().Version).Logger()
+
 	return &Logger{&log.Logger}
 }
 
@@ -0,0 +1,169 @@
+package api_models
+
+import (
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// Response DTOs for the hardware models. Their JSON field names are the API
+// contract: the hardware models may be reshaped freely, but renaming a field
+// here breaks clients and needs a deliberate, reviewed change. Controllers
+// return these rather than serializing hardware models directly.
+
+// PiResponse is a Pi as returned by the API
+type PiResponse struct {
+	PiID      string                 `json:"pi_id"`
+	UserID    string                 `json:"user_id"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// DeviceResponse is a device as returned by the API
+type DeviceResponse struct {
+	PiID       string                 `json:"pi_id"`
+	DeviceID   int                    `json:"device_id"`
+	DeviceType string                 `json:"device_type"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// DeviceWithLatestResponse is a device with its most recent reading, or null
+type DeviceWithLatestResponse struct {
+	DeviceResponse
+	Current *ReadingResponse `json:"current"`
+}
+
+// ReadingResponse is a reading as returned by the API. Ts and ReceivedAt are
+// RFC3339 UTC with the fixed precision set by SetTimestampPrecision.
+type ReadingResponse struct {
+	PiID       string                 `json:"pi_id"`
+	DeviceID   int                    `json:"device_id"`
+	Ts         string                 `json:"ts"`
+	Payload    map[string]interface{} `json:"payload"`
+	ReceivedAt *string                `json:"received_at,omitempty"`
+	Units      map[string]string      `json:"units,omitempty"`
+}
+
+// ReadingSummaryResponse is how many readings a device has and the span they
+// cover. Count is an estimate when Approximate is set; FirstTs and LastTs are
+// null when the device has no readings.
+type ReadingSummaryResponse struct {
+	PiID        string  `json:"pi_id"`
+	DeviceID    int     `json:"device_id"`
+	Count       int64   `json:"count"`
+	Approximate bool    `json:"approximate"`
+	FirstTs     *string `json:"first_ts"`
+	LastTs      *string `json:"last_ts"`
+}
+
+// ListResponse is an unpaginated list. Items is never null.
+type ListResponse[T any] struct {
+	Items []T `json:"items"`
+}
+
+// PageResponse is one page of a page-numbered list. Items is never null.
+type PageResponse[T any] struct {
+	Items    []T  `json:"items"`
+	NextPage *int `json:"next_page,omitempty"`
+	Total    *int `json:"total,omitempty"` // only with include_total=true
+}
+
+// ReadingPageResponse is one page of readings, continued with NextPageToken.
+// Sample is the sampling factor applied, when one was asked for. Query echoes
+// how the server interpreted the request.
+type ReadingPageResponse struct {
+	Items         []ReadingResponse `json:"items"`
+	NextPageToken *string           `json:"next_page_token,omitempty"`
+	Total         *int              `json:"total,omitempty"` // only with include_total=true
+	Sample        int               `json:"sample,omitempty"`
+	Query         *ReadingQueryEcho `json:"query,omitempty"`
+}
+
+// Reading orders reported in ReadingQueryEcho
+const (
+	ReadingOrderNewestFirst = "ts_desc"
+	ReadingOrderOldestFirst = "ts_asc"       // incremental sync: ts, then device_id
+	ReadingOrderArrival     = "received_asc" // sync by arrival: received_at, then device_id and ts
+)
+
+// ReadingQueryEcho is the query a reading page was selected with, after
+// parsing and defaults, so clients can see why a range came back empty. From,
+// To, Since and ReceivedSince are UTC and null when not applied; the range is
+// [from, to) unless ToInclusive is set.
+type ReadingQueryEcho struct {
+	PiID          string  `json:"pi_id"`
+	DeviceID      *int    `json:"device_id"`
+	From          *string `json:"from"`
+	To            *string `json:"to"`
+	ToInclusive   bool    `json:"to_inclusive"`
+	Since         *string `json:"since,omitempty"`
+	ReceivedSince *string `json:"received_since,omitempty"`
+	Cursor        bool    `json:"cursor"`
+	Limit         int     `json:"limit"`
+	Page          int     `json:"page,omitempty"`
+	Order         string  `json:"order"`
+	Sample        int     `json:"sample,omitempty"`
+}
+
+// NewPiResponse maps a Pi to its response
+func NewPiResponse(pi hardware_models.Pi) PiResponse {
+	return PiResponse{
+		PiID:      pi.PiID,
+		UserID:    pi.UserID,
+		Meta:      pi.Meta,
+		CreatedAt: pi.CreatedAt,
+	}
+}
+
+// NewDeviceResponse maps a device to its response
+func NewDeviceResponse(device hardware_models.Device) DeviceResponse {
+	return DeviceResponse{
+		PiID:       device.PiID,
+		DeviceID:   device.DeviceID,
+		DeviceType: device.DeviceType,
+		Meta:       device.Meta,
+		CreatedAt:  device.CreatedAt,
+	}
+}
+
+// NewDeviceWithLatestResponse maps a device and its latest reading to a response
+func NewDeviceWithLatestResponse(device hardware_models.DeviceWithLatest) DeviceWithLatestResponse {
+	response := DeviceWithLatestResponse{DeviceResponse: NewDeviceResponse(device.Device)}
+	if device.Current != nil {
+		current := NewReadingResponse(*device.Current)
+		response.Current = &current
+	}
+	return response
+}
+
+// NewReadingResponse maps a reading to its response
+func NewReadingResponse(reading hardware_models.Reading) ReadingResponse {
+	return ReadingResponse{
+		PiID:       reading.PiID,
+		DeviceID:   reading.DeviceID,
+		Ts:         hardware_models.FormatTimestamp(reading.Ts),
+		Payload:    reading.Payload,
+		ReceivedAt: FormatOptionalTimestamp(reading.ReceivedAt),
+		Units:      reading.Units,
+	}
+}
+
+// FormatOptionalTimestamp formats t with FormatTimestamp, or returns nil
+func FormatOptionalTimestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := hardware_models.FormatTimestamp(*t)
+	return &formatted
+}
+
+// MapItems maps every item with mapper, returning an empty slice rather than
+// nil so lists serialize as [] instead of null
+func MapItems[M any, T any](items []M, mapper func(M) T) []T {
+	mapped := make([]T, len(items))
+	for i, item := range items {
+		mapped[i] = mapper(item)
+	}
+	return mapped
+}
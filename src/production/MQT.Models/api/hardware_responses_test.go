@@ -0,0 +1,94 @@
+package api_models
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The responses are compared with testdata as decoded JSON, so key order and
+// whitespace don't matter but a renamed, added or removed field, a changed
+// type, or null where a field used to be omitted fails the test. A failure
+// means the API contract changed: update the golden file with -update only
+// once that is intended, and say so in the changelog.
+func TestHardwareResponsesGolden(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	ts := time.Date(2024, 3, 1, 14, 0, 0, 123456789, time.FixedZone("EET", 7200))
+	receivedAt := ts.Add(2 * time.Second)
+	pi := hardware_models.Pi{PiID: "pi-1", UserID: "user-1", Meta: map[string]interface{}{"site": "greenhouse"}, CreatedAt: created}
+	device := hardware_models.Device{PiID: "pi-1", DeviceID: 0, DeviceType: "temperature", Meta: map[string]interface{}{"floor": 2.0}, CreatedAt: created}
+	reading := hardware_models.Reading{PiID: "pi-1", DeviceID: 0, Ts: ts, Payload: map[string]interface{}{"t": 21.5, "h": 40.0}, ReceivedAt: &receivedAt}
+	converted := reading
+	converted.Payload = map[string]interface{}{"t": 70.7}
+	converted.Units = map[string]string{"t": "°F"}
+	first, last := hardware_models.FormatTimestamp(created), hardware_models.FormatTimestamp(ts)
+	nextPage, total, token := 2, 41, "eyJ0cyI6MX0"
+	deviceID := 0
+	from, to := FormatOptionalTimestamp(&created), FormatOptionalTimestamp(&ts)
+
+	tests := []struct {
+		file     string
+		response interface{}
+	}{
+		{file: "pi.json", response: NewPiResponse(pi)},
+		{file: "pi_without_meta.json", response: NewPiResponse(hardware_models.Pi{PiID: "pi-2", CreatedAt: created})},
+		{file: "device.json", response: NewDeviceResponse(device)},
+		{file: "device_with_latest.json", response: NewDeviceWithLatestResponse(hardware_models.DeviceWithLatest{Device: device, Current: &reading})},
+		{file: "device_without_readings.json", response: NewDeviceWithLatestResponse(hardware_models.DeviceWithLatest{Device: device})},
+		{file: "reading.json", response: NewReadingResponse(reading)},
+		{file: "reading_converted.json", response: NewReadingResponse(converted)},
+		{file: "reading_summary.json", response: ReadingSummaryResponse{PiID: "pi-1", DeviceID: 0, Count: 1200, Approximate: true, FirstTs: &first, LastTs: &last}},
+		{file: "reading_summary_empty.json", response: ReadingSummaryResponse{PiID: "pi-1", DeviceID: 0}},
+		{file: "pi_list.json", response: ListResponse[PiResponse]{Items: MapItems([]hardware_models.Pi{pi}, NewPiResponse)}},
+		{file: "device_list_empty.json", response: ListResponse[DeviceResponse]{Items: MapItems(nil, NewDeviceResponse)}},
+		{file: "device_page.json", response: PageResponse[DeviceResponse]{Items: MapItems([]hardware_models.Device{device}, NewDeviceResponse), NextPage: &nextPage, Total: &total}},
+		{file: "reading_page.json", response: ReadingPageResponse{
+			Items:         MapItems([]hardware_models.Reading{reading}, NewReadingResponse),
+			NextPageToken: &token,
+			Total:         &total,
+			Sample:        10,
+			Query:         &ReadingQueryEcho{PiID: "pi-1", DeviceID: &deviceID, From: from, To: to, Since: to, ReceivedSince: from, Cursor: true, Limit: 100, Page: 2, Order: ReadingOrderOldestFirst, Sample: 10},
+		}},
+		{file: "reading_page_last.json", response: ReadingPageResponse{
+			Items: MapItems(nil, NewReadingResponse),
+			Query: &ReadingQueryEcho{PiID: "pi-1", Limit: 100, Order: ReadingOrderNewestFirst},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := json.MarshalIndent(tt.response, "", "  ")
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			path := filepath.Join("testdata", tt.file)
+			if *update {
+				if err := os.WriteFile(path, append(got, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotJSON, wantJSON interface{}
+			if err := json.Unmarshal(got, &gotJSON); err != nil {
+				t.Fatalf("Unmarshal response: %v", err)
+			}
+			if err := json.Unmarshal(want, &wantJSON); err != nil {
+				t.Fatalf("Unmarshal %s: %v", path, err)
+			}
+			if !reflect.DeepEqual(gotJSON, wantJSON) {
+				t.Errorf("response differs from %s:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
@@ -8,10 +8,11 @@ import (
 
 // Config holds JWT configuration
 type Config struct {
-	SecretKey            string
-	AccessTokenDuration  time.Duration
-	RefreshTokenDuration time.Duration
-	Issuer               string
+	SecretKey                  string
+	AccessTokenDuration        time.Duration
+	RefreshTokenDuration       time.Duration
+	ImpersonationTokenDuration time.Duration
+	Issuer                     string
 }
 
 // AccessClaims represents the JWT claims for user access
@@ -20,6 +21,12 @@ type AccessClaims struct {
 	UserID  string `json:"user_id"`
 	Role    string `json:"role"`
 	TokenID string `json:"token_id"`
+
+	// ImpersonatorID is the admin acting as UserID; empty for normal sessions
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
+
+	// Purpose is only set on single-purpose tokens, which are never valid as sessions
+	Purpose string `json:"purpose,omitempty"`
 }
 
 // RefreshClaims represents the JWT claims for refresh tokens
@@ -27,6 +34,20 @@ type RefreshClaims struct {
 	jwt.RegisteredClaims
 	UserID  string `json:"user_id"`
 	TokenID string `json:"token_id"`
+
+	// Purpose is only set on single-purpose tokens, which are never valid as sessions
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// PurposeClaims represents the JWT claims for a single-purpose token, such as
+// confirming an email change. Target is what the token acts on, e.g. the new
+// email address.
+type PurposeClaims struct {
+	jwt.RegisteredClaims
+	UserID  string `json:"user_id"`
+	TokenID string `json:"token_id"`
+	Purpose string `json:"purpose"`
+	Target  string `json:"target,omitempty"`
 }
 
 // TokenPair contains access and refresh tokens
@@ -0,0 +1,24 @@
+package audit_models
+
+import "time"
+
+// Actor types recorded on audit events
+const (
+	ActorTypeUser    = "user"
+	ActorTypeService = "service"
+	ActorTypeSystem  = "system"
+)
+
+// AuditEvent represents a security-relevant action recorded for later review
+type AuditEvent struct {
+	EventID      string `json:"event_id" db:"event_id"`
+	ActorType    string `json:"actor_type" db:"actor_type"`
+	ActorID      string `json:"actor_id" db:"actor_id"`
+	Action       string `json:"action" db:"action"`
+	ResourceType string `json:"resource_type" db:"resource_type"`
+	ResourceID   string `json:"resource_id" db:"resource_id"`
+	// ImpersonatorID is set when the actor was being impersonated by an admin
+	ImpersonatorID string                 `json:"impersonator_id,omitempty" db:"impersonator_id"`
+	Details        map[string]interface{} `json:"details,omitempty" db:"details"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
@@ -29,3 +29,11 @@ func NewUser(username, email, password, role string) *User {
 		UpdatedAt: now,
 	}
 }
+
+// PendingEmailChange is an email address change awaiting confirmation from the
+// new address
+type PendingEmailChange struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	TokenID   string    `json:"-"` // ID of the confirmation token that applies it
+}
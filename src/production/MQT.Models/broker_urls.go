@@ -0,0 +1,91 @@
+package mqtmodels
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Broker URL schemes paho accepts for plain and TLS connections. Entries without
+// a scheme get tcp or tcps depending on the TLS setting.
+var (
+	plainBrokerSchemes = map[string]bool{"tcp": true, "mqtt": true}
+	tlsBrokerSchemes   = map[string]bool{"tcps": true, "ssl": true, "tls": true, "mqtts": true}
+)
+
+// ParseBrokerURLs expands a comma-separated broker list into connection URLs.
+// Entries may be "host", "host:port", "[::1]:port" or a full URL such as
+// "tcps://broker-2:8883"; a missing port defaults to defaultPort. An explicit
+// scheme must agree with useTLS so one broker can't silently go plaintext.
+// Credentials belong in BROKER_USER and BROKER_PASS, not in the URLs.
+func ParseBrokerURLs(list string, defaultPort int, useTLS bool) ([]string, error) {
+	scheme := "tcp"
+	if useTLS {
+		scheme = "tcps"
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for n, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label := strconv.Quote(entry)
+		if strings.Contains(entry, "@") {
+			label = "#" + strconv.Itoa(n+1) // don't echo credentials into logs
+		}
+
+		u, err := parseBrokerEntry(entry, scheme, defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("broker %s: %w", label, err)
+		}
+		if useTLS && !tlsBrokerSchemes[u.Scheme] {
+			return nil, fmt.Errorf("broker %s: scheme %s is not a TLS scheme but BROKER_TLS is enabled", label, u.Scheme)
+		}
+		if !useTLS && !plainBrokerSchemes[u.Scheme] {
+			return nil, fmt.Errorf("broker %s: scheme %s needs BROKER_TLS=true", label, u.Scheme)
+		}
+
+		s := u.String()
+		if !seen[s] {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no brokers configured")
+	}
+	return urls, nil
+}
+
+func parseBrokerEntry(entry, scheme string, defaultPort int) (*url.URL, error) {
+	if !strings.Contains(entry, "://") {
+		entry = scheme + "://" + entry
+	}
+	u, err := url.Parse(entry)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.User != nil {
+		return nil, fmt.Errorf("credentials must be set with BROKER_USER and BROKER_PASS")
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("only scheme, host and port are allowed")
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = strconv.Itoa(defaultPort)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("invalid port %s", port)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: net.JoinHostPort(u.Hostname(), port)}, nil
+}
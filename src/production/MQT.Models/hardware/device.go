@@ -4,8 +4,35 @@ import "time"
 
 // Device represents a device attached to a Raspberry Pi
 type Device struct {
-	PiID       string    `json:"pi_id" db:"pi_id"`
-	DeviceID   int       `json:"device_id" db:"device_id"`
-	DeviceType string    `json:"device_type" db:"device_type"` // temperature, humidity, light, pressure
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	PiID       string                 `json:"pi_id" db:"pi_id"`
+	DeviceID   int                    `json:"device_id" db:"device_id"`
+	DeviceType string                 `json:"device_type" db:"device_type"` // temperature, humidity, light, pressure
+	Meta       map[string]interface{} `json:"meta,omitempty" db:"meta"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+}
+
+// DeviceWithLatest is a device together with its most recent reading, if any
+type DeviceWithLatest struct {
+	Device
+	Current *Reading `json:"current"`
+}
+
+// PendingDevice is a device a Pi announced on its discovery topic. It is not a
+// Device until an owner or admin approves it, so its readings are still rejected.
+type PendingDevice struct {
+	PiID        string    `json:"pi_id" db:"pi_id"`
+	DeviceID    int       `json:"device_id" db:"device_id"`
+	DeviceType  string    `json:"device_type" db:"device_type"`
+	Firmware    string    `json:"firmware,omitempty" db:"firmware"`
+	FirstSeenAt time.Time `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+	SeenCount   int       `json:"seen_count" db:"seen_count"`
+}
+
+// DeviceType holds settings shared by every device of a type. Meta.units declares
+// the unit of payload fields, and a device's own meta.units overrides it per field.
+type DeviceType struct {
+	DeviceType string                 `json:"device_type" db:"device_type"`
+	Meta       map[string]interface{} `json:"meta" db:"meta"`
+	UpdatedAt  time.Time              `json:"updated_at" db:"updated_at"`
 }
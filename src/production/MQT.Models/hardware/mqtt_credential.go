@@ -0,0 +1,18 @@
+package hardware_models
+
+import "time"
+
+// MqttCredential is a broker password issued to a Pi. The Pi connects with its
+// pi_id as the MQTT username; only the hash of the password is stored.
+type MqttCredential struct {
+	CredentialID string     `json:"credential_id" db:"credential_id"`
+	PiID         string     `json:"pi_id" db:"pi_id"`
+	SecretHash   string     `json:"-" db:"secret_hash"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsRevoked reports whether the credential has been revoked
+func (c *MqttCredential) IsRevoked() bool {
+	return c.RevokedAt != nil
+}
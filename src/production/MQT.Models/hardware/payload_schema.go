@@ -0,0 +1,43 @@
+package hardware_models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// What happens to a reading whose payload violates its device type's active schema
+const (
+	SchemaEnforcementFlag   = "flag"   // store the reading and record the violations
+	SchemaEnforcementReject = "reject" // refuse the reading
+)
+
+// PayloadSchema is one version of the JSON Schema that payloads of a device type
+// should follow. Versions are immutable; at most one per device type is active.
+type PayloadSchema struct {
+	DeviceType  string          `json:"device_type" db:"device_type"`
+	Version     int             `json:"version" db:"version"`
+	Schema      json.RawMessage `json:"schema" db:"schema"`
+	Enforcement string          `json:"enforcement" db:"enforcement"`
+	Active      bool            `json:"active" db:"active"`
+	CreatedBy   string          `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// SchemaViolation is a single way a payload fails its schema. Path uses the same
+// dot notation as the fields parameter; it is empty for the payload itself.
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// PayloadSchemaViolation records a flagged reading and what was wrong with it
+type PayloadSchemaViolation struct {
+	ViolationID   int64             `json:"violation_id" db:"violation_id"`
+	PiID          string            `json:"pi_id" db:"pi_id"`
+	DeviceID      int               `json:"device_id" db:"device_id"`
+	Ts            time.Time         `json:"ts" db:"ts"`
+	DeviceType    string            `json:"device_type" db:"device_type"`
+	SchemaVersion int               `json:"schema_version" db:"schema_version"`
+	Violations    []SchemaViolation `json:"violations" db:"violations"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+}
@@ -1,10 +1,22 @@
 package hardware_models
 
-import "time"
+import (
+	"regexp"
+	"time"
+)
+
+// piIDPattern restricts pi_ids to characters that are safe in MQTT topic levels
+var piIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
 
 // Pi represents a Raspberry Pi gateway
 type Pi struct {
-	PiID      string    `json:"pi_id" db:"pi_id"`
-	UserID    string    `json:"user_id" db:"user_id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	PiID      string                 `json:"pi_id" db:"pi_id"`
+	UserID    string                 `json:"user_id" db:"user_id"`
+	Meta      map[string]interface{} `json:"meta,omitempty" db:"meta"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+}
+
+// IsValidPiID checks that a pi_id is non-empty and usable as an MQTT topic level
+func IsValidPiID(piID string) bool {
+	return piIDPattern.MatchString(piID)
 }
@@ -1,22 +1,64 @@
 package hardware_models
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"time"
 )
 
-// Reading represents a time-series reading from a device
+// Reading represents a time-series reading from a device. Ts is when the value
+// was measured; ReceivedAt is when the platform received it, which differs for
+// replayed or imported data. ReceivedAt is nil for readings stored before it was tracked.
 type Reading struct {
-	PiID     string                 `json:"pi_id" db:"pi_id"`
-	DeviceID int                    `json:"device_id" db:"device_id"`
-	Ts       time.Time              `json:"ts" db:"ts"`
-	Payload  map[string]interface{} `json:"payload" db:"payload"`
+	PiID       string                 `json:"pi_id" db:"pi_id"`
+	DeviceID   int                    `json:"device_id" db:"device_id"`
+	Ts         time.Time              `json:"ts" db:"ts"`
+	Payload    map[string]interface{} `json:"payload" db:"payload"`
+	ReceivedAt *time.Time             `json:"received_at,omitempty" db:"received_at"`
+
+	// Units is the unit of each converted payload field, set only when a
+	// units=metric|imperial query asked for conversion
+	Units map[string]string `json:"units,omitempty" db:"-"`
+}
+
+// MarshalJSON writes ts and received_at as RFC3339 UTC with the fixed precision
+// set by SetTimestampPrecision, whatever zone the driver returned them in
+func (r Reading) MarshalJSON() ([]byte, error) {
+	out := struct {
+		PiID       string                 `json:"pi_id"`
+		DeviceID   int                    `json:"device_id"`
+		Ts         string                 `json:"ts"`
+		Payload    map[string]interface{} `json:"payload"`
+		ReceivedAt *string                `json:"received_at,omitempty"`
+		Units      map[string]string      `json:"units,omitempty"`
+	}{
+		PiID:     r.PiID,
+		DeviceID: r.DeviceID,
+		Ts:       FormatTimestamp(r.Ts),
+		Payload:  r.Payload,
+		Units:    r.Units,
+	}
+	if r.ReceivedAt != nil {
+		receivedAt := FormatTimestamp(*r.ReceivedAt)
+		out.ReceivedAt = &receivedAt
+	}
+	return json.Marshal(out)
 }
 
-// ReadingWithTopic represents a reading with topic information for MQTT processing
-type ReadingWithTopic struct {
-	PiID       string                 `json:"pi_id"`
-	DeviceID   string                 `json:"device_id"`
-	Topic      string                 `json:"topic"`
-	Payload    map[string]interface{} `json:"payload"`
-	ReceivedAt time.Time              `json:"received_at"`
+// DecodePayload decodes a JSON reading payload keeping numbers as json.Number,
+// so integers beyond 2^53 and high-precision decimals are stored and returned
+// exactly instead of being rounded through float64. Like json.Unmarshal it
+// rejects trailing data.
+func DecodePayload(data []byte, payload *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(payload); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package hardware_models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Timestamp precisions accepted by SetTimestampPrecision. Postgres stores
+// microseconds, so nothing finer is offered.
+var timestampLayouts = map[time.Duration]string{
+	time.Second:      "2006-01-02T15:04:05Z07:00",
+	time.Millisecond: "2006-01-02T15:04:05.000Z07:00",
+	time.Microsecond: "2006-01-02T15:04:05.000000Z07:00",
+}
+
+// timestampPrecision is set once at startup and read on every reading
+var timestampPrecision atomic.Int64
+
+func init() {
+	timestampPrecision.Store(int64(time.Millisecond))
+}
+
+// ValidTimestampPrecision reports whether precision can be passed to SetTimestampPrecision
+func ValidTimestampPrecision(precision time.Duration) bool {
+	_, ok := timestampLayouts[precision]
+	return ok
+}
+
+// SetTimestampPrecision sets the precision reading timestamps are truncated to
+// and serialized with. The default is milliseconds.
+func SetTimestampPrecision(precision time.Duration) error {
+	if !ValidTimestampPrecision(precision) {
+		return fmt.Errorf("timestamp precision must be 1s, 1ms or 1us")
+	}
+	timestampPrecision.Store(int64(precision))
+	return nil
+}
+
+// NormalizeTimestamp converts t to UTC and truncates it to the configured
+// precision, so the same instant always compares and serializes the same way
+func NormalizeTimestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Duration(timestampPrecision.Load()))
+}
+
+// FormatTimestamp formats t as RFC3339 in UTC with the fixed number of
+// fractional digits of the configured precision
+func FormatTimestamp(t time.Time) string {
+	return NormalizeTimestamp(t).Format(timestampLayouts[time.Duration(timestampPrecision.Load())])
+}
+
+// ParseTimestamp parses RFC3339 with any offset and precision, a few older
+// layouts (read as UTC), or Unix epoch seconds with an optional fraction. The
+// result is normalized with NormalizeTimestamp.
+func ParseTimestamp(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return NormalizeTimestamp(t), nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return NormalizeTimestamp(t), nil
+		}
+	}
+
+	if t, ok := parseEpoch(value); ok {
+		return NormalizeTimestamp(t), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse time string: %s", value)
+}
+
+// parseEpoch parses seconds.fraction without going through a float, which
+// would lose sub-millisecond digits at current epoch values
+func parseEpoch(value string) (time.Time, bool) {
+	wholeStr, fracStr, hasFrac := strings.Cut(value, ".")
+	whole, err := strconv.ParseInt(wholeStr, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if !hasFrac {
+		return time.Unix(whole, 0), true
+	}
+
+	if fracStr == "" || len(fracStr) > 9 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseUint(fracStr+strings.Repeat("0", 9-len(fracStr)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if strings.HasPrefix(wholeStr, "-") {
+		return time.Unix(whole, -int64(nanos)), true
+	}
+	return time.Unix(whole, int64(nanos)), true
+}
@@ -0,0 +1,111 @@
+package hardware_models
+
+import (
+	"testing"
+	"time"
+)
+
+// usePrecision sets the timestamp precision for the test
+func usePrecision(t *testing.T, precision time.Duration) {
+	t.Helper()
+	if err := SetTimestampPrecision(precision); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTimestampPrecision(time.Millisecond) })
+}
+
+func TestParseTimestamp(t *testing.T) {
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) // 1709294400
+
+	tests := []struct {
+		name      string
+		value     string
+		precision time.Duration
+		want      time.Time
+		wantErr   bool
+	}{
+		// Offsets
+		{name: "UTC", value: "2024-03-01T12:00:00Z", precision: time.Millisecond, want: noon},
+		{name: "positive offset", value: "2024-03-01T14:00:00+02:00", precision: time.Millisecond, want: noon},
+		{name: "negative offset", value: "2024-03-01T07:00:00-05:00", precision: time.Millisecond, want: noon},
+		{name: "half-hour offset", value: "2024-03-01T17:30:00+05:30", precision: time.Millisecond, want: noon},
+		{name: "zero offset", value: "2024-03-01T12:00:00+00:00", precision: time.Millisecond, want: noon},
+		{name: "offset across midnight", value: "2024-03-02T01:00:00+13:00", precision: time.Millisecond, want: noon},
+		{name: "older layout read as UTC", value: "2024-03-01T12:00:00", precision: time.Millisecond, want: noon},
+		{name: "older layout with a space", value: "2024-03-01 12:00:00", precision: time.Millisecond, want: noon},
+
+		// Fractions
+		{name: "milliseconds", value: "2024-03-01T12:00:00.123Z", precision: time.Millisecond, want: noon.Add(123 * time.Millisecond)},
+		{name: "nanoseconds truncated to milliseconds", value: "2024-03-01T12:00:00.123999999Z", precision: time.Millisecond, want: noon.Add(123 * time.Millisecond)},
+		{name: "nanoseconds truncated to microseconds", value: "2024-03-01T12:00:00.123456789Z", precision: time.Microsecond, want: noon.Add(123456 * time.Microsecond)},
+		{name: "nanoseconds truncated to seconds", value: "2024-03-01T12:00:00.999999999Z", precision: time.Second, want: noon},
+		{name: "nanoseconds with an offset", value: "2024-03-01T14:00:00.000000001+02:00", precision: time.Microsecond, want: noon},
+		{name: "one digit", value: "2024-03-01T12:00:00.5Z", precision: time.Millisecond, want: noon.Add(500 * time.Millisecond)},
+
+		// Epoch seconds
+		{name: "epoch", value: "1709294400", precision: time.Millisecond, want: noon},
+		{name: "epoch with milliseconds", value: "1709294400.123", precision: time.Millisecond, want: noon.Add(123 * time.Millisecond)},
+		{name: "epoch with microseconds kept exactly", value: "1709294400.123456", precision: time.Microsecond, want: noon.Add(123456 * time.Microsecond)},
+		{name: "epoch with nanoseconds", value: "1709294400.123456789", precision: time.Microsecond, want: noon.Add(123456 * time.Microsecond)},
+		{name: "epoch zero", value: "0", precision: time.Millisecond, want: time.Unix(0, 0).UTC()},
+		{name: "negative epoch", value: "-1.5", precision: time.Millisecond, want: time.Unix(-2, 500000000).UTC()},
+
+		// Refused
+		{name: "epoch with ten fraction digits", value: "1709294400.1234567890", precision: time.Millisecond, wantErr: true},
+		{name: "epoch with an empty fraction", value: "1709294400.", precision: time.Millisecond, wantErr: true},
+		{name: "epoch with a signed fraction", value: "1709294400.-5", precision: time.Millisecond, wantErr: true},
+		{name: "epoch in exponent notation", value: "1.7e9", precision: time.Millisecond, wantErr: true},
+		{name: "date only", value: "2024-03-01", precision: time.Millisecond, wantErr: true},
+		{name: "words", value: "noon", precision: time.Millisecond, wantErr: true},
+		{name: "empty", value: "", precision: time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePrecision(t, tt.precision)
+			got, err := ParseTimestamp(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTimestamp(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("ParseTimestamp(%q) = %v, want %v in UTC", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// The same instant written with any offset or finer digits formats the same
+// way, with the fixed digits of the precision
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		precision time.Duration
+		value     string
+		want      string
+	}{
+		{precision: time.Second, value: "2024-03-01T14:00:00.999+02:00", want: "2024-03-01T12:00:00Z"},
+		{precision: time.Millisecond, value: "2024-03-01T14:00:00+02:00", want: "2024-03-01T12:00:00.000Z"},
+		{precision: time.Millisecond, value: "2024-03-01T12:00:00.123456789Z", want: "2024-03-01T12:00:00.123Z"},
+		{precision: time.Microsecond, value: "2024-03-01T07:00:00.1-05:00", want: "2024-03-01T12:00:00.100000Z"},
+		{precision: time.Microsecond, value: "1709294400.123456789", want: "2024-03-01T12:00:00.123456Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.precision.String()+" "+tt.value, func(t *testing.T) {
+			usePrecision(t, tt.precision)
+			parsed, err := ParseTimestamp(tt.value)
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q): %v", tt.value, err)
+			}
+			if got := FormatTimestamp(parsed); got != tt.want {
+				t.Errorf("FormatTimestamp() = %q, want %q", got, tt.want)
+			}
+			if again, err := ParseTimestamp(tt.want); err != nil || !again.Equal(parsed) {
+				t.Errorf("%q parses back to %v, %v, want %v", tt.want, again, err, parsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package ingest_models
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Changes reported in a CacheInvalidation. Every one evicts; the action is
+// for logs.
+const (
+	CacheInvalidationCreated = "created"
+	CacheInvalidationUpdated = "updated"
+	CacheInvalidationDeleted = "deleted"
+)
+
+// CacheInvalidationSignatureMethod stands in for the HTTP method when an
+// invalidation is signed; the topic it is published on is its path
+const CacheInvalidationSignatureMethod = "MQTT"
+
+// CacheInvalidation tells validation caches to forget a Pi and its devices, or
+// only one device when DeviceID is set. The API publishes one whenever a Pi or
+// device is created, changed or deleted, so caches neither keep refusing
+// hardware registered after a miss nor keep accepting hardware that is gone.
+type CacheInvalidation struct {
+	PiID     string `json:"pi_id"`
+	DeviceID *int   `json:"device_id,omitempty"`
+	Action   string `json:"action"`
+}
+
+// CacheInvalidationMessage is a CacheInvalidation as published on the
+// invalidation topic. It is signed like a service request, over the topic, the
+// timestamp and the event as sent, so only holders of INTERNAL_API_SECRET can
+// evict cache entries.
+type CacheInvalidationMessage struct {
+	Event     json.RawMessage `json:"event"`
+	Timestamp string          `json:"timestamp"` // Unix seconds
+	Signature string          `json:"signature"`
+}
+
+// SignCacheInvalidation wraps event in a message for topic, signed at now
+func SignCacheInvalidation(secret, topic string, event CacheInvalidation, now time.Time) (CacheInvalidationMessage, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return CacheInvalidationMessage{}, fmt.Errorf("failed to marshal cache invalidation: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return CacheInvalidationMessage{
+		Event:     body,
+		Timestamp: timestamp,
+		Signature: SignServiceRequest(secret, CacheInvalidationSignatureMethod, topic, timestamp, body),
+	}, nil
+}
+
+// Verify checks the message's signature for topic and that it was signed
+// within maxSkew of now, and returns its event
+func (m CacheInvalidationMessage) Verify(secret, topic string, now time.Time, maxSkew time.Duration) (CacheInvalidation, error) {
+	seconds, err := strconv.ParseInt(m.Timestamp, 10, 64)
+	if err != nil {
+		return CacheInvalidation{}, errors.New("invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > maxSkew || skew < -maxSkew {
+		return CacheInvalidation{}, errors.New("timestamp is outside the allowed window")
+	}
+	expected := SignServiceRequest(secret, CacheInvalidationSignatureMethod, topic, m.Timestamp, m.Event)
+	if !hmac.Equal([]byte(m.Signature), []byte(expected)) {
+		return CacheInvalidation{}, errors.New("invalid signature")
+	}
+
+	var event CacheInvalidation
+	if err := json.Unmarshal(m.Event, &event); err != nil {
+		return CacheInvalidation{}, fmt.Errorf("invalid event: %w", err)
+	}
+	if event.PiID == "" {
+		return CacheInvalidation{}, errors.New("event has no pi_id")
+	}
+	return event, nil
+}
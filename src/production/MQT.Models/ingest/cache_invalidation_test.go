@@ -0,0 +1,126 @@
+package ingest_models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testInvalidationTopic = "internal/cache-invalidate"
+
+func TestCacheInvalidationRoundTrip(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	deviceID := 0
+	event := CacheInvalidation{PiID: "pi-1", DeviceID: &deviceID, Action: CacheInvalidationCreated}
+
+	message, err := SignCacheInvalidation("secret", testInvalidationTopic, event, now)
+	if err != nil {
+		t.Fatalf("SignCacheInvalidation: %v", err)
+	}
+
+	// The message survives being published as JSON
+	payload, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var received CacheInvalidationMessage
+	if err := json.Unmarshal(payload, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	got, err := received.Verify("secret", testInvalidationTopic, now.Add(time.Minute), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.PiID != "pi-1" || got.DeviceID == nil || *got.DeviceID != 0 || got.Action != CacheInvalidationCreated {
+		t.Errorf("Verify returned %+v, want %+v", got, event)
+	}
+}
+
+func TestCacheInvalidationVerifyRejects(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signed := func(t *testing.T, event CacheInvalidation) CacheInvalidationMessage {
+		t.Helper()
+		message, err := SignCacheInvalidation("secret", testInvalidationTopic, event, now)
+		if err != nil {
+			t.Fatalf("SignCacheInvalidation: %v", err)
+		}
+		return message
+	}
+	event := CacheInvalidation{PiID: "pi-1", Action: CacheInvalidationDeleted}
+
+	tests := []struct {
+		name    string
+		message func(t *testing.T) CacheInvalidationMessage
+		secret  string
+		topic   string
+		at      time.Time
+	}{
+		{
+			name:    "wrong secret",
+			message: func(t *testing.T) CacheInvalidationMessage { return signed(t, event) },
+			secret:  "other",
+			topic:   testInvalidationTopic,
+			at:      now,
+		},
+		{
+			name:    "other topic",
+			message: func(t *testing.T) CacheInvalidationMessage { return signed(t, event) },
+			secret:  "secret",
+			topic:   "internal/other",
+			at:      now,
+		},
+		{
+			name: "tampered event",
+			message: func(t *testing.T) CacheInvalidationMessage {
+				message := signed(t, event)
+				message.Event = json.RawMessage(`{"pi_id":"pi-2","action":"deleted"}`)
+				return message
+			},
+			secret: "secret",
+			topic:  testInvalidationTopic,
+			at:     now,
+		},
+		{
+			name:    "too old",
+			message: func(t *testing.T) CacheInvalidationMessage { return signed(t, event) },
+			secret:  "secret",
+			topic:   testInvalidationTopic,
+			at:      now.Add(6 * time.Minute),
+		},
+		{
+			name:    "from the future",
+			message: func(t *testing.T) CacheInvalidationMessage { return signed(t, event) },
+			secret:  "secret",
+			topic:   testInvalidationTopic,
+			at:      now.Add(-6 * time.Minute),
+		},
+		{
+			name: "malformed timestamp",
+			message: func(t *testing.T) CacheInvalidationMessage {
+				message := signed(t, event)
+				message.Timestamp = "yesterday"
+				return message
+			},
+			secret: "secret",
+			topic:  testInvalidationTopic,
+			at:     now,
+		},
+		{
+			name: "no pi_id",
+			message: func(t *testing.T) CacheInvalidationMessage {
+				return signed(t, CacheInvalidation{Action: CacheInvalidationDeleted})
+			},
+			secret: "secret",
+			topic:  testInvalidationTopic,
+			at:     now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.message(t).Verify(tt.secret, tt.topic, tt.at, 5*time.Minute); err == nil {
+				t.Error("Verify accepted the message")
+			}
+		})
+	}
+}
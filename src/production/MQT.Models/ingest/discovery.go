@@ -0,0 +1,39 @@
+package ingest_models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiscoveryTopicFormat is the topic layout device announcements are published on
+const DiscoveryTopicFormat = "discovery/<pi_id>"
+
+// DiscoveryMessage is what a Pi publishes when a device is plugged in. The
+// device is recorded as pending until an owner or admin approves it. Device
+// IDs start at 0, so DeviceID is a pointer to tell 0 from a missing field.
+type DiscoveryMessage struct {
+	DeviceID   *int   `json:"device_id"`
+	DeviceType string `json:"device_type"`
+	Firmware   string `json:"firmware,omitempty"`
+}
+
+// Validate checks the fields the API requires
+func (m DiscoveryMessage) Validate() error {
+	if m.DeviceID == nil || *m.DeviceID < 0 {
+		return fmt.Errorf("device_id must be a non-negative integer")
+	}
+	if strings.TrimSpace(m.DeviceType) == "" {
+		return fmt.Errorf("device_type is required")
+	}
+	return nil
+}
+
+// ParseDiscoveryTopic returns the pi_id of a discovery/<pi_id> topic. Any prefix
+// is accepted as long as the pi_id is the second and last level.
+func ParseDiscoveryTopic(topic string) (string, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid discovery topic: %s, expected: %s", topic, DiscoveryTopicFormat)
+	}
+	return parts[1], nil
+}
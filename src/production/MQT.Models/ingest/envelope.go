@@ -0,0 +1,47 @@
+package ingest_models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SensorTopicFormat is the topic layout readings are published on
+const SensorTopicFormat = "sensors/<pi_id>/<device_id>/<metric>"
+
+// ReadingEnvelope is a reading as it comes off the broker, before the API has
+// validated its pi and device. DeviceID is still the raw topic level.
+type ReadingEnvelope struct {
+	PiID       string                 `json:"pi_id"`
+	DeviceID   string                 `json:"device_id"`
+	Topic      string                 `json:"topic"`
+	Payload    map[string]interface{} `json:"payload"`
+	Ts         time.Time              `json:"ts"` // measurement time from the payload, or ReceivedAt when it has none
+	ReceivedAt time.Time              `json:"received_at"`
+}
+
+// SensorTopic holds the levels of a sensors/<pi_id>/<device_id>/<metric> topic
+type SensorTopic struct {
+	PiID     string
+	DeviceID string
+	Metric   string
+}
+
+// ParseSensorTopic splits a sensor topic into its levels. On a malformed topic it
+// returns an error along with whatever pi_id and device_id could be read, using
+// "unknown" for missing levels, so the failure can still be reported to the Pi.
+func ParseSensorTopic(topic string) (SensorTopic, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) >= 4 {
+		return SensorTopic{PiID: parts[1], DeviceID: parts[2], Metric: strings.Join(parts[3:], "/")}, nil
+	}
+
+	parsed := SensorTopic{PiID: "unknown", DeviceID: "unknown"}
+	if len(parts) >= 2 {
+		parsed.PiID = parts[1]
+	}
+	if len(parts) >= 3 {
+		parsed.DeviceID = parts[2]
+	}
+	return parsed, fmt.Errorf("invalid topic format: %s, expected: %s", topic, SensorTopicFormat)
+}
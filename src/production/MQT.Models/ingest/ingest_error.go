@@ -0,0 +1,34 @@
+package ingest_models
+
+import "time"
+
+// IngestErrorSchemaVersion is the version of IngestError published to the error
+// topic. Bump it when fields change meaning or are removed.
+const IngestErrorSchemaVersion = 2
+
+// IngestError is published back to a Pi on its error topic when one of its
+// readings can't be ingested
+type IngestError struct {
+	SchemaVersion int       `json:"schema_version"`
+	ErrorType     string    `json:"error_type"`
+	Message       string    `json:"message"`
+	PiID          string    `json:"pi_id"`
+	DeviceID      string    `json:"device_id"`
+	Topic         string    `json:"topic"`
+	Timestamp     time.Time `json:"timestamp"`
+	AffectedCount int       `json:"affected_count"` // readings this error covers; Pi and device errors are reported once per flush
+}
+
+// NewIngestError returns an IngestError at the current schema version
+func NewIngestError(errorType, message, piID, deviceID, topic string, timestamp time.Time) IngestError {
+	return IngestError{
+		SchemaVersion: IngestErrorSchemaVersion,
+		ErrorType:     errorType,
+		Message:       message,
+		PiID:          piID,
+		DeviceID:      deviceID,
+		Topic:         topic,
+		Timestamp:     timestamp,
+		AffectedCount: 1,
+	}
+}
@@ -0,0 +1,45 @@
+package ingest_models
+
+import "time"
+
+// Commands accepted on an ingestor's control topic
+const (
+	ControlCmdSetBatch    = "set_batch"   // change BatchSize and/or BatchWindow
+	ControlCmdResubscribe = "resubscribe" // replace the reading topic filters
+)
+
+// Outcomes reported in a ControlAck
+const (
+	ControlStatusApplied  = "applied"
+	ControlStatusRejected = "rejected"
+)
+
+// ControlCommand is published on an ingestor's control topic to change its
+// settings while it runs. Secret must match the ingestor's INTERNAL_API_SECRET;
+// commands without it are dropped unanswered.
+type ControlCommand struct {
+	Cmd    string `json:"cmd"`
+	Secret string `json:"secret"`
+	ID     string `json:"id,omitempty"`     // echoed in the ack to match it to the command
+	Size   int    `json:"size,omitempty"`   // set_batch: readings per batch; 0 keeps the current size
+	Window string `json:"window,omitempty"` // set_batch: flush window, e.g. "2s"; "" keeps the current window
+	Topic  string `json:"topic,omitempty"`  // resubscribe: comma-separated topic filters, as in MQTT_TOPIC
+}
+
+// ControlAck answers an authorized control command on the control topic's
+// /ack subtopic, with the settings in effect afterwards
+type ControlAck struct {
+	ID        string          `json:"id,omitempty"`
+	Cmd       string          `json:"cmd"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"` // why a rejected command wasn't applied
+	Config    ControlSettings `json:"config"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ControlSettings are the ingestor settings a control command can change
+type ControlSettings struct {
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow string   `json:"batch_window"`
+	Topics      []string `json:"topics"`
+}
@@ -0,0 +1,20 @@
+package ingest_models
+
+import "time"
+
+// Ingestor statuses published retained on the status topic
+const (
+	IngestorStatusOnline   = "online"
+	IngestorStatusStopping = "stopping"
+	IngestorStatusOffline  = "offline" // also the Last Will, sent by the broker if the ingestor drops off
+)
+
+// IngestorStatus is published retained on an ingestor's status topic, so
+// anything watching the broker can tell whether the ingestor is up
+type IngestorStatus struct {
+	Status     string     `json:"status"`
+	ClientID   string     `json:"client_id"`
+	InstanceID string     `json:"instance_id,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"` // set while online
+	Timestamp  *time.Time `json:"timestamp,omitempty"`  // when it was published; the Last Will has none
+}
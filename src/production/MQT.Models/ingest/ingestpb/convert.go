@@ -0,0 +1,89 @@
+package ingestpb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// NewReading converts a reading request to its message, encoding the payload
+// as JSON
+func NewReading(req ingest_models.CreateReadingRequest) (*Reading, error) {
+	if req.DeviceID == nil {
+		return nil, fmt.Errorf("device_id is required")
+	}
+	payload, err := json.Marshal(req.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return &Reading{
+		PiId:       req.PiID,
+		DeviceId:   int32(*req.DeviceID),
+		Ts:         string(req.Ts),
+		Payload:    payload,
+		ReceivedAt: string(req.ReceivedAt),
+	}, nil
+}
+
+// ToModel converts the message back to a reading request. The payload is
+// decoded as the HTTP routes decode it, keeping numbers as json.Number.
+func (r *Reading) ToModel() (ingest_models.CreateReadingRequest, error) {
+	deviceID := int(r.GetDeviceId())
+	req := ingest_models.CreateReadingRequest{
+		PiID:       r.GetPiId(),
+		DeviceID:   &deviceID,
+		Ts:         ingest_models.TimeValue(r.GetTs()),
+		ReceivedAt: ingest_models.TimeValue(r.GetReceivedAt()),
+	}
+	if err := hardware_models.DecodePayload(r.GetPayload(), &req.Payload); err != nil {
+		return ingest_models.CreateReadingRequest{}, fmt.Errorf("invalid payload: %w", err)
+	}
+	return req, nil
+}
+
+// NewCreateReadingsResponse converts a batch's outcome to its message
+func NewCreateReadingsResponse(response ingest_models.CreateReadingsResponse) *CreateReadingsResponse {
+	message := &CreateReadingsResponse{
+		Inserted: int32(response.Inserted),
+		Failed:   make([]*ReadingFailure, len(response.Failed)),
+	}
+	for n, failure := range response.Failed {
+		violations := make([]*SchemaViolation, len(failure.Violations))
+		for v, violation := range failure.Violations {
+			violations[v] = &SchemaViolation{Path: violation.Path, Message: violation.Message}
+		}
+		message.Failed[n] = &ReadingFailure{
+			Index:      int32(failure.Index),
+			PiId:       failure.PiID,
+			DeviceId:   int32(failure.DeviceID),
+			Ts:         failure.Ts,
+			Reason:     failure.Reason,
+			Error:      failure.Error,
+			Violations: violations,
+		}
+	}
+	return message
+}
+
+// ToModel converts the message back to a batch's outcome
+func (r *CreateReadingsResponse) ToModel() *ingest_models.CreateReadingsResponse {
+	response := &ingest_models.CreateReadingsResponse{Inserted: int(r.GetInserted())}
+	for _, failure := range r.GetFailed() {
+		var violations []hardware_models.SchemaViolation
+		for _, violation := range failure.GetViolations() {
+			violations = append(violations, hardware_models.SchemaViolation{Path: violation.GetPath(), Message: violation.GetMessage()})
+		}
+		response.Failed = append(response.Failed, ingest_models.ReadingFailure{
+			Index:      int(failure.GetIndex()),
+			PiID:       failure.GetPiId(),
+			DeviceID:   int(failure.GetDeviceId()),
+			Ts:         failure.GetTs(),
+			Reason:     failure.GetReason(),
+			Error:      failure.GetError(),
+			Violations: violations,
+		})
+	}
+	return response
+}
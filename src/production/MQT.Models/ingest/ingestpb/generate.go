@@ -0,0 +1,6 @@
+// Package ingestpb holds the protobuf messages and gRPC service of the
+// ingestor's optional gRPC transport to the API service. The Go files are
+// generated from ingest.proto; regenerate them after changing it.
+package ingestpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ingest.proto
@@ -0,0 +1,600 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.28.3
+// source: ingest.proto
+
+package ingestpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ValidatePiRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PiId          string                 `protobuf:"bytes,1,opt,name=pi_id,json=piId,proto3" json:"pi_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidatePiRequest) Reset() {
+	*x = ValidatePiRequest{}
+	mi := &file_ingest_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidatePiRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidatePiRequest) ProtoMessage() {}
+
+func (x *ValidatePiRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidatePiRequest.ProtoReflect.Descriptor instead.
+func (*ValidatePiRequest) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ValidatePiRequest) GetPiId() string {
+	if x != nil {
+		return x.PiId
+	}
+	return ""
+}
+
+type ValidatePiResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Exists bool                   `protobuf:"varint,1,opt,name=exists,proto3" json:"exists,omitempty"`
+	// One of the ingest_models.PiStatus* values
+	Status        string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidatePiResponse) Reset() {
+	*x = ValidatePiResponse{}
+	mi := &file_ingest_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidatePiResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidatePiResponse) ProtoMessage() {}
+
+func (x *ValidatePiResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidatePiResponse.ProtoReflect.Descriptor instead.
+func (*ValidatePiResponse) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ValidatePiResponse) GetExists() bool {
+	if x != nil {
+		return x.Exists
+	}
+	return false
+}
+
+func (x *ValidatePiResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ValidateDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PiId          string                 `protobuf:"bytes,1,opt,name=pi_id,json=piId,proto3" json:"pi_id,omitempty"`
+	DeviceId      int32                  `protobuf:"varint,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateDeviceRequest) Reset() {
+	*x = ValidateDeviceRequest{}
+	mi := &file_ingest_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateDeviceRequest) ProtoMessage() {}
+
+func (x *ValidateDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateDeviceRequest.ProtoReflect.Descriptor instead.
+func (*ValidateDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ValidateDeviceRequest) GetPiId() string {
+	if x != nil {
+		return x.PiId
+	}
+	return ""
+}
+
+func (x *ValidateDeviceRequest) GetDeviceId() int32 {
+	if x != nil {
+		return x.DeviceId
+	}
+	return 0
+}
+
+type ValidateDeviceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exists        bool                   `protobuf:"varint,1,opt,name=exists,proto3" json:"exists,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateDeviceResponse) Reset() {
+	*x = ValidateDeviceResponse{}
+	mi := &file_ingest_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateDeviceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateDeviceResponse) ProtoMessage() {}
+
+func (x *ValidateDeviceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateDeviceResponse.ProtoReflect.Descriptor instead.
+func (*ValidateDeviceResponse) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ValidateDeviceResponse) GetExists() bool {
+	if x != nil {
+		return x.Exists
+	}
+	return false
+}
+
+type Reading struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	PiId     string                 `protobuf:"bytes,1,opt,name=pi_id,json=piId,proto3" json:"pi_id,omitempty"`
+	DeviceId int32                  `protobuf:"varint,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Measurement time in any form ingest_models.ParseTime accepts
+	Ts string `protobuf:"bytes,3,opt,name=ts,proto3" json:"ts,omitempty"`
+	// The payload as a JSON object, so numbers keep their exact digits
+	Payload []byte `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	// When the reading first reached the platform; empty means now
+	ReceivedAt    string `protobuf:"bytes,5,opt,name=received_at,json=receivedAt,proto3" json:"received_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reading) Reset() {
+	*x = Reading{}
+	mi := &file_ingest_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reading) ProtoMessage() {}
+
+func (x *Reading) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reading.ProtoReflect.Descriptor instead.
+func (*Reading) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Reading) GetPiId() string {
+	if x != nil {
+		return x.PiId
+	}
+	return ""
+}
+
+func (x *Reading) GetDeviceId() int32 {
+	if x != nil {
+		return x.DeviceId
+	}
+	return 0
+}
+
+func (x *Reading) GetTs() string {
+	if x != nil {
+		return x.Ts
+	}
+	return ""
+}
+
+func (x *Reading) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Reading) GetReceivedAt() string {
+	if x != nil {
+		return x.ReceivedAt
+	}
+	return ""
+}
+
+type SchemaViolation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SchemaViolation) Reset() {
+	*x = SchemaViolation{}
+	mi := &file_ingest_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SchemaViolation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SchemaViolation) ProtoMessage() {}
+
+func (x *SchemaViolation) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SchemaViolation.ProtoReflect.Descriptor instead.
+func (*SchemaViolation) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SchemaViolation) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SchemaViolation) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// ReadingFailure is a reading of the stream that was not stored. Index is its
+// position in the stream.
+type ReadingFailure struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Index    int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	PiId     string                 `protobuf:"bytes,2,opt,name=pi_id,json=piId,proto3" json:"pi_id,omitempty"`
+	DeviceId int32                  `protobuf:"varint,3,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Ts       string                 `protobuf:"bytes,4,opt,name=ts,proto3" json:"ts,omitempty"`
+	// One of the ingest_models.ReadingFailure* values
+	Reason        string             `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	Error         string             `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	Violations    []*SchemaViolation `protobuf:"bytes,7,rep,name=violations,proto3" json:"violations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadingFailure) Reset() {
+	*x = ReadingFailure{}
+	mi := &file_ingest_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadingFailure) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadingFailure) ProtoMessage() {}
+
+func (x *ReadingFailure) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadingFailure.ProtoReflect.Descriptor instead.
+func (*ReadingFailure) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReadingFailure) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *ReadingFailure) GetPiId() string {
+	if x != nil {
+		return x.PiId
+	}
+	return ""
+}
+
+func (x *ReadingFailure) GetDeviceId() int32 {
+	if x != nil {
+		return x.DeviceId
+	}
+	return 0
+}
+
+func (x *ReadingFailure) GetTs() string {
+	if x != nil {
+		return x.Ts
+	}
+	return ""
+}
+
+func (x *ReadingFailure) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *ReadingFailure) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ReadingFailure) GetViolations() []*SchemaViolation {
+	if x != nil {
+		return x.Violations
+	}
+	return nil
+}
+
+type CreateReadingsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Inserted      int32                  `protobuf:"varint,1,opt,name=inserted,proto3" json:"inserted,omitempty"`
+	Failed        []*ReadingFailure      `protobuf:"bytes,2,rep,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateReadingsResponse) Reset() {
+	*x = CreateReadingsResponse{}
+	mi := &file_ingest_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateReadingsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateReadingsResponse) ProtoMessage() {}
+
+func (x *CreateReadingsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ingest_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateReadingsResponse.ProtoReflect.Descriptor instead.
+func (*CreateReadingsResponse) Descriptor() ([]byte, []int) {
+	return file_ingest_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CreateReadingsResponse) GetInserted() int32 {
+	if x != nil {
+		return x.Inserted
+	}
+	return 0
+}
+
+func (x *CreateReadingsResponse) GetFailed() []*ReadingFailure {
+	if x != nil {
+		return x.Failed
+	}
+	return nil
+}
+
+var File_ingest_proto protoreflect.FileDescriptor
+
+const file_ingest_proto_rawDesc = "" +
+	"\n" +
+	"\fingest.proto\x12\x0emptt.ingest.v1\"(\n" +
+	"\x11ValidatePiRequest\x12\x13\n" +
+	"\x05pi_id\x18\x01 \x01(\tR\x04piId\"D\n" +
+	"\x12ValidatePiResponse\x12\x16\n" +
+	"\x06exists\x18\x01 \x01(\bR\x06exists\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"I\n" +
+	"\x15ValidateDeviceRequest\x12\x13\n" +
+	"\x05pi_id\x18\x01 \x01(\tR\x04piId\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\x05R\bdeviceId\"0\n" +
+	"\x16ValidateDeviceResponse\x12\x16\n" +
+	"\x06exists\x18\x01 \x01(\bR\x06exists\"\x86\x01\n" +
+	"\aReading\x12\x13\n" +
+	"\x05pi_id\x18\x01 \x01(\tR\x04piId\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\x05R\bdeviceId\x12\x0e\n" +
+	"\x02ts\x18\x03 \x01(\tR\x02ts\x12\x18\n" +
+	"\apayload\x18\x04 \x01(\fR\apayload\x12\x1f\n" +
+	"\vreceived_at\x18\x05 \x01(\tR\n" +
+	"receivedAt\"?\n" +
+	"\x0fSchemaViolation\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xd7\x01\n" +
+	"\x0eReadingFailure\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x13\n" +
+	"\x05pi_id\x18\x02 \x01(\tR\x04piId\x12\x1b\n" +
+	"\tdevice_id\x18\x03 \x01(\x05R\bdeviceId\x12\x0e\n" +
+	"\x02ts\x18\x04 \x01(\tR\x02ts\x12\x16\n" +
+	"\x06reason\x18\x05 \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12?\n" +
+	"\n" +
+	"violations\x18\a \x03(\v2\x1f.mptt.ingest.v1.SchemaViolationR\n" +
+	"violations\"l\n" +
+	"\x16CreateReadingsResponse\x12\x1a\n" +
+	"\binserted\x18\x01 \x01(\x05R\binserted\x126\n" +
+	"\x06failed\x18\x02 \x03(\v2\x1e.mptt.ingest.v1.ReadingFailureR\x06failed2\x9a\x02\n" +
+	"\rIngestService\x12S\n" +
+	"\n" +
+	"ValidatePi\x12!.mptt.ingest.v1.ValidatePiRequest\x1a\".mptt.ingest.v1.ValidatePiResponse\x12_\n" +
+	"\x0eValidateDevice\x12%.mptt.ingest.v1.ValidateDeviceRequest\x1a&.mptt.ingest.v1.ValidateDeviceResponse\x12S\n" +
+	"\x0eCreateReadings\x12\x17.mptt.ingest.v1.Reading\x1a&.mptt.ingest.v1.CreateReadingsResponse(\x01BRZPgitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest/ingestpbb\x06proto3"
+
+var (
+	file_ingest_proto_rawDescOnce sync.Once
+	file_ingest_proto_rawDescData []byte
+)
+
+func file_ingest_proto_rawDescGZIP() []byte {
+	file_ingest_proto_rawDescOnce.Do(func() {
+		file_ingest_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ingest_proto_rawDesc), len(file_ingest_proto_rawDesc)))
+	})
+	return file_ingest_proto_rawDescData
+}
+
+var file_ingest_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_ingest_proto_goTypes = []any{
+	(*ValidatePiRequest)(nil),      // 0: mptt.ingest.v1.ValidatePiRequest
+	(*ValidatePiResponse)(nil),     // 1: mptt.ingest.v1.ValidatePiResponse
+	(*ValidateDeviceRequest)(nil),  // 2: mptt.ingest.v1.ValidateDeviceRequest
+	(*ValidateDeviceResponse)(nil), // 3: mptt.ingest.v1.ValidateDeviceResponse
+	(*Reading)(nil),                // 4: mptt.ingest.v1.Reading
+	(*SchemaViolation)(nil),        // 5: mptt.ingest.v1.SchemaViolation
+	(*ReadingFailure)(nil),         // 6: mptt.ingest.v1.ReadingFailure
+	(*CreateReadingsResponse)(nil), // 7: mptt.ingest.v1.CreateReadingsResponse
+}
+var file_ingest_proto_depIdxs = []int32{
+	5, // 0: mptt.ingest.v1.ReadingFailure.violations:type_name -> mptt.ingest.v1.SchemaViolation
+	6, // 1: mptt.ingest.v1.CreateReadingsResponse.failed:type_name -> mptt.ingest.v1.ReadingFailure
+	0, // 2: mptt.ingest.v1.IngestService.ValidatePi:input_type -> mptt.ingest.v1.ValidatePiRequest
+	2, // 3: mptt.ingest.v1.IngestService.ValidateDevice:input_type -> mptt.ingest.v1.ValidateDeviceRequest
+	4, // 4: mptt.ingest.v1.IngestService.CreateReadings:input_type -> mptt.ingest.v1.Reading
+	1, // 5: mptt.ingest.v1.IngestService.ValidatePi:output_type -> mptt.ingest.v1.ValidatePiResponse
+	3, // 6: mptt.ingest.v1.IngestService.ValidateDevice:output_type -> mptt.ingest.v1.ValidateDeviceResponse
+	7, // 7: mptt.ingest.v1.IngestService.CreateReadings:output_type -> mptt.ingest.v1.CreateReadingsResponse
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_ingest_proto_init() }
+func file_ingest_proto_init() {
+	if File_ingest_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ingest_proto_rawDesc), len(file_ingest_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ingest_proto_goTypes,
+		DependencyIndexes: file_ingest_proto_depIdxs,
+		MessageInfos:      file_ingest_proto_msgTypes,
+	}.Build()
+	File_ingest_proto = out.File
+	file_ingest_proto_goTypes = nil
+	file_ingest_proto_depIdxs = nil
+}
@@ -0,0 +1,205 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: ingest.proto
+
+package ingestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IngestService_ValidatePi_FullMethodName     = "/mptt.ingest.v1.IngestService/ValidatePi"
+	IngestService_ValidateDevice_FullMethodName = "/mptt.ingest.v1.IngestService/ValidateDevice"
+	IngestService_CreateReadings_FullMethodName = "/mptt.ingest.v1.IngestService/CreateReadings"
+)
+
+// IngestServiceClient is the client API for IngestService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IngestService carries the ingestor's hot path to the API service: Pi and
+// device validation and reading writes. It mirrors /internal/pis/validate,
+// /internal/devices/validate and /internal/readings/batch, which stay the
+// default transport; every other internal call is HTTP only.
+type IngestServiceClient interface {
+	ValidatePi(ctx context.Context, in *ValidatePiRequest, opts ...grpc.CallOption) (*ValidatePiResponse, error)
+	ValidateDevice(ctx context.Context, in *ValidateDeviceRequest, opts ...grpc.CallOption) (*ValidateDeviceResponse, error)
+	// CreateReadings stores the readings streamed in one call as one batch,
+	// answered once the client closes its side
+	CreateReadings(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Reading, CreateReadingsResponse], error)
+}
+
+type ingestServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestServiceClient(cc grpc.ClientConnInterface) IngestServiceClient {
+	return &ingestServiceClient{cc}
+}
+
+func (c *ingestServiceClient) ValidatePi(ctx context.Context, in *ValidatePiRequest, opts ...grpc.CallOption) (*ValidatePiResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidatePiResponse)
+	err := c.cc.Invoke(ctx, IngestService_ValidatePi_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestServiceClient) ValidateDevice(ctx context.Context, in *ValidateDeviceRequest, opts ...grpc.CallOption) (*ValidateDeviceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidateDeviceResponse)
+	err := c.cc.Invoke(ctx, IngestService_ValidateDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestServiceClient) CreateReadings(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Reading, CreateReadingsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IngestService_ServiceDesc.Streams[0], IngestService_CreateReadings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Reading, CreateReadingsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IngestService_CreateReadingsClient = grpc.ClientStreamingClient[Reading, CreateReadingsResponse]
+
+// IngestServiceServer is the server API for IngestService service.
+// All implementations must embed UnimplementedIngestServiceServer
+// for forward compatibility.
+//
+// IngestService carries the ingestor's hot path to the API service: Pi and
+// device validation and reading writes. It mirrors /internal/pis/validate,
+// /internal/devices/validate and /internal/readings/batch, which stay the
+// default transport; every other internal call is HTTP only.
+type IngestServiceServer interface {
+	ValidatePi(context.Context, *ValidatePiRequest) (*ValidatePiResponse, error)
+	ValidateDevice(context.Context, *ValidateDeviceRequest) (*ValidateDeviceResponse, error)
+	// CreateReadings stores the readings streamed in one call as one batch,
+	// answered once the client closes its side
+	CreateReadings(grpc.ClientStreamingServer[Reading, CreateReadingsResponse]) error
+	mustEmbedUnimplementedIngestServiceServer()
+}
+
+// UnimplementedIngestServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIngestServiceServer struct{}
+
+func (UnimplementedIngestServiceServer) ValidatePi(context.Context, *ValidatePiRequest) (*ValidatePiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidatePi not implemented")
+}
+func (UnimplementedIngestServiceServer) ValidateDevice(context.Context, *ValidateDeviceRequest) (*ValidateDeviceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateDevice not implemented")
+}
+func (UnimplementedIngestServiceServer) CreateReadings(grpc.ClientStreamingServer[Reading, CreateReadingsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CreateReadings not implemented")
+}
+func (UnimplementedIngestServiceServer) mustEmbedUnimplementedIngestServiceServer() {}
+func (UnimplementedIngestServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeIngestServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServiceServer will
+// result in compilation errors.
+type UnsafeIngestServiceServer interface {
+	mustEmbedUnimplementedIngestServiceServer()
+}
+
+func RegisterIngestServiceServer(s grpc.ServiceRegistrar, srv IngestServiceServer) {
+	// If the following call pancis, it indicates UnimplementedIngestServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IngestService_ServiceDesc, srv)
+}
+
+func _IngestService_ValidatePi_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidatePiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).ValidatePi(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_ValidatePi_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).ValidatePi(ctx, req.(*ValidatePiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IngestService_ValidateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).ValidateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_ValidateDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).ValidateDevice(ctx, req.(*ValidateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IngestService_CreateReadings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServiceServer).CreateReadings(&grpc.GenericServerStream[Reading, CreateReadingsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IngestService_CreateReadingsServer = grpc.ClientStreamingServer[Reading, CreateReadingsResponse]
+
+// IngestService_ServiceDesc is the grpc.ServiceDesc for IngestService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IngestService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mptt.ingest.v1.IngestService",
+	HandlerType: (*IngestServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ValidatePi",
+			Handler:    _IngestService_ValidatePi_Handler,
+		},
+		{
+			MethodName: "ValidateDevice",
+			Handler:    _IngestService_ValidateDevice_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateReadings",
+			Handler:       _IngestService_CreateReadings_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
@@ -0,0 +1,339 @@
+package ingest_models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// Request and response bodies of the /internal endpoints the ingestor calls. The
+// API binds requests into these types and the ingestor's client sends them, so
+// the JSON tags here are the wire format for both sides.
+
+// ValidatePiRequest represents the request to validate a Pi
+type ValidatePiRequest struct {
+	PiID string `json:"pi_id" binding:"required"`
+}
+
+// Pi validation statuses
+const (
+	PiStatusOK         = "ok"
+	PiStatusNotFound   = "not_found"
+	PiStatusUnassigned = "unassigned" // Pi exists but has no owner and INGEST_REQUIRE_OWNED_PI is set
+)
+
+// ValidatePiResponse represents the response from Pi validation. Status is empty
+// from API services that predate it; Exists is then the only signal.
+type ValidatePiResponse struct {
+	Exists bool   `json:"exists"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidateDeviceRequest represents the request to validate a Device. Device
+// IDs start at 0, so DeviceID is a pointer to tell 0 from a missing field.
+type ValidateDeviceRequest struct {
+	PiID     string `json:"pi_id" binding:"required"`
+	DeviceID *int   `json:"device_id" binding:"required,min=0"`
+}
+
+// ValidateDeviceResponse represents the response from Device validation
+type ValidateDeviceResponse struct {
+	Exists bool   `json:"exists"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidateItem is a Pi, and one of its devices, to validate in a batch.
+// Without a DeviceID only the Pi is validated.
+type ValidateItem struct {
+	PiID     string `json:"pi_id" binding:"required"`
+	DeviceID *int   `json:"device_id,omitempty" binding:"omitempty,min=0"`
+}
+
+// ValidateBatchRequest validates the Pis and devices of a whole ingest flush
+// in one call. Items may repeat.
+type ValidateBatchRequest struct {
+	Items []ValidateItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// ValidateResult is the outcome for one item of a batch. PiStatus is one of
+// the PiStatus* values; DeviceExists is only true when the Pi exists too.
+type ValidateResult struct {
+	PiID         string `json:"pi_id"`
+	DeviceID     *int   `json:"device_id,omitempty"`
+	PiExists     bool   `json:"pi_exists"`
+	PiStatus     string `json:"pi_status"`
+	DeviceExists bool   `json:"device_exists"`
+}
+
+// ValidateBatchResponse holds one result per request item, in request order
+type ValidateBatchResponse struct {
+	Results []ValidateResult `json:"results"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// RegistryPi is a Pi and the IDs of its devices in a registry snapshot
+type RegistryPi struct {
+	PiID      string `json:"pi_id"`
+	DeviceIDs []int  `json:"device_ids"`
+}
+
+// RegistrySnapshotResponse is a page of the Pis readings are accepted for.
+// NextCursor is set while there may be more pages.
+type RegistrySnapshotResponse struct {
+	Pis        []RegistryPi `json:"pis"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// IngestErrorReport is an error the ingestor published to a Pi, reported to the
+// API so the Pi's rejection history is kept. DeviceID is as the Pi sent it,
+// which may not be a number; Ts is when the ingestor raised the error.
+type IngestErrorReport struct {
+	PiID          string    `json:"pi_id" binding:"required"`
+	DeviceID      string    `json:"device_id"`
+	ErrorType     string    `json:"error_type" binding:"required"`
+	Message       string    `json:"message"`
+	Topic         string    `json:"topic,omitempty"`
+	AffectedCount int       `json:"affected_count,omitempty" binding:"min=0"`
+	Ts            time.Time `json:"ts" binding:"required"`
+}
+
+// IngestErrorBatchRequest reports several ingestor errors in one request
+type IngestErrorBatchRequest struct {
+	Errors []IngestErrorReport `json:"errors" binding:"required,min=1,dive"`
+}
+
+// IngestErrorsResponse counts the reports stored
+type IngestErrorsResponse struct {
+	Stored int    `json:"stored"`
+	Error  string `json:"error,omitempty"`
+}
+
+// IngestErrorRecord is a stored ingestor error, as listed for a Pi
+type IngestErrorRecord struct {
+	ErrorID       int64     `json:"error_id"`
+	PiID          string    `json:"pi_id"`
+	DeviceID      string    `json:"device_id"`
+	ErrorType     string    `json:"error_type"`
+	Message       string    `json:"message"`
+	Topic         string    `json:"topic,omitempty"`
+	AffectedCount int       `json:"affected_count"`
+	Ts            time.Time `json:"ts"`
+	ReceivedAt    time.Time `json:"received_at"`
+}
+
+// CreateReadingRequest represents the request to create a reading. Ts is the
+// measurement time; ReceivedAt, when set, is when the reading first reached the
+// platform (e.g. for spool replays and imports) and otherwise defaults to now.
+// Both are TimeValues so the API can accept every form ParseTime does,
+// including epoch numbers. DeviceID is a pointer so device 0 is accepted.
+type CreateReadingRequest struct {
+	PiID       string                 `json:"pi_id" binding:"required"`
+	DeviceID   *int                   `json:"device_id" binding:"required,min=0"`
+	Ts         TimeValue              `json:"ts" binding:"required"`
+	Payload    map[string]interface{} `json:"payload" binding:"required"`
+	ReceivedAt TimeValue              `json:"received_at,omitempty"`
+}
+
+// NewCreateReadingRequest builds the request for reading, formatting its times as RFC3339 UTC.
+// Full precision is sent; the API truncates to its configured precision.
+func NewCreateReadingRequest(reading hardware_models.Reading) CreateReadingRequest {
+	req := CreateReadingRequest{
+		PiID:     reading.PiID,
+		DeviceID: &reading.DeviceID,
+		Ts:       TimeValue(reading.Ts.UTC().Format(time.RFC3339Nano)),
+		Payload:  reading.Payload,
+	}
+	if reading.ReceivedAt != nil {
+		req.ReceivedAt = TimeValue(reading.ReceivedAt.UTC().Format(time.RFC3339Nano))
+	}
+	return req
+}
+
+// CreateReadingResponse represents the response from reading creation.
+// Violations lists how the payload failed its device type's schema, both for
+// rejected readings and for readings stored with a flag.
+type CreateReadingResponse struct {
+	Success    bool                              `json:"success"`
+	Error      string                            `json:"error,omitempty"`
+	Violations []hardware_models.SchemaViolation `json:"violations,omitempty"`
+}
+
+// CreateReadingsRequest creates a batch of readings in one call
+type CreateReadingsRequest struct {
+	Readings []CreateReadingRequest `json:"readings" binding:"required,min=1,dive"`
+}
+
+// Reasons a reading of a batch was not stored
+const (
+	ReadingFailureInvalid         = "invalid"          // a timestamp could not be parsed
+	ReadingFailureSchemaViolation = "schema_violation" // rejected by the device type's payload schema
+	ReadingFailureDeviceNotFound  = "device_not_found" // the device no longer exists for the Pi
+	ReadingFailureDuplicate       = "duplicate"        // the device already has a reading at ts
+)
+
+// ReadingFailure is a reading of a batch that was not stored. Index is its
+// position in the request's readings.
+type ReadingFailure struct {
+	Index      int                               `json:"index"`
+	PiID       string                            `json:"pi_id"`
+	DeviceID   int                               `json:"device_id"`
+	Ts         string                            `json:"ts"`
+	Reason     string                            `json:"reason"`
+	Error      string                            `json:"error"`
+	Violations []hardware_models.SchemaViolation `json:"violations,omitempty"`
+}
+
+// CreateReadingsResponse reports a batch's outcome. Readings not listed in
+// Failed were stored.
+type CreateReadingsResponse struct {
+	Inserted int              `json:"inserted"`
+	Failed   []ReadingFailure `json:"failed,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// DiscoveredDeviceRequest reports a device a Pi announced on its discovery topic
+type DiscoveredDeviceRequest struct {
+	PiID       string `json:"pi_id" binding:"required"`
+	DeviceID   *int   `json:"device_id" binding:"required,min=0"`
+	DeviceType string `json:"device_type" binding:"required"`
+	Firmware   string `json:"firmware,omitempty"`
+}
+
+// Discovery outcomes
+const (
+	DiscoveryStatusPending    = "pending"      // recorded, or refreshed, as awaiting approval
+	DiscoveryStatusRegistered = "registered"   // the device already exists; nothing recorded
+	DiscoveryStatusPiNotFound = "pi_not_found" // the announcing Pi is unknown
+)
+
+// DiscoveredDeviceResponse represents the outcome of a discovery report
+type DiscoveredDeviceResponse struct {
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AutoRegisterDeviceRequest asks for a device to be created when its first
+// reading arrives, for ingestors with INGESTOR_AUTO_REGISTER_DEVICES set
+type AutoRegisterDeviceRequest struct {
+	PiID       string `json:"pi_id" binding:"required"`
+	DeviceID   *int   `json:"device_id" binding:"required,min=0"`
+	DeviceType string `json:"device_type" binding:"required,max=255"`
+}
+
+// Auto-registration outcomes
+const (
+	AutoRegisterStatusCreated    = "created"      // the device was created
+	AutoRegisterStatusExists     = "exists"       // the device already existed, e.g. created by a concurrent request
+	AutoRegisterStatusPiNotFound = "pi_not_found" // the Pi is unknown; Pis are never auto-created
+)
+
+// AutoRegisterDeviceResponse represents the outcome of an auto-registration
+type AutoRegisterDeviceResponse struct {
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DeviceMetaAutoRegistered marks the meta of a device created by auto-registration
+const DeviceMetaAutoRegistered = "auto_registered"
+
+// LivenessEntry summarises one device's readings written in an ingest flush:
+// the newest reading time and how many were written
+type LivenessEntry struct {
+	PiID     string    `json:"pi_id" binding:"required"`
+	DeviceID *int      `json:"device_id" binding:"required,min=0"`
+	LastTs   time.Time `json:"last_ts" binding:"required"`
+	Count    int       `json:"count" binding:"min=1"`
+}
+
+// LivenessRequest is sent once per flush, with one entry per device written
+type LivenessRequest struct {
+	Entries []LivenessEntry `json:"entries" binding:"required,min=1,dive"`
+}
+
+// LivenessResponse reports how many devices and pis were touched; entries for
+// devices deleted since the flush are skipped
+type LivenessResponse struct {
+	Devices  int64  `json:"devices"`
+	Pis      int64  `json:"pis"`
+	Readings int    `json:"readings"`
+	Error    string `json:"error,omitempty"`
+}
+
+// IngestorHeartbeat is the periodic report each ingestor instance sends so
+// operators can see whether the shared subscription group is keeping up
+type IngestorHeartbeat struct {
+	InstanceID     string  `json:"instance_id" binding:"required,max=128"`
+	Version        string  `json:"version,omitempty"`
+	Commit         string  `json:"commit,omitempty"`
+	ClientID       string  `json:"client_id,omitempty"`
+	SharedGroup    string  `json:"shared_group,omitempty"`
+	Connected      bool    `json:"connected"`
+	DryRun         bool    `json:"dry_run,omitempty"`
+	QueueDepth     int     `json:"queue_depth" binding:"min=0"`
+	QueueCapacity  int     `json:"queue_capacity" binding:"min=0"`
+	ProcessingRate float64 `json:"processing_rate" binding:"min=0"` // readings per second since the previous heartbeat
+	LagSeconds     float64 `json:"lag_seconds" binding:"min=0"`     // estimated time to drain the queue at that rate
+}
+
+// TimeValue is a request timestamp as sent: a JSON string, or a JSON number
+// kept as its digits, so gateways sending epoch numbers bind as well as ones
+// sending RFC3339. It is parsed with ParseTime.
+type TimeValue string
+
+// UnmarshalJSON accepts a string or a number; null leaves v unchanged
+func (v *TimeValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*v = TimeValue(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return errors.New("timestamp must be a string or number")
+	}
+	*v = TimeValue(number)
+	return nil
+}
+
+// ParseTime parses a request timestamp into UTC at the configured precision.
+// RFC3339 with any offset is preferred; older layouts are still accepted, as
+// are Unix epoch seconds, milliseconds and microseconds, told apart by
+// magnitude as in ParsePayloadTime.
+func ParseTime(timeStr string) (time.Time, error) {
+	return ParsePayloadTime(timeStr)
+}
+
+// ErrorCodeMaintenance is the code of the 503 the API answers writes with while
+// maintenance mode is on. Clients should wait for Retry-After and try again.
+const ErrorCodeMaintenance = "maintenance"
+
+// Trailer metadata of a gRPC write refused during maintenance, which ends with
+// codes.Unavailable: the seconds to wait, as Retry-After, and the reason.
+// The reason is binary metadata so it may hold any text.
+const (
+	MetadataMaintenanceRetryAfter = "x-maintenance-retry-after"
+	MetadataMaintenanceReason     = "x-maintenance-reason-bin"
+)
+
+// MetadataRateLimitRetryAfter is the trailer of a gRPC call refused by the
+// rate limit, which ends with codes.ResourceExhausted: the seconds to wait, as
+// Retry-After. Without it, ResourceExhausted means the call was too large.
+const MetadataRateLimitRetryAfter = "x-rate-limit-retry-after"
+
+// MaintenanceResponse is the body of a request refused during maintenance
+type MaintenanceResponse struct {
+	Error     string     `json:"error"`
+	Code      string     `json:"code"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
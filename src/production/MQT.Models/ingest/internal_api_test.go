@@ -0,0 +1,166 @@
+package ingest_models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// roundTrip returns a test that marshals v and checks it unmarshals back equal
+func roundTrip[T any](v T) func(*testing.T) {
+	return func(t *testing.T) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var got T
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%s unmarshalled to %+v, want %+v", data, got, v)
+		}
+	}
+}
+
+// Every field of the shared DTOs survives a round trip, device 0 included.
+// Payload numbers are float64, as encoding/json decodes them.
+func TestInternalAPIRoundTrip(t *testing.T) {
+	zero, three := 0, 3
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	later := ts.Add(time.Minute)
+	violations := []hardware_models.SchemaViolation{{Path: "/t", Message: "must be a number"}}
+
+	tests := []struct {
+		name  string
+		check func(*testing.T)
+	}{
+		{name: "ValidatePiRequest", check: roundTrip(ValidatePiRequest{PiID: "pi-1"})},
+		{name: "ValidatePiResponse", check: roundTrip(ValidatePiResponse{Exists: true, Status: PiStatusUnassigned, Error: "unowned"})},
+		{name: "ValidateDeviceRequest", check: roundTrip(ValidateDeviceRequest{PiID: "pi-1", DeviceID: &zero})},
+		{name: "ValidateDeviceResponse", check: roundTrip(ValidateDeviceResponse{Exists: true, Error: "x"})},
+		{name: "ValidateBatchRequest", check: roundTrip(ValidateBatchRequest{Items: []ValidateItem{{PiID: "pi-1", DeviceID: &zero}, {PiID: "pi-2"}}})},
+		{name: "ValidateBatchResponse", check: roundTrip(ValidateBatchResponse{Results: []ValidateResult{
+			{PiID: "pi-1", DeviceID: &zero, PiExists: true, PiStatus: PiStatusOK, DeviceExists: true},
+			{PiID: "pi-2", PiStatus: PiStatusNotFound},
+		}, Error: "partial"})},
+		{name: "RegistrySnapshotResponse", check: roundTrip(RegistrySnapshotResponse{Pis: []RegistryPi{{PiID: "pi-1", DeviceIDs: []int{0, 3}}}, NextCursor: "pi-1", Error: "x"})},
+		{name: "IngestErrorBatchRequest", check: roundTrip(IngestErrorBatchRequest{Errors: []IngestErrorReport{
+			{PiID: "pi-1", DeviceID: "abc", ErrorType: "invalid_device_id", Message: "not a number", Topic: "sensors/pi-1/abc/t", AffectedCount: 4, Ts: ts},
+		}})},
+		{name: "IngestErrorsResponse", check: roundTrip(IngestErrorsResponse{Stored: 2, Error: "x"})},
+		{name: "IngestErrorRecord", check: roundTrip(IngestErrorRecord{ErrorID: 1 << 40, PiID: "pi-1", DeviceID: "3", ErrorType: "device_not_found", Message: "m", Topic: "t", AffectedCount: 1, Ts: ts, ReceivedAt: later})},
+		{name: "CreateReadingRequest", check: roundTrip(CreateReadingRequest{PiID: "pi-1", DeviceID: &zero, Ts: "1709294400.123", Payload: map[string]interface{}{"t": 21.5, "ok": true, "gps": map[string]interface{}{"lat": 1.5}}, ReceivedAt: "2024-03-01T12:01:00Z"})},
+		{name: "CreateReadingResponse", check: roundTrip(CreateReadingResponse{Success: true, Error: "x", Violations: violations})},
+		{name: "CreateReadingsRequest", check: roundTrip(CreateReadingsRequest{Readings: []CreateReadingRequest{
+			{PiID: "pi-1", DeviceID: &zero, Ts: "2024-03-01T12:00:00.123Z", Payload: map[string]interface{}{"t": 21.5}},
+			{PiID: "pi-1", DeviceID: &three, Ts: "2024-03-01T12:00:00Z", Payload: map[string]interface{}{}},
+		}})},
+		{name: "CreateReadingsResponse", check: roundTrip(CreateReadingsResponse{Inserted: 1, Failed: []ReadingFailure{
+			{Index: 1, PiID: "pi-1", DeviceID: 3, Ts: "2024-03-01T12:00:00.000Z", Reason: ReadingFailureSchemaViolation, Error: "schema", Violations: violations},
+		}, Error: "x"})},
+		{name: "DiscoveredDeviceRequest", check: roundTrip(DiscoveredDeviceRequest{PiID: "pi-1", DeviceID: &zero, DeviceType: "thermometer", Firmware: "1.2"})},
+		{name: "DiscoveredDeviceResponse", check: roundTrip(DiscoveredDeviceResponse{Status: DiscoveryStatusPending, Error: "x"})},
+		{name: "AutoRegisterDeviceRequest", check: roundTrip(AutoRegisterDeviceRequest{PiID: "pi-1", DeviceID: &zero, DeviceType: "thermometer"})},
+		{name: "AutoRegisterDeviceResponse", check: roundTrip(AutoRegisterDeviceResponse{Status: AutoRegisterStatusExists, Error: "x"})},
+		{name: "LivenessRequest", check: roundTrip(LivenessRequest{Entries: []LivenessEntry{{PiID: "pi-1", DeviceID: &zero, LastTs: ts, Count: 2}}})},
+		{name: "LivenessResponse", check: roundTrip(LivenessResponse{Devices: 2, Pis: 1, Readings: 5, Error: "x"})},
+		{name: "IngestorHeartbeat", check: roundTrip(IngestorHeartbeat{InstanceID: "ingestor-1", Version: "1.4.0", Commit: "abc123", ClientID: "c", SharedGroup: "g", Connected: true, DryRun: true, QueueDepth: 10, QueueCapacity: 100, ProcessingRate: 12.5, LagSeconds: 0.8})},
+		{name: "MaintenanceResponse", check: roundTrip(MaintenanceResponse{Error: "maintenance", Code: ErrorCodeMaintenance, Reason: "migration", ExpiresAt: &later})},
+		{name: "ReadingEnvelope", check: roundTrip(ReadingEnvelope{PiID: "pi-1", DeviceID: "03", Topic: "sensors/pi-1/03/t", Payload: map[string]interface{}{"t": 21.5}, Ts: ts, ReceivedAt: later})},
+		{name: "IngestError", check: roundTrip(NewIngestError("device_not_found", "m", "pi-1", "3", "sensors/pi-1/3/t", ts))},
+		{name: "empty CreateReadingsResponse", check: roundTrip(CreateReadingsResponse{})},
+		{name: "ValidateItem without a device", check: roundTrip(ValidateItem{PiID: "pi-1"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.check)
+	}
+}
+
+// JSON as existing producers send it still decodes: API Services without
+// Pi statuses, gateways sending epoch numbers, and device 0
+func TestInternalAPIWireCompatibility(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		name   string
+		data   string
+		target interface{}
+		want   interface{}
+	}{
+		{
+			name:   "validate Pi response without a status",
+			data:   `{"exists":true}`,
+			target: &ValidatePiResponse{},
+			want:   &ValidatePiResponse{Exists: true},
+		},
+		{
+			name:   "reading with epoch number times",
+			data:   `{"pi_id":"pi-1","device_id":0,"ts":1709294400.123,"payload":{"t":21.5},"received_at":1709294460}`,
+			target: &CreateReadingRequest{},
+			want:   &CreateReadingRequest{PiID: "pi-1", DeviceID: &zero, Ts: "1709294400.123", Payload: map[string]interface{}{"t": 21.5}, ReceivedAt: "1709294460"},
+		},
+		{
+			name:   "reading with a null received_at",
+			data:   `{"pi_id":"pi-1","device_id":0,"ts":"2024-03-01T12:00:00Z","payload":{},"received_at":null}`,
+			target: &CreateReadingRequest{},
+			want:   &CreateReadingRequest{PiID: "pi-1", DeviceID: &zero, Ts: "2024-03-01T12:00:00Z", Payload: map[string]interface{}{}},
+		},
+		{
+			name:   "batch result without a device",
+			data:   `{"results":[{"pi_id":"pi-1","pi_exists":false,"pi_status":"not_found","device_exists":false}]}`,
+			target: &ValidateBatchResponse{},
+			want:   &ValidateBatchResponse{Results: []ValidateResult{{PiID: "pi-1", PiStatus: PiStatusNotFound}}},
+		},
+		{
+			name:   "ingest error before affected_count",
+			data:   `{"schema_version":1,"error_type":"invalid_json","message":"m","pi_id":"pi-1","device_id":"3","topic":"t","timestamp":"2024-03-01T12:00:00Z"}`,
+			target: &IngestError{},
+			want:   &IngestError{SchemaVersion: 1, ErrorType: "invalid_json", Message: "m", PiID: "pi-1", DeviceID: "3", Topic: "t", Timestamp: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.data), tt.target); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(tt.target, tt.want) {
+				t.Errorf("decoded %+v, want %+v", tt.target, tt.want)
+			}
+		})
+	}
+}
+
+// A reading sent by the client decodes on the API side to the same instant
+func TestNewCreateReadingRequestRoundTrip(t *testing.T) {
+	useMicrosecondPrecision(t)
+	receivedAt := time.Date(2024, 3, 1, 13, 0, 0, 0, time.FixedZone("CET", 3600))
+	reading := hardware_models.Reading{
+		PiID:       "pi-1",
+		DeviceID:   0,
+		Ts:         time.Date(2024, 3, 1, 14, 0, 0, 123456000, time.FixedZone("EET", 7200)),
+		Payload:    map[string]interface{}{"t": 21.5},
+		ReceivedAt: &receivedAt,
+	}
+
+	data, err := json.Marshal(NewCreateReadingRequest(reading))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var req CreateReadingRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if req.PiID != reading.PiID || req.DeviceID == nil || *req.DeviceID != 0 || !reflect.DeepEqual(req.Payload, reading.Payload) {
+		t.Errorf("decoded %+v from %s", req, data)
+	}
+	if ts, err := ParseTime(string(req.Ts)); err != nil || !ts.Equal(reading.Ts) {
+		t.Errorf("ts decoded to %v, %v, want %v", ts, err, reading.Ts)
+	}
+	if got, err := ParseTime(string(req.ReceivedAt)); err != nil || !got.Equal(receivedAt) {
+		t.Errorf("received_at decoded to %v, %v, want %v", got, err, receivedAt)
+	}
+}
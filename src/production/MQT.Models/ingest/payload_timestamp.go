@@ -0,0 +1,103 @@
+package ingest_models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// epochMillisThreshold separates epoch seconds from epoch milliseconds: a
+// value this large in seconds is past the year 5000, while in milliseconds it
+// is March 1973, before any device could have recorded it
+const epochMillisThreshold = 100_000_000_000
+
+// epochMicrosThreshold does the same for milliseconds and microseconds: this
+// many milliseconds is past the year 5000 too
+const epochMicrosThreshold = 100_000_000_000_000
+
+// PayloadTimestamp reads the measurement time a device put in its payload
+// under field. It reports false when the field is absent, and an error when it
+// is present but not a timestamp. See ParsePayloadTime for the accepted forms.
+func PayloadTimestamp(payload map[string]interface{}, field string) (time.Time, bool, error) {
+	value, ok := payload[field]
+	if !ok || field == "" {
+		return time.Time{}, false, nil
+	}
+	ts, err := ParsePayloadTime(value)
+	return ts, true, err
+}
+
+// ParsePayloadTime parses a timestamp sent by a device: an RFC3339 string (or
+// one of the layouts hardware_models.ParseTimestamp accepts), or Unix epoch
+// seconds, milliseconds or microseconds as a number or numeric string. Epoch
+// values are read as milliseconds from epochMillisThreshold up and as
+// microseconds from epochMicrosThreshold up.
+func ParsePayloadTime(value interface{}) (time.Time, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case json.Number:
+		text = v.String()
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return time.Time{}, fmt.Errorf("timestamp must be a string or number, got %T", value)
+	}
+
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return parseEpochValue(text)
+	}
+	return hardware_models.ParseTimestamp(text)
+}
+
+// parseEpochValue parses a numeric timestamp in seconds, milliseconds or
+// microseconds, keeping the digits of the fraction instead of going through a
+// float where the value allows
+func parseEpochValue(text string) (time.Time, error) {
+	wholeStr, fracStr, _ := strings.Cut(text, ".")
+	whole, err := strconv.ParseInt(wholeStr, 10, 64)
+	if err != nil || strings.ContainsAny(fracStr, "eE+-") {
+		// Exponent notation, e.g. 1.7e+12
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return time.Time{}, fmt.Errorf("timestamp %s is out of range", text)
+		}
+		micros := f * 1e6
+		switch {
+		case math.Abs(f) >= epochMicrosThreshold:
+			micros = f
+		case math.Abs(f) >= epochMillisThreshold:
+			micros = f * 1e3
+		}
+		if math.Abs(micros) >= math.MaxInt64 {
+			return time.Time{}, fmt.Errorf("timestamp %s is out of range", text)
+		}
+		return hardware_models.NormalizeTimestamp(time.UnixMicro(int64(micros))), nil
+	}
+
+	// Milliseconds or microseconds: shift the point three or six places and
+	// parse as seconds
+	shift := 0
+	switch {
+	case whole >= epochMicrosThreshold || whole <= -epochMicrosThreshold:
+		shift = 6
+	case whole >= epochMillisThreshold || whole <= -epochMillisThreshold:
+		shift = 3
+	}
+	if shift > 0 {
+		sign := ""
+		if whole < 0 {
+			sign, wholeStr = "-", wholeStr[1:]
+		}
+		wholeStr = strings.TrimLeft(wholeStr, "0")
+		seconds, fraction := wholeStr[:len(wholeStr)-shift], wholeStr[len(wholeStr)-shift:]
+		text = sign + seconds + "." + fraction + fracStr
+	}
+	return hardware_models.ParseTimestamp(text)
+}
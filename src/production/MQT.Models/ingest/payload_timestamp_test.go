@@ -0,0 +1,126 @@
+package ingest_models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+// useMicrosecondPrecision keeps sub-millisecond digits for the test
+func useMicrosecondPrecision(t *testing.T) {
+	t.Helper()
+	if err := hardware_models.SetTimestampPrecision(time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hardware_models.SetTimestampPrecision(time.Millisecond) })
+}
+
+func TestParsePayloadTime(t *testing.T) {
+	useMicrosecondPrecision(t)
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) // 1709294400
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "rfc3339", value: "2024-03-01T12:00:00Z", want: noon},
+		{name: "rfc3339 with offset", value: "2024-03-01T13:00:00+01:00", want: noon},
+		{name: "rfc3339 with fraction", value: "2024-03-01T12:00:00.123456Z", want: noon.Add(123456 * time.Microsecond)},
+		{name: "older layout", value: "2024-03-01 12:00:00", want: noon},
+		{name: "padded string", value: " 2024-03-01T12:00:00Z ", want: noon},
+		{name: "seconds string", value: "1709294400", want: noon},
+		{name: "seconds with fraction", value: "1709294400.5", want: noon.Add(500 * time.Millisecond)},
+		{name: "seconds number", value: json.Number("1709294400"), want: noon},
+		{name: "seconds float", value: float64(1709294400), want: noon},
+		{name: "milliseconds string", value: "1709294400123", want: noon.Add(123 * time.Millisecond)},
+		{name: "milliseconds number", value: json.Number("1709294400123"), want: noon.Add(123 * time.Millisecond)},
+		{name: "milliseconds float", value: float64(1709294400123), want: noon.Add(123 * time.Millisecond)},
+		{name: "milliseconds with fraction", value: "1709294400123.5", want: noon.Add(123500 * time.Microsecond)},
+		{name: "milliseconds in exponent notation", value: json.Number("1.709294400123e12"), want: noon.Add(123 * time.Millisecond)},
+		{name: "microseconds", value: json.Number("1709294400123456"), want: noon.Add(123456 * time.Microsecond)},
+		{name: "microseconds with fraction", value: "1709294400123456.7", want: noon.Add(123456 * time.Microsecond)},
+		{name: "largest seconds", value: json.Number("99999999999"), want: time.Unix(99999999999, 0).UTC()},
+		{name: "smallest milliseconds", value: json.Number("100000000000"), want: time.Unix(100000000, 0).UTC()},
+		{name: "smallest microseconds", value: json.Number("100000000000000"), want: time.Unix(100000000, 0).UTC()},
+		{name: "words", value: "yesterday at noon", wantErr: true},
+		{name: "ambiguous date", value: "03/01/2024 12:00", wantErr: true},
+		{name: "digits and letters", value: "1709294400abc", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+		{name: "not a number", value: "NaN", wantErr: true},
+		{name: "infinite", value: "Inf", wantErr: true},
+		{name: "out of range", value: json.Number("1e300"), wantErr: true},
+		{name: "boolean", value: true, wantErr: true},
+		{name: "null", value: nil, wantErr: true},
+		{name: "object", value: map[string]interface{}{"seconds": 1709294400}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePayloadTime(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePayloadTime(%v) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePayloadTime(%v): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("ParsePayloadTime(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEpochValue(t *testing.T) {
+	useMicrosecondPrecision(t)
+
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"0", time.Unix(0, 0)},
+		{"-1", time.Unix(-1, 0)},
+		{"-1709294400123", time.Unix(-1709294400, -123*int64(time.Millisecond))},
+		{"00001709294400123", time.Unix(1709294400, 123*int64(time.Millisecond))},
+		{"1.7092944e9", time.Unix(1709294400, 0)},
+		{"1.709294400123456e15", time.Unix(1709294400, 123456*int64(time.Microsecond))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseEpochValue(tt.text)
+			if err != nil {
+				t.Fatalf("parseEpochValue(%s): %v", tt.text, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseEpochValue(%s) = %v, want %v", tt.text, got, tt.want.UTC())
+			}
+		})
+	}
+}
+
+func TestPayloadTimestamp(t *testing.T) {
+	payload := map[string]interface{}{"ts": json.Number("1709294400"), "bad": "soon"}
+	tests := []struct {
+		field     string
+		wantFound bool
+		wantErr   bool
+	}{
+		{field: "ts", wantFound: true},
+		{field: "bad", wantFound: true, wantErr: true},
+		{field: "missing"},
+		{field: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			_, found, err := PayloadTimestamp(payload, tt.field)
+			if found != tt.wantFound || (err != nil) != tt.wantErr {
+				t.Errorf("PayloadTimestamp(%q) found %v, error %v", tt.field, found, err)
+			}
+		})
+	}
+}
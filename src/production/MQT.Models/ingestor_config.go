@@ -1,18 +1,41 @@
 package mqtmodels
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// MinBatchWindow is the shortest BatchWindow accepted; shorter windows would
+// have the batch writer waking continuously to flush almost nothing
+const MinBatchWindow = 50 * time.Millisecond
 
 type IngestorConfig struct {
 	// MQTT
-	BrokerHost  string
-	BrokerPort  int
+	BrokerHost  string // one host or a comma-separated list for failover
+	BrokerPort  int    // used for brokers listed without a port
+	BrokerURLs  string // comma-separated broker URLs; takes precedence over BrokerHost
 	BrokerUser  string
 	BrokerPass  string
 	UseTLS      bool
 	CACertPath  string
-	Topic       string
+	Topic       string // one topic filter or a comma-separated list
 	ClientID    string
 	SharedGroup string // e.g., "ingestors" to enable $share group consumption
+	QoS         byte   // QoS requested for the reading and discovery subscriptions
+
+	ClientIDAutoSuffix bool // append the instance ID, or a random suffix, to ClientID so replicas don't take over each other's connection
+	CleanSession       bool // start each connection without the broker's stored session for ClientID
+
+	// MQTT connection tuning, e.g. for flaky cellular backhaul links
+	KeepAlive            time.Duration // interval between keepalive pings
+	PingTimeout          time.Duration // how long to wait for a ping response; must be below KeepAlive
+	ConnectRetryInterval time.Duration // wait between attempts at the initial connection
+	MaxReconnectInterval time.Duration // cap on the backoff between reconnect attempts
+	DisconnectQuiesce    time.Duration // time allowed for in-flight work on disconnect
+
+	// Device discovery
+	DiscoveryEnabled bool   // forward device announcements to the API as pending devices
+	DiscoveryTopic   string // e.g., "discovery/+"; the last level is the pi_id
 
 	// PostgreSQL
 	PostgresHost     string
@@ -23,8 +46,91 @@ type IngestorConfig struct {
 	PostgresSSLMode  string
 
 	// Ingestion
-	BatchSize   int
-	BatchWindow time.Duration
+	BatchSize            int
+	BatchWindow          time.Duration
+	Workers              int           // goroutines validating and writing flushed readings in parallel
+	QueueSize            int           // maximum readings waiting for the batch writer
+	QueueMaxBytes        int64         // estimated bytes of queued readings allowed; 0 disables the budget
+	QueueOverflowPolicy  string        // "block", "drop_newest", "drop_oldest" or "spool" when either queue limit is reached
+	QueueDegradedPercent int           // queue fill level (percent) at which health reports degraded
+	DryRun               bool          // run the full pipeline but skip the API writes, logging would_insert instead
+	ShutdownTimeout      time.Duration // how long Stop waits for the final flush before spooling what is left; 0 waits for Stop's context
+
+	// Per-Pi rate limiting of incoming messages
+	MaxMsgsPerPiPerSec float64       // messages per second accepted from one Pi; 0 is unlimited
+	RateLimitCooldown  time.Duration // least time between rate_limited errors published to one Pi
+
+	// Retained messages are redelivered on every reconnect; drop them, or store them marked "retained"
+	IgnoreRetained bool
+
+	// Payload decoding
+	PayloadFormat        string // "json", "cbor" or "auto" (JSON, falling back to CBOR)
+	MaxDecompressedBytes int64  // largest a gzip payload may decompress to
+	StoreInvalidAsRaw    bool   // store payloads that don't decode under "raw", as before payload formats, instead of dropping them
+
+	// Reading timestamps
+	PayloadTimestampField string        // payload field holding the measurement time; "" always uses the receive time
+	MaxTimestampSkew      time.Duration // how far ahead of the receive time a payload timestamp may be
+	MaxPayloadReadings    int           // most readings accepted in one array payload
+
+	// Duplicate readings from gateways that retransmit on reconnect
+	DedupWindow     time.Duration // ts window within which equal payloads from a device are duplicates; 0 disables
+	DedupMaxEntries int           // readings remembered for deduplication
+
+	// Create unknown devices of known Pis on their first reading; Pis are never created
+	AutoRegisterDevices bool
+
+	// Pi and device validation cache
+	ValidationCacheTTL         time.Duration // how long a Pi or device that passed validation is trusted; 0 disables caching
+	ValidationCacheNegativeTTL time.Duration // how long a failed validation is remembered; 0 disables negative caching
+	RegistrySnapshot           bool          // fill the cache from the API's registry snapshot on start
+	RegistryRefreshInterval    time.Duration // how often Pis and devices registered since are fetched; 0 disables refreshes
+	CacheInvalidationTopic     string        // the API's signed invalidation events, which evict entries at once; "" disables, and needs ControlSecret
+
+	// API client; zero or negative values fall back to the client's defaults
+	APIClientTimeout         time.Duration // limit on one request to the API service
+	APIClientMaxRetries      int           // retries after a failed call; 0 makes one attempt
+	APIClientRetryDelay      time.Duration // backoff before the first retry, doubled for each one after
+	APIClientBreakerFailures int           // consecutive failures that open the circuit breaker
+	APIClientBreakerReset    time.Duration // how long the open breaker refuses calls before probing
+	CircuitHalfOpenProbes    int           // calls let through to probe the API once the breaker's reset timeout has passed
+	APIClientMaxIdleConns    int           // keep-alive connections kept to the API service
+	APIClientIdleConnTimeout time.Duration // how long an unused keep-alive connection is kept
+	APITransport             string        // "http" or "grpc" for Pi and device validation and reading writes
+	APIGRPCAddr              string        // host:port of the API's gRPC service, used with APITransport "grpc"
+
+	// Dead-letter spool for readings the API couldn't take
+	SpoolDir            string        // directory of spooled readings; "" disables spooling
+	SpoolMaxBytes       int64         // cap on all spool files together; readings past it are dropped
+	SpoolFileMaxBytes   int64         // size at which a spool file is rotated
+	SpoolReplayInterval time.Duration // how often spooled readings are replayed once the API is back
+
+	// Error feedback
+	PublishErrors      bool   // publish errors back to Pis on the error topic
+	ErrorBufferSize    int    // number of recent errors kept for the health endpoint
+	ErrorTopicTemplate string // e.g., "ingestor/errors/{pi_id}/{device_id}"
+	ErrorQoS           byte
+	ErrorRetained      bool
+	ReportErrors       bool   // also send every error to the API, which keeps each Pi's history
+	ErrorReportBuffer  int    // errors waiting to be sent to the API; more are dropped
+	SchemaErrorType    string // error_type for readings a payload schema rejects: "schema_violation" or its alias "schema_validation_failed"
+
+	// Online/offline status published retained for anything watching the broker
+	StatusEnabled       bool   // publish the status and register the offline Last Will
+	StatusTopicTemplate string // e.g., "ingestor/status/{client_id}"; {instance_id} is also replaced
+
+	// Runtime changes to the batch and subscription settings, published on the control topic
+	ControlEnabled       bool   // subscribe to the control topic; needs ControlSecret
+	ControlTopicTemplate string // e.g., "ingestor/control/{client_id}"; acks go to its /ack subtopic
+	ControlSecret        string // INTERNAL_API_SECRET, which every command must carry
+
+	// Coordination heartbeats to the API's /admin/ingestors view
+	InstanceID        string        // identifies this replica; defaults to the hostname
+	HeartbeatInterval time.Duration // 0 disables heartbeats
+
+	// Debug endpoints
+	MaxTrackedPis int    // Pis kept in the per-Pi failure tracker (least recently failed evicted first)
+	DebugToken    string // bearer token required for /debug/* on the health server; empty disables the check
 }
 
 // NewIngestorConfig returns a new IngestorConfig with sensible defaults
@@ -35,6 +141,16 @@ func NewIngestorConfig() *IngestorConfig {
 		UseTLS:     true,
 		Topic:      "sensors/+/+/+", // pi_id/device_id/reading format
 		ClientID:   "mqtt-ingestor",
+		QoS:        1,
+
+		KeepAlive:            30 * time.Second,
+		PingTimeout:          10 * time.Second,
+		ConnectRetryInterval: 5 * time.Second,
+		MaxReconnectInterval: 10 * time.Minute,
+		DisconnectQuiesce:    500 * time.Millisecond,
+
+		DiscoveryEnabled: true,
+		DiscoveryTopic:   "discovery/+",
 
 		// PostgreSQL defaults
 		PostgresPort:    5432,
@@ -43,5 +159,169 @@ func NewIngestorConfig() *IngestorConfig {
 		// Ingestion defaults
 		BatchSize:   1000,            // Batch 1000 readings at a time
 		BatchWindow: 5 * time.Second, // Or flush every 5 seconds
+		Workers:     4,
+
+		QueueSize:            4096,
+		QueueMaxBytes:        64 << 20,
+		QueueOverflowPolicy:  "block",
+		QueueDegradedPercent: 80,
+		ShutdownTimeout:      20 * time.Second,
+
+		RateLimitCooldown: time.Minute,
+
+		IgnoreRetained: true,
+
+		PayloadFormat:        "json",
+		MaxDecompressedBytes: 1 << 20,
+
+		PayloadTimestampField: "ts",
+		MaxTimestampSkew:      5 * time.Minute,
+		MaxPayloadReadings:    500,
+
+		DedupMaxEntries: 100000,
+
+		ValidationCacheTTL:         5 * time.Minute,
+		ValidationCacheNegativeTTL: 30 * time.Second,
+		RegistrySnapshot:           true,
+		RegistryRefreshInterval:    5 * time.Minute,
+
+		APIClientTimeout:         30 * time.Second,
+		APIClientMaxRetries:      3,
+		APIClientRetryDelay:      time.Second,
+		APIClientBreakerFailures: 5,
+		APIClientBreakerReset:    30 * time.Second,
+		CircuitHalfOpenProbes:    1,
+		APIClientMaxIdleConns:    32,
+		APIClientIdleConnTimeout: 90 * time.Second,
+		APITransport:             "http",
+
+		SpoolMaxBytes:       256 << 20,
+		SpoolFileMaxBytes:   8 << 20,
+		SpoolReplayInterval: 30 * time.Second,
+
+		// Error feedback defaults
+		PublishErrors:      true,
+		ErrorBufferSize:    50,
+		ErrorTopicTemplate: "ingestor/errors/{pi_id}/{device_id}",
+		ErrorQoS:           1,
+		ReportErrors:       true,
+		ErrorReportBuffer:  256,
+		SchemaErrorType:    "schema_violation",
+
+		StatusEnabled:       true,
+		StatusTopicTemplate: "ingestor/status/{client_id}",
+
+		ControlEnabled:       true,
+		ControlTopicTemplate: "ingestor/control/{client_id}",
+
+		HeartbeatInterval: 15 * time.Second,
+
+		MaxTrackedPis: 1000,
+	}
+}
+
+// Brokers returns the URLs of the brokers to connect to, in the order they are
+// tried
+func (c IngestorConfig) Brokers() ([]string, error) {
+	list := c.BrokerURLs
+	if list == "" {
+		list = c.BrokerHost
+	}
+	return ParseBrokerURLs(list, c.BrokerPort, c.UseTLS)
+}
+
+// Topics returns the topic filters readings are subscribed on
+func (c IngestorConfig) Topics() []string {
+	return ParseTopicFilters(c.Topic)
+}
+
+// ValidateBatching checks the batch writer settings. A batch must hold at
+// least one reading, as must an array payload, the flush window must be at
+// least MinBatchWindow, and the timestamp skew and validation cache TTLs must
+// not be negative.
+func (c IngestorConfig) ValidateBatching() error {
+	if c.BatchSize < 1 {
+		return fmt.Errorf("BATCH_SIZE must be at least 1, got %d", c.BatchSize)
+	}
+	if c.BatchWindow < MinBatchWindow {
+		return fmt.Errorf("BATCH_WINDOW must be at least %s, got %s", MinBatchWindow, c.BatchWindow)
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("INGESTOR_WORKERS must be at least 1, got %d", c.Workers)
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("INGESTOR_SHUTDOWN_TIMEOUT must not be negative, got %s", c.ShutdownTimeout)
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("QUEUE_SIZE must not be negative, got %d", c.QueueSize)
+	}
+	if c.MaxPayloadReadings < 1 {
+		return fmt.Errorf("MAX_PAYLOAD_READINGS must be at least 1, got %d", c.MaxPayloadReadings)
+	}
+	if c.MaxDecompressedBytes < 1 {
+		return fmt.Errorf("INGESTOR_MAX_DECOMPRESSED_BYTES must be at least 1, got %d", c.MaxDecompressedBytes)
+	}
+	if c.MaxTimestampSkew < 0 {
+		return fmt.Errorf("MAX_TIMESTAMP_SKEW must not be negative, got %s", c.MaxTimestampSkew)
+	}
+	if c.MaxMsgsPerPiPerSec < 0 {
+		return fmt.Errorf("INGESTOR_MAX_MSGS_PER_PI_PER_SEC must not be negative, got %g", c.MaxMsgsPerPiPerSec)
+	}
+	if c.RateLimitCooldown < 0 {
+		return fmt.Errorf("INGESTOR_RATE_LIMIT_COOLDOWN must not be negative, got %s", c.RateLimitCooldown)
+	}
+	if c.DedupWindow < 0 {
+		return fmt.Errorf("INGESTOR_DEDUP_WINDOW must not be negative, got %s", c.DedupWindow)
+	}
+	if c.DedupWindow > 0 && c.DedupMaxEntries < 1 {
+		return fmt.Errorf("INGESTOR_DEDUP_MAX_ENTRIES must be at least 1, got %d", c.DedupMaxEntries)
+	}
+	if c.ValidationCacheTTL < 0 || c.ValidationCacheNegativeTTL < 0 {
+		return fmt.Errorf("VALIDATION_CACHE_TTL and VALIDATION_CACHE_NEGATIVE_TTL must not be negative")
+	}
+	if c.ReportErrors && c.ErrorReportBuffer < 1 {
+		return fmt.Errorf("INGESTOR_ERROR_REPORT_BUFFER must be at least 1, got %d", c.ErrorReportBuffer)
+	}
+	if c.RegistryRefreshInterval < 0 {
+		return fmt.Errorf("INGESTOR_REGISTRY_REFRESH_INTERVAL must not be negative, got %s", c.RegistryRefreshInterval)
+	}
+	if c.QueueOverflowPolicy == "spool" && c.SpoolDir == "" {
+		return fmt.Errorf("INGESTOR_OVERFLOW=spool needs INGEST_SPOOL_DIR")
+	}
+	if c.SpoolDir != "" {
+		if c.SpoolFileMaxBytes < 1 || c.SpoolMaxBytes < c.SpoolFileMaxBytes {
+			return fmt.Errorf("INGEST_SPOOL_FILE_MAX_BYTES must be positive and at most INGEST_SPOOL_MAX_BYTES, got %d and %d", c.SpoolFileMaxBytes, c.SpoolMaxBytes)
+		}
+		if c.SpoolReplayInterval <= 0 {
+			return fmt.Errorf("INGEST_SPOOL_REPLAY_INTERVAL must be positive, got %s", c.SpoolReplayInterval)
+		}
+	}
+	return nil
+}
+
+// ValidateConnection checks the broker list and topic filters, and that the
+// MQTT connection timings are usable together
+func (c IngestorConfig) ValidateConnection() error {
+	if _, err := c.Brokers(); err != nil {
+		return fmt.Errorf("BROKER_URLS or BROKER_HOST: %w", err)
+	}
+	if len(c.Topics()) == 0 {
+		return fmt.Errorf("MQTT_TOPIC must list at least one topic filter")
+	}
+	if c.KeepAlive < time.Second {
+		return fmt.Errorf("MQTT_KEEP_ALIVE must be at least 1s")
+	}
+	if c.PingTimeout <= 0 || c.PingTimeout >= c.KeepAlive {
+		return fmt.Errorf("MQTT_PING_TIMEOUT must be positive and shorter than MQTT_KEEP_ALIVE")
+	}
+	if c.ConnectRetryInterval <= 0 {
+		return fmt.Errorf("MQTT_CONNECT_RETRY_INTERVAL must be positive")
+	}
+	if c.MaxReconnectInterval < c.ConnectRetryInterval {
+		return fmt.Errorf("MQTT_MAX_RECONNECT_INTERVAL must not be shorter than MQTT_CONNECT_RETRY_INTERVAL")
+	}
+	if c.DisconnectQuiesce < 0 || c.DisconnectQuiesce > time.Minute {
+		return fmt.Errorf("MQTT_DISCONNECT_QUIESCE must be between 0 and 1m")
 	}
+	return nil
 }
@@ -0,0 +1,88 @@
+package notification_models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Digest modes: send each notification as it happens, or batch them into one
+// summary per channel at the end of each hour or day in the user's timezone
+const (
+	DigestImmediate = "immediate"
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+)
+
+// ClockLayout is the layout of quiet hour bounds, e.g. "22:00"
+const ClockLayout = "15:04"
+
+// Preferences decide how and when a user is notified. Quiet hours defer
+// non-critical notifications to the end of the window; they may wrap past
+// midnight, and leaving both bounds empty disables them.
+type Preferences struct {
+	UserID          string    `json:"user_id" db:"user_id"`
+	Channels        []string  `json:"channels" db:"channels"` // empty uses NOTIFY_DEFAULT_CHANNELS
+	DigestMode      string    `json:"digest_mode" db:"digest_mode"`
+	QuietHoursStart string    `json:"quiet_hours_start,omitempty" db:"quiet_hours_start"`
+	QuietHoursEnd   string    `json:"quiet_hours_end,omitempty" db:"quiet_hours_end"`
+	Timezone        string    `json:"timezone" db:"timezone"` // IANA name, e.g. "Europe/Berlin"
+	UpdatedAt       time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// DefaultPreferences are used for users who never set any: every notification
+// is sent right away on the default channels
+func DefaultPreferences(userID string) Preferences {
+	return Preferences{
+		UserID:     userID,
+		Channels:   []string{},
+		DigestMode: DigestImmediate,
+		Timezone:   "UTC",
+	}
+}
+
+// Validate checks the digest mode, timezone and quiet hours. Channel names are
+// checked by the notifier, which knows which channels exist.
+func (p Preferences) Validate() error {
+	switch p.DigestMode {
+	case DigestImmediate, DigestHourly, DigestDaily:
+	default:
+		return fmt.Errorf("digest_mode must be immediate, hourly or daily")
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "" {
+		return fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+	}
+	if (p.QuietHoursStart == "") != (p.QuietHoursEnd == "") {
+		return fmt.Errorf("quiet_hours_start and quiet_hours_end must be set together")
+	}
+	for _, bound := range []string{p.QuietHoursStart, p.QuietHoursEnd} {
+		if bound == "" {
+			continue
+		}
+		if _, err := time.Parse(ClockLayout, bound); err != nil {
+			return fmt.Errorf("quiet hours must be given as HH:MM")
+		}
+	}
+	return nil
+}
+
+// PendingNotification is a notification held back for a digest or until quiet
+// hours end
+type PendingNotification struct {
+	EventID   int64                  `json:"event_id" db:"event_id"`
+	UserID    string                 `json:"user_id" db:"user_id"`
+	Channel   string                 `json:"channel" db:"channel"`
+	Kind      string                 `json:"kind" db:"kind"`
+	Subject   string                 `json:"subject" db:"subject"`
+	Body      string                 `json:"body" db:"body"`
+	Data      map[string]interface{} `json:"data,omitempty" db:"data"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+}
+
+// PendingRecipient is a user and channel with held-back notifications, and how
+// far their digests have been sent
+type PendingRecipient struct {
+	UserID          string
+	Email           string
+	Channel         string
+	DispatchedUntil time.Time // notifications created before this were sent
+}
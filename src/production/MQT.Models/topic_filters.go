@@ -0,0 +1,41 @@
+package mqtmodels
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseTopicFilters splits a comma-separated list of MQTT topic filters, as
+// MQTT_TOPIC may hold, dropping blanks and repeats
+func ParseTopicFilters(list string) []string {
+	var filters []string
+	seen := make(map[string]bool)
+	for _, filter := range strings.Split(list, ",") {
+		filter = strings.TrimSpace(filter)
+		if filter == "" || seen[filter] {
+			continue
+		}
+		seen[filter] = true
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// ValidateTopicFilter checks that filter is a usable MQTT subscription filter:
+// not empty, with "+" only as a whole level and "#" only as the whole last one
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("topic filter is empty")
+	}
+	levels := strings.Split(filter, "/")
+	for n, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || n != len(levels)-1) {
+			return fmt.Errorf("topic filter %q: # must be the whole last level", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("topic filter %q: + must be a whole level", filter)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package conformance is the behaviour every backend of the Pi, device and
+// reading repositories must share: not-found sentinels, upsert semantics,
+// pagination, time range boundaries, sync cursors, batch failures and
+// cascading deletes, as the Postgres repositories implement them.
+//
+// A backend's tests call RunPiRepositoryTests, RunDeviceRepositoryTests and
+// RunReadingRepositoryTests with a Factory. A new backend must pass all three
+// before it can be selected in place of Postgres.
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Backend is one set of repositories sharing a store
+type Backend struct {
+	Pis      interfaces.PiRepository
+	Devices  interfaces.DeviceRepository
+	Readings interfaces.ReadingRepository
+
+	// AddUser makes userID a user that may own Pis, for backends whose Pis
+	// must be owned by existing users
+	AddUser func(t *testing.T, userID string)
+}
+
+// Factory returns a backend with an empty store. It is called once per test.
+type Factory func(t *testing.T) Backend
+
+// base is the time the fixtures are laid out from
+var base = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// at returns base plus n seconds
+func at(n int) time.Time {
+	return base.Add(time.Duration(n) * time.Second)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// run runs test as a subtest against a fresh backend
+func run(t *testing.T, name string, factory Factory, test func(t *testing.T, ctx context.Context, b Backend)) {
+	t.Helper()
+	t.Run(name, func(t *testing.T) {
+		b := factory(t)
+		if b.AddUser == nil {
+			b.AddUser = func(*testing.T, string) {}
+		}
+		test(t, context.Background(), b)
+	})
+}
+
+// addPi creates an owned Pi, and its owner, created at the given time
+func addPi(t *testing.T, ctx context.Context, b Backend, piID, userID string, createdAt time.Time) {
+	t.Helper()
+	b.AddUser(t, userID)
+	if err := b.Pis.CreateOrUpdatePi(ctx, hardware_models.Pi{PiID: piID, UserID: userID, CreatedAt: createdAt}); err != nil {
+		t.Fatalf("CreateOrUpdatePi(%s): %v", piID, err)
+	}
+}
+
+// addDevice creates a device of an existing Pi
+func addDevice(t *testing.T, ctx context.Context, b Backend, device hardware_models.Device) {
+	t.Helper()
+	if err := b.Devices.CreateOrUpdateDevice(ctx, device); err != nil {
+		t.Fatalf("CreateOrUpdateDevice(%s, %d): %v", device.PiID, device.DeviceID, err)
+	}
+}
+
+// addReadings stores readings, failing the test unless all are inserted
+func addReadings(t *testing.T, ctx context.Context, b Backend, readings ...hardware_models.Reading) {
+	t.Helper()
+	result, err := b.Readings.CreateReadings(ctx, readings)
+	if err != nil {
+		t.Fatalf("CreateReadings: %v", err)
+	}
+	if len(result.Failed) > 0 {
+		t.Fatalf("CreateReadings failed %+v", result.Failed)
+	}
+}
+
+// reading builds a reading with a one-field payload
+func reading(piID string, deviceID int, ts time.Time, value int) hardware_models.Reading {
+	return hardware_models.Reading{PiID: piID, DeviceID: deviceID, Ts: ts, Payload: map[string]interface{}{"value": value}}
+}
+
+// numberPayload is how a stored integer payload value reads back
+func numberPayload(n int) json.Number {
+	return json.Number(strconv.Itoa(n))
+}
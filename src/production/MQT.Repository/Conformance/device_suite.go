@@ -0,0 +1,324 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// RunDeviceRepositoryTests checks a backend's DeviceRepository
+func RunDeviceRepositoryTests(t *testing.T, factory Factory) {
+	run(t, "GetDeviceMissing", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		if _, err := b.Devices.GetDevice(ctx, "pi-a", 1); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetDevice of a missing device returned %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	run(t, "CreateOrUpdateDevice", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		err := b.Devices.CreateOrUpdateDevice(ctx, hardware_models.Device{PiID: "pi-missing", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(0)})
+		if err == nil {
+			t.Error("a device of a missing Pi was created")
+		}
+
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		// Device 0 is a device like any other
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 0, DeviceType: "sensor", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 0, DeviceType: "meter", Meta: map[string]interface{}{"room": "lab"}, CreatedAt: at(5)})
+
+		device, err := b.Devices.GetDevice(ctx, "pi-a", 0)
+		if err != nil {
+			t.Fatalf("GetDevice: %v", err)
+		}
+		if device.DeviceType != "meter" || device.Meta["room"] != "lab" {
+			t.Errorf("device is %+v, want type and meta replaced", device)
+		}
+		if !device.CreatedAt.Equal(at(1)) {
+			t.Errorf("created_at is %v, want the first insert's %v", device.CreatedAt, at(1))
+		}
+	})
+
+	run(t, "CreateDeviceIfAbsent", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+
+		created, err := b.Devices.CreateDeviceIfAbsent(ctx, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(1)})
+		if err != nil || !created {
+			t.Fatalf("first CreateDeviceIfAbsent returned %v, %v", created, err)
+		}
+		created, err = b.Devices.CreateDeviceIfAbsent(ctx, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "meter", CreatedAt: at(2)})
+		if err != nil || created {
+			t.Fatalf("second CreateDeviceIfAbsent returned %v, %v", created, err)
+		}
+		device, err := b.Devices.GetDevice(ctx, "pi-a", 1)
+		if err != nil {
+			t.Fatalf("GetDevice: %v", err)
+		}
+		if device.DeviceType != "sensor" {
+			t.Errorf("existing device became a %s", device.DeviceType)
+		}
+
+		if _, err := b.Devices.CreateDeviceIfAbsent(ctx, hardware_models.Device{PiID: "pi-missing", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(1)}); err == nil {
+			t.Error("a device of a missing Pi was created")
+		}
+	})
+
+	run(t, "ExistingDevicesAndKeys", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(1))
+		addPi(t, ctx, b, "pi-c", "user-a", at(2))
+		for _, key := range []interfaces.DeviceKey{{PiID: "pi-b", DeviceID: 2}, {PiID: "pi-a", DeviceID: 3}, {PiID: "pi-a", DeviceID: 0}, {PiID: "pi-c", DeviceID: 1}} {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: key.PiID, DeviceID: key.DeviceID, DeviceType: "sensor", CreatedAt: at(3)})
+		}
+
+		existing, err := b.Devices.ExistingDevices(ctx, []interfaces.DeviceKey{{PiID: "pi-a", DeviceID: 0}, {PiID: "pi-a", DeviceID: 2}, {PiID: "pi-b", DeviceID: 2}})
+		if err != nil {
+			t.Fatalf("ExistingDevices: %v", err)
+		}
+		for key, want := range map[interfaces.DeviceKey]bool{{PiID: "pi-a", DeviceID: 0}: true, {PiID: "pi-a", DeviceID: 2}: false, {PiID: "pi-b", DeviceID: 2}: true} {
+			if existing[key] != want {
+				t.Errorf("%v exists is %v, want %v", key, existing[key], want)
+			}
+		}
+
+		keys, err := b.Devices.ListAllDeviceKeys(ctx, []string{"pi-b", "pi-a", "pi-missing"})
+		if err != nil {
+			t.Fatalf("ListAllDeviceKeys: %v", err)
+		}
+		want := []interfaces.DeviceKey{{PiID: "pi-a", DeviceID: 0}, {PiID: "pi-a", DeviceID: 3}, {PiID: "pi-b", DeviceID: 2}}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("keys are %v, want %v", keys, want)
+		}
+	})
+
+	run(t, "ListDevicesByPi", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(0))
+		for deviceID := 0; deviceID < 3; deviceID++ {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: deviceID, DeviceType: "sensor", CreatedAt: at(deviceID + 1)})
+		}
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-b", DeviceID: 9, DeviceType: "sensor", CreatedAt: at(9)})
+
+		first, err := b.Devices.ListDevicesByPi(ctx, "pi-a", interfaces.PageOptions{Page: 1, PageSize: 2, IncludeTotal: true})
+		if err != nil {
+			t.Fatalf("ListDevicesByPi: %v", err)
+		}
+		second, err := b.Devices.ListDevicesByPi(ctx, "pi-a", interfaces.PageOptions{Page: 2, PageSize: 2})
+		if err != nil {
+			t.Fatalf("ListDevicesByPi: %v", err)
+		}
+		if first.Total == nil || *first.Total != 3 || second.Total != nil {
+			t.Errorf("totals are %v and %v, want 3 and none", first.Total, second.Total)
+		}
+		if first.NextPage == nil || *first.NextPage != 2 || second.NextPage != nil {
+			t.Errorf("next pages are %v and %v, want 2 and none", first.NextPage, second.NextPage)
+		}
+		var got []int
+		for _, result := range []*interfaces.PaginationResult{first, second} {
+			devices, _ := result.Items.([]hardware_models.Device)
+			for _, device := range devices {
+				got = append(got, device.DeviceID)
+			}
+		}
+		if want := []int{2, 1, 0}; !reflect.DeepEqual(got, want) {
+			t.Errorf("listed devices %v, want newest first %v", got, want)
+		}
+	})
+
+	run(t, "ListDevicesWithLatest", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "sensor", CreatedAt: at(2)})
+		addReadings(t, ctx, b, reading("pi-a", 1, at(10), 1), reading("pi-a", 1, at(20), 2), reading("pi-a", 1, at(15), 3))
+
+		result, err := b.Devices.ListDevicesWithLatest(ctx, "pi-a", interfaces.PageOptions{Page: 1, PageSize: 10, IncludeTotal: true})
+		if err != nil {
+			t.Fatalf("ListDevicesWithLatest: %v", err)
+		}
+		devices, _ := result.Items.([]hardware_models.DeviceWithLatest)
+		if len(devices) != 2 || *result.Total != 2 || result.NextPage != nil {
+			t.Fatalf("listed %+v", result)
+		}
+		if devices[0].DeviceID != 2 || devices[0].Current != nil {
+			t.Errorf("first device is %+v, want device 2 without readings", devices[0])
+		}
+		current := devices[1].Current
+		if devices[1].DeviceID != 1 || current == nil || !current.Ts.Equal(at(20)) || current.Payload["value"] != numberPayload(2) {
+			t.Errorf("second device is %+v with %+v, want device 1 with its latest reading", devices[1], current)
+		}
+	})
+
+	run(t, "FindDevicesByMeta", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-b", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", Meta: map[string]interface{}{"room": "lab"}, CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "sensor", Meta: map[string]interface{}{"room": "hall"}, CreatedAt: at(2)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-b", DeviceID: 1, DeviceType: "sensor", Meta: map[string]interface{}{"room": "lab"}, CreatedAt: at(3)})
+
+		tests := []struct {
+			name   string
+			userID string
+			limit  int
+			want   []interfaces.DeviceKey
+		}{
+			{name: "every user", limit: 10, want: []interfaces.DeviceKey{{PiID: "pi-b", DeviceID: 1}, {PiID: "pi-a", DeviceID: 1}}},
+			{name: "one user", userID: "user-a", limit: 10, want: []interfaces.DeviceKey{{PiID: "pi-a", DeviceID: 1}}},
+			{name: "limit", limit: 1, want: []interfaces.DeviceKey{{PiID: "pi-b", DeviceID: 1}}},
+			{name: "user without devices", userID: "user-none", limit: 10, want: nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				devices, err := b.Devices.FindDevicesByMeta(ctx, map[string]string{"room": "lab"}, tt.userID, tt.limit)
+				if err != nil {
+					t.Fatalf("FindDevicesByMeta: %v", err)
+				}
+				var got []interfaces.DeviceKey
+				for _, device := range devices {
+					got = append(got, interfaces.DeviceKey{PiID: device.PiID, DeviceID: device.DeviceID})
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	run(t, "UpdateDevice", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		if err := b.Devices.UpdateDevice(ctx, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "meter"}); err == nil {
+			t.Error("UpdateDevice of a missing device succeeded")
+		}
+
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", Meta: map[string]interface{}{"room": "lab"}, CreatedAt: at(1)})
+		if err := b.Devices.UpdateDevice(ctx, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "meter"}); err != nil {
+			t.Fatalf("UpdateDevice: %v", err)
+		}
+		device, err := b.Devices.GetDevice(ctx, "pi-a", 1)
+		if err != nil {
+			t.Fatalf("GetDevice: %v", err)
+		}
+		if device.DeviceType != "meter" || device.Meta != nil {
+			t.Errorf("device is %+v, want type meter and meta cleared", device)
+		}
+	})
+
+	run(t, "TouchLiveness", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "sensor", CreatedAt: at(1)})
+
+		result, err := b.Devices.TouchLiveness(ctx, []interfaces.DeviceLiveness{
+			{PiID: "pi-a", DeviceID: 1, LastTs: at(10)},
+			{PiID: "pi-a", DeviceID: 2, LastTs: at(20)},
+			{PiID: "pi-b", DeviceID: 7, LastTs: at(30)},
+			{PiID: "pi-missing", DeviceID: 1, LastTs: at(30)},
+		})
+		if err != nil {
+			t.Fatalf("TouchLiveness: %v", err)
+		}
+		// The unknown device of pi-b is ignored, but pi-b itself is still seen
+		if want := (interfaces.LivenessResult{Devices: 2, Pis: 2}); result != want {
+			t.Errorf("touched %+v, want %+v", result, want)
+		}
+
+		// Older times don't move anything back, but the rows still match
+		result, err = b.Devices.TouchLiveness(ctx, []interfaces.DeviceLiveness{{PiID: "pi-a", DeviceID: 1, LastTs: at(5)}})
+		if err != nil {
+			t.Fatalf("TouchLiveness: %v", err)
+		}
+		if want := (interfaces.LivenessResult{Devices: 1, Pis: 1}); result != want {
+			t.Errorf("touched %+v, want %+v", result, want)
+		}
+
+		result, err = b.Devices.TouchLiveness(ctx, nil)
+		if err != nil || result != (interfaces.LivenessResult{}) {
+			t.Errorf("no entries touched %+v, %v", result, err)
+		}
+	})
+
+	run(t, "DeleteDeviceCascades", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		if err := b.Devices.DeleteDevice(ctx, "pi-a", 1, true); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeleteDevice of a missing device returned %v, want sql.ErrNoRows", err)
+		}
+
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "sensor", CreatedAt: at(1)})
+		addReadings(t, ctx, b, reading("pi-a", 1, at(2), 1), reading("pi-a", 2, at(2), 1))
+
+		if err := b.Devices.DeleteDevice(ctx, "pi-a", 1, false); err != nil {
+			t.Fatalf("DeleteDevice: %v", err)
+		}
+		if _, err := b.Devices.GetDevice(ctx, "pi-a", 1); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetDevice after delete returned %v", err)
+		}
+		if latest, err := b.Readings.GetLatestReading(ctx, "pi-a", 1); err != nil || latest != nil {
+			t.Errorf("the deleted device's readings are still there: %v, %v", latest, err)
+		}
+		if latest, err := b.Readings.GetLatestReading(ctx, "pi-a", 2); err != nil || latest == nil {
+			t.Errorf("another device's reading went too: %v, %v", latest, err)
+		}
+	})
+
+	run(t, "DeclaredUnits", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		err := b.Devices.UpsertDeviceType(ctx, &hardware_models.DeviceType{
+			DeviceType: "weather",
+			Meta:       map[string]interface{}{"units": map[string]interface{}{"temp": "C", "hum": "%", "bad": 1}},
+		})
+		if err != nil {
+			t.Fatalf("UpsertDeviceType: %v", err)
+		}
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "weather", Meta: map[string]interface{}{"units": map[string]interface{}{"temp": "F", "wind": "m/s"}}, CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "weather", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 3, DeviceType: "sensor", CreatedAt: at(1)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 4, DeviceType: "sensor", Meta: map[string]interface{}{"units": map[string]interface{}{"lux": "lx"}}, CreatedAt: at(1)})
+
+		units, err := b.Devices.GetDeclaredUnits(ctx, "pi-a")
+		if err != nil {
+			t.Fatalf("GetDeclaredUnits: %v", err)
+		}
+		want := map[int]map[string]string{
+			1: {"temp": "F", "hum": "%", "wind": "m/s"},
+			2: {"temp": "C", "hum": "%"},
+			4: {"lux": "lx"},
+		}
+		if !reflect.DeepEqual(units, want) {
+			t.Errorf("units are %v, want %v", units, want)
+		}
+	})
+
+	run(t, "DeviceTypes", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		deviceType, err := b.Devices.GetDeviceType(ctx, "weather")
+		if err != nil || deviceType != nil {
+			t.Fatalf("GetDeviceType of a missing type returned %+v, %v", deviceType, err)
+		}
+
+		before := time.Now().Add(-time.Second)
+		dt := &hardware_models.DeviceType{DeviceType: "weather", Meta: map[string]interface{}{"units": map[string]interface{}{"temp": "C"}}}
+		if err := b.Devices.UpsertDeviceType(ctx, dt); err != nil {
+			t.Fatalf("UpsertDeviceType: %v", err)
+		}
+		if dt.UpdatedAt.Before(before) {
+			t.Errorf("updated_at was set to %v", dt.UpdatedAt)
+		}
+		dt = &hardware_models.DeviceType{DeviceType: "weather", Meta: map[string]interface{}{"model": "ws-1"}}
+		if err := b.Devices.UpsertDeviceType(ctx, dt); err != nil {
+			t.Fatalf("UpsertDeviceType: %v", err)
+		}
+
+		deviceType, err = b.Devices.GetDeviceType(ctx, "weather")
+		if err != nil || deviceType == nil {
+			t.Fatalf("GetDeviceType returned %+v, %v", deviceType, err)
+		}
+		if want := map[string]interface{}{"model": "ws-1"}; !reflect.DeepEqual(deviceType.Meta, want) {
+			t.Errorf("meta is %v, want it replaced by %v", deviceType.Meta, want)
+		}
+	})
+}
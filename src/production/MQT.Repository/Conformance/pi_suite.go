@@ -0,0 +1,294 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// RunPiRepositoryTests checks a backend's PiRepository
+func RunPiRepositoryTests(t *testing.T, factory Factory) {
+	run(t, "GetPiMissing", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		if _, err := b.Pis.GetPi(ctx, "pi-missing"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetPi of a missing Pi returned %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	run(t, "CreateOrUpdatePiSetsOwner", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-a", "user-b", at(10))
+
+		pi, err := b.Pis.GetPi(ctx, "pi-a")
+		if err != nil {
+			t.Fatalf("GetPi: %v", err)
+		}
+		if pi.UserID != "user-b" {
+			t.Errorf("owner is %q, want user-b", pi.UserID)
+		}
+		if !pi.CreatedAt.Equal(at(0)) {
+			t.Errorf("created_at is %v, want the first insert's %v", pi.CreatedAt, at(0))
+		}
+		if pi.Meta != nil {
+			t.Errorf("meta is %v, want none", pi.Meta)
+		}
+	})
+
+	run(t, "CreateOrUpdatePisUpsertsMeta", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+
+		results, err := b.Pis.CreateOrUpdatePis(ctx, []hardware_models.Pi{
+			{PiID: "pi-a", Meta: map[string]interface{}{"site": "north"}, CreatedAt: at(1)},
+			{PiID: "pi-b", Meta: map[string]interface{}{"site": "south"}, CreatedAt: at(2)},
+		})
+		if err != nil {
+			t.Fatalf("CreateOrUpdatePis: %v", err)
+		}
+		want := []interfaces.PiUpsertResult{{PiID: "pi-a", Created: false}, {PiID: "pi-b", Created: true}}
+		if !reflect.DeepEqual(results, want) {
+			t.Errorf("results are %+v, want %+v", results, want)
+		}
+
+		piA, err := b.Pis.GetPi(ctx, "pi-a")
+		if err != nil {
+			t.Fatalf("GetPi: %v", err)
+		}
+		if piA.UserID != "user-a" || piA.Meta["site"] != "north" {
+			t.Errorf("pi-a is %+v, want owner user-a kept and site north", piA)
+		}
+		piB, err := b.Pis.GetPi(ctx, "pi-b")
+		if err != nil {
+			t.Fatalf("GetPi: %v", err)
+		}
+		if piB.UserID != "" {
+			t.Errorf("pi-b owner is %q, want none", piB.UserID)
+		}
+
+		if results, err := b.Pis.CreateOrUpdatePis(ctx, nil); err != nil || len(results) != 0 {
+			t.Errorf("empty batch returned %v, %v", results, err)
+		}
+	})
+
+	run(t, "GetPiOwners", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		if _, err := b.Pis.CreateOrUpdatePis(ctx, []hardware_models.Pi{{PiID: "pi-b", CreatedAt: at(1)}}); err != nil {
+			t.Fatalf("CreateOrUpdatePis: %v", err)
+		}
+
+		owners, err := b.Pis.GetPiOwners(ctx, []string{"pi-a", "pi-b", "pi-missing"})
+		if err != nil {
+			t.Fatalf("GetPiOwners: %v", err)
+		}
+		want := map[string]string{"pi-a": "user-a", "pi-b": ""}
+		if !reflect.DeepEqual(owners, want) {
+			t.Errorf("owners are %v, want %v", owners, want)
+		}
+
+		owners, err = b.Pis.GetPiOwners(ctx, nil)
+		if err != nil || len(owners) != 0 {
+			t.Errorf("no Pis returned %v, %v", owners, err)
+		}
+	})
+
+	run(t, "ListAllPiIDs", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-c", "user-a", at(0))
+		addPi(t, ctx, b, "pi-a", "user-a", at(1))
+		addPi(t, ctx, b, "pi-d", "user-a", at(2))
+		if _, err := b.Pis.CreateOrUpdatePis(ctx, []hardware_models.Pi{{PiID: "pi-b", CreatedAt: at(3)}}); err != nil {
+			t.Fatalf("CreateOrUpdatePis: %v", err)
+		}
+		// pi-c itself is old, but it has a new device
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-c", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(5)})
+
+		tests := []struct {
+			name string
+			page interfaces.RegistryPage
+			want []string
+		}{
+			{name: "first page", page: interfaces.RegistryPage{Limit: 2}, want: []string{"pi-a", "pi-b"}},
+			{name: "after", page: interfaces.RegistryPage{After: "pi-b", Limit: 2}, want: []string{"pi-c", "pi-d"}},
+			{name: "past the end", page: interfaces.RegistryPage{After: "pi-d", Limit: 2}, want: nil},
+			{name: "owned only", page: interfaces.RegistryPage{OwnedOnly: true, Limit: 10}, want: []string{"pi-a", "pi-c", "pi-d"}},
+			{name: "updated since", page: interfaces.RegistryPage{UpdatedSince: ptr(at(2)), Limit: 10}, want: []string{"pi-b", "pi-c", "pi-d"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := b.Pis.ListAllPiIDs(ctx, tt.page)
+				if err != nil {
+					t.Fatalf("ListAllPiIDs: %v", err)
+				}
+				if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	run(t, "ListPisPagination", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		for n, piID := range []string{"pi-a", "pi-b", "pi-c", "pi-d", "pi-e"} {
+			addPi(t, ctx, b, piID, "user-a", at(n))
+		}
+		addPi(t, ctx, b, "pi-x", "user-b", at(10))
+
+		var seen []string
+		for page := 1; page <= 3; page++ {
+			result, err := b.Pis.ListPis(ctx, "user-a", interfaces.PageOptions{Page: page, PageSize: 2, IncludeTotal: true})
+			if err != nil {
+				t.Fatalf("ListPis page %d: %v", page, err)
+			}
+			if result.Total == nil || *result.Total != 5 {
+				t.Errorf("page %d total is %v, want 5", page, result.Total)
+			}
+			pis, _ := result.Items.([]hardware_models.Pi)
+			for _, pi := range pis {
+				seen = append(seen, pi.PiID)
+			}
+			if full := len(pis) == 2; full != (result.NextPage != nil) {
+				t.Errorf("page %d has %d Pis and next page %v", page, len(pis), result.NextPage)
+			} else if full && *result.NextPage != page+1 {
+				t.Errorf("page %d next page is %d", page, *result.NextPage)
+			}
+		}
+		// Newest first
+		want := []string{"pi-e", "pi-d", "pi-c", "pi-b", "pi-a"}
+		if !reflect.DeepEqual(seen, want) {
+			t.Errorf("pages listed %v, want %v", seen, want)
+		}
+
+		result, err := b.Pis.ListPis(ctx, "user-a", interfaces.PageOptions{Page: 1, PageSize: 2})
+		if err != nil {
+			t.Fatalf("ListPis: %v", err)
+		}
+		if result.Total != nil {
+			t.Errorf("total is %d without IncludeTotal", *result.Total)
+		}
+
+		result, err = b.Pis.ListPis(ctx, "", interfaces.PageOptions{Page: 1, PageSize: 10, IncludeTotal: true})
+		if err != nil {
+			t.Fatalf("ListPis of every user: %v", err)
+		}
+		if *result.Total != 6 {
+			t.Errorf("every user's Pis total %d, want 6", *result.Total)
+		}
+
+		result, err = b.Pis.ListPis(ctx, "user-none", interfaces.PageOptions{Page: 1, PageSize: 10, IncludeTotal: true})
+		if err != nil {
+			t.Fatalf("ListPis of a user without Pis: %v", err)
+		}
+		if pis, _ := result.Items.([]hardware_models.Pi); len(pis) != 0 || *result.Total != 0 || result.NextPage != nil {
+			t.Errorf("a user without Pis listed %+v", result)
+		}
+	})
+
+	run(t, "CountPisByUser", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(1))
+		addPi(t, ctx, b, "pi-c", "user-b", at(2))
+
+		for userID, want := range map[string]int{"user-a": 2, "user-b": 1, "user-none": 0} {
+			got, err := b.Pis.CountPisByUser(ctx, userID)
+			if err != nil {
+				t.Fatalf("CountPisByUser(%s): %v", userID, err)
+			}
+			if got != want {
+				t.Errorf("%s has %d Pis, want %d", userID, got, want)
+			}
+		}
+	})
+
+	run(t, "FindPisByMeta", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(1))
+		addPi(t, ctx, b, "pi-c", "user-b", at(2))
+		_, err := b.Pis.CreateOrUpdatePis(ctx, []hardware_models.Pi{
+			{PiID: "pi-a", Meta: map[string]interface{}{"site": "north", "floor": "1"}},
+			{PiID: "pi-b", Meta: map[string]interface{}{"site": "north", "floor": 2}},
+			{PiID: "pi-c", Meta: map[string]interface{}{"site": "north"}},
+		})
+		if err != nil {
+			t.Fatalf("CreateOrUpdatePis: %v", err)
+		}
+
+		tests := []struct {
+			name   string
+			match  map[string]string
+			userID string
+			limit  int
+			want   []string
+		}{
+			{name: "every user", match: map[string]string{"site": "north"}, limit: 10, want: []string{"pi-c", "pi-b", "pi-a"}},
+			{name: "one user", match: map[string]string{"site": "north"}, userID: "user-a", limit: 10, want: []string{"pi-b", "pi-a"}},
+			{name: "limit", match: map[string]string{"site": "north"}, limit: 1, want: []string{"pi-c"}},
+			{name: "every key", match: map[string]string{"site": "north", "floor": "1"}, limit: 10, want: []string{"pi-a"}},
+			{name: "strings only", match: map[string]string{"floor": "2"}, limit: 10, want: nil},
+			{name: "no match", match: map[string]string{"site": "south"}, limit: 10, want: nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				pis, err := b.Pis.FindPisByMeta(ctx, tt.match, tt.userID, tt.limit)
+				if err != nil {
+					t.Fatalf("FindPisByMeta: %v", err)
+				}
+				var got []string
+				for _, pi := range pis {
+					got = append(got, pi.PiID)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	run(t, "UpdatePi", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		b.AddUser(t, "user-b")
+		if err := b.Pis.UpdatePi(ctx, hardware_models.Pi{PiID: "pi-missing", UserID: "user-b"}); err == nil {
+			t.Error("UpdatePi of a missing Pi succeeded")
+		}
+
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		if err := b.Pis.UpdatePi(ctx, hardware_models.Pi{PiID: "pi-a", UserID: "user-b"}); err != nil {
+			t.Fatalf("UpdatePi: %v", err)
+		}
+		pi, err := b.Pis.GetPi(ctx, "pi-a")
+		if err != nil {
+			t.Fatalf("GetPi: %v", err)
+		}
+		if pi.UserID != "user-b" {
+			t.Errorf("owner is %q, want user-b", pi.UserID)
+		}
+	})
+
+	run(t, "DeletePiCascades", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		if err := b.Pis.DeletePi(ctx, "pi-missing", true); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeletePi of a missing Pi returned %v, want sql.ErrNoRows", err)
+		}
+
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addPi(t, ctx, b, "pi-b", "user-a", at(1))
+		for _, piID := range []string{"pi-a", "pi-b"} {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: piID, DeviceID: 1, DeviceType: "sensor", CreatedAt: at(2)})
+			addReadings(t, ctx, b, reading(piID, 1, at(3), 1))
+		}
+
+		if err := b.Pis.DeletePi(ctx, "pi-a", true); err != nil {
+			t.Fatalf("DeletePi: %v", err)
+		}
+		if _, err := b.Pis.GetPi(ctx, "pi-a"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetPi after delete returned %v", err)
+		}
+		if _, err := b.Devices.GetDevice(ctx, "pi-a", 1); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("the deleted Pi's device is still there: %v", err)
+		}
+		if latest, err := b.Readings.GetLatestReading(ctx, "pi-a", 1); err != nil || latest != nil {
+			t.Errorf("the deleted Pi's readings are still there: %v, %v", latest, err)
+		}
+		if latest, err := b.Readings.GetLatestReading(ctx, "pi-b", 1); err != nil || latest == nil {
+			t.Errorf("another Pi's reading went too: %v, %v", latest, err)
+		}
+	})
+}
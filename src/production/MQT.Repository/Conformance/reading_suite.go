@@ -0,0 +1,831 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// addDeviceWithReadings creates pi-a with device 1 and readings at at(0)
+// through at(n-1), reading n holding value n
+func addDeviceWithReadings(t *testing.T, ctx context.Context, b Backend, n int) {
+	t.Helper()
+	addPi(t, ctx, b, "pi-a", "user-a", at(0))
+	addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(0)})
+	readings := make([]hardware_models.Reading, n)
+	for i := range readings {
+		readings[i] = reading("pi-a", 1, at(i), i)
+	}
+	addReadings(t, ctx, b, readings...)
+}
+
+// timestamps returns the seconds after base of each reading
+func timestamps(readings []hardware_models.Reading) []int {
+	seconds := []int{}
+	for _, reading := range readings {
+		seconds = append(seconds, int(reading.Ts.Sub(base)/time.Second))
+	}
+	return seconds
+}
+
+// RunReadingRepositoryTests checks a backend's ReadingRepository
+func RunReadingRepositoryTests(t *testing.T, factory Factory) {
+	run(t, "CreateReading", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 0, DeviceType: "sensor", CreatedAt: at(0)})
+
+		if err := b.Readings.CreateReading(ctx, reading("pi-a", 0, at(1), 1)); err != nil {
+			t.Fatalf("CreateReading: %v", err)
+		}
+		receivedAt := at(100)
+		late := reading("pi-a", 0, at(2), 2)
+		late.ReceivedAt = &receivedAt
+		if err := b.Readings.CreateReading(ctx, late); err != nil {
+			t.Fatalf("CreateReading: %v", err)
+		}
+		if err := b.Readings.CreateReading(ctx, reading("pi-a", 0, at(1), 3)); !errors.Is(err, interfaces.ErrDuplicateReading) {
+			t.Errorf("duplicate reading returned %v, want ErrDuplicateReading", err)
+		}
+		if err := b.Readings.CreateReading(ctx, reading("pi-a", 9, at(1), 1)); !errors.Is(err, interfaces.ErrReadingDeviceNotFound) {
+			t.Errorf("reading of a missing device returned %v, want ErrReadingDeviceNotFound", err)
+		}
+
+		result, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(0), Limit: 10, Page: 1})
+		if err != nil {
+			t.Fatalf("GetReadingsByDevice: %v", err)
+		}
+		if len(result.Items) != 2 {
+			t.Fatalf("stored %d readings, want 2", len(result.Items))
+		}
+		if got := result.Items[0].ReceivedAt; got == nil || !got.Equal(receivedAt) {
+			t.Errorf("received_at is %v, want the given %v", got, receivedAt)
+		}
+		if got := result.Items[1]; got.ReceivedAt == nil || got.Payload["value"] != numberPayload(1) {
+			t.Errorf("first reading is %+v, want received_at defaulted and value 1 kept", got)
+		}
+	})
+
+	run(t, "CreateReadingsReportsFailures", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		result, err := b.Readings.CreateReadings(ctx, nil)
+		if err != nil || result == nil || result.Inserted != 0 || len(result.Failed) != 0 {
+			t.Fatalf("empty batch returned %+v, %v", result, err)
+		}
+
+		addDeviceWithReadings(t, ctx, b, 1)
+		result, err = b.Readings.CreateReadings(ctx, []hardware_models.Reading{
+			reading("pi-a", 1, at(1), 1),
+			reading("pi-a", 1, at(0), 2), // already stored
+			reading("pi-a", 9, at(1), 3), // no such device
+			reading("pi-a", 1, at(2), 4),
+			reading("pi-a", 1, at(1), 5), // repeats the first of the batch
+		})
+		if err != nil {
+			t.Fatalf("CreateReadings: %v", err)
+		}
+		if result.Inserted != 2 {
+			t.Errorf("inserted %d, want 2", result.Inserted)
+		}
+		var failed []interfaces.ReadingInsertFailure
+		for _, failure := range result.Failed {
+			failed = append(failed, interfaces.ReadingInsertFailure{Index: failure.Index, PiID: failure.PiID, DeviceID: failure.DeviceID, Reason: failure.Reason})
+		}
+		want := []interfaces.ReadingInsertFailure{
+			{Index: 1, PiID: "pi-a", DeviceID: 1, Reason: interfaces.ReadingFailureDuplicate},
+			{Index: 2, PiID: "pi-a", DeviceID: 9, Reason: interfaces.ReadingFailureDeviceNotFound},
+			{Index: 4, PiID: "pi-a", DeviceID: 1, Reason: interfaces.ReadingFailureDuplicate},
+		}
+		if !reflect.DeepEqual(failed, want) {
+			t.Errorf("failures are %+v, want %+v", failed, want)
+		}
+
+		latest, err := b.Readings.GetLatestReading(ctx, "pi-a", 1)
+		if err != nil {
+			t.Fatalf("GetLatestReading: %v", err)
+		}
+		if !latest.Ts.Equal(at(2)) {
+			t.Errorf("latest reading is at %v, want %v", latest.Ts, at(2))
+		}
+		first, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(1), From: ptr(at(1)), To: ptr(at(2)), Limit: 10, Page: 1})
+		if err != nil {
+			t.Fatalf("GetReadingsByDevice: %v", err)
+		}
+		if len(first.Items) != 1 || first.Items[0].Payload["value"] != numberPayload(1) {
+			t.Errorf("reading at %v is %+v, want the batch's first", at(1), first.Items)
+		}
+	})
+
+	// A batch failing partway is split until each bad reading stands alone, so
+	// the failures must be found at any depth with their index in the whole
+	// batch, and every other reading stored
+	run(t, "CreateReadingsMidBatchFailures", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 0)
+
+		tests := []struct {
+			name string
+			size int
+			bad  []int // indexes given a device that doesn't exist
+		}{
+			{name: "first", size: 8, bad: []int{0}},
+			{name: "middle", size: 8, bad: []int{4}},
+			{name: "last", size: 8, bad: []int{7}},
+			{name: "either side of the split", size: 8, bad: []int{3, 4}},
+			{name: "scattered in an odd batch", size: 37, bad: []int{1, 17, 18, 29, 36}},
+			{name: "all but one", size: 5, bad: []int{0, 1, 3, 4}},
+		}
+		for n, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// Each case writes its own minute, so cases don't collide
+				offset := n * 60
+				bad := map[int]bool{}
+				for _, index := range tt.bad {
+					bad[index] = true
+				}
+				batch := make([]hardware_models.Reading, tt.size)
+				for i := range batch {
+					deviceID := 1
+					if bad[i] {
+						deviceID = 99
+					}
+					batch[i] = reading("pi-a", deviceID, at(offset+i), i)
+				}
+
+				result, err := b.Readings.CreateReadings(ctx, batch)
+				if err != nil {
+					t.Fatalf("CreateReadings: %v", err)
+				}
+				if result.Inserted != tt.size-len(tt.bad) {
+					t.Errorf("inserted %d, want %d", result.Inserted, tt.size-len(tt.bad))
+				}
+				var failed []int
+				for _, failure := range result.Failed {
+					failed = append(failed, failure.Index)
+					if failure.Reason != interfaces.ReadingFailureDeviceNotFound || failure.DeviceID != 99 || !failure.Ts.Equal(at(offset+failure.Index)) {
+						t.Errorf("failure %+v doesn't describe reading %d", failure, failure.Index)
+					}
+				}
+				if !reflect.DeepEqual(failed, tt.bad) {
+					t.Errorf("failed indexes %v, want %v", failed, tt.bad)
+				}
+
+				stored, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(1), From: ptr(at(offset)), To: ptr(at(offset + tt.size)), Limit: 100, Page: 1})
+				if err != nil {
+					t.Fatalf("GetReadingsByDevice: %v", err)
+				}
+				var want []int
+				for i := tt.size - 1; i >= 0; i-- {
+					if !bad[i] {
+						want = append(want, offset+i)
+					}
+				}
+				if got := timestamps(stored.Items); !reflect.DeepEqual(got, want) {
+					t.Errorf("stored %v, want %v", got, want)
+				}
+			})
+		}
+	})
+
+	run(t, "CreateReadingsLargeBatch", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 2500)
+		count, err := b.Readings.CountReadingsByTimeRange(ctx, "pi-a", 1, at(0), at(2500), 0)
+		if err != nil {
+			t.Fatalf("CountReadingsByTimeRange: %v", err)
+		}
+		if count != 2500 {
+			t.Errorf("stored %d readings, want 2500", count)
+		}
+	})
+
+	// A timestamp parsed from any offset, precision or epoch form is stored and
+	// read back equal, and formats the same, so a reading sent again with the
+	// same instant written another way is a duplicate
+	run(t, "TimestampRoundTrip", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 0)
+
+		tests := []struct {
+			name  string
+			value string
+			again string // the same instant written another way
+		}{
+			{name: "offset", value: "2026-03-01T14:00:01.123+02:00", again: "2026-03-01T12:00:01.123Z"},
+			{name: "negative offset", value: "2026-03-01T07:00:02-05:00", again: "2026-03-01 12:00:02"},
+			{name: "nanoseconds", value: "2026-03-01T12:00:03.456789123Z", again: "2026-03-01T13:00:03.456+01:00"},
+			{name: "epoch", value: strconv.FormatInt(at(4).Unix(), 10) + ".25", again: "2026-03-01T12:00:04.250Z"},
+		}
+		for n, tt := range tests {
+			ts, err := hardware_models.ParseTimestamp(tt.value)
+			if err != nil {
+				t.Fatalf("%s: ParseTimestamp(%q): %v", tt.name, tt.value, err)
+			}
+			stored := reading("pi-a", 1, ts, n)
+			stored.ReceivedAt = &ts
+			if err := b.Readings.CreateReading(ctx, stored); err != nil {
+				t.Fatalf("%s: CreateReading: %v", tt.name, err)
+			}
+
+			result, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(1), From: ptr(ts), To: ptr(ts.Add(time.Millisecond)), Limit: 10, Page: 1})
+			if err != nil {
+				t.Fatalf("%s: GetReadingsByDevice: %v", tt.name, err)
+			}
+			if len(result.Items) != 1 {
+				t.Fatalf("%s: %d readings at %v, want 1", tt.name, len(result.Items), ts)
+			}
+			got := result.Items[0]
+			if !got.Ts.Equal(ts) || hardware_models.FormatTimestamp(got.Ts) != hardware_models.FormatTimestamp(ts) {
+				t.Errorf("%s: ts read back as %v, want %v", tt.name, got.Ts, ts)
+			}
+			if got.ReceivedAt == nil || !got.ReceivedAt.Equal(ts) {
+				t.Errorf("%s: received_at read back as %v, want %v", tt.name, got.ReceivedAt, ts)
+			}
+
+			again, err := hardware_models.ParseTimestamp(tt.again)
+			if err != nil {
+				t.Fatalf("%s: ParseTimestamp(%q): %v", tt.name, tt.again, err)
+			}
+			if err := b.Readings.CreateReading(ctx, reading("pi-a", 1, again, n)); !errors.Is(err, interfaces.ErrDuplicateReading) {
+				t.Errorf("%s: %q after %q returned %v, want ErrDuplicateReading", tt.name, tt.again, tt.value, err)
+			}
+		}
+	})
+
+	run(t, "GetReadingsRangeBoundaries", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		tests := []struct {
+			name   string
+			params interfaces.ReadingQueryParams
+			want   []int
+		}{
+			{name: "everything", params: interfaces.ReadingQueryParams{}, want: []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+			{name: "from inclusive to exclusive", params: interfaces.ReadingQueryParams{From: ptr(at(2)), To: ptr(at(5))}, want: []int{4, 3, 2}},
+			{name: "inclusive to", params: interfaces.ReadingQueryParams{From: ptr(at(2)), To: ptr(at(5)), InclusiveTo: true}, want: []int{5, 4, 3, 2}},
+			{name: "between readings", params: interfaces.ReadingQueryParams{From: ptr(at(2).Add(time.Millisecond)), To: ptr(at(3).Add(time.Millisecond))}, want: []int{3}},
+			{name: "empty range", params: interfaces.ReadingQueryParams{From: ptr(at(20)), To: ptr(at(30))}, want: []int{}},
+			{name: "other pi", params: interfaces.ReadingQueryParams{PiID: "pi-b"}, want: []int{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				params := tt.params
+				params.Limit, params.Page = 100, 1
+				result, err := b.Readings.GetReadings(ctx, params)
+				if err != nil {
+					t.Fatalf("GetReadings: %v", err)
+				}
+				if got := timestamps(result.Items); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				if result.NextPageToken != nil {
+					t.Errorf("next page token %q on a partial page", *result.NextPageToken)
+				}
+			})
+		}
+	})
+
+	// Every query taking a range treats a reading exactly at From as inside and
+	// one exactly at To as outside, unless InclusiveTo
+	run(t, "RangeBoundariesEveryQuery", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		tests := []struct {
+			name        string
+			from, to    int
+			inclusiveTo bool
+			want        []int // oldest first
+		}{
+			{name: "half-open", from: 2, to: 5, want: []int{2, 3, 4}},
+			{name: "inclusive to", from: 2, to: 5, inclusiveTo: true, want: []int{2, 3, 4, 5}},
+			{name: "half-open at the last reading", from: 7, to: 9, want: []int{7, 8}},
+			{name: "inclusive to at the last reading", from: 7, to: 9, inclusiveTo: true, want: []int{7, 8, 9}},
+			{name: "half-open from equals to", from: 4, to: 4, want: []int{}},
+			{name: "inclusive from equals to", from: 4, to: 4, inclusiveTo: true, want: []int{4}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				params := interfaces.ReadingQueryParams{PiID: "pi-a", From: ptr(at(tt.from)), To: ptr(at(tt.to)), InclusiveTo: tt.inclusiveTo, Limit: 100, Page: 1, IncludeTotal: true}
+				newestFirst := make([]int, len(tt.want))
+				for n, second := range tt.want {
+					newestFirst[len(tt.want)-1-n] = second
+				}
+
+				result, err := b.Readings.GetReadings(ctx, params)
+				if err != nil {
+					t.Fatalf("GetReadings: %v", err)
+				}
+				if got := timestamps(result.Items); !reflect.DeepEqual(got, newestFirst) {
+					t.Errorf("GetReadings got %v, want %v", got, newestFirst)
+				}
+				if result.Total == nil || *result.Total != len(tt.want) {
+					t.Errorf("GetReadings total %v, want %d", result.Total, len(tt.want))
+				}
+
+				deviceParams := params
+				deviceParams.DeviceID = ptr(1)
+				result, err = b.Readings.GetReadingsByDevice(ctx, deviceParams)
+				if err != nil {
+					t.Fatalf("GetReadingsByDevice: %v", err)
+				}
+				if got := timestamps(result.Items); !reflect.DeepEqual(got, newestFirst) {
+					t.Errorf("GetReadingsByDevice got %v, want %v", got, newestFirst)
+				}
+
+				iterated := []int{}
+				err = b.Readings.IterateReadings(ctx, params, func(reading hardware_models.Reading) error {
+					iterated = append(iterated, int(reading.Ts.Sub(base)/time.Second))
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("IterateReadings: %v", err)
+				}
+				if !reflect.DeepEqual(iterated, tt.want) {
+					t.Errorf("IterateReadings got %v, want %v", iterated, tt.want)
+				}
+
+				stats, err := b.Readings.GetSummaryStats(ctx, params)
+				if err != nil {
+					t.Fatalf("GetSummaryStats: %v", err)
+				}
+				if stats.Count != int64(len(tt.want)) {
+					t.Errorf("GetSummaryStats count %d, want %d", stats.Count, len(tt.want))
+				}
+				if len(tt.want) > 0 {
+					if stats.LastTS == nil || !stats.LastTS.Equal(at(tt.want[len(tt.want)-1])) {
+						t.Errorf("GetSummaryStats last %v, want %v", stats.LastTS, at(tt.want[len(tt.want)-1]))
+					}
+					if len(stats.ByDevice) != 1 || stats.ByDevice[0].Count != int64(len(tt.want)) {
+						t.Errorf("GetSummaryStats by device %+v, want %d readings of device 1", stats.ByDevice, len(tt.want))
+					}
+				}
+			})
+		}
+	})
+
+	run(t, "GetReadingsPagination", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		var seen []int
+		for page := 1; page <= 4; page++ {
+			params := interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(1), Limit: 3, Page: page, IncludeTotal: true}
+			result, err := b.Readings.GetReadingsByDevice(ctx, params)
+			if err != nil {
+				t.Fatalf("page %d: %v", page, err)
+			}
+			if result.Total == nil || *result.Total != 10 {
+				t.Errorf("page %d total is %v, want 10", page, result.Total)
+			}
+			seen = append(seen, timestamps(result.Items)...)
+			if page < 4 && (result.NextPageToken == nil || *result.NextPageToken != []string{"", "2", "3", "4"}[page]) {
+				t.Errorf("page %d next page token is %v", page, result.NextPageToken)
+			}
+			if page == 4 && result.NextPageToken != nil {
+				t.Errorf("last page has next page token %q", *result.NextPageToken)
+			}
+		}
+		if want := []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}; !reflect.DeepEqual(seen, want) {
+			t.Errorf("pages listed %v, want %v", seen, want)
+		}
+
+		result, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Limit: 3, Page: 1})
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		if result.Total != nil {
+			t.Errorf("total is %d without IncludeTotal", *result.Total)
+		}
+
+		if _, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Limit: 3, Page: 1}); err == nil {
+			t.Error("GetReadingsByDevice without a device succeeded")
+		}
+		if _, err := b.Readings.GetReadingsByDevice(ctx, interfaces.ReadingQueryParams{DeviceID: ptr(1), Limit: 3, Page: 1}); err == nil {
+			t.Error("GetReadingsByDevice without a Pi succeeded")
+		}
+	})
+
+	run(t, "GetReadingsSample", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		result, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Sample: 3, Limit: 2, Page: 2, IncludeTotal: true})
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		// Every third reading newest first is 9, 6, 3, 0; the second page is 3, 0
+		if got, want := timestamps(result.Items), []int{3, 0}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if result.Total == nil || *result.Total != 4 {
+			t.Errorf("total is %v, want the 4 sampled readings", result.Total)
+		}
+		if result.Sample != 3 {
+			t.Errorf("sample is %d, want 3", result.Sample)
+		}
+
+		if _, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Sample: 3, Since: ptr(at(0)), Limit: 2}); err == nil {
+			t.Error("sample with since succeeded")
+		}
+		if _, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Sample: 3, ReceivedSince: ptr(at(0)), Limit: 2}); err == nil {
+			t.Error("sample with received_since succeeded")
+		}
+	})
+
+	run(t, "GetReadingsSinceCursor", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		for deviceID := 1; deviceID <= 2; deviceID++ {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: deviceID, DeviceType: "sensor", CreatedAt: at(0)})
+		}
+		// Both devices share every timestamp, so pages split ties
+		var readings []hardware_models.Reading
+		for i := 0; i < 4; i++ {
+			readings = append(readings, reading("pi-a", 1, at(i), i), reading("pi-a", 2, at(i), i))
+		}
+		addReadings(t, ctx, b, readings...)
+
+		type key struct{ ts, deviceID int }
+		var seen []key
+		params := interfaces.ReadingQueryParams{PiID: "pi-a", Since: ptr(at(0)), Limit: 3, IncludeTotal: true}
+		wantTotals := []int{6, 3, 0}
+		for page := 0; page < 3; page++ {
+			result, err := b.Readings.GetReadings(ctx, params)
+			if err != nil {
+				t.Fatalf("page %d: %v", page, err)
+			}
+			if result.Total == nil || *result.Total != wantTotals[page] {
+				t.Errorf("page %d total is %v, want %d", page, result.Total, wantTotals[page])
+			}
+			for _, reading := range result.Items {
+				seen = append(seen, key{int(reading.Ts.Sub(base) / time.Second), reading.DeviceID})
+			}
+			if result.NextPageToken == nil {
+				t.Fatalf("page %d has no next page token", page)
+			}
+			cursor, err := interfaces.DecodeReadingCursor(*result.NextPageToken)
+			if err != nil {
+				t.Fatalf("DecodeReadingCursor: %v", err)
+			}
+			if page == 2 && (!cursor.Ts.Equal(params.After.Ts) || cursor.DeviceID != params.After.DeviceID) {
+				t.Errorf("caught-up token is %+v, want the previous cursor %+v", cursor, params.After)
+			}
+			params.After = cursor
+		}
+		want := []key{{1, 1}, {1, 2}, {2, 1}, {2, 2}, {3, 1}, {3, 2}}
+		if !reflect.DeepEqual(seen, want) {
+			t.Errorf("walked %v, want %v", seen, want)
+		}
+	})
+
+	run(t, "GetReadingsReceivedSince", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "sensor", CreatedAt: at(0)})
+		received := func(ts, receivedAt int) hardware_models.Reading {
+			r := reading("pi-a", 1, at(ts), ts)
+			r.ReceivedAt = ptr(at(receivedAt))
+			return r
+		}
+		// The reading at 1 arrives last, long after the others
+		addReadings(t, ctx, b, received(2, 100), received(3, 101), received(1, 200), received(0, 50))
+
+		params := interfaces.ReadingQueryParams{PiID: "pi-a", ReceivedSince: ptr(at(60)), Limit: 2, IncludeTotal: true}
+		result, err := b.Readings.GetReadings(ctx, params)
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		if got, want := timestamps(result.Items), []int{2, 3}; !reflect.DeepEqual(got, want) {
+			t.Errorf("first page is %v, want %v", got, want)
+		}
+		if result.Total == nil || *result.Total != 3 {
+			t.Errorf("total is %v, want 3", result.Total)
+		}
+		cursor, err := interfaces.DecodeReadingCursor(*result.NextPageToken)
+		if err != nil {
+			t.Fatalf("DecodeReadingCursor: %v", err)
+		}
+		if cursor.ReceivedAt == nil {
+			t.Fatal("cursor has no received_at")
+		}
+
+		params.After = cursor
+		result, err = b.Readings.GetReadings(ctx, params)
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		if got, want := timestamps(result.Items), []int{1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("second page is %v, want the late reading %v", got, want)
+		}
+
+		params.After = &interfaces.ReadingCursor{Ts: at(2), DeviceID: 1}
+		if _, err := b.Readings.GetReadings(ctx, params); err == nil {
+			t.Error("a since cursor was accepted for received_since")
+		}
+	})
+
+	run(t, "LatestReadings", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		for _, deviceID := range []int{3, 0, 1} {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: deviceID, DeviceType: "sensor", CreatedAt: at(0)})
+		}
+		addReadings(t, ctx, b, reading("pi-a", 3, at(1), 1), reading("pi-a", 3, at(5), 2), reading("pi-a", 0, at(3), 3), reading("pi-a", 0, at(2), 4))
+
+		latest, err := b.Readings.GetLatestReadings(ctx, "pi-a")
+		if err != nil {
+			t.Fatalf("GetLatestReadings: %v", err)
+		}
+		if len(latest) != 2 || latest[0].DeviceID != 0 || !latest[0].Ts.Equal(at(3)) || latest[1].DeviceID != 3 || !latest[1].Ts.Equal(at(5)) {
+			t.Errorf("latest readings are %+v", latest)
+		}
+
+		reading, err := b.Readings.GetLatestReading(ctx, "pi-a", 1)
+		if err != nil || reading != nil {
+			t.Errorf("device without readings returned %+v, %v", reading, err)
+		}
+		latest, err = b.Readings.GetLatestReadings(ctx, "pi-missing")
+		if err != nil || len(latest) != 0 {
+			t.Errorf("missing Pi returned %+v, %v", latest, err)
+		}
+	})
+
+	run(t, "IterateReadings", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 2500)
+
+		// Across the batch boundaries, in order, each reading once
+		var seen []int
+		err := b.Readings.IterateReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a"}, func(reading hardware_models.Reading) error {
+			seen = append(seen, int(reading.Ts.Sub(base)/time.Second))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("IterateReadings: %v", err)
+		}
+		if len(seen) != 2500 {
+			t.Fatalf("iterated %d readings, want 2500", len(seen))
+		}
+		for n, second := range seen {
+			if second != n {
+				t.Fatalf("reading %d is at second %d", n, second)
+			}
+		}
+
+		tests := []struct {
+			name   string
+			params interfaces.ReadingQueryParams
+			count  int
+			first  int
+		}{
+			{name: "limit", params: interfaces.ReadingQueryParams{Limit: 1500}, count: 1500, first: 0},
+			{name: "since is exclusive", params: interfaces.ReadingQueryParams{Since: ptr(at(999))}, count: 1500, first: 1000},
+			{name: "range", params: interfaces.ReadingQueryParams{From: ptr(at(10)), To: ptr(at(20))}, count: 10, first: 10},
+			{name: "other device", params: interfaces.ReadingQueryParams{DeviceID: ptr(2)}, count: 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var seen []int
+				err := b.Readings.IterateReadings(ctx, tt.params, func(reading hardware_models.Reading) error {
+					seen = append(seen, int(reading.Ts.Sub(base)/time.Second))
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("IterateReadings: %v", err)
+				}
+				if len(seen) != tt.count || (tt.count > 0 && seen[0] != tt.first) {
+					t.Errorf("iterated %d readings from %v, want %d from %d", len(seen), seen[:min(len(seen), 1)], tt.count, tt.first)
+				}
+			})
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = b.Readings.IterateReadings(ctx, interfaces.ReadingQueryParams{}, func(hardware_models.Reading) error {
+			calls++
+			if calls == 3 {
+				return stop
+			}
+			return nil
+		})
+		if !errors.Is(err, stop) || calls != 3 {
+			t.Errorf("stopping after 3 readings returned %v after %d calls", err, calls)
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		err = b.Readings.IterateReadings(cancelled, interfaces.ReadingQueryParams{}, func(hardware_models.Reading) error { return nil })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled iteration returned %v", err)
+		}
+	})
+
+	run(t, "SummaryStats", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		for deviceID := 1; deviceID <= 2; deviceID++ {
+			addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: deviceID, DeviceType: "sensor", CreatedAt: at(0)})
+		}
+		addReadings(t, ctx, b, reading("pi-a", 1, at(1), 1), reading("pi-a", 1, at(4), 1), reading("pi-a", 2, at(2), 1), reading("pi-a", 2, at(9), 1))
+
+		stats, err := b.Readings.GetSummaryStats(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", DeviceID: ptr(1), To: ptr(at(9))})
+		if err != nil {
+			t.Fatalf("GetSummaryStats: %v", err)
+		}
+		if stats.Count != 2 || !stats.FirstTS.Equal(at(1)) || !stats.LastTS.Equal(at(4)) {
+			t.Errorf("stats are %d from %v to %v, want 2 from %v to %v", stats.Count, stats.FirstTS, stats.LastTS, at(1), at(4))
+		}
+		// Per-device stats cover the Pi's devices within the range
+		if len(stats.ByDevice) != 2 {
+			t.Fatalf("by device is %+v", stats.ByDevice)
+		}
+		for n, want := range []interfaces.DeviceStats{
+			{PiID: "pi-a", DeviceID: "1", Count: 2, FirstTS: ptr(at(1)), LastTS: ptr(at(4))},
+			{PiID: "pi-a", DeviceID: "2", Count: 1, FirstTS: ptr(at(2)), LastTS: ptr(at(2))},
+		} {
+			got := stats.ByDevice[n]
+			if got.PiID != want.PiID || got.DeviceID != want.DeviceID || got.Count != want.Count || !got.FirstTS.Equal(*want.FirstTS) || !got.LastTS.Equal(*want.LastTS) {
+				t.Errorf("device stats %d are %+v, want %+v", n, got, want)
+			}
+		}
+
+		stats, err = b.Readings.GetSummaryStats(ctx, interfaces.ReadingQueryParams{From: ptr(at(20))})
+		if err != nil {
+			t.Fatalf("GetSummaryStats: %v", err)
+		}
+		if stats.Count != 0 || stats.FirstTS != nil || stats.LastTS != nil || stats.ByDevice != nil {
+			t.Errorf("empty range stats are %+v", stats)
+		}
+	})
+
+	run(t, "PayloadKeys", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addPi(t, ctx, b, "pi-a", "user-a", at(0))
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 1, DeviceType: "weather", CreatedAt: at(0)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 2, DeviceType: "weather", CreatedAt: at(0)})
+		addDevice(t, ctx, b, hardware_models.Device{PiID: "pi-a", DeviceID: 3, DeviceType: "light", CreatedAt: at(0)})
+		payload := func(deviceID, second int, payload map[string]interface{}) hardware_models.Reading {
+			return hardware_models.Reading{PiID: "pi-a", DeviceID: deviceID, Ts: at(second), Payload: payload}
+		}
+		addReadings(t, ctx, b,
+			payload(1, 1, map[string]interface{}{"temp": 20, "state": "ok"}),
+			payload(1, 2, map[string]interface{}{"temp": "n/a"}),
+			payload(1, 3, map[string]interface{}{"temp": 21, "tags": []interface{}{"a"}}),
+			payload(1, 10, map[string]interface{}{"late": true}),
+			payload(2, 1, map[string]interface{}{"hum": nil}),
+			payload(3, 1, map[string]interface{}{"lux": 3}),
+		)
+
+		keys, err := b.Readings.GetPayloadKeys(ctx, interfaces.PayloadKeyQuery{PiID: "pi-a", DeviceID: 1, From: at(0), To: at(10)})
+		if err != nil {
+			t.Fatalf("GetPayloadKeys: %v", err)
+		}
+		want := []interfaces.PayloadKeyStats{
+			{Key: "temp", Occurrences: 3, SampleType: "number"},
+			{Key: "state", Occurrences: 1, SampleType: "string"},
+			{Key: "tags", Occurrences: 1, SampleType: "array"},
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("device keys are %+v, want %+v", keys, want)
+		}
+
+		keys, err = b.Readings.GetPayloadKeys(ctx, interfaces.PayloadKeyQuery{DeviceType: "weather", From: at(1), To: at(2)})
+		if err != nil {
+			t.Fatalf("GetPayloadKeys: %v", err)
+		}
+		want = []interfaces.PayloadKeyStats{
+			{Key: "hum", Occurrences: 1, SampleType: "null"},
+			{Key: "state", Occurrences: 1, SampleType: "string"},
+			{Key: "temp", Occurrences: 1, SampleType: "number"},
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("device type keys are %+v, want %+v", keys, want)
+		}
+
+		keys, err = b.Readings.GetPayloadKeys(ctx, interfaces.PayloadKeyQuery{PiID: "pi-a", DeviceID: 1, From: at(20), To: at(30)})
+		if err != nil || keys == nil || len(keys) != 0 {
+			t.Errorf("empty window returned %#v, %v, want an empty list", keys, err)
+		}
+	})
+
+	run(t, "DeviceReadingSummary", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		summary, err := b.Readings.GetDeviceReadingSummary(ctx, "pi-a", 1, 10)
+		if err != nil {
+			t.Fatalf("GetDeviceReadingSummary: %v", err)
+		}
+		if summary.Count != 10 || summary.Approximate || !summary.FirstTS.Equal(at(0)) || !summary.LastTS.Equal(at(9)) {
+			t.Errorf("exact summary is %+v", summary)
+		}
+
+		summary, err = b.Readings.GetDeviceReadingSummary(ctx, "pi-a", 1, 5)
+		if err != nil {
+			t.Fatalf("GetDeviceReadingSummary: %v", err)
+		}
+		// An estimate, but never below what could be counted
+		if !summary.Approximate || summary.Count < 6 {
+			t.Errorf("approximate summary is %+v", summary)
+		}
+
+		summary, err = b.Readings.GetDeviceReadingSummary(ctx, "pi-a", 2, 5)
+		if err != nil {
+			t.Fatalf("GetDeviceReadingSummary: %v", err)
+		}
+		if *summary != (interfaces.DeviceReadingSummary{}) {
+			t.Errorf("device without readings summary is %+v", summary)
+		}
+	})
+
+	run(t, "CountAndDeleteByTimeRange", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		tests := []struct {
+			name  string
+			limit int64
+			want  int64
+		}{
+			{name: "unlimited", limit: 0, want: 5},
+			{name: "limit below count", limit: 3, want: 3},
+			{name: "limit above count", limit: 50, want: 5},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				count, err := b.Readings.CountReadingsByTimeRange(ctx, "pi-a", 1, at(2), at(7), tt.limit)
+				if err != nil {
+					t.Fatalf("CountReadingsByTimeRange: %v", err)
+				}
+				if count != tt.want {
+					t.Errorf("counted %d, want %d", count, tt.want)
+				}
+			})
+		}
+
+		deleted, err := b.Readings.DeleteReadingsByTimeRange(ctx, "pi-a", 1, at(2), at(7))
+		if err != nil {
+			t.Fatalf("DeleteReadingsByTimeRange: %v", err)
+		}
+		if deleted != 5 {
+			t.Errorf("deleted %d, want 5", deleted)
+		}
+		result, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Limit: 100, Page: 1})
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		if got, want := timestamps(result.Items), []int{9, 8, 7, 1, 0}; !reflect.DeepEqual(got, want) {
+			t.Errorf("left %v, want %v", got, want)
+		}
+	})
+
+	run(t, "DeleteReadingsInChunks", factory, func(t *testing.T, ctx context.Context, b Backend) {
+		addDeviceWithReadings(t, ctx, b, 10)
+
+		if _, err := b.Readings.DeleteReadingsInChunks(ctx, "pi-a", 1, at(0), at(10), 0, func(int64) error { return nil }); err == nil {
+			t.Error("a chunk size of 0 was accepted")
+		}
+
+		// The oldest go first: stopping after one chunk leaves the newest
+		stop := errors.New("stop")
+		total, err := b.Readings.DeleteReadingsInChunks(ctx, "pi-a", 1, at(0), at(10), 2, func(int64) error { return stop })
+		if !errors.Is(err, stop) || total != 2 {
+			t.Fatalf("stopped deletion returned %d, %v", total, err)
+		}
+		result, err := b.Readings.GetReadings(ctx, interfaces.ReadingQueryParams{PiID: "pi-a", Limit: 100, Page: 1})
+		if err != nil {
+			t.Fatalf("GetReadings: %v", err)
+		}
+		if got, want := timestamps(result.Items), []int{9, 8, 7, 6, 5, 4, 3, 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("left %v, want %v", got, want)
+		}
+
+		tests := []struct {
+			name   string
+			start  int
+			end    int
+			chunks []int64
+		}{
+			// A full last chunk is followed by an empty one
+			{name: "exact multiple", start: 2, end: 8, chunks: []int64{3, 3, 0}},
+			{name: "short last chunk", start: 8, end: 20, chunks: []int64{2}},
+			{name: "nothing in range", start: 20, end: 30, chunks: []int64{0}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var chunks []int64
+				total, err := b.Readings.DeleteReadingsInChunks(ctx, "pi-a", 1, at(tt.start), at(tt.end), 3, func(deleted int64) error {
+					chunks = append(chunks, deleted)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("DeleteReadingsInChunks: %v", err)
+				}
+				var want int64
+				for _, chunk := range tt.chunks {
+					want += chunk
+				}
+				if total != want || !reflect.DeepEqual(chunks, tt.chunks) {
+					t.Errorf("deleted %d in chunks %v, want %d in %v", total, chunks, want, tt.chunks)
+				}
+			})
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := b.Readings.DeleteReadingsInChunks(cancelled, "pi-a", 1, at(0), at(10), 3, func(int64) error { return nil }); !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled deletion returned %v", err)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+)
+
+type PostgresAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db}
+}
+
+// Create inserts a new audit event
+func (r *PostgresAuditRepository) Create(ctx context.Context, event *audit_models.AuditEvent) error {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	detailsJSON, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal details: %w", err)
+	}
+
+	impersonatorID := sql.NullString{String: event.ImpersonatorID, Valid: event.ImpersonatorID != ""}
+
+	query := `
+		INSERT INTO audit_events (event_id, actor_type, actor_id, action, resource_type, resource_id, impersonator_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err = r.db.ExecContext(ctx, query, event.EventID, event.ActorType, event.ActorID,
+		event.Action, event.ResourceType, event.ResourceID, impersonatorID, detailsJSON, event.CreatedAt)
+	return err
+}
@@ -0,0 +1,75 @@
+//go:build integration
+
+package implementation_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/health"
+	conformance "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Conformance"
+	implementation "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Implementation"
+)
+
+// The tests run against a scratch database named by CONFORMANCE_POSTGRES_DSN,
+// whose Pis, devices, readings and users they truncate before every test:
+//
+//	CONFORMANCE_POSTGRES_DSN=postgres://... go test -tags integration ./MQT.Repository/Implementation/
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("CONFORMANCE_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("CONFORMANCE_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	if err := health.NewDatabaseManager(db).CreateTables(ctx); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `TRUNCATE pis, device_types, users CASCADE`); err != nil {
+		t.Fatalf("failed to truncate tables: %v", err)
+	}
+	return db
+}
+
+func newBackend(t *testing.T) conformance.Backend {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	return conformance.Backend{
+		Pis:      implementation.NewPostgresPiRepository(db),
+		Devices:  implementation.NewPostgresDeviceRepository(db),
+		Readings: implementation.NewPostgresReadingRepository(db),
+		AddUser: func(t *testing.T, userID string) {
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO users (user_id, username, email, password, role)
+				VALUES ($1, $1, $1 || '@example.com', 'x', 'user')
+				ON CONFLICT (user_id) DO NOTHING
+			`, userID)
+			if err != nil {
+				t.Fatalf("failed to add user %s: %v", userID, err)
+			}
+		},
+	}
+}
+
+func TestPiRepositoryConformance(t *testing.T) {
+	conformance.RunPiRepositoryTests(t, newBackend)
+}
+
+func TestDeviceRepositoryConformance(t *testing.T) {
+	conformance.RunDeviceRepositoryTests(t, newBackend)
+}
+
+func TestReadingRepositoryConformance(t *testing.T) {
+	conformance.RunReadingRepositoryTests(t, newBackend)
+}
@@ -3,7 +3,10 @@ package implementation
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
@@ -20,23 +23,54 @@ func NewPostgresDeviceRepository(db *sql.DB) *PostgresDeviceRepository {
 // Create device (idempotent upsert)
 func (r *PostgresDeviceRepository) CreateOrUpdateDevice(ctx context.Context, device hardware_models.Device) error {
 	query := `
-		INSERT INTO devices (pi_id, device_id, device_type, created_at) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO devices (pi_id, device_id, device_type, meta, created_at) 
+		VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT (pi_id, device_id) 
-		DO UPDATE SET device_type = EXCLUDED.device_type
+		DO UPDATE SET device_type = EXCLUDED.device_type, meta = EXCLUDED.meta
 	`
 
-	_, err := r.db.ExecContext(ctx, query, device.PiID, device.DeviceID, device.DeviceType, device.CreatedAt)
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, device.PiID, device.DeviceID, device.DeviceType, metaJSON, device.CreatedAt)
 	return err
 }
 
+// CreateDeviceIfAbsent inserts device, doing nothing when it already exists, so
+// concurrent creations of the same device settle on whichever came first
+func (r *PostgresDeviceRepository) CreateDeviceIfAbsent(ctx context.Context, device hardware_models.Device) (bool, error) {
+	query := `
+		INSERT INTO devices (pi_id, device_id, device_type, meta, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (pi_id, device_id) DO NOTHING
+	`
+
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := r.db.ExecContext(ctx, query, device.PiID, device.DeviceID, device.DeviceType, metaJSON, device.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
 // Read devices
 func (r *PostgresDeviceRepository) GetDevice(ctx context.Context, piID string, deviceID int) (*hardware_models.Device, error) {
-	query := `SELECT pi_id, device_id, device_type, created_at FROM devices WHERE pi_id = $1 AND device_id = $2`
+	query := `SELECT pi_id, device_id, device_type, meta, created_at FROM devices WHERE pi_id = $1 AND device_id = $2`
 
 	var device hardware_models.Device
+	var metaJSON []byte
 
-	err := r.db.QueryRowContext(ctx, query, piID, deviceID).Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &device.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, piID, deviceID).Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &metaJSON, &device.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, sql.ErrNoRows
@@ -44,14 +78,86 @@ func (r *PostgresDeviceRepository) GetDevice(ctx context.Context, piID string, d
 		return nil, err
 	}
 
+	if err := unmarshalMeta(metaJSON, &device.Meta); err != nil {
+		return nil, err
+	}
+
 	return &device, nil
 }
 
-func (r *PostgresDeviceRepository) ListDevicesByPi(ctx context.Context, piID string, page, pageSize int) (*interfaces.PaginationResult, error) {
-	offset := (page - 1) * pageSize
-	query := `SELECT pi_id, device_id, device_type, created_at FROM devices WHERE pi_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+// ExistingDevices matches keys against devices with one (pi_id, device_id)
+// IN list
+func (r *PostgresDeviceRepository) ExistingDevices(ctx context.Context, keys []interfaces.DeviceKey) (map[interfaces.DeviceKey]bool, error) {
+	existing := make(map[interfaces.DeviceKey]bool, len(keys))
+	if len(keys) == 0 {
+		return existing, nil
+	}
+
+	pairs := make([]string, len(keys))
+	args := make([]interface{}, 0, len(keys)*2)
+	for n, key := range keys {
+		pairs[n] = fmt.Sprintf("($%d, $%d::integer)", n*2+1, n*2+2)
+		args = append(args, key.PiID, key.DeviceID)
+	}
+	query := `SELECT pi_id, device_id FROM devices WHERE (pi_id, device_id) IN (` + strings.Join(pairs, ", ") + `)`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key interfaces.DeviceKey
+		if err := rows.Scan(&key.PiID, &key.DeviceID); err != nil {
+			return nil, err
+		}
+		existing[key] = true
+	}
+	return existing, rows.Err()
+}
+
+// ListAllDeviceKeys looks up the devices of piIDs with one IN list
+func (r *PostgresDeviceRepository) ListAllDeviceKeys(ctx context.Context, piIDs []string) ([]interfaces.DeviceKey, error) {
+	if len(piIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(piIDs))
+	args := make([]interface{}, len(piIDs))
+	for n, piID := range piIDs {
+		placeholders[n] = fmt.Sprintf("$%d", n+1)
+		args[n] = piID
+	}
+	query := `SELECT pi_id, device_id FROM devices WHERE pi_id IN (` + strings.Join(placeholders, ", ") + `) ORDER BY pi_id, device_id`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []interfaces.DeviceKey
+	for rows.Next() {
+		var key interfaces.DeviceKey
+		if err := rows.Scan(&key.PiID, &key.DeviceID); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresDeviceRepository) ListDevicesByPi(ctx context.Context, piID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	offset := (opts.Page - 1) * opts.PageSize
+	query := `SELECT pi_id, device_id, device_type, meta, created_at FROM devices WHERE pi_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+
+	total, err := r.countDevices(ctx, piID, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := r.db.QueryContext(ctx, query, piID, pageSize, offset)
+	rows, err := r.db.QueryContext(ctx, query, piID, opts.PageSize, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -60,8 +166,13 @@ func (r *PostgresDeviceRepository) ListDevicesByPi(ctx context.Context, piID str
 	var devices []hardware_models.Device
 	for rows.Next() {
 		var device hardware_models.Device
+		var metaJSON []byte
+
+		if err := rows.Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &metaJSON, &device.CreatedAt); err != nil {
+			return nil, err
+		}
 
-		if err := rows.Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &device.CreatedAt); err != nil {
+		if err := unmarshalMeta(metaJSON, &device.Meta); err != nil {
 			return nil, err
 		}
 
@@ -74,26 +185,172 @@ func (r *PostgresDeviceRepository) ListDevicesByPi(ctx context.Context, piID str
 
 	result := &interfaces.PaginationResult{
 		Items: devices,
+		Total: total,
 	}
 
 	// Check if there are more pages
-	if len(devices) == pageSize {
-		nextPage := page + 1
+	if len(devices) == opts.PageSize {
+		nextPage := opts.Page + 1
 		result.NextPage = &nextPage
 	}
 
 	return result, nil
 }
 
+// FindDevicesByMeta uses JSONB containment so the lookup is served by idx_devices_meta_gin
+func (r *PostgresDeviceRepository) FindDevicesByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Device, error) {
+	matchJSON, err := json.Marshal(match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meta match: %w", err)
+	}
+
+	query := `
+		SELECT d.pi_id, d.device_id, d.device_type, d.meta, d.created_at
+		FROM devices d
+		JOIN pis p ON p.pi_id = d.pi_id
+		WHERE d.meta @> $1::jsonb`
+	args := []interface{}{matchJSON}
+	if userID != "" {
+		query += ` AND p.user_id = $2`
+		args = append(args, userID)
+	}
+	query += fmt.Sprintf(` ORDER BY d.created_at DESC LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []hardware_models.Device
+	for rows.Next() {
+		var device hardware_models.Device
+		var metaJSON []byte
+
+		if err := rows.Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &metaJSON, &device.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := unmarshalMeta(metaJSON, &device.Meta); err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// ListDevicesWithLatest lists a page of devices, each with its most recent reading.
+// The lateral subquery is a LIMIT 1 walk of idx_readings_pi_device_ts_desc per
+// device, so the cost doesn't grow with the number of stored readings.
+func (r *PostgresDeviceRepository) ListDevicesWithLatest(ctx context.Context, piID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	offset := (opts.Page - 1) * opts.PageSize
+	total, err := r.countDevices(ctx, piID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT d.pi_id, d.device_id, d.device_type, d.meta, d.created_at, latest.ts, latest.payload
+		FROM (
+			SELECT pi_id, device_id, device_type, meta, created_at
+			FROM devices
+			WHERE pi_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2 OFFSET $3
+		) d
+		LEFT JOIN LATERAL (
+			SELECT ts, payload
+			FROM readings
+			WHERE readings.pi_id = d.pi_id AND readings.device_id = d.device_id
+			ORDER BY ts DESC
+			LIMIT 1
+		) latest ON true
+		ORDER BY d.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, piID, opts.PageSize, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []hardware_models.DeviceWithLatest
+	for rows.Next() {
+		var device hardware_models.DeviceWithLatest
+		var ts sql.NullTime
+		var metaJSON, payloadJSON []byte
+
+		if err := rows.Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &metaJSON, &device.CreatedAt, &ts, &payloadJSON); err != nil {
+			return nil, err
+		}
+
+		if err := unmarshalMeta(metaJSON, &device.Meta); err != nil {
+			return nil, err
+		}
+
+		if ts.Valid {
+			current := &hardware_models.Reading{PiID: device.PiID, DeviceID: device.DeviceID, Ts: ts.Time}
+			if err := hardware_models.DecodePayload(payloadJSON, &current.Payload); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+			}
+			device.Current = current
+		}
+
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &interfaces.PaginationResult{
+		Items: devices,
+		Total: total,
+	}
+
+	// Check if there are more pages
+	if len(devices) == opts.PageSize {
+		nextPage := opts.Page + 1
+		result.NextPage = &nextPage
+	}
+
+	return result, nil
+}
+
+// countDevices returns the number of devices of a Pi when opts asks for the
+// total of its listings, and nil otherwise
+func (r *PostgresDeviceRepository) countDevices(ctx context.Context, piID string, opts interfaces.PageOptions) (*int, error) {
+	if !opts.IncludeTotal {
+		return nil, nil
+	}
+	count, err := countRows(ctx, r.db, `SELECT 1 FROM devices WHERE pi_id = $1`, piID)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
 // Update device
 func (r *PostgresDeviceRepository) UpdateDevice(ctx context.Context, device hardware_models.Device) error {
 	query := `
 		UPDATE devices 
-		SET device_type = $1 
-		WHERE pi_id = $2 AND device_id = $3
+		SET device_type = $1, meta = $2 
+		WHERE pi_id = $3 AND device_id = $4
 	`
 
-	result, err := r.db.ExecContext(ctx, query, device.DeviceType, device.PiID, device.DeviceID)
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, query, device.DeviceType, metaJSON, device.PiID, device.DeviceID)
 	if err != nil {
 		return err
 	}
@@ -110,6 +367,47 @@ func (r *PostgresDeviceRepository) UpdateDevice(ctx context.Context, device hard
 	return nil
 }
 
+// TouchLiveness updates devices and pis from one VALUES list in a single
+// statement, so a whole ingest flush costs one round trip. GREATEST ignores
+// NULL, so the first touch sets the column and later ones only advance it.
+func (r *PostgresDeviceRepository) TouchLiveness(ctx context.Context, entries []interfaces.DeviceLiveness) (interfaces.LivenessResult, error) {
+	var result interfaces.LivenessResult
+	if len(entries) == 0 {
+		return result, nil
+	}
+
+	rows := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*3)
+	for n, entry := range entries {
+		rows = append(rows, fmt.Sprintf("($%d, $%d::integer, $%d::timestamptz)", n*3+1, n*3+2, n*3+3))
+		args = append(args, entry.PiID, entry.DeviceID, entry.LastTs)
+	}
+
+	query := `
+		WITH touched (pi_id, device_id, last_ts) AS (
+			VALUES ` + strings.Join(rows, ", ") + `
+		),
+		touched_devices AS (
+			UPDATE devices d
+			SET last_reading_at = GREATEST(d.last_reading_at, t.last_ts)
+			FROM touched t
+			WHERE d.pi_id = t.pi_id AND d.device_id = t.device_id
+			RETURNING d.pi_id
+		),
+		touched_pis AS (
+			UPDATE pis p
+			SET last_seen_at = GREATEST(p.last_seen_at, latest.last_ts)
+			FROM (SELECT pi_id, MAX(last_ts) AS last_ts FROM touched GROUP BY pi_id) latest
+			WHERE p.pi_id = latest.pi_id
+			RETURNING p.pi_id
+		)
+		SELECT (SELECT COUNT(*) FROM touched_devices), (SELECT COUNT(*) FROM touched_pis)
+	`
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&result.Devices, &result.Pis)
+	return result, err
+}
+
 // Delete device
 func (r *PostgresDeviceRepository) DeleteDevice(ctx context.Context, piID string, deviceID int, cascade bool) error {
 	var query string
@@ -137,3 +435,94 @@ func (r *PostgresDeviceRepository) DeleteDevice(ctx context.Context, piID string
 
 	return nil
 }
+
+// GetDeclaredUnits returns the declared payload units of every device on a pi,
+// keyed by device_id. Units declared on the device type are merged first and the
+// device's own meta.units overrides them field by field.
+func (r *PostgresDeviceRepository) GetDeclaredUnits(ctx context.Context, piID string) (map[int]map[string]string, error) {
+	query := `
+		SELECT d.device_id, COALESCE(t.meta->'units', '{}'::jsonb), COALESCE(d.meta->'units', '{}'::jsonb)
+		FROM devices d
+		LEFT JOIN device_types t ON t.device_type = d.device_type
+		WHERE d.pi_id = $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, piID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	declared := make(map[int]map[string]string)
+	for rows.Next() {
+		var deviceID int
+		var typeUnitsJSON, deviceUnitsJSON []byte
+
+		if err := rows.Scan(&deviceID, &typeUnitsJSON, &deviceUnitsJSON); err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]string)
+		for _, unitsJSON := range [][]byte{typeUnitsJSON, deviceUnitsJSON} {
+			var fieldUnits map[string]interface{}
+			if err := json.Unmarshal(unitsJSON, &fieldUnits); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal units: %w", err)
+			}
+			for field, unit := range fieldUnits {
+				if symbol, ok := unit.(string); ok {
+					merged[field] = symbol
+				}
+			}
+		}
+		if len(merged) > 0 {
+			declared[deviceID] = merged
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return declared, nil
+}
+
+// GetDeviceType returns a device type's shared settings, or nil if none are stored
+func (r *PostgresDeviceRepository) GetDeviceType(ctx context.Context, deviceType string) (*hardware_models.DeviceType, error) {
+	query := `SELECT device_type, meta, updated_at FROM device_types WHERE device_type = $1`
+
+	var dt hardware_models.DeviceType
+	var metaJSON []byte
+
+	err := r.db.QueryRowContext(ctx, query, deviceType).Scan(&dt.DeviceType, &metaJSON, &dt.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := unmarshalMeta(metaJSON, &dt.Meta); err != nil {
+		return nil, err
+	}
+
+	return &dt, nil
+}
+
+// UpsertDeviceType stores a device type's shared settings, replacing its meta
+func (r *PostgresDeviceRepository) UpsertDeviceType(ctx context.Context, dt *hardware_models.DeviceType) error {
+	query := `
+		INSERT INTO device_types (device_type, meta, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (device_type)
+		DO UPDATE SET meta = EXCLUDED.meta, updated_at = EXCLUDED.updated_at
+	`
+
+	metaJSON, err := marshalMeta(dt.Meta)
+	if err != nil {
+		return err
+	}
+
+	dt.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, query, dt.DeviceType, metaJSON, dt.UpdatedAt)
+	return err
+}
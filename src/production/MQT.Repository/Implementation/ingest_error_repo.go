@@ -0,0 +1,92 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PostgresIngestErrorRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIngestErrorRepository(db *sql.DB) *PostgresIngestErrorRepository {
+	return &PostgresIngestErrorRepository{db: db}
+}
+
+// CreateMany inserts every report with one multi-row VALUES list
+func (r *PostgresIngestErrorRepository) CreateMany(ctx context.Context, reports []ingest_models.IngestErrorReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	const columns = 7
+	rows := make([]string, len(reports))
+	args := make([]interface{}, 0, len(reports)*columns)
+	for n, report := range reports {
+		base := n * columns
+		rows[n] = fmt.Sprintf("($%d, $%d, $%d, $%d, NULLIF($%d, ''), $%d, $%d)", base+1, base+2, base+3, base+4, base+5, base+6, base+7)
+		affected := report.AffectedCount
+		if affected < 1 {
+			affected = 1
+		}
+		args = append(args, report.PiID, report.DeviceID, report.ErrorType, report.Message, report.Topic, affected, report.Ts)
+	}
+	query := `INSERT INTO ingest_errors (pi_id, device_id, error_type, message, topic, affected_count, ts) VALUES ` + strings.Join(rows, ", ")
+
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *PostgresIngestErrorRepository) ListByPi(ctx context.Context, q interfaces.IngestErrorQuery) (*interfaces.PaginationResult, error) {
+	query := `
+		SELECT error_id, pi_id, device_id, error_type, message, COALESCE(topic, ''), affected_count, ts, received_at
+		FROM ingest_errors
+		WHERE pi_id = $1`
+	args := []interface{}{q.PiID}
+	if q.From != nil {
+		args = append(args, *q.From)
+		query += fmt.Sprintf(` AND ts >= $%d`, len(args))
+	}
+	if q.To != nil {
+		args = append(args, *q.To)
+		query += fmt.Sprintf(` AND ts < $%d`, len(args))
+	}
+	args = append(args, q.PageSize, (q.Page-1)*q.PageSize)
+	query += fmt.Sprintf(` ORDER BY ts DESC, error_id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ingest_models.IngestErrorRecord{}
+	for rows.Next() {
+		var record ingest_models.IngestErrorRecord
+		if err := rows.Scan(&record.ErrorID, &record.PiID, &record.DeviceID, &record.ErrorType, &record.Message,
+			&record.Topic, &record.AffectedCount, &record.Ts, &record.ReceivedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &interfaces.PaginationResult{
+		Items: records,
+	}
+
+	// Check if there are more pages
+	if len(records) == q.PageSize {
+		nextPage := q.Page + 1
+		result.NextPage = &nextPage
+	}
+
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PostgresInstallationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresInstallationRepository(db *sql.DB) *PostgresInstallationRepository {
+	return &PostgresInstallationRepository{db: db}
+}
+
+// GetInstallID inserts a random install ID unless the single installation row
+// already exists, then returns the stored ID
+func (r *PostgresInstallationRepository) GetInstallID(ctx context.Context) (string, error) {
+	insert := `
+		INSERT INTO installation (singleton, install_id)
+		VALUES (true, $1)
+		ON CONFLICT (singleton) DO NOTHING
+	`
+	if _, err := r.db.ExecContext(ctx, insert, uuid.New().String()); err != nil {
+		return "", err
+	}
+
+	var installID string
+	err := r.db.QueryRowContext(ctx, `SELECT install_id FROM installation WHERE singleton`).Scan(&installID)
+	if err != nil {
+		return "", err
+	}
+	return installID, nil
+}
+
+// CountResources counts users, pis and devices in one round trip
+func (r *PostgresInstallationRepository) CountResources(ctx context.Context) (*interfaces.ResourceCounts, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM users),
+		       (SELECT COUNT(*) FROM pis),
+		       (SELECT COUNT(*) FROM devices)
+	`
+
+	var counts interfaces.ResourceCounts
+	if err := r.db.QueryRowContext(ctx, query).Scan(&counts.Users, &counts.Pis, &counts.Devices); err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
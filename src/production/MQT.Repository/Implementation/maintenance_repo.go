@@ -0,0 +1,59 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PostgresMaintenanceRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMaintenanceRepository(db *sql.DB) *PostgresMaintenanceRepository {
+	return &PostgresMaintenanceRepository{db: db}
+}
+
+func (r *PostgresMaintenanceRepository) GetState(ctx context.Context) (*interfaces.MaintenanceState, error) {
+	query := `
+		SELECT enabled, COALESCE(reason, ''), COALESCE(enabled_by, ''), started_at, expires_at, updated_at
+		FROM maintenance_state
+		WHERE singleton
+	`
+
+	var state interfaces.MaintenanceState
+	var startedAt, expiresAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query).Scan(&state.Enabled, &state.Reason, &state.EnabledBy, &startedAt, &expiresAt, &state.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if startedAt.Valid {
+		state.StartedAt = &startedAt.Time
+	}
+	if expiresAt.Valid {
+		state.ExpiresAt = &expiresAt.Time
+	}
+	return &state, nil
+}
+
+func (r *PostgresMaintenanceRepository) SaveState(ctx context.Context, state interfaces.MaintenanceState) error {
+	query := `
+		INSERT INTO maintenance_state (singleton, enabled, reason, enabled_by, started_at, expires_at, updated_at)
+		VALUES (true, $1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, now())
+		ON CONFLICT (singleton)
+		DO UPDATE SET enabled = EXCLUDED.enabled,
+		              reason = EXCLUDED.reason,
+		              enabled_by = EXCLUDED.enabled_by,
+		              started_at = EXCLUDED.started_at,
+		              expires_at = EXCLUDED.expires_at,
+		              updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query, state.Enabled, state.Reason, state.EnabledBy, state.StartedAt, state.ExpiresAt)
+	return err
+}
@@ -0,0 +1,29 @@
+package implementation
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for the readings write path, served by the API service on /metrics
+var (
+	readingInsertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api_service",
+		Name:      "reading_insert_duration_seconds",
+		Help:      "Time taken to insert readings, by operation (single, batch).",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"operation"})
+
+	readingInsertErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api_service",
+		Name:      "reading_insert_errors_total",
+		Help:      "Failed reading inserts, by operation (single, batch).",
+	}, []string{"operation"})
+
+	readingInsertRows = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "api_service",
+		Name:      "reading_insert_batch_rows",
+		Help:      "Readings per batch insert.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
@@ -0,0 +1,94 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type PostgresMqttCredentialRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMqttCredentialRepository(db *sql.DB) *PostgresMqttCredentialRepository {
+	return &PostgresMqttCredentialRepository{db: db}
+}
+
+// Issue revokes the pi's active credential and stores the new one in a single transaction
+func (r *PostgresMqttCredentialRepository) Issue(ctx context.Context, credential *hardware_models.MqttCredential) error {
+	if credential.CredentialID == "" {
+		credential.CredentialID = uuid.New().String()
+	}
+	credential.CreatedAt = time.Now()
+
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	_, err = txn.ExecContext(ctx,
+		`UPDATE mqtt_credentials SET revoked_at = $1 WHERE pi_id = $2 AND revoked_at IS NULL`,
+		credential.CreatedAt, credential.PiID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, `
+		INSERT INTO mqtt_credentials (credential_id, pi_id, secret_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, credential.CredentialID, credential.PiID, credential.SecretHash, credential.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// GetLatest returns the most recently issued credential for a pi, or nil if there is none
+func (r *PostgresMqttCredentialRepository) GetLatest(ctx context.Context, piID string) (*hardware_models.MqttCredential, error) {
+	query := `
+		SELECT credential_id, pi_id, secret_hash, created_at, revoked_at
+		FROM mqtt_credentials
+		WHERE pi_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var credential hardware_models.MqttCredential
+	var revokedAt sql.NullTime
+
+	err := r.db.QueryRowContext(ctx, query, piID).Scan(&credential.CredentialID, &credential.PiID,
+		&credential.SecretHash, &credential.CreatedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		credential.RevokedAt = &revokedAt.Time
+	}
+
+	return &credential, nil
+}
+
+// Revoke revokes the pi's active credential
+func (r *PostgresMqttCredentialRepository) Revoke(ctx context.Context, piID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE mqtt_credentials SET revoked_at = now() WHERE pi_id = $1 AND revoked_at IS NULL`, piID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
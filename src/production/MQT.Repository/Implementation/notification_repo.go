@@ -0,0 +1,167 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+)
+
+type PostgresNotificationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresNotificationRepository(db *sql.DB) *PostgresNotificationRepository {
+	return &PostgresNotificationRepository{db: db}
+}
+
+func (r *PostgresNotificationRepository) GetPreferences(ctx context.Context, userID string) (*notification_models.Preferences, error) {
+	query := `
+		SELECT user_id, channels, digest_mode, COALESCE(quiet_hours_start, ''), COALESCE(quiet_hours_end, ''), timezone, updated_at
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	var prefs notification_models.Preferences
+	var channels []byte
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&prefs.UserID, &channels, &prefs.DigestMode, &prefs.QuietHoursStart, &prefs.QuietHoursEnd, &prefs.Timezone, &prefs.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(channels, &prefs.Channels); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (r *PostgresNotificationRepository) UpsertPreferences(ctx context.Context, prefs *notification_models.Preferences) error {
+	channels := prefs.Channels
+	if channels == nil {
+		channels = []string{}
+	}
+	channelsJSON, err := json.Marshal(channels)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO notification_preferences (user_id, channels, digest_mode, quiet_hours_start, quiet_hours_end, timezone, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, now())
+		ON CONFLICT (user_id)
+		DO UPDATE SET channels = EXCLUDED.channels,
+		              digest_mode = EXCLUDED.digest_mode,
+		              quiet_hours_start = EXCLUDED.quiet_hours_start,
+		              quiet_hours_end = EXCLUDED.quiet_hours_end,
+		              timezone = EXCLUDED.timezone,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRowContext(ctx, query, prefs.UserID, channelsJSON, prefs.DigestMode, prefs.QuietHoursStart, prefs.QuietHoursEnd, prefs.Timezone).Scan(&prefs.UpdatedAt)
+}
+
+func (r *PostgresNotificationRepository) EnqueueNotification(ctx context.Context, pending notification_models.PendingNotification) error {
+	var data []byte
+	if pending.Data != nil {
+		var err error
+		if data, err = json.Marshal(pending.Data); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO pending_notifications (user_id, channel, kind, subject, body, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, pending.UserID, pending.Channel, pending.Kind, pending.Subject, pending.Body, data)
+	return err
+}
+
+func (r *PostgresNotificationRepository) ListPendingRecipients(ctx context.Context) ([]notification_models.PendingRecipient, error) {
+	query := `
+		SELECT p.user_id, u.email, p.channel, COALESCE(w.dispatched_until, 'epoch'::timestamptz)
+		FROM (SELECT DISTINCT user_id, channel FROM pending_notifications) p
+		JOIN users u ON u.user_id = p.user_id
+		LEFT JOIN notification_digest_watermarks w ON w.user_id = p.user_id AND w.channel = p.channel
+		ORDER BY p.user_id, p.channel
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []notification_models.PendingRecipient
+	for rows.Next() {
+		var recipient notification_models.PendingRecipient
+		if err := rows.Scan(&recipient.UserID, &recipient.Email, &recipient.Channel, &recipient.DispatchedUntil); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+func (r *PostgresNotificationRepository) ListPendingNotifications(ctx context.Context, userID, channel string, from, until time.Time) ([]notification_models.PendingNotification, error) {
+	query := `
+		SELECT event_id, user_id, channel, kind, subject, body, data, created_at
+		FROM pending_notifications
+		WHERE user_id = $1 AND channel = $2 AND created_at >= $3 AND created_at < $4
+		ORDER BY created_at, event_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, channel, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []notification_models.PendingNotification
+	for rows.Next() {
+		var n notification_models.PendingNotification
+		var data []byte
+		if err := rows.Scan(&n.EventID, &n.UserID, &n.Channel, &n.Kind, &n.Subject, &n.Body, &data, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if data != nil {
+			if err := json.Unmarshal(data, &n.Data); err != nil {
+				return nil, err
+			}
+		}
+		pending = append(pending, n)
+	}
+	return pending, rows.Err()
+}
+
+func (r *PostgresNotificationRepository) AdvanceWatermark(ctx context.Context, userID, channel string, until time.Time) error {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	upsert := `
+		INSERT INTO notification_digest_watermarks (user_id, channel, dispatched_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, channel)
+		DO UPDATE SET dispatched_until = GREATEST(notification_digest_watermarks.dispatched_until, EXCLUDED.dispatched_until)
+	`
+	if _, err := txn.ExecContext(ctx, upsert, userID, channel, until); err != nil {
+		return err
+	}
+
+	cleanup := `DELETE FROM pending_notifications WHERE user_id = $1 AND channel = $2 AND created_at < $3`
+	if _, err := txn.ExecContext(ctx, cleanup, userID, channel, until); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
@@ -0,0 +1,204 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type PostgresPayloadSchemaRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPayloadSchemaRepository(db *sql.DB) *PostgresPayloadSchemaRepository {
+	return &PostgresPayloadSchemaRepository{db: db}
+}
+
+const payloadSchemaColumns = `device_type, version, schema, enforcement, active, COALESCE(created_by, ''), created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPayloadSchema(row rowScanner) (*hardware_models.PayloadSchema, error) {
+	var schema hardware_models.PayloadSchema
+	var document []byte
+	if err := row.Scan(&schema.DeviceType, &schema.Version, &document, &schema.Enforcement,
+		&schema.Active, &schema.CreatedBy, &schema.CreatedAt); err != nil {
+		return nil, err
+	}
+	schema.Schema = json.RawMessage(document)
+	return &schema, nil
+}
+
+func (r *PostgresPayloadSchemaRepository) querySchemas(ctx context.Context, query string, args ...interface{}) ([]hardware_models.PayloadSchema, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := []hardware_models.PayloadSchema{}
+	for rows.Next() {
+		schema, err := scanPayloadSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, *schema)
+	}
+
+	return schemas, rows.Err()
+}
+
+// CreateSchema locks the device type's rows so concurrent creates can't pick
+// the same version
+func (r *PostgresPayloadSchemaRepository) CreateSchema(ctx context.Context, schema *hardware_models.PayloadSchema) error {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('payload_schemas:' || $1))`, schema.DeviceType); err != nil {
+		return err
+	}
+
+	if schema.Active {
+		if _, err := txn.ExecContext(ctx,
+			`UPDATE payload_schemas SET active = false WHERE device_type = $1 AND active`, schema.DeviceType); err != nil {
+			return err
+		}
+	}
+
+	err = txn.QueryRowContext(ctx, `
+		INSERT INTO payload_schemas (device_type, version, schema, enforcement, active, created_by)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, NULLIF($5, '')
+		FROM payload_schemas
+		WHERE device_type = $1
+		RETURNING version, created_at
+	`, schema.DeviceType, []byte(schema.Schema), schema.Enforcement, schema.Active, schema.CreatedBy).Scan(&schema.Version, &schema.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *PostgresPayloadSchemaRepository) ListSchemas(ctx context.Context, deviceType string) ([]hardware_models.PayloadSchema, error) {
+	query := `SELECT ` + payloadSchemaColumns + ` FROM payload_schemas WHERE device_type = $1 ORDER BY version DESC`
+	return r.querySchemas(ctx, query, deviceType)
+}
+
+func (r *PostgresPayloadSchemaRepository) GetSchema(ctx context.Context, deviceType string, version int) (*hardware_models.PayloadSchema, error) {
+	query := `SELECT ` + payloadSchemaColumns + ` FROM payload_schemas WHERE device_type = $1 AND version = $2`
+	return scanPayloadSchema(r.db.QueryRowContext(ctx, query, deviceType, version))
+}
+
+func (r *PostgresPayloadSchemaRepository) GetActiveSchema(ctx context.Context, deviceType string) (*hardware_models.PayloadSchema, error) {
+	query := `SELECT ` + payloadSchemaColumns + ` FROM payload_schemas WHERE device_type = $1 AND active`
+	return scanPayloadSchema(r.db.QueryRowContext(ctx, query, deviceType))
+}
+
+func (r *PostgresPayloadSchemaRepository) ListActiveSchemas(ctx context.Context) ([]hardware_models.PayloadSchema, error) {
+	query := `SELECT ` + payloadSchemaColumns + ` FROM payload_schemas WHERE active ORDER BY device_type`
+	return r.querySchemas(ctx, query)
+}
+
+func (r *PostgresPayloadSchemaRepository) UpdateSchema(ctx context.Context, deviceType string, version int, enforcement *string, active *bool) (*hardware_models.PayloadSchema, error) {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	if active != nil && *active {
+		if _, err := txn.ExecContext(ctx,
+			`UPDATE payload_schemas SET active = false WHERE device_type = $1 AND version <> $2 AND active`,
+			deviceType, version); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE payload_schemas
+		SET enforcement = COALESCE($3, enforcement),
+		    active = COALESCE($4, active)
+		WHERE device_type = $1 AND version = $2
+		RETURNING ` + payloadSchemaColumns
+
+	schema, err := scanPayloadSchema(txn.QueryRowContext(ctx, query, deviceType, version, enforcement, active))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (r *PostgresPayloadSchemaRepository) DeleteSchema(ctx context.Context, deviceType string, version int) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM payload_schemas WHERE device_type = $1 AND version = $2`, deviceType, version)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *PostgresPayloadSchemaRepository) RecordViolation(ctx context.Context, violation hardware_models.PayloadSchemaViolation) error {
+	violationsJSON, err := json.Marshal(violation.Violations)
+	if err != nil {
+		return fmt.Errorf("failed to marshal violations: %w", err)
+	}
+
+	query := `
+		INSERT INTO payload_schema_violations (pi_id, device_id, ts, device_type, schema_version, violations)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err = r.db.ExecContext(ctx, query, violation.PiID, violation.DeviceID, violation.Ts,
+		violation.DeviceType, violation.SchemaVersion, violationsJSON)
+	return err
+}
+
+func (r *PostgresPayloadSchemaRepository) ListViolations(ctx context.Context, deviceType string, limit int) ([]hardware_models.PayloadSchemaViolation, error) {
+	query := `
+		SELECT violation_id, pi_id, device_id, ts, device_type, schema_version, violations, created_at
+		FROM payload_schema_violations
+		WHERE device_type = $1
+		ORDER BY created_at DESC, violation_id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, deviceType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	violations := []hardware_models.PayloadSchemaViolation{}
+	for rows.Next() {
+		var violation hardware_models.PayloadSchemaViolation
+		var violationsJSON []byte
+		if err := rows.Scan(&violation.ViolationID, &violation.PiID, &violation.DeviceID, &violation.Ts,
+			&violation.DeviceType, &violation.SchemaVersion, &violationsJSON, &violation.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(violationsJSON, &violation.Violations); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal violations: %w", err)
+		}
+		violations = append(violations, violation)
+	}
+
+	return violations, rows.Err()
+}
@@ -0,0 +1,124 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type PostgresPendingDeviceRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPendingDeviceRepository(db *sql.DB) *PostgresPendingDeviceRepository {
+	return &PostgresPendingDeviceRepository{db: db}
+}
+
+// Record upserts on (pi_id, device_id), so a Pi repeating its announcement
+// keeps a single entry
+func (r *PostgresPendingDeviceRepository) Record(ctx context.Context, device hardware_models.PendingDevice) error {
+	query := `
+		INSERT INTO pending_devices (pi_id, device_id, device_type, firmware)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (pi_id, device_id)
+		DO UPDATE SET device_type = EXCLUDED.device_type,
+		              firmware = EXCLUDED.firmware,
+		              last_seen_at = now(),
+		              seen_count = pending_devices.seen_count + 1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, device.PiID, device.DeviceID, device.DeviceType, device.Firmware)
+	return err
+}
+
+func (r *PostgresPendingDeviceRepository) ListByPi(ctx context.Context, piID string) ([]hardware_models.PendingDevice, error) {
+	query := `
+		SELECT pi_id, device_id, device_type, COALESCE(firmware, ''), first_seen_at, last_seen_at, seen_count
+		FROM pending_devices
+		WHERE pi_id = $1
+		ORDER BY first_seen_at, device_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, piID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []hardware_models.PendingDevice{}
+	for rows.Next() {
+		var device hardware_models.PendingDevice
+		if err := rows.Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &device.Firmware,
+			&device.FirstSeenAt, &device.LastSeenAt, &device.SeenCount); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+// Approve takes the device type from the pending entry. A device created by
+// other means in the meantime is kept as it is and returned.
+func (r *PostgresPendingDeviceRepository) Approve(ctx context.Context, piID string, deviceID int, meta map[string]interface{}) (*hardware_models.Device, error) {
+	metaJSON, err := marshalMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	var deviceType string
+	err = txn.QueryRowContext(ctx,
+		`DELETE FROM pending_devices WHERE pi_id = $1 AND device_id = $2 RETURNING device_type`,
+		piID, deviceID).Scan(&deviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = txn.ExecContext(ctx, `
+		INSERT INTO devices (pi_id, device_id, device_type, meta)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (pi_id, device_id) DO NOTHING
+	`, piID, deviceID, deviceType, metaJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var device hardware_models.Device
+	var storedMeta []byte
+	err = txn.QueryRowContext(ctx,
+		`SELECT pi_id, device_id, device_type, meta, created_at FROM devices WHERE pi_id = $1 AND device_id = $2`,
+		piID, deviceID).Scan(&device.PiID, &device.DeviceID, &device.DeviceType, &storedMeta, &device.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalMeta(storedMeta, &device.Meta); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *PostgresPendingDeviceRepository) Reject(ctx context.Context, piID string, deviceID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM pending_devices WHERE pi_id = $1 AND device_id = $2`, piID, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
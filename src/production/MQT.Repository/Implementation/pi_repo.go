@@ -3,7 +3,9 @@ package implementation
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
@@ -30,36 +32,158 @@ func (r *PostgresPiRepository) CreateOrUpdatePi(ctx context.Context, pi hardware
 	return err
 }
 
+// CreateOrUpdatePis upserts a batch of pis in a single transaction, setting only meta.
+// Ownership is never changed. Results are returned in input order.
+func (r *PostgresPiRepository) CreateOrUpdatePis(ctx context.Context, pis []hardware_models.Pi) ([]interfaces.PiUpsertResult, error) {
+	if len(pis) == 0 {
+		return nil, nil
+	}
+
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	// xmax is zero for freshly inserted rows, which tells created and updated apart
+	query := `
+		INSERT INTO pis (pi_id, meta, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (pi_id)
+		DO UPDATE SET meta = EXCLUDED.meta
+		RETURNING (xmax = 0)
+	`
+
+	results := make([]interfaces.PiUpsertResult, 0, len(pis))
+	for _, pi := range pis {
+		metaJSON, err := marshalMeta(pi.Meta)
+		if err != nil {
+			return nil, err
+		}
+
+		var created bool
+		if err := txn.QueryRowContext(ctx, query, pi.PiID, metaJSON, pi.CreatedAt).Scan(&created); err != nil {
+			return nil, fmt.Errorf("failed to upsert pi %s: %w", pi.PiID, err)
+		}
+		results = append(results, interfaces.PiUpsertResult{PiID: pi.PiID, Created: created})
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
 // Read pis
 func (r *PostgresPiRepository) GetPi(ctx context.Context, piID string) (*hardware_models.Pi, error) {
-	query := `SELECT pi_id, user_id, created_at FROM pis WHERE pi_id = $1`
+	query := `SELECT pi_id, user_id, meta, created_at FROM pis WHERE pi_id = $1`
 
 	var pi hardware_models.Pi
+	var userID sql.NullString
+	var metaJSON []byte
 
-	err := r.db.QueryRowContext(ctx, query, piID).Scan(&pi.PiID, &pi.UserID, &pi.CreatedAt)
+	// A missing Pi is sql.ErrNoRows, never a nil Pi without an error
+	err := r.db.QueryRowContext(ctx, query, piID).Scan(&pi.PiID, &userID, &metaJSON, &pi.CreatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
+		return nil, err
+	}
+
+	pi.UserID = userID.String
+	if err := unmarshalMeta(metaJSON, &pi.Meta); err != nil {
 		return nil, err
 	}
 
 	return &pi, nil
 }
 
-func (r *PostgresPiRepository) ListPis(ctx context.Context, userID string, page, pageSize int) (*interfaces.PaginationResult, error) {
-	offset := (page - 1) * pageSize
-	var query string
+// GetPiOwners looks up every Pi of piIDs with one IN list
+func (r *PostgresPiRepository) GetPiOwners(ctx context.Context, piIDs []string) (map[string]string, error) {
+	owners := make(map[string]string, len(piIDs))
+	if len(piIDs) == 0 {
+		return owners, nil
+	}
+
+	placeholders := make([]string, len(piIDs))
+	args := make([]interface{}, len(piIDs))
+	for n, piID := range piIDs {
+		placeholders[n] = fmt.Sprintf("$%d", n+1)
+		args[n] = piID
+	}
+	query := `SELECT pi_id, user_id FROM pis WHERE pi_id IN (` + strings.Join(placeholders, ", ") + `)`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var piID string
+		var userID sql.NullString
+		if err := rows.Scan(&piID, &userID); err != nil {
+			return nil, err
+		}
+		owners[piID] = userID.String
+	}
+	return owners, rows.Err()
+}
+
+// ListAllPiIDs pages through pis by pi_id, so a page costs an index range
+// scan however far in it starts
+func (r *PostgresPiRepository) ListAllPiIDs(ctx context.Context, page interfaces.RegistryPage) ([]string, error) {
+	query := `SELECT p.pi_id FROM pis p WHERE p.pi_id > $1`
+	args := []interface{}{page.After}
+	if page.OwnedOnly {
+		query += ` AND p.user_id IS NOT NULL`
+	}
+	if page.UpdatedSince != nil {
+		args = append(args, *page.UpdatedSince)
+		n := len(args)
+		query += fmt.Sprintf(` AND (p.created_at >= $%d OR EXISTS (SELECT 1 FROM devices d WHERE d.pi_id = p.pi_id AND d.created_at >= $%d))`, n, n)
+	}
+	args = append(args, page.Limit)
+	query += fmt.Sprintf(` ORDER BY p.pi_id LIMIT $%d`, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var piIDs []string
+	for rows.Next() {
+		var piID string
+		if err := rows.Scan(&piID); err != nil {
+			return nil, err
+		}
+		piIDs = append(piIDs, piID)
+	}
+	return piIDs, rows.Err()
+}
+
+func (r *PostgresPiRepository) ListPis(ctx context.Context, userID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	offset := (opts.Page - 1) * opts.PageSize
+	query := `SELECT pi_id, user_id, meta, created_at FROM pis`
 	var args []interface{}
 
 	if userID != "" {
-		query = `SELECT pi_id, user_id, created_at FROM pis WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-		args = []interface{}{userID, pageSize, offset}
-	} else {
-		query = `SELECT pi_id, user_id, created_at FROM pis ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-		args = []interface{}{pageSize, offset}
+		query += ` WHERE user_id = $1`
+		args = append(args, userID)
+	}
+
+	var total *int
+	if opts.IncludeTotal {
+		count, err := countRows(ctx, r.db, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		total = &count
 	}
 
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, opts.PageSize, offset)
+
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -69,8 +193,15 @@ func (r *PostgresPiRepository) ListPis(ctx context.Context, userID string, page,
 	var pis []hardware_models.Pi
 	for rows.Next() {
 		var pi hardware_models.Pi
+		var userID sql.NullString
+		var metaJSON []byte
 
-		if err := rows.Scan(&pi.PiID, &pi.UserID, &pi.CreatedAt); err != nil {
+		if err := rows.Scan(&pi.PiID, &userID, &metaJSON, &pi.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		pi.UserID = userID.String
+		if err := unmarshalMeta(metaJSON, &pi.Meta); err != nil {
 			return nil, err
 		}
 
@@ -83,17 +214,75 @@ func (r *PostgresPiRepository) ListPis(ctx context.Context, userID string, page,
 
 	result := &interfaces.PaginationResult{
 		Items: pis,
+		Total: total,
 	}
 
 	// Check if there are more pages
-	if len(pis) == pageSize {
-		nextPage := page + 1
+	if len(pis) == opts.PageSize {
+		nextPage := opts.Page + 1
 		result.NextPage = &nextPage
 	}
 
 	return result, nil
 }
 
+// FindPisByMeta uses JSONB containment so the lookup is served by idx_pis_meta_gin
+func (r *PostgresPiRepository) FindPisByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Pi, error) {
+	matchJSON, err := json.Marshal(match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meta match: %w", err)
+	}
+
+	query := `SELECT pi_id, user_id, meta, created_at FROM pis WHERE meta @> $1::jsonb`
+	args := []interface{}{matchJSON}
+	if userID != "" {
+		query += ` AND user_id = $2`
+		args = append(args, userID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pis []hardware_models.Pi
+	for rows.Next() {
+		var pi hardware_models.Pi
+		var owner sql.NullString
+		var metaJSON []byte
+
+		if err := rows.Scan(&pi.PiID, &owner, &metaJSON, &pi.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		pi.UserID = owner.String
+		if err := unmarshalMeta(metaJSON, &pi.Meta); err != nil {
+			return nil, err
+		}
+
+		pis = append(pis, pi)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pis, nil
+}
+
+// CountPisByUser returns the number of pis assigned to a user
+func (r *PostgresPiRepository) CountPisByUser(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM pis WHERE user_id = $1`
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 // Update pi
 func (r *PostgresPiRepository) UpdatePi(ctx context.Context, pi hardware_models.Pi) error {
 	query := `
@@ -146,3 +335,39 @@ func (r *PostgresPiRepository) DeletePi(ctx context.Context, piID string, cascad
 
 	return nil
 }
+
+// marshalMeta encodes a meta map for a JSONB column, storing nil as an empty object
+func marshalMeta(meta map[string]interface{}) ([]byte, error) {
+	if meta == nil {
+		return []byte("{}"), nil
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meta: %w", err)
+	}
+	return metaJSON, nil
+}
+
+// countRows returns how many rows query matches, for PageOptions.IncludeTotal.
+// query is a listing's filtered SELECT, without its ORDER BY and LIMIT.
+func countRows(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+query+`) counted`, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// unmarshalMeta decodes a JSONB meta column, leaving empty objects as nil
+func unmarshalMeta(metaJSON []byte, meta *map[string]interface{}) error {
+	if len(metaJSON) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(metaJSON, meta); err != nil {
+		return fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	if len(*meta) == 0 {
+		*meta = nil
+	}
+	return nil
+}
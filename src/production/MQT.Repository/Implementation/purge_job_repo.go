@@ -0,0 +1,113 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+const purgeJobColumns = `purge_id, pi_id, device_id, range_from, range_to, status, estimated_rows, deleted_rows,
+	chunks, cancel_requested, COALESCE(error, ''), COALESCE(requested_by, ''), created_at, updated_at, finished_at`
+
+type PostgresPurgeJobRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPurgeJobRepository(db *sql.DB) *PostgresPurgeJobRepository {
+	return &PostgresPurgeJobRepository{db: db}
+}
+
+func (r *PostgresPurgeJobRepository) Create(ctx context.Context, job *interfaces.PurgeJob) error {
+	query := `
+		INSERT INTO purge_jobs (pi_id, device_id, range_from, range_to, status, estimated_rows, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING purge_id, created_at, updated_at
+	`
+
+	job.Status = interfaces.PurgeStatusRunning
+	return r.db.QueryRowContext(ctx, query, job.PiID, job.DeviceID, job.From, job.To, job.Status, job.EstimatedRows, job.RequestedBy).
+		Scan(&job.PurgeID, &job.CreatedAt, &job.UpdatedAt)
+}
+
+func (r *PostgresPurgeJobRepository) Get(ctx context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	query := `SELECT ` + purgeJobColumns + ` FROM purge_jobs WHERE purge_id = $1`
+
+	job, err := scanPurgeJob(r.db.QueryRowContext(ctx, query, purgeID))
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *PostgresPurgeJobRepository) List(ctx context.Context, limit int) ([]interfaces.PurgeJob, error) {
+	query := `SELECT ` + purgeJobColumns + ` FROM purge_jobs ORDER BY purge_id DESC LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []interfaces.PurgeJob{}
+	for rows.Next() {
+		job, err := scanPurgeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *PostgresPurgeJobRepository) RecordChunk(ctx context.Context, purgeID int64, deleted int64) (bool, error) {
+	query := `
+		UPDATE purge_jobs
+		SET deleted_rows = deleted_rows + $2, chunks = chunks + 1, updated_at = now()
+		WHERE purge_id = $1
+		RETURNING cancel_requested
+	`
+
+	var cancelRequested bool
+	err := r.db.QueryRowContext(ctx, query, purgeID, deleted).Scan(&cancelRequested)
+	return cancelRequested, err
+}
+
+func (r *PostgresPurgeJobRepository) RequestCancel(ctx context.Context, purgeID int64) (*interfaces.PurgeJob, error) {
+	query := `
+		UPDATE purge_jobs
+		SET cancel_requested = true, updated_at = now()
+		WHERE purge_id = $1 AND status = 'running'
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, purgeID); err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, purgeID)
+}
+
+func (r *PostgresPurgeJobRepository) Finish(ctx context.Context, purgeID int64, status, errMsg string) error {
+	query := `
+		UPDATE purge_jobs
+		SET status = $2, error = NULLIF($3, ''), updated_at = now(), finished_at = now()
+		WHERE purge_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, purgeID, status, errMsg)
+	return err
+}
+
+// scanPurgeJob reads one row selected with purgeJobColumns
+func scanPurgeJob(row interface{ Scan(...interface{}) error }) (*interfaces.PurgeJob, error) {
+	var job interfaces.PurgeJob
+	var finishedAt sql.NullTime
+	err := row.Scan(&job.PurgeID, &job.PiID, &job.DeviceID, &job.From, &job.To, &job.Status, &job.EstimatedRows, &job.DeletedRows,
+		&job.Chunks, &job.CancelRequested, &job.Error, &job.RequestedBy, &job.CreatedAt, &job.UpdatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
@@ -4,28 +4,62 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 )
 
+// Insert operations reported to metrics and the insert observer
+const (
+	InsertOperationSingle = "single"
+	InsertOperationBatch  = "batch"
+)
+
+// InsertObserver is told about every reading insert, successful or not
+type InsertObserver func(operation string, duration time.Duration, err error)
+
 type PostgresReadingRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	observer InsertObserver
 }
 
 func NewPostgresReadingRepository(db *sql.DB) *PostgresReadingRepository {
 	return &PostgresReadingRepository{db: db}
 }
 
+// SetInsertObserver registers a callback for insert latencies. It must be called
+// before the repository is used.
+func (r *PostgresReadingRepository) SetInsertObserver(observer InsertObserver) {
+	r.observer = observer
+}
+
+// observeInsert records an insert's latency and outcome
+func (r *PostgresReadingRepository) observeInsert(operation string, start time.Time, err error) {
+	duration := time.Since(start)
+	readingInsertDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		readingInsertErrorsTotal.WithLabelValues(operation).Inc()
+	}
+	if r.observer != nil {
+		r.observer(operation, duration, err)
+	}
+}
+
 // Reading operations
-func (r *PostgresReadingRepository) CreateReading(ctx context.Context, reading hardware_models.Reading) error {
+func (r *PostgresReadingRepository) CreateReading(ctx context.Context, reading hardware_models.Reading) (err error) {
+	start := time.Now()
+	defer func() { r.observeInsert(InsertOperationSingle, start, err) }()
+
+	// Live ingestion may leave received_at unset; it then defaults to now()
 	query := `
-        INSERT INTO readings (pi_id, device_id, ts, payload) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO readings (pi_id, device_id, ts, payload, received_at) 
+        VALUES ($1, $2, $3, $4, COALESCE($5::timestamptz, now()))
     `
 
 	payloadJSON, err := json.Marshal(reading.Payload)
@@ -33,86 +67,452 @@ func (r *PostgresReadingRepository) CreateReading(ctx context.Context, reading h
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	_, err = r.db.ExecContext(ctx, query, reading.PiID, reading.DeviceID, reading.Ts, payloadJSON)
+	_, err = r.db.ExecContext(ctx, query, reading.PiID, reading.DeviceID, reading.Ts, payloadJSON, reading.ReceivedAt)
+	if reason, ok := readingViolation(err); ok {
+		if reason == interfaces.ReadingFailureDuplicate {
+			return interfaces.ErrDuplicateReading
+		}
+		return interfaces.ErrReadingDeviceNotFound
+	}
 	return err
 }
 
-func (r *PostgresReadingRepository) CreateReadings(ctx context.Context, readings []hardware_models.Reading) error {
+// foreignKeyViolation is the Postgres SQLSTATE for a foreign key violation
+const foreignKeyViolation = "23503"
+
+// CreateReadings inserts readings with a single statement. If that statement
+// fails on a foreign key or primary key violation it is rolled back and the
+// batch is inserted again in halves under savepoints, down to the single rows
+// that fail. The happy path stays one statement, and each bad reading costs
+// O(log n) extra statements instead of failing the whole batch.
+func (r *PostgresReadingRepository) CreateReadings(ctx context.Context, readings []hardware_models.Reading) (result *interfaces.ReadingBatchResult, err error) {
 	if len(readings) == 0 {
-		return nil
+		return &interfaces.ReadingBatchResult{}, nil
 	}
 
-	// Use batched VALUES upsert for conflict handling
+	start := time.Now()
+	readingInsertRows.Observe(float64(len(readings)))
+	defer func() { r.observeInsert(InsertOperationBatch, start, err) }()
+
 	txn, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	err = insertReadings(ctx, txn, readings)
+	if err == nil {
+		if err = txn.Commit(); err != nil {
+			return nil, err
+		}
+		return &interfaces.ReadingBatchResult{Inserted: len(readings)}, nil
+	}
+	if _, ok := readingViolation(err); !ok {
+		return nil, err
+	}
+	txn.Rollback()
+
+	return r.createReadingsBisected(ctx, readings)
+}
+
+// createReadingsBisected inserts what it can of a batch that failed as a whole
+func (r *PostgresReadingRepository) createReadingsBisected(ctx context.Context, readings []hardware_models.Reading) (*interfaces.ReadingBatchResult, error) {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
 	defer txn.Rollback()
 
-	// Build batched INSERT (append-only)
+	result := &interfaces.ReadingBatchResult{}
+	if err := bisectReadings(ctx, txn, readings, 0, result); err != nil {
+		return nil, err
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// bisectReadings inserts readings, which start at offset in the batch, under a
+// savepoint. On a violation it rolls back to the savepoint and tries each half,
+// recording a single failing reading in result.
+func bisectReadings(ctx context.Context, txn *sql.Tx, readings []hardware_models.Reading, offset int, result *interfaces.ReadingBatchResult) error {
+	if _, err := txn.ExecContext(ctx, "SAVEPOINT reading_chunk"); err != nil {
+		return err
+	}
+	err := insertReadings(ctx, txn, readings)
+	if err == nil {
+		_, err = txn.ExecContext(ctx, "RELEASE SAVEPOINT reading_chunk")
+		if err == nil {
+			result.Inserted += len(readings)
+		}
+		return err
+	}
+	reason, ok := readingViolation(err)
+	if !ok {
+		return err
+	}
+	if _, err := txn.ExecContext(ctx, "ROLLBACK TO SAVEPOINT reading_chunk"); err != nil {
+		return err
+	}
+	if _, err := txn.ExecContext(ctx, "RELEASE SAVEPOINT reading_chunk"); err != nil {
+		return err
+	}
+
+	if len(readings) == 1 {
+		reading := readings[0]
+		result.Failed = append(result.Failed, interfaces.ReadingInsertFailure{
+			Index:    offset,
+			PiID:     reading.PiID,
+			DeviceID: reading.DeviceID,
+			Ts:       reading.Ts,
+			Reason:   reason,
+			Error:    err.Error(),
+		})
+		return nil
+	}
+
+	mid := len(readings) / 2
+	if err := bisectReadings(ctx, txn, readings[:mid], offset, result); err != nil {
+		return err
+	}
+	return bisectReadings(ctx, txn, readings[mid:], offset+mid, result)
+}
+
+// insertReadings inserts readings with one multi-row INSERT (append-only)
+func insertReadings(ctx context.Context, txn *sql.Tx, readings []hardware_models.Reading) error {
 	valueStrings := make([]string, len(readings))
-	args := make([]interface{}, 0, len(readings)*4)
+	args := make([]interface{}, 0, len(readings)*5)
 
 	for i, reading := range readings {
-		valueStrings[i] = fmt.Sprintf("($%d, $%d, $%d, $%d)",
-			i*4+1, i*4+2, i*4+3, i*4+4)
+		valueStrings[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, COALESCE($%d::timestamptz, now()))",
+			i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
 
 		payloadJSON, err := json.Marshal(reading.Payload)
 		if err != nil {
 			return fmt.Errorf("failed to marshal payload: %w", err)
 		}
 
-		args = append(args, reading.PiID, reading.DeviceID, reading.Ts, payloadJSON)
+		args = append(args, reading.PiID, reading.DeviceID, reading.Ts, payloadJSON, reading.ReceivedAt)
 	}
 
 	valuesClause := strings.Join(valueStrings, ",")
 
 	query := fmt.Sprintf(`
-        INSERT INTO readings (pi_id, device_id, ts, payload) 
+        INSERT INTO readings (pi_id, device_id, ts, payload, received_at) 
         VALUES %s
     `, valuesClause)
 
-	_, err = txn.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
+	_, err := txn.ExecContext(ctx, query, args...)
+	return err
+}
 
-	return txn.Commit()
+// readingViolation reports whether err is a violation that rejects individual
+// readings, and which ReadingFailure* reason it is
+func readingViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return "", false
+	}
+	switch pqErr.Code {
+	case foreignKeyViolation:
+		return interfaces.ReadingFailureDeviceNotFound, true
+	case uniqueViolation:
+		return interfaces.ReadingFailureDuplicate, true
+	default:
+		return "", false
+	}
 }
 
 func (r *PostgresReadingRepository) scanReadings(rows *sql.Rows) ([]hardware_models.Reading, error) {
 	var readings []hardware_models.Reading
 
 	for rows.Next() {
-		var reading hardware_models.Reading
-		var payloadJSON []byte
-
-		if err := rows.Scan(&reading.PiID, &reading.DeviceID, &reading.Ts, &payloadJSON); err != nil {
+		reading, err := scanReading(rows)
+		if err != nil {
 			return nil, err
 		}
+		readings = append(readings, reading)
+	}
+
+	return readings, rows.Err()
+}
+
+// scanReading scans a pi_id, device_id, ts, payload, received_at row
+func scanReading(rows *sql.Rows) (hardware_models.Reading, error) {
+	var reading hardware_models.Reading
+	var payloadJSON []byte
+	var receivedAt sql.NullTime
+
+	if err := rows.Scan(&reading.PiID, &reading.DeviceID, &reading.Ts, &payloadJSON, &receivedAt); err != nil {
+		return reading, err
+	}
+
+	if receivedAt.Valid {
+		reading.ReceivedAt = &receivedAt.Time
+	}
+
+	if err := hardware_models.DecodePayload(payloadJSON, &reading.Payload); err != nil {
+		return reading, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
 
-		if err := json.Unmarshal(payloadJSON, &reading.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	return reading, nil
+}
+
+// readingIterateBatchSize is how many rows IterateReadings fetches per query
+const readingIterateBatchSize = 1000
+
+// IterateReadings walks the matching readings in (ts, pi_id, device_id) order,
+// one keyset batch at a time. Rows are handed to fn as they are read, so only
+// the current row is held in memory, and no query outlives its batch.
+func (r *PostgresReadingRepository) IterateReadings(ctx context.Context, params interfaces.ReadingQueryParams, fn func(hardware_models.Reading) error) error {
+	filter := ` WHERE 1=1`
+	args := []interface{}{}
+	argIndex := 1
+
+	if params.PiID != "" {
+		filter += fmt.Sprintf(" AND pi_id = $%d", argIndex)
+		args = append(args, params.PiID)
+		argIndex++
+	}
+
+	if params.DeviceID != nil {
+		filter += fmt.Sprintf(" AND device_id = $%d", argIndex)
+		args = append(args, *params.DeviceID)
+		argIndex++
+	}
+
+	if params.From != nil {
+		filter += fmt.Sprintf(" AND ts >= $%d", argIndex)
+		args = append(args, *params.From)
+		argIndex++
+	}
+
+	if params.To != nil {
+		filter += fmt.Sprintf(" AND ts %s $%d", toOperator(params), argIndex)
+		args = append(args, *params.To)
+		argIndex++
+	}
+
+	if params.Since != nil {
+		filter += fmt.Sprintf(" AND ts > $%d", argIndex)
+		args = append(args, *params.Since)
+		argIndex++
+	}
+
+	var last *hardware_models.Reading
+	remaining := params.Limit
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		readings = append(readings, reading)
+		batchSize := readingIterateBatchSize
+		if params.Limit > 0 {
+			if remaining <= 0 {
+				return nil
+			}
+			if remaining < batchSize {
+				batchSize = remaining
+			}
+		}
+
+		query := `SELECT pi_id, device_id, ts, payload, received_at FROM readings` + filter
+		batchArgs := append([]interface{}{}, args...)
+		next := argIndex
+		if last != nil {
+			query += fmt.Sprintf(" AND (ts, pi_id, device_id) > ($%d, $%d, $%d)", next, next+1, next+2)
+			batchArgs = append(batchArgs, last.Ts, last.PiID, last.DeviceID)
+			next += 3
+		}
+		query += fmt.Sprintf(" ORDER BY ts, pi_id, device_id LIMIT $%d", next)
+		batchArgs = append(batchArgs, batchSize)
+
+		count, err := r.iterateBatch(ctx, query, batchArgs, func(reading hardware_models.Reading) error {
+			last = &reading
+			return fn(reading)
+		})
+		if err != nil {
+			return err
+		}
+		if count < batchSize {
+			return nil
+		}
+		remaining -= count
 	}
+}
 
-	return readings, rows.Err()
+// iterateBatch runs one IterateReadings query and returns how many rows it passed to fn
+func (r *PostgresReadingRepository) iterateBatch(ctx context.Context, query string, args []interface{}, fn func(hardware_models.Reading) error) (int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		reading, err := scanReading(rows)
+		if err != nil {
+			return count, err
+		}
+		if err := fn(reading); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
 }
 
-func (r *PostgresReadingRepository) DeleteReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time) error {
-	query := `DELETE FROM readings WHERE pi_id = $1 AND device_id = $2 AND ts BETWEEN $3 AND $4`
+// toOperator compares ts with params.To: ranges are half-open [From, To) so
+// consecutive windows never share a reading, unless InclusiveTo asks for the
+// old inclusive end
+func toOperator(params interfaces.ReadingQueryParams) string {
+	if params.InclusiveTo {
+		return "<="
+	}
+	return "<"
+}
 
-	_, err := r.db.ExecContext(ctx, query, piID, deviceID, start, end)
-	return err
+func (r *PostgresReadingRepository) DeleteReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time) (int64, error) {
+	query := `DELETE FROM readings WHERE pi_id = $1 AND device_id = $2 AND ts >= $3 AND ts < $4`
+
+	result, err := r.db.ExecContext(ctx, query, piID, deviceID, start, end)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresReadingRepository) CountReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time, limit int64) (int64, error) {
+	query := `SELECT COUNT(*) FROM readings WHERE pi_id = $1 AND device_id = $2 AND ts >= $3 AND ts < $4`
+	args := []interface{}{piID, deviceID, start, end}
+	if limit > 0 {
+		query = `
+			SELECT COUNT(*) FROM (
+				SELECT 1 FROM readings
+				WHERE pi_id = $1 AND device_id = $2 AND ts >= $3 AND ts < $4
+				LIMIT $5
+			) AS bounded
+		`
+		args = append(args, limit)
+	}
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+func (r *PostgresReadingRepository) GetDeviceReadingSummary(ctx context.Context, piID string, deviceID int, exactLimit int64) (*interfaces.DeviceReadingSummary, error) {
+	// The bounds come from the ends of the (pi_id, device_id, ts) primary key
+	summary := &interfaces.DeviceReadingSummary{}
+	var firstTS, lastTS sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT MIN(ts) FROM readings WHERE pi_id = $1 AND device_id = $2),
+			(SELECT MAX(ts) FROM readings WHERE pi_id = $1 AND device_id = $2)
+	`, piID, deviceID).Scan(&firstTS, &lastTS)
+	if err != nil {
+		return nil, err
+	}
+	if !firstTS.Valid {
+		return summary, nil
+	}
+	summary.FirstTS = &firstTS.Time
+	summary.LastTS = &lastTS.Time
+
+	count, err := r.CountReadingsByTimeRange(ctx, piID, deviceID, firstTS.Time, lastTS.Time.Add(time.Nanosecond), exactLimit+1)
+	if err != nil {
+		return nil, err
+	}
+	if count <= exactLimit {
+		summary.Count = count
+		return summary, nil
+	}
+
+	estimate, err := r.estimateDeviceReadings(ctx, piID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	// The estimate can lag behind the table; it is never below what was counted
+	summary.Count = max(estimate, count)
+	summary.Approximate = true
+	return summary, nil
+}
+
+// estimateDeviceReadings returns the planner's row estimate for a device's
+// readings, which comes from the table statistics without scanning
+func (r *PostgresReadingRepository) estimateDeviceReadings(ctx context.Context, piID string, deviceID int) (int64, error) {
+	var planJSON []byte
+	err := r.db.QueryRowContext(ctx, `
+		EXPLAIN (FORMAT JSON) SELECT 1 FROM readings WHERE pi_id = $1 AND device_id = $2
+	`, piID, deviceID).Scan(&planJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(planJSON, &plans); err != nil {
+		return 0, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+	return int64(plans[0].Plan.PlanRows), nil
+}
+
+func (r *PostgresReadingRepository) DeleteReadingsInChunks(ctx context.Context, piID string, deviceID int, start, end time.Time, chunkSize int, fn func(deleted int64) error) (int64, error) {
+	if chunkSize < 1 {
+		return 0, fmt.Errorf("chunk size must be at least 1")
+	}
+
+	// ts is unique per device, so the subquery names exactly the rows to delete
+	query := `
+		DELETE FROM readings
+		WHERE pi_id = $1 AND device_id = $2 AND ts IN (
+			SELECT ts FROM readings
+			WHERE pi_id = $1 AND device_id = $2 AND ts >= $3 AND ts < $4
+			ORDER BY ts
+			LIMIT $5
+		)
+	`
+
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		result, err := r.db.ExecContext(ctx, query, piID, deviceID, start, end, chunkSize)
+		if err != nil {
+			return total, err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+
+		if err := fn(deleted); err != nil {
+			return total, err
+		}
+		if deleted < int64(chunkSize) {
+			return total, nil
+		}
+	}
 }
 
 // Enhanced methods for new interface
 
 func (r *PostgresReadingRepository) GetLatestReadings(ctx context.Context, piID string) ([]hardware_models.Reading, error) {
 	query := `
-		SELECT DISTINCT ON (device_id) pi_id, device_id, ts, payload 
+		SELECT DISTINCT ON (device_id) pi_id, device_id, ts, payload, received_at
 		FROM readings 
 		WHERE pi_id = $1 
 		ORDER BY device_id, ts DESC
@@ -127,10 +527,36 @@ func (r *PostgresReadingRepository) GetLatestReadings(ctx context.Context, piID
 	return r.scanReadings(rows)
 }
 
+// GetLatestReading returns the most recent reading for a device, or nil if it has none
+func (r *PostgresReadingRepository) GetLatestReading(ctx context.Context, piID string, deviceID int) (*hardware_models.Reading, error) {
+	query := `
+		SELECT pi_id, device_id, ts, payload, received_at
+		FROM readings
+		WHERE pi_id = $1 AND device_id = $2
+		ORDER BY ts DESC
+		LIMIT 1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, piID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings, err := r.scanReadings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(readings) == 0 {
+		return nil, nil
+	}
+	return &readings[0], nil
+}
+
 func (r *PostgresReadingRepository) GetReadings(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
 	offset := (params.Page - 1) * params.Limit
 
-	query := `SELECT pi_id, device_id, ts, payload FROM readings WHERE 1=1`
+	query := `SELECT pi_id, device_id, ts, payload, received_at FROM readings WHERE 1=1`
 	args := []interface{}{}
 	argIndex := 1
 
@@ -140,13 +566,9 @@ func (r *PostgresReadingRepository) GetReadings(ctx context.Context, params inte
 		argIndex++
 	}
 
-	if params.DeviceID != "" {
-		deviceIDInt, err := strconv.Atoi(params.DeviceID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid device_id: %w", err)
-		}
+	if params.DeviceID != nil {
 		query += fmt.Sprintf(" AND device_id = $%d", argIndex)
-		args = append(args, deviceIDInt)
+		args = append(args, *params.DeviceID)
 		argIndex++
 	}
 
@@ -157,11 +579,36 @@ func (r *PostgresReadingRepository) GetReadings(ctx context.Context, params inte
 	}
 
 	if params.To != nil {
-		query += fmt.Sprintf(" AND ts <= $%d", argIndex)
+		query += fmt.Sprintf(" AND ts %s $%d", toOperator(params), argIndex)
 		args = append(args, *params.To)
 		argIndex++
 	}
 
+	if params.Since != nil {
+		if params.Sample > 1 {
+			return nil, fmt.Errorf("sample cannot be combined with since")
+		}
+		return r.getReadingsSince(ctx, query, args, argIndex, params)
+	}
+
+	if params.ReceivedSince != nil {
+		if params.Sample > 1 {
+			return nil, fmt.Errorf("sample cannot be combined with received_since")
+		}
+		return r.getReadingsReceivedSince(ctx, query, args, argIndex, params)
+	}
+
+	if params.Sample > 1 {
+		query = sampledReadingsQuery(query, argIndex)
+		args = append(args, params.Sample)
+		argIndex++
+	}
+
+	total, err := r.countReadings(ctx, params, query, args)
+	if err != nil {
+		return nil, err
+	}
+
 	query += fmt.Sprintf(" ORDER BY ts DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
 	args = append(args, params.Limit, offset)
 
@@ -177,7 +624,9 @@ func (r *PostgresReadingRepository) GetReadings(ctx context.Context, params inte
 	}
 
 	result := &interfaces.ReadingQueryResult{
-		Items: readings,
+		Items:  readings,
+		Total:  total,
+		Sample: params.Sample,
 	}
 
 	// Check if there are more pages
@@ -189,11 +638,16 @@ func (r *PostgresReadingRepository) GetReadings(ctx context.Context, params inte
 	return result, nil
 }
 
-func (r *PostgresReadingRepository) GetReadingsByDevice(ctx context.Context, piID string, deviceID int, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+// GetReadingsByDevice returns the readings of the device identified by
+// params.PiID and params.DeviceID, both of which are required
+func (r *PostgresReadingRepository) GetReadingsByDevice(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	if params.PiID == "" || params.DeviceID == nil {
+		return nil, fmt.Errorf("pi_id and device_id are required")
+	}
 	offset := (params.Page - 1) * params.Limit
 
-	query := `SELECT pi_id, device_id, ts, payload FROM readings WHERE pi_id = $1 AND device_id = $2`
-	args := []interface{}{piID, deviceID}
+	query := `SELECT pi_id, device_id, ts, payload, received_at FROM readings WHERE pi_id = $1 AND device_id = $2`
+	args := []interface{}{params.PiID, *params.DeviceID}
 	argIndex := 3
 
 	if params.From != nil {
@@ -203,11 +657,36 @@ func (r *PostgresReadingRepository) GetReadingsByDevice(ctx context.Context, piI
 	}
 
 	if params.To != nil {
-		query += fmt.Sprintf(" AND ts <= $%d", argIndex)
+		query += fmt.Sprintf(" AND ts %s $%d", toOperator(params), argIndex)
 		args = append(args, *params.To)
 		argIndex++
 	}
 
+	if params.Since != nil {
+		if params.Sample > 1 {
+			return nil, fmt.Errorf("sample cannot be combined with since")
+		}
+		return r.getReadingsSince(ctx, query, args, argIndex, params)
+	}
+
+	if params.ReceivedSince != nil {
+		if params.Sample > 1 {
+			return nil, fmt.Errorf("sample cannot be combined with received_since")
+		}
+		return r.getReadingsReceivedSince(ctx, query, args, argIndex, params)
+	}
+
+	if params.Sample > 1 {
+		query = sampledReadingsQuery(query, argIndex)
+		args = append(args, params.Sample)
+		argIndex++
+	}
+
+	total, err := r.countReadings(ctx, params, query, args)
+	if err != nil {
+		return nil, err
+	}
+
 	query += fmt.Sprintf(" ORDER BY ts DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
 	args = append(args, params.Limit, offset)
 
@@ -223,7 +702,9 @@ func (r *PostgresReadingRepository) GetReadingsByDevice(ctx context.Context, piI
 	}
 
 	result := &interfaces.ReadingQueryResult{
-		Items: readings,
+		Items:  readings,
+		Total:  total,
+		Sample: params.Sample,
 	}
 
 	// Check if there are more pages
@@ -235,6 +716,137 @@ func (r *PostgresReadingRepository) GetReadingsByDevice(ctx context.Context, piI
 	return result, nil
 }
 
+// sampledReadingsQuery keeps every nth row of query, numbering the rows newest
+// first as the pages are ordered; n is bound at argIndex. The numbering covers
+// the whole filtered range, so pages of a sampled query stay consistent with
+// each other while no readings arrive in between.
+func sampledReadingsQuery(query string, argIndex int) string {
+	return fmt.Sprintf(`SELECT pi_id, device_id, ts, payload, received_at FROM (
+		SELECT pi_id, device_id, ts, payload, received_at, row_number() OVER (ORDER BY ts DESC, device_id) AS sample_rn
+		FROM (%s) filtered
+	) numbered WHERE (sample_rn - 1) %% $%d = 0`, query, argIndex)
+}
+
+// countReadings returns how many rows query matches when params.IncludeTotal
+// asks for it, and nil otherwise. query is the filtered SELECT of a reading
+// query, without its ORDER BY and LIMIT.
+func (r *PostgresReadingRepository) countReadings(ctx context.Context, params interfaces.ReadingQueryParams, query string, args []interface{}) (*int, error) {
+	if !params.IncludeTotal {
+		return nil, nil
+	}
+	count, err := countRows(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
+// getReadingsSince runs the incremental-sync path: ts strictly after Since (or
+// after the cursor position), ordered ascending by the (ts, device_id) key
+func (r *PostgresReadingRepository) getReadingsSince(ctx context.Context, query string, args []interface{}, argIndex int, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	if params.After != nil {
+		query += fmt.Sprintf(" AND (ts, device_id) > ($%d, $%d)", argIndex, argIndex+1)
+		args = append(args, params.After.Ts, params.After.DeviceID)
+		argIndex += 2
+	} else {
+		query += fmt.Sprintf(" AND ts > $%d", argIndex)
+		args = append(args, *params.Since)
+		argIndex++
+	}
+
+	total, err := r.countReadings(ctx, params, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	query += fmt.Sprintf(" ORDER BY ts ASC, device_id ASC LIMIT $%d", argIndex)
+	args = append(args, params.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings, err := r.scanReadings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &interfaces.ReadingQueryResult{
+		Items: readings,
+		Total: total,
+	}
+
+	// Always hand back the position of the last reading so consumers can resume
+	// from it later, even once they've caught up
+	if len(readings) > 0 {
+		last := readings[len(readings)-1]
+		nextPageToken := interfaces.ReadingCursor{Ts: last.Ts, DeviceID: last.DeviceID}.Encode()
+		result.NextPageToken = &nextPageToken
+	} else if params.After != nil {
+		nextPageToken := params.After.Encode()
+		result.NextPageToken = &nextPageToken
+	}
+
+	return result, nil
+}
+
+// getReadingsReceivedSince runs the arrival-order sync path: received_at
+// strictly after ReceivedSince (or after the cursor position), ordered by the
+// (received_at, device_id, ts) key. It picks up late readings whose ts is older
+// than a Since consumer's watermark.
+func (r *PostgresReadingRepository) getReadingsReceivedSince(ctx context.Context, query string, args []interface{}, argIndex int, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	if params.After != nil {
+		if params.After.ReceivedAt == nil {
+			return nil, fmt.Errorf("cursor is not from a received_since query")
+		}
+		query += fmt.Sprintf(" AND (received_at, device_id, ts) > ($%d, $%d, $%d)", argIndex, argIndex+1, argIndex+2)
+		args = append(args, *params.After.ReceivedAt, params.After.DeviceID, params.After.Ts)
+		argIndex += 3
+	} else {
+		query += fmt.Sprintf(" AND received_at > $%d", argIndex)
+		args = append(args, *params.ReceivedSince)
+		argIndex++
+	}
+
+	total, err := r.countReadings(ctx, params, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	query += fmt.Sprintf(" ORDER BY received_at ASC, device_id ASC, ts ASC LIMIT $%d", argIndex)
+	args = append(args, params.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings, err := r.scanReadings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &interfaces.ReadingQueryResult{
+		Items: readings,
+		Total: total,
+	}
+
+	// As with since, the position of the last reading is always handed back
+	if len(readings) > 0 {
+		last := readings[len(readings)-1]
+		nextPageToken := interfaces.ReadingCursor{Ts: last.Ts, DeviceID: last.DeviceID, ReceivedAt: last.ReceivedAt}.Encode()
+		result.NextPageToken = &nextPageToken
+	} else if params.After != nil {
+		nextPageToken := params.After.Encode()
+		result.NextPageToken = &nextPageToken
+	}
+
+	return result, nil
+}
+
 func (r *PostgresReadingRepository) GetSummaryStats(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.SummaryStats, error) {
 	query := `SELECT COUNT(*) FROM readings WHERE 1=1`
 	args := []interface{}{}
@@ -246,13 +858,9 @@ func (r *PostgresReadingRepository) GetSummaryStats(ctx context.Context, params
 		argIndex++
 	}
 
-	if params.DeviceID != "" {
-		deviceIDInt, err := strconv.Atoi(params.DeviceID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid device_id: %w", err)
-		}
+	if params.DeviceID != nil {
 		query += fmt.Sprintf(" AND device_id = $%d", argIndex)
-		args = append(args, deviceIDInt)
+		args = append(args, *params.DeviceID)
 		argIndex++
 	}
 
@@ -263,7 +871,7 @@ func (r *PostgresReadingRepository) GetSummaryStats(ctx context.Context, params
 	}
 
 	if params.To != nil {
-		query += fmt.Sprintf(" AND ts <= $%d", argIndex)
+		query += fmt.Sprintf(" AND ts %s $%d", toOperator(params), argIndex)
 		args = append(args, *params.To)
 		argIndex++
 	}
@@ -304,7 +912,7 @@ func (r *PostgresReadingRepository) GetSummaryStats(ctx context.Context, params
 		}
 
 		if params.To != nil {
-			deviceStatsQuery += " AND ts <= $" + strconv.Itoa(len(deviceArgs)+1)
+			deviceStatsQuery += " AND ts " + toOperator(params) + " $" + strconv.Itoa(len(deviceArgs)+1)
 			deviceArgs = append(deviceArgs, *params.To)
 		}
 
@@ -330,3 +938,52 @@ func (r *PostgresReadingRepository) GetSummaryStats(ctx context.Context, params
 
 	return stats, nil
 }
+
+// GetPayloadKeys counts the top-level payload keys of readings in a time window.
+// The window is applied in the inner query so only readings in range are expanded.
+func (r *PostgresReadingRepository) GetPayloadKeys(ctx context.Context, query interfaces.PayloadKeyQuery) ([]interfaces.PayloadKeyStats, error) {
+	var inner string
+	var args []interface{}
+	if query.DeviceType != "" {
+		inner = `
+			SELECT r.payload
+			FROM readings r
+			JOIN devices d ON d.pi_id = r.pi_id AND d.device_id = r.device_id
+			WHERE d.device_type = $1 AND r.ts >= $2 AND r.ts < $3`
+		args = []interface{}{query.DeviceType, query.From, query.To}
+	} else {
+		inner = `
+			SELECT payload
+			FROM readings
+			WHERE pi_id = $1 AND device_id = $2 AND ts >= $3 AND ts < $4`
+		args = []interface{}{query.PiID, query.DeviceID, query.From, query.To}
+	}
+
+	sqlQuery := `
+		SELECT k.key, COUNT(*) AS occurrences, MIN(jsonb_typeof(w.payload -> k.key)) AS sample_type
+		FROM (` + inner + `
+		) w
+		CROSS JOIN LATERAL jsonb_object_keys(
+			CASE WHEN jsonb_typeof(w.payload) = 'object' THEN w.payload ELSE '{}'::jsonb END
+		) AS k(key)
+		GROUP BY k.key
+		ORDER BY occurrences DESC, k.key
+	`
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []interfaces.PayloadKeyStats{}
+	for rows.Next() {
+		var stat interfaces.PayloadKeyStats
+		if err := rows.Scan(&stat.Key, &stat.Occurrences, &stat.SampleType); err != nil {
+			return nil, err
+		}
+		keys = append(keys, stat)
+	}
+
+	return keys, rows.Err()
+}
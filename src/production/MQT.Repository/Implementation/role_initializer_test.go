@@ -0,0 +1,93 @@
+//go:build integration
+
+package implementation_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	auth "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/auth"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/password"
+	"gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.ApiService/implementation/rbac"
+	config "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Config"
+	logger "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Logger"
+	implementation "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Implementation"
+)
+
+// Replicas starting together on an empty database must seed each role and the
+// admin user exactly once, and all of them must start
+func TestRoleInitializerConcurrent(t *testing.T) {
+	const replicas = 2
+
+	db := openTestDB(t)
+	ctx := context.Background()
+	nop := zerolog.Nop()
+	hasher := password.NewHasher(config.PasswordHashConfig{Algorithm: password.AlgorithmBcrypt, BcryptCost: 4})
+	adminConfig := auth.AdminConfig{Username: "admin", Email: "admin@example.com", Password: "adminpassword123"}
+
+	for round := 0; round < 20; round++ {
+		if _, err := db.ExecContext(ctx, `TRUNCATE users, roles CASCADE`); err != nil {
+			t.Fatalf("failed to truncate users and roles: %v", err)
+		}
+
+		start := make(chan struct{})
+		errs := make([]error, replicas)
+		var wg sync.WaitGroup
+		for n := 0; n < replicas; n++ {
+			initializer := auth.NewRoleInitializerService(
+				implementation.NewPostgresRoleRepository(db),
+				implementation.NewPostgresUserRepository(db),
+				rbac.NewService(),
+				hasher,
+				&logger.Logger{Logger: &nop},
+				adminConfig,
+			)
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				<-start
+				if err := initializer.InitializeRoles(ctx); err != nil {
+					errs[n] = err
+					return
+				}
+				errs[n] = initializer.InitializeAdminUser(ctx)
+			}(n)
+		}
+		close(start)
+		wg.Wait()
+
+		for n, err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: replica %d failed: %v", round, n, err)
+			}
+		}
+
+		rows, err := db.QueryContext(ctx, `SELECT name, COUNT(*) FROM roles GROUP BY name`)
+		if err != nil {
+			t.Fatalf("failed to count roles: %v", err)
+		}
+		roles := make(map[string]int)
+		for rows.Next() {
+			var name string
+			var count int
+			if err := rows.Scan(&name, &count); err != nil {
+				t.Fatalf("failed to scan role count: %v", err)
+			}
+			roles[name] = count
+		}
+		rows.Close()
+		if len(roles) != 2 || roles["admin"] != 1 || roles["user"] != 1 {
+			t.Fatalf("round %d: roles %v, want one admin and one user", round, roles)
+		}
+
+		var admins int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin'`).Scan(&admins); err != nil {
+			t.Fatalf("failed to count admins: %v", err)
+		}
+		if admins != 1 {
+			t.Fatalf("round %d: %d admin users, want 1", round, admins)
+		}
+	}
+}
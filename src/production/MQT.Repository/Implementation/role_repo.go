@@ -43,6 +43,33 @@ func (r *PostgresRoleRepository) Create(ctx context.Context, role *auth_models.R
 	return role, nil
 }
 
+// CreateIfNotExists inserts a role keyed by its name, leaving an existing role untouched
+func (r *PostgresRoleRepository) CreateIfNotExists(ctx context.Context, role *auth_models.Role) (bool, error) {
+	if role.RoleID == "" {
+		role.RoleID = uuid.New().String()
+	}
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO roles (role_id, name, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query, role.RoleID, role.Name,
+		role.Description, role.CreatedAt, role.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
 // FindByID finds a role by ID
 func (r *PostgresRoleRepository) FindByID(ctx context.Context, id string) (*auth_models.Role, error) {
 	query := `SELECT role_id, name, description, created_at, updated_at FROM roles WHERE role_id = $1`
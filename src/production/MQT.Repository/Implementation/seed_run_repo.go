@@ -0,0 +1,79 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PostgresSeedRunRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSeedRunRepository(db *sql.DB) *PostgresSeedRunRepository {
+	return &PostgresSeedRunRepository{db: db}
+}
+
+func (r *PostgresSeedRunRepository) Claim(ctx context.Context, name, requestedBy string) (bool, *interfaces.SeedRun, error) {
+	query := `
+		INSERT INTO seed_runs (name, status, requested_by)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (name) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query, name, interfaces.SeedStatusRunning, requestedBy)
+	if err != nil {
+		return false, nil, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, nil, err
+	}
+	if inserted == 1 {
+		return true, nil, nil
+	}
+
+	existing := &interfaces.SeedRun{}
+	var summary []byte
+	err = r.db.QueryRowContext(ctx, `
+		SELECT name, status, summary, COALESCE(requested_by, ''), created_at, finished_at
+		FROM seed_runs WHERE name = $1
+	`, name).Scan(&existing.Name, &existing.Status, &summary, &existing.RequestedBy, &existing.CreatedAt, &existing.FinishedAt)
+	if err != nil {
+		return false, nil, err
+	}
+	existing.Summary = summary
+	return false, existing, nil
+}
+
+func (r *PostgresSeedRunRepository) Complete(ctx context.Context, name string, summary json.RawMessage) error {
+	query := `
+		UPDATE seed_runs
+		SET status = $2, summary = $3, finished_at = now()
+		WHERE name = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, name, interfaces.SeedStatusCompleted, []byte(summary))
+	return err
+}
+
+func (r *PostgresSeedRunRepository) Release(ctx context.Context, name string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM seed_runs WHERE name = $1 AND status = $2`, name, interfaces.SeedStatusRunning)
+	return err
+}
+
+func (r *PostgresSeedRunRepository) CountRows(ctx context.Context, limit int64) (int64, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM (SELECT 1 FROM users LIMIT $1) AS u) +
+			(SELECT COUNT(*) FROM (SELECT 1 FROM pis LIMIT $1) AS p) +
+			(SELECT COUNT(*) FROM (SELECT 1 FROM devices LIMIT $1) AS d) +
+			(SELECT COUNT(*) FROM (SELECT 1 FROM readings LIMIT $1) AS r)
+	`
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, limit).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,179 @@
+package implementation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PostgresStorageUsageRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresStorageUsageRepository(db *sql.DB) *PostgresStorageUsageRepository {
+	return &PostgresStorageUsageRepository{db: db}
+}
+
+func (r *PostgresStorageUsageRepository) MeasureReadings(ctx context.Context, statementTimeout time.Duration) (*interfaces.ReadingsMeasurement, error) {
+	txn, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	// SET LOCAL doesn't take parameters; the value is a formatted integer
+	if _, err := txn.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", statementTimeout.Milliseconds())); err != nil {
+		return nil, err
+	}
+
+	measurement := &interfaces.ReadingsMeasurement{RowsByPi: make(map[string]int64)}
+	if err := txn.QueryRowContext(ctx, `SELECT pg_total_relation_size('readings')`).Scan(&measurement.TotalBytes); err != nil {
+		return nil, err
+	}
+
+	rows, err := txn.QueryContext(ctx, `SELECT pi_id, COUNT(*) FROM readings GROUP BY pi_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var piID string
+		var count int64
+		if err := rows.Scan(&piID, &count); err != nil {
+			return nil, err
+		}
+		measurement.RowsByPi[piID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return measurement, txn.Commit()
+}
+
+func (r *PostgresStorageUsageRepository) SaveUsage(ctx context.Context, usage []interfaces.PiStorageUsage, total interfaces.StorageTotal) ([]interfaces.PiStorageUsage, *interfaces.StorageTotal, error) {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('storage_usage'))`); err != nil {
+		return nil, nil, err
+	}
+
+	previous, err := r.listUsage(ctx, txn, `
+		SELECT s.pi_id, COALESCE(p.user_id, ''), s.row_count, s.approx_bytes, s.computed_at
+		FROM storage_usage s
+		LEFT JOIN pis p ON p.pi_id = s.pi_id
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var previousTotal *interfaces.StorageTotal
+	var prev interfaces.StorageTotal
+	err = txn.QueryRowContext(ctx, `SELECT row_count, total_bytes, computed_at FROM storage_usage_total WHERE singleton`).Scan(&prev.RowCount, &prev.TotalBytes, &prev.ComputedAt)
+	switch {
+	case err == nil:
+		previousTotal = &prev
+	case err != sql.ErrNoRows:
+		return nil, nil, err
+	}
+
+	if _, err := txn.ExecContext(ctx, `DELETE FROM storage_usage`); err != nil {
+		return nil, nil, err
+	}
+
+	insert := `
+		INSERT INTO storage_usage (pi_id, row_count, approx_bytes, computed_at)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM pis WHERE pi_id = $1)
+	`
+	for _, u := range usage {
+		if _, err := txn.ExecContext(ctx, insert, u.PiID, u.RowCount, u.ApproxBytes, u.ComputedAt); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	upsertTotal := `
+		INSERT INTO storage_usage_total (singleton, row_count, total_bytes, computed_at)
+		VALUES (true, $1, $2, $3)
+		ON CONFLICT (singleton)
+		DO UPDATE SET row_count = EXCLUDED.row_count,
+		              total_bytes = EXCLUDED.total_bytes,
+		              computed_at = EXCLUDED.computed_at
+	`
+	if _, err := txn.ExecContext(ctx, upsertTotal, total.RowCount, total.TotalBytes, total.ComputedAt); err != nil {
+		return nil, nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return previous, previousTotal, nil
+}
+
+func (r *PostgresStorageUsageRepository) GetPiUsage(ctx context.Context, piID string) (*interfaces.PiStorageUsage, error) {
+	query := `
+		SELECT s.pi_id, COALESCE(p.user_id, ''), s.row_count, s.approx_bytes, s.computed_at
+		FROM storage_usage s
+		JOIN pis p ON p.pi_id = s.pi_id
+		WHERE s.pi_id = $1
+	`
+
+	var u interfaces.PiStorageUsage
+	if err := r.db.QueryRowContext(ctx, query, piID).Scan(&u.PiID, &u.UserID, &u.RowCount, &u.ApproxBytes, &u.ComputedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *PostgresStorageUsageRepository) ListTopUsage(ctx context.Context, limit int) ([]interfaces.PiStorageUsage, error) {
+	return r.listUsage(ctx, r.db, `
+		SELECT s.pi_id, COALESCE(p.user_id, ''), s.row_count, s.approx_bytes, s.computed_at
+		FROM storage_usage s
+		JOIN pis p ON p.pi_id = s.pi_id
+		ORDER BY s.approx_bytes DESC, s.pi_id
+		LIMIT $1
+	`, limit)
+}
+
+func (r *PostgresStorageUsageRepository) GetTotal(ctx context.Context) (*interfaces.StorageTotal, error) {
+	var total interfaces.StorageTotal
+	err := r.db.QueryRowContext(ctx, `SELECT row_count, total_bytes, computed_at FROM storage_usage_total WHERE singleton`).Scan(&total.RowCount, &total.TotalBytes, &total.ComputedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &total, nil
+}
+
+// usageQuerier is satisfied by both *sql.DB and *sql.Tx
+type usageQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (r *PostgresStorageUsageRepository) listUsage(ctx context.Context, q usageQuerier, query string, args ...interface{}) ([]interfaces.PiStorageUsage, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []interfaces.PiStorageUsage
+	for rows.Next() {
+		var u interfaces.PiStorageUsage
+		if err := rows.Scan(&u.PiID, &u.UserID, &u.RowCount, &u.ApproxBytes, &u.ComputedAt); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -3,14 +3,19 @@ package implementation
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
 	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
 )
 
+// uniqueViolation is the Postgres SQLSTATE for a unique constraint violation
+const uniqueViolation = "23505"
+
 type PostgresUserRepository struct {
 	db *sql.DB
 }
@@ -39,6 +44,10 @@ func (r *PostgresUserRepository) Create(ctx context.Context, user *auth_models.U
 	_, err := r.db.ExecContext(ctx, query, user.UserID, user.Username, user.Email,
 		user.Password, user.Role, user.Active, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, fmt.Errorf("%w: %s", interfaces.ErrUserExists, pqErr.Constraint)
+		}
 		return nil, err
 	}
 
@@ -90,8 +99,12 @@ func (r *PostgresUserRepository) GetByUsername(ctx context.Context, username str
 	return &user, nil
 }
 
-func (r *PostgresUserRepository) GetAll(ctx context.Context) ([]*auth_models.User, error) {
-	query := `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users ORDER BY created_at DESC`
+func (r *PostgresUserRepository) GetAll(ctx context.Context, includeInactive bool) ([]*auth_models.User, error) {
+	query := `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users`
+	if !includeInactive {
+		query += ` WHERE active = true`
+	}
+	query += ` ORDER BY created_at DESC`
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -118,19 +131,33 @@ func (r *PostgresUserRepository) GetAll(ctx context.Context) ([]*auth_models.Use
 	return users, nil
 }
 
-func (r *PostgresUserRepository) List(ctx context.Context, page, pageSize int, role string) (*interfaces.PaginationResult, error) {
-	offset := (page - 1) * pageSize
-	var query string
+func (r *PostgresUserRepository) List(ctx context.Context, opts interfaces.PageOptions, role string, includeInactive bool) (*interfaces.PaginationResult, error) {
+	offset := (opts.Page - 1) * opts.PageSize
+	query := `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users WHERE 1=1`
 	var args []interface{}
+	argIndex := 1
 
 	if role != "" {
-		query = `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users WHERE role = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-		args = []interface{}{role, pageSize, offset}
-	} else {
-		query = `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-		args = []interface{}{pageSize, offset}
+		query += fmt.Sprintf(" AND role = $%d", argIndex)
+		args = append(args, role)
+		argIndex++
+	}
+	if !includeInactive {
+		query += " AND active = true"
 	}
 
+	var total *int
+	if opts.IncludeTotal {
+		count, err := countRows(ctx, r.db, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, opts.PageSize, offset)
+
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -155,11 +182,12 @@ func (r *PostgresUserRepository) List(ctx context.Context, page, pageSize int, r
 
 	result := &interfaces.PaginationResult{
 		Items: users,
+		Total: total,
 	}
 
 	// Check if there are more pages
-	if len(users) == pageSize {
-		nextPage := page + 1
+	if len(users) == opts.PageSize {
+		nextPage := opts.Page + 1
 		result.NextPage = &nextPage
 	}
 
@@ -195,8 +223,12 @@ func (r *PostgresUserRepository) Update(ctx context.Context, user *auth_models.U
 }
 
 // GetByRole retrieves users by role
-func (r *PostgresUserRepository) GetByRole(ctx context.Context, role string) ([]*auth_models.User, error) {
-	query := `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users WHERE role = $1 ORDER BY created_at DESC`
+func (r *PostgresUserRepository) GetByRole(ctx context.Context, role string, includeInactive bool) ([]*auth_models.User, error) {
+	query := `SELECT user_id, username, email, password, role, active, created_at, updated_at FROM users WHERE role = $1`
+	if !includeInactive {
+		query += ` AND active = true`
+	}
+	query += ` ORDER BY created_at DESC`
 
 	rows, err := r.db.QueryContext(ctx, query, role)
 	if err != nil {
@@ -224,8 +256,189 @@ func (r *PostgresUserRepository) GetByRole(ctx context.Context, role string) ([]
 	return users, nil
 }
 
+// UpdateRole changes a user's role, refusing to demote the last active admin
+func (r *PostgresUserRepository) UpdateRole(ctx context.Context, userID string, role string) (string, error) {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer txn.Rollback()
+
+	// Before the user's row, as Delete does, so the two can't deadlock
+	if err := lockAdmins(ctx, txn); err != nil {
+		return "", err
+	}
+
+	var previousRole string
+	err = txn.QueryRowContext(ctx, `SELECT role FROM users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&previousRole)
+	if err != nil {
+		return "", err
+	}
+
+	if previousRole == "admin" && role != "admin" {
+		if err := checkLastAdmin(ctx, txn, userID); err != nil {
+			return "", err
+		}
+	}
+
+	_, err = txn.ExecContext(ctx, `UPDATE users SET role = $1, updated_at = $2 WHERE user_id = $3`, role, time.Now(), userID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return "", err
+	}
+
+	return previousRole, nil
+}
+
+// SetPendingEmail stores an email change awaiting confirmation
+func (r *PostgresUserRepository) SetPendingEmail(ctx context.Context, userID string, change auth_models.PendingEmailChange) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1, pending_email_token_id = $2, pending_email_expires_at = $3
+		WHERE user_id = $4
+	`
+
+	result, err := r.db.ExecContext(ctx, query, change.Email, change.TokenID, change.ExpiresAt, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetPendingEmail returns the user's pending email change, or nil
+func (r *PostgresUserRepository) GetPendingEmail(ctx context.Context, userID string) (*auth_models.PendingEmailChange, error) {
+	query := `
+		SELECT pending_email, pending_email_token_id, pending_email_expires_at
+		FROM users
+		WHERE user_id = $1 AND pending_email IS NOT NULL
+	`
+
+	var change auth_models.PendingEmailChange
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&change.Email, &change.TokenID, &change.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// ConfirmPendingEmail swaps in the pending email in one statement, so a change
+// can only be applied once and never after it was cancelled or replaced
+func (r *PostgresUserRepository) ConfirmPendingEmail(ctx context.Context, userID, tokenID string, now time.Time) (string, error) {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, pending_email_token_id = NULL,
+		    pending_email_expires_at = NULL, updated_at = $3
+		WHERE user_id = $1 AND pending_email_token_id = $2 AND pending_email_expires_at > $3
+		RETURNING email
+	`
+
+	var email string
+	err := r.db.QueryRowContext(ctx, query, userID, tokenID, now).Scan(&email)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return "", fmt.Errorf("%w: %s", interfaces.ErrUserExists, pqErr.Constraint)
+		}
+		return "", err
+	}
+
+	return email, nil
+}
+
+// ClearPendingEmail drops the user's pending email change
+func (r *PostgresUserRepository) ClearPendingEmail(ctx context.Context, userID string) (bool, error) {
+	query := `
+		UPDATE users
+		SET pending_email = NULL, pending_email_token_id = NULL, pending_email_expires_at = NULL
+		WHERE user_id = $1 AND pending_email IS NOT NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// lockAdmins serializes the changes that can remove an active admin until
+// the transaction ends. It is taken before any user row is locked: row locks
+// taken in whatever order each change reaches them would let two concurrent
+// demotions deadlock instead of one of them getting ErrLastAdmin.
+func lockAdmins(ctx context.Context, txn *sql.Tx) error {
+	_, err := txn.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('users:admins'))`)
+	return err
+}
+
+// checkLastAdmin returns ErrLastAdmin if userID is the only active admin.
+// Callers hold lockAdmins, so each change counts the admins the previous one
+// left.
+func checkLastAdmin(ctx context.Context, txn *sql.Tx, userID string) error {
+	rows, err := txn.QueryContext(ctx, `SELECT user_id FROM users WHERE role = 'admin' AND active = true`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var admins int
+	isAdmin := false
+	for rows.Next() {
+		var adminID string
+		if err := rows.Scan(&adminID); err != nil {
+			return err
+		}
+		admins++
+		if adminID == userID {
+			isAdmin = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if isAdmin && admins <= 1 {
+		return interfaces.ErrLastAdmin
+	}
+	return nil
+}
+
 // Delete user
 func (r *PostgresUserRepository) Delete(ctx context.Context, userID string, hardDelete bool) error {
+	txn, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if err := lockAdmins(ctx, txn); err != nil {
+		return err
+	}
+	if err := checkLastAdmin(ctx, txn, userID); err != nil {
+		return err
+	}
+
 	var query string
 	if hardDelete {
 		query = `DELETE FROM users WHERE user_id = $1`
@@ -234,7 +447,7 @@ func (r *PostgresUserRepository) Delete(ctx context.Context, userID string, hard
 		query = `UPDATE users SET active = false, updated_at = now() WHERE user_id = $1`
 	}
 
-	result, err := r.db.ExecContext(ctx, query, userID)
+	result, err := txn.ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
@@ -248,5 +461,5 @@ func (r *PostgresUserRepository) Delete(ctx context.Context, userID string, hard
 		return sql.ErrNoRows
 	}
 
-	return nil
+	return txn.Commit()
 }
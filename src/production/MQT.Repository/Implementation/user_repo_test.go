@@ -0,0 +1,97 @@
+//go:build integration
+
+package implementation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	implementation "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Implementation"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Two admins removing each other at once must leave exactly one: one change
+// succeeds and the other gets ErrLastAdmin, never a deadlock error
+func TestLastAdminConcurrent(t *testing.T) {
+	demote := func(repo *implementation.PostgresUserRepository, userID string) error {
+		_, err := repo.UpdateRole(context.Background(), userID, "user")
+		return err
+	}
+	deactivate := func(repo *implementation.PostgresUserRepository, userID string) error {
+		return repo.Delete(context.Background(), userID, false)
+	}
+	remove := func(repo *implementation.PostgresUserRepository, userID string) error {
+		return repo.Delete(context.Background(), userID, true)
+	}
+
+	tests := []struct {
+		name   string
+		first  func(*implementation.PostgresUserRepository, string) error
+		second func(*implementation.PostgresUserRepository, string) error
+	}{
+		{"demote both", demote, demote},
+		{"deactivate both", deactivate, deactivate},
+		{"delete both", remove, remove},
+		{"demote and deactivate", demote, deactivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			repo := implementation.NewPostgresUserRepository(db)
+			ctx := context.Background()
+
+			for round := 0; round < 20; round++ {
+				if _, err := db.ExecContext(ctx, `TRUNCATE users CASCADE`); err != nil {
+					t.Fatalf("failed to truncate users: %v", err)
+				}
+				for _, userID := range []string{"admin-1", "admin-2"} {
+					if _, err := db.ExecContext(ctx, `
+						INSERT INTO users (user_id, username, email, password, role)
+						VALUES ($1, $1, $1 || '@example.com', 'x', 'admin')
+					`, userID); err != nil {
+						t.Fatalf("failed to add %s: %v", userID, err)
+					}
+				}
+
+				start := make(chan struct{})
+				errs := make([]error, 2)
+				var wg sync.WaitGroup
+				for n, change := range []func(*implementation.PostgresUserRepository, string) error{tt.first, tt.second} {
+					wg.Add(1)
+					go func(n int, change func(*implementation.PostgresUserRepository, string) error) {
+						defer wg.Done()
+						<-start
+						errs[n] = change(repo, []string{"admin-1", "admin-2"}[n])
+					}(n, change)
+				}
+				close(start)
+				wg.Wait()
+
+				succeeded, refused := 0, 0
+				for _, err := range errs {
+					switch {
+					case err == nil:
+						succeeded++
+					case errors.Is(err, interfaces.ErrLastAdmin):
+						refused++
+					default:
+						t.Fatalf("round %d: unexpected error: %v", round, err)
+					}
+				}
+				if succeeded != 1 || refused != 1 {
+					t.Fatalf("round %d: %d changes succeeded and %d were refused, want one of each", round, succeeded, refused)
+				}
+
+				var admins int
+				if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND active = true`).Scan(&admins); err != nil {
+					t.Fatalf("failed to count admins: %v", err)
+				}
+				if admins != 1 {
+					t.Fatalf("round %d: %d active admins left, want 1", round, admins)
+				}
+			}
+		})
+	}
+}
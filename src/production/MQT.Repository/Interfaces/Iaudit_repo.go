@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"context"
+
+	audit_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/audit"
+)
+
+type AuditRepository interface {
+	// Create audit event
+	Create(ctx context.Context, event *audit_models.AuditEvent) error
+}
@@ -2,21 +2,65 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 )
 
+// DeviceLiveness is the newest reading time written for one device in a batch
+type DeviceLiveness struct {
+	PiID     string
+	DeviceID int
+	LastTs   time.Time
+}
+
+// LivenessResult counts the rows TouchLiveness updated
+type LivenessResult struct {
+	Devices int64
+	Pis     int64
+}
+
+// DeviceKey identifies a device by its Pi and its ID on that Pi
+type DeviceKey struct {
+	PiID     string
+	DeviceID int
+}
+
 type DeviceRepository interface {
 	// Create device (idempotent upsert)
 	CreateOrUpdateDevice(ctx context.Context, device hardware_models.Device) error
 
+	// CreateDeviceIfAbsent creates device unless its Pi already has a device with
+	// that ID, which is left untouched, and reports whether it was created
+	CreateDeviceIfAbsent(ctx context.Context, device hardware_models.Device) (bool, error)
+
 	// Read devices
 	GetDevice(ctx context.Context, piID string, deviceID int) (*hardware_models.Device, error)
-	ListDevicesByPi(ctx context.Context, piID string, page, pageSize int) (*PaginationResult, error)
+	// ExistingDevices returns which of keys exist, in one query
+	ExistingDevices(ctx context.Context, keys []DeviceKey) (map[DeviceKey]bool, error)
+	// ListAllDeviceKeys returns every device of piIDs, ordered by Pi and device
+	ListAllDeviceKeys(ctx context.Context, piIDs []string) ([]DeviceKey, error)
+	ListDevicesByPi(ctx context.Context, piID string, opts PageOptions) (*PaginationResult, error)
+	ListDevicesWithLatest(ctx context.Context, piID string, opts PageOptions) (*PaginationResult, error)
+	// FindDevicesByMeta returns devices whose meta contains every key/value in
+	// match, limited to devices on userID's pis unless userID is empty
+	FindDevicesByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Device, error)
 
 	// Update device
 	UpdateDevice(ctx context.Context, device hardware_models.Device) error
 
+	// TouchLiveness advances devices.last_reading_at and their pis' last_seen_at
+	// to the given times in one statement. Times never move backwards, and
+	// entries for unknown devices are ignored. Each device may appear once.
+	TouchLiveness(ctx context.Context, entries []DeviceLiveness) (LivenessResult, error)
+
 	// Delete device
 	DeleteDevice(ctx context.Context, piID string, deviceID int, cascade bool) error
+
+	// Units declared per payload field, merged from the device type and the device
+	GetDeclaredUnits(ctx context.Context, piID string) (map[int]map[string]string, error)
+
+	// Device type settings
+	GetDeviceType(ctx context.Context, deviceType string) (*hardware_models.DeviceType, error)
+	UpsertDeviceType(ctx context.Context, deviceType *hardware_models.DeviceType) error
 }
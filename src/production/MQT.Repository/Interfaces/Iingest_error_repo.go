@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	ingest_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/ingest"
+)
+
+// IngestErrorQuery selects a page of a Pi's ingest errors. From and To bound
+// ts, From inclusive and To exclusive; nil leaves that end open.
+type IngestErrorQuery struct {
+	PiID     string
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
+
+type IngestErrorRepository interface {
+	// CreateMany stores reports with one insert
+	CreateMany(ctx context.Context, reports []ingest_models.IngestErrorReport) error
+
+	// ListByPi returns a page of the Pi's errors, newest first
+	ListByPi(ctx context.Context, query IngestErrorQuery) (*PaginationResult, error)
+}
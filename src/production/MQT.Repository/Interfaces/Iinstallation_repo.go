@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"context"
+)
+
+// ResourceCounts are the exact row counts behind the telemetry report; the
+// report itself only carries them bucketed
+type ResourceCounts struct {
+	Users   int64
+	Pis     int64
+	Devices int64
+}
+
+type InstallationRepository interface {
+	// GetInstallID returns the random ID of this installation, generating it on
+	// first use. Safe to race across replicas.
+	GetInstallID(ctx context.Context) (string, error)
+
+	// CountResources counts users, pis and devices
+	CountResources(ctx context.Context) (*ResourceCounts, error)
+}
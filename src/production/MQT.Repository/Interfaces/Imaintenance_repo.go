@@ -0,0 +1,25 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// MaintenanceState is the stored maintenance switch. ExpiresAt is nil when
+// maintenance lasts until it is disabled.
+type MaintenanceState struct {
+	Enabled   bool
+	Reason    string
+	EnabledBy string
+	StartedAt *time.Time
+	ExpiresAt *time.Time
+	UpdatedAt time.Time
+}
+
+type MaintenanceRepository interface {
+	// GetState returns the stored switch, or nil if it was never set
+	GetState(ctx context.Context) (*MaintenanceState, error)
+
+	// SaveState replaces the stored switch
+	SaveState(ctx context.Context, state MaintenanceState) error
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type MqttCredentialRepository interface {
+	// Issue stores a new credential for a pi, revoking any active one
+	Issue(ctx context.Context, credential *hardware_models.MqttCredential) error
+
+	// GetLatest returns the pi's most recently issued credential, revoked or not,
+	// or nil if none was ever issued
+	GetLatest(ctx context.Context, piID string) (*hardware_models.MqttCredential, error)
+
+	// Revoke revokes the pi's active credential and reports whether there was one
+	Revoke(ctx context.Context, piID string) (bool, error)
+}
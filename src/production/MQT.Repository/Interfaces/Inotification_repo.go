@@ -0,0 +1,33 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	notification_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/notification"
+)
+
+type NotificationRepository interface {
+	// GetPreferences returns the user's stored preferences, or nil if they never
+	// set any
+	GetPreferences(ctx context.Context, userID string) (*notification_models.Preferences, error)
+
+	// UpsertPreferences stores the user's preferences, setting UpdatedAt
+	UpsertPreferences(ctx context.Context, prefs *notification_models.Preferences) error
+
+	// EnqueueNotification holds a notification back for the digest job
+	EnqueueNotification(ctx context.Context, pending notification_models.PendingNotification) error
+
+	// ListPendingRecipients returns every user and channel with held-back
+	// notifications, with the user's email and digest watermark
+	ListPendingRecipients(ctx context.Context) ([]notification_models.PendingRecipient, error)
+
+	// ListPendingNotifications returns the held-back notifications of a user and
+	// channel created in [from, until), oldest first
+	ListPendingNotifications(ctx context.Context, userID, channel string, from, until time.Time) ([]notification_models.PendingNotification, error)
+
+	// AdvanceWatermark records that notifications created before until were
+	// dispatched and deletes them, in one transaction. The watermark never moves
+	// backwards.
+	AdvanceWatermark(ctx context.Context, userID, channel string, until time.Time) error
+}
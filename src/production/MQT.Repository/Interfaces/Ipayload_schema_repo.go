@@ -0,0 +1,39 @@
+package interfaces
+
+import (
+	"context"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type PayloadSchemaRepository interface {
+	// CreateSchema stores schema as the device type's next version, filling in
+	// Version and CreatedAt. An active schema deactivates the type's previous one.
+	CreateSchema(ctx context.Context, schema *hardware_models.PayloadSchema) error
+
+	// ListSchemas returns every version of a device type's schema, newest first
+	ListSchemas(ctx context.Context, deviceType string) ([]hardware_models.PayloadSchema, error)
+
+	// GetSchema returns one version, or sql.ErrNoRows
+	GetSchema(ctx context.Context, deviceType string, version int) (*hardware_models.PayloadSchema, error)
+
+	// GetActiveSchema returns the device type's active schema, or sql.ErrNoRows
+	GetActiveSchema(ctx context.Context, deviceType string) (*hardware_models.PayloadSchema, error)
+
+	// ListActiveSchemas returns the active schema of every device type
+	ListActiveSchemas(ctx context.Context) ([]hardware_models.PayloadSchema, error)
+
+	// UpdateSchema changes a version's enforcement mode and whether it is active,
+	// leaving nil fields as they are. Activating a version deactivates the type's
+	// other versions. It returns sql.ErrNoRows when the version does not exist.
+	UpdateSchema(ctx context.Context, deviceType string, version int, enforcement *string, active *bool) (*hardware_models.PayloadSchema, error)
+
+	// DeleteSchema removes a version and reports whether it existed
+	DeleteSchema(ctx context.Context, deviceType string, version int) (bool, error)
+
+	// RecordViolation stores a reading that was kept despite failing its schema
+	RecordViolation(ctx context.Context, violation hardware_models.PayloadSchemaViolation) error
+
+	// ListViolations returns a device type's most recent violations, newest first
+	ListViolations(ctx context.Context, deviceType string, limit int) ([]hardware_models.PayloadSchemaViolation, error)
+}
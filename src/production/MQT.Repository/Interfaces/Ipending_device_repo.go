@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+)
+
+type PendingDeviceRepository interface {
+	// Record stores a discovered device, or refreshes its type, firmware and
+	// last_seen_at when the Pi announces it again
+	Record(ctx context.Context, device hardware_models.PendingDevice) error
+
+	// ListByPi returns the pi's pending devices, oldest first
+	ListByPi(ctx context.Context, piID string) ([]hardware_models.PendingDevice, error)
+
+	// Approve creates the device from its pending entry and removes the entry in
+	// one transaction. It returns sql.ErrNoRows when there is no pending entry.
+	Approve(ctx context.Context, piID string, deviceID int, meta map[string]interface{}) (*hardware_models.Device, error)
+
+	// Reject removes the pending entry and reports whether there was one
+	Reject(ctx context.Context, piID string, deviceID int) (bool, error)
+}
@@ -0,0 +1,57 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// Purge job statuses
+const (
+	PurgeStatusRunning   = "running"
+	PurgeStatusCompleted = "completed"
+	PurgeStatusCancelled = "cancelled"
+	PurgeStatusFailed    = "failed"
+)
+
+// PurgeJob is an asynchronous deletion of one device's readings in the
+// half-open range [From, To)
+type PurgeJob struct {
+	PurgeID         int64      `json:"purge_id"`
+	PiID            string     `json:"pi_id"`
+	DeviceID        int        `json:"device_id"`
+	From            time.Time  `json:"from"`
+	To              time.Time  `json:"to"`
+	Status          string     `json:"status"`
+	EstimatedRows   int64      `json:"estimated_rows"` // counted when the job started
+	DeletedRows     int64      `json:"deleted_rows"`
+	Chunks          int        `json:"chunks"`
+	CancelRequested bool       `json:"cancel_requested"`
+	Error           string     `json:"error,omitempty"`
+	RequestedBy     string     `json:"requested_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+type PurgeJobRepository interface {
+	// Create stores a running job and fills in its ID and timestamps
+	Create(ctx context.Context, job *PurgeJob) error
+
+	// Get returns a job, or sql.ErrNoRows if it doesn't exist
+	Get(ctx context.Context, purgeID int64) (*PurgeJob, error)
+
+	// List returns the most recent jobs, newest first
+	List(ctx context.Context, limit int) ([]PurgeJob, error)
+
+	// RecordChunk adds one deleted chunk to a job's progress and reports whether
+	// cancellation has been requested
+	RecordChunk(ctx context.Context, purgeID int64, deleted int64) (cancelRequested bool, err error)
+
+	// RequestCancel asks a running job to stop after its current chunk. It
+	// returns the job, or sql.ErrNoRows if it doesn't exist; jobs that already
+	// finished are returned unchanged.
+	RequestCancel(ctx context.Context, purgeID int64) (*PurgeJob, error)
+
+	// Finish records a job's final status and error message, if any
+	Finish(ctx context.Context, purgeID int64, status, errMsg string) error
+}
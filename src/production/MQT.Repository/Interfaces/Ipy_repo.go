@@ -2,17 +2,45 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 )
 
+// PiUpsertResult reports the outcome of upserting a single pi in a batch
+type PiUpsertResult struct {
+	PiID    string
+	Created bool
+}
+
+// RegistryPage selects a page of ListAllPiIDs
+type RegistryPage struct {
+	After string // return Pis after this pi_id; "" starts at the beginning
+	// UpdatedSince keeps only Pis created at or after it, or with a device
+	// that was; nil keeps all. Pis and devices have no update time, so a Pi
+	// whose owner changed is not picked up.
+	UpdatedSince *time.Time
+	OwnedOnly    bool // leave out Pis without an owner
+	Limit        int
+}
+
 type PiRepository interface {
 	// Create pi (idempotent upsert)
 	CreateOrUpdatePi(ctx context.Context, pi hardware_models.Pi) error
+	CreateOrUpdatePis(ctx context.Context, pis []hardware_models.Pi) ([]PiUpsertResult, error)
 
-	// Read pis
+	// Read pis. GetPi returns sql.ErrNoRows when the Pi does not exist.
 	GetPi(ctx context.Context, piID string) (*hardware_models.Pi, error)
-	ListPis(ctx context.Context, userID string, page, pageSize int) (*PaginationResult, error)
+	// GetPiOwners returns the owner of each Pi of piIDs that exists, keyed by
+	// Pi ID, in one query; a Pi without an owner maps to ""
+	GetPiOwners(ctx context.Context, piIDs []string) (map[string]string, error)
+	// ListAllPiIDs returns a page of Pi IDs in pi_id order
+	ListAllPiIDs(ctx context.Context, page RegistryPage) ([]string, error)
+	ListPis(ctx context.Context, userID string, opts PageOptions) (*PaginationResult, error)
+	CountPisByUser(ctx context.Context, userID string) (int, error)
+	// FindPisByMeta returns pis whose meta contains every key/value in match,
+	// limited to userID's pis unless userID is empty
+	FindPisByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Pi, error)
 
 	// Update pi
 	UpdatePi(ctx context.Context, pi hardware_models.Pi) error
@@ -2,26 +2,131 @@ package interfaces
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
 )
 
+// ErrDuplicateReading is returned by CreateReading when the device already has
+// a reading at that ts, as when a gateway replays buffered data
+var ErrDuplicateReading = errors.New("reading already exists")
+
+// ErrReadingDeviceNotFound is returned by CreateReading when the reading's
+// device doesn't exist for its Pi, as when it was deleted after validation
+var ErrReadingDeviceNotFound = errors.New("device not found")
+
 // ReadingQueryParams represents parameters for reading queries
 type ReadingQueryParams struct {
 	PiID     string
-	DeviceID string
+	DeviceID *int // nil matches every device
 	From     *time.Time
-	To       *time.Time
+	To       *time.Time // exclusive: the range is [From, To)
 	Limit    int
 	Page     int
+
+	// InclusiveTo makes To inclusive, for clients that relied on the old
+	// [From, To] ranges. Day-by-day pages then count boundary readings twice.
+	InclusiveTo bool
+
+	// Since switches to incremental sync: readings with ts strictly after Since,
+	// oldest first, paged by After instead of Page. Cannot be combined with From/To.
+	// Readings replayed late, with a ts before the consumer's watermark, are not
+	// returned; ReceivedSince finds those.
+	Since *time.Time
+	After *ReadingCursor
+
+	// ReceivedSince is incremental sync by arrival instead: readings received
+	// strictly after ReceivedSince, in the order they arrived, whatever their ts.
+	// Paged by After; cannot be combined with Since or From/To. Readings stored
+	// before received_at was tracked have none and are never returned.
+	ReceivedSince *time.Time
+
+	// Sample keeps roughly every Nth matching reading, for cheap previews; 0 or 1
+	// keeps them all. Cannot be combined with Since.
+	Sample int
+
+	// IncludeTotal also counts the readings the pages walk through: every
+	// (sampled) match, or with Since and ReceivedSince those after the cursor.
+	// It is a second scan of the range, so it is only run when asked for.
+	IncludeTotal bool
+}
+
+// ReadingCursor is the keyset position of the last reading a consumer has seen.
+// (ts, device_id) is unique within a pi, so walking forward from it never skips
+// or repeats readings that share a timestamp. ReceivedAt is set for cursors of
+// ReceivedSince queries, which walk (received_at, device_id, ts) instead.
+type ReadingCursor struct {
+	Ts         time.Time
+	DeviceID   int
+	ReceivedAt *time.Time
+}
+
+// Encode returns the opaque page token for the cursor
+func (c ReadingCursor) Encode() string {
+	raw := c.Ts.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.DeviceID)
+	if c.ReceivedAt != nil {
+		raw += "|" + c.ReceivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeReadingCursor parses a page token produced by ReadingCursor.Encode
+func DecodeReadingCursor(token string) (*ReadingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	tsStr, deviceStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, tsStr)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	deviceStr, receivedStr, hasReceived := strings.Cut(deviceStr, "|")
+	deviceID, err := strconv.Atoi(deviceStr)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	cursor := &ReadingCursor{Ts: ts, DeviceID: deviceID}
+	if hasReceived {
+		receivedAt, err := time.Parse(time.RFC3339Nano, receivedStr)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		cursor.ReceivedAt = &receivedAt
+	}
+	return cursor, nil
 }
 
 // ReadingQueryResult represents the result of a reading query with pagination
 type ReadingQueryResult struct {
 	Items         []hardware_models.Reading `json:"items"`
-	NextPageToken *string             `json:"next_page_token,omitempty"`
-	Total         int                 `json:"total,omitempty"`
+	NextPageToken *string                   `json:"next_page_token,omitempty"`
+	Total         *int                      `json:"total,omitempty"`  // set only when IncludeTotal asked for it
+	Sample        int                       `json:"sample,omitempty"` // sampling factor applied, when one was asked for
+}
+
+// PayloadKeyQuery selects the readings whose top-level payload keys are counted:
+// either one device (PiID and DeviceID) or every device of DeviceType
+type PayloadKeyQuery struct {
+	PiID       string
+	DeviceID   int
+	DeviceType string
+	From       time.Time
+	To         time.Time
+}
+
+// PayloadKeyStats describes a top-level payload key seen in the queried window
+type PayloadKeyStats struct {
+	Key         string `json:"key"`
+	Occurrences int64  `json:"occurrences"`
+	SampleType  string `json:"sample_type"` // JSON type of a sample value: number, string, boolean, object, array or null
 }
 
 // SummaryStats represents aggregate statistics
@@ -32,6 +137,16 @@ type SummaryStats struct {
 	ByDevice []DeviceStats `json:"by_device,omitempty"`
 }
 
+// DeviceReadingSummary is how many readings a device has and the time span
+// they cover. Count is exact up to the exact limit it was asked with; above it
+// Count is the planner's estimate and Approximate is set.
+type DeviceReadingSummary struct {
+	Count       int64      `json:"count"`
+	Approximate bool       `json:"approximate"`
+	FirstTS     *time.Time `json:"first_ts,omitempty"`
+	LastTS      *time.Time `json:"last_ts,omitempty"`
+}
+
 // DeviceStats represents stats for a specific device
 type DeviceStats struct {
 	PiID     string     `json:"pi_id"`
@@ -41,19 +156,71 @@ type DeviceStats struct {
 	LastTS   *time.Time `json:"last_ts,omitempty"`
 }
 
+// Reasons a reading of a batch was not inserted
+const (
+	ReadingFailureDeviceNotFound = "device_not_found" // no such device for the Pi (foreign key)
+	ReadingFailureDuplicate      = "duplicate"        // a reading for the device at that ts already exists
+)
+
+// ReadingInsertFailure is a reading of a batch that was not inserted. Index is
+// its position in the batch.
+type ReadingInsertFailure struct {
+	Index    int
+	PiID     string
+	DeviceID int
+	Ts       time.Time
+	Reason   string
+	Error    string
+}
+
+// ReadingBatchResult reports how a batch insert went. Readings not listed in
+// Failed were inserted.
+type ReadingBatchResult struct {
+	Inserted int
+	Failed   []ReadingInsertFailure
+}
+
 type ReadingRepository interface {
 	// Reading operations
+	// CreateReading returns ErrDuplicateReading if the device already has a
+	// reading at its ts, and ErrReadingDeviceNotFound if the device is unknown
 	CreateReading(ctx context.Context, reading hardware_models.Reading) error
-	CreateReadings(ctx context.Context, readings []hardware_models.Reading) error
+	// CreateReadings inserts readings in one statement. When some of them
+	// violate the device foreign key or the primary key, the others are still
+	// inserted and the offending ones are reported in the result instead.
+	CreateReadings(ctx context.Context, readings []hardware_models.Reading) (*ReadingBatchResult, error)
 
 	// Query operations with pagination
 	GetLatestReadings(ctx context.Context, piID string) ([]hardware_models.Reading, error)
+	GetLatestReading(ctx context.Context, piID string, deviceID int) (*hardware_models.Reading, error)
 	GetReadings(ctx context.Context, params ReadingQueryParams) (*ReadingQueryResult, error)
-	GetReadingsByDevice(ctx context.Context, piID string, deviceID int, params ReadingQueryParams) (*ReadingQueryResult, error)
+	GetReadingsByDevice(ctx context.Context, params ReadingQueryParams) (*ReadingQueryResult, error)
+
+	// IterateReadings calls fn for every reading matching params, oldest first,
+	// fetching them in batches so memory stays flat however many rows match.
+	// Since excludes its own timestamp; Limit caps the total (0 for no cap); Page
+	// and After are ignored. It stops at the first error from fn and returns it,
+	// and returns ctx.Err() if ctx is cancelled between batches.
+	IterateReadings(ctx context.Context, params ReadingQueryParams, fn func(hardware_models.Reading) error) error
 
 	// Statistics
 	GetSummaryStats(ctx context.Context, params ReadingQueryParams) (*SummaryStats, error)
+	GetPayloadKeys(ctx context.Context, query PayloadKeyQuery) ([]PayloadKeyStats, error)
+	// GetDeviceReadingSummary counts a device's readings exactly up to
+	// exactLimit and estimates above it, so it stays cheap for any device.
+	GetDeviceReadingSummary(ctx context.Context, piID string, deviceID int, exactLimit int64) (*DeviceReadingSummary, error)
 
-	// Delete operations
-	DeleteReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time) error
+	// Delete operations. The range is half-open [start, end), like queries.
+	// DeleteReadingsByTimeRange deletes in one statement and returns the count.
+	DeleteReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time) (int64, error)
+	// CountReadingsByTimeRange counts the readings in the range, stopping at
+	// limit so estimating a huge range stays cheap; 0 counts them all.
+	CountReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time, limit int64) (int64, error)
+	// DeleteReadingsInChunks deletes the range oldest first, at most chunkSize
+	// readings per statement, and calls fn with each chunk's count. Every chunk
+	// takes the oldest readings still in the range, so none are skipped or
+	// counted twice at chunk edges. It stops after a short chunk, at the first
+	// error from fn, or with ctx.Err() once ctx is cancelled, and returns the
+	// total deleted.
+	DeleteReadingsInChunks(ctx context.Context, piID string, deviceID int, start, end time.Time, chunkSize int, fn func(deleted int64) error) (int64, error)
 }
@@ -9,6 +9,9 @@ import (
 type RoleRepository interface {
 	// Create role
 	Create(ctx context.Context, role *auth_models.Role) (*auth_models.Role, error)
+	// CreateIfNotExists inserts the role unless one with the same name exists,
+	// reporting whether it was inserted. Safe to race across replicas.
+	CreateIfNotExists(ctx context.Context, role *auth_models.Role) (bool, error)
 
 	// Read roles
 	FindByID(ctx context.Context, id string) (*auth_models.Role, error)
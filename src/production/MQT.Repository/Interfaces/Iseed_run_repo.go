@@ -0,0 +1,40 @@
+package interfaces
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Seed run statuses
+const (
+	SeedStatusRunning   = "running"
+	SeedStatusCompleted = "completed"
+)
+
+// SeedRun is a named demo data seed. Summary is what the seed created, set
+// once it completed.
+type SeedRun struct {
+	Name        string          `json:"name"`
+	Status      string          `json:"status"`
+	Summary     json.RawMessage `json:"summary,omitempty"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+type SeedRunRepository interface {
+	// Claim records a running seed called name. It returns false, with the
+	// existing run, when a seed of that name is already running or completed.
+	Claim(ctx context.Context, name, requestedBy string) (claimed bool, existing *SeedRun, err error)
+
+	// Complete marks a claimed seed completed with its summary
+	Complete(ctx context.Context, name string, summary json.RawMessage) error
+
+	// Release forgets a claimed seed that failed, so it can be run again
+	Release(ctx context.Context, name string) error
+
+	// CountRows counts users, pis, devices and readings together, stopping at
+	// limit so checking a large database stays cheap
+	CountRows(ctx context.Context, limit int64) (int64, error)
+}
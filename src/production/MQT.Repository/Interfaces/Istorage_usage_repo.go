@@ -0,0 +1,53 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// PiStorageUsage is a Pi's share of the readings table as of the last
+// accounting run. ApproxBytes apportions the table's total size by row share.
+type PiStorageUsage struct {
+	PiID        string    `json:"pi_id"`
+	UserID      string    `json:"user_id,omitempty"` // owner, when the Pi is assigned
+	RowCount    int64     `json:"row_count"`
+	ApproxBytes int64     `json:"approx_bytes"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
+// StorageTotal is the size of the readings table, including its indexes and
+// TOAST data, as of the last accounting run
+type StorageTotal struct {
+	RowCount   int64     `json:"row_count"`
+	TotalBytes int64     `json:"total_bytes"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// ReadingsMeasurement is what an accounting run reads from the database: the
+// table size and each Pi's row count
+type ReadingsMeasurement struct {
+	TotalBytes int64
+	RowsByPi   map[string]int64
+}
+
+type StorageUsageRepository interface {
+	// MeasureReadings counts readings per Pi and sizes the readings table. Every
+	// statement is cancelled once it runs longer than statementTimeout.
+	MeasureReadings(ctx context.Context, statementTimeout time.Duration) (*ReadingsMeasurement, error)
+
+	// SaveUsage replaces the stored usage with a new run and returns the run it
+	// replaced (previousTotal is nil on the first run). Concurrent saves are
+	// serialized, so each run is compared with the one just before it. Pis
+	// that no longer exist are skipped.
+	SaveUsage(ctx context.Context, usage []PiStorageUsage, total StorageTotal) (previous []PiStorageUsage, previousTotal *StorageTotal, err error)
+
+	// GetPiUsage returns a Pi's usage, or sql.ErrNoRows if it hasn't been
+	// accounted for yet
+	GetPiUsage(ctx context.Context, piID string) (*PiStorageUsage, error)
+
+	// ListTopUsage returns the Pis using the most storage, largest first
+	ListTopUsage(ctx context.Context, limit int) ([]PiStorageUsage, error)
+
+	// GetTotal returns the readings table total, or nil before the first run
+	GetTotal(ctx context.Context) (*StorageTotal, error)
+}
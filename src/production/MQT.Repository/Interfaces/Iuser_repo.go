@@ -2,15 +2,31 @@ package interfaces
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	auth_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/auth"
 )
 
+// ErrUserExists is returned by Create when the username or email is already taken
+var ErrUserExists = errors.New("username or email already exists")
+
+// ErrLastAdmin is returned when a change would leave no active admin
+var ErrLastAdmin = errors.New("cannot remove the last active admin")
+
 // PaginationResult represents a paginated result
 type PaginationResult struct {
 	Items    interface{} `json:"items"`
 	NextPage *int        `json:"next_page,omitempty"`
-	Total    int         `json:"total,omitempty"`
+	Total    *int        `json:"total,omitempty"` // set only when PageOptions.IncludeTotal asked for it
+}
+
+// PageOptions selects a page of a listing. IncludeTotal also counts every row
+// the listing matches, which is a second query, so it is only run when asked for.
+type PageOptions struct {
+	Page         int
+	PageSize     int
+	IncludeTotal bool
 }
 
 type UserRepository interface {
@@ -20,15 +36,32 @@ type UserRepository interface {
 	// Read users
 	GetByID(ctx context.Context, userID string) (*auth_models.User, error)
 	FindByID(ctx context.Context, userID string) (*auth_models.User, error)
+	// GetByUsername returns inactive users too; callers decide how to treat them
 	GetByUsername(ctx context.Context, username string) (*auth_models.User, error)
-	GetAll(ctx context.Context) ([]*auth_models.User, error)
-	List(ctx context.Context, page, pageSize int, role string) (*PaginationResult, error)
+	GetAll(ctx context.Context, includeInactive bool) ([]*auth_models.User, error)
+	List(ctx context.Context, opts PageOptions, role string, includeInactive bool) (*PaginationResult, error)
 	GetUser(ctx context.Context, userID string) (*auth_models.User, error)
-	GetByRole(ctx context.Context, role string) ([]*auth_models.User, error)
+	GetByRole(ctx context.Context, role string, includeInactive bool) ([]*auth_models.User, error)
 
 	// Update user
 	Update(ctx context.Context, user *auth_models.User) error
+	// UpdateRole changes a user's role and returns the previous one. It returns
+	// sql.ErrNoRows if the user does not exist and ErrLastAdmin if the user is the
+	// only active admin and the new role is not admin.
+	UpdateRole(ctx context.Context, userID string, role string) (string, error)
+
+	// Email changes wait for confirmation from the new address. SetPendingEmail
+	// replaces any earlier pending change. GetPendingEmail returns nil when there
+	// is none, expired or not.
+	SetPendingEmail(ctx context.Context, userID string, change auth_models.PendingEmailChange) error
+	GetPendingEmail(ctx context.Context, userID string) (*auth_models.PendingEmailChange, error)
+	// ConfirmPendingEmail applies the pending change made with tokenID if it hasn't
+	// expired at now, and returns the new email. It returns sql.ErrNoRows when no
+	// such change is pending and ErrUserExists when the address has been taken since.
+	ConfirmPendingEmail(ctx context.Context, userID, tokenID string, now time.Time) (string, error)
+	// ClearPendingEmail cancels the pending change; false means there was none
+	ClearPendingEmail(ctx context.Context, userID string) (bool, error)
 
-	// Delete user
+	// Delete user. Returns ErrLastAdmin for the only active admin.
 	Delete(ctx context.Context, userID string, hardDelete bool) error
 }
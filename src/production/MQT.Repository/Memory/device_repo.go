@@ -0,0 +1,382 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type DeviceRepository struct {
+	store *Store
+}
+
+func NewDeviceRepository(store *Store) *DeviceRepository {
+	return &DeviceRepository{store: store}
+}
+
+// CreateOrUpdateDevice creates the device, or replaces the type and meta of an
+// existing one. Its Pi must exist.
+func (r *DeviceRepository) CreateOrUpdateDevice(ctx context.Context, device hardware_models.Device) error {
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := interfaces.DeviceKey{PiID: device.PiID, DeviceID: device.DeviceID}
+	if row, ok := r.store.devices[key]; ok {
+		row.deviceType = device.DeviceType
+		row.meta = metaJSON
+		return nil
+	}
+	return r.store.insertDevice(device, metaJSON)
+}
+
+// CreateDeviceIfAbsent creates the device unless it exists. Its Pi must exist.
+func (r *DeviceRepository) CreateDeviceIfAbsent(ctx context.Context, device hardware_models.Device) (bool, error) {
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return false, err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.devices[interfaces.DeviceKey{PiID: device.PiID, DeviceID: device.DeviceID}]; ok {
+		return false, nil
+	}
+	if err := r.store.insertDevice(device, metaJSON); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// insertDevice adds a new device of an existing Pi. Callers hold s.mu.
+func (s *Store) insertDevice(device hardware_models.Device, metaJSON []byte) error {
+	if _, ok := s.pis[device.PiID]; !ok {
+		return fmt.Errorf("pi %s does not exist", device.PiID)
+	}
+	s.devices[interfaces.DeviceKey{PiID: device.PiID, DeviceID: device.DeviceID}] = &deviceRow{
+		piID:       device.PiID,
+		deviceID:   device.DeviceID,
+		deviceType: device.DeviceType,
+		meta:       metaJSON,
+		createdAt:  storedTime(device.CreatedAt),
+	}
+	return nil
+}
+
+// GetDevice returns sql.ErrNoRows when the device does not exist
+func (r *DeviceRepository) GetDevice(ctx context.Context, piID string, deviceID int) (*hardware_models.Device, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row, ok := r.store.devices[interfaces.DeviceKey{PiID: piID, DeviceID: deviceID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return row.device()
+}
+
+func (r *DeviceRepository) ExistingDevices(ctx context.Context, keys []interfaces.DeviceKey) (map[interfaces.DeviceKey]bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	existing := make(map[interfaces.DeviceKey]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := r.store.devices[key]; ok {
+			existing[key] = true
+		}
+	}
+	return existing, nil
+}
+
+func (r *DeviceRepository) ListAllDeviceKeys(ctx context.Context, piIDs []string) ([]interfaces.DeviceKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(piIDs))
+	for _, piID := range piIDs {
+		wanted[piID] = true
+	}
+	var keys []interfaces.DeviceKey
+	for key := range r.store.devices {
+		if wanted[key.PiID] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].PiID != keys[j].PiID {
+			return keys[i].PiID < keys[j].PiID
+		}
+		return keys[i].DeviceID < keys[j].DeviceID
+	})
+	return keys, nil
+}
+
+func (r *DeviceRepository) ListDevicesByPi(ctx context.Context, piID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	rows := r.store.devicesOf(piID)
+	var devices []hardware_models.Device
+	for _, row := range page(rows, opts) {
+		device, err := row.device()
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+	return paginationResult(devices, len(devices), len(rows), opts), nil
+}
+
+func (r *DeviceRepository) ListDevicesWithLatest(ctx context.Context, piID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	rows := r.store.devicesOf(piID)
+	var devices []hardware_models.DeviceWithLatest
+	for _, row := range page(rows, opts) {
+		device, err := row.device()
+		if err != nil {
+			return nil, err
+		}
+		withLatest := hardware_models.DeviceWithLatest{Device: *device}
+		if latest := r.store.latestReading(row.piID, row.deviceID); latest != nil {
+			current, err := latest.reading()
+			if err != nil {
+				return nil, err
+			}
+			// Only the time and payload of the latest reading are listed
+			current.ReceivedAt = nil
+			withLatest.Current = &current
+		}
+		devices = append(devices, withLatest)
+	}
+	return paginationResult(devices, len(devices), len(rows), opts), nil
+}
+
+// devicesOf returns a Pi's devices newest first, breaking ties by device_id.
+// Callers hold s.mu.
+func (s *Store) devicesOf(piID string) []*deviceRow {
+	var rows []*deviceRow
+	for key, row := range s.devices {
+		if key.PiID == piID {
+			rows = append(rows, row)
+		}
+	}
+	sortDevicesNewestFirst(rows)
+	return rows
+}
+
+func (r *DeviceRepository) FindDevicesByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Device, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var rows []*deviceRow
+	for _, row := range r.store.devices {
+		if userID != "" && r.store.pis[row.piID].userID != userID {
+			continue
+		}
+		if metaContains(row.meta, match) {
+			rows = append(rows, row)
+		}
+	}
+	sortDevicesNewestFirst(rows)
+	if len(rows) > limit {
+		rows = rows[:max(limit, 0)]
+	}
+
+	var devices []hardware_models.Device
+	for _, row := range rows {
+		device, err := row.device()
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+	return devices, nil
+}
+
+// UpdateDevice replaces the device's type and meta
+func (r *DeviceRepository) UpdateDevice(ctx context.Context, device hardware_models.Device) error {
+	metaJSON, err := marshalMeta(device.Meta)
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.devices[interfaces.DeviceKey{PiID: device.PiID, DeviceID: device.DeviceID}]
+	if !ok {
+		return fmt.Errorf("device not found")
+	}
+	row.deviceType = device.DeviceType
+	row.meta = metaJSON
+	return nil
+}
+
+// TouchLiveness advances the devices' last reading times and their Pis' last
+// seen times. Like the Postgres statement, it counts every existing device and
+// Pi it matched, whether or not its time moved.
+func (r *DeviceRepository) TouchLiveness(ctx context.Context, entries []interfaces.DeviceLiveness) (interfaces.LivenessResult, error) {
+	var result interfaces.LivenessResult
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	piLatest := make(map[string]time.Time)
+	for _, entry := range entries {
+		lastTs := storedTime(entry.LastTs)
+		if row, ok := r.store.devices[interfaces.DeviceKey{PiID: entry.PiID, DeviceID: entry.DeviceID}]; ok {
+			row.lastReadingAt = later(row.lastReadingAt, lastTs)
+			result.Devices++
+		}
+		if latest, ok := piLatest[entry.PiID]; !ok || lastTs.After(latest) {
+			piLatest[entry.PiID] = lastTs
+		}
+	}
+	for piID, lastTs := range piLatest {
+		if row, ok := r.store.pis[piID]; ok {
+			row.lastSeenAt = later(row.lastSeenAt, lastTs)
+			result.Pis++
+		}
+	}
+	return result, nil
+}
+
+// later returns the later of current, which may be unset, and t
+func later(current *time.Time, t time.Time) *time.Time {
+	if current != nil && current.After(t) {
+		return current
+	}
+	return &t
+}
+
+// DeleteDevice deletes the device with its readings, whatever cascade says, as
+// the Postgres foreign keys do
+func (r *DeviceRepository) DeleteDevice(ctx context.Context, piID string, deviceID int, cascade bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := interfaces.DeviceKey{PiID: piID, DeviceID: deviceID}
+	if _, ok := r.store.devices[key]; !ok {
+		return sql.ErrNoRows
+	}
+	r.store.deleteDevice(key)
+	return nil
+}
+
+// deleteDevice removes a device and its readings. Callers hold s.mu for writing.
+func (s *Store) deleteDevice(key interfaces.DeviceKey) {
+	delete(s.devices, key)
+	for readingKey := range s.readings {
+		if readingKey.piID == key.PiID && readingKey.deviceID == key.DeviceID {
+			delete(s.readings, readingKey)
+		}
+	}
+}
+
+// GetDeclaredUnits merges the units of each device's type with the device's
+// own meta.units, which win field by field
+func (r *DeviceRepository) GetDeclaredUnits(ctx context.Context, piID string) (map[int]map[string]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	declared := make(map[int]map[string]string)
+	for key, row := range r.store.devices {
+		if key.PiID != piID {
+			continue
+		}
+		merged := make(map[string]string)
+		sources := [][]byte{row.meta}
+		if deviceType, ok := r.store.deviceTypes[row.deviceType]; ok {
+			sources = [][]byte{deviceType.meta, row.meta}
+		}
+		for _, metaJSON := range sources {
+			var meta struct {
+				Units map[string]interface{} `json:"units"`
+			}
+			if err := json.Unmarshal(metaJSON, &meta); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal units: %w", err)
+			}
+			for field, unit := range meta.Units {
+				if symbol, ok := unit.(string); ok {
+					merged[field] = symbol
+				}
+			}
+		}
+		if len(merged) > 0 {
+			declared[key.DeviceID] = merged
+		}
+	}
+	return declared, nil
+}
+
+// GetDeviceType returns a device type's shared settings, or nil if none are stored
+func (r *DeviceRepository) GetDeviceType(ctx context.Context, deviceType string) (*hardware_models.DeviceType, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row, ok := r.store.deviceTypes[deviceType]
+	if !ok {
+		return nil, nil
+	}
+	meta, err := unmarshalMeta(row.meta)
+	if err != nil {
+		return nil, err
+	}
+	return &hardware_models.DeviceType{DeviceType: row.deviceType, Meta: meta, UpdatedAt: row.updatedAt}, nil
+}
+
+// UpsertDeviceType stores a device type's shared settings, replacing its meta
+func (r *DeviceRepository) UpsertDeviceType(ctx context.Context, dt *hardware_models.DeviceType) error {
+	metaJSON, err := marshalMeta(dt.Meta)
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	dt.UpdatedAt = time.Now()
+	r.store.deviceTypes[dt.DeviceType] = &deviceTypeRow{deviceType: dt.DeviceType, meta: metaJSON, updatedAt: storedTime(dt.UpdatedAt)}
+	return nil
+}
+
+func (row *deviceRow) device() (*hardware_models.Device, error) {
+	meta, err := unmarshalMeta(row.meta)
+	if err != nil {
+		return nil, err
+	}
+	return &hardware_models.Device{
+		PiID:       row.piID,
+		DeviceID:   row.deviceID,
+		DeviceType: row.deviceType,
+		Meta:       meta,
+		CreatedAt:  row.createdAt,
+	}, nil
+}
+
+// sortDevicesNewestFirst orders devices by created_at descending, breaking
+// ties by Pi and device_id so listings are stable
+func sortDevicesNewestFirst(rows []*deviceRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].createdAt.Equal(rows[j].createdAt) {
+			return rows[i].createdAt.After(rows[j].createdAt)
+		}
+		if rows[i].piID != rows[j].piID {
+			return rows[i].piID < rows[j].piID
+		}
+		return rows[i].deviceID < rows[j].deviceID
+	})
+}
@@ -0,0 +1,29 @@
+package memory_test
+
+import (
+	"testing"
+
+	conformance "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Conformance"
+	memory "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Memory"
+)
+
+func newBackend(t *testing.T) conformance.Backend {
+	store := memory.NewStore()
+	return conformance.Backend{
+		Pis:      memory.NewPiRepository(store),
+		Devices:  memory.NewDeviceRepository(store),
+		Readings: memory.NewReadingRepository(store),
+	}
+}
+
+func TestPiRepositoryConformance(t *testing.T) {
+	conformance.RunPiRepositoryTests(t, newBackend)
+}
+
+func TestDeviceRepositoryConformance(t *testing.T) {
+	conformance.RunDeviceRepositoryTests(t, newBackend)
+}
+
+func TestReadingRepositoryConformance(t *testing.T) {
+	conformance.RunReadingRepositoryTests(t, newBackend)
+}
@@ -0,0 +1,237 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+type PiRepository struct {
+	store *Store
+}
+
+func NewPiRepository(store *Store) *PiRepository {
+	return &PiRepository{store: store}
+}
+
+// CreateOrUpdatePi creates the Pi, or sets the owner of an existing one
+func (r *PiRepository) CreateOrUpdatePi(ctx context.Context, pi hardware_models.Pi) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row, ok := r.store.pis[pi.PiID]; ok {
+		row.userID = pi.UserID
+		return nil
+	}
+	r.store.pis[pi.PiID] = &piRow{piID: pi.PiID, userID: pi.UserID, meta: []byte("{}"), createdAt: storedTime(pi.CreatedAt)}
+	return nil
+}
+
+// CreateOrUpdatePis upserts a batch of Pis, setting only meta, all or nothing
+func (r *PiRepository) CreateOrUpdatePis(ctx context.Context, pis []hardware_models.Pi) ([]interfaces.PiUpsertResult, error) {
+	if len(pis) == 0 {
+		return nil, nil
+	}
+
+	metas := make([][]byte, len(pis))
+	for n, pi := range pis {
+		metaJSON, err := marshalMeta(pi.Meta)
+		if err != nil {
+			return nil, err
+		}
+		metas[n] = metaJSON
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	results := make([]interfaces.PiUpsertResult, 0, len(pis))
+	for n, pi := range pis {
+		row, ok := r.store.pis[pi.PiID]
+		if ok {
+			row.meta = metas[n]
+		} else {
+			r.store.pis[pi.PiID] = &piRow{piID: pi.PiID, meta: metas[n], createdAt: storedTime(pi.CreatedAt)}
+		}
+		results = append(results, interfaces.PiUpsertResult{PiID: pi.PiID, Created: !ok})
+	}
+	return results, nil
+}
+
+// GetPi returns sql.ErrNoRows when the Pi does not exist
+func (r *PiRepository) GetPi(ctx context.Context, piID string) (*hardware_models.Pi, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row, ok := r.store.pis[piID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return row.pi()
+}
+
+func (r *PiRepository) GetPiOwners(ctx context.Context, piIDs []string) (map[string]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	owners := make(map[string]string, len(piIDs))
+	for _, piID := range piIDs {
+		if row, ok := r.store.pis[piID]; ok {
+			owners[piID] = row.userID
+		}
+	}
+	return owners, nil
+}
+
+func (r *PiRepository) ListAllPiIDs(ctx context.Context, page interfaces.RegistryPage) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var piIDs []string
+	for piID, row := range r.store.pis {
+		if piID <= page.After || (page.OwnedOnly && row.userID == "") {
+			continue
+		}
+		if page.UpdatedSince != nil && !r.store.updatedSince(row, *page.UpdatedSince) {
+			continue
+		}
+		piIDs = append(piIDs, piID)
+	}
+	sort.Strings(piIDs)
+	if len(piIDs) > page.Limit {
+		piIDs = piIDs[:max(page.Limit, 0)]
+	}
+	return piIDs, nil
+}
+
+// updatedSince reports whether the Pi, or one of its devices, was created at
+// or after since. Callers hold s.mu.
+func (s *Store) updatedSince(row *piRow, since time.Time) bool {
+	if !row.createdAt.Before(since) {
+		return true
+	}
+	for key, device := range s.devices {
+		if key.PiID == row.piID && !device.createdAt.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PiRepository) ListPis(ctx context.Context, userID string, opts interfaces.PageOptions) (*interfaces.PaginationResult, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var rows []*piRow
+	for _, row := range r.store.pis {
+		if userID == "" || row.userID == userID {
+			rows = append(rows, row)
+		}
+	}
+	sortPisNewestFirst(rows)
+
+	var pis []hardware_models.Pi
+	for _, row := range page(rows, opts) {
+		pi, err := row.pi()
+		if err != nil {
+			return nil, err
+		}
+		pis = append(pis, *pi)
+	}
+	return paginationResult(pis, len(pis), len(rows), opts), nil
+}
+
+func (r *PiRepository) CountPisByUser(ctx context.Context, userID string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	// Unowned Pis have no user_id to match, even an empty one
+	count := 0
+	for _, row := range r.store.pis {
+		if userID != "" && row.userID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *PiRepository) FindPisByMeta(ctx context.Context, match map[string]string, userID string, limit int) ([]hardware_models.Pi, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var rows []*piRow
+	for _, row := range r.store.pis {
+		if (userID == "" || row.userID == userID) && metaContains(row.meta, match) {
+			rows = append(rows, row)
+		}
+	}
+	sortPisNewestFirst(rows)
+	if len(rows) > limit {
+		rows = rows[:max(limit, 0)]
+	}
+
+	var pis []hardware_models.Pi
+	for _, row := range rows {
+		pi, err := row.pi()
+		if err != nil {
+			return nil, err
+		}
+		pis = append(pis, *pi)
+	}
+	return pis, nil
+}
+
+// UpdatePi sets the Pi's owner
+func (r *PiRepository) UpdatePi(ctx context.Context, pi hardware_models.Pi) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.pis[pi.PiID]
+	if !ok {
+		return fmt.Errorf("pi not found")
+	}
+	row.userID = pi.UserID
+	return nil
+}
+
+// DeletePi deletes the Pi with its devices and their readings, whatever
+// cascade says, as the Postgres foreign keys do
+func (r *PiRepository) DeletePi(ctx context.Context, piID string, cascade bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.pis[piID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.store.pis, piID)
+	for key := range r.store.devices {
+		if key.PiID == piID {
+			r.store.deleteDevice(key)
+		}
+	}
+	return nil
+}
+
+func (row *piRow) pi() (*hardware_models.Pi, error) {
+	meta, err := unmarshalMeta(row.meta)
+	if err != nil {
+		return nil, err
+	}
+	return &hardware_models.Pi{PiID: row.piID, UserID: row.userID, Meta: meta, CreatedAt: row.createdAt}, nil
+}
+
+// sortPisNewestFirst orders Pis by created_at descending, breaking ties by
+// pi_id so listings are stable
+func sortPisNewestFirst(rows []*piRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].createdAt.Equal(rows[j].createdAt) {
+			return rows[i].createdAt.After(rows[j].createdAt)
+		}
+		return rows[i].piID < rows[j].piID
+	})
+}
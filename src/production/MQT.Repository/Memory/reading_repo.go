@@ -0,0 +1,628 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	hardware_models "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Models/hardware"
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// readingIterateBatchSize is how many readings IterateReadings hands to fn
+// between checks of its context, as the Postgres repository does per query
+const readingIterateBatchSize = 1000
+
+type ReadingRepository struct {
+	store *Store
+}
+
+func NewReadingRepository(store *Store) *ReadingRepository {
+	return &ReadingRepository{store: store}
+}
+
+// CreateReading returns ErrDuplicateReading if the device already has a reading
+// at its ts, and ErrReadingDeviceNotFound if the device is unknown
+func (r *ReadingRepository) CreateReading(ctx context.Context, reading hardware_models.Reading) error {
+	payloadJSON, err := json.Marshal(reading.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.insertReading(reading, payloadJSON, time.Now())
+}
+
+// CreateReadings inserts every reading it can, in order, so of two readings of
+// a batch with the same key the earlier one is stored
+func (r *ReadingRepository) CreateReadings(ctx context.Context, readings []hardware_models.Reading) (*interfaces.ReadingBatchResult, error) {
+	result := &interfaces.ReadingBatchResult{}
+	if len(readings) == 0 {
+		return result, nil
+	}
+
+	payloads := make([][]byte, len(readings))
+	for i, reading := range readings {
+		payloadJSON, err := json.Marshal(reading.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		payloads[i] = payloadJSON
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	for i, reading := range readings {
+		err := r.store.insertReading(reading, payloads[i], now)
+		if err == nil {
+			result.Inserted++
+			continue
+		}
+		reason := interfaces.ReadingFailureDuplicate
+		if err == interfaces.ErrReadingDeviceNotFound {
+			reason = interfaces.ReadingFailureDeviceNotFound
+		}
+		result.Failed = append(result.Failed, interfaces.ReadingInsertFailure{
+			Index:    i,
+			PiID:     reading.PiID,
+			DeviceID: reading.DeviceID,
+			Ts:       reading.Ts,
+			Reason:   reason,
+			Error:    err.Error(),
+		})
+	}
+	return result, nil
+}
+
+// insertReading stores a reading of an existing device, received now unless it
+// says otherwise. Callers hold s.mu for writing.
+func (s *Store) insertReading(reading hardware_models.Reading, payloadJSON []byte, now time.Time) error {
+	if _, ok := s.devices[interfaces.DeviceKey{PiID: reading.PiID, DeviceID: reading.DeviceID}]; !ok {
+		return interfaces.ErrReadingDeviceNotFound
+	}
+	ts := storedTime(reading.Ts)
+	key := readingKey{piID: reading.PiID, deviceID: reading.DeviceID, ts: ts.UnixNano()}
+	if _, ok := s.readings[key]; ok {
+		return interfaces.ErrDuplicateReading
+	}
+	receivedAt := now
+	if reading.ReceivedAt != nil {
+		receivedAt = *reading.ReceivedAt
+	}
+	s.readings[key] = &readingRow{
+		piID:       reading.PiID,
+		deviceID:   reading.DeviceID,
+		ts:         ts,
+		payload:    payloadJSON,
+		receivedAt: storedTime(receivedAt),
+	}
+	return nil
+}
+
+func (r *ReadingRepository) GetLatestReadings(ctx context.Context, piID string) ([]hardware_models.Reading, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	latest := make(map[int]*readingRow)
+	for _, row := range r.store.readings {
+		if row.piID != piID {
+			continue
+		}
+		if current, ok := latest[row.deviceID]; !ok || row.ts.After(current.ts) {
+			latest[row.deviceID] = row
+		}
+	}
+	rows := make([]*readingRow, 0, len(latest))
+	for _, row := range latest {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].deviceID < rows[j].deviceID })
+	return toReadings(rows)
+}
+
+// GetLatestReading returns the most recent reading for a device, or nil if it has none
+func (r *ReadingRepository) GetLatestReading(ctx context.Context, piID string, deviceID int) (*hardware_models.Reading, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.latestReading(piID, deviceID)
+	if row == nil {
+		return nil, nil
+	}
+	reading, err := row.reading()
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// latestReading returns a device's newest reading, or nil. Callers hold s.mu.
+func (s *Store) latestReading(piID string, deviceID int) *readingRow {
+	var latest *readingRow
+	for _, row := range s.readings {
+		if row.piID == piID && row.deviceID == deviceID && (latest == nil || row.ts.After(latest.ts)) {
+			latest = row
+		}
+	}
+	return latest
+}
+
+func (r *ReadingRepository) GetReadings(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	return r.getReadings(params)
+}
+
+// GetReadingsByDevice returns the readings of the device identified by
+// params.PiID and params.DeviceID, both of which are required
+func (r *ReadingRepository) GetReadingsByDevice(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	if params.PiID == "" || params.DeviceID == nil {
+		return nil, fmt.Errorf("pi_id and device_id are required")
+	}
+	return r.getReadings(params)
+}
+
+// getReadings serves both reading queries, which only differ in what they require
+func (r *ReadingRepository) getReadings(params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	if params.Since != nil && params.Sample > 1 {
+		return nil, fmt.Errorf("sample cannot be combined with since")
+	}
+	if params.Since == nil && params.ReceivedSince != nil {
+		if params.Sample > 1 {
+			return nil, fmt.Errorf("sample cannot be combined with received_since")
+		}
+		if params.After != nil && params.After.ReceivedAt == nil {
+			return nil, fmt.Errorf("cursor is not from a received_since query")
+		}
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	rows := r.store.matchingReadings(params)
+	switch {
+	case params.Since != nil:
+		return readingsSince(rows, params)
+	case params.ReceivedSince != nil:
+		return readingsReceivedSince(rows, params)
+	}
+
+	// Newest first, numbered the way sampling numbers them
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].ts.Equal(rows[j].ts) {
+			return rows[i].ts.After(rows[j].ts)
+		}
+		if rows[i].deviceID != rows[j].deviceID {
+			return rows[i].deviceID < rows[j].deviceID
+		}
+		return rows[i].piID < rows[j].piID
+	})
+	if params.Sample > 1 {
+		var sampled []*readingRow
+		for n, row := range rows {
+			if n%params.Sample == 0 {
+				sampled = append(sampled, row)
+			}
+		}
+		rows = sampled
+	}
+
+	readings, err := toReadings(limitRows(rows, (params.Page-1)*params.Limit, params.Limit))
+	if err != nil {
+		return nil, err
+	}
+	result := &interfaces.ReadingQueryResult{
+		Items:  readings,
+		Total:  total(rows, params),
+		Sample: params.Sample,
+	}
+	if len(readings) == params.Limit {
+		nextPageToken := strconv.Itoa(params.Page + 1)
+		result.NextPageToken = &nextPageToken
+	}
+	return result, nil
+}
+
+// readingsSince is the incremental-sync path: ts strictly after Since, or
+// after the cursor, oldest first
+func readingsSince(rows []*readingRow, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	var after []*readingRow
+	for _, row := range rows {
+		if params.After != nil {
+			cursorTs := storedTime(params.After.Ts)
+			if row.ts.After(cursorTs) || (row.ts.Equal(cursorTs) && row.deviceID > params.After.DeviceID) {
+				after = append(after, row)
+			}
+		} else if row.ts.After(*params.Since) {
+			after = append(after, row)
+		}
+	}
+	sort.Slice(after, func(i, j int) bool {
+		if !after[i].ts.Equal(after[j].ts) {
+			return after[i].ts.Before(after[j].ts)
+		}
+		return after[i].deviceID < after[j].deviceID
+	})
+
+	readings, err := toReadings(limitRows(after, 0, params.Limit))
+	if err != nil {
+		return nil, err
+	}
+	result := &interfaces.ReadingQueryResult{Items: readings, Total: total(after, params)}
+	if len(readings) > 0 {
+		last := readings[len(readings)-1]
+		nextPageToken := interfaces.ReadingCursor{Ts: last.Ts, DeviceID: last.DeviceID}.Encode()
+		result.NextPageToken = &nextPageToken
+	} else if params.After != nil {
+		nextPageToken := params.After.Encode()
+		result.NextPageToken = &nextPageToken
+	}
+	return result, nil
+}
+
+// readingsReceivedSince is the arrival-order sync path: received_at strictly
+// after ReceivedSince, or after the cursor, in arrival order
+func readingsReceivedSince(rows []*readingRow, params interfaces.ReadingQueryParams) (*interfaces.ReadingQueryResult, error) {
+	var after []*readingRow
+	for _, row := range rows {
+		if params.After != nil {
+			cursor := &readingRow{ts: storedTime(params.After.Ts), deviceID: params.After.DeviceID, receivedAt: storedTime(*params.After.ReceivedAt)}
+			if receivedBefore(cursor, row) {
+				after = append(after, row)
+			}
+		} else if row.receivedAt.After(*params.ReceivedSince) {
+			after = append(after, row)
+		}
+	}
+	sort.Slice(after, func(i, j int) bool { return receivedBefore(after[i], after[j]) })
+
+	readings, err := toReadings(limitRows(after, 0, params.Limit))
+	if err != nil {
+		return nil, err
+	}
+	result := &interfaces.ReadingQueryResult{Items: readings, Total: total(after, params)}
+	if len(readings) > 0 {
+		last := readings[len(readings)-1]
+		nextPageToken := interfaces.ReadingCursor{Ts: last.Ts, DeviceID: last.DeviceID, ReceivedAt: last.ReceivedAt}.Encode()
+		result.NextPageToken = &nextPageToken
+	} else if params.After != nil {
+		nextPageToken := params.After.Encode()
+		result.NextPageToken = &nextPageToken
+	}
+	return result, nil
+}
+
+// receivedBefore orders readings by the (received_at, device_id, ts) key
+func receivedBefore(a, b *readingRow) bool {
+	if !a.receivedAt.Equal(b.receivedAt) {
+		return a.receivedAt.Before(b.receivedAt)
+	}
+	if a.deviceID != b.deviceID {
+		return a.deviceID < b.deviceID
+	}
+	return a.ts.Before(b.ts)
+}
+
+// total counts rows when params.IncludeTotal asks for it, and is nil otherwise
+func total(rows []*readingRow, params interfaces.ReadingQueryParams) *int {
+	if !params.IncludeTotal {
+		return nil
+	}
+	count := len(rows)
+	return &count
+}
+
+// limitRows applies an OFFSET and LIMIT to rows
+func limitRows(rows []*readingRow, offset, limit int) []*readingRow {
+	if offset < 0 || offset >= len(rows) || limit <= 0 {
+		return nil
+	}
+	return rows[offset:min(offset+limit, len(rows))]
+}
+
+// matchingReadings returns the readings matching the pi, device and [From, To)
+// filters of params, in no particular order. Callers hold s.mu.
+func (s *Store) matchingReadings(params interfaces.ReadingQueryParams) []*readingRow {
+	var rows []*readingRow
+	for _, row := range s.readings {
+		if params.PiID != "" && row.piID != params.PiID {
+			continue
+		}
+		if params.DeviceID != nil && row.deviceID != *params.DeviceID {
+			continue
+		}
+		if !inRange(row.ts, params) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// inRange reports whether ts is within the From and To of params
+func inRange(ts time.Time, params interfaces.ReadingQueryParams) bool {
+	if params.From != nil && ts.Before(*params.From) {
+		return false
+	}
+	if params.To != nil {
+		if params.InclusiveTo {
+			return !ts.After(*params.To)
+		}
+		return ts.Before(*params.To)
+	}
+	return true
+}
+
+// IterateReadings hands fn a snapshot of the matching readings in (ts, pi_id,
+// device_id) order. The store is not locked while fn runs, so fn may use the
+// repositories itself.
+func (r *ReadingRepository) IterateReadings(ctx context.Context, params interfaces.ReadingQueryParams, fn func(hardware_models.Reading) error) error {
+	r.store.mu.RLock()
+	var rows []*readingRow
+	for _, row := range r.store.matchingReadings(params) {
+		if params.Since == nil || row.ts.After(*params.Since) {
+			rows = append(rows, row)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].ts.Equal(rows[j].ts) {
+			return rows[i].ts.Before(rows[j].ts)
+		}
+		if rows[i].piID != rows[j].piID {
+			return rows[i].piID < rows[j].piID
+		}
+		return rows[i].deviceID < rows[j].deviceID
+	})
+	if params.Limit > 0 && len(rows) > params.Limit {
+		rows = rows[:params.Limit]
+	}
+
+	for n, row := range rows {
+		if n%readingIterateBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		reading, err := row.reading()
+		if err != nil {
+			return err
+		}
+		if err := fn(reading); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *ReadingRepository) GetSummaryStats(ctx context.Context, params interfaces.ReadingQueryParams) (*interfaces.SummaryStats, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stats := &interfaces.SummaryStats{}
+	stats.Count, stats.FirstTS, stats.LastTS = span(r.store.matchingReadings(params))
+
+	// Per-device stats cover every device of the Pi, whatever DeviceID says
+	if params.PiID != "" {
+		byDevice := make(map[int][]*readingRow)
+		piParams := params
+		piParams.DeviceID = nil
+		for _, row := range r.store.matchingReadings(piParams) {
+			byDevice[row.deviceID] = append(byDevice[row.deviceID], row)
+		}
+		deviceIDs := make([]int, 0, len(byDevice))
+		for deviceID := range byDevice {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+		sort.Ints(deviceIDs)
+		for _, deviceID := range deviceIDs {
+			deviceStat := interfaces.DeviceStats{PiID: params.PiID, DeviceID: strconv.Itoa(deviceID)}
+			deviceStat.Count, deviceStat.FirstTS, deviceStat.LastTS = span(byDevice[deviceID])
+			stats.ByDevice = append(stats.ByDevice, deviceStat)
+		}
+	}
+	return stats, nil
+}
+
+// span returns how many rows there are and their earliest and latest ts
+func span(rows []*readingRow) (int64, *time.Time, *time.Time) {
+	if len(rows) == 0 {
+		return 0, nil, nil
+	}
+	first, last := rows[0].ts, rows[0].ts
+	for _, row := range rows[1:] {
+		if row.ts.Before(first) {
+			first = row.ts
+		}
+		if row.ts.After(last) {
+			last = row.ts
+		}
+	}
+	return int64(len(rows)), &first, &last
+}
+
+// GetPayloadKeys counts the top-level keys of the object payloads in the
+// window, most frequent first
+func (r *ReadingRepository) GetPayloadKeys(ctx context.Context, query interfaces.PayloadKeyQuery) ([]interfaces.PayloadKeyStats, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	counts := make(map[string]*interfaces.PayloadKeyStats)
+	for _, row := range r.store.readings {
+		if query.DeviceType != "" {
+			device, ok := r.store.devices[interfaces.DeviceKey{PiID: row.piID, DeviceID: row.deviceID}]
+			if !ok || device.deviceType != query.DeviceType {
+				continue
+			}
+		} else if row.piID != query.PiID || row.deviceID != query.DeviceID {
+			continue
+		}
+		if row.ts.Before(query.From) || !row.ts.Before(query.To) {
+			continue
+		}
+
+		var payload interface{}
+		decoder := json.NewDecoder(bytes.NewReader(row.payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+		object, ok := payload.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range object {
+			stat, ok := counts[key]
+			if !ok {
+				stat = &interfaces.PayloadKeyStats{Key: key, SampleType: jsonType(value)}
+				counts[key] = stat
+			}
+			stat.Occurrences++
+			// MIN(jsonb_typeof) picks the alphabetically first type
+			if valueType := jsonType(value); valueType < stat.SampleType {
+				stat.SampleType = valueType
+			}
+		}
+	}
+
+	keys := []interfaces.PayloadKeyStats{}
+	for _, stat := range counts {
+		keys = append(keys, *stat)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Occurrences != keys[j].Occurrences {
+			return keys[i].Occurrences > keys[j].Occurrences
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys, nil
+}
+
+// jsonType names the JSON type of a decoded value as jsonb_typeof does
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// GetDeviceReadingSummary counts exactly; above exactLimit the count is still
+// reported as approximate, as the Postgres estimate would be
+func (r *ReadingRepository) GetDeviceReadingSummary(ctx context.Context, piID string, deviceID int, exactLimit int64) (*interfaces.DeviceReadingSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	summary := &interfaces.DeviceReadingSummary{}
+	summary.Count, summary.FirstTS, summary.LastTS = span(r.store.matchingReadings(interfaces.ReadingQueryParams{PiID: piID, DeviceID: &deviceID}))
+	summary.Approximate = summary.Count > exactLimit
+	return summary, nil
+}
+
+func (r *ReadingRepository) DeleteReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rows := r.store.deviceReadingsInRange(piID, deviceID, start, end)
+	for _, row := range rows {
+		delete(r.store.readings, row.key())
+	}
+	return int64(len(rows)), nil
+}
+
+func (r *ReadingRepository) CountReadingsByTimeRange(ctx context.Context, piID string, deviceID int, start, end time.Time, limit int64) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := int64(len(r.store.deviceReadingsInRange(piID, deviceID, start, end)))
+	if limit > 0 && count > limit {
+		return limit, nil
+	}
+	return count, nil
+}
+
+func (r *ReadingRepository) DeleteReadingsInChunks(ctx context.Context, piID string, deviceID int, start, end time.Time, chunkSize int, fn func(deleted int64) error) (int64, error) {
+	if chunkSize < 1 {
+		return 0, fmt.Errorf("chunk size must be at least 1")
+	}
+
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		deleted := r.deleteOldest(piID, deviceID, start, end, chunkSize)
+		total += deleted
+
+		if err := fn(deleted); err != nil {
+			return total, err
+		}
+		if deleted < int64(chunkSize) {
+			return total, nil
+		}
+	}
+}
+
+// deleteOldest deletes up to n of the oldest readings in [start, end)
+func (r *ReadingRepository) deleteOldest(piID string, deviceID int, start, end time.Time, n int) int64 {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rows := r.store.deviceReadingsInRange(piID, deviceID, start, end)
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ts.Before(rows[j].ts) })
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	for _, row := range rows {
+		delete(r.store.readings, row.key())
+	}
+	return int64(len(rows))
+}
+
+// deviceReadingsInRange returns a device's readings in [start, end). Callers
+// hold s.mu.
+func (s *Store) deviceReadingsInRange(piID string, deviceID int, start, end time.Time) []*readingRow {
+	return s.matchingReadings(interfaces.ReadingQueryParams{PiID: piID, DeviceID: &deviceID, From: &start, To: &end})
+}
+
+func (row *readingRow) key() readingKey {
+	return readingKey{piID: row.piID, deviceID: row.deviceID, ts: row.ts.UnixNano()}
+}
+
+func (row *readingRow) reading() (hardware_models.Reading, error) {
+	receivedAt := row.receivedAt
+	reading := hardware_models.Reading{PiID: row.piID, DeviceID: row.deviceID, Ts: row.ts, ReceivedAt: &receivedAt}
+	if err := hardware_models.DecodePayload(row.payload, &reading.Payload); err != nil {
+		return reading, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return reading, nil
+}
+
+func toReadings(rows []*readingRow) ([]hardware_models.Reading, error) {
+	var readings []hardware_models.Reading
+	for _, row := range rows {
+		reading, err := row.reading()
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
@@ -0,0 +1,141 @@
+// Package memory holds Pis, devices and readings in process memory. It
+// behaves like the Postgres repositories, as checked by the conformance suite,
+// and is meant for tests and local experiments: nothing survives a restart.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	interfaces "gitlab.com/maplesense1/mpt.mqtt_server/src/production/MQT.Repository/Interfaces"
+)
+
+// Store is the shared state of the in-memory repositories. Like the foreign
+// keys of the Postgres schema, it keeps devices to existing Pis and readings
+// to existing devices, and deleting a Pi or device deletes what belongs to it.
+type Store struct {
+	mu          sync.RWMutex
+	pis         map[string]*piRow
+	devices     map[interfaces.DeviceKey]*deviceRow
+	deviceTypes map[string]*deviceTypeRow
+	readings    map[readingKey]*readingRow
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		pis:         make(map[string]*piRow),
+		devices:     make(map[interfaces.DeviceKey]*deviceRow),
+		deviceTypes: make(map[string]*deviceTypeRow),
+		readings:    make(map[readingKey]*readingRow),
+	}
+}
+
+type piRow struct {
+	piID       string
+	userID     string // "" for a Pi without an owner
+	meta       []byte
+	createdAt  time.Time
+	lastSeenAt *time.Time
+}
+
+type deviceRow struct {
+	piID          string
+	deviceID      int
+	deviceType    string
+	meta          []byte
+	createdAt     time.Time
+	lastReadingAt *time.Time
+}
+
+type deviceTypeRow struct {
+	deviceType string
+	meta       []byte
+	updatedAt  time.Time
+}
+
+// readingKey is the primary key of a reading; ts is in Unix nanoseconds
+type readingKey struct {
+	piID     string
+	deviceID int
+	ts       int64
+}
+
+type readingRow struct {
+	piID       string
+	deviceID   int
+	ts         time.Time
+	payload    []byte
+	receivedAt time.Time
+}
+
+// storedTime rounds t to the microseconds a timestamptz column keeps, so two
+// times Postgres can't tell apart collide here too
+func storedTime(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
+
+// marshalMeta encodes meta as it is stored, nil as an empty object
+func marshalMeta(meta map[string]interface{}) ([]byte, error) {
+	if meta == nil {
+		return []byte("{}"), nil
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meta: %w", err)
+	}
+	return metaJSON, nil
+}
+
+// unmarshalMeta decodes stored meta, leaving empty objects as nil
+func unmarshalMeta(metaJSON []byte) (map[string]interface{}, error) {
+	var meta map[string]interface{}
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	return meta, nil
+}
+
+// metaContains reports whether stored meta has every key of match with that
+// string value, as JSONB containment does
+func metaContains(metaJSON []byte, match map[string]string) bool {
+	var meta map[string]interface{}
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return false
+	}
+	for key, want := range match {
+		if got, ok := meta[key].(string); !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// page returns the items of page of a listing, pages counting from 1
+func page[T any](items []T, opts interfaces.PageOptions) []T {
+	offset := (opts.Page - 1) * opts.PageSize
+	if offset < 0 || offset >= len(items) || opts.PageSize <= 0 {
+		return nil
+	}
+	end := min(offset+opts.PageSize, len(items))
+	return items[offset:end]
+}
+
+// paginationResult builds a listing's result like the Postgres repositories:
+// a next page whenever the page is full, and the total only when asked for
+func paginationResult(items interface{}, count, total int, opts interfaces.PageOptions) *interfaces.PaginationResult {
+	result := &interfaces.PaginationResult{Items: items}
+	if opts.IncludeTotal {
+		result.Total = &total
+	}
+	if count == opts.PageSize {
+		nextPage := opts.Page + 1
+		result.NextPage = &nextPage
+	}
+	return result
+}